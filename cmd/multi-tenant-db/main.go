@@ -1,9 +1,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
 	// Swagger imports
@@ -11,6 +19,7 @@ import (
 	"github.com/swaggo/http-swagger"
 
 	"multitenant-db/internal/api"
+	"multitenant-db/internal/audit"
 	"multitenant-db/internal/config"
 	"multitenant-db/internal/logger"
 	"multitenant-db/internal/mysql"
@@ -34,7 +43,41 @@ func (adapter *DatabaseManagerAdapter) GetActiveDatabases() map[string]interface
 
 // GetOrCreateDatabase creates a database for the given idx
 func (adapter *DatabaseManagerAdapter) GetOrCreateDatabase(idx string) (interface{}, error) {
-	return adapter.handler.GetDatabaseManager().GetOrCreateDatabase(idx)
+	db, err := adapter.handler.GetDatabaseManager().GetOrCreateDatabase(idx)
+	if errors.Is(err, mysql.ErrTenantLimitReached) {
+		return nil, tenantLimitError(err)
+	}
+	return db, err
+}
+
+// tenantLimitError turns a mysql.ErrTenantLimitReached into api.ErrTenantLimitReached
+func tenantLimitError(err error) error {
+	return rewrapError(err, mysql.ErrTenantLimitReached, api.ErrTenantLimitReached)
+}
+
+// rewrapError turns err, which wraps from, into an error wrapping to, keeping the detail that
+// follows the shared message rather than repeating it
+func rewrapError(err error, from error, to error) error {
+	return fmt.Errorf("%w%s", to, strings.TrimPrefix(err.Error(), from.Error()))
+}
+
+// CreateDatabase creates a new database for idx, optionally seeded, and applies schemaSQL to it
+func (adapter *DatabaseManagerAdapter) CreateDatabase(idx string, seed bool, schemaSQL string) error {
+	err := adapter.handler.GetDatabaseManager().CreateDatabase(idx, seed, schemaSQL)
+	switch {
+	case errors.Is(err, mysql.ErrTenantLimitReached):
+		return tenantLimitError(err)
+	case errors.Is(err, mysql.ErrDatabaseExists):
+		return fmt.Errorf("%w: %v", api.ErrDatabaseExists, err)
+	case errors.Is(err, mysql.ErrInvalidSchema):
+		return fmt.Errorf("%w: %v", api.ErrInvalidSchema, err)
+	}
+	return err
+}
+
+// HasDatabase reports whether a database exists for the given idx without creating it
+func (adapter *DatabaseManagerAdapter) HasDatabase(idx string) bool {
+	return adapter.handler.GetDatabaseManager().HasDatabase(idx)
 }
 
 // DeleteDatabase deletes a database for the given idx
@@ -47,12 +90,269 @@ func (adapter *DatabaseManagerAdapter) ListDatabases() []string {
 	return adapter.handler.GetDatabaseManager().ListDatabases()
 }
 
+// IsFileBacked reports whether the database for idx is stored on disk
+func (adapter *DatabaseManagerAdapter) IsFileBacked(idx string) bool {
+	return adapter.handler.GetDatabaseManager().IsFileBacked(idx)
+}
+
+// SnapshotDatabase writes a consistent copy of the database for idx to destPath
+func (adapter *DatabaseManagerAdapter) SnapshotDatabase(idx string, destPath string) error {
+	return adapter.handler.GetDatabaseManager().SnapshotDatabase(idx, destPath)
+}
+
+// SetAlias makes alias resolve to the same database as target
+func (adapter *DatabaseManagerAdapter) SetAlias(alias, target string) error {
+	err := adapter.handler.GetDatabaseManager().SetAlias(alias, target)
+	if errors.Is(err, mysql.ErrInvalidAlias) {
+		return fmt.Errorf("%w: %v", api.ErrInvalidAlias, err)
+	}
+	return err
+}
+
+// Aliases returns the alias -> target mappings
+func (adapter *DatabaseManagerAdapter) Aliases() map[string]string {
+	return adapter.handler.GetDatabaseManager().Aliases()
+}
+
+// SeedSampleData creates any missing sample tables and rows for idx
+func (adapter *DatabaseManagerAdapter) SeedSampleData(idx string) (map[string]int64, error) {
+	return adapter.handler.GetDatabaseManager().SeedSampleData(idx)
+}
+
+// LoadRows bulk-inserts the rows read from next into table for idx, reporting the rows that failed
+func (adapter *DatabaseManagerAdapter) LoadRows(idx, table string, columns []string, next func() (int, []interface{}, error)) (int64, []api.LoadRowError, error) {
+	loaded, rowErrors, err := adapter.handler.GetDatabaseManager().LoadRows(idx, table, columns, next)
+	if errors.Is(err, mysql.ErrInvalidLoad) {
+		return loaded, nil, fmt.Errorf("%w: %v", api.ErrInvalidLoad, err)
+	}
+	if err != nil {
+		return loaded, nil, err
+	}
+	apiErrors := make([]api.LoadRowError, len(rowErrors))
+	for i, rowErr := range rowErrors {
+		apiErrors[i] = api.LoadRowError{Row: rowErr.Row, Message: rowErr.Message}
+	}
+	return loaded, apiErrors, nil
+}
+
+// TruncateDatabase deletes all rows from the user tables for idx, keeping the schema
+func (adapter *DatabaseManagerAdapter) TruncateDatabase(idx string, resetSequences bool) ([]string, error) {
+	tables, err := adapter.handler.GetDatabaseManager().TruncateDatabase(idx, resetSequences)
+	if errors.Is(err, mysql.ErrDestructiveStatement) {
+		return nil, fmt.Errorf("%w: %v", api.ErrDestructiveStatement, err)
+	}
+	return tables, err
+}
+
+// CopyDatabase copies the tables and rows of srcIdx into dstIdx
+func (adapter *DatabaseManagerAdapter) CopyDatabase(srcIdx, dstIdx string) (map[string]int64, error) {
+	return adapter.handler.GetDatabaseManager().CopyDatabase(srcIdx, dstIdx)
+}
+
+// ReplayQueries re-runs logged statements against the database for idx, or a scratch copy of it on a dry run
+func (adapter *DatabaseManagerAdapter) ReplayQueries(idx string, queries []string, dryRun bool) ([]api.ReplayResult, error) {
+	results, err := adapter.handler.ReplayQueries(idx, queries, dryRun)
+	if err != nil {
+		return nil, err
+	}
+	replayed := make([]api.ReplayResult, len(results))
+	for i, result := range results {
+		replayed[i] = api.ReplayResult{Skipped: result.Skipped, RowsAffected: result.RowsAffected, Err: result.Err}
+	}
+	return replayed, nil
+}
+
+// LastError returns the most recent error recorded for idx, or nil if there is none
+func (adapter *DatabaseManagerAdapter) LastError(idx string) *api.TenantError {
+	lastError, ok := adapter.handler.GetDatabaseManager().LastError(idx)
+	if !ok {
+		return nil
+	}
+	return &api.TenantError{Message: lastError.Message, At: lastError.At}
+}
+
+// LastQuery returns a preview of the most recent statement idx ran, or nil if there is none
+func (adapter *DatabaseManagerAdapter) LastQuery(idx string) *api.TenantQuery {
+	lastQuery, ok := adapter.handler.GetDatabaseManager().LastQuery(idx)
+	if !ok {
+		return nil
+	}
+	return &api.TenantQuery{Query: lastQuery.Query, At: lastQuery.At}
+}
+
+// DatabasesModifiedAt returns when a database was last created or removed
+func (adapter *DatabaseManagerAdapter) DatabasesModifiedAt() time.Time {
+	return adapter.handler.GetDatabaseManager().DatabasesModifiedAt()
+}
+
+// SchemaModifiedAt returns when the schema of idx last changed, or the zero time if it does not exist
+func (adapter *DatabaseManagerAdapter) SchemaModifiedAt(idx string) time.Time {
+	modified, _ := adapter.handler.GetDatabaseManager().SchemaModifiedAt(idx)
+	return modified
+}
+
+// LastAccessedAt returns when the database for idx was last used, or the zero time if it is not open
+func (adapter *DatabaseManagerAdapter) LastAccessedAt(idx string) time.Time {
+	accessed, _ := adapter.handler.GetDatabaseManager().LastAccessedAt(idx)
+	return accessed
+}
+
+// ListIndexes returns the indexes on the tables of idx
+func (adapter *DatabaseManagerAdapter) ListIndexes(idx string) ([]api.IndexInfo, error) {
+	indexes, err := adapter.handler.GetDatabaseManager().ListIndexes(idx)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]api.IndexInfo, len(indexes))
+	for i, index := range indexes {
+		result[i] = api.IndexInfo{
+			Name:    index.Name,
+			Table:   index.Table,
+			Unique:  index.Unique,
+			Columns: index.Columns,
+		}
+	}
+	return result, nil
+}
+
+// CompareSchemas returns how the schema of sourceIdx differs from the schema of targetIdx
+func (adapter *DatabaseManagerAdapter) CompareSchemas(sourceIdx, targetIdx string) (*api.SchemaDiff, error) {
+	diff, err := adapter.handler.GetDatabaseManager().CompareSchemas(sourceIdx, targetIdx)
+	if err != nil {
+		return nil, err
+	}
+	result := &api.SchemaDiff{
+		TablesOnlyInSource:  diff.TablesOnlyInSource,
+		TablesOnlyInTarget:  diff.TablesOnlyInTarget,
+		ColumnsOnlyInSource: make([]api.SchemaColumn, len(diff.ColumnsOnlyInSource)),
+		ColumnsOnlyInTarget: make([]api.SchemaColumn, len(diff.ColumnsOnlyInTarget)),
+		TypeMismatches:      make([]api.SchemaTypeMismatch, len(diff.TypeMismatches)),
+		Identical:           diff.Identical(),
+	}
+	for i, column := range diff.ColumnsOnlyInSource {
+		result.ColumnsOnlyInSource[i] = api.SchemaColumn{Table: column.Table, Column: column.Column, Type: column.Type}
+	}
+	for i, column := range diff.ColumnsOnlyInTarget {
+		result.ColumnsOnlyInTarget[i] = api.SchemaColumn{Table: column.Table, Column: column.Column, Type: column.Type}
+	}
+	for i, mismatch := range diff.TypeMismatches {
+		result.TypeMismatches[i] = api.SchemaTypeMismatch{
+			Table:      mismatch.Table,
+			Column:     mismatch.Column,
+			SourceType: mismatch.SourceType,
+			TargetType: mismatch.TargetType,
+		}
+	}
+	return result, nil
+}
+
+// ExecuteQuery runs a parameterized query against the database for idx, rewritten for SQLite as
+// statements from MySQL clients are
+func (adapter *DatabaseManagerAdapter) ExecuteQuery(idx string, query string, args []interface{}) (*api.QueryResponse, error) {
+	result, err := adapter.handler.ExecuteQuery(idx, query, args)
+	switch {
+	case errors.Is(err, mysql.ErrDestructiveStatement):
+		return nil, fmt.Errorf("%w: %v", api.ErrDestructiveStatement, err)
+	case errors.Is(err, mysql.ErrInvalidQuery):
+		return nil, rewrapError(err, mysql.ErrInvalidQuery, api.ErrInvalidQuery)
+	case err != nil:
+		return nil, err
+	}
+	return &api.QueryResponse{
+		Columns:      result.Columns,
+		Rows:         result.Rows,
+		RowsAffected: result.RowsAffected,
+		LastInsertID: result.LastInsertID,
+		Debug:        &api.QueryDebug{SQL: result.SQL, Idx: result.Idx},
+	}, nil
+}
+
+// StreamQuery runs a read-only query against the database for idx, calling fn for each row
+func (adapter *DatabaseManagerAdapter) StreamQuery(idx string, query string, fn func(columns []string, values []interface{}) error) error {
+	return adapter.handler.GetDatabaseManager().StreamQuery(idx, query, fn)
+}
+
+// GetQueryStats returns a snapshot of the query counters
+func (adapter *DatabaseManagerAdapter) GetQueryStats() *api.QueryStats {
+	snapshot := adapter.handler.GetQueryStats().Snapshot()
+	durations := make([]api.QueryDuration, len(snapshot.Durations))
+	for i, d := range snapshot.Durations {
+		durations[i] = api.QueryDuration{
+			Idx:           d.Idx,
+			StatementType: d.StatementType,
+			Status:        d.Status,
+			BucketCounts:  d.BucketCounts,
+			Sum:           d.Sum,
+			Count:         d.Count,
+		}
+	}
+	return &api.QueryStats{
+		TotalQueries:     snapshot.TotalQueries,
+		QueriesPerSecond: snapshot.QueriesPerSecond,
+		QPSWindow:        mysql.QPSWindow,
+		TenantQueries:    snapshot.TenantQueries,
+		DurationBuckets:  mysql.QueryDurationBuckets,
+		Durations:        durations,
+	}
+}
+
+// DatabaseSize returns the approximate size in bytes of the database for idx
+func (adapter *DatabaseManagerAdapter) DatabaseSize(idx string) (int64, error) {
+	return adapter.handler.GetDatabaseManager().DatabaseSize(idx)
+}
+
 // GetQueryLogger returns the query logger
 func (adapter *DatabaseManagerAdapter) GetQueryLogger() interface{} {
 	return adapter.handler.GetQueryLogger()
 }
 
+// loadConfig builds a configuration from defaults, the config file at path (if set) and
+// environment variables
+func loadConfig(path string) (*config.Config, error) {
+	cfg := config.NewConfig()
+	if path != "" {
+		if err := cfg.LoadFromFile(path); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+	if err := cfg.LoadFromEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// reloadConfig re-reads the configuration, applies overrides and swaps the runtime-safe
+// settings into handler, logging and returning each setting that changed
+func reloadConfig(path string, handler *mysql.Handler, overrides func(*config.Config), logger *log.Logger) ([]string, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		overrides(cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	changes := handler.ReloadConfig(cfg)
+	if len(changes) == 0 {
+		logger.Printf("Configuration reloaded, no changes")
+	}
+	for _, change := range changes {
+		logger.Printf("Configuration reloaded: %s", change)
+	}
+	return changes, nil
+}
+
 func main() {
+	// "version" subcommand, handled before flags so it never starts the server
+	if len(os.Args) > 1 && os.Args[1] == "version" {
+		printVersion(os.Stdout)
+		return
+	}
+	
 	// Parse command line flags
 	var (
 		dbType     = flag.String("default-db-type", "", "Default database type (sqlite or mysql)")
@@ -63,24 +363,123 @@ func main() {
 		dbPassword = flag.String("default-db-password", "", "MySQL password (for mysql type)")
 		dbName     = flag.String("default-db-name", "", "MySQL database name (for mysql type)")
 		dbSSLMode  = flag.String("default-db-ssl-mode", "", "MySQL SSL mode (for mysql type)")
+		dbMaxOpen  = flag.Int("default-db-max-open-conns", 0, "MySQL connection pool size (for mysql type, 0 keeps the default)")
+		dbMaxIdle  = flag.Int("default-db-max-idle-conns", 0, "Idle MySQL connections kept for reuse (for mysql type, 0 keeps the default)")
+		dbLifetime = flag.Duration("default-db-conn-max-lifetime", 0, "Maximum time a MySQL connection is reused (for mysql type, 0 keeps the default)")
 		authUser   = flag.String("auth-username", "", "Username for MySQL protocol authentication")
 		authPass   = flag.String("auth-password", "", "Password for MySQL protocol authentication")
 		httpPort   = flag.Int("http-port", 8080, "HTTP server port")
 		mysqlPort  = flag.Int("mysql-port", 3306, "MySQL protocol server port")
+		idleTTL    = flag.Duration("tenant-idle-timeout", 0, "Evict tenant databases idle for longer than this (0 disables)")
+		tenantTTL  = flag.Duration("tenant-ttl", 0, "Delete tenant databases untouched for longer than this (0 disables)")
+		webhookURL = flag.String("eviction-webhook-url", "", "URL to notify when a tenant database is evicted or expires")
+		maxTenants = flag.Int("max-tenant-databases", 0, "Maximum open tenant databases, excluding the default (0 disables)")
+		noCreate   = flag.Bool("no-autocreate-tenants", false, "Refuse USE and SET @idx for tenants that do not exist instead of creating them on first use")
+		resolvers  = flag.String("tenant-resolvers", "", "Comma-separated sources of a session's tenant in priority order (variable, attribute, username)")
+		userAccess = flag.String("tenant-user-access", "", "Tenants each user may select through the idx attribute or a username prefix, as user=idx1|idx2,user2=* (empty trusts every login)")
+		defTenant  = flag.String("default-tenant", "", "Tenant of sessions no resolver binds (empty means the default database)")
+		limitMode  = flag.String("tenant-limit-mode", "", "At the tenant limit: reject new tenants or evict the least recently used (reject or evict)")
+		maxLogDBs  = flag.Int("max-query-log-databases", 0, "Maximum open per-tenant query log databases, closing the least recently used (0 disables)")
+		logDir     = flag.String("query-log-dir", "", "Directory of the per-tenant query log databases (empty keeps them in memory)")
+		logShards  = flag.Int("query-log-shard-levels", 0, "Levels of hash-named subdirectories query log databases are spread over (0 keeps them flat)")
+		colocate   = flag.Bool("query-log-colocate", false, "Keep each tenant's query log in a __query_logs table of its own database")
+		affinity   = flag.Bool("tenant-connection-affinity", false, "Serialize each tenant's statements on one dedicated connection")
+		timeZone   = flag.String("default-time-zone", "", "time_zone sessions start with: SYSTEM, an offset such as +00:00, or a named zone")
+		sessionGC  = flag.Duration("session-gc-interval", config.DefaultSessionGCInterval, "How often sessions without an open connection are removed (0 disables)")
+		graceTime  = flag.Duration("shutdown-grace-timeout", 0, "How long shutdown waits for statements in flight before closing their connections (0 keeps the default)")
+		maxRows    = flag.Int("max-result-rows", 0, "Maximum rows returned by a single query (0 disables)")
+		lowerCase  = flag.Bool("lower-case-table-names", false, "Resolve table names case-insensitively")
+		noCompat   = flag.Bool("no-mysql-compat", false, "Pass MySQL-only clauses such as FOR UPDATE to SQLite instead of rewriting them")
+		blockDest  = flag.Bool("block-destructive", false, "Reject DROP, TRUNCATE and DELETE without WHERE on every tenant")
+		destExempt = flag.String("block-destructive-exempt", "", "Comma-separated tenants (idx) still allowed destructive statements")
+		stmtMS     = flag.Int("statement-timeout-ms", 0, "Maximum run time of a single statement in milliseconds (0 disables)")
+		slowMS     = flag.Int("slow-query-ms", 0, "Run time in milliseconds from which a statement counts as slow (0 keeps the default)")
+		explain    = flag.Bool("slow-query-explain", false, "Store the EXPLAIN QUERY PLAN of slow statements in the query log")
+		noParams   = flag.Bool("no-log-bind-params", false, "Do not log prepared-statement arguments")
+		skipSess   = flag.Bool("query-log-skip-session", false, "Keep SET, USE, SHOW VARIABLES and SELECT @@var out of the query log")
+		redaction  = flag.String("bind-param-redaction", "", "Mask logged prepared-statement arguments (none, redact or hash)")
+		maxPacket  = flag.Int("max-allowed-packet", 0, "Largest query payload accepted, in bytes (0 keeps the default)")
+		emptyQuery = flag.String("empty-query-mode", "", "Answer empty queries with OK or MySQL's \"Query was empty\" error (ok or error)")
+		cacheSize  = flag.Int("sqlite-cache-size", 0, "PRAGMA cache_size for tenant databases (pages, or KiB when negative; 0 keeps the default)")
+		mmapSize   = flag.Int("sqlite-mmap-size", 0, "PRAGMA mmap_size for tenant databases in bytes (0 keeps the default)")
+		sampleRows = flag.Int("sample-data-rows", config.DefaultSampleDataRows, "Sample users and products seeded into each new database")
+		auditSink  = flag.String("audit-log", "", "Audit administrative actions to stdout or the given file (empty disables)")
+		logMirror  = flag.Bool("query-log-to-stdout", false, "Also write each logged query to the application log as a JSON line")
+		apiDebug   = flag.Bool("api-debug", false, "Allow ?debug=true on /api/query to echo the executed SQL and resolved tenant")
+		showVer    = flag.Bool("version", false, "Print version information and exit")
+		checkCfg   = flag.Bool("check-config", false, "Load and validate the configuration, print it and exit without starting the server")
+		cfgFile    = flag.String("config", "", "Configuration file of KEY=VALUE lines, re-read on SIGHUP (defaults to $CONFIG_FILE)")
 	)
 	flag.Parse()
+	
+	if *showVer {
+		printVersion(os.Stdout)
+		return
+	}
 
 	// Setup logger
 	appLogger := logger.Setup()
-	appLogger.Println("Starting Multitenant DB server...")
+	if !*checkCfg {
+		appLogger.Println("Starting Multitenant DB server...")
+	}
 	
-	// Load configuration
-	cfg := config.NewConfig()
+	// Load configuration from the config file, if any, and environment variables
+	configPath := *cfgFile
+	if configPath == "" {
+		configPath = os.Getenv("CONFIG_FILE")
+	}
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		appLogger.Fatalf("Failed to load configuration: %v", err)
+	}
+	if cfg.ServiceName != "" {
+		logger.SetServiceName(appLogger, cfg.ServiceName)
+	}
 	
-	// Override from environment variables
-	if err := cfg.LoadFromEnv(); err != nil {
-		appLogger.Fatalf("Failed to load configuration from environment: %v", err)
+	// Override reloadable settings from command line flags; reapplied on every reload
+	// so flags keep precedence over the config file
+	applyReloadableFlags := func(c *config.Config) {
+		if *maxRows != 0 {
+			c.MaxResultRows = *maxRows
+		}
+		if *lowerCase {
+			c.LowerCaseTableNames = true
+		}
+		if *noCompat {
+			c.MySQLCompat = false
+		}
+		if *blockDest {
+			c.BlockDestructive = true
+		}
+		if *destExempt != "" {
+			c.BlockDestructiveExempt = config.ParseIdxList(*destExempt)
+		}
+		if *stmtMS != 0 {
+			c.StatementTimeout = time.Duration(*stmtMS) * time.Millisecond
+		}
+		if *slowMS != 0 {
+			c.SlowQueryThreshold = time.Duration(*slowMS) * time.Millisecond
+		}
+		if *explain {
+			c.SlowQueryExplain = true
+		}
+		if *noParams {
+			c.LogBindParams = false
+		}
+		if *skipSess {
+			c.QueryLogSkipSession = true
+		}
+		if *redaction != "" {
+			c.BindParamRedaction = *redaction
+		}
+		if *maxPacket != 0 {
+			c.MaxAllowedPacket = *maxPacket
+		}
+		if *emptyQuery != "" {
+			c.EmptyQueryMode = *emptyQuery
+		}
 	}
+	applyReloadableFlags(cfg)
 	
 	// Override from command line flags
 	if *httpPort != 8080 {
@@ -89,6 +488,79 @@ func main() {
 	if *mysqlPort != 3306 {
 		cfg.MySQLPort = *mysqlPort
 	}
+	if *idleTTL != 0 {
+		cfg.TenantIdleTimeout = *idleTTL
+	}
+	if *tenantTTL != 0 {
+		cfg.TenantTTL = *tenantTTL
+	}
+	if *webhookURL != "" {
+		cfg.EvictionWebhookURL = *webhookURL
+	}
+	if *apiDebug {
+		cfg.APIDebug = true
+	}
+	if *maxTenants != 0 {
+		cfg.MaxTenantDatabases = *maxTenants
+	}
+	if *limitMode != "" {
+		cfg.TenantLimitMode = *limitMode
+	}
+	if *noCreate {
+		cfg.AutocreateTenants = false
+	}
+	if *resolvers != "" {
+		cfg.TenantResolvers = config.ParseIdxList(strings.ToLower(*resolvers))
+	}
+	if *userAccess != "" {
+		access, err := config.ParseTenantUserAccess(*userAccess)
+		if err != nil {
+			appLogger.Fatalf("Invalid --tenant-user-access: %v", err)
+		}
+		cfg.TenantUserAccess = access
+	}
+	if *defTenant != "" {
+		cfg.DefaultTenant = *defTenant
+	}
+	if *maxLogDBs != 0 {
+		cfg.MaxQueryLogDatabases = *maxLogDBs
+	}
+	if *logDir != "" {
+		cfg.QueryLogDir = *logDir
+	}
+	if *logShards != 0 {
+		cfg.QueryLogShardLevels = *logShards
+	}
+	if *colocate {
+		cfg.QueryLogColocate = true
+	}
+	if *affinity {
+		cfg.TenantConnectionAffinity = true
+	}
+	if *timeZone != "" {
+		cfg.DefaultTimeZone = *timeZone
+	}
+	if *sessionGC != config.DefaultSessionGCInterval {
+		cfg.SessionGCInterval = *sessionGC
+	}
+	if *graceTime != 0 {
+		cfg.ShutdownGraceTimeout = *graceTime
+	}
+	if *cacheSize != 0 {
+		cfg.SQLiteCacheSize = *cacheSize
+	}
+	if *mmapSize != 0 {
+		cfg.SQLiteMmapSize = *mmapSize
+	}
+	if *sampleRows != config.DefaultSampleDataRows {
+		cfg.SampleDataRows = *sampleRows
+	}
+	if *auditSink != "" {
+		cfg.AuditLog = *auditSink
+	}
+	if *logMirror {
+		cfg.QueryLogToStdout = true
+	}
 	
 	// Configure default database from command line flags
 	if *dbType != "" {
@@ -112,6 +584,9 @@ func main() {
 			cfg.DefaultDatabase.MySQLPassword = *dbPassword
 			cfg.DefaultDatabase.MySQLDatabase = *dbName
 			cfg.DefaultDatabase.MySQLSSLMode = *dbSSLMode
+			cfg.DefaultDatabase.MySQLMaxOpenConns = *dbMaxOpen
+			cfg.DefaultDatabase.MySQLMaxIdleConns = *dbMaxIdle
+			cfg.DefaultDatabase.MySQLConnMaxLifetime = *dbLifetime
 			
 			// Build connection string
 			connStr, err := cfg.DefaultDatabase.BuildMySQLConnectionString()
@@ -140,6 +615,17 @@ func main() {
 		appLogger.Fatalf("Invalid configuration: %v", err)
 	}
 	
+	// In check mode, print the effective configuration and exit before binding any ports
+	if *checkCfg {
+		summary, err := json.MarshalIndent(cfg.Redacted(), "", "  ")
+		if err != nil {
+			appLogger.Fatalf("Failed to encode configuration: %v", err)
+		}
+		fmt.Println(string(summary))
+		fmt.Println("Configuration OK")
+		return
+	}
+	
 	// Log default database configuration if present
 	if cfg.DefaultDatabase != nil {
 		appLogger.Printf("Using configured default database: %s", cfg.DefaultDatabase.Type)
@@ -159,17 +645,46 @@ func main() {
 		appLogger.Printf("MySQL protocol authentication: using default credentials (root with no password)")
 	}
 	
+	// Open the audit trail of administrative actions, kept apart from the query logs
+	auditLog, err := audit.Open(cfg.AuditLog)
+	if err != nil {
+		appLogger.Fatalf("Failed to open audit log: %v", err)
+	}
+	defer auditLog.Close()
+	if auditLog != nil {
+		appLogger.Printf("Auditing administrative actions to %s", cfg.AuditLog)
+	}
+	
 	// Create MySQL protocol handler with configuration
-	mysqlHandler := mysql.NewHandlerWithConfig(appLogger, cfg)
+	mysqlHandler, err := mysql.NewHandlerWithConfig(appLogger, cfg)
+	if err != nil {
+		appLogger.Fatalf("Failed to create MySQL handler: %v", err)
+	}
+	mysqlHandler.SetAuditLogger(auditLog)
 	
 	// Start MySQL protocol server in a goroutine
 	go mysql.StartServer(cfg.MySQLPort, mysqlHandler)
 	
+	// Reload runtime-safe settings on SIGHUP
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			appLogger.Printf("Received SIGHUP, reloading configuration")
+			if _, err := reloadConfig(configPath, mysqlHandler, applyReloadableFlags, appLogger); err != nil {
+				appLogger.Printf("Configuration reload failed, keeping current settings: %v", err)
+			}
+		}
+	}()
+	
 	// Create database manager adapter for API
 	dbManagerAdapter := &DatabaseManagerAdapter{mysqlHandler}
 	
 	// Create API handler
 	apiHandler := api.NewHandler(appLogger, dbManagerAdapter)
+	apiHandler.SetServiceInfo(cfg.ServiceName, cfg.ServiceDescription)
+	apiHandler.SetDebugEnabled(cfg.APIDebug)
+	apiHandler.SetAuditLogger(auditLog)
 	
 	// Setup HTTP routes
 	mux := apiHandler.SetupRoutes()
@@ -215,8 +730,38 @@ func main() {
 	}
 	appLogger.Printf("MySQL connection: mysql -h 127.0.0.1 -P %d -u %s --protocol=TCP", cfg.MySQLPort, username)
 	
+	// Drain both servers on SIGINT or SIGTERM, giving requests and statements in flight the
+	// grace period to finish
+	shutdownDone := make(chan struct{})
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer close(shutdownDone)
+		sig := <-stop
+		appLogger.Printf("Received %v, shutting down within %v", sig, cfg.ShutdownGraceTimeout)
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGraceTimeout)
+		defer cancel()
+
+		mysqlDrained := make(chan struct{})
+		go func() {
+			defer close(mysqlDrained)
+			if err := mysqlHandler.Shutdown(ctx); err != nil {
+				appLogger.Printf("MySQL server shutdown: %v", err)
+			}
+		}()
+		if err := server.Shutdown(ctx); err != nil {
+			appLogger.Printf("HTTP server shutdown: %v", err)
+		}
+		<-mysqlDrained
+		if err := mysqlHandler.Close(); err != nil {
+			appLogger.Printf("Failed to close databases: %v", err)
+		}
+	}()
+	
 	// Start HTTP server
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		appLogger.Fatalf("HTTP server failed to start: %v", err)
 	}
+	<-shutdownDone
+	appLogger.Printf("Shutdown complete")
 }
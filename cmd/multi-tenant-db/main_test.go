@@ -1,10 +1,24 @@
 package main
 
 import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
+	"multitenant-db/internal/api"
+	"multitenant-db/internal/config"
 	"multitenant-db/internal/logger"
 	"multitenant-db/internal/mysql"
 )
@@ -115,4 +129,919 @@ func TestDatabaseManagerAdapter_ErrorHandling(t *testing.T) {
 	if db == nil {
 		t.Error("Should return default database for empty idx")
 	}
-}
\ No newline at end of file
+
+	// The tenant limit maps to the API error without repeating its message
+	mysqlHandler.GetDatabaseManager().SetTenantLimit(1, false)
+	if _, err := adapter.GetOrCreateDatabase("limit_a"); err != nil {
+		t.Fatalf("Failed to create limit_a: %v", err)
+	}
+	_, err = adapter.GetOrCreateDatabase("limit_b")
+	if !errors.Is(err, api.ErrTenantLimitReached) || err.Error() != "tenant database limit reached (max 1)" {
+		t.Errorf("Expected a single tenant limit message, got %v", err)
+	}
+}
+
+func TestDatabaseManagerAdapter_DownloadDatabase(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.DefaultDatabase = &config.DefaultDatabaseConfig{
+		Type:             config.DatabaseTypeSQLite,
+		ConnectionString: filepath.Join(t.TempDir(), "default.db"),
+	}
+	mysqlHandler, err := mysql.NewHandlerWithConfig(testLogger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/databases/default/download")
+	if err != nil {
+		t.Fatalf("Download request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/octet-stream" {
+		t.Errorf("Expected application/octet-stream, got %s", ct)
+	}
+
+	// Write the downloaded bytes out and open them as a SQLite database
+	downloadPath := filepath.Join(t.TempDir(), "downloaded.db")
+	out, err := os.Create(downloadPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		t.Fatalf("Failed to read download body: %v", err)
+	}
+	out.Close()
+
+	db, err := sql.Open("sqlite3", downloadPath)
+	if err != nil {
+		t.Fatalf("Failed to open downloaded database: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Downloaded bytes should be a valid SQLite database: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 users in downloaded database, got %d", count)
+	}
+
+	// In-memory tenants cannot be downloaded
+	adapter.GetOrCreateDatabase("memory_tenant")
+	resp2, err := http.Get(server.URL + "/api/databases/memory_tenant/download")
+	if err != nil {
+		t.Fatalf("Download request failed: %v", err)
+	}
+	resp2.Body.Close()
+	if resp2.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for in-memory tenant, got %d", resp2.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_ParameterizedQuery(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	// The injected string is bound as a value, not interpolated into the SQL
+	body := `{"idx":"param_tenant","query":"SELECT id, name, age FROM users WHERE id = ? OR name = ?","args":[2, "x' OR '1'='1"]}`
+	resp, err := http.Post(server.URL+"/api/query", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Query request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var response api.QueryResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.RowCount != 1 {
+		t.Fatalf("Expected exactly 1 row, got %d", response.RowCount)
+	}
+	row := response.Rows[0]
+	if row[0] != float64(2) || row[1] != "Bob" || row[2] != float64(25) {
+		t.Errorf("Expected typed row [2 Bob 25], got %v", row)
+	}
+}
+
+func TestDatabaseManagerAdapter_TruncateDatabase(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	adapter.GetOrCreateDatabase("truncate_tenant")
+	if _, err := adapter.ExecuteQuery("truncate_tenant", "INSERT INTO users (name, email, age) VALUES (?, ?, ?)", []interface{}{"Dana", "dana@example.com", 41}); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	resp, err := http.Post(server.URL+"/api/databases/truncate_tenant/truncate", "application/json", nil)
+	if err != nil {
+		t.Fatalf("Truncate request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	for _, table := range []string{"users", "products"} {
+		result, err := adapter.ExecuteQuery("truncate_tenant", "SELECT COUNT(*) FROM "+table, nil)
+		if err != nil {
+			t.Errorf("Table %s should still exist after truncate: %v", table, err)
+			continue
+		}
+		if count := result.Rows[0][0]; count != int64(0) {
+			t.Errorf("Expected %s to be empty, got %v rows", table, count)
+		}
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	configPath := filepath.Join(t.TempDir(), "multitenant-db.conf")
+	if err := os.WriteFile(configPath, []byte("MAX_RESULT_ROWS=10\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	cfg, err := loadConfig(configPath)
+	if err != nil {
+		t.Fatalf("loadConfig failed: %v", err)
+	}
+	mysqlHandler, err := mysql.NewHandlerWithConfig(testLogger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	if mysqlHandler.Config().MaxResultRows != 10 {
+		t.Fatalf("Expected initial row cap of 10, got %d", mysqlHandler.Config().MaxResultRows)
+	}
+
+	// Mutate the file and simulate the SIGHUP handler
+	if err := os.WriteFile(configPath, []byte("MAX_RESULT_ROWS=25\nMYSQL_PORT=4406\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite config file: %v", err)
+	}
+	changes, err := reloadConfig(configPath, mysqlHandler, nil, testLogger)
+	if err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if len(changes) != 1 {
+		t.Errorf("Expected 1 change, got %v", changes)
+	}
+	if got := mysqlHandler.Config().MaxResultRows; got != 25 {
+		t.Errorf("Expected reloaded row cap of 25, got %d", got)
+	}
+	if got := mysqlHandler.Config().MySQLPort; got != 3306 {
+		t.Errorf("MySQL port should not change on reload, got %d", got)
+	}
+
+	// Flag overrides keep precedence over the file
+	changes, err = reloadConfig(configPath, mysqlHandler, func(c *config.Config) { c.MaxResultRows = 5 }, testLogger)
+	if err != nil {
+		t.Fatalf("reloadConfig failed: %v", err)
+	}
+	if got := mysqlHandler.Config().MaxResultRows; got != 5 || len(changes) != 1 {
+		t.Errorf("Expected flag override of 5 rows, got %d (changes %v)", got, changes)
+	}
+
+	// An invalid file leaves the current settings in place
+	if err := os.WriteFile(configPath, []byte("MAX_RESULT_ROWS=-1\n"), 0o644); err != nil {
+		t.Fatalf("Failed to rewrite config file: %v", err)
+	}
+	if _, err := reloadConfig(configPath, mysqlHandler, nil, testLogger); err == nil {
+		t.Error("Expected error reloading invalid configuration")
+	}
+	if got := mysqlHandler.Config().MaxResultRows; got != 5 {
+		t.Errorf("Expected row cap to stay at 5 after failed reload, got %d", got)
+	}
+}
+
+func TestDatabaseManagerAdapter_QueryCount(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	queryCount := func() map[string]interface{} {
+		resp, err := http.Get(server.URL + "/api/databases/default/query-count")
+		if err != nil {
+			t.Fatalf("Query count request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var body map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return body
+	}
+
+	initial := queryCount()
+	if initial["query_count"] != float64(0) || initial["last_query_at"] != nil {
+		t.Fatalf("Expected no queries yet, got %v", initial)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := mysqlHandler.HandleQuery("SELECT 1"); err != nil {
+			t.Fatalf("Query failed: %v", err)
+		}
+	}
+
+	// Queries are logged asynchronously, so wait for the counter to catch up
+	var body map[string]interface{}
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if body = queryCount(); body["query_count"] == float64(2) {
+			break
+		}
+	}
+	if body["query_count"] != float64(2) {
+		t.Fatalf("Expected query_count 2, got %v", body["query_count"])
+	}
+	if body["idx"] != "default" || body["last_query_at"] == nil {
+		t.Errorf("Expected idx and last_query_at in response, got %v", body)
+	}
+}
+
+func TestDatabaseManagerAdapter_CreateDatabaseWithSchema(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	createDatabase := func(body string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/api/databases", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Create request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	status := createDatabase(`{"idx": "custom_tenant", "seed": false, "schema_sql": "CREATE TABLE orders (id INTEGER PRIMARY KEY, total REAL); CREATE INDEX idx_orders_total ON orders (total); INSERT INTO orders (id, total) VALUES (1, 9.5);"}`)
+	if status != http.StatusCreated {
+		t.Fatalf("Expected status 201, got %d", status)
+	}
+
+	result, err := adapter.ExecuteQuery("custom_tenant", "SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name", nil)
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "orders" {
+		t.Errorf("Expected only the schema's orders table without sample data, got %v", result.Rows)
+	}
+
+	// Recreating an existing tenant with a schema is a conflict
+	if status := createDatabase(`{"idx": "custom_tenant", "schema_sql": "CREATE TABLE more (id INTEGER)"}`); status != http.StatusConflict {
+		t.Errorf("Expected status 409 for an existing tenant, got %d", status)
+	}
+
+	// A failing schema rolls back and leaves no tenant behind
+	if status := createDatabase(`{"idx": "broken_tenant", "schema_sql": "CREATE TABLE ok (id INTEGER); CREATE TABLE broken ("}`); status != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an invalid schema, got %d", status)
+	}
+	for _, idx := range adapter.ListDatabases() {
+		if idx == "broken_tenant" {
+			t.Error("A tenant whose schema failed should not be created")
+		}
+	}
+}
+
+func TestDatabaseManagerAdapter_ListIndexes(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	adapter.GetOrCreateDatabase("index_tenant")
+	if _, err := adapter.ExecuteQuery("index_tenant", "CREATE UNIQUE INDEX idx_users_name_email ON users (name, email)", nil); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/api/databases/index_tenant/indexes")
+	if err != nil {
+		t.Fatalf("Indexes request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Indexes []api.IndexInfo `json:"indexes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	var found *api.IndexInfo
+	for i := range body.Indexes {
+		if body.Indexes[i].Name == "idx_users_name_email" {
+			found = &body.Indexes[i]
+		}
+	}
+	if found == nil {
+		t.Fatalf("Expected idx_users_name_email to be listed, got %+v", body.Indexes)
+	}
+	if found.Table != "users" || !found.Unique {
+		t.Errorf("Expected a unique index on users, got %+v", *found)
+	}
+	if strings.Join(found.Columns, ",") != "name,email" {
+		t.Errorf("Expected columns [name email], got %v", found.Columns)
+	}
+
+	missing, err := http.Get(server.URL + "/api/databases/no_such_tenant/indexes")
+	if err != nil {
+		t.Fatalf("Indexes request failed: %v", err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing database, got %d", missing.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_LastError(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	getDetail := func() map[string]interface{} {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/api/databases/error_tenant")
+		if err != nil {
+			t.Fatalf("Detail request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var detail map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return detail
+	}
+
+	adapter.GetOrCreateDatabase("error_tenant")
+	if detail := getDetail(); detail["last_error"] != nil {
+		t.Fatalf("Expected no last_error before any failure, got %v", detail["last_error"])
+	}
+
+	body := `{"idx":"error_tenant","query":"INSERT INTO missing_table (id) VALUES (1)"}`
+	resp, err := http.Post(server.URL+"/api/query", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("Query request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		t.Fatal("Expected the write to be rejected")
+	}
+
+	lastError, ok := getDetail()["last_error"].(map[string]interface{})
+	if !ok {
+		t.Fatal("Expected last_error to be populated after a rejected write")
+	}
+	if message, _ := lastError["message"].(string); !strings.Contains(message, "missing_table") {
+		t.Errorf("Expected last_error to mention missing_table, got %q", message)
+	}
+	if at, _ := lastError["at"].(string); at == "" {
+		t.Error("Expected last_error to carry a timestamp")
+	}
+}
+
+func TestDatabaseManagerAdapter_QueryStream(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	adapter.GetOrCreateDatabase("stream_tenant")
+	count, err := adapter.ExecuteQuery("stream_tenant", "SELECT COUNT(*) FROM users", nil)
+	if err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	expected := count.Rows[0][0].(int64)
+
+	resp, err := http.Get(server.URL + "/api/query-stream?idx=stream_tenant&q=" + url.QueryEscape("SELECT id, name FROM users ORDER BY id"))
+	if err != nil {
+		t.Fatalf("Stream request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "application/x-ndjson" {
+		t.Errorf("Expected Content-Type application/x-ndjson, got %q", contentType)
+	}
+
+	var lines int64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var row map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("Line %d is not a JSON object: %q", lines+1, scanner.Text())
+		}
+		lines++
+		if id, _ := row["id"].(float64); int64(id) != lines {
+			t.Errorf("Expected row %d to have id %d, got %v", lines, lines, row["id"])
+		}
+		if _, ok := row["name"].(string); !ok {
+			t.Errorf("Expected row %d to have a name, got %v", lines, row["name"])
+		}
+	}
+	if lines != expected || lines == 0 {
+		t.Errorf("Expected %d NDJSON lines, got %d", expected, lines)
+	}
+
+	// Only SELECTs can be streamed
+	rejected, err := http.Get(server.URL + "/api/query-stream?idx=stream_tenant&q=" + url.QueryEscape("DELETE FROM users"))
+	if err != nil {
+		t.Fatalf("Stream request failed: %v", err)
+	}
+	rejected.Body.Close()
+	if rejected.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a DELETE, got %d", rejected.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_ConditionalRequests(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	get := func(path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if err != nil {
+			t.Fatalf("Failed to build request: %v", err)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	first := get("/api/databases", nil)
+	etag, lastModified := first.Header.Get("ETag"), first.Header.Get("Last-Modified")
+	if first.StatusCode != http.StatusOK || etag == "" || lastModified == "" {
+		t.Fatalf("Expected 200 with ETag and Last-Modified, got %d %q %q", first.StatusCode, etag, lastModified)
+	}
+
+	// A repeated request with the same validators is answered without a body
+	if resp := get("/api/databases", map[string]string{"If-None-Match": etag}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for a matching ETag, got %d", resp.StatusCode)
+	}
+	if resp := get("/api/databases", map[string]string{"If-Modified-Since": lastModified}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for an unchanged Last-Modified, got %d", resp.StatusCode)
+	}
+	if resp := get("/api/databases", map[string]string{"If-None-Match": etag, "Accept": "application/vnd.multitenant-db.v2+json"}); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected another API version to be a different representation, got %d", resp.StatusCode)
+	}
+
+	// Creating a database changes the list
+	adapter.GetOrCreateDatabase("etag_tenant")
+	resp := get("/api/databases", map[string]string{"If-None-Match": etag})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("Expected 200 with a new ETag after creating a database, got %d %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+
+	// Schema endpoints change with DDL
+	indexes := get("/api/databases/etag_tenant/indexes", nil)
+	schemaETag := indexes.Header.Get("ETag")
+	if resp := get("/api/databases/etag_tenant/indexes", map[string]string{"If-None-Match": schemaETag}); resp.StatusCode != http.StatusNotModified {
+		t.Errorf("Expected 304 for unchanged indexes, got %d", resp.StatusCode)
+	}
+	if _, err := adapter.ExecuteQuery("etag_tenant", "CREATE INDEX idx_users_age ON users (age)", nil); err != nil {
+		t.Fatalf("Failed to create index: %v", err)
+	}
+	if resp := get("/api/databases/etag_tenant/indexes", map[string]string{"If-None-Match": schemaETag}); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected 200 after an index was created, got %d", resp.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_CompareSchemas(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	adapter.GetOrCreateDatabase("migrated")
+	adapter.GetOrCreateDatabase("sample")
+	if _, err := adapter.ExecuteQuery("migrated", "ALTER TABLE users ADD COLUMN nickname VARCHAR(50)", nil); err != nil {
+		t.Fatalf("Failed to add column: %v", err)
+	}
+
+	resp, err := http.Get(server.URL + "/api/databases/migrated/compare?target=sample")
+	if err != nil {
+		t.Fatalf("Compare request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var body struct {
+		Diff api.SchemaDiff `json:"diff"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	diff := body.Diff
+	if diff.Identical {
+		t.Error("Expected the schemas to differ")
+	}
+	expected := api.SchemaColumn{Table: "users", Column: "nickname", Type: "VARCHAR(50)"}
+	if len(diff.ColumnsOnlyInSource) != 1 || diff.ColumnsOnlyInSource[0] != expected {
+		t.Errorf("Expected only %+v in the source, got %+v", expected, diff.ColumnsOnlyInSource)
+	}
+	if len(diff.ColumnsOnlyInTarget) != 0 || len(diff.TablesOnlyInSource) != 0 || len(diff.TablesOnlyInTarget) != 0 || len(diff.TypeMismatches) != 0 {
+		t.Errorf("Expected no other differences, got %+v", diff)
+	}
+
+	missingTarget, err := http.Get(server.URL + "/api/databases/migrated/compare")
+	if err != nil {
+		t.Fatalf("Compare request failed: %v", err)
+	}
+	missingTarget.Body.Close()
+	if missingTarget.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 without a target, got %d", missingTarget.StatusCode)
+	}
+
+	missing, err := http.Get(server.URL + "/api/databases/migrated/compare?target=no_such_tenant")
+	if err != nil {
+		t.Fatalf("Compare request failed: %v", err)
+	}
+	missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for a missing database, got %d", missing.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_LoadRows(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	apiHandler := api.NewHandler(testLogger, adapter)
+	server := httptest.NewServer(apiHandler.SetupRoutes())
+	defer server.Close()
+
+	adapter.GetOrCreateDatabase("load_tenant")
+	before, err := adapter.ExecuteQuery("load_tenant", "SELECT COUNT(*) FROM users", nil)
+	if err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+
+	// The third data row has no name, which users requires
+	csvBody := "name,email,age\nAda,ada@example.com,36\n\"Lovelace, Grace\",grace@example.com,45\n,nobody@example.com,20\nAlan,alan@example.com,41\n"
+	resp, err := http.Post(server.URL+"/api/databases/load_tenant/load?table=users", "text/csv", strings.NewReader(csvBody))
+	if err != nil {
+		t.Fatalf("Load request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	var loadResp api.LoadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&loadResp); err != nil {
+		t.Fatalf("Failed to decode load response: %v", err)
+	}
+	if loadResp.RowsLoaded != 3 {
+		t.Errorf("Expected 3 rows loaded, got %d", loadResp.RowsLoaded)
+	}
+	if len(loadResp.Errors) != 1 || loadResp.Errors[0].Row != 3 {
+		t.Errorf("Expected one error for row 3, got %+v", loadResp.Errors)
+	}
+
+	after, err := adapter.ExecuteQuery("load_tenant", "SELECT COUNT(*) FROM users", nil)
+	if err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if added := after.Rows[0][0].(int64) - before.Rows[0][0].(int64); added != 3 {
+		t.Errorf("Expected 3 more users, got %d", added)
+	}
+
+	// An unknown column fails the whole load
+	resp, err = http.Post(server.URL+"/api/databases/load_tenant/load?table=users&columns=name,nickname", "text/csv", strings.NewReader("Ada,ada\n"))
+	if err != nil {
+		t.Fatalf("Load request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for an unknown column, got %d", resp.StatusCode)
+	}
+
+	// A quoting error ends the load with a 400
+	resp, err = http.Post(server.URL+"/api/databases/load_tenant/load?table=users&columns=name", "text/csv", strings.NewReader("Ada\n\"Grace\n"))
+	if err != nil {
+		t.Fatalf("Load request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for a malformed body, got %d", resp.StatusCode)
+	}
+
+	// A body over the limit is refused
+	apiHandler.SetMaxLoadBytes(64)
+	largeBody := "name\n" + strings.Repeat("Ada\n", 100)
+	resp, err = http.Post(server.URL+"/api/databases/load_tenant/load?table=users", "text/csv", strings.NewReader(largeBody))
+	if err != nil {
+		t.Fatalf("Load request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a body over the limit, got %d", resp.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_LastQueryPreview(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.BindParamRedaction = config.BindParamRedactionRedact
+	mysqlHandler, err := mysql.NewHandlerWithConfig(testLogger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	lastQuery := func(idx string) *api.TenantQuery {
+		t.Helper()
+		resp, err := http.Get(server.URL + "/api/databases")
+		if err != nil {
+			t.Fatalf("List request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body api.DatabaseResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		for _, info := range body.Databases {
+			if info.Idx == idx {
+				return info.LastQuery
+			}
+		}
+		return nil
+	}
+
+	if _, err := mysqlHandler.HandleQuery("SET @idx = 'preview_tenant'"); err != nil {
+		t.Fatalf("SET @idx failed: %v", err)
+	}
+	if _, err := mysqlHandler.HandleQuery("SELECT name AS name2\n  FROM users WHERE id = 1 AND name <> 'Bob' AND `users`.age > 0"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	preview := lastQuery("preview_tenant")
+	if preview == nil || preview.Query != "SELECT name AS name2 FROM users WHERE id = <redacted> AND name <> <redacted> AND `users`.age > <redacted>" {
+		t.Fatalf("Expected the SELECT with its literals redacted as preview_tenant's last query, got %+v", preview)
+	}
+	if preview.At.IsZero() {
+		t.Error("Expected the last query to carry a timestamp")
+	}
+
+	// Prepared-statement arguments are previewed with the configured redaction
+	if _, err := mysqlHandler.HandleStmtExecute(nil, "SELECT name FROM users", []interface{}{"alice@example.com"}); err != nil {
+		t.Fatalf("Prepared statement failed: %v", err)
+	}
+	if preview = lastQuery("preview_tenant"); !strings.Contains(preview.Query, "<redacted>") || strings.Contains(preview.Query, "alice@example.com") {
+		t.Errorf("Expected the argument to be redacted in the preview, got %q", preview.Query)
+	}
+
+	// Long statements are cut short
+	long := "SELECT name" + strings.Repeat(", name", 100) + " FROM users"
+	if _, err := mysqlHandler.HandleQuery(long); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if preview = lastQuery("preview_tenant"); len(preview.Query) >= len(long) || !strings.HasSuffix(preview.Query, "...") {
+		t.Errorf("Expected a truncated preview, got %d characters", len(preview.Query))
+	}
+}
+
+func TestDatabaseManagerAdapter_ColocatedQueryLogs(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.QueryLogColocate = true
+	mysqlHandler, err := mysql.NewHandlerWithConfig(testLogger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	if _, err := mysqlHandler.HandleQuery("SET @idx = 'colocated_tenant'"); err != nil {
+		t.Fatalf("SET @idx failed: %v", err)
+	}
+	if _, err := mysqlHandler.HandleQuery("SELECT name FROM users WHERE id = 1"); err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+
+	// Queries are logged asynchronously, so wait for the entry to land in the tenant's database
+	tenantDB, err := mysqlHandler.GetDatabaseManager().GetOrCreateDatabase("colocated_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get tenant database: %v", err)
+	}
+	var count int
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if err := tenantDB.QueryRow("SELECT COUNT(*) FROM __query_logs WHERE query = 'SELECT name FROM users WHERE id = 1'").Scan(&count); err == nil && count == 1 {
+			break
+		}
+	}
+	if count != 1 {
+		t.Fatalf("Expected the query logged in the tenant's __query_logs table, got %d entries", count)
+	}
+
+	resp, err := http.Get(server.URL + "/api/query-logs/colocated_tenant")
+	if err != nil {
+		t.Fatalf("Query logs request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var body api.QueryLogResponse
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	found := false
+	for _, entry := range body.Logs {
+		if entry.Query == "SELECT name FROM users WHERE id = 1" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Expected the colocated log entry from the logs endpoint, got %+v", body.Logs)
+	}
+}
+
+func TestDatabaseManagerAdapter_TenantMetrics(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	if err := adapter.CreateDatabase("metrics_tenant", true, ""); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// Durations of 1ms to 20ms, the last two failing
+	queryLogger := mysqlHandler.GetQueryLogger()
+	for i := 1; i <= 20; i++ {
+		success, errorMsg := i <= 18, ""
+		if !success {
+			errorMsg = "no such table: missing"
+		}
+		if err := queryLogger.LogQuery("metrics_tenant", fmt.Sprintf("SELECT %d", i), "conn_1", time.Duration(i)*time.Millisecond, success, errorMsg); err != nil {
+			t.Fatalf("Failed to log query: %v", err)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/api/databases/metrics_tenant/metrics")
+	if err != nil {
+		t.Fatalf("Metrics request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	var body map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+
+	if body["query_count"] != float64(20) || body["error_count"] != float64(2) {
+		t.Errorf("Expected 20 queries and 2 errors, got %v and %v", body["query_count"], body["error_count"])
+	}
+	if body["avg_latency_ms"] != 10.5 {
+		t.Errorf("Expected an average latency of 10.5ms, got %v", body["avg_latency_ms"])
+	}
+	if body["p95_latency_ms"] != float64(19) {
+		t.Errorf("Expected a p95 latency of 19ms, got %v", body["p95_latency_ms"])
+	}
+	if size, ok := body["db_size_bytes"].(float64); !ok || size <= 0 {
+		t.Errorf("Expected a positive database size, got %v", body["db_size_bytes"])
+	}
+
+	resp, err = http.Get(server.URL + "/api/databases/missing_tenant/metrics")
+	if err != nil {
+		t.Fatalf("Metrics request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown tenant, got %d", resp.StatusCode)
+	}
+}
+
+func TestDatabaseManagerAdapter_ReplayQueryLog(t *testing.T) {
+	testLogger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mysqlHandler := mysql.NewHandler(testLogger)
+	defer mysqlHandler.Close()
+	adapter := &DatabaseManagerAdapter{handler: mysqlHandler}
+	server := httptest.NewServer(api.NewHandler(testLogger, adapter).SetupRoutes())
+	defer server.Close()
+
+	queryLogger := mysqlHandler.GetQueryLogger()
+	for _, entry := range []struct {
+		query    string
+		errorMsg string
+	}{
+		{"CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)", ""},
+		{"INSERT INTO items (id, name) VALUES (1, 'a')", ""},
+		{"SELECT * FROM items", ""},
+		{"INSERT INTO missing (id) VALUES (1)", "no such table: missing"},
+		{"INSERT INTO items (id, name) VALUES (?, ?) -- params: [2 b]", ""},
+		{"UPDATE items SET name = 'c' WHERE id = 1", ""},
+	} {
+		if err := queryLogger.LogQuery("replay_source", entry.query, "conn_1", time.Millisecond, entry.errorMsg == "", entry.errorMsg); err != nil {
+			t.Fatalf("Failed to log query: %v", err)
+		}
+	}
+
+	replay := func(body string) api.QueryLogReplayResponse {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/api/query-logs/replay_source/replay", "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Replay request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		var response api.QueryLogReplayResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return response
+	}
+
+	// A dry run reports every entry but leaves the target without the table
+	response := replay(`{"target_idx": "replay_target", "dry_run": true}`)
+	if response.Replayed != 3 || response.Failed != 1 || response.Skipped != 2 || len(response.Results) != 6 {
+		t.Fatalf("Expected 3 replayed, 1 failed and 2 skipped of 6, got %+v", response)
+	}
+	if result := response.Results[3]; result.Status != api.ReplayStatusFailed || !strings.Contains(result.Error, "missing") {
+		t.Errorf("Expected the insert into a missing table to fail, got %+v", result)
+	}
+	if result := response.Results[4]; result.Status != api.ReplayStatusSkipped || result.Reason == "" {
+		t.Errorf("Expected the prepared statement to be skipped, got %+v", result)
+	}
+	if mysqlHandler.GetDatabaseManager().HasDatabase("replay_target") {
+		t.Error("Expected a dry run not to create the target")
+	}
+
+	// Replaying only successful statements reproduces the source's data
+	response = replay(`{"target_idx": "replay_target", "only_success": true}`)
+	if response.Replayed != 3 || response.Failed != 0 || response.Skipped != 2 {
+		t.Fatalf("Expected 3 replayed and 2 skipped, got %+v", response)
+	}
+	result, err := adapter.ExecuteQuery("replay_target", "SELECT id, name FROM items", nil)
+	if err != nil {
+		t.Fatalf("Failed to read replayed data: %v", err)
+	}
+	if len(result.Rows) != 1 || fmt.Sprint(result.Rows[0][0]) != "1" || fmt.Sprint(result.Rows[0][1]) != "c" {
+		t.Errorf("Expected the single row (1, c), got %v", result.Rows)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// Build information, set at build time with e.g.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse --short HEAD) -X main.date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version = "dev"
+	commit  = "unknown"
+	date    = "unknown"
+)
+
+// printVersion writes the build version, commit and date to w
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "multitenant-db %s (commit %s, built %s)\n", version, commit, date)
+}
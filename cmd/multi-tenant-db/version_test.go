@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMainHelper runs main() with the arguments after "--" when started as a subprocess by runMain
+func TestMainHelper(t *testing.T) {
+	if os.Getenv("MULTITENANT_DB_RUN_MAIN") != "1" {
+		t.Skip("only runs as a subprocess of runMain")
+	}
+	args := os.Args
+	for i, arg := range args {
+		if arg == "--" {
+			args = args[i+1:]
+			break
+		}
+	}
+	os.Args = append([]string{"multitenant-db"}, args...)
+	main()
+	os.Exit(0)
+}
+
+// runMain runs the binary's main() in a subprocess with args, returning its combined output.
+// It fails the test if main doesn't exit promptly, e.g. because it started serving.
+func runMain(t *testing.T, env []string, args ...string) (string, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, os.Args[0], append([]string{"-test.run=^TestMainHelper$", "--"}, args...)...)
+	cmd.Env = append(append(os.Environ(), "MULTITENANT_DB_RUN_MAIN=1"), env...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		t.Fatalf("main %v did not exit: %s", args, output)
+	}
+	return string(output), err
+}
+
+func TestPrintVersion(t *testing.T) {
+	originalVersion, originalCommit, originalDate := version, commit, date
+	defer func() { version, commit, date = originalVersion, originalCommit, originalDate }()
+	version, commit, date = "1.2.0", "abc1234", "2026-01-02T03:04:05Z"
+
+	var out bytes.Buffer
+	printVersion(&out)
+	if expected := "multitenant-db 1.2.0 (commit abc1234, built 2026-01-02T03:04:05Z)\n"; out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestVersionCommand(t *testing.T) {
+	for _, args := range [][]string{{"--version"}, {"version"}} {
+		output, err := runMain(t, nil, args...)
+		if err != nil {
+			t.Fatalf("%v should exit cleanly: %v\n%s", args, err, output)
+		}
+		if !strings.Contains(output, "multitenant-db dev (commit unknown, built unknown)") {
+			t.Errorf("%v should print the version, got %q", args, output)
+		}
+		if strings.Contains(output, "Starting Multitenant DB server") {
+			t.Errorf("%v should not start the server", args)
+		}
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	output, err := runMain(t, []string{"CONFIG_FILE="}, "--check-config", "--http-port", "18080")
+	if err != nil {
+		t.Fatalf("A valid configuration should exit zero: %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "Configuration OK") || !strings.Contains(output, `"http_port": 18080`) {
+		t.Errorf("Expected the configuration summary, got %q", output)
+	}
+	if strings.Contains(output, "Starting Multitenant DB server") {
+		t.Error("--check-config should not start the server")
+	}
+
+	output, err = runMain(t, []string{"CONFIG_FILE=", "HTTP_PORT=70000"}, "--check-config")
+	if err == nil {
+		t.Fatalf("An invalid port should exit non-zero:\n%s", output)
+	}
+	if !strings.Contains(output, "invalid HTTP port: 70000") {
+		t.Errorf("Expected the validation error, got %q", output)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// checkNotModified sets the ETag and Last-Modified validators of a read-only response whose
+// content last changed at modified, and answers 304 Not Modified when the request's
+// If-None-Match, or failing that If-Modified-Since, shows the client's copy is still current.
+// It returns true when the 304 has been sent. A zero modified time disables the validators.
+//
+// Responses carry a generation timestamp, so the ETag is weak: it identifies the data rather
+// than the exact bytes. It includes the API version, which the Accept header can select.
+func (h *Handler) checkNotModified(w http.ResponseWriter, r *http.Request, modified time.Time) bool {
+	if modified.IsZero() {
+		return false
+	}
+
+	etag := fmt.Sprintf(`W/"%s-%x"`, requestedAPIVersion(r), modified.UnixNano())
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	w.Header().Add("Vary", "Accept")
+
+	notModified := false
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		notModified = etagMatches(match, etag)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil {
+		// Last-Modified only has whole seconds
+		notModified = !modified.Truncate(time.Second).After(since)
+	}
+	if notModified {
+		w.WriteHeader(http.StatusNotModified)
+	}
+	return notModified
+}
+
+// etagMatches reports whether an If-None-Match header lists etag, using the weak comparison
+// RFC 9110 prescribes for If-None-Match
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// databasesModifiedAt returns when the list of databases last changed, or the zero time when the
+// database manager does not track it
+func (h *Handler) databasesModifiedAt() time.Time {
+	if tracker, ok := h.dbManager.(interface{ DatabasesModifiedAt() time.Time }); ok {
+		return tracker.DatabasesModifiedAt()
+	}
+	return time.Time{}
+}
+
+// schemaModifiedAt returns when the schema of the database for idx last changed, or the zero time
+// when it is unknown
+func (h *Handler) schemaModifiedAt(idx string) time.Time {
+	if tracker, ok := h.dbManager.(interface{ SchemaModifiedAt(idx string) time.Time }); ok {
+		return tracker.SchemaModifiedAt(idx)
+	}
+	return time.Time{}
+}
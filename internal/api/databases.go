@@ -0,0 +1,969 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"multitenant-db/internal/audit"
+)
+
+// IndexInfo describes one index on a tenant table
+type IndexInfo struct {
+	Name    string   `json:"name"`
+	Table   string   `json:"table"`
+	Unique  bool     `json:"unique"`
+	Columns []string `json:"columns"`
+}
+
+// SchemaColumn names a column of a tenant table and its declared type
+type SchemaColumn struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Type   string `json:"type"`
+}
+
+// SchemaTypeMismatch is a column two tenants both have with different declared types
+type SchemaTypeMismatch struct {
+	Table      string `json:"table"`
+	Column     string `json:"column"`
+	SourceType string `json:"source_type"`
+	TargetType string `json:"target_type"`
+}
+
+// SchemaDiff lists how the schema of a source tenant differs from a target tenant's
+type SchemaDiff struct {
+	TablesOnlyInSource  []string             `json:"tables_only_in_source"`
+	TablesOnlyInTarget  []string             `json:"tables_only_in_target"`
+	ColumnsOnlyInSource []SchemaColumn       `json:"columns_only_in_source"`
+	ColumnsOnlyInTarget []SchemaColumn       `json:"columns_only_in_target"`
+	TypeMismatches      []SchemaTypeMismatch `json:"type_mismatches"`
+	Identical           bool                 `json:"identical"`
+}
+
+// TenantError is the most recent error a tenant ran into
+type TenantError struct {
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// TenantQuery previews the most recent statement a tenant ran and when
+type TenantQuery struct {
+	Query string    `json:"query"`
+	At    time.Time `json:"at"`
+}
+
+// Orders GET /api/databases can list databases in
+const (
+	DatabaseSortIdx          = "idx"           // Alphabetically by idx
+	DatabaseSortLastAccessed = "last_accessed" // Most recently used first, databases that are not open last
+)
+
+// MaxDatabaseListLimit is the largest page GET /api/databases returns
+const MaxDatabaseListLimit = 1000
+
+// databaseListParams are the filter, order and page of a GET /api/databases request
+type databaseListParams struct {
+	prefix string
+	sort   string
+	limit  int // 0 lists every match
+	offset int
+}
+
+// parseDatabaseListParams reads the prefix, sort, limit and offset parameters of a database
+// list request
+func parseDatabaseListParams(r *http.Request) (databaseListParams, error) {
+	query := r.URL.Query()
+	params := databaseListParams{prefix: query.Get("prefix"), sort: DatabaseSortIdx}
+
+	if sortBy := query.Get("sort"); sortBy != "" {
+		if sortBy != DatabaseSortIdx && sortBy != DatabaseSortLastAccessed {
+			return params, fmt.Errorf("Invalid sort. Use %s or %s.", DatabaseSortIdx, DatabaseSortLastAccessed)
+		}
+		params.sort = sortBy
+	}
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > MaxDatabaseListLimit {
+			return params, fmt.Errorf("Invalid limit. Use a number between 1 and %d.", MaxDatabaseListLimit)
+		}
+		params.limit = limit
+	}
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		offset, err := strconv.Atoi(offsetStr)
+		if err != nil || offset < 0 {
+			return params, errors.New("Invalid offset. Use a number of 0 or more.")
+		}
+		params.offset = offset
+	}
+	return params, nil
+}
+
+// listDatabases returns the page of idxs params asks for, how many idxs match its prefix, and
+// the latest access time the order depended on (zero unless sorting by last access)
+func (h *Handler) listDatabases(params databaseListParams) ([]string, int, time.Time) {
+	var matches []string
+	for _, idx := range h.dbManager.ListDatabases() {
+		if strings.HasPrefix(idx, params.prefix) {
+			matches = append(matches, idx)
+		}
+	}
+
+	var latest time.Time
+	accessed := make(map[string]time.Time)
+	if tracker, ok := h.dbManager.(interface{ LastAccessedAt(idx string) time.Time }); ok && params.sort == DatabaseSortLastAccessed {
+		for _, idx := range matches {
+			accessed[idx] = tracker.LastAccessedAt(idx)
+			if accessed[idx].After(latest) {
+				latest = accessed[idx]
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if ai, aj := accessed[matches[i]], accessed[matches[j]]; !ai.Equal(aj) {
+			return ai.After(aj)
+		}
+		return matches[i] < matches[j]
+	})
+
+	total := len(matches)
+	start := min(params.offset, total)
+	end := total
+	if params.limit > 0 {
+		end = min(start+params.limit, total)
+	}
+	return matches[start:end], total, latest
+}
+
+// databaseName returns the MySQL-facing database name for an idx
+func databaseName(idx string) string {
+	if idx == "" || idx == "default" {
+		return "multitenant_db"
+	}
+	return "multitenant_db_idx_" + idx
+}
+
+// databaseExists checks whether a database for idx is currently known to the manager
+// without creating it
+func (h *Handler) databaseExists(idx string) bool {
+	if checker, ok := h.dbManager.(interface{ HasDatabase(idx string) bool }); ok {
+		return checker.HasDatabase(idx)
+	}
+
+	for _, existing := range h.dbManager.ListDatabases() {
+		if existing == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// handleDatabaseRoutes handles per-database routes under /api/databases/{idx}
+func (h *Handler) handleDatabaseRoutes(w http.ResponseWriter, r *http.Request) {
+	// Parse the path to extract idx and action
+	path := strings.Trim(r.URL.Path[len("/api/databases/"):], "/")
+
+	if path == "" {
+		// Handle /api/databases/ -> same as /api/databases
+		h.DatabasesHandler(w, r)
+		return
+	}
+
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 1 && parts[0] == "alias" {
+		// Handle /api/databases/alias -> map an idx onto another tenant's database
+		h.DatabaseAliasHandler(w, r)
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		// Handle GET /api/databases/{idx} -> tenant details, including its last error
+		h.DatabaseDetailHandler(w, r)
+		return
+	}
+
+	if len(parts) == 1 || (len(parts) == 2 && parts[1] == "exists") {
+		// Handle HEAD /api/databases/{idx} and GET /api/databases/{idx}/exists -> existence check
+		h.DatabaseExistsHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "seed" {
+		// Handle /api/databases/{idx}/seed -> create sample tables and rows on demand
+		h.SeedDatabaseHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "truncate" {
+		// Handle /api/databases/{idx}/truncate -> delete all rows, keep schema
+		h.TruncateDatabaseHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "copy-to-default" {
+		// Handle /api/databases/{idx}/copy-to-default -> promote a tenant's data into the default (or another) database
+		h.CopyToDefaultHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "load" {
+		// Handle /api/databases/{idx}/load?table={table} -> bulk-load a CSV or NDJSON body into a table
+		h.LoadDatabaseHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "query-count" {
+		// Handle /api/databases/{idx}/query-count -> cheap query counter for dashboards
+		h.DatabaseQueryCountHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "metrics" {
+		// Handle /api/databases/{idx}/metrics -> per-tenant usage for billing and observability
+		h.DatabaseMetricsHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "indexes" {
+		// Handle /api/databases/{idx}/indexes -> list indexes and their columns
+		h.DatabaseIndexesHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "compare" {
+		// Handle /api/databases/{idx}/compare?target={other} -> schema diff between two tenants
+		h.CompareDatabasesHandler(w, r)
+		return
+	}
+
+	if len(parts) == 2 && parts[1] == "download" {
+		// Handle /api/databases/{idx}/download -> download SQLite file
+		h.DownloadDatabaseHandler(w, r)
+		return
+	}
+
+	// If no specific endpoint matches, return 404
+	http.NotFound(w, r)
+}
+
+// DatabaseExistsHandler godoc
+// @Summary Check whether a tenant database exists
+// @Description Returns 200 if the tenant's database exists and 404 otherwise, without creating it
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Database exists"
+// @Failure 404 {object} map[string]interface{} "Database does not exist"
+// @Failure 405 {object} Response "Method not allowed"
+// @Router /api/databases/{idx} [head]
+// @Router /api/databases/{idx}/exists [get]
+func (h *Handler) DatabaseExistsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")
+	idx := parts[0]
+
+	// HEAD is only meaningful on the bare resource, GET only on the explicit exists action
+	if (len(parts) == 1 && r.Method != http.MethodHead) || (len(parts) == 2 && r.Method != http.MethodGet) {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	exists := h.databaseExists(idx)
+	statusCode := http.StatusOK
+	if !exists {
+		statusCode = http.StatusNotFound
+	}
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(statusCode)
+		return
+	}
+
+	response := map[string]interface{}{
+		"idx":       idx,
+		"database":  databaseName(idx),
+		"exists":    exists,
+		"status":    "ok",
+		"timestamp": time.Now(),
+	}
+	if err := h.writeJSON(w, r, statusCode, response); err != nil {
+		h.logger.Printf("Error encoding database exists response: %v", err)
+		return
+	}
+}
+
+// SeedDatabaseHandler godoc
+// @Summary Seed a tenant database with sample data
+// @Description Idempotently creates the sample tables and rows and returns the resulting row counts
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Seed result with per-table row counts"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/seed [post]
+func (h *Handler) SeedDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	seeder, ok := h.dbManager.(interface {
+		SeedSampleData(idx string) (map[string]int64, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Database seeding not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	counts, err := seeder.SeedSampleData(idx)
+	h.auditAction(r, audit.ActionTenantSeed, idx, err)
+	if err != nil {
+		h.logger.Printf("Error seeding database for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to seed database", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Sample data seeded successfully",
+		"status":    "ok",
+		"idx":       idx,
+		"database":  databaseName(idx),
+		"tables":    counts,
+		"timestamp": time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding seed database response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Sample data seeded for idx %s from %s", idx, r.RemoteAddr)
+}
+
+// TruncateDatabaseHandler godoc
+// @Summary Truncate a tenant database
+// @Description Deletes all rows from every table in the tenant's database while keeping table definitions
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Param reset_sequences query bool false "Also reset AUTOINCREMENT sequences"
+// @Success 200 {object} map[string]interface{} "Truncated tables"
+// @Failure 400 {object} Response "Invalid reset_sequences value"
+// @Failure 403 {object} Response "Destructive statements blocked for the tenant"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/truncate [post]
+func (h *Handler) TruncateDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	resetSequences := false
+	if resetStr := r.URL.Query().Get("reset_sequences"); resetStr != "" {
+		reset, err := strconv.ParseBool(resetStr)
+		if err != nil {
+			h.sendErrorResponse(w, r, "Invalid reset_sequences value. Use true or false.", http.StatusBadRequest)
+			return
+		}
+		resetSequences = reset
+	}
+
+	truncater, ok := h.dbManager.(interface {
+		TruncateDatabase(idx string, resetSequences bool) ([]string, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Database truncation not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	tables, err := truncater.TruncateDatabase(idx, resetSequences)
+	h.auditAction(r, audit.ActionTenantTruncate, idx, err)
+	if errors.Is(err, ErrDestructiveStatement) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Truncate rejected: %v", err), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error truncating database for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to truncate database", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":         "Database truncated successfully",
+		"status":          "ok",
+		"idx":             idx,
+		"database":        databaseName(idx),
+		"tables":          tables,
+		"reset_sequences": resetSequences,
+		"timestamp":       time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding truncate database response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Database truncated for idx %s from %s", idx, r.RemoteAddr)
+}
+
+// CopyToDefaultHandler godoc
+// @Summary Copy a tenant's data into the default database
+// @Description Copies every table and row of the tenant into the default database, or into the tenant named by target, in one transaction. Rows whose key already exists in the target are left as they are. Requires confirm=true.
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx to copy from"
+// @Param target query string false "Tenant idx to copy into (defaults to the default database)"
+// @Param confirm query bool true "Must be true to confirm writing into the target"
+// @Success 200 {object} map[string]interface{} "Copy result with per-table row counts in the target"
+// @Failure 400 {object} Response "Missing confirmation or invalid target"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/copy-to-default [post]
+func (h *Handler) CopyToDefaultHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	confirm, err := strconv.ParseBool(r.URL.Query().Get("confirm"))
+	if err != nil || !confirm {
+		h.sendErrorResponse(w, r, "Copying into another database requires confirm=true", http.StatusBadRequest)
+		return
+	}
+
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		target = "default"
+	}
+	if target == idx {
+		h.sendErrorResponse(w, r, "Cannot copy a database onto itself", http.StatusBadRequest)
+		return
+	}
+
+	copier, ok := h.dbManager.(interface {
+		CopyDatabase(srcIdx, dstIdx string) (map[string]int64, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Database copying not supported", http.StatusInternalServerError)
+		return
+	}
+
+	for _, required := range []string{idx, target} {
+		if !h.databaseExists(required) {
+			h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", required), http.StatusNotFound)
+			return
+		}
+	}
+
+	counts, err := copier.CopyDatabase(idx, target)
+	h.auditAction(r, audit.ActionTenantCopy, target, err)
+	if err != nil {
+		h.logger.Printf("Error copying database for idx %s to %s: %v", idx, target, err)
+		h.sendErrorResponse(w, r, "Failed to copy database", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":   "Database copied successfully",
+		"status":    "ok",
+		"idx":       idx,
+		"target":    target,
+		"database":  databaseName(target),
+		"tables":    counts,
+		"timestamp": time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding copy database response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Database for idx %s copied to %s from %s", idx, target, r.RemoteAddr)
+}
+
+// AliasRequest is the request body for POST /api/databases/alias
+type AliasRequest struct {
+	Alias  string `json:"alias"`
+	Target string `json:"target"`
+}
+
+// DatabaseAliasHandler godoc
+// @Summary Manage idx aliases
+// @Description POST makes alias resolve to the same database as target, so both idx values share one tenant database. Aliases cannot form cycles or take the name of a tenant that already has its own database. GET lists the aliases.
+// @Tags databases
+// @Accept json
+// @Produce json
+// @Param request body AliasRequest false "Alias to create (for POST)"
+// @Success 200 {object} map[string]interface{} "Aliases"
+// @Success 201 {object} map[string]interface{} "Alias created"
+// @Failure 400 {object} Response "Invalid request"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 409 {object} Response "Alias would form a cycle or shadow an existing tenant"
+// @Failure 500 {object} Response "Aliases not supported"
+// @Router /api/databases/alias [get]
+// @Router /api/databases/alias [post]
+func (h *Handler) DatabaseAliasHandler(w http.ResponseWriter, r *http.Request) {
+	aliaser, ok := h.dbManager.(interface {
+		SetAlias(alias, target string) error
+		Aliases() map[string]string
+	})
+
+	switch r.Method {
+	case http.MethodGet:
+		if !ok {
+			h.sendErrorResponse(w, r, "Database aliases not supported", http.StatusInternalServerError)
+			return
+		}
+		response := map[string]interface{}{
+			"aliases":   aliaser.Aliases(),
+			"status":    "ok",
+			"timestamp": time.Now(),
+		}
+		if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+			h.logger.Printf("Error encoding aliases response: %v", err)
+		}
+	case http.MethodPost:
+		var req AliasRequest
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+		if err := validateIdx("alias", req.Alias); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+		if err := validateIdx("target", req.Target); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+		if req.Alias == req.Target {
+			h.sendErrorResponse(w, r, "An alias cannot point at itself", http.StatusBadRequest)
+			return
+		}
+		if !ok {
+			h.sendErrorResponse(w, r, "Database aliases not supported", http.StatusInternalServerError)
+			return
+		}
+
+		err := aliaser.SetAlias(req.Alias, req.Target)
+		h.auditAction(r, audit.ActionTenantAlias, req.Alias, err)
+		if err != nil {
+			if errors.Is(err, ErrInvalidAlias) {
+				h.sendErrorResponse(w, r, fmt.Sprintf("Cannot alias %s to %s: %v", req.Alias, req.Target, err), http.StatusConflict)
+				return
+			}
+			h.logger.Printf("Error aliasing %s to %s: %v", req.Alias, req.Target, err)
+			h.sendErrorResponse(w, r, "Failed to create alias", http.StatusInternalServerError)
+			return
+		}
+
+		response := map[string]interface{}{
+			"message":   "Alias created successfully",
+			"status":    "ok",
+			"alias":     req.Alias,
+			"target":    req.Target,
+			"database":  databaseName(req.Target),
+			"timestamp": time.Now(),
+		}
+		if err := h.writeJSON(w, r, http.StatusCreated, response); err != nil {
+			h.logger.Printf("Error encoding alias response: %v", err)
+			return
+		}
+		h.logger.Printf("Alias %s -> %s created from %s", req.Alias, req.Target, r.RemoteAddr)
+	default:
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// DatabaseDetailHandler godoc
+// @Summary Get tenant details
+// @Description Returns details of a tenant database, including the most recent error it ran into (a failed open or a rejected statement) and when
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Tenant details"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Router /api/databases/{idx} [get]
+func (h *Handler) DatabaseDetailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	var lastError *TenantError
+	if reporter, ok := h.dbManager.(interface{ LastError(idx string) *TenantError }); ok {
+		lastError = reporter.LastError(idx)
+	}
+
+	// A tenant whose database failed to open has no database but is still worth diagnosing
+	exists := h.databaseExists(idx)
+	if !exists && lastError == nil {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	response := map[string]interface{}{
+		"idx":        idx,
+		"database":   databaseName(idx),
+		"exists":     exists,
+		"last_error": lastError,
+		"status":     "ok",
+		"timestamp":  time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding database detail response: %v", err)
+		return
+	}
+}
+
+// DatabaseQueryCountHandler godoc
+// @Summary Get a tenant's query count
+// @Description Returns the number of logged queries for a tenant and when the last one ran, without reading the logs
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Query count"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/query-count [get]
+func (h *Handler) DatabaseQueryCountHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+
+	counter, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetQueryCount(tenantID string) (int64, *time.Time, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	count, lastQueryAt, err := counter.GetQueryCount(idx)
+	if err != nil {
+		h.logger.Printf("Error getting query count for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to retrieve query count", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"idx":           idx,
+		"query_count":   count,
+		"last_query_at": lastQueryAt,
+		"status":        "ok",
+		"timestamp":     time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding query count response: %v", err)
+		return
+	}
+}
+
+// DatabaseMetricsHandler godoc
+// @Summary Get a tenant's metrics
+// @Description Returns a tenant's query count, error count, average and p95 latency from its query log, and the size of its database
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Tenant metrics"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/metrics [get]
+func (h *Handler) DatabaseMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+
+	metricsSource, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetTenantMetrics(tenantID string) (map[string]interface{}, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	metrics, err := metricsSource.GetTenantMetrics(idx)
+	if err != nil {
+		h.logger.Printf("Error getting metrics for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to retrieve tenant metrics", http.StatusInternalServerError)
+		return
+	}
+
+	// The size is left null where it can't be measured, such as a default database on MySQL
+	var dbSize interface{}
+	if sizer, ok := h.dbManager.(interface {
+		DatabaseSize(idx string) (int64, error)
+	}); ok {
+		if size, err := sizer.DatabaseSize(idx); err != nil {
+			h.logger.Printf("Error getting database size for idx %s: %v", idx, err)
+		} else {
+			dbSize = size
+		}
+	}
+
+	response := map[string]interface{}{
+		"idx":            idx,
+		"query_count":    metrics["query_count"],
+		"error_count":    metrics["error_count"],
+		"avg_latency_ms": metrics["avg_latency_ms"],
+		"p95_latency_ms": metrics["p95_latency_ms"],
+		"db_size_bytes":  dbSize,
+		"status":         "ok",
+		"timestamp":      time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding metrics response: %v", err)
+		return
+	}
+}
+
+// DatabaseIndexesHandler godoc
+// @Summary List a tenant's indexes
+// @Description Returns every index on the tenant's tables with its columns in index order, including the automatic indexes behind PRIMARY KEY and UNIQUE constraints
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Success 200 {object} map[string]interface{} "Indexes"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/indexes [get]
+func (h *Handler) DatabaseIndexesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	lister, ok := h.dbManager.(interface {
+		ListIndexes(idx string) ([]IndexInfo, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Index listing not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+	if h.checkNotModified(w, r, h.schemaModifiedAt(idx)) {
+		return
+	}
+
+	indexes, err := lister.ListIndexes(idx)
+	if err != nil {
+		h.logger.Printf("Error listing indexes for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to list indexes", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"idx":       idx,
+		"database":  databaseName(idx),
+		"indexes":   indexes,
+		"count":     len(indexes),
+		"status":    "ok",
+		"timestamp": time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding indexes response: %v", err)
+		return
+	}
+}
+
+// CompareDatabasesHandler godoc
+// @Summary Compare two tenants' schemas
+// @Description Lists the tables and columns only one of the two tenants has and the columns whose declared types differ, to check that a migration left tenants in step
+// @Tags databases
+// @Produce json
+// @Param idx path string true "Source tenant idx"
+// @Param target query string true "Target tenant idx"
+// @Success 200 {object} map[string]interface{} "Schema differences"
+// @Failure 400 {object} Response "Missing target"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/compare [get]
+func (h *Handler) CompareDatabasesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+	target := r.URL.Query().Get("target")
+	if target == "" {
+		h.sendErrorResponse(w, r, "target is required", http.StatusBadRequest)
+		return
+	}
+
+	comparer, ok := h.dbManager.(interface {
+		CompareSchemas(sourceIdx, targetIdx string) (*SchemaDiff, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Schema comparison not supported", http.StatusInternalServerError)
+		return
+	}
+
+	for _, tenant := range []string{idx, target} {
+		if !h.databaseExists(tenant) {
+			h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", tenant), http.StatusNotFound)
+			return
+		}
+	}
+
+	diff, err := comparer.CompareSchemas(idx, target)
+	if err != nil {
+		h.logger.Printf("Error comparing schemas of idx %s and %s: %v", idx, target, err)
+		h.sendErrorResponse(w, r, "Failed to compare schemas", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"idx":       idx,
+		"target":    target,
+		"diff":      diff,
+		"status":    "ok",
+		"timestamp": time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding schema comparison response: %v", err)
+		return
+	}
+}
+
+// DownloadDatabaseHandler godoc
+// @Summary Download a tenant database file
+// @Description Streams a consistent snapshot of a file-backed tenant's SQLite database
+// @Tags databases
+// @Produce application/octet-stream
+// @Param idx path string true "Tenant idx"
+// @Success 200 {file} file "SQLite database file"
+// @Failure 400 {object} Response "Database is in-memory"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/download [get]
+func (h *Handler) DownloadDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+	if idx == "" {
+		h.sendErrorResponse(w, r, "idx is required", http.StatusBadRequest)
+		return
+	}
+
+	snapshotter, ok := h.dbManager.(interface {
+		IsFileBacked(idx string) bool
+		SnapshotDatabase(idx string, destPath string) error
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Database download not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	if !snapshotter.IsFileBacked(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s is in-memory and cannot be downloaded", idx), http.StatusBadRequest)
+		return
+	}
+
+	// Snapshot into a temporary directory so concurrent writes don't produce a torn copy
+	tmpDir, err := os.MkdirTemp("", "multitenant-db-download-")
+	if err != nil {
+		h.logger.Printf("Error creating temp directory for idx %s download: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to prepare database download", http.StatusInternalServerError)
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshotPath := filepath.Join(tmpDir, "snapshot.db")
+	if err := snapshotter.SnapshotDatabase(idx, snapshotPath); err != nil {
+		h.logger.Printf("Error snapshotting database for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to snapshot database", http.StatusInternalServerError)
+		return
+	}
+
+	file, err := os.Open(snapshotPath)
+	if err != nil {
+		h.logger.Printf("Error opening snapshot for idx %s: %v", idx, err)
+		h.sendErrorResponse(w, r, "Failed to read database snapshot", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", databaseName(idx)+".db"))
+	if info, err := file.Stat(); err == nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size(), 10))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := io.Copy(w, file); err != nil {
+		h.logger.Printf("Error streaming database download for idx %s: %v", idx, err)
+		return
+	}
+
+	h.logger.Printf("Database downloaded for idx %s from %s", idx, r.RemoteAddr)
+}
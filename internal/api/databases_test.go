@@ -0,0 +1,294 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestHandler_DatabaseExists(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := NewMockDatabaseManager()
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	testCases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"HEAD", "/api/databases/test1", http.StatusOK},
+		{"HEAD", "/api/databases/missing_tenant", http.StatusNotFound},
+		{"GET", "/api/databases/test1/exists", http.StatusOK},
+		{"GET", "/api/databases/missing_tenant/exists", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tc.method, tc.path, rr.Code, tc.expected)
+		}
+		if tc.method == "HEAD" && rr.Body.Len() != 0 {
+			t.Errorf("%s %s should not return a body", tc.method, tc.path)
+		}
+		if tc.method == "GET" {
+			var response map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Errorf("Should be able to unmarshal response: %v", err)
+			}
+			if response["exists"] != (tc.expected == http.StatusOK) {
+				t.Errorf("%s %s reported exists=%v", tc.method, tc.path, response["exists"])
+			}
+		}
+	}
+
+	// The existence check must not create the database
+	for _, idx := range mockDB.ListDatabases() {
+		if idx == "missing_tenant" {
+			t.Error("Existence check should not create a database")
+		}
+	}
+}
+
+// seedingMockDatabaseManager adds sample-data seeding to the mock manager
+type seedingMockDatabaseManager struct {
+	*MockDatabaseManager
+	seeded []string
+}
+
+func (m *seedingMockDatabaseManager) SeedSampleData(idx string) (map[string]int64, error) {
+	m.seeded = append(m.seeded, idx)
+	return map[string]int64{"users": 3, "products": 3}, nil
+}
+
+func TestHandler_SeedDatabase(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &seedingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	testCases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"POST", "/api/databases/default/seed", http.StatusOK},
+		{"GET", "/api/databases/default/seed", http.StatusMethodNotAllowed},
+		{"POST", "/api/databases/missing_tenant/seed", http.StatusNotFound},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tc.method, tc.path, rr.Code, tc.expected)
+		}
+		if rr.Code == http.StatusOK {
+			var response map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Should be able to unmarshal response: %v", err)
+			}
+			tables, ok := response["tables"].(map[string]interface{})
+			if !ok || tables["users"] != float64(3) || tables["products"] != float64(3) {
+				t.Errorf("Unexpected table counts: %v", response["tables"])
+			}
+		}
+	}
+
+	if len(mockDB.seeded) != 1 || mockDB.seeded[0] != "default" {
+		t.Errorf("Expected exactly one seed of default, got %v", mockDB.seeded)
+	}
+}
+
+// cappedMockDatabaseManager refuses to create more than max tenant databases, like a manager in reject mode
+type cappedMockDatabaseManager struct {
+	*MockDatabaseManager
+	max     int
+	created int
+}
+
+func (m *cappedMockDatabaseManager) GetOrCreateDatabase(idx string) (interface{}, error) {
+	if m.created >= m.max {
+		return nil, fmt.Errorf("%w (max %d)", ErrTenantLimitReached, m.max)
+	}
+	m.created++
+	return m.MockDatabaseManager.GetOrCreateDatabase(idx)
+}
+
+func TestHandler_DatabasesHandler_TenantLimit(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &cappedMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), max: 2}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	create := func(idx string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(CreateDatabaseRequest{Idx: idx})
+		req := httptest.NewRequest(http.MethodPost, "/api/databases", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, idx := range []string{"tenant_a", "tenant_b"} {
+		if rr := create(idx); rr.Code != http.StatusCreated {
+			t.Fatalf("Expected %s to be created, got %d: %s", idx, rr.Code, rr.Body.String())
+		}
+	}
+
+	rr := create("tenant_c")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 past the tenant limit, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Status != "error" || !strings.Contains(response.Message, "tenant database limit reached") {
+		t.Errorf("Expected a clear limit error, got %+v", response)
+	}
+}
+
+// copyingMockDatabaseManager records the copies it is asked to make
+type copyingMockDatabaseManager struct {
+	*MockDatabaseManager
+	copies [][2]string
+}
+
+func (m *copyingMockDatabaseManager) CopyDatabase(srcIdx, dstIdx string) (map[string]int64, error) {
+	m.copies = append(m.copies, [2]string{srcIdx, dstIdx})
+	return map[string]int64{"users": 4, "products": 3}, nil
+}
+
+func TestHandler_CopyToDefault(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &copyingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	testCases := []struct {
+		method   string
+		path     string
+		expected int
+	}{
+		{"POST", "/api/databases/test1/copy-to-default?confirm=true", http.StatusOK},
+		{"POST", "/api/databases/test1/copy-to-default?confirm=true&target=test2", http.StatusOK},
+		{"POST", "/api/databases/test1/copy-to-default", http.StatusBadRequest},
+		{"POST", "/api/databases/test1/copy-to-default?confirm=false", http.StatusBadRequest},
+		{"POST", "/api/databases/test1/copy-to-default?confirm=true&target=test1", http.StatusBadRequest},
+		{"POST", "/api/databases/missing_tenant/copy-to-default?confirm=true", http.StatusNotFound},
+		{"POST", "/api/databases/test1/copy-to-default?confirm=true&target=missing_tenant", http.StatusNotFound},
+		{"GET", "/api/databases/test1/copy-to-default?confirm=true", http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		req, err := http.NewRequest(tc.method, tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tc.method, tc.path, rr.Code, tc.expected)
+		}
+		if rr.Code == http.StatusOK {
+			var response map[string]interface{}
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Should be able to unmarshal response: %v", err)
+			}
+			tables, ok := response["tables"].(map[string]interface{})
+			if !ok || tables["users"] != float64(4) {
+				t.Errorf("Unexpected table counts: %v", response["tables"])
+			}
+		}
+	}
+
+	expected := [][2]string{{"test1", "default"}, {"test1", "test2"}}
+	if len(mockDB.copies) != len(expected) || mockDB.copies[0] != expected[0] || mockDB.copies[1] != expected[1] {
+		t.Errorf("Expected copies %v, got %v", expected, mockDB.copies)
+	}
+}
+
+// aliasingMockDatabaseManager adds idx aliases to the mock manager
+type aliasingMockDatabaseManager struct {
+	*MockDatabaseManager
+	aliases map[string]string
+}
+
+func (m *aliasingMockDatabaseManager) SetAlias(alias, target string) error {
+	if _, exists := m.databases[alias]; exists {
+		return fmt.Errorf("%w: idx %s already has its own database", ErrInvalidAlias, alias)
+	}
+	m.aliases[alias] = target
+	return nil
+}
+
+func (m *aliasingMockDatabaseManager) Aliases() map[string]string {
+	return m.aliases
+}
+
+func TestHandler_DatabaseAlias(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &aliasingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), aliases: make(map[string]string)}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	testCases := []struct {
+		method   string
+		body     string
+		expected int
+	}{
+		{"POST", `{"alias": "acme-corp", "target": "test1"}`, http.StatusCreated},
+		{"POST", `{"alias": "test2", "target": "test1"}`, http.StatusConflict},
+		{"POST", `{"alias": "acme", "target": "acme"}`, http.StatusBadRequest},
+		{"POST", `{"alias": "acme"}`, http.StatusBadRequest},
+		{"POST", `not json`, http.StatusBadRequest},
+		{"DELETE", ``, http.StatusMethodNotAllowed},
+	}
+
+	for _, tc := range testCases {
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, httptest.NewRequest(tc.method, "/api/databases/alias", strings.NewReader(tc.body)))
+		if rr.Code != tc.expected {
+			t.Errorf("%s %s returned wrong status code: got %v want %v", tc.method, tc.body, rr.Code, tc.expected)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/databases/alias", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 listing aliases, got %d", rr.Code)
+	}
+	var response struct {
+		Aliases map[string]string `json:"aliases"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if len(response.Aliases) != 1 || response.Aliases["acme-corp"] != "test1" {
+		t.Errorf("Unexpected aliases: %v", response.Aliases)
+	}
+
+	// Managers without alias support report an error
+	rr = httptest.NewRecorder()
+	NewHandler(logger, NewMockDatabaseManager()).SetupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/databases/alias", strings.NewReader(`{"alias": "a", "target": "b"}`)))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 without alias support, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// Supported API response versions
+const (
+	APIVersion1       = "1" // Flat response objects (original shape)
+	APIVersion2       = "2" // Payload wrapped under "data" (or "error") with a common envelope
+	DefaultAPIVersion = APIVersion1
+
+	// APIVersionHeader is the response header reporting which shape was used
+	APIVersionHeader = "Api-Version"
+)
+
+// acceptVersionRegex matches vendor media types such as application/vnd.multitenant-db.v2+json
+var acceptVersionRegex = regexp.MustCompile(`application/vnd\.multitenant-db\.v(\d+)\+json`)
+
+// EnvelopeV2 is the response shape used for API version 2
+type EnvelopeV2 struct {
+	APIVersion string                 `json:"api_version"`
+	Status     string                 `json:"status"`
+	Data       map[string]interface{} `json:"data,omitempty"`
+	Error      map[string]interface{} `json:"error,omitempty"`
+	Timestamp  time.Time              `json:"timestamp"`
+}
+
+// isSupportedAPIVersion reports whether version is one the API can render
+func isSupportedAPIVersion(version string) bool {
+	return version == APIVersion1 || version == APIVersion2
+}
+
+// requestedAPIVersion picks the response version from ?api_version= or the Accept header,
+// falling back to the default for missing or unsupported versions
+func requestedAPIVersion(r *http.Request) string {
+	if r == nil {
+		return DefaultAPIVersion
+	}
+
+	if version := r.URL.Query().Get("api_version"); isSupportedAPIVersion(version) {
+		return version
+	}
+
+	if matches := acceptVersionRegex.FindStringSubmatch(r.Header.Get("Accept")); len(matches) == 2 && isSupportedAPIVersion(matches[1]) {
+		return matches[1]
+	}
+
+	return DefaultAPIVersion
+}
+
+// buildEnvelope converts a v1 (flat) payload into the shape for the requested version
+func buildEnvelope(version string, payload interface{}) (interface{}, error) {
+	if version != APIVersion2 {
+		return payload, nil
+	}
+
+	// Round-trip through JSON so every handler's payload can be enveloped the same way
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	fields := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	status, _ := fields["status"].(string)
+	if status == "" {
+		status = "ok"
+	}
+	delete(fields, "status")
+	delete(fields, "timestamp")
+
+	envelope := EnvelopeV2{
+		APIVersion: APIVersion2,
+		Status:     status,
+		Timestamp:  time.Now(),
+	}
+	if status == "error" {
+		envelope.Error = fields
+	} else {
+		envelope.Data = fields
+	}
+	return envelope, nil
+}
+
+// writeJSON writes payload as JSON using the envelope for the request's API version
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, statusCode int, payload interface{}) error {
+	version := requestedAPIVersion(r)
+	body, envelopeErr := buildEnvelope(version, payload)
+	if envelopeErr != nil {
+		// The payload can't be enveloped, so an enveloped error goes out in its place
+		statusCode = http.StatusInternalServerError
+		body, _ = buildEnvelope(version, Response{Message: "Internal Server Error", Status: "error", Timestamp: time.Now()})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(APIVersionHeader, version)
+	w.WriteHeader(statusCode)
+
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		return err
+	}
+	return envelopeErr
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestEnvelope_DatabasesListV1(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+
+	req, err := http.NewRequest("GET", "/api/databases", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, req)
+
+	if version := rr.Header().Get(APIVersionHeader); version != APIVersion1 {
+		t.Errorf("Expected %s header %s, got %s", APIVersionHeader, APIVersion1, version)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if _, ok := response["databases"].([]interface{}); !ok {
+		t.Error("v1 response should have databases at the top level")
+	}
+	if _, ok := response["data"]; ok {
+		t.Error("v1 response should not be wrapped under data")
+	}
+	if response["status"] != "ok" {
+		t.Errorf("Expected status 'ok', got %v", response["status"])
+	}
+}
+
+func TestEnvelope_DatabasesListV2(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+
+	requests := map[string]func() *http.Request{
+		"query parameter": func() *http.Request {
+			req, _ := http.NewRequest("GET", "/api/databases?api_version=2", nil)
+			return req
+		},
+		"accept header": func() *http.Request {
+			req, _ := http.NewRequest("GET", "/api/databases", nil)
+			req.Header.Set("Accept", "application/vnd.multitenant-db.v2+json")
+			return req
+		},
+	}
+
+	for name, newRequest := range requests {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, newRequest())
+
+			if version := rr.Header().Get(APIVersionHeader); version != APIVersion2 {
+				t.Errorf("Expected %s header %s, got %s", APIVersionHeader, APIVersion2, version)
+			}
+
+			var response EnvelopeV2
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Should be able to unmarshal response: %v", err)
+			}
+			if response.Status != "ok" || response.APIVersion != APIVersion2 {
+				t.Errorf("Unexpected v2 envelope: %+v", response)
+			}
+			databases, ok := response.Data["databases"].([]interface{})
+			if !ok || len(databases) == 0 {
+				t.Errorf("v2 response should wrap databases under data, got %v", response.Data)
+			}
+			if _, ok := response.Data["status"]; ok {
+				t.Error("status should live on the envelope, not inside data")
+			}
+		})
+	}
+}
+
+func TestEnvelope_ErrorResponseV2(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+
+	req, _ := http.NewRequest("GET", "/api/databases/unknown/download?api_version=2", nil)
+	rr := httptest.NewRecorder()
+	handler.sendErrorResponse(rr, req, "Something went wrong", http.StatusBadRequest)
+
+	var response EnvelopeV2
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if rr.Code != http.StatusBadRequest || response.Status != "error" {
+		t.Errorf("Expected error envelope with 400, got %d %+v", rr.Code, response)
+	}
+	if response.Error["message"] != "Something went wrong" {
+		t.Errorf("Expected error message under error, got %v", response.Error)
+	}
+}
+
+func TestRequestedAPIVersion_UnsupportedFallsBack(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/databases?api_version=99", nil)
+	if version := requestedAPIVersion(req); version != DefaultAPIVersion {
+		t.Errorf("Unsupported versions should fall back to %s, got %s", DefaultAPIVersion, version)
+	}
+}
+
+func TestEnvelope_DatabaseErrorsV2(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+
+	testCases := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{"DELETE", "/api/databases?api_version=2", http.StatusBadRequest},
+		{"DELETE", "/api/databases?idx=default&api_version=2", http.StatusBadRequest},
+		{"DELETE", "/api/databases?idx=error_test&api_version=2", http.StatusInternalServerError},
+		{"PUT", "/api/databases?api_version=2", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range testCases {
+		req, _ := http.NewRequest(tc.method, tc.path, nil)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, req)
+
+		var response EnvelopeV2
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Errorf("%s %s: expected a JSON envelope, got %q", tc.method, tc.path, rr.Body.String())
+			continue
+		}
+		if rr.Code != tc.status || response.Status != "error" || response.Error["message"] == nil {
+			t.Errorf("%s %s: expected error envelope with %d, got %d %+v", tc.method, tc.path, tc.status, rr.Code, response)
+		}
+	}
+}
+
+func TestEnvelope_UnencodablePayload(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+
+	req, _ := http.NewRequest("GET", "/api/databases?api_version=2", nil)
+	rr := httptest.NewRecorder()
+	if err := handler.writeJSON(rr, req, http.StatusOK, map[string]interface{}{"bad": func() {}}); err == nil {
+		t.Error("Expected an error for a payload that cannot be encoded")
+	}
+
+	var response EnvelopeV2
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Expected a JSON envelope, got %q", rr.Body.String())
+	}
+	if rr.Code != http.StatusInternalServerError || response.Status != "error" {
+		t.Errorf("Expected error envelope with 500, got %d %+v", rr.Code, response)
+	}
+}
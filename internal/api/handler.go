@@ -1,11 +1,15 @@
 package api
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
+
+	"multitenant-db/internal/audit"
 )
 
 // DatabaseManager interface to avoid circular imports
@@ -16,9 +20,28 @@ type DatabaseManager interface {
 	ListDatabases() []string
 }
 
+// ErrTenantLimitReached is returned by a DatabaseManager that refuses to create another tenant database
+var ErrTenantLimitReached = errors.New("tenant database limit reached")
+
+// ErrDatabaseExists is returned by a DatabaseManager asked to provision a database that already exists
+var ErrDatabaseExists = errors.New("database already exists")
+
+// ErrInvalidAlias is returned by a DatabaseManager when an alias would form a cycle or shadow an existing tenant
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// ErrInvalidSchema is returned by a DatabaseManager when the schema SQL for a new database is rejected or fails
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// ErrInvalidQuery is returned by a DatabaseManager when a query is rejected as invalid SQL
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ErrDestructiveStatement is returned by a DatabaseManager that refuses a DROP, TRUNCATE or DELETE without WHERE
+var ErrDestructiveStatement = errors.New("destructive statement blocked")
+
 // Response struct for JSON responses
 type Response struct {
 	Message   string    `json:"message"`
+	Field     string    `json:"field,omitempty"` // Request body field a 400 response is about
 	Status    string    `json:"status"`
 	Timestamp time.Time `json:"timestamp"`
 }
@@ -26,25 +49,42 @@ type Response struct {
 // DatabaseResponse struct for database operations
 type DatabaseResponse struct {
 	Databases []DatabaseInfo `json:"databases"`
+	Total     int            `json:"total"`            // Databases matching the prefix, before limit and offset
+	Limit     int            `json:"limit,omitempty"`  // Page size requested, 0 for all
+	Offset    int            `json:"offset,omitempty"` // Matching databases skipped before this page
 	Status    string         `json:"status"`
 	Timestamp time.Time      `json:"timestamp"`
 }
 
 // DatabaseInfo struct for database information
 type DatabaseInfo struct {
-	Name string `json:"name"`
-	Idx  string `json:"idx"`
+	Name      string       `json:"name"`
+	Idx       string       `json:"idx"`
+	LastQuery *TenantQuery `json:"last_query,omitempty"` // Preview of the most recent statement over the MySQL protocol
 }
 
 // CreateDatabaseRequest struct for database creation
 type CreateDatabaseRequest struct {
-	Idx string `json:"idx"`
+	Idx       string `json:"idx"`
+	Seed      *bool  `json:"seed,omitempty"`       // Create the sample tables and rows (default true)
+	SchemaSQL string `json:"schema_sql,omitempty"` // Statements run in a transaction right after creation
 }
 
+// Default service branding used when none is configured
+const (
+	DefaultServiceName        = "multitenant-db"
+	DefaultServiceDescription = "A MySQL-compatible multi-tenant database server with per-idx isolation"
+)
+
 // Handler represents the HTTP API handler
 type Handler struct {
 	logger *log.Logger
 	dbManager DatabaseManager
+	serviceName        string        // Configured service name, empty for the default
+	serviceDescription string        // Configured service description, empty for the default
+	debugEnabled       bool          // Whether ?debug=true may expose executed SQL in responses
+	auditLog           *audit.Logger // Trail of administrative actions, nil when auditing is off
+	loadLimit          int64         // Largest bulk load body in bytes, 0 for DefaultMaxLoadBytes
 }
 
 // NewHandler creates a new API handler
@@ -55,6 +95,46 @@ func NewHandler(logger *log.Logger, dbManager DatabaseManager) *Handler {
 	}
 }
 
+// SetServiceInfo overrides the service name and description reported by the root and info
+// endpoints. Empty values keep the defaults.
+func (h *Handler) SetServiceInfo(name, description string) {
+	h.serviceName = name
+	h.serviceDescription = description
+}
+
+// SetDebugEnabled allows clients to request debugging details such as the executed SQL with
+// ?debug=true. It is off by default since those details may reveal more than the caller sent.
+func (h *Handler) SetDebugEnabled(enabled bool) {
+	h.debugEnabled = enabled
+}
+
+// SetAuditLogger records administrative actions such as creating and deleting databases in
+// auditLog. A nil logger disables auditing.
+func (h *Handler) SetAuditLogger(auditLog *audit.Logger) {
+	h.auditLog = auditLog
+}
+
+// SetMaxLoadBytes limits the size of a bulk load body. Zero or less restores DefaultMaxLoadBytes.
+func (h *Handler) SetMaxLoadBytes(limit int64) {
+	h.loadLimit = limit
+}
+
+// auditAction records an administrative action by the client of r, failed if err is not nil
+func (h *Handler) auditAction(r *http.Request, action, idx string, err error) {
+	if auditErr := h.auditLog.Record(r.RemoteAddr, action, idx, err); auditErr != nil {
+		h.logger.Printf("Failed to write audit entry for %s on idx %s: %v", action, idx, auditErr)
+	}
+}
+
+// debugRequested reports whether r asked for debugging details and they are enabled
+func (h *Handler) debugRequested(r *http.Request) bool {
+	if !h.debugEnabled {
+		return false
+	}
+	debug, err := strconv.ParseBool(r.URL.Query().Get("debug"))
+	return err == nil && debug
+}
+
 // Middleware for logging HTTP requests
 func (h *Handler) LoggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -83,12 +163,8 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 		h.logger.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 	
@@ -104,18 +180,19 @@ func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 // @Router / [get]
 // Root endpoint
 func (h *Handler) RootHandler(w http.ResponseWriter, r *http.Request) {
+	message := "Welcome to Multitenant DB!"
+	if h.serviceName != "" {
+		message = "Welcome to " + h.serviceName + "!"
+	}
+	
 	response := Response{
-		Message:   "Welcome to Multitenant DB!",
+		Message:   message,
 		Status:    "ok",
 		Timestamp: time.Now(),
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 		h.logger.Printf("Error encoding response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 	
@@ -131,10 +208,18 @@ func (h *Handler) RootHandler(w http.ResponseWriter, r *http.Request) {
 // @Router /api/info [get]
 // Info endpoint with API information
 func (h *Handler) InfoHandler(w http.ResponseWriter, r *http.Request) {
+	service, description := DefaultServiceName, DefaultServiceDescription
+	if h.serviceName != "" {
+		service = h.serviceName
+	}
+	if h.serviceDescription != "" {
+		description = h.serviceDescription
+	}
+	
 	info := map[string]interface{}{
-		"service":     "multitenant-db",
+		"service":     service,
 		"version":     "1.0.0",
-		"description": "A MySQL-compatible multi-tenant database server with per-idx isolation",
+		"description": description,
 		"protocols": map[string]interface{}{
 			"http": map[string]interface{}{
 				"port": 8080,
@@ -145,16 +230,42 @@ func (h *Handler) InfoHandler(w http.ResponseWriter, r *http.Request) {
 				       "GET /api/databases",
 				       "POST /api/databases",
 				       "DELETE /api/databases?idx=<idx>",
+				       "GET /api/databases/{idx}",
+				       "HEAD /api/databases/{idx}",
+				       "GET /api/databases/{idx}/exists",
+				       "GET /api/databases/{idx}/download",
+				       "POST /api/databases/{idx}/seed",
+				       "POST /api/databases/{idx}/truncate",
+				       "POST /api/databases/{idx}/copy-to-default?confirm=true",
+				       "GET /api/databases/alias",
+				       "POST /api/databases/alias",
+				       "GET /api/databases/{idx}/query-count",
+				       "GET /api/databases/{idx}/metrics",
+				       "GET /api/databases/{idx}/indexes",
+				       "POST /api/query",
+				       "GET /api/query-stream?idx=<idx>&q=<select>",
+				       "GET /api/stats",
+				       "GET /metrics",
 			       },
 			},
 			"mysql": map[string]interface{}{
 				"port":       3306,
 				"connection": "mysql -h 127.0.0.1 -P 3306 -u root --protocol=TCP",
 				"features": []string{
-					"SHOW TABLES",
+					"SHOW [FULL] TABLES",
 					"SHOW DATABASES",
 					"SELECT queries",
 					"DESCRIBE tables",
+					"SHOW GRANTS",
+					"SHOW WARNINGS",
+					"SET TRANSACTION",
+					"SELECT FOUND_ROWS()",
+					"SELECT CONNECTION_ID()",
+					"SHOW PROCESSLIST",
+					"KILL [QUERY | CONNECTION]",
+					"SELECT NOW() / UNIX_TIMESTAMP()",
+					"ANALYZE / OPTIMIZE TABLE",
+					"CALL truncate_tenant() / seed_sample_data()",
 					"Basic INSERT support",
 					"Connection Attributes",
 				},
@@ -180,12 +291,8 @@ func (h *Handler) InfoHandler(w http.ResponseWriter, r *http.Request) {
 		"timestamp": time.Now(),
 	}
 	
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	
-	if err := json.NewEncoder(w).Encode(info); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, info); err != nil {
 		h.logger.Printf("Error encoding API info response: %v", err)
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 	
@@ -194,15 +301,21 @@ func (h *Handler) InfoHandler(w http.ResponseWriter, r *http.Request) {
 
 // DatabasesHandler godoc
 // @Summary Manage tenant databases
-// @Description List, create, or delete tenant databases
+// @Description List, create, or delete tenant databases. The list previews each tenant's most recent statement and when it ran, with prepared-statement arguments shown as the query log shows them. On create, schema_sql is run in a transaction right after the database is created and seed (default true) controls the sample data; if the schema fails the database is not created. Creating a database that already exists without schema_sql or seed succeeds with 200 and created false.
 // @Tags databases
 // @Produce json
 // @Param idx query string false "Tenant idx (for DELETE)"
+// @Param prefix query string false "Only list idxs starting with this prefix (for GET)"
+// @Param sort query string false "Order of the list: idx (default) or last_accessed, most recent first (for GET)"
+// @Param limit query int false "Maximum number of databases, 1 to 1000 (for GET, default: all)"
+// @Param offset query int false "Number of matching databases to skip (for GET, default: 0)"
 // @Param request body CreateDatabaseRequest false "Create database request (for POST)"
-// @Success 200 {object} DatabaseResponse "List/Delete success"
+// @Success 200 {object} DatabaseResponse "List/Delete success, or the database already existed"
 // @Success 201 {object} map[string]interface{} "Create success"
 // @Failure 400 {object} map[string]interface{} "Bad request"
 // @Failure 405 {object} map[string]interface{} "Method not allowed"
+// @Failure 409 {object} Response "Database already exists (with schema_sql or seed)"
+// @Failure 429 {object} Response "Tenant database limit reached"
 // @Failure 500 {object} map[string]interface{} "Internal error"
 // @Router /api/databases [get]
 // @Router /api/databases [post]
@@ -211,8 +324,21 @@ func (h *Handler) InfoHandler(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) DatabasesHandler(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		databases := h.dbManager.ListDatabases()
-		var dbInfos []DatabaseInfo
+		params, err := parseDatabaseListParams(r)
+		if err != nil {
+			h.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+		
+		// The list changes whenever a tenant runs a statement too, not only when databases come and go
+		modified := h.databasesModifiedAt()
+		databases, total, accessed := h.listDatabases(params)
+		if !modified.IsZero() && accessed.After(modified) {
+			modified = accessed
+		}
+		reporter, previews := h.dbManager.(interface{ LastQuery(idx string) *TenantQuery })
+		
+		dbInfos := []DatabaseInfo{}
 		for _, idx := range databases {
 			var name string
 			if idx == "" || idx == "default" {
@@ -220,38 +346,78 @@ func (h *Handler) DatabasesHandler(w http.ResponseWriter, r *http.Request) {
 			} else {
 				name = "multitenant_db_idx_" + idx
 			}
-			dbInfos = append(dbInfos, DatabaseInfo{
+			info := DatabaseInfo{
 				Name: name,
 				Idx:  idx,
-			})
+			}
+			if previews {
+				info.LastQuery = reporter.LastQuery(idx)
+				if info.LastQuery != nil && !modified.IsZero() && info.LastQuery.At.After(modified) {
+					modified = info.LastQuery.At
+				}
+			}
+			dbInfos = append(dbInfos, info)
+		}
+		if h.checkNotModified(w, r, modified) {
+			return
 		}
 		response := DatabaseResponse{
 			Databases: dbInfos,
+			Total:     total,
+			Limit:     params.limit,
+			Offset:    params.offset,
 			Status:    "ok",
 			Timestamp: time.Now(),
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(response); err != nil {
+		if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 			h.logger.Printf("Error encoding databases response: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 		h.logger.Printf("Databases listed for %s", r.RemoteAddr)
 	case http.MethodPost:
 		var req CreateDatabaseRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid JSON request", http.StatusBadRequest)
+		if err := decodeJSONBody(r, &req, false); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+		if err := validateIdx("idx", req.Idx); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+		// A custom schema or seed choice needs a fresh database; otherwise creation is idempotent
+		var err error
+		created := true
+		if req.SchemaSQL != "" || req.Seed != nil {
+			creator, ok := h.dbManager.(interface {
+				CreateDatabase(idx string, seed bool, schemaSQL string) error
+			})
+			if !ok {
+				h.sendErrorResponse(w, r, "Schema provisioning not supported", http.StatusInternalServerError)
+				return
+			}
+			err = creator.CreateDatabase(req.Idx, req.Seed == nil || *req.Seed, req.SchemaSQL)
+		} else {
+			created = !h.databaseExists(req.Idx)
+			_, err = h.dbManager.GetOrCreateDatabase(req.Idx)
+		}
+		h.auditAction(r, audit.ActionTenantCreate, req.Idx, err)
+		if errors.Is(err, ErrTenantLimitReached) {
+			h.logger.Printf("Refused to create database for idx %s: %v", req.Idx, err)
+			h.sendErrorResponse(w, r, fmt.Sprintf("Cannot create database for idx %s: %v", req.Idx, err), http.StatusTooManyRequests)
 			return
 		}
-		if req.Idx == "" {
-			http.Error(w, "idx field is required", http.StatusBadRequest)
+		if errors.Is(err, ErrDatabaseExists) {
+			h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s already exists", req.Idx), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, ErrInvalidSchema) {
+			h.logger.Printf("Schema for idx %s failed: %v", req.Idx, err)
+			h.sendErrorResponse(w, r, fmt.Sprintf("Cannot create database for idx %s: %v", req.Idx, err), http.StatusBadRequest)
 			return
 		}
-		_, err := h.dbManager.GetOrCreateDatabase(req.Idx)
 		if err != nil {
 			h.logger.Printf("Error creating database for idx %s: %v", req.Idx, err)
-			http.Error(w, "Failed to create database", http.StatusInternalServerError)
+			h.sendErrorResponse(w, r, "Failed to create database", http.StatusInternalServerError)
 			return
 		}
 		var name string
@@ -265,30 +431,36 @@ func (h *Handler) DatabasesHandler(w http.ResponseWriter, r *http.Request) {
 			"status":    "ok",
 			"database":  name,
 			"idx":       req.Idx,
+			"created":   created,
 			"timestamp": time.Now(),
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusCreated)
-		if err := json.NewEncoder(w).Encode(response); err != nil {
+		status := http.StatusCreated
+		if !created {
+			response["message"] = "Database already exists"
+			status = http.StatusOK
+		}
+		if err := h.writeJSON(w, r, status, response); err != nil {
 			h.logger.Printf("Error encoding create database response: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		h.logger.Printf("Database created for idx %s from %s", req.Idx, r.RemoteAddr)
+		if created {
+			h.logger.Printf("Database created for idx %s from %s", req.Idx, r.RemoteAddr)
+		}
 	case http.MethodDelete:
 		idx := r.URL.Query().Get("idx")
 		if idx == "" {
-			http.Error(w, "idx query parameter is required", http.StatusBadRequest)
+			h.sendErrorResponse(w, r, "idx query parameter is required", http.StatusBadRequest)
 			return
 		}
 		if idx == "default" {
-			http.Error(w, "Cannot delete default database", http.StatusBadRequest)
+			h.sendErrorResponse(w, r, "Cannot delete default database", http.StatusBadRequest)
 			return
 		}
 		err := h.dbManager.DeleteDatabase(idx)
+		h.auditAction(r, audit.ActionTenantDelete, idx, err)
 		if err != nil {
 			h.logger.Printf("Error deleting database for idx %s: %v", idx, err)
-			http.Error(w, "Failed to delete database", http.StatusInternalServerError)
+			h.sendErrorResponse(w, r, "Failed to delete database", http.StatusInternalServerError)
 			return
 		}
 		response := map[string]interface{}{
@@ -297,16 +469,13 @@ func (h *Handler) DatabasesHandler(w http.ResponseWriter, r *http.Request) {
 			"idx":       idx,
 			"timestamp": time.Now(),
 		}
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusOK)
-		if err := json.NewEncoder(w).Encode(response); err != nil {
+		if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 			h.logger.Printf("Error encoding delete database response: %v", err)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 		h.logger.Printf("Database deleted for idx %s from %s", idx, r.RemoteAddr)
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
@@ -319,10 +488,17 @@ func (h *Handler) SetupRoutes() *http.ServeMux {
 	mux.HandleFunc("/health", h.HealthHandler)
 	mux.HandleFunc("/api/info", h.InfoHandler)
 	mux.HandleFunc("/api/databases", h.DatabasesHandler)
+	mux.HandleFunc("/api/databases/", h.handleDatabaseRoutes)
+	mux.HandleFunc("/api/query", h.QueryHandler)
+	mux.HandleFunc("/api/query-stream", h.QueryStreamHandler)
+	mux.HandleFunc("/api/stats", h.StatsHandler)
+	mux.HandleFunc("/metrics", h.MetricsHandler)
 	
 	// Query log routes - simplified paths
 	mux.HandleFunc("/api/query-logs", h.ListQueryLogTenantsHandler)
 	mux.HandleFunc("/api/query-logs/", h.handleQueryLogRoutes)
+	// Kept outside /api/query-logs/ so it never shadows a tenant's logs
+	mux.HandleFunc("/api/query-log-sizes", h.GetQueryLogSizesHandler)
 	
 	return mux
 }
@@ -357,6 +533,30 @@ func (h *Handler) handleQueryLogRoutes(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	
+	if len(parts) == 2 && parts[1] == "purge-failed" {
+		// Handle /api/query-logs/{tenantId}/purge-failed -> delete failed queries for tenant
+		h.PurgeFailedQueriesHandler(w, r)
+		return
+	}
+	
+	if len(parts) == 2 && parts[1] == "replay" {
+		// Handle /api/query-logs/{tenantId}/replay -> re-run logged queries against another tenant
+		h.ReplayQueryLogHandler(w, r)
+		return
+	}
+	
+	if len(parts) == 2 && parts[1] == "errors" {
+		// Handle /api/query-logs/{tenantId}/errors -> get failed queries for tenant
+		h.GetQueryLogErrorsHandler(w, r)
+		return
+	}
+	
+	if len(parts) == 2 && parts[1] == "slowest" {
+		// Handle /api/query-logs/{tenantId}/slowest -> get slowest queries for tenant
+		h.GetSlowestQueriesHandler(w, r)
+		return
+	}
+	
 	// If no specific endpoint matches, return 404
 	http.NotFound(w, r)
 }
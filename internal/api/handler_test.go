@@ -4,14 +4,18 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"multitenant-db/internal/audit"
 )
 
 // MockDatabaseManager implements the DatabaseManager interface for testing
@@ -211,6 +215,91 @@ func TestHandler_DatabasesHandler_List(t *testing.T) {
 	}
 }
 
+// accessTrackingDatabaseManager reports when each of its databases was last used
+type accessTrackingDatabaseManager struct {
+	*MockDatabaseManager
+	accessed map[string]time.Time
+}
+
+func (m *accessTrackingDatabaseManager) LastAccessedAt(idx string) time.Time {
+	return m.accessed[idx]
+}
+
+func TestHandler_DatabasesHandler_ListFilterAndPaging(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	now := time.Now()
+	mockDB := &accessTrackingDatabaseManager{
+		MockDatabaseManager: NewMockDatabaseManager(),
+		accessed: map[string]time.Time{
+			"test1": now.Add(-time.Hour),
+			"test2": now,
+			"test3": now.Add(-time.Minute),
+		},
+	}
+	for _, idx := range []string{"test3", "test4", "other"} {
+		mockDB.GetOrCreateDatabase(idx)
+	}
+	handler := NewHandler(logger, mockDB)
+
+	list := func(query string) DatabaseResponse {
+		t.Helper()
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/api/databases"+query, nil))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200 for %s, got %d: %s", query, rr.Code, rr.Body.String())
+		}
+		var response DatabaseResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Should be able to unmarshal response: %v", err)
+		}
+		return response
+	}
+	idxs := func(response DatabaseResponse) []string {
+		result := []string{}
+		for _, db := range response.Databases {
+			result = append(result, db.Idx)
+		}
+		return result
+	}
+
+	// Without parameters every database is listed, sorted by idx
+	response := list("")
+	if got := idxs(response); !reflect.DeepEqual(got, []string{"default", "other", "test1", "test2", "test3", "test4"}) || response.Total != 6 {
+		t.Errorf("Expected all 6 databases in idx order, got %v (total %d)", got, response.Total)
+	}
+
+	response = list("?prefix=test")
+	if got := idxs(response); !reflect.DeepEqual(got, []string{"test1", "test2", "test3", "test4"}) || response.Total != 4 {
+		t.Errorf("Expected the 4 test databases, got %v (total %d)", got, response.Total)
+	}
+
+	// Pages are cut from the filtered, sorted list and the total counts every match
+	response = list("?prefix=test&limit=2&offset=1")
+	if got := idxs(response); !reflect.DeepEqual(got, []string{"test2", "test3"}) || response.Total != 4 {
+		t.Errorf("Expected page [test2 test3] of 4, got %v (total %d)", got, response.Total)
+	}
+	if response.Limit != 2 || response.Offset != 1 {
+		t.Errorf("Expected limit 2 and offset 1 echoed, got %d and %d", response.Limit, response.Offset)
+	}
+	if got := idxs(list("?prefix=test&limit=2&offset=10")); len(got) != 0 {
+		t.Errorf("Expected an empty page past the end, got %v", got)
+	}
+
+	// Most recently used first; databases never used come last in idx order
+	response = list("?prefix=test&sort=last_accessed")
+	if got := idxs(response); !reflect.DeepEqual(got, []string{"test2", "test3", "test1", "test4"}) {
+		t.Errorf("Expected last-accessed order [test2 test3 test1 test4], got %v", got)
+	}
+
+	for _, query := range []string{"?sort=size", "?limit=0", "?limit=1001", "?limit=ten", "?offset=-1"} {
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/api/databases"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s, got %d", query, rr.Code)
+		}
+	}
+}
+
 func TestHandler_DatabasesHandler_Create(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	mockDB := NewMockDatabaseManager()
@@ -249,6 +338,41 @@ func TestHandler_DatabasesHandler_Create(t *testing.T) {
 	}
 }
 
+func TestHandler_DatabasesHandler_CreateExisting(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := NewMockDatabaseManager()
+	handler := NewHandler(logger, mockDB)
+
+	create := func() (int, map[string]interface{}) {
+		req, err := http.NewRequest("POST", "/api/databases", strings.NewReader(`{"idx": "repeat_db"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(rr, req)
+
+		var response map[string]interface{}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Should be able to unmarshal response: %v", err)
+		}
+		return rr.Code, response
+	}
+
+	status, response := create()
+	if status != http.StatusCreated || response["created"] != true {
+		t.Errorf("Expected 201 with created true on first create, got %d %v", status, response)
+	}
+
+	status, response = create()
+	if status != http.StatusOK || response["created"] != false {
+		t.Errorf("Expected 200 with created false for an existing database, got %d %v", status, response)
+	}
+	if response["message"] != "Database already exists" {
+		t.Errorf("Expected the message to say the database already exists, got %v", response["message"])
+	}
+}
+
 func TestHandler_DatabasesHandler_EmptyIdx(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	mockDB := NewMockDatabaseManager()
@@ -412,6 +536,47 @@ func TestHandler_DatabasesHandler_DeleteError(t *testing.T) {
 	}
 }
 
+func TestHandler_DatabasesHandler_DeleteAudited(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := NewMockDatabaseManager()
+	handler := NewHandler(logger, mockDB)
+	var auditBuf bytes.Buffer
+	handler.SetAuditLogger(audit.New(&auditBuf))
+
+	for _, idx := range []string{"test1", "error_test"} {
+		req, err := http.NewRequest("DELETE", "/api/databases?idx="+idx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.RemoteAddr = "192.0.2.10:51234"
+		http.HandlerFunc(handler.DatabasesHandler).ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	lines := strings.Split(strings.TrimSpace(auditBuf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 audit entries, got %d: %q", len(lines), auditBuf.String())
+	}
+	var entries []audit.Entry
+	for _, line := range lines {
+		var entry audit.Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("Audit entry should be JSON: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+
+	deleted := entries[0]
+	if deleted.Action != audit.ActionTenantDelete || deleted.Target != "test1" || deleted.Result != audit.ResultSuccess {
+		t.Errorf("Expected a successful tenant_delete of test1, got %+v", deleted)
+	}
+	if deleted.Actor != "192.0.2.10:51234" || deleted.Time.IsZero() {
+		t.Errorf("Expected the entry to record the client and a timestamp, got %+v", deleted)
+	}
+	if failed := entries[1]; failed.Target != "error_test" || failed.Result != audit.ResultFailure || failed.Detail == "" {
+		t.Errorf("Expected a failed tenant_delete of error_test with detail, got %+v", failed)
+	}
+}
+
 func TestHandler_RootHandler(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	mockDB := NewMockDatabaseManager()
@@ -439,6 +604,32 @@ func TestHandler_RootHandler(t *testing.T) {
 	}
 }
 
+func TestHandler_ServiceInfo(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger, NewMockDatabaseManager())
+	handler.SetServiceInfo("Acme Tenant DB", "Acme's staging database")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handler.RootHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/", nil))
+	var root Response
+	if err := json.Unmarshal(rr.Body.Bytes(), &root); err != nil {
+		t.Fatalf("Failed to decode root response: %v", err)
+	}
+	if root.Message != "Welcome to Acme Tenant DB!" {
+		t.Errorf("Expected configured welcome message, got %q", root.Message)
+	}
+
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(handler.InfoHandler).ServeHTTP(rr, httptest.NewRequest("GET", "/api/info", nil))
+	var info map[string]interface{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &info); err != nil {
+		t.Fatalf("Failed to decode info response: %v", err)
+	}
+	if info["service"] != "Acme Tenant DB" || info["description"] != "Acme's staging database" {
+		t.Errorf("Expected configured service and description, got %v / %v", info["service"], info["description"])
+	}
+}
+
 func TestHandler_MethodNotAllowed(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	mockDB := NewMockDatabaseManager()
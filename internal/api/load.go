@@ -0,0 +1,366 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"multitenant-db/internal/audit"
+)
+
+// ErrInvalidLoad is returned by a DatabaseManager when a load names a table or column that does not exist
+var ErrInvalidLoad = errors.New("invalid load target")
+
+// loadBodyError is a load body that could not be read or parsed
+type loadBodyError struct {
+	err error
+}
+
+// Error implements error
+func (e *loadBodyError) Error() string {
+	return "invalid load body: " + e.err.Error()
+}
+
+// Unwrap returns the read or parse error, such as an *http.MaxBytesError
+func (e *loadBodyError) Unwrap() error {
+	return e.err
+}
+
+// DefaultMaxLoadBytes caps the size of a bulk load body unless SetMaxLoadBytes sets another limit
+const DefaultMaxLoadBytes int64 = 256 << 20
+
+// LoadRowError reports a row of a bulk load that was not inserted
+type LoadRowError struct {
+	Row     int    `json:"row"`     // Data row in the request body, starting at 1 and not counting a CSV header
+	Message string `json:"message"` // Why it was rejected
+}
+
+// LoadResponse is the result of a bulk load
+type LoadResponse struct {
+	Idx        string         `json:"idx"`
+	Table      string         `json:"table"`
+	Columns    []string       `json:"columns"`
+	RowsLoaded int64          `json:"rows_loaded"`
+	Errors     []LoadRowError `json:"errors"`
+	Status     string         `json:"status"`
+	Timestamp  time.Time      `json:"timestamp"`
+}
+
+// loadSource streams the rows of a load body. next yields each row that parsed, numbered by its
+// position among the body's data rows, and io.EOF at the end; rows that failed to parse are
+// collected in errors instead.
+type loadSource struct {
+	columns []string
+	next    func() (int, []interface{}, error)
+	errors  []LoadRowError
+}
+
+// LoadDatabaseHandler godoc
+// @Summary Bulk-load rows into a tenant table
+// @Description Streams a CSV (text/csv) or newline-delimited JSON (application/x-ndjson) body of at most 256 MiB into a table in batched transactions. Columns come from the columns parameter, or else from the CSV header row or the keys of the first JSON object. Empty CSV fields load as NULL. Rows that fail are skipped and reported without stopping the load.
+// @Tags databases
+// @Accept plain
+// @Produce json
+// @Param idx path string true "Tenant idx"
+// @Param table query string true "Table to load into"
+// @Param columns query string false "Comma-separated columns, in CSV field order; a CSV body then has no header row"
+// @Success 200 {object} LoadResponse "Rows loaded and row-level errors"
+// @Failure 400 {object} Response "Missing table, unknown table or column, or malformed body"
+// @Failure 404 {object} Response "Database not found"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 413 {object} Response "Body too large"
+// @Failure 415 {object} Response "Unsupported content type"
+// @Failure 500 {object} Response "Internal error"
+// @Router /api/databases/{idx}/load [post]
+func (h *Handler) LoadDatabaseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := strings.Split(strings.Trim(r.URL.Path[len("/api/databases/"):], "/"), "/")[0]
+
+	table := r.URL.Query().Get("table")
+	if table == "" {
+		h.sendErrorResponse(w, r, "table parameter is required", http.StatusBadRequest)
+		return
+	}
+	var columns []string
+	if columnsParam := r.URL.Query().Get("columns"); columnsParam != "" {
+		for _, column := range strings.Split(columnsParam, ",") {
+			if column = strings.TrimSpace(column); column == "" {
+				h.sendErrorResponse(w, r, "columns parameter has an empty column name", http.StatusBadRequest)
+				return
+			}
+			columns = append(columns, column)
+		}
+	}
+
+	loader, ok := h.dbManager.(interface {
+		LoadRows(idx, table string, columns []string, next func() (int, []interface{}, error)) (int64, []LoadRowError, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Bulk loading not supported", http.StatusInternalServerError)
+		return
+	}
+
+	if !h.databaseExists(idx) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Database for idx %s not found", idx), http.StatusNotFound)
+		return
+	}
+
+	// The body is parsed while it loads, so a large load never sits in memory as a whole
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxLoadBytes())
+
+	var source *loadSource
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv", "":
+		source, err = csvLoadSource(r.Body, columns)
+	case "application/x-ndjson", "application/jsonl":
+		source, err = ndjsonLoadSource(r.Body, columns)
+	default:
+		h.sendErrorResponse(w, r, fmt.Sprintf("Unsupported content type %s. Use text/csv or application/x-ndjson.", mediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		h.sendLoadBodyError(w, r, err, 0)
+		return
+	}
+
+	loaded, rowErrors, err := loader.LoadRows(idx, table, source.columns, source.next)
+	h.auditAction(r, audit.ActionTenantLoad, idx, err)
+	if err != nil {
+		if errors.Is(err, ErrInvalidLoad) {
+			h.sendErrorResponse(w, r, fmt.Sprintf("Cannot load into %s: %v", table, err), http.StatusBadRequest)
+			return
+		}
+		var bodyErr *loadBodyError
+		if errors.As(err, &bodyErr) {
+			h.sendLoadBodyError(w, r, err, loaded)
+			return
+		}
+		h.logger.Printf("Error loading rows into %s for idx %s: %v", table, idx, err)
+		h.sendErrorResponse(w, r, "Failed to load rows", http.StatusInternalServerError)
+		return
+	}
+
+	rowErrors = append(source.errors, rowErrors...)
+	sort.SliceStable(rowErrors, func(i, j int) bool { return rowErrors[i].Row < rowErrors[j].Row })
+
+	response := LoadResponse{
+		Idx:        idx,
+		Table:      table,
+		Columns:    source.columns,
+		RowsLoaded: loaded,
+		Errors:     rowErrors,
+		Status:     "ok",
+		Timestamp:  time.Now(),
+	}
+	if response.Errors == nil {
+		response.Errors = []LoadRowError{}
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding load response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Loaded %d rows into %s for idx %s from %s", loaded, table, idx, r.RemoteAddr)
+}
+
+// maxLoadBytes returns the largest load body accepted
+func (h *Handler) maxLoadBytes() int64 {
+	if h.loadLimit > 0 {
+		return h.loadLimit
+	}
+	return DefaultMaxLoadBytes
+}
+
+// sendLoadBodyError reports err, which wraps a loadBodyError, with the rows loaded from the body
+// before it was found
+func (h *Handler) sendLoadBodyError(w http.ResponseWriter, r *http.Request, err error, loaded int64) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Load body exceeds %d bytes; %d rows were loaded before the limit", tooLarge.Limit, loaded), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var bodyErr *loadBodyError
+	errors.As(err, &bodyErr)
+	message := fmt.Sprintf("Invalid load body: %v", bodyErr.err)
+	if loaded > 0 {
+		message += fmt.Sprintf("; %d rows were loaded before it", loaded)
+	}
+	h.sendErrorResponse(w, r, message, http.StatusBadRequest)
+}
+
+// csvLoadSource streams a CSV load body. Without columns the first record is the header naming
+// them. Empty fields are NULL, as in a COPY ... CSV, and a record with the wrong number of fields
+// is a row error.
+func csvLoadSource(body io.Reader, columns []string) (*loadSource, error) {
+	reader := csv.NewReader(body)
+	// Field counts are checked per record, so a short row is a row error rather than the end of the load
+	reader.FieldsPerRecord = -1
+
+	source := &loadSource{columns: columns}
+	if source.columns == nil {
+		header, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil, &loadBodyError{errors.New("CSV body has no header row")}
+		}
+		if err != nil {
+			return nil, &loadBodyError{err}
+		}
+		for _, column := range header {
+			source.columns = append(source.columns, strings.TrimSpace(column))
+		}
+	}
+
+	row := 0
+	source.next = func() (int, []interface{}, error) {
+		for {
+			record, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				return 0, nil, io.EOF
+			}
+			if err != nil {
+				// A quoting error leaves the reader unable to find the next record reliably
+				return 0, nil, &loadBodyError{err}
+			}
+			row++
+			if len(record) != len(source.columns) {
+				source.errors = append(source.errors, LoadRowError{Row: row,
+					Message: fmt.Sprintf("has %d fields, expected %d", len(record), len(source.columns))})
+				continue
+			}
+
+			values := make([]interface{}, len(record))
+			for i, field := range record {
+				if field != "" {
+					values[i] = field
+				}
+			}
+			return row, values, nil
+		}
+	}
+	return source, nil
+}
+
+// ndjsonLoadSource streams a load body holding one JSON object per line. Without columns they are
+// the keys of the first object, in sorted order. A line that isn't an object, or has a key that
+// isn't a column, is a row error; a missing key is NULL.
+func ndjsonLoadSource(body io.Reader, columns []string) (*loadSource, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	source := &loadSource{columns: columns}
+	row := 0
+	// readObject returns the next line that holds a JSON object, recording the others as row errors
+	readObject := func() (int, map[string]interface{}, error) {
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			row++
+
+			var object map[string]interface{}
+			decoder := json.NewDecoder(bytes.NewReader(line))
+			decoder.UseNumber()
+			if err := decoder.Decode(&object); err != nil || object == nil || decoder.More() {
+				source.errors = append(source.errors, LoadRowError{Row: row, Message: "is not a JSON object"})
+				continue
+			}
+			return row, object, nil
+		}
+		if err := scanner.Err(); err != nil {
+			return 0, nil, &loadBodyError{err}
+		}
+		return 0, nil, io.EOF
+	}
+
+	// Naming the columns needs the first object, which is then held back as the first row
+	var pendingRow int
+	var pending map[string]interface{}
+	if source.columns == nil {
+		number, object, err := readObject()
+		if errors.Is(err, io.EOF) {
+			return nil, &loadBodyError{errors.New("NDJSON body has no JSON objects")}
+		}
+		if err != nil {
+			return nil, err
+		}
+		for key := range object {
+			source.columns = append(source.columns, key)
+		}
+		sort.Strings(source.columns)
+		pendingRow, pending = number, object
+	}
+
+	source.next = func() (int, []interface{}, error) {
+		for {
+			number, object := pendingRow, pending
+			if object != nil {
+				pending = nil
+			} else {
+				var err error
+				if number, object, err = readObject(); err != nil {
+					return 0, nil, err
+				}
+			}
+
+			values, err := loadValues(object, source.columns)
+			if err != nil {
+				source.errors = append(source.errors, LoadRowError{Row: number, Message: err.Error()})
+				continue
+			}
+			return number, values, nil
+		}
+	}
+	return source, nil
+}
+
+// loadValues orders the values of a decoded JSON object by columns. Numbers load as integers when
+// they are whole and as floats otherwise; nested arrays and objects load as their JSON text.
+func loadValues(object map[string]interface{}, columns []string) ([]interface{}, error) {
+	positions := make(map[string]int, len(columns))
+	for i, column := range columns {
+		positions[column] = i
+	}
+
+	values := make([]interface{}, len(columns))
+	for key, value := range object {
+		i, ok := positions[key]
+		if !ok {
+			return nil, fmt.Errorf("has key %q, which is not a loaded column", key)
+		}
+		switch v := value.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				values[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				values[i] = f
+			} else {
+				values[i] = v.String()
+			}
+		case map[string]interface{}, []interface{}:
+			text, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("has an unencodable value for %q: %v", key, err)
+			}
+			values[i] = string(text)
+		default:
+			values[i] = v
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,269 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// QueryRequest is the body accepted by POST /api/query
+type QueryRequest struct {
+	Idx   string        `json:"idx"`
+	Query string        `json:"query"`
+	Args  []interface{} `json:"args,omitempty"`
+}
+
+// QueryDebug describes how a query was executed, returned when debugging is requested
+type QueryDebug struct {
+	SQL string `json:"sql"`
+	Idx string `json:"idx"`
+}
+
+// QueryResponse represents the response for query execution
+type QueryResponse struct {
+	Idx          string          `json:"idx"`
+	Columns      []string        `json:"columns,omitempty"`
+	Rows         [][]interface{} `json:"rows,omitempty"`
+	RowCount     int             `json:"row_count"`
+	RowsAffected int64           `json:"rows_affected"`
+	LastInsertID int64           `json:"last_insert_id,omitempty"`
+	Debug        *QueryDebug     `json:"debug,omitempty"`
+	Status       string          `json:"status"`
+	Timestamp    time.Time       `json:"timestamp"`
+}
+
+// QueryHandler godoc
+// @Summary Execute a parameterized query
+// @Description Runs a query against a tenant database, binding args positionally to ? placeholders
+// @Tags query
+// @Accept json
+// @Produce json
+// @Param request body QueryRequest true "Tenant idx, query and positional args"
+// @Param debug query bool false "Include the executed SQL and resolved tenant (requires API debugging to be enabled)"
+// @Success 200 {object} QueryResponse
+// @Failure 400 {object} Response "Invalid request, arg count mismatch or invalid SQL"
+// @Failure 403 {object} Response "Destructive statement blocked"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Query execution failed"
+// @Router /api/query [post]
+func (h *Handler) QueryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Decode numbers as json.Number so integer args bind as integers rather than floats
+	var req QueryRequest
+	if err := decodeJSONBody(r, &req, true); err != nil {
+		h.sendRequestError(w, r, err)
+		return
+	}
+
+	// An empty idx runs against the default database
+	if req.Idx != "" {
+		if err := validateIdx("idx", req.Idx); err != nil {
+			h.sendRequestError(w, r, err)
+			return
+		}
+	}
+	if strings.TrimSpace(req.Query) == "" {
+		h.sendRequestError(w, r, &FieldError{Field: "query", Message: "is required"})
+		return
+	}
+	if len(req.Args) > MaxQueryArgs {
+		h.sendRequestError(w, r, &FieldError{Field: "args", Message: fmt.Sprintf("must have at most %d items", MaxQueryArgs)})
+		return
+	}
+
+	if placeholders := countPlaceholders(req.Query); placeholders != len(req.Args) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Query has %d placeholders but %d args were provided", placeholders, len(req.Args)), http.StatusBadRequest)
+		return
+	}
+
+	args, err := normalizeQueryArgs(req.Args)
+	if err != nil {
+		h.sendErrorResponse(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The executor fills in the result and the debug details; the handler owns the rest
+	executor, ok := h.dbManager.(interface {
+		ExecuteQuery(idx string, query string, args []interface{}) (*QueryResponse, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query execution not supported", http.StatusInternalServerError)
+		return
+	}
+
+	result, err := executor.ExecuteQuery(req.Idx, req.Query, args)
+	if errors.Is(err, ErrDestructiveStatement) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Query rejected: %v", err), http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, ErrInvalidQuery) {
+		h.sendErrorResponse(w, r, fmt.Sprintf("Query failed: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Printf("Error executing query for idx %s: %v", req.Idx, err)
+		h.sendErrorResponse(w, r, fmt.Sprintf("Query failed: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	result.Idx = req.Idx
+	result.RowCount = len(result.Rows)
+	result.Status = "ok"
+	result.Timestamp = time.Now()
+	if !h.debugRequested(r) {
+		result.Debug = nil
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, result); err != nil {
+		h.logger.Printf("Error encoding query response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Query executed for idx %s from %s", req.Idx, r.RemoteAddr)
+}
+
+// streamFlushRows is how many NDJSON rows QueryStreamHandler writes between flushes
+const streamFlushRows = 100
+
+// QueryStreamHandler godoc
+// @Summary Stream a SELECT as NDJSON
+// @Description Runs a read-only SELECT against a tenant database and streams each row as a JSON object on its own line, flushing as rows are scanned so large results are never buffered. An error after rows have been sent ends the stream with an {"error": ...} line.
+// @Tags query
+// @Produce application/x-ndjson
+// @Param idx query string false "Tenant idx (defaults to the default database)"
+// @Param q query string true "SELECT statement"
+// @Success 200 {string} string "One JSON object per row"
+// @Failure 400 {object} Response "Missing or non-SELECT query"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Query execution failed"
+// @Router /api/query-stream [get]
+func (h *Handler) QueryStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	idx := r.URL.Query().Get("idx")
+	query := r.URL.Query().Get("q")
+	if strings.TrimSpace(query) == "" {
+		h.sendErrorResponse(w, r, "q is required", http.StatusBadRequest)
+		return
+	}
+	if fields := strings.Fields(strings.ToLower(query)); strings.TrimLeft(fields[0], "(") != "select" {
+		h.sendErrorResponse(w, r, "Only SELECT statements can be streamed", http.StatusBadRequest)
+		return
+	}
+
+	streamer, ok := h.dbManager.(interface {
+		StreamQuery(idx string, query string, fn func(columns []string, values []interface{}) error) error
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	rowCount := 0
+	start := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		started = true
+	}
+
+	err := streamer.StreamQuery(idx, query, func(columns []string, values []interface{}) error {
+		if !started {
+			start()
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		if err := encoder.Encode(row); err != nil {
+			return fmt.Errorf("client went away: %v", err)
+		}
+		rowCount++
+		if flusher != nil && rowCount%streamFlushRows == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.Printf("Error streaming query for idx %s: %v", idx, err)
+		if !started {
+			h.sendErrorResponse(w, r, fmt.Sprintf("Query failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		// Headers are gone, so the failure is reported in-band
+		encoder.Encode(map[string]string{"error": err.Error()})
+	}
+	if !started {
+		start()
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	h.logger.Printf("Streamed %d rows for idx %s to %s", rowCount, idx, r.RemoteAddr)
+}
+
+// countPlaceholders counts ? placeholders in query, ignoring any inside quoted strings, identifiers
+// or the -- and /* */ comments SQLite recognises
+func countPlaceholders(query string) int {
+	runes := []rune(query)
+	count := 0
+	var quote rune
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/') {
+				i++
+			}
+			i++
+		case c == '?':
+			count++
+		}
+	}
+	return count
+}
+
+// normalizeQueryArgs converts decoded JSON args into values the database driver can bind
+func normalizeQueryArgs(args []interface{}) ([]interface{}, error) {
+	normalized := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch v := arg.(type) {
+		case json.Number:
+			if n, err := v.Int64(); err == nil {
+				normalized[i] = n
+			} else if f, err := v.Float64(); err == nil {
+				normalized[i] = f
+			} else {
+				return nil, fmt.Errorf("invalid numeric arg at position %d: %s", i+1, v)
+			}
+		case nil, string, bool:
+			normalized[i] = v
+		default:
+			return nil, fmt.Errorf("unsupported arg type at position %d: only strings, numbers, booleans and null can be bound", i+1)
+		}
+	}
+	return normalized, nil
+}
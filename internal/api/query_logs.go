@@ -1,12 +1,14 @@
 package api
 
 import (
-	"encoding/json"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"multitenant-db/internal/audit"
 )
 
 // QueryLogEntry represents a query log entry for API responses
@@ -19,6 +21,7 @@ type QueryLogEntry struct {
 	Success      bool      `json:"success"`
 	ErrorMsg     string    `json:"error_message,omitempty"`
 	ConnectionID string    `json:"connection_id"`
+	Explain      string    `json:"explain,omitempty"` // Query plan, captured for slow queries when enabled
 }
 
 // QueryLogResponse represents the response for query log requests
@@ -31,6 +34,24 @@ type QueryLogResponse struct {
 	Timestamp time.Time       `json:"timestamp"`
 }
 
+// QueryLogErrorsResponse represents the response for failed query log requests
+type QueryLogErrorsResponse struct {
+	Logs      []QueryLogEntry `json:"logs"`
+	Total     int             `json:"total"`
+	Limit     int             `json:"limit"`
+	Status    string          `json:"status"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+// QueryLogSlowestResponse represents the response for slowest query log requests
+type QueryLogSlowestResponse struct {
+	Logs      []QueryLogEntry `json:"logs"`
+	Total     int             `json:"total"`
+	Limit     int             `json:"limit"`
+	Status    string          `json:"status"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
 // QueryLogStatsResponse represents the response for query log statistics
 type QueryLogStatsResponse struct {
 	Stats     map[string]interface{} `json:"stats"`
@@ -38,6 +59,66 @@ type QueryLogStatsResponse struct {
 	Timestamp time.Time              `json:"timestamp"`
 }
 
+// QueryLogSizesResponse represents the response for per-tenant query log sizes
+type QueryLogSizesResponse struct {
+	Sizes     []map[string]interface{} `json:"sizes"`
+	Status    string                   `json:"status"`
+	Timestamp time.Time                `json:"timestamp"`
+}
+
+// QueryLogPurgeResponse represents the response for purging a tenant's failed queries
+type QueryLogPurgeResponse struct {
+	Message   string    `json:"message"`
+	TenantID  string    `json:"tenant_id"`
+	Removed   int64     `json:"removed"`
+	Status    string    `json:"status"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// QueryLogReplayRequest is the body accepted by POST /api/query-logs/{tenant_id}/replay
+type QueryLogReplayRequest struct {
+	TargetIdx   string `json:"target_idx"`
+	DryRun      bool   `json:"dry_run,omitempty"`      // Roll the replay back once every statement has run
+	OnlySuccess bool   `json:"only_success,omitempty"` // Leave out statements that failed when logged
+}
+
+// ReplayResult is the outcome of replaying one logged statement
+type ReplayResult struct {
+	Skipped      string // Why the statement was not replayed, empty if it was
+	RowsAffected int64
+	Err          error // Why the statement failed, nil if it succeeded or was skipped
+}
+
+// Outcomes of a replayed query log entry
+const (
+	ReplayStatusOK      = "ok"
+	ReplayStatusFailed  = "failed"
+	ReplayStatusSkipped = "skipped"
+)
+
+// QueryLogReplayEntry reports what replaying one query log entry did
+type QueryLogReplayEntry struct {
+	LogID        int64  `json:"log_id"`
+	Query        string `json:"query"`
+	Status       string `json:"status"` // ok, failed or skipped
+	RowsAffected int64  `json:"rows_affected"`
+	Error        string `json:"error,omitempty"`
+	Reason       string `json:"reason,omitempty"` // Why a skipped entry was not replayed
+}
+
+// QueryLogReplayResponse represents the response for replaying a tenant's query log
+type QueryLogReplayResponse struct {
+	TenantID  string                `json:"tenant_id"`
+	TargetIdx string                `json:"target_idx"`
+	DryRun    bool                  `json:"dry_run"`
+	Replayed  int                   `json:"replayed"`
+	Failed    int                   `json:"failed"`
+	Skipped   int                   `json:"skipped"`
+	Results   []QueryLogReplayEntry `json:"results"`
+	Status    string                `json:"status"`
+	Timestamp time.Time             `json:"timestamp"`
+}
+
 // TenantsResponse represents the response for listing tenants with logs
 type TenantsResponse struct {
 	Tenants   []string  `json:"tenants"`
@@ -62,6 +143,8 @@ type QueryLogger interface {
 // @Param page_size query int false "Page size (default: 50, max: 1000)"
 // @Param start_time query string false "Start time filter (RFC3339 format)"
 // @Param end_time query string false "End time filter (RFC3339 format)"
+// @Param success query bool false "Only return successful (true) or failed (false) queries"
+// @Param connection_id query string false "Only return queries from this connection; cannot be combined with the time and success filters"
 // @Success 200 {object} QueryLogResponse
 // @Failure 400 {object} Response
 // @Failure 500 {object} Response
@@ -72,7 +155,7 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(path, "/")
 	
 	if len(parts) == 0 || parts[0] == "" {
-		h.sendErrorResponse(w, "Tenant ID is required", http.StatusBadRequest)
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
 		return
 	}
 	
@@ -99,7 +182,7 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 		if st, err := time.Parse(time.RFC3339, startTimeStr); err == nil {
 			startTime = &st
 		} else {
-			h.sendErrorResponse(w, "Invalid start_time format. Use RFC3339 format.", http.StatusBadRequest)
+			h.sendErrorResponse(w, r, "Invalid start_time format. Use RFC3339 format.", http.StatusBadRequest)
 			return
 		}
 	}
@@ -108,15 +191,33 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 		if et, err := time.Parse(time.RFC3339, endTimeStr); err == nil {
 			endTime = &et
 		} else {
-			h.sendErrorResponse(w, "Invalid end_time format. Use RFC3339 format.", http.StatusBadRequest)
+			h.sendErrorResponse(w, r, "Invalid end_time format. Use RFC3339 format.", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Parse success filter
+	var success *bool
+	if successStr := r.URL.Query().Get("success"); successStr != "" {
+		sv, err := strconv.ParseBool(successStr)
+		if err != nil {
+			h.sendErrorResponse(w, r, "Invalid success value. Use true or false.", http.StatusBadRequest)
 			return
 		}
+		success = &sv
+	}
+
+	// Connection filter, for tracing a single session
+	connectionID := r.URL.Query().Get("connection_id")
+	if connectionID != "" && (startTime != nil || endTime != nil || success != nil) {
+		h.sendErrorResponse(w, r, "connection_id cannot be combined with start_time, end_time or success", http.StatusBadRequest)
+		return
 	}
 
 	// Get query logger interface
 	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not supported", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
 		return
 	}
 	
@@ -124,7 +225,7 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 		GetQueryLogs(tenantID string, limit int, offset int, startTime, endTime *time.Time) ([]interface{}, error)
 	})
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not available", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
 		return
 	}
 
@@ -132,33 +233,37 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * pageSize
 
 	// Get logs
-	logs, err := queryLogger.GetQueryLogs(tenantID, pageSize, offset, startTime, endTime)
+	var logs []interface{}
+	var err error
+	if connectionID != "" {
+		connectionLogger, ok := queryLogger.(interface {
+			GetLogsByConnection(tenantID string, connectionID string, limit int, offset int) ([]interface{}, error)
+		})
+		if !ok {
+			h.sendErrorResponse(w, r, "Query log filtering not available", http.StatusInternalServerError)
+			return
+		}
+		logs, err = connectionLogger.GetLogsByConnection(tenantID, connectionID, pageSize, offset)
+	} else if success != nil {
+		filteredLogger, ok := queryLogger.(interface {
+			GetQueryLogsFiltered(tenantID string, limit int, offset int, startTime, endTime *time.Time, success *bool) ([]interface{}, error)
+		})
+		if !ok {
+			h.sendErrorResponse(w, r, "Query log filtering not available", http.StatusInternalServerError)
+			return
+		}
+		logs, err = filteredLogger.GetQueryLogsFiltered(tenantID, pageSize, offset, startTime, endTime, success)
+	} else {
+		logs, err = queryLogger.GetQueryLogs(tenantID, pageSize, offset, startTime, endTime)
+	}
 	if err != nil {
 		h.logger.Printf("Error getting query logs for tenant %s: %v", tenantID, err)
-		h.sendErrorResponse(w, "Failed to retrieve query logs", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Failed to retrieve query logs", http.StatusInternalServerError)
 		return
 	}
 
 	// Convert to API format
-	apiLogs := make([]QueryLogEntry, len(logs))
-	for i, logInterface := range logs {
-		// Use reflection to convert the struct
-		logValue := reflect.ValueOf(logInterface)
-		if logValue.Kind() == reflect.Struct {
-			apiLogs[i] = QueryLogEntry{
-				ID:           logValue.FieldByName("ID").Int(),
-				TenantID:     logValue.FieldByName("TenantID").String(),
-				Query:        logValue.FieldByName("Query").String(),
-				ExecutedAt:   logValue.FieldByName("ExecutedAt").Interface().(time.Time),
-				Duration:     logValue.FieldByName("Duration").Int(),
-				Success:      logValue.FieldByName("Success").Bool(),
-				ErrorMsg:     logValue.FieldByName("ErrorMsg").String(),
-				ConnectionID: logValue.FieldByName("ConnectionID").String(),
-			}
-		} else {
-			h.logger.Printf("Warning: unexpected log entry type at index %d", i)
-		}
-	}
+	apiLogs := h.toQueryLogEntries(logs)
 
 	response := QueryLogResponse{
 		Logs:      apiLogs,
@@ -169,18 +274,359 @@ func (h *Handler) GetQueryLogsHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 		h.logger.Printf("Error encoding query logs response: %v", err)
-		h.sendErrorResponse(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	h.logger.Printf("Query logs retrieved for tenant %s (page %d, size %d)", tenantID, page, pageSize)
 }
 
+// GetQueryLogErrorsHandler godoc
+// @Summary Get failed queries for a tenant
+// @Description Retrieve the most recent failed queries for a specific tenant, including their error messages
+// @Tags query-logs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param limit query int false "Maximum number of entries (default: 50, max: 1000)"
+// @Success 200 {object} QueryLogErrorsResponse
+// @Failure 400 {object} Response
+// @Failure 500 {object} Response
+// @Router /api/query-logs/{tenant_id}/errors [get]
+func (h *Handler) GetQueryLogErrorsHandler(w http.ResponseWriter, r *http.Request) {
+	// Get tenant ID from URL path
+	path := r.URL.Path[len("/api/query-logs/"):]
+	parts := strings.Split(path, "/")
+	
+	if len(parts) < 2 || parts[0] == "" {
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
+		return
+	}
+	
+	tenantID := parts[0]
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > 1000 {
+			h.sendErrorResponse(w, r, "Invalid limit. Use a number between 1 and 1000.", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	// Get query logger interface
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	queryLogger, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetFailedQueries(tenantID string, limit int) ([]interface{}, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	logs, err := queryLogger.GetFailedQueries(tenantID, limit)
+	if err != nil {
+		h.logger.Printf("Error getting failed queries for tenant %s: %v", tenantID, err)
+		h.sendErrorResponse(w, r, "Failed to retrieve failed queries", http.StatusInternalServerError)
+		return
+	}
+
+	apiLogs := h.toQueryLogEntries(logs)
+	response := QueryLogErrorsResponse{
+		Logs:      apiLogs,
+		Total:     len(apiLogs),
+		Limit:     limit,
+		Status:    "ok",
+		Timestamp: time.Now(),
+	}
+
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding failed queries response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Failed queries retrieved for tenant %s (limit %d)", tenantID, limit)
+}
+
+// GetSlowestQueriesHandler godoc
+// @Summary Get the slowest queries for a tenant
+// @Description Retrieve a tenant's slowest logged queries, longest first. Queries that ran past the slow query threshold while SLOW_QUERY_EXPLAIN was enabled carry their EXPLAIN QUERY PLAN.
+// @Tags query-logs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Param limit query int false "Maximum number of entries (default: 50, max: 1000)"
+// @Success 200 {object} QueryLogSlowestResponse
+// @Failure 400 {object} Response
+// @Failure 500 {object} Response
+// @Router /api/query-logs/{tenant_id}/slowest [get]
+func (h *Handler) GetSlowestQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get tenant ID from URL path
+	path := r.URL.Path[len("/api/query-logs/"):]
+	parts := strings.Split(path, "/")
+	
+	if len(parts) < 2 || parts[0] == "" {
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
+		return
+	}
+	
+	tenantID := parts[0]
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 || l > 1000 {
+			h.sendErrorResponse(w, r, "Invalid limit. Use a number between 1 and 1000.", http.StatusBadRequest)
+			return
+		}
+		limit = l
+	}
+
+	// Get query logger interface
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	queryLogger, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetSlowestQueries(tenantID string, limit int) ([]interface{}, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	logs, err := queryLogger.GetSlowestQueries(tenantID, limit)
+	if err != nil {
+		h.logger.Printf("Error getting slowest queries for tenant %s: %v", tenantID, err)
+		h.sendErrorResponse(w, r, "Failed to retrieve slowest queries", http.StatusInternalServerError)
+		return
+	}
+
+	apiLogs := h.toQueryLogEntries(logs)
+	response := QueryLogSlowestResponse{
+		Logs:      apiLogs,
+		Total:     len(apiLogs),
+		Limit:     limit,
+		Status:    "ok",
+		Timestamp: time.Now(),
+	}
+
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding slowest queries response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Slowest queries retrieved for tenant %s (limit %d)", tenantID, limit)
+}
+
+// PurgeFailedQueriesHandler godoc
+// @Summary Purge failed queries for a tenant
+// @Description Deletes only the tenant's failed query log entries, keeping successful history intact
+// @Tags query-logs
+// @Produce json
+// @Param tenant_id path string true "Tenant ID"
+// @Success 200 {object} QueryLogPurgeResponse
+// @Failure 400 {object} Response
+// @Failure 405 {object} Response
+// @Failure 500 {object} Response
+// @Router /api/query-logs/{tenant_id}/purge-failed [post]
+func (h *Handler) PurgeFailedQueriesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get tenant ID from URL path
+	path := r.URL.Path[len("/api/query-logs/"):]
+	parts := strings.Split(path, "/")
+	
+	if len(parts) < 2 || parts[0] == "" {
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
+		return
+	}
+	
+	tenantID := parts[0]
+
+	// Get query logger interface
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	queryLogger, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		PurgeFailedQueries(tenantID string) (int64, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	removed, err := queryLogger.PurgeFailedQueries(tenantID)
+	h.auditAction(r, audit.ActionQueryLogPurge, tenantID, err)
+	if err != nil {
+		h.logger.Printf("Error purging failed queries for tenant %s: %v", tenantID, err)
+		h.sendErrorResponse(w, r, "Failed to purge failed queries", http.StatusInternalServerError)
+		return
+	}
+
+	response := QueryLogPurgeResponse{
+		Message:   "Failed queries purged successfully",
+		TenantID:  tenantID,
+		Removed:   removed,
+		Status:    "ok",
+		Timestamp: time.Now(),
+	}
+
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding purge failed queries response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Purged %d failed queries for tenant %s from %s", removed, tenantID, r.RemoteAddr)
+}
+
+// ReplayQueryLogHandler godoc
+// @Summary Replay a tenant's query log into another tenant
+// @Description Re-runs the statements in a tenant's query log, oldest first, against target_idx, creating it if needed. Only statements that change data or schema are replayed; reads, session statements and prepared statements are reported as skipped. The statements run in one transaction. A dry run runs them against a scratch copy of the target, so every statement is validated without creating or changing it.
+// @Tags query-logs
+// @Accept json
+// @Produce json
+// @Param tenant_id path string true "Tenant ID whose log is replayed"
+// @Param request body QueryLogReplayRequest true "Target tenant and replay options"
+// @Success 200 {object} QueryLogReplayResponse
+// @Failure 400 {object} Response
+// @Failure 405 {object} Response
+// @Failure 500 {object} Response
+// @Router /api/query-logs/{tenant_id}/replay [post]
+func (h *Handler) ReplayQueryLogHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Get tenant ID from URL path
+	path := r.URL.Path[len("/api/query-logs/"):]
+	parts := strings.Split(path, "/")
+
+	if len(parts) < 2 || parts[0] == "" {
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
+		return
+	}
+
+	tenantID := parts[0]
+
+	var req QueryLogReplayRequest
+	if err := decodeJSONBody(r, &req, false); err != nil {
+		h.sendRequestError(w, r, err)
+		return
+	}
+	if err := validateIdx("target_idx", req.TargetIdx); err != nil {
+		h.sendRequestError(w, r, err)
+		return
+	}
+	if req.TargetIdx == tenantID {
+		h.sendRequestError(w, r, &FieldError{Field: "target_idx", Message: "must differ from the tenant whose log is replayed"})
+		return
+	}
+
+	// Get query logger interface
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+
+	queryLogger, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetQueryLogsFiltered(tenantID string, limit int, offset int, startTime, endTime *time.Time, success *bool) ([]interface{}, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	replayer, ok := h.dbManager.(interface {
+		ReplayQueries(idx string, queries []string, dryRun bool) ([]ReplayResult, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query log replay not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var success *bool
+	if req.OnlySuccess {
+		success = &req.OnlySuccess
+	}
+	logs, err := queryLogger.GetQueryLogsFiltered(tenantID, 0, 0, nil, nil, success)
+	if err != nil {
+		h.logger.Printf("Error retrieving query logs for tenant %s: %v", tenantID, err)
+		h.sendErrorResponse(w, r, "Failed to retrieve query logs", http.StatusInternalServerError)
+		return
+	}
+
+	// Logs come newest first; replay them in the order they ran
+	entries := h.toQueryLogEntries(logs)
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].ExecutedAt.Equal(entries[j].ExecutedAt) {
+			return entries[i].ExecutedAt.Before(entries[j].ExecutedAt)
+		}
+		return entries[i].ID < entries[j].ID
+	})
+	queries := make([]string, len(entries))
+	for i, entry := range entries {
+		queries[i] = entry.Query
+	}
+
+	results, err := replayer.ReplayQueries(req.TargetIdx, queries, req.DryRun)
+	if !req.DryRun {
+		h.auditAction(r, audit.ActionQueryLogReplay, req.TargetIdx, err)
+	}
+	if err != nil {
+		h.logger.Printf("Error replaying query log of tenant %s into %s: %v", tenantID, req.TargetIdx, err)
+		h.sendErrorResponse(w, r, "Failed to replay query log", http.StatusInternalServerError)
+		return
+	}
+
+	response := QueryLogReplayResponse{
+		TenantID:  tenantID,
+		TargetIdx: req.TargetIdx,
+		DryRun:    req.DryRun,
+		Results:   make([]QueryLogReplayEntry, len(entries)),
+		Status:    "ok",
+		Timestamp: time.Now(),
+	}
+	for i, entry := range entries {
+		result := QueryLogReplayEntry{LogID: entry.ID, Query: entry.Query, Status: ReplayStatusOK}
+		switch {
+		case results[i].Skipped != "":
+			result.Status, result.Reason = ReplayStatusSkipped, results[i].Skipped
+			response.Skipped++
+		case results[i].Err != nil:
+			result.Status, result.Error = ReplayStatusFailed, results[i].Err.Error()
+			response.Failed++
+		default:
+			result.RowsAffected = results[i].RowsAffected
+			response.Replayed++
+		}
+		response.Results[i] = result
+	}
+
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding query log replay response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Replayed query log of tenant %s into %s (dry run %t): %d replayed, %d failed, %d skipped, from %s",
+		tenantID, req.TargetIdx, req.DryRun, response.Replayed, response.Failed, response.Skipped, r.RemoteAddr)
+}
+
 // GetQueryLogStatsHandler godoc
 // @Summary Get query log statistics for a tenant
 // @Description Retrieve query execution statistics for a specific tenant
@@ -197,7 +643,7 @@ func (h *Handler) GetQueryLogStatsHandler(w http.ResponseWriter, r *http.Request
 	parts := strings.Split(path, "/")
 	
 	if len(parts) < 2 || parts[0] == "" {
-		h.sendErrorResponse(w, "Tenant ID is required", http.StatusBadRequest)
+		h.sendErrorResponse(w, r, "Tenant ID is required", http.StatusBadRequest)
 		return
 	}
 	
@@ -206,7 +652,7 @@ func (h *Handler) GetQueryLogStatsHandler(w http.ResponseWriter, r *http.Request
 	// Get query logger interface
 	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not supported", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
 		return
 	}
 	
@@ -214,7 +660,7 @@ func (h *Handler) GetQueryLogStatsHandler(w http.ResponseWriter, r *http.Request
 		GetQueryLogStats(tenantID string) (map[string]interface{}, error)
 	})
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not available", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
 		return
 	}
 
@@ -222,7 +668,7 @@ func (h *Handler) GetQueryLogStatsHandler(w http.ResponseWriter, r *http.Request
 	stats, err := queryLogger.GetQueryLogStats(tenantID)
 	if err != nil {
 		h.logger.Printf("Error getting query stats for tenant %s: %v", tenantID, err)
-		h.sendErrorResponse(w, "Failed to retrieve query statistics", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Failed to retrieve query statistics", http.StatusInternalServerError)
 		return
 	}
 
@@ -232,18 +678,59 @@ func (h *Handler) GetQueryLogStatsHandler(w http.ResponseWriter, r *http.Request
 		Timestamp: time.Now(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 		h.logger.Printf("Error encoding query stats response: %v", err)
-		h.sendErrorResponse(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	h.logger.Printf("Query stats retrieved for tenant %s", tenantID)
 }
 
+// GetQueryLogSizesHandler godoc
+// @Summary List query log sizes per tenant
+// @Description Returns each tenant's query log row count and approximate size in bytes, largest first
+// @Tags query-logs
+// @Produce json
+// @Success 200 {object} QueryLogSizesResponse
+// @Failure 500 {object} Response
+// @Router /api/query-log-sizes [get]
+func (h *Handler) GetQueryLogSizesHandler(w http.ResponseWriter, r *http.Request) {
+	// Get query logger interface
+	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
+		return
+	}
+	
+	queryLogger, ok := queryLoggerProvider.GetQueryLogger().(interface {
+		GetLogSizes() ([]map[string]interface{}, error)
+	})
+	if !ok {
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
+		return
+	}
+
+	sizes, err := queryLogger.GetLogSizes()
+	if err != nil {
+		h.logger.Printf("Error getting query log sizes: %v", err)
+		h.sendErrorResponse(w, r, "Failed to retrieve query log sizes", http.StatusInternalServerError)
+		return
+	}
+
+	response := QueryLogSizesResponse{
+		Sizes:     sizes,
+		Status:    "ok",
+		Timestamp: time.Now(),
+	}
+
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding query log sizes response: %v", err)
+		return
+	}
+
+	h.logger.Printf("Query log sizes retrieved")
+}
+
 // ListQueryLogTenantsHandler godoc
 // @Summary List tenants with query logs
 // @Description Get a list of all tenants that have query logs
@@ -256,7 +743,7 @@ func (h *Handler) ListQueryLogTenantsHandler(w http.ResponseWriter, r *http.Requ
 	// Get query logger interface
 	queryLoggerProvider, ok := h.dbManager.(interface{ GetQueryLogger() interface{} })
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not supported", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not supported", http.StatusInternalServerError)
 		return
 	}
 	
@@ -264,7 +751,7 @@ func (h *Handler) ListQueryLogTenantsHandler(w http.ResponseWriter, r *http.Requ
 		ListTenantLogs() []string
 	})
 	if !ok {
-		h.sendErrorResponse(w, "Query logging not available", http.StatusInternalServerError)
+		h.sendErrorResponse(w, r, "Query logging not available", http.StatusInternalServerError)
 		return
 	}
 
@@ -277,30 +764,48 @@ func (h *Handler) ListQueryLogTenantsHandler(w http.ResponseWriter, r *http.Requ
 		Timestamp: time.Now(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
 		h.logger.Printf("Error encoding tenants response: %v", err)
-		h.sendErrorResponse(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
 
 	h.logger.Printf("Query log tenants list retrieved")
 }
 
+// toQueryLogEntries converts query logger entries into the API format
+func (h *Handler) toQueryLogEntries(logs []interface{}) []QueryLogEntry {
+	apiLogs := make([]QueryLogEntry, len(logs))
+	for i, logInterface := range logs {
+		// Use reflection to convert the struct
+		logValue := reflect.ValueOf(logInterface)
+		if logValue.Kind() == reflect.Struct {
+			apiLogs[i] = QueryLogEntry{
+				ID:           logValue.FieldByName("ID").Int(),
+				TenantID:     logValue.FieldByName("TenantID").String(),
+				Query:        logValue.FieldByName("Query").String(),
+				ExecutedAt:   logValue.FieldByName("ExecutedAt").Interface().(time.Time),
+				Duration:     logValue.FieldByName("Duration").Int(),
+				Success:      logValue.FieldByName("Success").Bool(),
+				ErrorMsg:     logValue.FieldByName("ErrorMsg").String(),
+				ConnectionID: logValue.FieldByName("ConnectionID").String(),
+				Explain:      logValue.FieldByName("Explain").String(),
+			}
+		} else {
+			h.logger.Printf("Warning: unexpected log entry type at index %d", i)
+		}
+	}
+	return apiLogs
+}
+
 // sendErrorResponse is a helper method to send error responses
-func (h *Handler) sendErrorResponse(w http.ResponseWriter, message string, statusCode int) {
+func (h *Handler) sendErrorResponse(w http.ResponseWriter, r *http.Request, message string, statusCode int) {
 	response := Response{
 		Message:   message,
 		Status:    "error",
 		Timestamp: time.Now(),
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
-
-	if err := json.NewEncoder(w).Encode(response); err != nil {
+	if err := h.writeJSON(w, r, statusCode, response); err != nil {
 		h.logger.Printf("Error encoding error response: %v", err)
 	}
 }
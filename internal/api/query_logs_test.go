@@ -0,0 +1,352 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mockLogEntry mirrors the fields the API reads from query logger entries
+type mockLogEntry struct {
+	ID           int64
+	TenantID     string
+	Query        string
+	ExecutedAt   time.Time
+	Duration     int64
+	Success      bool
+	ErrorMsg     string
+	ConnectionID string
+	Explain      string
+}
+
+// mockQueryLogger is an in-memory query logger for API tests
+type mockQueryLogger struct {
+	entries []mockLogEntry
+}
+
+func (m *mockQueryLogger) GetFailedQueries(tenantID string, limit int) ([]interface{}, error) {
+	var failed []mockLogEntry
+	for _, entry := range m.entries {
+		if entry.TenantID == tenantID && !entry.Success {
+			failed = append(failed, entry)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ExecutedAt.After(failed[j].ExecutedAt) })
+
+	var logs []interface{}
+	for i, entry := range failed {
+		if i >= limit {
+			break
+		}
+		logs = append(logs, entry)
+	}
+	return logs, nil
+}
+
+func (m *mockQueryLogger) GetQueryLogs(tenantID string, limit int, offset int, startTime, endTime *time.Time) ([]interface{}, error) {
+	return m.matching(tenantID, limit, offset, func(mockLogEntry) bool { return true }), nil
+}
+
+func (m *mockQueryLogger) GetLogsByConnection(tenantID string, connectionID string, limit int, offset int) ([]interface{}, error) {
+	return m.matching(tenantID, limit, offset, func(entry mockLogEntry) bool { return entry.ConnectionID == connectionID }), nil
+}
+
+// matching returns a page of the tenant's entries accepted by keep, newest first
+func (m *mockQueryLogger) matching(tenantID string, limit int, offset int, keep func(mockLogEntry) bool) []interface{} {
+	var matched []mockLogEntry
+	for _, entry := range m.entries {
+		if entry.TenantID == tenantID && keep(entry) {
+			matched = append(matched, entry)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].ExecutedAt.After(matched[j].ExecutedAt) })
+
+	logs := []interface{}{}
+	for i := offset; i < len(matched) && i < offset+limit; i++ {
+		logs = append(logs, matched[i])
+	}
+	return logs
+}
+
+func (m *mockQueryLogger) PurgeFailedQueries(tenantID string) (int64, error) {
+	var kept []mockLogEntry
+	var removed int64
+	for _, entry := range m.entries {
+		if entry.TenantID == tenantID && !entry.Success {
+			removed++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	m.entries = kept
+	return removed, nil
+}
+
+func (m *mockQueryLogger) GetLogSizes() ([]map[string]interface{}, error) {
+	return []map[string]interface{}{
+		{"tenant_id": "tenant1", "row_count": 3, "size_bytes": 8192},
+		{"tenant_id": "tenant2", "row_count": 1, "size_bytes": 4096},
+	}, nil
+}
+
+// queryLoggingMockDatabaseManager exposes a query logger alongside the mock manager
+type queryLoggingMockDatabaseManager struct {
+	*MockDatabaseManager
+	queryLogger *mockQueryLogger
+}
+
+func (m *queryLoggingMockDatabaseManager) GetQueryLogger() interface{} {
+	return m.queryLogger
+}
+
+func TestHandler_GetQueryLogErrors(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	base := time.Now().Add(-time.Hour)
+	mockLogger := &mockQueryLogger{entries: []mockLogEntry{
+		{ID: 1, TenantID: "tenant1", Query: "SELECT 1", ExecutedAt: base, Success: true},
+		{ID: 2, TenantID: "tenant1", Query: "SELEC 2", ExecutedAt: base.Add(time.Minute), ErrorMsg: "syntax error"},
+		{ID: 3, TenantID: "tenant1", Query: "SELECT * FROM missing", ExecutedAt: base.Add(2 * time.Minute), ErrorMsg: "no such table: missing"},
+		{ID: 4, TenantID: "tenant2", Query: "BROKEN", ExecutedAt: base, ErrorMsg: "other tenant"},
+	}}
+	mockDB := &queryLoggingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), queryLogger: mockLogger}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	req, err := http.NewRequest("GET", "/api/query-logs/tenant1/errors?limit=50", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response QueryLogErrorsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if response.Total != 2 || len(response.Logs) != 2 {
+		t.Fatalf("Expected 2 failed queries, got %d", len(response.Logs))
+	}
+	if response.Logs[0].ID != 3 || response.Logs[0].ErrorMsg != "no such table: missing" {
+		t.Errorf("Expected most recent failure first with its message, got %+v", response.Logs[0])
+	}
+	if response.Logs[1].ID != 2 || response.Logs[1].ErrorMsg != "syntax error" {
+		t.Errorf("Expected older failure second with its message, got %+v", response.Logs[1])
+	}
+	for _, entry := range response.Logs {
+		if entry.Success {
+			t.Errorf("Only failed queries should be returned, got %+v", entry)
+		}
+	}
+
+	// Invalid limits are rejected
+	req, _ = http.NewRequest("GET", "/api/query-logs/tenant1/errors?limit=0", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid limit, got %v", rr.Code)
+	}
+}
+
+func TestHandler_PurgeFailedQueries(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	base := time.Now().Add(-time.Hour)
+	mockLogger := &mockQueryLogger{entries: []mockLogEntry{
+		{ID: 1, TenantID: "tenant1", Query: "SELECT 1", ExecutedAt: base, Success: true},
+		{ID: 2, TenantID: "tenant1", Query: "SELEC 2", ExecutedAt: base.Add(time.Minute), ErrorMsg: "syntax error"},
+		{ID: 3, TenantID: "tenant1", Query: "SELECT 3", ExecutedAt: base.Add(2 * time.Minute), Success: true},
+		{ID: 4, TenantID: "tenant1", Query: "SELECT * FROM missing", ExecutedAt: base.Add(3 * time.Minute), ErrorMsg: "no such table: missing"},
+		{ID: 5, TenantID: "tenant2", Query: "BROKEN", ExecutedAt: base, ErrorMsg: "other tenant"},
+	}}
+	mockDB := &queryLoggingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), queryLogger: mockLogger}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	// Only POST purges
+	req, _ := http.NewRequest("GET", "/api/query-logs/tenant1/purge-failed", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %v", rr.Code)
+	}
+
+	req, err := http.NewRequest("POST", "/api/query-logs/tenant1/purge-failed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response QueryLogPurgeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if response.Removed != 2 || response.TenantID != "tenant1" {
+		t.Errorf("Expected 2 failed queries removed for tenant1, got %+v", response)
+	}
+
+	var remaining []int64
+	for _, entry := range mockLogger.entries {
+		if entry.TenantID == "tenant1" {
+			if !entry.Success {
+				t.Errorf("Failed query should have been purged: %+v", entry)
+			}
+			remaining = append(remaining, entry.ID)
+		}
+	}
+	if len(remaining) != 2 || remaining[0] != 1 || remaining[1] != 3 {
+		t.Errorf("Expected successful queries 1 and 3 to remain, got %v", remaining)
+	}
+	if len(mockLogger.entries) != 3 {
+		t.Errorf("Expected other tenants' logs to be untouched, got %d entries", len(mockLogger.entries))
+	}
+}
+
+func TestHandler_GetQueryLogSizes(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockLogger := &mockQueryLogger{entries: []mockLogEntry{
+		{ID: 1, TenantID: "sizes", Query: "SELECT 1", ExecutedAt: time.Now(), Success: true},
+	}}
+	mockDB := &queryLoggingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), queryLogger: mockLogger}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	req, err := http.NewRequest("GET", "/api/query-log-sizes", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response QueryLogSizesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if len(response.Sizes) != 2 || response.Sizes[0]["tenant_id"] != "tenant1" {
+		t.Errorf("Expected sizes for both tenants largest first, got %v", response.Sizes)
+	}
+
+	// A tenant named "sizes" still gets its own logs
+	req, _ = http.NewRequest("GET", "/api/query-logs/sizes", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	var logs QueryLogResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &logs); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if len(logs.Logs) != 1 || logs.Logs[0].ID != 1 {
+		t.Errorf("Expected the logs of tenant sizes, got %+v", logs.Logs)
+	}
+}
+
+func TestHandler_GetQueryLogsByConnection(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	base := time.Now().Add(-time.Hour)
+	mockLogger := &mockQueryLogger{entries: []mockLogEntry{
+		{ID: 1, TenantID: "tenant1", Query: "SELECT 1", ExecutedAt: base, Success: true, ConnectionID: "7"},
+		{ID: 2, TenantID: "tenant1", Query: "SELECT 2", ExecutedAt: base.Add(time.Minute), Success: true, ConnectionID: "8"},
+		{ID: 3, TenantID: "tenant1", Query: "SELECT 3", ExecutedAt: base.Add(2 * time.Minute), Success: true, ConnectionID: "7"},
+	}}
+	mockDB := &queryLoggingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), queryLogger: mockLogger}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	req, _ := http.NewRequest("GET", "/api/query-logs/tenant1?connection_id=7", nil)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response QueryLogResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if len(response.Logs) != 2 || response.Logs[0].ID != 3 || response.Logs[1].ID != 1 {
+		t.Fatalf("Expected the two queries of connection 7, newest first, got %+v", response.Logs)
+	}
+
+	// The connection filter does not combine with the other filters
+	req, _ = http.NewRequest("GET", "/api/query-logs/tenant1?connection_id=7&success=false", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when combining connection_id with success, got %v", rr.Code)
+	}
+}
+
+func (m *mockQueryLogger) GetSlowestQueries(tenantID string, limit int) ([]interface{}, error) {
+	var matched []mockLogEntry
+	for _, entry := range m.entries {
+		if entry.TenantID == tenantID {
+			matched = append(matched, entry)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Duration > matched[j].Duration })
+
+	var logs []interface{}
+	for i := 0; i < len(matched) && i < limit; i++ {
+		logs = append(logs, matched[i])
+	}
+	return logs, nil
+}
+
+func TestHandler_GetSlowestQueries(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	base := time.Now().Add(-time.Hour)
+	mockLogger := &mockQueryLogger{entries: []mockLogEntry{
+		{ID: 1, TenantID: "tenant1", Query: "SELECT 1", ExecutedAt: base, Duration: 1, Success: true},
+		{ID: 2, TenantID: "tenant1", Query: "SELECT * FROM orders", ExecutedAt: base, Duration: 2400, Success: true, Explain: "SCAN orders"},
+		{ID: 3, TenantID: "tenant1", Query: "SELECT * FROM users WHERE id = 1", ExecutedAt: base, Duration: 30, Success: true},
+		{ID: 4, TenantID: "tenant2", Query: "SELECT * FROM other", ExecutedAt: base, Duration: 9000, Success: true},
+	}}
+	mockDB := &queryLoggingMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager(), queryLogger: mockLogger}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	req, err := http.NewRequest("GET", "/api/query-logs/tenant1/slowest?limit=2", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+
+	var response QueryLogSlowestResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Total != 2 || response.Limit != 2 {
+		t.Fatalf("Expected 2 entries with limit 2, got %d with limit %d", response.Total, response.Limit)
+	}
+	if response.Logs[0].ID != 2 || response.Logs[0].Explain != "SCAN orders" {
+		t.Errorf("Expected the slowest query first with its plan, got %+v", response.Logs[0])
+	}
+	if response.Logs[1].ID != 3 {
+		t.Errorf("Expected the second slowest query next, got %+v", response.Logs[1])
+	}
+
+	req, _ = http.NewRequest("GET", "/api/query-logs/tenant1/slowest?limit=0", nil)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid limit, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// queryMockDatabaseManager records the statements it is asked to execute
+type queryMockDatabaseManager struct {
+	*MockDatabaseManager
+	executed [][]interface{}
+}
+
+func (m *queryMockDatabaseManager) ExecuteQuery(idx string, query string, args []interface{}) (*QueryResponse, error) {
+	if strings.Contains(query, "missing_table") {
+		return nil, fmt.Errorf("%w: no such table: missing_table", ErrInvalidQuery)
+	}
+	m.executed = append(m.executed, args)
+	return &QueryResponse{
+		Columns: []string{"id", "name"},
+		Rows:    [][]interface{}{{args[0], "Alice"}},
+		Debug:   &QueryDebug{SQL: strings.TrimSpace(query), Idx: idx},
+	}, nil
+}
+
+func TestHandler_QueryHandler_Parameterized(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &queryMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	body := []byte(`{"idx":"test1","query":"SELECT id, name FROM users WHERE id = ?","args":[1]}`)
+	req, err := http.NewRequest("POST", "/api/query", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Handler returned wrong status code: got %v want %v", rr.Code, http.StatusOK)
+	}
+	if len(mockDB.executed) != 1 {
+		t.Fatalf("Expected one execution, got %d", len(mockDB.executed))
+	}
+	if arg, ok := mockDB.executed[0][0].(int64); !ok || arg != 1 {
+		t.Errorf("Integer args should bind as int64, got %T %v", mockDB.executed[0][0], mockDB.executed[0][0])
+	}
+
+	var response QueryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Should be able to unmarshal response: %v", err)
+	}
+	if response.RowCount != 1 || response.Rows[0][1] != "Alice" {
+		t.Errorf("Unexpected rows in response: %+v", response.Rows)
+	}
+}
+
+func TestHandler_QueryHandler_ArgCountMismatch(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &queryMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	testCases := []string{
+		`{"idx":"test1","query":"SELECT * FROM users WHERE id = ? AND name = ?","args":[1]}`,
+		`{"idx":"test1","query":"SELECT * FROM users WHERE name = '?'","args":[1]}`,
+		`{"idx":"test1","query":"SELECT * FROM users WHERE id = ?"}`,
+	}
+
+	for _, body := range testCases {
+		req, err := http.NewRequest("POST", "/api/query", bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Body %s: expected status 400, got %v", body, rr.Code)
+		}
+	}
+
+	if len(mockDB.executed) != 0 {
+		t.Errorf("Mismatched queries must not be executed, got %d executions", len(mockDB.executed))
+	}
+}
+
+func TestHandler_QueryHandler_InvalidSQL(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &queryMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	body := `{"idx":"test1","query":"SELECT * FROM missing_table"}`
+	req := httptest.NewRequest("POST", "/api/query", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("Invalid SQL should be rejected with 400, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if !strings.Contains(rr.Body.String(), "no such table: missing_table") {
+		t.Errorf("Response should carry the SQL error, got %s", rr.Body.String())
+	}
+}
+
+func TestCountPlaceholders(t *testing.T) {
+	testCases := map[string]int{
+		"SELECT 1":                                     0,
+		"SELECT * FROM users WHERE id = ?":             1,
+		"SELECT * FROM users WHERE id = ? OR age > ?":  2,
+		"SELECT '?' AS q, \"?\" AS r FROM t WHERE a=?": 1,
+		"SELECT * FROM t WHERE a = ? -- why?\n":         1,
+		"SELECT /* a? b? */ * FROM t WHERE a = ?":      1,
+		"SELECT * FROM t /* unterminated ?":            0,
+	}
+	for query, expected := range testCases {
+		if got := countPlaceholders(query); got != expected {
+			t.Errorf("countPlaceholders(%q) = %d, want %d", query, got, expected)
+		}
+	}
+}
+
+func TestHandler_QueryHandler_Debug(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &queryMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	handler := NewHandler(logger, mockDB)
+	mux := handler.SetupRoutes()
+
+	query := func(path string) QueryResponse {
+		body := []byte(`{"idx":"test1","query":"  SELECT id, name FROM users WHERE id = ?  ","args":[1]}`)
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(body))
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s returned status %v: %s", path, rr.Code, rr.Body.String())
+		}
+		var response QueryResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("Should be able to unmarshal response: %v", err)
+		}
+		return response
+	}
+
+	// Debugging is off unless the server enables it
+	if response := query("/api/query?debug=true"); response.Debug != nil {
+		t.Errorf("Debug details should be absent while disabled, got %+v", response.Debug)
+	}
+
+	handler.SetDebugEnabled(true)
+	if response := query("/api/query"); response.Debug != nil {
+		t.Errorf("Debug details should be absent unless requested, got %+v", response.Debug)
+	}
+	response := query("/api/query?debug=true")
+	if response.Debug == nil {
+		t.Fatal("Expected debug details when requested and enabled")
+	}
+	if response.Debug.SQL != "SELECT id, name FROM users WHERE id = ?" || response.Debug.Idx != "test1" {
+		t.Errorf("Expected the executed SQL and tenant, got %+v", response.Debug)
+	}
+}
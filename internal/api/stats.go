@@ -0,0 +1,154 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// QueryStats holds the query counters reported by the stats and metrics endpoints
+type QueryStats struct {
+	TotalQueries     int64
+	QueriesPerSecond float64
+	QPSWindow        time.Duration
+	TenantQueries    map[string]int64
+	DurationBuckets  []float64       // Upper bounds in seconds of the query duration histogram buckets
+	Durations        []QueryDuration // Query duration histograms by tenant, statement type and status
+}
+
+// QueryDuration is the query duration histogram for one {idx, statement_type, status} label set
+type QueryDuration struct {
+	Idx           string
+	StatementType string
+	Status        string
+	BucketCounts  []int64 // Cumulative counts for each of DurationBuckets
+	Sum           time.Duration
+	Count         int64
+}
+
+// labelValueEscaper escapes a label value for the Prometheus text exposition format, which only
+// escapes backslashes, double quotes and line feeds
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labelValue quotes value as a Prometheus label value
+func labelValue(value string) string {
+	return `"` + labelValueEscaper.Replace(value) + `"`
+}
+
+// StatsResponse represents the response for GET /api/stats
+type StatsResponse struct {
+	TotalQueries     int64            `json:"total_queries"`
+	QueriesPerSecond float64          `json:"queries_per_second"`
+	QPSWindowSeconds float64          `json:"qps_window_seconds"`
+	TenantQueries    map[string]int64 `json:"tenant_queries"`
+	Status           string           `json:"status"`
+	Timestamp        time.Time        `json:"timestamp"`
+}
+
+// queryStats fetches the query counters from the database manager, if it tracks them
+func (h *Handler) queryStats() (*QueryStats, bool) {
+	provider, ok := h.dbManager.(interface{ GetQueryStats() *QueryStats })
+	if !ok {
+		return nil, false
+	}
+	return provider.GetQueryStats(), true
+}
+
+// StatsHandler godoc
+// @Summary Query statistics
+// @Description Returns total and per-tenant query counts and a rolling queries-per-second estimate
+// @Tags stats
+// @Produce json
+// @Success 200 {object} StatsResponse
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Statistics not supported"
+// @Router /api/stats [get]
+func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, ok := h.queryStats()
+	if !ok {
+		h.sendErrorResponse(w, r, "Query statistics not supported", http.StatusInternalServerError)
+		return
+	}
+
+	response := StatsResponse{
+		TotalQueries:     stats.TotalQueries,
+		QueriesPerSecond: stats.QueriesPerSecond,
+		QPSWindowSeconds: stats.QPSWindow.Seconds(),
+		TenantQueries:    stats.TenantQueries,
+		Status:           "ok",
+		Timestamp:        time.Now(),
+	}
+	if err := h.writeJSON(w, r, http.StatusOK, response); err != nil {
+		h.logger.Printf("Error encoding stats response: %v", err)
+		return
+	}
+}
+
+// MetricsHandler godoc
+// @Summary Prometheus metrics
+// @Description Exposes the query counters in the Prometheus text exposition format
+// @Tags stats
+// @Produce plain
+// @Success 200 {string} string "Metrics"
+// @Failure 405 {object} Response "Method not allowed"
+// @Failure 500 {object} Response "Statistics not supported"
+// @Router /metrics [get]
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		h.sendErrorResponse(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	stats, ok := h.queryStats()
+	if !ok {
+		h.sendErrorResponse(w, r, "Query statistics not supported", http.StatusInternalServerError)
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("# HELP multitenant_db_queries_total Queries handled over the MySQL protocol.\n")
+	b.WriteString("# TYPE multitenant_db_queries_total counter\n")
+	fmt.Fprintf(&b, "multitenant_db_queries_total %d\n", stats.TotalQueries)
+
+	b.WriteString("# HELP multitenant_db_tenant_queries_total Queries handled over the MySQL protocol per tenant.\n")
+	b.WriteString("# TYPE multitenant_db_tenant_queries_total counter\n")
+	tenants := make([]string, 0, len(stats.TenantQueries))
+	for idx := range stats.TenantQueries {
+		tenants = append(tenants, idx)
+	}
+	sort.Strings(tenants)
+	for _, idx := range tenants {
+		fmt.Fprintf(&b, "multitenant_db_tenant_queries_total{idx=%s} %d\n", labelValue(idx), stats.TenantQueries[idx])
+	}
+
+	fmt.Fprintf(&b, "# HELP multitenant_db_queries_per_second Average queries per second over the last %v.\n", stats.QPSWindow)
+	b.WriteString("# TYPE multitenant_db_queries_per_second gauge\n")
+	fmt.Fprintf(&b, "multitenant_db_queries_per_second %g\n", stats.QueriesPerSecond)
+
+	if len(stats.Durations) > 0 {
+		b.WriteString("# HELP multitenant_db_query_duration_seconds Query duration by tenant, statement type and status.\n")
+		b.WriteString("# TYPE multitenant_db_query_duration_seconds histogram\n")
+		for _, d := range stats.Durations {
+			labels := fmt.Sprintf("idx=%s,statement_type=%s,status=%s", labelValue(d.Idx), labelValue(d.StatementType), labelValue(d.Status))
+			for i, bound := range stats.DurationBuckets {
+				fmt.Fprintf(&b, "multitenant_db_query_duration_seconds_bucket{%s,le=\"%g\"} %d\n", labels, bound, d.BucketCounts[i])
+			}
+			fmt.Fprintf(&b, "multitenant_db_query_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", labels, d.Count)
+			fmt.Fprintf(&b, "multitenant_db_query_duration_seconds_sum{%s} %g\n", labels, d.Sum.Seconds())
+			fmt.Fprintf(&b, "multitenant_db_query_duration_seconds_count{%s} %d\n", labels, d.Count)
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write([]byte(b.String())); err != nil {
+		h.logger.Printf("Error writing metrics response: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// statsMockDatabaseManager adds query statistics to the mock manager
+type statsMockDatabaseManager struct {
+	*MockDatabaseManager
+	stats *QueryStats
+}
+
+func (m *statsMockDatabaseManager) GetQueryStats() *QueryStats {
+	return m.stats
+}
+
+func TestHandler_StatsHandler(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &statsMockDatabaseManager{
+		MockDatabaseManager: NewMockDatabaseManager(),
+		stats: &QueryStats{
+			TotalQueries:     42,
+			QueriesPerSecond: 4.2,
+			QPSWindow:        10 * time.Second,
+			TenantQueries:    map[string]int64{"default": 40, "tenant_a": 2, "t\\\t\"\n": 1},
+			DurationBuckets:  []float64{0.01, 1},
+			Durations: []QueryDuration{
+				{Idx: "tenant_a", StatementType: "select", Status: "success", BucketCounts: []int64{1, 2}, Sum: 20 * time.Millisecond, Count: 2},
+				{Idx: "other", StatementType: "insert", Status: "error", BucketCounts: []int64{0, 0}, Sum: 2 * time.Second, Count: 1},
+			},
+		},
+	}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	var response StatsResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.TotalQueries != 42 || response.QueriesPerSecond != 4.2 || response.QPSWindowSeconds != 10 {
+		t.Errorf("Unexpected stats response: %+v", response)
+	}
+	if response.TenantQueries["tenant_a"] != 2 {
+		t.Errorf("Expected per-tenant counts, got %v", response.TenantQueries)
+	}
+
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, line := range []string{
+		"multitenant_db_queries_total 42",
+		`multitenant_db_tenant_queries_total{idx="tenant_a"} 2`,
+		"multitenant_db_queries_per_second 4.2",
+		`multitenant_db_query_duration_seconds_bucket{idx="tenant_a",statement_type="select",status="success",le="0.01"} 1`,
+		`multitenant_db_query_duration_seconds_bucket{idx="tenant_a",statement_type="select",status="success",le="+Inf"} 2`,
+		`multitenant_db_query_duration_seconds_sum{idx="tenant_a",statement_type="select",status="success"} 0.02`,
+		`multitenant_db_query_duration_seconds_count{idx="other",statement_type="insert",status="error"} 1`,
+		// Label values use the exposition format's escaping, which leaves tabs alone
+		`multitenant_db_tenant_queries_total{idx="t\\` + "\t" + `\"\n"} 1`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+
+	// Managers without statistics report an error rather than zeros
+	rr = httptest.NewRecorder()
+	NewHandler(logger, NewMockDatabaseManager()).SetupRoutes().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/stats", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status 500 without statistics, got %d", rr.Code)
+	}
+}
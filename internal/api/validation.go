@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"multitenant-db/internal/config"
+)
+
+// MaxQueryArgs is the most positional args one query request may bind
+const MaxQueryArgs = 1000
+
+// FieldError reports a request body field that is unknown or failed validation
+type FieldError struct {
+	Field   string // JSON name of the field, dotted for nested fields
+	Message string // What is wrong with it, e.g. "is required"
+}
+
+// Error implements error
+func (e *FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// validateIdx checks that the idx in field is present and well formed
+func validateIdx(field, idx string) error {
+	if problem := config.CheckIdx(idx); problem != "" {
+		return &FieldError{Field: field, Message: problem}
+	}
+	return nil
+}
+
+// decodeJSONBody decodes a request body holding one JSON object into dst, rejecting fields dst
+// does not have, values of the wrong type and anything after the object. Errors about a field are
+// a *FieldError naming it. With useNumber, numbers in interface{} values decode as json.Number.
+func decodeJSONBody(r *http.Request, dst interface{}, useNumber bool) error {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if useNumber {
+		decoder.UseNumber()
+	}
+
+	if err := decoder.Decode(dst); err != nil {
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.Is(err, io.EOF):
+			return errors.New("request body is required")
+		case errors.As(err, &syntaxErr):
+			return fmt.Errorf("malformed JSON at offset %d", syntaxErr.Offset)
+		case errors.As(err, &typeErr) && typeErr.Field != "":
+			return &FieldError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)}
+		case errors.As(err, &typeErr):
+			return errors.New("request body must be a JSON object")
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			// encoding/json has no typed error for unknown fields
+			field, unquoteErr := strconv.Unquote(strings.TrimPrefix(err.Error(), "json: unknown field "))
+			if unquoteErr != nil {
+				return err
+			}
+			return &FieldError{Field: field, Message: "is not a known field"}
+		}
+		return fmt.Errorf("malformed JSON: %v", err)
+	}
+
+	if decoder.More() {
+		return errors.New("request body must hold a single JSON object")
+	}
+	return nil
+}
+
+// jsonTypeName describes the JSON value a Go type decodes from, for error messages
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.String:
+		return "a string"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	case reflect.Map, reflect.Struct:
+		return "an object"
+	}
+	return "a valid value"
+}
+
+// sendRequestError answers 400 Bad Request for a request body that failed decoding or
+// validation, naming the offending field when the error is a *FieldError
+func (h *Handler) sendRequestError(w http.ResponseWriter, r *http.Request, err error) {
+	response := Response{
+		Message:   "invalid request: " + err.Error(),
+		Status:    "error",
+		Timestamp: time.Now(),
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		response.Field = fieldErr.Field
+	}
+
+	if err := h.writeJSON(w, r, http.StatusBadRequest, response); err != nil {
+		h.logger.Printf("Error encoding error response: %v", err)
+	}
+}
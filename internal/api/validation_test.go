@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"multitenant-db/internal/config"
+)
+
+func TestHandler_StrictRequestBodies(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	mockDB := &queryMockDatabaseManager{MockDatabaseManager: NewMockDatabaseManager()}
+	mux := NewHandler(logger, mockDB).SetupRoutes()
+
+	tooManyArgs := `{"query":"SELECT 1","args":[` + strings.Repeat("1,", MaxQueryArgs) + `1]}`
+	tests := []struct {
+		name  string
+		path  string
+		body  string
+		field string // Field the error should name, "" for errors about the whole body
+	}{
+		{"unknown create field", "/api/databases", `{"idx":"acme","sead":false}`, "sead"},
+		{"invalid idx", "/api/databases", `{"idx":"acme corp"}`, "idx"},
+		{"idx too long", "/api/databases", `{"idx":"` + strings.Repeat("a", config.MaxIdxLength+1) + `"}`, "idx"},
+		{"missing idx", "/api/databases", `{"seed":true}`, "idx"},
+		{"wrong type", "/api/databases", `{"idx":"acme","seed":"yes"}`, "seed"},
+		{"trailing data", "/api/databases", `{"idx":"acme"} {"idx":"other"}`, ""},
+		{"empty body", "/api/databases", ``, ""},
+		{"unknown alias field", "/api/databases/alias", `{"alias":"a","target":"b","force":true}`, "force"},
+		{"invalid alias target", "/api/databases/alias", `{"alias":"a","target":"../b"}`, "target"},
+		{"unknown query field", "/api/query", `{"query":"SELECT 1","params":[1]}`, "params"},
+		{"invalid query idx", "/api/query", `{"idx":"a;b","query":"SELECT 1"}`, "idx"},
+		{"missing query", "/api/query", `{"idx":"acme"}`, "query"},
+		{"too many args", "/api/query", tooManyArgs, "args"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Fatalf("Expected 400, got %v: %s", rr.Code, rr.Body.String())
+			}
+			var response Response
+			if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if response.Field != tt.field {
+				t.Errorf("Expected the error to name field %q, got %q (%s)", tt.field, response.Field, response.Message)
+			}
+			if tt.field != "" && !strings.Contains(response.Message, tt.field) {
+				t.Errorf("Expected the message to mention %s, got %q", tt.field, response.Message)
+			}
+		})
+	}
+
+	if len(mockDB.executed) != 0 {
+		t.Errorf("Expected no query to run, got %d", len(mockDB.executed))
+	}
+
+	// Tenant IDs with dots, which SET @idx and tenant hints accept, are valid
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/api/query", strings.NewReader(`{"idx":"acme.eu","query":"SELECT ?","args":[1]}`)))
+	if rr.Code != http.StatusOK {
+		t.Errorf("Expected 200 for idx acme.eu, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogger_Record(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf)
+
+	if err := logger.Record("10.0.0.1:5000", ActionTenantCreate, "acme", nil); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+	if err := logger.Record("10.0.0.2:5000", ActionAuthFailure, "", errors.New("access denied")); err != nil {
+		t.Fatalf("Record failed: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var created, failed Entry
+	if err := json.Unmarshal([]byte(lines[0]), &created); err != nil {
+		t.Fatalf("Entry should be JSON: %v", err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failed); err != nil {
+		t.Fatalf("Entry should be JSON: %v", err)
+	}
+	if created.Actor != "10.0.0.1:5000" || created.Action != ActionTenantCreate || created.Target != "acme" || created.Result != ResultSuccess || created.Time.IsZero() {
+		t.Errorf("Unexpected success entry: %+v", created)
+	}
+	if failed.Result != ResultFailure || failed.Detail != "access denied" || strings.Contains(lines[1], `"target"`) {
+		t.Errorf("Unexpected failure entry: %+v (%s)", failed, lines[1])
+	}
+}
+
+func TestOpen(t *testing.T) {
+	logger, err := Open("")
+	if err != nil || logger != nil {
+		t.Fatalf("Expected an empty sink to disable auditing, got %v, %v", logger, err)
+	}
+	// A disabled logger accepts entries and discards them
+	if err := logger.Record("actor", ActionTenantDelete, "acme", nil); err != nil {
+		t.Errorf("Nil logger should discard entries, got %v", err)
+	}
+	if err := logger.Close(); err != nil {
+		t.Errorf("Nil logger should close cleanly, got %v", err)
+	}
+
+	if logger, err := Open(SinkStdout); err != nil || logger == nil {
+		t.Errorf("Expected a stdout logger, got %v, %v", logger, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	for i := 0; i < 2; i++ {
+		logger, err := Open(path)
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		if err := logger.Record("actor", ActionTenantDelete, "acme", nil); err != nil {
+			t.Fatalf("Record failed: %v", err)
+		}
+		if err := logger.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("Expected entries to be appended across opens, got %d lines", lines)
+	}
+
+	if _, err := Open(filepath.Join(t.TempDir(), "missing", "audit.log")); err == nil {
+		t.Error("Expected an error for a file in a missing directory")
+	}
+}
@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // DatabaseType represents the type of default database
@@ -27,8 +31,71 @@ type DefaultDatabaseConfig struct {
 	MySQLPassword    string       `json:"mysql_password,omitempty"`    // MySQL password
 	MySQLDatabase    string       `json:"mysql_database,omitempty"`    // MySQL database name
 	MySQLSSLMode     string       `json:"mysql_ssl_mode,omitempty"`    // MySQL SSL mode
+
+	// Connection pool of a MySQL default database; zero values use the Default* pool settings
+	MySQLMaxOpenConns    int           `json:"mysql_max_open_conns,omitempty"`     // Maximum open connections
+	MySQLMaxIdleConns    int           `json:"mysql_max_idle_conns,omitempty"`     // Maximum idle connections kept for reuse
+	MySQLConnMaxLifetime time.Duration `json:"mysql_conn_max_lifetime,omitempty"` // Maximum time a connection is reused
 }
 
+// Connection pool settings of a MySQL default database, used when not configured. The lifetime
+// keeps connections well inside MySQL's wait_timeout and lets them follow failovers.
+const (
+	DefaultMySQLMaxOpenConns    = 20
+	DefaultMySQLMaxIdleConns    = 10
+	DefaultMySQLConnMaxLifetime = 5 * time.Minute
+)
+
+// DefaultMaxAllowedPacket is the default max_allowed_packet in bytes (MySQL 8.0 default)
+const DefaultMaxAllowedPacket = 64 << 20
+
+// Default SQLite page cache and memory-map sizes applied to tenant databases (SQLite's own defaults)
+const (
+	DefaultSQLiteCacheSize = -2000 // Negative values are KiB, so about 2 MiB of page cache
+	DefaultSQLiteMmapSize  = 0     // Memory-mapped I/O disabled
+)
+
+// DefaultSampleDataRows is how many sample users and products are seeded into a new database
+const DefaultSampleDataRows = 3
+
+// DefaultSessionGCInterval is how often sessions left behind by vanished connections are collected
+const DefaultSessionGCInterval = time.Minute
+
+// MaxQueryLogShardLevels is the deepest query log directory sharding allowed
+const MaxQueryLogShardLevels = 4
+
+// DefaultSlowQueryThreshold is how long a statement runs before it counts as slow
+const DefaultSlowQueryThreshold = time.Second
+
+// DefaultShutdownGraceTimeout is how long shutdown waits for statements in flight to finish
+const DefaultShutdownGraceTimeout = 30 * time.Second
+
+// Tenant limit modes, deciding what happens when MaxTenantDatabases is reached
+const (
+	TenantLimitModeReject = "reject" // Refuse to create another tenant database
+	TenantLimitModeEvict  = "evict"  // Evict the least recently used tenant database to make room
+)
+
+// Bind parameter redaction modes for logged prepared-statement arguments
+const (
+	BindParamRedactionNone   = "none"   // Log parameter values verbatim
+	BindParamRedactionRedact = "redact" // Replace every value with a placeholder
+	BindParamRedactionHash   = "hash"   // Replace every value with a short SHA-256 digest
+)
+
+// Empty query modes, deciding how a query that is empty or only whitespace is answered
+const (
+	EmptyQueryModeOK    = "ok"    // Answer with an OK packet, for clients that send empty keep-alives
+	EmptyQueryModeError = "error" // Answer with MySQL's "Query was empty" error
+)
+
+// Tenant resolvers, the sources a session's tenant can be taken from
+const (
+	TenantResolverVariable  = "variable"  // The @idx user variable
+	TenantResolverAttribute = "attribute" // The idx connection attribute sent in the handshake
+	TenantResolverUsername  = "username"  // A tenant prefix on the username, as in tenant_alpha:root
+)
+
 // AuthConfig holds authentication configuration for MySQL protocol connections
 type AuthConfig struct {
 	Username string `json:"username"`
@@ -42,59 +109,468 @@ type Config struct {
 	HTTPPort        int                    `json:"http_port"`
 	MySQLPort       int                    `json:"mysql_port"`
 	Env             string                 `json:"env,omitempty"` // Environment (development, production, etc)
+
+	ServiceName        string `json:"service_name,omitempty"`        // Name shown in the welcome message, /api/info and log prefix (empty keeps the built-in name)
+	ServiceDescription string `json:"service_description,omitempty"` // Description shown in /api/info (empty keeps the built-in description)
+	APIDebug           bool   `json:"api_debug,omitempty"`           // Allow ?debug=true on the HTTP API to echo the executed SQL and resolved tenant
+
+	TenantIdleTimeout  time.Duration `json:"tenant_idle_timeout,omitempty"`  // Evict tenant databases idle for longer than this (0 disables)
+	EvictionWebhookURL string        `json:"eviction_webhook_url,omitempty"` // URL notified when a tenant database is evicted or expires
+	TenantTTL          time.Duration `json:"tenant_ttl,omitempty"`           // Delete tenant databases untouched for longer than this (0 disables)
+
+	MaxTenantDatabases int    `json:"max_tenant_databases,omitempty"` // Cap on open tenant databases, excluding the default (0 disables)
+	TenantLimitMode    string `json:"tenant_limit_mode,omitempty"`    // What to do at the cap: reject (default) or evict
+
+	AutocreateTenants bool `json:"autocreate_tenants"` // Create tenant databases on first use; when false, USE and SET @idx refuse unknown tenants
+
+	TenantResolvers []string `json:"tenant_resolvers,omitempty"` // Sources of a session's tenant in priority order: variable, attribute, username (empty means variable)
+	DefaultTenant   string   `json:"default_tenant,omitempty"`   // Tenant of sessions no resolver binds (empty means the default database)
+
+	TenantUserAccess map[string][]string `json:"tenant_user_access,omitempty"` // Tenants each user may select through the idx attribute or a username prefix, "*" meaning any (empty trusts every login)
+
+	MaxQueryLogDatabases int `json:"max_query_log_databases,omitempty"` // Cap on open per-tenant query log databases, evicting the least recently used (0 disables)
+
+	QueryLogDir         string `json:"query_log_dir,omitempty"`          // Directory of the per-tenant query log databases (empty keeps them in memory)
+	QueryLogShardLevels int    `json:"query_log_shard_levels,omitempty"` // Levels of hash-named subdirectories query log databases are spread over (0 keeps them flat)
+	QueryLogColocate    bool   `json:"query_log_colocate,omitempty"`     // Keep each tenant's query log in a __query_logs table of its own database
+
+	MaxResultRows       int            `json:"max_result_rows,omitempty"`        // Cap on rows returned by a single query (0 disables)
+	TenantMaxResultRows map[string]int `json:"tenant_max_result_rows,omitempty"` // Per-tenant overrides of MaxResultRows, keyed by idx
+
+	LowerCaseTableNames bool `json:"lower_case_table_names,omitempty"` // Resolve table names case-insensitively (like MySQL lower_case_table_names=1)
+
+	MySQLCompat bool `json:"mysql_compat"` // Rewrite MySQL-only clauses SQLite rejects, such as FOR UPDATE on a SELECT, and name result columns as MySQL does
+
+	BlockDestructive       bool     `json:"block_destructive,omitempty"`        // Reject DROP, TRUNCATE and DELETE without WHERE on every tenant
+	BlockDestructiveExempt []string `json:"block_destructive_exempt,omitempty"` // Tenants (idx) still allowed to run destructive statements
+
+	TenantConnectionAffinity bool `json:"tenant_connection_affinity,omitempty"` // Serialize each tenant's statements on one dedicated connection
+
+	DefaultTimeZone string `json:"default_time_zone,omitempty"` // time_zone sessions start with: SYSTEM (default), an offset such as +00:00, or a named zone
+
+	SessionGCInterval time.Duration `json:"session_gc_interval"` // How often sessions without an open connection are removed (0 disables)
+
+	ShutdownGraceTimeout time.Duration `json:"shutdown_grace_timeout"` // How long shutdown waits for statements in flight before closing their connections (0 closes them at once)
+
+	StatementTimeout time.Duration `json:"statement_timeout,omitempty"` // Maximum run time of a single statement (0 disables)
+
+	SlowQueryThreshold time.Duration `json:"slow_query_threshold"`         // Run time from which a statement counts as slow
+	SlowQueryExplain   bool          `json:"slow_query_explain,omitempty"` // Store the EXPLAIN QUERY PLAN of slow statements in the query log
+
+	LogBindParams      bool   `json:"log_bind_params"`                // Include prepared-statement arguments in logs
+	BindParamRedaction string `json:"bind_param_redaction,omitempty"` // How logged arguments are masked: none, redact or hash
+
+	MaxAllowedPacket int `json:"max_allowed_packet,omitempty"` // Largest query payload accepted, in bytes (0 uses DefaultMaxAllowedPacket)
+
+	EmptyQueryMode string `json:"empty_query_mode,omitempty"` // How empty queries are answered: ok (default) or error
+
+	SQLiteCacheSize       int            `json:"sqlite_cache_size"`                  // PRAGMA cache_size for tenant databases (pages, or KiB when negative)
+	SQLiteMmapSize        int            `json:"sqlite_mmap_size"`                   // PRAGMA mmap_size for tenant databases, in bytes
+	TenantSQLiteCacheSize map[string]int `json:"tenant_sqlite_cache_size,omitempty"` // Per-tenant overrides of SQLiteCacheSize, keyed by idx
+	TenantSQLiteMmapSize  map[string]int `json:"tenant_sqlite_mmap_size,omitempty"`  // Per-tenant overrides of SQLiteMmapSize, keyed by idx
+
+	SampleDataRows int `json:"sample_data_rows"` // Sample users and products seeded into each new database, e.g. more for load testing
+
+	AuditLog string `json:"audit_log,omitempty"` // Where administrative actions are audited: "stdout" or a file path (empty disables)
+
+	QueryLogToStdout    bool `json:"query_log_to_stdout,omitempty"`    // Also write each query log entry to the application log as a JSON line
+	QueryLogSkipSession bool `json:"query_log_skip_session,omitempty"` // Keep session-management statements (SET, USE, SHOW VARIABLES, SELECT @@var) out of the query log
 }
 
 // NewConfig creates a new configuration with default values
 func NewConfig() *Config {
 	return &Config{
-		HTTPPort:  8080,
-		MySQLPort: 3306,
+		HTTPPort:             8080,
+		MySQLPort:            3306,
+		LogBindParams:        true,
+		MaxAllowedPacket:     DefaultMaxAllowedPacket,
+		SQLiteCacheSize:      DefaultSQLiteCacheSize,
+		SQLiteMmapSize:       DefaultSQLiteMmapSize,
+		SampleDataRows:       DefaultSampleDataRows,
+		SessionGCInterval:    DefaultSessionGCInterval,
+		ShutdownGraceTimeout: DefaultShutdownGraceTimeout,
+		SlowQueryThreshold:   DefaultSlowQueryThreshold,
+		AutocreateTenants:    true,
+		MySQLCompat:          true,
 	}
 }
 
 // LoadFromEnv loads configuration from environment variables
 func (c *Config) LoadFromEnv() error {
+	return c.load(os.Getenv)
+}
+
+// LoadFromFile loads configuration from a file of KEY=VALUE lines using the same keys as the
+// environment. Blank lines and lines starting with # are ignored. Environment variables take
+// precedence over values from the file.
+func (c *Config) LoadFromFile(path string) error {
+	values, err := readConfigFile(path)
+	if err != nil {
+		return err
+	}
+	return c.load(func(key string) string {
+		if value, ok := os.LookupEnv(key); ok {
+			return value
+		}
+		return values[key]
+	})
+}
+
+// readConfigFile parses a KEY=VALUE configuration file
+func readConfigFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+
+	values := make(map[string]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid config file line %d: expected KEY=VALUE", i+1)
+		}
+		values[strings.TrimSpace(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+	}
+	return values, nil
+}
+
+// load populates the configuration from getenv
+func (c *Config) load(getenv func(string) string) error {
    // Environment
-   if env := os.Getenv("ENV"); env != "" {
+   if env := getenv("ENV"); env != "" {
 	   c.Env = env
    }
+	// Service branding
+	if name := getenv("SERVICE_NAME"); name != "" {
+		c.ServiceName = name
+	}
+	if description := getenv("SERVICE_DESCRIPTION"); description != "" {
+		c.ServiceDescription = description
+	}
+	// HTTP API debugging
+	if apiDebug := getenv("API_DEBUG"); apiDebug != "" {
+		enabled, err := strconv.ParseBool(apiDebug)
+		if err != nil {
+			return fmt.Errorf("invalid API_DEBUG: %v", err)
+		}
+		c.APIDebug = enabled
+	}
 	// HTTP Port
-	if port := os.Getenv("HTTP_PORT"); port != "" {
+	if port := getenv("HTTP_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
 			c.HTTPPort = p
 		}
 	}
 
 	// MySQL Port
-	if port := os.Getenv("MYSQL_PORT"); port != "" {
+	if port := getenv("MYSQL_PORT"); port != "" {
 		if p, err := strconv.Atoi(port); err == nil {
 			c.MySQLPort = p
 		}
 	}
 
+	// Tenant idle eviction
+	if timeout := getenv("TENANT_IDLE_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_IDLE_TIMEOUT: %v", err)
+		}
+		c.TenantIdleTimeout = d
+	}
+	if webhookURL := getenv("EVICTION_WEBHOOK_URL"); webhookURL != "" {
+		c.EvictionWebhookURL = webhookURL
+	}
+
+	// Ephemeral tenant expiry
+	if ttl := getenv("TENANT_TTL"); ttl != "" {
+		d, err := time.ParseDuration(ttl)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_TTL: %v", err)
+		}
+		c.TenantTTL = d
+	}
+
+	// Tenant database cap
+	if maxTenants := getenv("MAX_TENANT_DATABASES"); maxTenants != "" {
+		n, err := strconv.Atoi(maxTenants)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_TENANT_DATABASES: %v", err)
+		}
+		c.MaxTenantDatabases = n
+	}
+	if mode := getenv("TENANT_LIMIT_MODE"); mode != "" {
+		c.TenantLimitMode = strings.ToLower(mode)
+	}
+
+	// Query log database cap
+	if maxLogs := getenv("MAX_QUERY_LOG_DATABASES"); maxLogs != "" {
+		n, err := strconv.Atoi(maxLogs)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_QUERY_LOG_DATABASES: %v", err)
+		}
+		c.MaxQueryLogDatabases = n
+	}
+
+	// Result row cap
+	if maxRows := getenv("MAX_RESULT_ROWS"); maxRows != "" {
+		n, err := strconv.Atoi(maxRows)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_RESULT_ROWS: %v", err)
+		}
+		c.MaxResultRows = n
+	}
+	if overrides := getenv("TENANT_MAX_RESULT_ROWS"); overrides != "" {
+		parsed, err := ParseTenantLimits(overrides)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_MAX_RESULT_ROWS: %v", err)
+		}
+		c.TenantMaxResultRows = parsed
+	}
+
+	// Statement timeout
+	if timeoutMS := getenv("STATEMENT_TIMEOUT_MS"); timeoutMS != "" {
+		ms, err := strconv.Atoi(timeoutMS)
+		if err != nil {
+			return fmt.Errorf("invalid STATEMENT_TIMEOUT_MS: %v", err)
+		}
+		c.StatementTimeout = time.Duration(ms) * time.Millisecond
+	}
+
+	// Slow query plan capture
+	if thresholdMS := getenv("SLOW_QUERY_MS"); thresholdMS != "" {
+		ms, err := strconv.Atoi(thresholdMS)
+		if err != nil {
+			return fmt.Errorf("invalid SLOW_QUERY_MS: %v", err)
+		}
+		c.SlowQueryThreshold = time.Duration(ms) * time.Millisecond
+	}
+	if explain := getenv("SLOW_QUERY_EXPLAIN"); explain != "" {
+		enabled, err := strconv.ParseBool(explain)
+		if err != nil {
+			return fmt.Errorf("invalid SLOW_QUERY_EXPLAIN: %v", err)
+		}
+		c.SlowQueryExplain = enabled
+	}
+
+	// Bind parameter logging
+	if logParams := getenv("LOG_BIND_PARAMS"); logParams != "" {
+		enabled, err := strconv.ParseBool(logParams)
+		if err != nil {
+			return fmt.Errorf("invalid LOG_BIND_PARAMS: %v", err)
+		}
+		c.LogBindParams = enabled
+	}
+	if redaction := getenv("BIND_PARAM_REDACTION"); redaction != "" {
+		c.BindParamRedaction = strings.ToLower(redaction)
+	}
+
+	// Empty query handling
+	if mode := getenv("EMPTY_QUERY_MODE"); mode != "" {
+		c.EmptyQueryMode = strings.ToLower(mode)
+	}
+
+	// Maximum query payload size
+	if maxPacket := getenv("MAX_ALLOWED_PACKET"); maxPacket != "" {
+		n, err := strconv.Atoi(maxPacket)
+		if err != nil {
+			return fmt.Errorf("invalid MAX_ALLOWED_PACKET: %v", err)
+		}
+		c.MaxAllowedPacket = n
+	}
+
+	// SQLite page cache and memory-map sizes
+	if cacheSize := getenv("SQLITE_CACHE_SIZE"); cacheSize != "" {
+		n, err := strconv.Atoi(cacheSize)
+		if err != nil {
+			return fmt.Errorf("invalid SQLITE_CACHE_SIZE: %v", err)
+		}
+		c.SQLiteCacheSize = n
+	}
+	if mmapSize := getenv("SQLITE_MMAP_SIZE"); mmapSize != "" {
+		n, err := strconv.Atoi(mmapSize)
+		if err != nil {
+			return fmt.Errorf("invalid SQLITE_MMAP_SIZE: %v", err)
+		}
+		c.SQLiteMmapSize = n
+	}
+	if overrides := getenv("TENANT_SQLITE_CACHE_SIZE"); overrides != "" {
+		parsed, err := ParseTenantLimits(overrides)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_SQLITE_CACHE_SIZE: %v", err)
+		}
+		c.TenantSQLiteCacheSize = parsed
+	}
+	if overrides := getenv("TENANT_SQLITE_MMAP_SIZE"); overrides != "" {
+		parsed, err := ParseTenantLimits(overrides)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_SQLITE_MMAP_SIZE: %v", err)
+		}
+		c.TenantSQLiteMmapSize = parsed
+	}
+
+	// Sample data volume
+	if rows := getenv("SAMPLE_DATA_ROWS"); rows != "" {
+		n, err := strconv.Atoi(rows)
+		if err != nil {
+			return fmt.Errorf("invalid SAMPLE_DATA_ROWS: %v", err)
+		}
+		c.SampleDataRows = n
+	}
+
+	// Audit trail of administrative actions
+	if auditLog := getenv("AUDIT_LOG"); auditLog != "" {
+		c.AuditLog = auditLog
+	}
+
+	// Strict tenant mode
+	if autocreate := getenv("AUTOCREATE_TENANTS"); autocreate != "" {
+		enabled, err := strconv.ParseBool(autocreate)
+		if err != nil {
+			return fmt.Errorf("invalid AUTOCREATE_TENANTS: %v", err)
+		}
+		c.AutocreateTenants = enabled
+	}
+
+	// Tenant resolution
+	if resolvers := getenv("TENANT_RESOLVERS"); resolvers != "" {
+		c.TenantResolvers = ParseIdxList(strings.ToLower(resolvers))
+	}
+	if defaultTenant := getenv("DEFAULT_TENANT"); defaultTenant != "" {
+		c.DefaultTenant = defaultTenant
+	}
+	if access := getenv("TENANT_USER_ACCESS"); access != "" {
+		parsed, err := ParseTenantUserAccess(access)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_USER_ACCESS: %v", err)
+		}
+		c.TenantUserAccess = parsed
+	}
+
+	// Query log storage
+	if logDir := getenv("QUERY_LOG_DIR"); logDir != "" {
+		c.QueryLogDir = logDir
+	}
+	if levels := getenv("QUERY_LOG_SHARD_LEVELS"); levels != "" {
+		n, err := strconv.Atoi(levels)
+		if err != nil {
+			return fmt.Errorf("invalid QUERY_LOG_SHARD_LEVELS: %v", err)
+		}
+		c.QueryLogShardLevels = n
+	}
+	if colocate := getenv("QUERY_LOG_COLOCATE"); colocate != "" {
+		enabled, err := strconv.ParseBool(colocate)
+		if err != nil {
+			return fmt.Errorf("invalid QUERY_LOG_COLOCATE: %v", err)
+		}
+		c.QueryLogColocate = enabled
+	}
+
+	// Query log mirroring
+	if mirror := getenv("QUERY_LOG_TO_STDOUT"); mirror != "" {
+		enabled, err := strconv.ParseBool(mirror)
+		if err != nil {
+			return fmt.Errorf("invalid QUERY_LOG_TO_STDOUT: %v", err)
+		}
+		c.QueryLogToStdout = enabled
+	}
+
+	if skip := getenv("QUERY_LOG_SKIP_SESSION"); skip != "" {
+		enabled, err := strconv.ParseBool(skip)
+		if err != nil {
+			return fmt.Errorf("invalid QUERY_LOG_SKIP_SESSION: %v", err)
+		}
+		c.QueryLogSkipSession = enabled
+	}
+
+	// Table name case handling
+	if lowerCase := getenv("LOWER_CASE_TABLE_NAMES"); lowerCase != "" {
+		enabled, err := strconv.ParseBool(lowerCase)
+		if err != nil {
+			return fmt.Errorf("invalid LOWER_CASE_TABLE_NAMES: %v", err)
+		}
+		c.LowerCaseTableNames = enabled
+	}
+
+	// MySQL compatibility rewrites
+	if compat := getenv("MYSQL_COMPAT"); compat != "" {
+		enabled, err := strconv.ParseBool(compat)
+		if err != nil {
+			return fmt.Errorf("invalid MYSQL_COMPAT: %v", err)
+		}
+		c.MySQLCompat = enabled
+	}
+
+	// Destructive statement blocking
+	if block := getenv("BLOCK_DESTRUCTIVE"); block != "" {
+		enabled, err := strconv.ParseBool(block)
+		if err != nil {
+			return fmt.Errorf("invalid BLOCK_DESTRUCTIVE: %v", err)
+		}
+		c.BlockDestructive = enabled
+	}
+	if exempt := getenv("BLOCK_DESTRUCTIVE_EXEMPT"); exempt != "" {
+		c.BlockDestructiveExempt = ParseIdxList(exempt)
+	}
+
+	// Per-tenant connection affinity
+	if affinity := getenv("TENANT_CONNECTION_AFFINITY"); affinity != "" {
+		enabled, err := strconv.ParseBool(affinity)
+		if err != nil {
+			return fmt.Errorf("invalid TENANT_CONNECTION_AFFINITY: %v", err)
+		}
+		c.TenantConnectionAffinity = enabled
+	}
+
+	// Orphaned session collection
+	if interval := getenv("SESSION_GC_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("invalid SESSION_GC_INTERVAL: %v", err)
+		}
+		c.SessionGCInterval = d
+	}
+
+	// Connection draining on shutdown
+	if grace := getenv("SHUTDOWN_GRACE_TIMEOUT"); grace != "" {
+		d, err := time.ParseDuration(grace)
+		if err != nil {
+			return fmt.Errorf("invalid SHUTDOWN_GRACE_TIMEOUT: %v", err)
+		}
+		c.ShutdownGraceTimeout = d
+	}
+
+	// Session time zone
+	if timeZone := getenv("DEFAULT_TIME_ZONE"); timeZone != "" {
+		c.DefaultTimeZone = timeZone
+	}
+
 	// Authentication Configuration
-	if username := os.Getenv("AUTH_USERNAME"); username != "" {
+	if username := getenv("AUTH_USERNAME"); username != "" {
 		c.Auth = &AuthConfig{
 			Username: username,
-			Password: os.Getenv("AUTH_PASSWORD"),
+			Password: getenv("AUTH_PASSWORD"),
 		}
-	} else if os.Getenv("AUTH_PASSWORD") != "" {
+	} else if getenv("AUTH_PASSWORD") != "" {
 		// If only password is provided, use default username
 		c.Auth = &AuthConfig{
 			Username: "root",
-			Password: os.Getenv("AUTH_PASSWORD"),
+			Password: getenv("AUTH_PASSWORD"),
 		}
 	}
 
 	// Default Database Configuration
-	if dbType := os.Getenv("DEFAULT_DB_TYPE"); dbType != "" {
+	if dbType := getenv("DEFAULT_DB_TYPE"); dbType != "" {
 		c.DefaultDatabase = &DefaultDatabaseConfig{
 			Type: DatabaseType(strings.ToLower(dbType)),
 		}
 
 		switch c.DefaultDatabase.Type {
 		case DatabaseTypeSQLite:
-			if path := os.Getenv("DEFAULT_DB_SQLITE_PATH"); path != "" {
+			if path := getenv("DEFAULT_DB_SQLITE_PATH"); path != "" {
 				c.DefaultDatabase.SQLitePath = path
 				c.DefaultDatabase.ConnectionString = path
 			} else {
@@ -104,24 +580,47 @@ func (c *Config) LoadFromEnv() error {
 
 		case DatabaseTypeMySQL:
 			// Load MySQL configuration from environment
-			host := os.Getenv("DEFAULT_DB_MYSQL_HOST")
+			host := getenv("DEFAULT_DB_MYSQL_HOST")
 			if host == "" {
 				host = "localhost"
 			}
 			c.DefaultDatabase.MySQLHost = host
 
 			port := 3306
-			if portStr := os.Getenv("DEFAULT_DB_MYSQL_PORT"); portStr != "" {
+			if portStr := getenv("DEFAULT_DB_MYSQL_PORT"); portStr != "" {
 				if p, err := strconv.Atoi(portStr); err == nil {
 					port = p
 				}
 			}
 			c.DefaultDatabase.MySQLPort = port
 
-			c.DefaultDatabase.MySQLUser = os.Getenv("DEFAULT_DB_MYSQL_USER")
-			c.DefaultDatabase.MySQLPassword = os.Getenv("DEFAULT_DB_MYSQL_PASSWORD")
-			c.DefaultDatabase.MySQLDatabase = os.Getenv("DEFAULT_DB_MYSQL_DATABASE")
-			c.DefaultDatabase.MySQLSSLMode = os.Getenv("DEFAULT_DB_MYSQL_SSL_MODE")
+			c.DefaultDatabase.MySQLUser = getenv("DEFAULT_DB_MYSQL_USER")
+			c.DefaultDatabase.MySQLPassword = getenv("DEFAULT_DB_MYSQL_PASSWORD")
+			c.DefaultDatabase.MySQLDatabase = getenv("DEFAULT_DB_MYSQL_DATABASE")
+			c.DefaultDatabase.MySQLSSLMode = getenv("DEFAULT_DB_MYSQL_SSL_MODE")
+
+			// Connection pool
+			if maxOpen := getenv("DEFAULT_DB_MYSQL_MAX_OPEN_CONNS"); maxOpen != "" {
+				n, err := strconv.Atoi(maxOpen)
+				if err != nil {
+					return fmt.Errorf("invalid DEFAULT_DB_MYSQL_MAX_OPEN_CONNS: %v", err)
+				}
+				c.DefaultDatabase.MySQLMaxOpenConns = n
+			}
+			if maxIdle := getenv("DEFAULT_DB_MYSQL_MAX_IDLE_CONNS"); maxIdle != "" {
+				n, err := strconv.Atoi(maxIdle)
+				if err != nil {
+					return fmt.Errorf("invalid DEFAULT_DB_MYSQL_MAX_IDLE_CONNS: %v", err)
+				}
+				c.DefaultDatabase.MySQLMaxIdleConns = n
+			}
+			if lifetime := getenv("DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME"); lifetime != "" {
+				d, err := time.ParseDuration(lifetime)
+				if err != nil {
+					return fmt.Errorf("invalid DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME: %v", err)
+				}
+				c.DefaultDatabase.MySQLConnMaxLifetime = d
+			}
 
 			// Build connection string
 			connStr, err := c.DefaultDatabase.BuildMySQLConnectionString()
@@ -136,7 +635,7 @@ func (c *Config) LoadFromEnv() error {
 	}
 
 	// Also support direct connection string override
-	if connStr := os.Getenv("DEFAULT_DB_CONNECTION_STRING"); connStr != "" {
+	if connStr := getenv("DEFAULT_DB_CONNECTION_STRING"); connStr != "" {
 		if c.DefaultDatabase == nil {
 			c.DefaultDatabase = &DefaultDatabaseConfig{}
 		}
@@ -153,6 +652,259 @@ func (c *Config) LoadFromEnv() error {
 	return nil
 }
 
+// ParseTenantLimits parses per-tenant limits in the form "idx1=100,idx2=500"
+func ParseTenantLimits(value string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("expected idx=limit, got %q", entry)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid limit for idx %s: %v", strings.TrimSpace(parts[0]), err)
+		}
+		limits[strings.TrimSpace(parts[0])] = n
+	}
+	return limits, nil
+}
+
+// ParseTenantUserAccess parses the tenants each user may select in the form
+// "user1=idx1|idx2,user2=*"
+func ParseTenantUserAccess(value string) (map[string][]string, error) {
+	access := make(map[string][]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("expected user=idx1|idx2, got %q", entry)
+		}
+		user := strings.TrimSpace(parts[0])
+		access[user] = append(access[user], ParseIdxList(strings.ReplaceAll(parts[1], "|", ","))...)
+	}
+	return access, nil
+}
+
+// ParseIdxList parses a comma-separated list of tenant idx values such as "idx1, idx2"
+func ParseIdxList(value string) []string {
+	var list []string
+	for _, idx := range strings.Split(value, ",") {
+		if idx = strings.TrimSpace(idx); idx != "" {
+			list = append(list, idx)
+		}
+	}
+	return list
+}
+
+// MaxIdxLength is the longest idx accepted, which keeps multitenant_db_idx_<idx> within MySQL's
+// 64-character limit on database names
+const MaxIdxLength = 64 - len("multitenant_db_idx_")
+
+// IdxPattern matches the characters an idx may contain: letters, digits, _, - and .
+const IdxPattern = `[\w.-]+`
+
+// idxRegex matches a whole idx
+var idxRegex = regexp.MustCompile(`^` + IdxPattern + `$`)
+
+// CheckIdx describes what makes idx unusable as a tenant ID, such as "is required", or returns
+// "" when it is well formed. The HTTP API, SET @idx and tenant hints all apply it.
+func CheckIdx(idx string) string {
+	switch {
+	case idx == "":
+		return "is required"
+	case len(idx) > MaxIdxLength:
+		return fmt.Sprintf("must be at most %d characters", MaxIdxLength)
+	case !idxRegex.MatchString(idx):
+		return "may only contain letters, digits, _, - and ."
+	}
+	return ""
+}
+
+// timeZoneOffsetRegex matches a time zone given as an offset from UTC, such as +05:30
+var timeZoneOffsetRegex = regexp.MustCompile(`^([+-])(\d{1,2}):(\d{2})$`)
+
+// LoadTimeZone resolves a MySQL time_zone value: SYSTEM for the server's zone, an offset such
+// as -08:00, or a named zone such as Europe/Paris
+func LoadTimeZone(name string) (*time.Location, error) {
+	if strings.EqualFold(name, "SYSTEM") {
+		return time.Local, nil
+	}
+	if matches := timeZoneOffsetRegex.FindStringSubmatch(name); matches != nil {
+		hours, _ := strconv.Atoi(matches[2])
+		minutes, _ := strconv.Atoi(matches[3])
+		offset := hours*3600 + minutes*60
+		if matches[1] == "-" {
+			offset = -offset
+		}
+		// MySQL accepts offsets from -13:59 to +14:00
+		if minutes < 60 && offset >= -(13*3600+59*60) && offset <= 14*3600 {
+			return time.FixedZone(name, offset), nil
+		}
+	} else if name != "" && !strings.EqualFold(name, "Local") {
+		if location, err := time.LoadLocation(name); err == nil {
+			return location, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown or incorrect time zone: %q", name)
+}
+
+// UserMayUseTenant reports whether user may select idx through the idx connection attribute or
+// a username prefix. Every login may when TenantUserAccess is empty.
+func (c *Config) UserMayUseTenant(user, idx string) bool {
+	if len(c.TenantUserAccess) == 0 {
+		return true
+	}
+	for _, allowed := range c.TenantUserAccess[user] {
+		if allowed == "*" || allowed == idx {
+			return true
+		}
+	}
+	return false
+}
+
+// MayUseAnyTenant reports whether user has "*" access in TenantUserAccess, which makes it an
+// administrator that may act on the connections of every tenant. No user does while
+// TenantUserAccess is empty.
+func (c *Config) MayUseAnyTenant(user string) bool {
+	return slices.Contains(c.TenantUserAccess[user], "*")
+}
+
+// MaxResultRowsFor returns the row cap for a tenant, honoring per-tenant overrides
+func (c *Config) MaxResultRowsFor(idx string) int {
+	if limit, ok := c.TenantMaxResultRows[idx]; ok {
+		return limit
+	}
+	return c.MaxResultRows
+}
+
+// BlocksDestructive reports whether destructive statements are rejected for a tenant: blocking
+// is enabled and idx is not exempt
+func (c *Config) BlocksDestructive(idx string) bool {
+	if !c.BlockDestructive {
+		return false
+	}
+	if idx == "" {
+		idx = "default"
+	}
+	for _, exempt := range c.BlockDestructiveExempt {
+		if exempt == idx {
+			return false
+		}
+	}
+	return true
+}
+
+// SQLiteCacheSizeFor returns the PRAGMA cache_size for a tenant, honoring per-tenant overrides
+func (c *Config) SQLiteCacheSizeFor(idx string) int {
+	if size, ok := c.TenantSQLiteCacheSize[idx]; ok {
+		return size
+	}
+	return c.SQLiteCacheSize
+}
+
+// SQLiteMmapSizeFor returns the PRAGMA mmap_size for a tenant, honoring per-tenant overrides
+func (c *Config) SQLiteMmapSizeFor(idx string) int {
+	if size, ok := c.TenantSQLiteMmapSize[idx]; ok {
+		return size
+	}
+	return c.SQLiteMmapSize
+}
+
+// ApplyReloadable copies the settings that are safe to change while the server is running
+// from other into c and returns a description of each one that changed. Ports, the default
+// database, authentication and eviction settings are fixed at startup and left untouched.
+func (c *Config) ApplyReloadable(other *Config) []string {
+	var changes []string
+	if c.MaxResultRows != other.MaxResultRows {
+		changes = append(changes, fmt.Sprintf("max_result_rows: %d -> %d", c.MaxResultRows, other.MaxResultRows))
+		c.MaxResultRows = other.MaxResultRows
+	}
+	if !reflect.DeepEqual(c.TenantMaxResultRows, other.TenantMaxResultRows) {
+		changes = append(changes, fmt.Sprintf("tenant_max_result_rows: %v -> %v", c.TenantMaxResultRows, other.TenantMaxResultRows))
+		c.TenantMaxResultRows = other.TenantMaxResultRows
+	}
+	if c.LowerCaseTableNames != other.LowerCaseTableNames {
+		changes = append(changes, fmt.Sprintf("lower_case_table_names: %t -> %t", c.LowerCaseTableNames, other.LowerCaseTableNames))
+		c.LowerCaseTableNames = other.LowerCaseTableNames
+	}
+	if c.MySQLCompat != other.MySQLCompat {
+		changes = append(changes, fmt.Sprintf("mysql_compat: %t -> %t", c.MySQLCompat, other.MySQLCompat))
+		c.MySQLCompat = other.MySQLCompat
+	}
+	if c.BlockDestructive != other.BlockDestructive {
+		changes = append(changes, fmt.Sprintf("block_destructive: %t -> %t", c.BlockDestructive, other.BlockDestructive))
+		c.BlockDestructive = other.BlockDestructive
+	}
+	if !reflect.DeepEqual(c.BlockDestructiveExempt, other.BlockDestructiveExempt) {
+		changes = append(changes, fmt.Sprintf("block_destructive_exempt: %v -> %v", c.BlockDestructiveExempt, other.BlockDestructiveExempt))
+		c.BlockDestructiveExempt = other.BlockDestructiveExempt
+	}
+	if c.StatementTimeout != other.StatementTimeout {
+		changes = append(changes, fmt.Sprintf("statement_timeout: %v -> %v", c.StatementTimeout, other.StatementTimeout))
+		c.StatementTimeout = other.StatementTimeout
+	}
+	if c.SlowQueryThreshold != other.SlowQueryThreshold {
+		changes = append(changes, fmt.Sprintf("slow_query_threshold: %v -> %v", c.SlowQueryThreshold, other.SlowQueryThreshold))
+		c.SlowQueryThreshold = other.SlowQueryThreshold
+	}
+	if c.SlowQueryExplain != other.SlowQueryExplain {
+		changes = append(changes, fmt.Sprintf("slow_query_explain: %t -> %t", c.SlowQueryExplain, other.SlowQueryExplain))
+		c.SlowQueryExplain = other.SlowQueryExplain
+	}
+	if c.LogBindParams != other.LogBindParams {
+		changes = append(changes, fmt.Sprintf("log_bind_params: %t -> %t", c.LogBindParams, other.LogBindParams))
+		c.LogBindParams = other.LogBindParams
+	}
+	if c.QueryLogSkipSession != other.QueryLogSkipSession {
+		changes = append(changes, fmt.Sprintf("query_log_skip_session: %t -> %t", c.QueryLogSkipSession, other.QueryLogSkipSession))
+		c.QueryLogSkipSession = other.QueryLogSkipSession
+	}
+	if c.BindParamRedaction != other.BindParamRedaction {
+		changes = append(changes, fmt.Sprintf("bind_param_redaction: %q -> %q", c.BindParamRedaction, other.BindParamRedaction))
+		c.BindParamRedaction = other.BindParamRedaction
+	}
+	if c.MaxAllowedPacket != other.MaxAllowedPacket {
+		changes = append(changes, fmt.Sprintf("max_allowed_packet: %d -> %d", c.MaxAllowedPacket, other.MaxAllowedPacket))
+		c.MaxAllowedPacket = other.MaxAllowedPacket
+	}
+	if c.EmptyQueryMode != other.EmptyQueryMode {
+		changes = append(changes, fmt.Sprintf("empty_query_mode: %q -> %q", c.EmptyQueryMode, other.EmptyQueryMode))
+		c.EmptyQueryMode = other.EmptyQueryMode
+	}
+	return changes
+}
+
+// redactedSecret replaces passwords in Redacted output
+const redactedSecret = "****"
+
+// Redacted returns a copy of the configuration with passwords masked, safe to print or log
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	if c.DefaultDatabase != nil {
+		dbc := *c.DefaultDatabase
+		if dbc.MySQLPassword != "" {
+			dbc.ConnectionString = strings.ReplaceAll(dbc.ConnectionString, ":"+dbc.MySQLPassword+"@", ":"+redactedSecret+"@")
+			dbc.MySQLPassword = redactedSecret
+		}
+		redacted.DefaultDatabase = &dbc
+	}
+	if c.Auth != nil {
+		auth := *c.Auth
+		if auth.Password != "" {
+			auth.Password = redactedSecret
+		}
+		redacted.Auth = &auth
+	}
+	return &redacted
+}
+
 // BuildMySQLConnectionString builds a MySQL connection string from the configuration
 func (dbc *DefaultDatabaseConfig) BuildMySQLConnectionString() (string, error) {
 	if dbc.Type != DatabaseTypeMySQL {
@@ -220,6 +972,121 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid MySQL port: %d", c.MySQLPort)
 	}
 
+	if c.TenantIdleTimeout < 0 {
+		return fmt.Errorf("invalid tenant idle timeout: %v", c.TenantIdleTimeout)
+	}
+
+	if c.TenantTTL < 0 {
+		return fmt.Errorf("invalid tenant TTL: %v", c.TenantTTL)
+	}
+
+	if c.MaxTenantDatabases < 0 {
+		return fmt.Errorf("invalid max tenant databases: %d", c.MaxTenantDatabases)
+	}
+
+	if c.MaxQueryLogDatabases < 0 {
+		return fmt.Errorf("invalid max query log databases: %d", c.MaxQueryLogDatabases)
+	}
+
+	// Each level is up to 256 directories, so a few levels cover any number of tenants
+	if c.QueryLogShardLevels < 0 || c.QueryLogShardLevels > MaxQueryLogShardLevels {
+		return fmt.Errorf("invalid query log shard levels: %d (must be between 0 and %d)", c.QueryLogShardLevels, MaxQueryLogShardLevels)
+	}
+
+	if c.SessionGCInterval < 0 {
+		return fmt.Errorf("invalid session GC interval: %v", c.SessionGCInterval)
+	}
+
+	if c.ShutdownGraceTimeout < 0 {
+		return fmt.Errorf("invalid shutdown grace timeout: %v", c.ShutdownGraceTimeout)
+	}
+
+	switch c.TenantLimitMode {
+	case "", TenantLimitModeReject, TenantLimitModeEvict:
+	default:
+		return fmt.Errorf("invalid tenant limit mode: %s", c.TenantLimitMode)
+	}
+
+	seenResolvers := make(map[string]bool, len(c.TenantResolvers))
+	for _, resolver := range c.TenantResolvers {
+		switch resolver {
+		case TenantResolverVariable, TenantResolverAttribute, TenantResolverUsername:
+		default:
+			return fmt.Errorf("invalid tenant resolver: %s", resolver)
+		}
+		if seenResolvers[resolver] {
+			return fmt.Errorf("duplicate tenant resolver: %s", resolver)
+		}
+		seenResolvers[resolver] = true
+	}
+	for user, tenants := range c.TenantUserAccess {
+		if user == "" {
+			return fmt.Errorf("invalid tenant user access: empty user")
+		}
+		if len(tenants) == 0 {
+			return fmt.Errorf("invalid tenant user access for user %s: no tenants", user)
+		}
+	}
+
+	if c.StatementTimeout < 0 {
+		return fmt.Errorf("invalid statement timeout: %v", c.StatementTimeout)
+	}
+
+	if c.SlowQueryThreshold < 0 {
+		return fmt.Errorf("invalid slow query threshold: %v", c.SlowQueryThreshold)
+	}
+
+	switch c.BindParamRedaction {
+	case "", BindParamRedactionNone, BindParamRedactionRedact, BindParamRedactionHash:
+	default:
+		return fmt.Errorf("invalid bind parameter redaction mode: %s", c.BindParamRedaction)
+	}
+
+	switch c.EmptyQueryMode {
+	case "", EmptyQueryModeOK, EmptyQueryModeError:
+	default:
+		return fmt.Errorf("invalid empty query mode: %s", c.EmptyQueryMode)
+	}
+
+	// Same bounds MySQL enforces for max_allowed_packet
+	if c.MaxAllowedPacket != 0 && (c.MaxAllowedPacket < 1024 || c.MaxAllowedPacket > 1<<30) {
+		return fmt.Errorf("invalid max allowed packet: %d (must be between 1024 and 1073741824)", c.MaxAllowedPacket)
+	}
+
+	if c.MaxResultRows < 0 {
+		return fmt.Errorf("invalid max result rows: %d", c.MaxResultRows)
+	}
+	for idx, limit := range c.TenantMaxResultRows {
+		if limit < 0 {
+			return fmt.Errorf("invalid max result rows for idx %s: %d", idx, limit)
+		}
+	}
+
+	if c.SQLiteMmapSize < 0 {
+		return fmt.Errorf("invalid SQLite mmap size: %d", c.SQLiteMmapSize)
+	}
+	for idx, size := range c.TenantSQLiteMmapSize {
+		if size < 0 {
+			return fmt.Errorf("invalid SQLite mmap size for idx %s: %d", idx, size)
+		}
+	}
+
+	if c.SampleDataRows < 0 {
+		return fmt.Errorf("invalid sample data rows: %d", c.SampleDataRows)
+	}
+
+	if c.DefaultTimeZone != "" {
+		if _, err := LoadTimeZone(c.DefaultTimeZone); err != nil {
+			return fmt.Errorf("invalid default time zone: %v", err)
+		}
+	}
+
+	if c.EvictionWebhookURL != "" {
+		if u, err := url.Parse(c.EvictionWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return fmt.Errorf("invalid eviction webhook URL: %s", c.EvictionWebhookURL)
+		}
+	}
+
 	if c.DefaultDatabase != nil {
 		if err := c.DefaultDatabase.Validate(); err != nil {
 			return fmt.Errorf("invalid default database configuration: %v", err)
@@ -252,6 +1119,12 @@ func (dbc *DefaultDatabaseConfig) Validate() error {
 		if dbc.MySQLPort == 0 && !strings.Contains(dbc.ConnectionString, "@tcp(") {
 			dbc.MySQLPort = 3306 // Set default
 		}
+		if dbc.MySQLMaxOpenConns < 0 || dbc.MySQLMaxIdleConns < 0 || dbc.MySQLConnMaxLifetime < 0 {
+			return fmt.Errorf("MySQL connection pool settings cannot be negative")
+		}
+		if maxOpen, maxIdle, _ := dbc.PoolSettings(); maxIdle > maxOpen {
+			return fmt.Errorf("MySQL max idle connections (%d) cannot exceed max open connections (%d)", maxIdle, maxOpen)
+		}
 	default:
 		return fmt.Errorf("unsupported database type: %s", dbc.Type)
 	}
@@ -259,6 +1132,25 @@ func (dbc *DefaultDatabaseConfig) Validate() error {
 	return nil
 }
 
+// PoolSettings returns the connection pool settings of a MySQL default database, falling back
+// to the Default* pool settings for any that are not configured
+func (dbc *DefaultDatabaseConfig) PoolSettings() (maxOpen, maxIdle int, maxLifetime time.Duration) {
+	maxOpen, maxIdle, maxLifetime = dbc.MySQLMaxOpenConns, dbc.MySQLMaxIdleConns, dbc.MySQLConnMaxLifetime
+	if maxOpen == 0 {
+		maxOpen = DefaultMySQLMaxOpenConns
+	}
+	if maxIdle == 0 {
+		maxIdle = DefaultMySQLMaxIdleConns
+		if maxIdle > maxOpen {
+			maxIdle = maxOpen
+		}
+	}
+	if maxLifetime == 0 {
+		maxLifetime = DefaultMySQLConnMaxLifetime
+	}
+	return maxOpen, maxIdle, maxLifetime
+}
+
 // Validate validates the authentication configuration
 func (ac *AuthConfig) Validate() error {
 	if ac.Username == "" {
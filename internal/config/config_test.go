@@ -2,7 +2,10 @@ package config
 
 import (
 	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -426,3 +429,783 @@ func TestDefaultDatabaseConfigValidate(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadFromEnv_TenantEviction(t *testing.T) {
+	originalTimeout := os.Getenv("TENANT_IDLE_TIMEOUT")
+	originalURL := os.Getenv("EVICTION_WEBHOOK_URL")
+	defer func() {
+		os.Setenv("TENANT_IDLE_TIMEOUT", originalTimeout)
+		os.Setenv("EVICTION_WEBHOOK_URL", originalURL)
+	}()
+
+	os.Setenv("TENANT_IDLE_TIMEOUT", "15m")
+	os.Setenv("EVICTION_WEBHOOK_URL", "http://hooks.example.com/evicted")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+
+	if cfg.TenantIdleTimeout != 15*time.Minute {
+		t.Errorf("Expected tenant idle timeout 15m, got %v", cfg.TenantIdleTimeout)
+	}
+	if cfg.EvictionWebhookURL != "http://hooks.example.com/evicted" {
+		t.Errorf("Expected eviction webhook URL, got %s", cfg.EvictionWebhookURL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Config should be valid: %v", err)
+	}
+
+	os.Setenv("TENANT_IDLE_TIMEOUT", "not-a-duration")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid TENANT_IDLE_TIMEOUT")
+	}
+}
+
+func TestLoadFromEnv_MaxResultRows(t *testing.T) {
+	os.Setenv("MAX_RESULT_ROWS", "100")
+	os.Setenv("TENANT_MAX_RESULT_ROWS", "big=0, small=10")
+	defer os.Unsetenv("MAX_RESULT_ROWS")
+	defer os.Unsetenv("TENANT_MAX_RESULT_ROWS")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	expected := map[string]int{"big": 0, "small": 10, "other": 100}
+	for idx, limit := range expected {
+		if got := cfg.MaxResultRowsFor(idx); got != limit {
+			t.Errorf("Expected limit %d for idx %s, got %d", limit, idx, got)
+		}
+	}
+
+	os.Setenv("TENANT_MAX_RESULT_ROWS", "broken")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for malformed TENANT_MAX_RESULT_ROWS")
+	}
+}
+
+func TestLoadFromEnv_LowerCaseTableNames(t *testing.T) {
+	os.Setenv("LOWER_CASE_TABLE_NAMES", "1")
+	defer os.Unsetenv("LOWER_CASE_TABLE_NAMES")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !cfg.LowerCaseTableNames {
+		t.Error("Expected LowerCaseTableNames to be enabled")
+	}
+
+	os.Setenv("LOWER_CASE_TABLE_NAMES", "sometimes")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid LOWER_CASE_TABLE_NAMES")
+	}
+}
+
+func TestLoadFromEnv_StatementTimeout(t *testing.T) {
+	os.Setenv("STATEMENT_TIMEOUT_MS", "250")
+	defer os.Unsetenv("STATEMENT_TIMEOUT_MS")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.StatementTimeout != 250*time.Millisecond {
+		t.Errorf("Expected statement timeout of 250ms, got %v", cfg.StatementTimeout)
+	}
+
+	os.Setenv("STATEMENT_TIMEOUT_MS", "soon")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid STATEMENT_TIMEOUT_MS")
+	}
+}
+
+func TestLoadFromEnv_BindParamLogging(t *testing.T) {
+	cfg := NewConfig()
+	if !cfg.LogBindParams {
+		t.Error("Bind parameters should be logged by default")
+	}
+
+	os.Setenv("LOG_BIND_PARAMS", "false")
+	os.Setenv("BIND_PARAM_REDACTION", "HASH")
+	defer os.Unsetenv("LOG_BIND_PARAMS")
+	defer os.Unsetenv("BIND_PARAM_REDACTION")
+
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.LogBindParams || cfg.BindParamRedaction != BindParamRedactionHash {
+		t.Errorf("Expected logging disabled with hash redaction, got %v/%s", cfg.LogBindParams, cfg.BindParamRedaction)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate failed: %v", err)
+	}
+
+	cfg.BindParamRedaction = "scramble"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for unknown redaction mode")
+	}
+}
+
+func TestLoadFromEnv_MaxAllowedPacket(t *testing.T) {
+	cfg := NewConfig()
+	if cfg.MaxAllowedPacket != DefaultMaxAllowedPacket {
+		t.Errorf("Expected default max allowed packet %d, got %d", DefaultMaxAllowedPacket, cfg.MaxAllowedPacket)
+	}
+
+	os.Setenv("MAX_ALLOWED_PACKET", "512")
+	defer os.Unsetenv("MAX_ALLOWED_PACKET")
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for max allowed packet below 1024")
+	}
+}
+
+func TestLoadFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "multitenant-db.conf")
+	contents := "# reloadable settings\nMAX_RESULT_ROWS=50\n\nBIND_PARAM_REDACTION=\"redact\"\nHTTP_PORT=9090\n"
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	// Environment variables take precedence over the file
+	os.Setenv("HTTP_PORT", "9191")
+	defer os.Unsetenv("HTTP_PORT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromFile(path); err != nil {
+		t.Fatalf("LoadFromFile failed: %v", err)
+	}
+	if cfg.MaxResultRows != 50 || cfg.BindParamRedaction != BindParamRedactionRedact {
+		t.Errorf("Expected file settings to be applied, got %d/%s", cfg.MaxResultRows, cfg.BindParamRedaction)
+	}
+	if cfg.HTTPPort != 9191 {
+		t.Errorf("Expected HTTP port from environment (9191), got %d", cfg.HTTPPort)
+	}
+
+	if err := os.WriteFile(path, []byte("MAX_RESULT_ROWS\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if err := NewConfig().LoadFromFile(path); err == nil {
+		t.Error("Expected error for malformed config file line")
+	}
+	if err := NewConfig().LoadFromFile(filepath.Join(t.TempDir(), "missing.conf")); err == nil {
+		t.Error("Expected error for missing config file")
+	}
+}
+
+func TestApplyReloadable(t *testing.T) {
+	cfg := NewConfig()
+	cfg.MaxResultRows = 10
+
+	updated := NewConfig()
+	updated.MaxResultRows = 20
+	updated.StatementTimeout = time.Second
+	updated.HTTPPort = 9999
+	updated.Auth = &AuthConfig{Username: "admin"}
+
+	changes := cfg.ApplyReloadable(updated)
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 changes, got %v", changes)
+	}
+	if cfg.MaxResultRows != 20 || cfg.StatementTimeout != time.Second {
+		t.Errorf("Expected reloadable settings to be applied, got %d/%v", cfg.MaxResultRows, cfg.StatementTimeout)
+	}
+	if cfg.HTTPPort != 8080 || cfg.Auth != nil {
+		t.Error("Structural settings should not be reloaded")
+	}
+
+	if changes := cfg.ApplyReloadable(updated); len(changes) != 0 {
+		t.Errorf("Expected no changes on identical reload, got %v", changes)
+	}
+}
+
+func TestLoadFromEnv_SQLitePragmas(t *testing.T) {
+	cfg := NewConfig()
+	if cfg.SQLiteCacheSizeFor("any") != DefaultSQLiteCacheSize || cfg.SQLiteMmapSizeFor("any") != DefaultSQLiteMmapSize {
+		t.Error("Expected SQLite pragma defaults")
+	}
+
+	os.Setenv("SQLITE_CACHE_SIZE", "-8000")
+	os.Setenv("TENANT_SQLITE_MMAP_SIZE", "hot=268435456")
+	defer os.Unsetenv("SQLITE_CACHE_SIZE")
+	defer os.Unsetenv("TENANT_SQLITE_MMAP_SIZE")
+
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if got := cfg.SQLiteCacheSizeFor("hot"); got != -8000 {
+		t.Errorf("Expected cache size -8000, got %d", got)
+	}
+	if got := cfg.SQLiteMmapSizeFor("hot"); got != 268435456 {
+		t.Errorf("Expected mmap size override for hot tenant, got %d", got)
+	}
+	if got := cfg.SQLiteMmapSizeFor("cold"); got != 0 {
+		t.Errorf("Expected default mmap size for other tenants, got %d", got)
+	}
+
+	cfg.TenantSQLiteMmapSize["hot"] = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected validation error for negative mmap size")
+	}
+}
+
+func TestLoadFromEnv_ServiceInfo(t *testing.T) {
+	os.Setenv("SERVICE_NAME", "Acme Tenant DB")
+	os.Setenv("SERVICE_DESCRIPTION", "Acme's staging database")
+	defer os.Unsetenv("SERVICE_NAME")
+	defer os.Unsetenv("SERVICE_DESCRIPTION")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.ServiceName != "Acme Tenant DB" || cfg.ServiceDescription != "Acme's staging database" {
+		t.Errorf("Expected service info from environment, got %q / %q", cfg.ServiceName, cfg.ServiceDescription)
+	}
+}
+
+func TestLoadFromEnv_TenantLimit(t *testing.T) {
+	os.Setenv("MAX_TENANT_DATABASES", "50")
+	os.Setenv("TENANT_LIMIT_MODE", "Evict")
+	defer os.Unsetenv("MAX_TENANT_DATABASES")
+	defer os.Unsetenv("TENANT_LIMIT_MODE")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.MaxTenantDatabases != 50 {
+		t.Errorf("Expected max tenant databases 50, got %d", cfg.MaxTenantDatabases)
+	}
+	if cfg.TenantLimitMode != TenantLimitModeEvict {
+		t.Errorf("Expected tenant limit mode %q, got %q", TenantLimitModeEvict, cfg.TenantLimitMode)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Config should be valid: %v", err)
+	}
+
+	cfg.TenantLimitMode = "drop"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for unknown tenant limit mode")
+	}
+
+	os.Setenv("MAX_TENANT_DATABASES", "many")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid MAX_TENANT_DATABASES")
+	}
+}
+
+func TestLoadFromEnv_TenantTTL(t *testing.T) {
+	os.Setenv("TENANT_TTL", "24h")
+	defer os.Unsetenv("TENANT_TTL")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.TenantTTL != 24*time.Hour {
+		t.Errorf("Expected tenant TTL 24h, got %v", cfg.TenantTTL)
+	}
+
+	cfg.TenantTTL = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative tenant TTL")
+	}
+
+	os.Setenv("TENANT_TTL", "forever")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid TENANT_TTL")
+	}
+}
+
+func TestLoadFromEnv_APIDebug(t *testing.T) {
+	os.Setenv("API_DEBUG", "true")
+	defer os.Unsetenv("API_DEBUG")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !cfg.APIDebug {
+		t.Error("Expected API debugging to be enabled")
+	}
+
+	os.Setenv("API_DEBUG", "sometimes")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid API_DEBUG")
+	}
+}
+
+func TestConfig_Redacted(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DefaultDatabase = &DefaultDatabaseConfig{
+		Type:             DatabaseTypeMySQL,
+		ConnectionString: "app:s3cret@tcp(db:3306)/app",
+		MySQLUser:        "app",
+		MySQLPassword:    "s3cret",
+	}
+	cfg.Auth = &AuthConfig{Username: "root", Password: "hunter2"}
+
+	redacted := cfg.Redacted()
+	if redacted.DefaultDatabase.MySQLPassword != "****" || redacted.Auth.Password != "****" {
+		t.Errorf("Expected passwords to be masked, got %q and %q", redacted.DefaultDatabase.MySQLPassword, redacted.Auth.Password)
+	}
+	if redacted.DefaultDatabase.ConnectionString != "app:****@tcp(db:3306)/app" {
+		t.Errorf("Expected password masked in connection string, got %q", redacted.DefaultDatabase.ConnectionString)
+	}
+	if cfg.DefaultDatabase.MySQLPassword != "s3cret" || cfg.Auth.Password != "hunter2" {
+		t.Error("Redacted should not modify the original configuration")
+	}
+}
+
+func TestLoadFromEnv_SampleDataRows(t *testing.T) {
+	if rows := NewConfig().SampleDataRows; rows != DefaultSampleDataRows {
+		t.Errorf("Expected %d sample rows by default, got %d", DefaultSampleDataRows, rows)
+	}
+
+	os.Setenv("SAMPLE_DATA_ROWS", "1000")
+	defer os.Unsetenv("SAMPLE_DATA_ROWS")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.SampleDataRows != 1000 {
+		t.Errorf("Expected 1000 sample rows, got %d", cfg.SampleDataRows)
+	}
+
+	cfg.SampleDataRows = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for negative sample data rows")
+	}
+
+	os.Setenv("SAMPLE_DATA_ROWS", "lots")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid SAMPLE_DATA_ROWS")
+	}
+}
+
+func TestLoadFromEnv_AuditLog(t *testing.T) {
+	if sink := NewConfig().AuditLog; sink != "" {
+		t.Errorf("Expected auditing to be off by default, got %q", sink)
+	}
+
+	os.Setenv("AUDIT_LOG", "/var/log/multitenant-db/audit.log")
+	defer os.Unsetenv("AUDIT_LOG")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.AuditLog != "/var/log/multitenant-db/audit.log" {
+		t.Errorf("Expected audit log path from AUDIT_LOG, got %q", cfg.AuditLog)
+	}
+}
+
+func TestLoadFromEnv_EmptyQueryMode(t *testing.T) {
+	os.Setenv("EMPTY_QUERY_MODE", "ERROR")
+	defer os.Unsetenv("EMPTY_QUERY_MODE")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.EmptyQueryMode != EmptyQueryModeError {
+		t.Errorf("Expected empty query mode %q, got %q", EmptyQueryModeError, cfg.EmptyQueryMode)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected error mode to validate, got %v", err)
+	}
+
+	cfg.EmptyQueryMode = "ignore"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an invalid empty query mode")
+	}
+}
+
+func TestLoadFromEnv_MySQLPoolSettings(t *testing.T) {
+	for _, key := range []string{"DEFAULT_DB_TYPE", "DEFAULT_DB_MYSQL_USER", "DEFAULT_DB_MYSQL_MAX_OPEN_CONNS", "DEFAULT_DB_MYSQL_MAX_IDLE_CONNS", "DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME"} {
+		defer os.Unsetenv(key)
+	}
+	os.Setenv("DEFAULT_DB_TYPE", "mysql")
+	os.Setenv("DEFAULT_DB_MYSQL_USER", "app")
+
+	// Unset pool settings fall back to the defaults
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	maxOpen, maxIdle, maxLifetime := cfg.DefaultDatabase.PoolSettings()
+	if maxOpen != DefaultMySQLMaxOpenConns || maxIdle != DefaultMySQLMaxIdleConns || maxLifetime != DefaultMySQLConnMaxLifetime {
+		t.Errorf("Expected default pool settings, got %d/%d/%v", maxOpen, maxIdle, maxLifetime)
+	}
+
+	os.Setenv("DEFAULT_DB_MYSQL_MAX_OPEN_CONNS", "50")
+	os.Setenv("DEFAULT_DB_MYSQL_MAX_IDLE_CONNS", "25")
+	os.Setenv("DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME", "90s")
+	cfg = NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	maxOpen, maxIdle, maxLifetime = cfg.DefaultDatabase.PoolSettings()
+	if maxOpen != 50 || maxIdle != 25 || maxLifetime != 90*time.Second {
+		t.Errorf("Expected pool settings 50/25/90s, got %d/%d/%v", maxOpen, maxIdle, maxLifetime)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected pool settings to validate, got %v", err)
+	}
+
+	// A small open limit caps the default idle count
+	small := &DefaultDatabaseConfig{Type: DatabaseTypeMySQL, MySQLMaxOpenConns: 4}
+	if _, maxIdle, _ := small.PoolSettings(); maxIdle != 4 {
+		t.Errorf("Expected idle connections capped at 4, got %d", maxIdle)
+	}
+
+	cfg.DefaultDatabase.MySQLMaxIdleConns = 60
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for more idle than open connections")
+	}
+	cfg.DefaultDatabase.MySQLMaxIdleConns = 0
+	cfg.DefaultDatabase.MySQLConnMaxLifetime = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative connection lifetime")
+	}
+
+	os.Setenv("DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME", "forever")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid DEFAULT_DB_MYSQL_CONN_MAX_LIFETIME")
+	}
+}
+
+func TestLoadFromEnv_MaxQueryLogDatabases(t *testing.T) {
+	os.Setenv("MAX_QUERY_LOG_DATABASES", "25")
+	defer os.Unsetenv("MAX_QUERY_LOG_DATABASES")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.MaxQueryLogDatabases != 25 {
+		t.Errorf("Expected max query log databases 25, got %d", cfg.MaxQueryLogDatabases)
+	}
+
+	cfg.MaxQueryLogDatabases = -1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative max query log databases")
+	}
+
+	os.Setenv("MAX_QUERY_LOG_DATABASES", "lots")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for a non-numeric MAX_QUERY_LOG_DATABASES")
+	}
+}
+
+func TestLoadFromEnv_DefaultTimeZone(t *testing.T) {
+	os.Setenv("DEFAULT_TIME_ZONE", "+05:30")
+	defer os.Unsetenv("DEFAULT_TIME_ZONE")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.DefaultTimeZone != "+05:30" {
+		t.Errorf("Expected default time zone +05:30, got %s", cfg.DefaultTimeZone)
+	}
+
+	for _, name := range []string{"SYSTEM", "-08:00", "UTC", "Europe/Paris"} {
+		cfg.DefaultTimeZone = name
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("Expected time zone %s to be valid: %v", name, err)
+		}
+	}
+	for _, name := range []string{"+15:00", "+05:75", "Not/AZone", "Local"} {
+		cfg.DefaultTimeZone = name
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected error for time zone %s", name)
+		}
+	}
+}
+
+func TestLoadFromEnv_SessionGCInterval(t *testing.T) {
+	if cfg := NewConfig(); cfg.SessionGCInterval != DefaultSessionGCInterval {
+		t.Errorf("Expected default session GC interval %v, got %v", DefaultSessionGCInterval, cfg.SessionGCInterval)
+	}
+
+	os.Setenv("SESSION_GC_INTERVAL", "30s")
+	defer os.Unsetenv("SESSION_GC_INTERVAL")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.SessionGCInterval != 30*time.Second {
+		t.Errorf("Expected session GC interval 30s, got %v", cfg.SessionGCInterval)
+	}
+
+	cfg.SessionGCInterval = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative session GC interval")
+	}
+
+	os.Setenv("SESSION_GC_INTERVAL", "often")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for an invalid SESSION_GC_INTERVAL")
+	}
+}
+
+func TestLoadFromEnv_BlockDestructive(t *testing.T) {
+	os.Setenv("BLOCK_DESTRUCTIVE", "true")
+	os.Setenv("BLOCK_DESTRUCTIVE_EXEMPT", "admin, ops ,")
+	defer os.Unsetenv("BLOCK_DESTRUCTIVE")
+	defer os.Unsetenv("BLOCK_DESTRUCTIVE_EXEMPT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !cfg.BlocksDestructive("demo") || !cfg.BlocksDestructive("") {
+		t.Error("Expected destructive statements to be blocked for tenants that are not exempt")
+	}
+	if cfg.BlocksDestructive("admin") || cfg.BlocksDestructive("ops") {
+		t.Errorf("Expected exempt tenants to be allowed, got exemptions %v", cfg.BlockDestructiveExempt)
+	}
+
+	os.Setenv("BLOCK_DESTRUCTIVE", "maybe")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid BLOCK_DESTRUCTIVE")
+	}
+}
+
+func TestLoadFromEnv_QueryLogToStdout(t *testing.T) {
+	os.Setenv("QUERY_LOG_TO_STDOUT", "true")
+	defer os.Unsetenv("QUERY_LOG_TO_STDOUT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !cfg.QueryLogToStdout {
+		t.Error("Expected QueryLogToStdout to be enabled")
+	}
+
+	os.Setenv("QUERY_LOG_TO_STDOUT", "loud")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid QUERY_LOG_TO_STDOUT")
+	}
+}
+
+func TestLoadFromEnv_AutocreateTenants(t *testing.T) {
+	if !NewConfig().AutocreateTenants {
+		t.Error("Expected tenants to be created on first use by default")
+	}
+
+	os.Setenv("AUTOCREATE_TENANTS", "false")
+	defer os.Unsetenv("AUTOCREATE_TENANTS")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.AutocreateTenants {
+		t.Error("Expected AutocreateTenants to be disabled")
+	}
+
+	os.Setenv("AUTOCREATE_TENANTS", "never")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid AUTOCREATE_TENANTS")
+	}
+}
+
+func TestLoadFromEnv_TenantResolvers(t *testing.T) {
+	os.Setenv("TENANT_RESOLVERS", "Attribute, variable")
+	os.Setenv("DEFAULT_TENANT", "shared")
+	defer os.Unsetenv("TENANT_RESOLVERS")
+	defer os.Unsetenv("DEFAULT_TENANT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.TenantResolvers, []string{TenantResolverAttribute, TenantResolverVariable}) {
+		t.Errorf("Expected resolvers [attribute variable], got %v", cfg.TenantResolvers)
+	}
+	if cfg.DefaultTenant != "shared" {
+		t.Errorf("Expected default tenant shared, got %q", cfg.DefaultTenant)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected valid configuration, got %v", err)
+	}
+
+	cfg.TenantResolvers = []string{TenantResolverVariable, "cookie"}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for an unknown tenant resolver")
+	}
+	cfg.TenantResolvers = []string{TenantResolverVariable, TenantResolverVariable}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a duplicate tenant resolver")
+	}
+}
+
+func TestLoadFromEnv_TenantUserAccess(t *testing.T) {
+	os.Setenv("TENANT_USER_ACCESS", "root=alpha|beta, reporting=*")
+	defer os.Unsetenv("TENANT_USER_ACCESS")
+
+	cfg := NewConfig()
+	if !cfg.UserMayUseTenant("anyone", "alpha") {
+		t.Error("Expected every login to be trusted without an access list")
+	}
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	expected := map[string][]string{"root": {"alpha", "beta"}, "reporting": {"*"}}
+	if !reflect.DeepEqual(cfg.TenantUserAccess, expected) {
+		t.Errorf("Expected access %v, got %v", expected, cfg.TenantUserAccess)
+	}
+
+	for _, tc := range []struct {
+		user, idx string
+		allowed   bool
+	}{
+		{"root", "beta", true},
+		{"root", "gamma", false},
+		{"reporting", "gamma", true},
+		{"guest", "alpha", false},
+	} {
+		if allowed := cfg.UserMayUseTenant(tc.user, tc.idx); allowed != tc.allowed {
+			t.Errorf("UserMayUseTenant(%q, %q) = %t, expected %t", tc.user, tc.idx, allowed, tc.allowed)
+		}
+	}
+
+	cfg.TenantUserAccess = map[string][]string{"root": nil}
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a user without tenants")
+	}
+
+	os.Setenv("TENANT_USER_ACCESS", "alpha|beta")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid TENANT_USER_ACCESS")
+	}
+}
+
+func TestLoadFromEnv_MySQLCompat(t *testing.T) {
+	if !NewConfig().MySQLCompat {
+		t.Error("Expected MySQL compatibility rewrites to be enabled by default")
+	}
+
+	os.Setenv("MYSQL_COMPAT", "false")
+	defer os.Unsetenv("MYSQL_COMPAT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.MySQLCompat {
+		t.Error("Expected MYSQL_COMPAT=false to disable MySQL compatibility rewrites")
+	}
+
+	os.Setenv("MYSQL_COMPAT", "sometimes")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid MYSQL_COMPAT")
+	}
+}
+
+func TestLoadFromEnv_ShutdownGraceTimeout(t *testing.T) {
+	if grace := NewConfig().ShutdownGraceTimeout; grace != DefaultShutdownGraceTimeout {
+		t.Errorf("Expected default shutdown grace timeout %v, got %v", DefaultShutdownGraceTimeout, grace)
+	}
+
+	os.Setenv("SHUTDOWN_GRACE_TIMEOUT", "5s")
+	defer os.Unsetenv("SHUTDOWN_GRACE_TIMEOUT")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.ShutdownGraceTimeout != 5*time.Second {
+		t.Errorf("Expected shutdown grace timeout 5s, got %v", cfg.ShutdownGraceTimeout)
+	}
+
+	os.Setenv("SHUTDOWN_GRACE_TIMEOUT", "soon")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid SHUTDOWN_GRACE_TIMEOUT")
+	}
+}
+
+func TestLoadFromEnv_QueryLogShardLevels(t *testing.T) {
+	os.Setenv("QUERY_LOG_DIR", "/var/lib/multitenant-db/logs")
+	os.Setenv("QUERY_LOG_SHARD_LEVELS", "2")
+	defer os.Unsetenv("QUERY_LOG_DIR")
+	defer os.Unsetenv("QUERY_LOG_SHARD_LEVELS")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.QueryLogDir != "/var/lib/multitenant-db/logs" || cfg.QueryLogShardLevels != 2 {
+		t.Errorf("Expected query logs in /var/lib/multitenant-db/logs over 2 shard levels, got %q and %d", cfg.QueryLogDir, cfg.QueryLogShardLevels)
+	}
+
+	cfg.QueryLogShardLevels = MaxQueryLogShardLevels + 1
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for too many query log shard levels")
+	}
+
+	os.Setenv("QUERY_LOG_SHARD_LEVELS", "two")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid QUERY_LOG_SHARD_LEVELS")
+	}
+}
+
+func TestLoadFromEnv_QueryLogColocate(t *testing.T) {
+	os.Setenv("QUERY_LOG_COLOCATE", "true")
+	defer os.Unsetenv("QUERY_LOG_COLOCATE")
+
+	cfg := NewConfig()
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if !cfg.QueryLogColocate {
+		t.Error("Expected query logs to be colocated with tenant data")
+	}
+
+	os.Setenv("QUERY_LOG_COLOCATE", "sometimes")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid QUERY_LOG_COLOCATE")
+	}
+}
+
+func TestLoadFromEnv_SlowQueryExplain(t *testing.T) {
+	cfg := NewConfig()
+	if cfg.SlowQueryThreshold != DefaultSlowQueryThreshold || cfg.SlowQueryExplain {
+		t.Fatalf("Expected a %v threshold with plan capture off by default, got %v and %t", DefaultSlowQueryThreshold, cfg.SlowQueryThreshold, cfg.SlowQueryExplain)
+	}
+
+	os.Setenv("SLOW_QUERY_MS", "250")
+	os.Setenv("SLOW_QUERY_EXPLAIN", "true")
+	defer os.Unsetenv("SLOW_QUERY_MS")
+	defer os.Unsetenv("SLOW_QUERY_EXPLAIN")
+	if err := cfg.LoadFromEnv(); err != nil {
+		t.Fatalf("LoadFromEnv failed: %v", err)
+	}
+	if cfg.SlowQueryThreshold != 250*time.Millisecond || !cfg.SlowQueryExplain {
+		t.Errorf("Expected a 250ms threshold with plan capture on, got %v and %t", cfg.SlowQueryThreshold, cfg.SlowQueryExplain)
+	}
+
+	cfg.SlowQueryThreshold = -time.Second
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected error for a negative slow query threshold")
+	}
+
+	os.Setenv("SLOW_QUERY_EXPLAIN", "sometimes")
+	if err := NewConfig().LoadFromEnv(); err == nil {
+		t.Error("Expected error for invalid SLOW_QUERY_EXPLAIN")
+	}
+}
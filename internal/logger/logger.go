@@ -4,17 +4,21 @@ import (
 	"io"
 	"log"
 	"os"
+	"strings"
 )
 
+// DefaultPrefix is the log prefix used when no service name is configured
+const DefaultPrefix = "[MULTI-TENANT-DB] "
+
 // Setup creates and configures the application logger
 func Setup() *log.Logger {
 	env := os.Getenv("ENV")
 	if env == "PROD" || env == "prod" {
 		// Production: log only to stdout
-		logger := log.New(os.Stdout, "[MULTI-TENANT-DB] ", log.Ldate|log.Ltime|log.Lshortfile)
+		logger := log.New(os.Stdout, DefaultPrefix, log.Ldate|log.Ltime|log.Lshortfile)
 		log.SetOutput(os.Stdout)
 		log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-		log.SetPrefix("[MULTI-TENANT-DB] ")
+		log.SetPrefix(DefaultPrefix)
 		return logger
 	}
 
@@ -24,9 +28,20 @@ func Setup() *log.Logger {
 		log.Fatalf("Failed to open log file: %v", err)
 	}
 	multiWriter := io.MultiWriter(os.Stdout, logFile)
-	logger := log.New(multiWriter, "[MULTI-TENANT-DB] ", log.Ldate|log.Ltime|log.Lshortfile)
+	logger := log.New(multiWriter, DefaultPrefix, log.Ldate|log.Ltime|log.Lshortfile)
 	log.SetOutput(multiWriter)
 	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-	log.SetPrefix("[MULTI-TENANT-DB] ")
+	log.SetPrefix(DefaultPrefix)
 	return logger
 }
+
+// SetServiceName replaces the log prefix of logger and the standard logger with the service
+// name, upper-cased like the default prefix. An empty name restores DefaultPrefix.
+func SetServiceName(logger *log.Logger, name string) {
+	prefix := DefaultPrefix
+	if name != "" {
+		prefix = "[" + strings.ToUpper(name) + "] "
+	}
+	logger.SetPrefix(prefix)
+	log.SetPrefix(prefix)
+}
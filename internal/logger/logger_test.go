@@ -190,3 +190,22 @@ func TestSetup_ExistingFile(t *testing.T) {
 		t.Error("New log message should have correct prefix")
 	}
 }
+
+func TestSetServiceName(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, DefaultPrefix, log.LstdFlags)
+	defer log.SetPrefix(DefaultPrefix)
+
+	SetServiceName(logger, "acme-db")
+	logger.Println("Branded message")
+	if !strings.Contains(buf.String(), "[ACME-DB] ") {
+		t.Errorf("Expected configured prefix, got %q", buf.String())
+	}
+
+	buf.Reset()
+	SetServiceName(logger, "")
+	logger.Println("Default message")
+	if !strings.HasPrefix(buf.String(), DefaultPrefix) {
+		t.Errorf("Expected default prefix, got %q", buf.String())
+	}
+}
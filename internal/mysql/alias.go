@@ -0,0 +1,92 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidAlias is returned when an alias would form a cycle or shadow an existing tenant database
+var ErrInvalidAlias = errors.New("invalid alias")
+
+// maxAliasDepth is the longest chain of aliases SetAlias accepts and resolveAliasLocked follows
+const maxAliasDepth = 16
+
+// SetAlias makes alias resolve to the same database as target, so both idx values share one
+// tenant database. Aliases may point at other aliases but never back at themselves, and an idx
+// that already has its own database, open or persisted by the tenant store, cannot become an
+// alias. A target that is persisted but not open is reopened on first use.
+func (dm *DatabaseManager) SetAlias(alias, target string) error {
+	if alias == "" || target == "" {
+		return fmt.Errorf("%w: alias and target are required", ErrInvalidAlias)
+	}
+	if dm.isDefaultDatabase(alias) {
+		return fmt.Errorf("%w: the default database cannot be an alias", ErrInvalidAlias)
+	}
+
+	dm.dbMu.Lock()
+	defer dm.dbMu.Unlock()
+
+	if _, exists := dm.databases[alias]; exists || dm.storedLocked(alias) {
+		return fmt.Errorf("%w: idx %s already has its own database", ErrInvalidAlias, alias)
+	}
+	// Walk the whole chain from target: alias may already exist and be pointed at by it
+	visited := map[string]bool{alias: true}
+	for hop, ok := target, true; ok; hop, ok = dm.aliases[hop] {
+		if visited[hop] {
+			return fmt.Errorf("%w: %s -> %s would form a cycle", ErrInvalidAlias, alias, target)
+		}
+		if len(visited) > maxAliasDepth {
+			return fmt.Errorf("%w: %s -> %s would chain more than %d aliases", ErrInvalidAlias, alias, target, maxAliasDepth)
+		}
+		visited[hop] = true
+	}
+
+	dm.aliases[alias] = target
+	dm.diagnostics.Delete(alias) // What ran under the name before belongs to another database
+	dm.generation.Add(1) // Sessions bound to the alias must look it up again
+	dm.logger.Printf("Alias %s now resolves to idx %s", alias, target)
+	return nil
+}
+
+// Aliases returns a copy of the alias -> target mappings
+func (dm *DatabaseManager) Aliases() map[string]string {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+
+	aliases := make(map[string]string, len(dm.aliases))
+	for alias, target := range dm.aliases {
+		aliases[alias] = target
+	}
+	return aliases
+}
+
+// dropAliasesLocked removes every alias resolving to idx, whose database has just been removed,
+// so a stale alias cannot silently recreate the tenant. Callers must hold dbMu for writing.
+func (dm *DatabaseManager) dropAliasesLocked(idx string) {
+	var stale []string
+	for alias := range dm.aliases {
+		if dm.resolveAliasLocked(alias) == idx {
+			stale = append(stale, alias)
+		}
+	}
+	for _, alias := range stale {
+		delete(dm.aliases, alias)
+		dm.logger.Printf("Removed alias %s of removed idx %s", alias, idx)
+	}
+}
+
+// resolveAliasLocked follows aliases from idx to the idx whose database it shares. SetAlias
+// refuses cycles, and the walk stops after maxAliasDepth steps in any case, since it runs under
+// dbMu and a loop would hang every manager call. Callers must hold dbMu.
+func (dm *DatabaseManager) resolveAliasLocked(idx string) string {
+	start := idx
+	for range maxAliasDepth {
+		target, ok := dm.aliases[idx]
+		if !ok {
+			return idx
+		}
+		idx = target
+	}
+	dm.logger.Printf("Alias chain from idx %s is longer than %d, stopping at %s", start, maxAliasDepth, idx)
+	return idx
+}
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDatabaseManager_Alias(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	target, err := dm.GetOrCreateDatabase("acme")
+	if err != nil {
+		t.Fatalf("Failed to create target database: %v", err)
+	}
+	if err := dm.SetAlias("acme-corp", "acme"); err != nil {
+		t.Fatalf("SetAlias failed: %v", err)
+	}
+
+	// Writes through the alias land in the target's database
+	viaAlias, err := dm.GetOrCreateDatabase("acme-corp")
+	if err != nil {
+		t.Fatalf("Failed to get database via alias: %v", err)
+	}
+	if _, err := viaAlias.Exec("INSERT INTO users (id, name, email, age) VALUES (4, 'Dana', 'dana@example.com', 41)"); err != nil {
+		t.Fatalf("Insert via alias failed: %v", err)
+	}
+	var name string
+	if err := target.QueryRow("SELECT name FROM users WHERE id = 4").Scan(&name); err != nil || name != "Dana" {
+		t.Errorf("Expected the row written via the alias in the target, got %q (%v)", name, err)
+	}
+	if !dm.HasDatabase("acme-corp") {
+		t.Error("HasDatabase should resolve the alias")
+	}
+	if stringInSlice("acme-corp", dm.ListDatabases()) {
+		t.Error("An alias should not be listed as a database of its own")
+	}
+
+	// Sessions bound to the alias share the target's database too
+	session := NewSessionVariables()
+	session.SetUser("idx", "acme-corp")
+	sessionDB, err := dm.GetDatabaseForSession(session)
+	if err != nil || sessionDB != target {
+		t.Errorf("Expected the session to resolve the alias to the target database (%v)", err)
+	}
+
+	// Aliases may chain, but never back to themselves
+	if err := dm.SetAlias("acme-inc", "acme-corp"); err != nil {
+		t.Fatalf("Chained alias failed: %v", err)
+	}
+	if db, _ := dm.GetOrCreateDatabase("acme-inc"); db != target {
+		t.Error("Chained alias should resolve to the target database")
+	}
+	if err := dm.SetAlias("acme", "acme-inc"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("Expected ErrInvalidAlias for an alias over an existing tenant, got %v", err)
+	}
+	if err := dm.SetAlias("beta", "gamma"); err != nil {
+		t.Fatalf("SetAlias failed: %v", err)
+	}
+	if err := dm.SetAlias("gamma", "beta"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("Expected ErrInvalidAlias for a cycle, got %v", err)
+	}
+	// Re-pointing an existing alias must not close a cycle through another alias
+	if err := dm.SetAlias("delta", "epsilon"); err != nil {
+		t.Fatalf("SetAlias failed: %v", err)
+	}
+	if err := dm.SetAlias("zeta", "delta"); err != nil {
+		t.Fatalf("SetAlias failed: %v", err)
+	}
+	if err := dm.SetAlias("delta", "zeta"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("Expected ErrInvalidAlias re-pointing an alias into a cycle, got %v", err)
+	}
+	if err := dm.SetAlias("default", "acme"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("Expected ErrInvalidAlias for aliasing the default database, got %v", err)
+	}
+
+	if err := dm.CreateDatabase("acme-corp", true, ""); !errors.Is(err, ErrDatabaseExists) {
+		t.Errorf("Expected ErrDatabaseExists creating a database under an alias, got %v", err)
+	}
+
+	// Statements and errors recorded under an alias are the target's
+	dm.RecordTenantQuery("acme-inc", "SELECT 1")
+	dm.RecordTenantError("acme-corp", errors.New("no such table: orders"))
+	if lastQuery, ok := dm.LastQuery("acme"); !ok || lastQuery.Query != "SELECT 1" {
+		t.Errorf("Expected the statement run through the alias as acme's last query, got %+v", lastQuery)
+	}
+	if lastError, ok := dm.LastError("acme-inc"); !ok || lastError.Message != "no such table: orders" {
+		t.Errorf("Expected the error raised through the alias as acme's last error, got %+v", lastError)
+	}
+
+	aliases := dm.Aliases()
+	if aliases["acme-corp"] != "acme" || aliases["acme-inc"] != "acme-corp" || len(aliases) != 5 {
+		t.Errorf("Unexpected aliases: %v", aliases)
+	}
+
+	// Deleting the target drops every alias resolving to it, so none recreates it
+	if err := dm.DeleteDatabase("acme"); err != nil {
+		t.Fatalf("DeleteDatabase failed: %v", err)
+	}
+	aliases = dm.Aliases()
+	if _, exists := aliases["acme-corp"]; exists || len(aliases) != 3 {
+		t.Errorf("Expected the aliases of acme to be dropped, got %v", aliases)
+	}
+	if dm.HasDatabase("acme-corp") || dm.HasDatabase("acme") {
+		t.Error("Expected neither acme nor its former alias to exist")
+	}
+	for _, idx := range []string{"acme", "acme-corp", "acme-inc"} {
+		if _, ok := dm.diagnostics.Load(idx); ok {
+			t.Errorf("Expected the diagnostics recorded under %s to be dropped with acme", idx)
+		}
+	}
+}
+
+func TestDatabaseManager_AliasStoredTenant(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm, err := NewDatabaseManagerWithStore(logger, nil, newFakeTenantStore())
+	if err != nil {
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	defer dm.Close()
+
+	for _, idx := range []string{"acme", "globex"} {
+		if _, err := dm.GetOrCreateDatabase(idx); err != nil {
+			t.Fatalf("Failed to create database for %s: %v", idx, err)
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	if evicted := dm.EvictIdleDatabases(time.Millisecond); len(evicted) != 2 {
+		t.Fatalf("Expected both tenants to be evicted, got %v", evicted)
+	}
+
+	// A stored tenant cannot become an alias, but may be the target of one
+	if err := dm.SetAlias("globex", "acme"); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("Expected ErrInvalidAlias aliasing over a stored tenant, got %v", err)
+	}
+	if err := dm.SetAlias("acme-corp", "acme"); err != nil {
+		t.Fatalf("SetAlias to a stored tenant failed: %v", err)
+	}
+	if _, err := dm.GetOrCreateDatabase("acme-corp"); err != nil {
+		t.Fatalf("Failed to open the stored target through its alias: %v", err)
+	}
+
+	// Eviction keeps the alias of a tenant the store persists
+	time.Sleep(5 * time.Millisecond)
+	dm.EvictIdleDatabases(time.Millisecond)
+	if dm.Aliases()["acme-corp"] != "acme" {
+		t.Errorf("Expected the alias to survive eviction of a stored tenant, got %v", dm.Aliases())
+	}
+}
@@ -0,0 +1,172 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// alterTableAddRegex matches ALTER TABLE name ADD ..., capturing the table and its specifications
+var alterTableAddRegex = regexp.MustCompile(`(?is)^\s*alter\s+table\s+(\S+)\s+(add\s.*?)\s*;?\s*$`)
+
+// sqliteCollations are the collations SQLite knows; any other COLLATE is a MySQL collation
+var sqliteCollations = map[string]bool{"BINARY": true, "NOCASE": true, "RTRIM": true}
+
+// translateAddColumns rewrites a MySQL ALTER TABLE ... ADD [COLUMN] statement as the SQLite
+// statements that perform it, one per added column since SQLite adds a single column at a time.
+// It returns false for any other ALTER TABLE, including ADD INDEX and ADD CONSTRAINT, which are
+// passed to SQLite unchanged.
+func translateAddColumns(query string) ([]string, bool) {
+	matches := alterTableAddRegex.FindStringSubmatch(query)
+	if matches == nil {
+		return nil, false
+	}
+	table := matches[1]
+
+	var definitions []string
+	for _, spec := range splitTopLevel(matches[2]) {
+		tokens := columnTokens(spec)
+		if len(tokens) < 2 || !strings.EqualFold(tokens[0], "add") {
+			return nil, false
+		}
+		tokens = tokens[1:]
+		if strings.EqualFold(tokens[0], "column") {
+			tokens = tokens[1:]
+		}
+		switch strings.ToLower(tokens[0]) {
+		case "index", "key", "unique", "primary", "constraint", "fulltext", "spatial", "foreign", "check":
+			return nil, false
+		}
+
+		// ADD [COLUMN] (col1 type, col2 type) adds several columns at once
+		if first := tokens[0]; len(tokens) == 1 && strings.HasPrefix(first, "(") && strings.HasSuffix(first, ")") {
+			for _, definition := range splitTopLevel(first[1 : len(first)-1]) {
+				definitions = append(definitions, strings.TrimSpace(definition))
+			}
+			continue
+		}
+		definitions = append(definitions, strings.Join(tokens, " "))
+	}
+
+	statements := make([]string, 0, len(definitions))
+	for _, definition := range definitions {
+		column, ok := sqliteColumnDefinition(definition)
+		if !ok {
+			return nil, false
+		}
+		statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, column))
+	}
+	return statements, true
+}
+
+// sqliteColumnDefinition translates a MySQL column definition to one SQLite accepts. SQLite
+// derives a column's affinity from its declared type name, so types it can parse are kept as
+// declared and DESCRIBE reports them as the client wrote them. ENUM and SET become TEXT, MySQL-only
+// attributes and column placement are dropped, and a NOT NULL column without a DEFAULT gets the
+// implicit default MySQL would fill existing rows with.
+func sqliteColumnDefinition(definition string) (string, bool) {
+	tokens := columnTokens(definition)
+	if len(tokens) < 2 {
+		return "", false
+	}
+
+	column := []string{tokens[0]}
+	dataType := strings.ToLower(tokens[1])
+	if i := strings.Index(dataType, "("); i >= 0 {
+		dataType = dataType[:i]
+	}
+	rest := tokens[2:]
+	if dataType == "enum" || dataType == "set" {
+		column = append(column, "TEXT")
+		if len(rest) > 0 && strings.HasPrefix(rest[0], "(") {
+			rest = rest[1:]
+		}
+	} else {
+		column = append(column, tokens[1])
+	}
+
+	notNull, hasDefault := false, false
+	for i := 0; i < len(rest); i++ {
+		token := strings.ToUpper(rest[i])
+		switch {
+		case token == "AUTO_INCREMENT" || token == "FIRST":
+		case token == "CHARSET" || token == "AFTER":
+			i++
+		case token == "CHARACTER" && i+1 < len(rest) && strings.EqualFold(rest[i+1], "set"):
+			i += 2
+		case token == "COLLATE" && i+1 < len(rest) && !sqliteCollations[strings.ToUpper(rest[i+1])]:
+			i++
+		case token == "COMMENT":
+			i++
+		case token == "ON" && i+2 < len(rest) && strings.EqualFold(rest[i+1], "update"):
+			i += 2
+			if i+1 < len(rest) && strings.HasPrefix(rest[i+1], "(") {
+				i++
+			}
+		default:
+			if token == "NOT" && i+1 < len(rest) && strings.EqualFold(rest[i+1], "null") {
+				notNull = true
+			}
+			if token == "DEFAULT" {
+				hasDefault = true
+			}
+			column = append(column, rest[i])
+		}
+	}
+
+	// SQLite refuses to add a NOT NULL column without a default, as existing rows would be NULL
+	if notNull && !hasDefault {
+		column = append(column, "DEFAULT", implicitDefault(dataType))
+	}
+	return strings.Join(column, " "), true
+}
+
+// implicitDefault returns the value MySQL gives a NOT NULL column of dataType that has no DEFAULT
+func implicitDefault(dataType string) string {
+	switch dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "decimal", "dec", "numeric",
+		"fixed", "float", "double", "real", "bit", "bool", "boolean", "year":
+		return "0"
+	}
+	return "''"
+}
+
+// columnTokens splits a column definition on whitespace, keeping quoted strings, quoted
+// identifiers and parenthesised groups such as a type's length or value list whole
+func columnTokens(definition string) []string {
+	var tokens []string
+	var quote rune
+	escaped := false
+	depth, start := 0, -1
+	for i, c := range definition {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' && quote != '`' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case depth == 0 && (c == ' ' || c == '\t' || c == '\n' || c == '\r'):
+			if start >= 0 {
+				tokens = append(tokens, definition[start:i])
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, definition[start:])
+	}
+	return tokens
+}
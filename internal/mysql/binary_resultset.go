@@ -0,0 +1,147 @@
+package mysql
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// binaryResultset re-encodes a text resultset in the binary row format that prepared statement
+// executions must answer with. Values are encoded according to each column's field type, so
+// integer columns reach the client as integers rather than as strings it has to reinterpret.
+// A date or time column holding a value that does not parse, such as MySQL's zero date, is sent
+// as text instead, with a warning for each such value.
+func binaryResultset(r *mysql.Resultset) (*mysql.Resultset, []Warning, error) {
+	rows := make([][]mysql.FieldValue, 0, len(r.RowDatas))
+	for _, text := range r.RowDatas {
+		values, err := text.ParseText(r.Fields, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to parse row: %v", err)
+		}
+		rows = append(rows, values)
+	}
+
+	fields := append([]*mysql.Field(nil), r.Fields...)
+	var warnings []Warning
+	for i, field := range r.Fields {
+		if !isDateTimeField(field) {
+			continue
+		}
+		for n, values := range rows {
+			if values[i].Type == mysql.FieldValueTypeNull {
+				continue
+			}
+			if _, ok := parseDateTime(values[i].AsString()); ok {
+				continue
+			}
+			warnings = append(warnings, Warning{
+				Level:   "Warning",
+				Code:    mysql.ER_TRUNCATED_WRONG_VALUE,
+				Message: fmt.Sprintf("Incorrect datetime value: '%s' for column '%s' at row %d", values[i].AsString(), field.Name, n+1),
+			})
+			if fields[i] == field {
+				text := *field
+				text.Type = mysql.MYSQL_TYPE_VAR_STRING
+				fields[i] = &text
+			}
+		}
+	}
+
+	// Binary rows start with a 0x00 header and a NULL bitmap that skips the first two bits
+	bitmapLen := (len(fields) + 7 + 2) >> 3
+
+	rowDatas := make([]mysql.RowData, 0, len(rows))
+	for _, values := range rows {
+		row := make([]byte, 1+bitmapLen)
+		for i, value := range values {
+			if value.Type == mysql.FieldValueTypeNull {
+				row[1+(i+2)/8] |= 1 << (uint(i+2) % 8)
+				continue
+			}
+			var err error
+			if row, err = appendBinaryValue(row, fields[i], &value); err != nil {
+				return nil, nil, fmt.Errorf("failed to encode column %s: %v", fields[i].Name, err)
+			}
+		}
+		rowDatas = append(rowDatas, row)
+	}
+
+	binaryResult := *r
+	binaryResult.Fields = fields
+	binaryResult.RowDatas = rowDatas
+	return &binaryResult, warnings, nil
+}
+
+// isDateTimeField reports whether field is sent in the binary date and time encoding
+func isDateTimeField(field *mysql.Field) bool {
+	switch field.Type {
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_DATE:
+		return true
+	}
+	return false
+}
+
+// parseDateTime parses a date or time column value as it appears in a text resultset
+func parseDateTime(value []byte) (time.Time, bool) {
+	t, err := time.Parse("2006-01-02 15:04:05.999999999", string(value))
+	if err != nil {
+		if t, err = time.Parse(time.DateOnly, string(value)); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
+
+// appendBinaryValue appends one non-NULL value in the binary encoding of field's type
+func appendBinaryValue(row []byte, field *mysql.Field, value *mysql.FieldValue) ([]byte, error) {
+	switch field.Type {
+	case mysql.MYSQL_TYPE_LONGLONG:
+		return binary.LittleEndian.AppendUint64(row, value.AsUint64()), nil
+	case mysql.MYSQL_TYPE_LONG, mysql.MYSQL_TYPE_INT24:
+		return binary.LittleEndian.AppendUint32(row, uint32(value.AsUint64())), nil
+	case mysql.MYSQL_TYPE_SHORT, mysql.MYSQL_TYPE_YEAR:
+		return binary.LittleEndian.AppendUint16(row, uint16(value.AsUint64())), nil
+	case mysql.MYSQL_TYPE_TINY:
+		return append(row, byte(value.AsUint64())), nil
+	case mysql.MYSQL_TYPE_DOUBLE:
+		return binary.LittleEndian.AppendUint64(row, math.Float64bits(value.AsFloat64())), nil
+	case mysql.MYSQL_TYPE_FLOAT:
+		return binary.LittleEndian.AppendUint32(row, math.Float32bits(float32(value.AsFloat64()))), nil
+	case mysql.MYSQL_TYPE_DATETIME, mysql.MYSQL_TYPE_TIMESTAMP, mysql.MYSQL_TYPE_DATE:
+		t, ok := parseDateTime(value.AsString())
+		if !ok {
+			return nil, fmt.Errorf("incorrect datetime value: '%s'", value.AsString())
+		}
+		return appendBinaryDateTime(row, t), nil
+	default:
+		return append(row, mysql.PutLengthEncodedString(value.AsString())...), nil
+	}
+}
+
+// appendBinaryDateTime appends t in the binary DATETIME encoding, using the shortest form that
+// holds all of its non-zero parts
+func appendBinaryDateTime(row []byte, t time.Time) []byte {
+	micros := t.Nanosecond() / 1000
+	hasTime := t.Hour() != 0 || t.Minute() != 0 || t.Second() != 0
+
+	switch {
+	case micros > 0:
+		row = append(row, 11)
+	case hasTime:
+		row = append(row, 7)
+	default:
+		row = append(row, 4)
+	}
+	row = binary.LittleEndian.AppendUint16(row, uint16(t.Year()))
+	row = append(row, byte(t.Month()), byte(t.Day()))
+	if micros > 0 || hasTime {
+		row = append(row, byte(t.Hour()), byte(t.Minute()), byte(t.Second()))
+	}
+	if micros > 0 {
+		row = binary.LittleEndian.AppendUint32(row, uint32(micros))
+	}
+	return row
+}
@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"fmt"
+	"strings"
+)
+
+// sqliteArgs converts prepared-statement arguments for binding in SQLite. The binary protocol
+// sends strings and binary values alike as bytes, and a []byte would be bound as a BLOB, which
+// never equals a TEXT value, so they are bound as text.
+func sqliteArgs(args []interface{}) []interface{} {
+	converted := make([]interface{}, len(args))
+	for i, arg := range args {
+		if b, ok := arg.([]byte); ok {
+			converted[i] = string(b)
+		} else {
+			converted[i] = arg
+		}
+	}
+	return converted
+}
+
+// inlineArgs replaces the ? placeholders in query, outside quoted strings and identifiers, with
+// args written as SQL literals. Statements answered by the query handlers rather than SQLite have
+// no parameters to bind, so this is how they see prepared-statement arguments.
+func inlineArgs(query string, args []interface{}) string {
+	// blankQuoted keeps every rune in place, so both line up rune for rune
+	runes, blanked := []rune(query), []rune(blankQuoted(query))
+	var inlined strings.Builder
+	next := 0
+	for i, r := range runes {
+		if blanked[i] != '?' || next >= len(args) {
+			inlined.WriteRune(r)
+			continue
+		}
+		inlined.WriteString(sqlLiteral(args[next]))
+		next++
+	}
+	return inlined.String()
+}
+
+// literalEscaper escapes backslashes and quotes in a string literal the way unquoteLiteral reads them
+var literalEscaper = strings.NewReplacer(`\`, `\\`, "'", "''")
+
+// sqlLiteral writes a prepared-statement argument as a SQL literal
+func sqlLiteral(arg interface{}) string {
+	switch v := arg.(type) {
+	case nil:
+		return "NULL"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return fmt.Sprintf("%v", v)
+	case []byte:
+		return "'" + literalEscaper.Replace(string(v)) + "'"
+	}
+	return "'" + literalEscaper.Replace(fmt.Sprintf("%v", arg)) + "'"
+}
+
+// sqliteLiteral writes a value as a literal for a statement SQLite runs. SQLite strings have no
+// backslash escapes, so only quotes are doubled; sqlLiteral's escaping would reach SQLite as
+// doubled backslashes.
+func sqliteLiteral(value interface{}) string {
+	switch v := value.(type) {
+	case nil, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return sqlLiteral(v)
+	case []byte:
+		return "'" + strings.ReplaceAll(string(v), "'", "''") + "'"
+	}
+	return "'" + strings.ReplaceAll(fmt.Sprintf("%v", value), "'", "''") + "'"
+}
+
+// literalEscapes maps the character after a backslash in a string literal to the one it stands for
+var literalEscapes = map[byte]byte{'0': 0, 'b': '\b', 'n': '\n', 'r': '\r', 't': '\t', 'Z': 26}
+
+// unquoteLiteral returns the text of a single- or double-quoted SQL string literal with MySQL's
+// escapes undone: a doubled quote, or a backslash before a quote, a backslash or one of the
+// characters in literalEscapes. As in MySQL, \% and \_ keep their backslash so they still match
+// literally in a LIKE pattern. It returns false when value is not one quoted literal.
+func unquoteLiteral(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || (value[0] != '\'' && value[0] != '"') {
+		return value, false
+	}
+	quote := value[0]
+	var text strings.Builder
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == '\\' && i+1 < len(value)-1:
+			i++
+			if escaped, ok := literalEscapes[value[i]]; ok {
+				text.WriteByte(escaped)
+			} else if value[i] == '%' || value[i] == '_' {
+				text.WriteByte('\\')
+				text.WriteByte(value[i])
+			} else {
+				text.WriteByte(value[i])
+			}
+		case c == quote && i+1 < len(value) && value[i+1] == quote:
+			text.WriteByte(quote)
+			i++
+		case c == quote:
+			if i != len(value)-1 {
+				return value, false
+			}
+			return text.String(), true
+		default:
+			text.WriteByte(c)
+		}
+	}
+	return value, false
+}
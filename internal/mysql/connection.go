@@ -0,0 +1,67 @@
+package mysql
+
+import (
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// connectionHandler serves the commands of a single client connection. Until the handshake has
+// completed it wraps the server's Handler; from then on a Handler bound to the connection's id,
+// the id sent to the client in the handshake, which keeps CONNECTION_ID(), SHOW PROCESSLIST, log
+// prefixes and the query log in agreement.
+type connectionHandler struct {
+	*Handler
+	denied error // Answers every command when the login selected a tenant its user may not use
+}
+
+// UseDB implements the MySQL UseDB command for this connection
+func (c *connectionHandler) UseDB(dbName string) error {
+	if c.denied != nil {
+		return c.denied
+	}
+	return c.Handler.UseDB(dbName)
+}
+
+// HandleQuery implements the MySQL Query command for this connection
+func (c *connectionHandler) HandleQuery(query string) (*mysql.Result, error) {
+	if c.denied != nil {
+		return nil, c.denied
+	}
+	return c.Handler.HandleQuery(query)
+}
+
+// HandleFieldList implements the MySQL FieldList command for this connection
+func (c *connectionHandler) HandleFieldList(table string, wildcard string) ([]*mysql.Field, error) {
+	if c.denied != nil {
+		return nil, c.denied
+	}
+	return c.Handler.HandleFieldList(table, wildcard)
+}
+
+// HandleStmtPrepare implements the MySQL StmtPrepare command for this connection
+func (c *connectionHandler) HandleStmtPrepare(query string) (int, int, interface{}, error) {
+	if c.denied != nil {
+		return 0, 0, nil, c.denied
+	}
+	return c.Handler.HandleStmtPrepare(query)
+}
+
+// HandleStmtExecute implements the MySQL StmtExecute command for this connection
+func (c *connectionHandler) HandleStmtExecute(context interface{}, query string, args []interface{}) (*mysql.Result, error) {
+	if c.denied != nil {
+		return nil, c.denied
+	}
+	return c.Handler.HandleStmtExecute(context, query, args)
+}
+
+// HandleStmtClose implements the MySQL StmtClose command for this connection
+func (c *connectionHandler) HandleStmtClose(context interface{}) error {
+	return c.Handler.HandleStmtClose(context)
+}
+
+// HandleOtherCommand implements other MySQL commands for this connection
+func (c *connectionHandler) HandleOtherCommand(cmd byte, data []byte) error {
+	if c.denied != nil {
+		return c.denied
+	}
+	return c.Handler.HandleOtherCommand(cmd, data)
+}
@@ -1,15 +1,23 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"multitenant-db/internal/config"
 
 	_ "github.com/go-sql-driver/mysql"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 // DatabaseManager manages multiple SQLite databases, one per idx
@@ -18,20 +26,87 @@ type DatabaseManager struct {
 	dbMu          sync.RWMutex
 	logger        *log.Logger
 	defaultConfig *config.DefaultDatabaseConfig // Optional default database configuration
+	store         TenantStore                   // Storage backend for tenant databases
+	lastAccess    map[string]*atomic.Int64      // key is idx value, value is last time (UnixNano) the DB was requested
+	aliases       map[string]string             // alias idx -> idx whose database it shares
+	generation    atomic.Uint64                 // bumped whenever a database is removed, invalidating session caches
+	closing       map[string]chan struct{}      // Removed databases whose hooks run before they close; each channel closes once they have
+	tenantPragmas TenantPragmasFunc             // Optional per-tenant SQLite pragmas applied to new databases
+	maxTenants    int                           // Cap on open tenant databases, excluding the default (0 disables)
+	evictAtLimit  bool                          // At the cap, evict the least recently used tenant instead of refusing
+	sampleRows    int                           // Sample users and products seeded by initSampleData
+	affinity      bool                          // Give each tenant a single dedicated connection
+	now           func() time.Time              // Clock used by the expiry sweeper, replaceable in tests
+	
+	// Optional check refusing destructive statements per tenant
+	destructiveGuard DestructiveGuardFunc
+	
+	// Connection whose transaction is open per tenant, under connection affinity
+	txMu     sync.Mutex
+	txOwners map[string]uint32
+	
+	// Most recent error and statement per idx, surfaced for diagnosis
+	diagnostics sync.Map // idx -> *tenantDiagnostics
+	
+	// When the set of databases and each one's schema last changed, for HTTP cache validators
+	modMu             sync.Mutex
+	databasesModified time.Time
+	schemaModified    map[string]time.Time
+	
+	// Bumped whenever any schema changes, invalidating the cached column types of each table
+	schemaVersion atomic.Uint64
+	columnTypes   sync.Map // idx + "\x00" + lowercased table -> columnTypesEntry
+	
+	// Eviction and expiry notification hooks
+	hooksMu       sync.RWMutex
+	evictionHooks []EvictionHook
+	expiryHooks   []ExpiryHook
+	closeHooks    []CloseHook
+	deleteHooks   []DeleteHook
+	stopEviction  chan struct{}
+	stopExpiry    chan struct{}
 }
 
-// NewDatabaseManager creates a new database manager
+// NewDatabaseManager creates a new database manager with an in-memory default database. It
+// panics if SQLite cannot open one, which only happens when the driver is unusable.
 func NewDatabaseManager(logger *log.Logger) *DatabaseManager {
-	return NewDatabaseManagerWithConfig(logger, nil)
+	dm, err := NewDatabaseManagerWithConfig(logger, nil)
+	if err != nil {
+		panic(err)
+	}
+	return dm
 }
 
 // NewDatabaseManagerWithConfig creates a new database manager with optional default database configuration
-func NewDatabaseManagerWithConfig(logger *log.Logger, defaultConfig *config.DefaultDatabaseConfig) *DatabaseManager {
+func NewDatabaseManagerWithConfig(logger *log.Logger, defaultConfig *config.DefaultDatabaseConfig) (*DatabaseManager, error) {
+	return NewDatabaseManagerWithStore(logger, defaultConfig, NewSQLiteMemoryStore())
+}
+
+// NewDatabaseManagerWithStore creates a new database manager whose tenant databases come from store.
+// It fails if the default database cannot be opened.
+func NewDatabaseManagerWithStore(logger *log.Logger, defaultConfig *config.DefaultDatabaseConfig, store TenantStore) (*DatabaseManager, error) {
+	return NewDatabaseManagerWithPragmas(logger, defaultConfig, store, nil)
+}
+
+// NewDatabaseManagerWithPragmas creates a new database manager whose SQLite databases, the
+// default one included, use the cache_size and mmap_size pragmas resolves for them on every
+// connection. A nil pragmas leaves SQLite's defaults.
+func NewDatabaseManagerWithPragmas(logger *log.Logger, defaultConfig *config.DefaultDatabaseConfig, store TenantStore, pragmas TenantPragmasFunc) (*DatabaseManager, error) {
 	dm := &DatabaseManager{
-		databases:     make(map[string]*sql.DB),
-		logger:        logger,
-		defaultConfig: defaultConfig,
+		databases:      make(map[string]*sql.DB),
+		logger:         logger,
+		defaultConfig:  defaultConfig,
+		store:          store,
+		tenantPragmas:  pragmas,
+		lastAccess:     make(map[string]*atomic.Int64),
+		aliases:        make(map[string]string),
+		closing:        make(map[string]chan struct{}),
+		txOwners:       make(map[string]uint32),
+		sampleRows:     config.DefaultSampleDataRows,
+		now:            time.Now,
+		schemaModified: make(map[string]time.Time),
 	}
+	dm.databasesModified = dm.now()
 	
 	// Create default database
 	var defaultDB *sql.DB
@@ -40,24 +115,162 @@ func NewDatabaseManagerWithConfig(logger *log.Logger, defaultConfig *config.Defa
 	if defaultConfig != nil {
 		// Use configured default database
 		defaultDB, err = dm.createConfiguredDatabase(defaultConfig)
+		if err != nil && defaultConfig.Type == config.DatabaseTypeMySQL {
+			// An unreachable MySQL server is a configuration error; serving an empty SQLite
+			// database in its place would hide it
+			return nil, fmt.Errorf("failed to connect to the configured MySQL default database: %w", err)
+		}
 		if err != nil {
 			logger.Printf("Failed to create configured default database, falling back to in-memory SQLite: %v", err)
-			defaultDB, err = sql.Open("sqlite3", ":memory:")
+			defaultDB, err = dm.openSQLiteDatabase("default", memoryDSN())
 		}
 	} else {
 		// Create default in-memory SQLite database (existing behavior)
-		defaultDB, err = sql.Open("sqlite3", ":memory:")
+		defaultDB, err = dm.openSQLiteDatabase("default", memoryDSN())
 	}
 	
 	if err != nil {
-		logger.Fatalf("Failed to create default database: %v", err)
+		return nil, fmt.Errorf("failed to create default database: %w", err)
 	}
 	
 	dm.databases["default"] = defaultDB
 	
 	// Initialize sample data in default database
 	dm.initSampleData("default")
-	return dm
+	return dm, nil
+}
+
+// TenantPragmasFunc returns the PRAGMA cache_size and mmap_size to apply to a new tenant database.
+// It is consulted whenever a database is opened; open databases keep the values they got.
+type TenantPragmasFunc func(idx string) (cacheSize int, mmapSize int)
+
+// SetConnectionAffinity gives every SQLite database, open or opened later, a single dedicated
+// connection when enabled. Statements for a tenant are then serialized on that connection, so a
+// write, and any transaction it is part of, is always visible to the next statement, at the cost
+// of running one statement per tenant at a time. Sessions share the connection and so any open
+// transaction; claimTransaction limits a tenant to one at a time. Disabling it restores the
+// default pools of databases opened afterwards only. A MySQL default database keeps its
+// configured pool.
+func (dm *DatabaseManager) SetConnectionAffinity(enabled bool) {
+	dm.dbMu.Lock()
+	defer dm.dbMu.Unlock()
+	dm.affinity = enabled
+	for idx, db := range dm.databases {
+		dm.applyConnectionAffinity(idx, db)
+	}
+}
+
+// applyConnectionAffinity pins db to one long-lived connection if connection affinity is enabled.
+// Callers must hold dbMu.
+func (dm *DatabaseManager) applyConnectionAffinity(idx string, db *sql.DB) {
+	if !dm.affinity {
+		return
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return
+	}
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+}
+
+// pinnedTenant resolves tenant to the idx of its database and reports whether connection affinity
+// pins that database to a single connection
+func (dm *DatabaseManager) pinnedTenant(tenant string) (string, bool) {
+	if tenant == "" {
+		tenant = "default"
+	}
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	idx := dm.resolveAliasLocked(tenant)
+	if !dm.affinity || (dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL) {
+		return idx, false
+	}
+	return idx, true
+}
+
+// claimTransaction records connID as running the open transaction of tenant when connection
+// affinity pins its database. Every session of the tenant shares that one connection, and with
+// it the transaction, so only one may have a transaction open at a time. It returns false when
+// another connection's transaction is open.
+func (dm *DatabaseManager) claimTransaction(tenant string, connID uint32) bool {
+	idx, pinned := dm.pinnedTenant(tenant)
+	if !pinned {
+		return true
+	}
+	dm.txMu.Lock()
+	defer dm.txMu.Unlock()
+	if owner, open := dm.txOwners[idx]; open && owner != connID {
+		return false
+	}
+	dm.txOwners[idx] = connID
+	return true
+}
+
+// transactionBlocked reports whether another connection than connID has a transaction open on
+// the single connection of tenant, which statements of connID would run inside of
+func (dm *DatabaseManager) transactionBlocked(tenant string, connID uint32) bool {
+	idx, pinned := dm.pinnedTenant(tenant)
+	if !pinned {
+		return false
+	}
+	dm.txMu.Lock()
+	defer dm.txMu.Unlock()
+	owner, open := dm.txOwners[idx]
+	return open && owner != connID
+}
+
+// rollbackTransaction rolls back the transaction a connection left open on the single connection
+// of idx's database
+func (dm *DatabaseManager) rollbackTransaction(idx string) error {
+	dm.dbMu.RLock()
+	db, exists := dm.databases[idx]
+	dm.dbMu.RUnlock()
+	if !exists {
+		return nil
+	}
+	_, err := db.Exec("ROLLBACK")
+	return err
+}
+
+// releaseTransaction drops the transaction connID opened, if any, returning the idx it was open on
+func (dm *DatabaseManager) releaseTransaction(connID uint32) (string, bool) {
+	dm.txMu.Lock()
+	defer dm.txMu.Unlock()
+	for idx, owner := range dm.txOwners {
+		if owner == connID {
+			delete(dm.txOwners, idx)
+			return idx, true
+		}
+	}
+	return "", false
+}
+
+// openSQLiteDatabase opens dsn as the SQLite database for idx. PRAGMAs only last for the
+// connection they run on, so the configured page cache and memory-map sizes are set through the
+// DSN, which applies them to every connection of the pool. mmap_size has no effect on in-memory
+// databases.
+func (dm *DatabaseManager) openSQLiteDatabase(idx, dsn string) (*sql.DB, error) {
+	if dm.tenantPragmas == nil {
+		return sql.Open("sqlite3", dsn)
+	}
+	cacheSize, mmapSize := dm.tenantPragmas(idx)
+	return withPragmas(dsn, cacheSize, mmapSize)
+}
+
+// openFromStoreLocked opens the database for idx from the tenant store, with the tenant pragmas
+// on every connection when they are set. A store that cannot apply them opens the database with
+// SQLite's defaults. Callers must hold dbMu.
+func (dm *DatabaseManager) openFromStoreLocked(idx string) (*sql.DB, error) {
+	if dm.tenantPragmas != nil {
+		if store, ok := dm.store.(PragmaTenantStore); ok {
+			cacheSize, mmapSize := dm.tenantPragmas(idx)
+			return store.GetOrCreateWithPragmas(idx, cacheSize, mmapSize)
+		}
+		dm.logger.Printf("Tenant store cannot apply SQLite pragmas, opening idx %s with the defaults", idx)
+	}
+	return dm.store.GetOrCreate(idx)
 }
 
 // createConfiguredDatabase creates a database connection using the provided configuration
@@ -65,70 +278,358 @@ func (dm *DatabaseManager) createConfiguredDatabase(dbConfig *config.DefaultData
 	switch dbConfig.Type {
 	case config.DatabaseTypeSQLite:
 		dm.logger.Printf("Creating SQLite default database: %s", dbConfig.ConnectionString)
-		return sql.Open("sqlite3", dbConfig.ConnectionString)
+		if dbConfig.ConnectionString == ":memory:" {
+			return dm.openSQLiteDatabase("default", memoryDSN())
+		}
+		return dm.openSQLiteDatabase("default", dbConfig.ConnectionString)
 		
 	case config.DatabaseTypeMySQL:
 		dm.logger.Printf("Creating MySQL default database connection to: %s", dbConfig.MySQLHost)
-		return sql.Open("mysql", dbConfig.ConnectionString)
+		return openMySQLDatabase(dbConfig)
 		
 	default:
 		return nil, fmt.Errorf("unsupported database type: %s", dbConfig.Type)
 	}
 }
 
+// mysqlDriverName is the database/sql driver used for a MySQL default database
+var mysqlDriverName = "mysql"
+
+// mysqlPingTimeout bounds the startup connectivity check of a MySQL default database
+const mysqlPingTimeout = 5 * time.Second
+
+// openMySQLDatabase opens a MySQL default database with the configured connection pool and pings
+// it, so an unreachable server or bad credentials fail at startup rather than on the first query
+func openMySQLDatabase(dbConfig *config.DefaultDatabaseConfig) (*sql.DB, error) {
+	db, err := sql.Open(mysqlDriverName, dbConfig.ConnectionString)
+	if err != nil {
+		return nil, err
+	}
+	
+	maxOpen, maxIdle, maxLifetime := dbConfig.PoolSettings()
+	db.SetMaxOpenConns(maxOpen)
+	db.SetMaxIdleConns(maxIdle)
+	db.SetConnMaxLifetime(maxLifetime)
+	
+	ctx, cancel := context.WithTimeout(context.Background(), mysqlPingTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to MySQL at %s: %v", dbConfig.MySQLHost, err)
+	}
+	return db, nil
+}
+
 // GetOrCreateDatabase gets or creates a database for the specified idx
 func (dm *DatabaseManager) GetOrCreateDatabase(idx string) (*sql.DB, error) {
-	dm.dbMu.Lock()
-	defer dm.dbMu.Unlock()
+	db, _, err := dm.getOrCreateDatabase(idx)
+	return db, err
+}
+
+// getOrCreateDatabase gets or creates a database for idx, also returning its last-access
+// timestamp so cached lookups can keep it current without taking dbMu
+func (dm *DatabaseManager) getOrCreateDatabase(idx string) (*sql.DB, *atomic.Int64, error) {
+	// Fast path: the database usually exists already, which only needs a read lock. The
+	// last-access timestamp is atomic, so recording the access doesn't need the write lock.
+	key := idx
+	if key == "" {
+		key = "default"
+	}
+	dm.dbMu.RLock()
+	key = dm.resolveAliasLocked(key)
+	db, exists := dm.databases[key]
+	access := dm.lastAccess[key]
+	dm.dbMu.RUnlock()
+	if exists && access != nil {
+		access.Store(time.Now().UnixNano())
+		return db, access, nil
+	}
+	
+	// Slow path: take the write lock; getOrCreateDatabaseLocked checks again in case another
+	// caller created the database in the meantime
+	dm.lockWhenClosed(key)
+	db, access, evicted, err := dm.getOrCreateDatabaseLocked(idx)
+	dm.dbMu.Unlock()
+	
+	dm.finishEviction(evicted)
+	if err != nil {
+		dm.RecordTenantError(idx, err)
+	}
 	
+	return db, access, err
+}
+
+// getOrCreateDatabaseLocked does the work of getOrCreateDatabase, also returning any tenant
+// evicted to make room. Callers must hold dbMu for writing and pass the evicted tenant to
+// finishEviction once it is released.
+func (dm *DatabaseManager) getOrCreateDatabaseLocked(idx string) (*sql.DB, *atomic.Int64, *removedDatabase, error) {
 	// If idx is empty, use default
 	if idx == "" {
 		idx = "default"
 	}
+	idx = dm.resolveAliasLocked(idx)
 	
 	// Check if database already exists
 	if db, exists := dm.databases[idx]; exists {
-		return db, nil
+		return db, dm.touchLocked(idx), nil, nil
+	}
+	
+	return dm.createDatabaseLocked(idx, true)
+}
+
+// createDatabaseLocked creates the database for idx, which must not exist yet, optionally with
+// the sample tables and rows. It also returns any tenant evicted to make room. Callers must hold
+// dbMu, taken with lockWhenClosed, for writing and pass the evicted tenant to finishEviction once
+// it is released.
+func (dm *DatabaseManager) createDatabaseLocked(idx string, seed bool) (*sql.DB, *atomic.Int64, *removedDatabase, error) {
+	// Stay within the tenant cap, evicting or refusing as configured
+	var evicted *removedDatabase
+	if !dm.isDefaultDatabase(idx) {
+		var err error
+		if evicted, err = dm.makeRoomLocked(); err != nil {
+			return nil, nil, nil, err
+		}
 	}
 	
-	// Create new in-memory database for this idx
-	db, err := sql.Open("sqlite3", ":memory:")
+	// Open (or create) the database for this idx from the tenant store
+	db, err := dm.openFromStoreLocked(idx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create database for idx %s: %v", idx, err)
+		return nil, nil, evicted, err
 	}
 	
+	dm.applyConnectionAffinity(idx, db)
+	
 	dm.databases[idx] = db
+	access := dm.touchLocked(idx)
+	dm.markDatabasesModified()
+	dm.markSchemaModifiedLocked(idx)
 	dm.logger.Printf("Created new database for idx: %s", idx)
 	
 	// Initialize with sample data
-	dm.initSampleData(idx)
+	if seed {
+		dm.initSampleData(idx)
+	}
 	
-	return db, nil
+	return db, access, evicted, nil
+}
+
+// ErrDatabaseExists is returned by CreateDatabase when the database for idx already exists
+var ErrDatabaseExists = errors.New("database already exists")
+
+// ErrInvalidSchema is returned by CreateDatabase when the schema SQL is rejected or fails to run
+var ErrInvalidSchema = errors.New("invalid schema")
+
+// schemaForbiddenRegex matches statements that reach outside the tenant database, which are
+// not allowed in a schema once quoted text has been blanked out
+var schemaForbiddenRegex = regexp.MustCompile(`(?i)\b(attach|detach|vacuum\s+into)\b`)
+
+// CreateDatabase creates a new database for idx, with the sample data when seed is set, and then
+// runs schemaSQL in a transaction. If the schema fails the database is removed again, so the
+// tenant is either fully provisioned or not created at all. A tenant the store has persisted
+// already exists, even while it is not open. The schema runs without holding dbMu, so a slow
+// schema never stalls the other tenants.
+func (dm *DatabaseManager) CreateDatabase(idx string, seed bool, schemaSQL string) error {
+	if idx == "" {
+		idx = "default"
+	}
+	if match := schemaForbiddenRegex.FindString(blankQuoted(schemaSQL)); match != "" {
+		return fmt.Errorf("%w: %s is not allowed", ErrInvalidSchema, strings.ToUpper(match))
+	}
+	
+	dm.lockWhenClosed(idx)
+	if _, isAlias := dm.aliases[idx]; isAlias {
+		dm.dbMu.Unlock()
+		return fmt.Errorf("%w: idx %s is an alias", ErrDatabaseExists, idx)
+	}
+	if _, exists := dm.databases[idx]; exists || dm.storedLocked(idx) {
+		dm.dbMu.Unlock()
+		return fmt.Errorf("%w: idx %s", ErrDatabaseExists, idx)
+	}
+	db, _, evicted, err := dm.createDatabaseLocked(idx, seed)
+	dm.dbMu.Unlock()
+	
+	dm.finishEviction(evicted)
+	if err != nil || strings.TrimSpace(schemaSQL) == "" {
+		return err
+	}
+	
+	schemaErr := applySchema(db, schemaSQL)
+	dm.dbMu.Lock()
+	if schemaErr == nil {
+		dm.markSchemaModifiedLocked(idx)
+		dm.dbMu.Unlock()
+		dm.logger.Printf("Applied schema to database for idx: %s", idx)
+		return nil
+	}
+	
+	// The storage was created by this call, as idx was neither open nor stored, so removing it
+	// loses nothing. It is left alone if the tenant was deleted or replaced in the meantime.
+	var removed *removedDatabase
+	if dm.databases[idx] == db {
+		removed = dm.removeDatabaseLocked(idx, db, true)
+	}
+	dm.dbMu.Unlock()
+	if removed != nil {
+		dm.fireCloseHooks(idx)
+		dm.closeRemoved(removed)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidSchema, schemaErr)
+}
+
+// applySchema runs the statements in schemaSQL against db in a single transaction
+func applySchema(db *sql.DB, schemaSQL string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+	
+	if _, err := tx.Exec(schemaSQL); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// touchLocked records an access to the database for idx. Callers must hold dbMu for writing.
+func (dm *DatabaseManager) touchLocked(idx string) *atomic.Int64 {
+	access, exists := dm.lastAccess[idx]
+	if !exists {
+		access = new(atomic.Int64)
+		dm.lastAccess[idx] = access
+	}
+	access.Store(time.Now().UnixNano())
+	return access
+}
+
+// HasDatabase reports whether a database for idx already exists, without creating it. Tenants
+// the store has persisted exist even while they are not open, as ListDatabases shows them.
+func (dm *DatabaseManager) HasDatabase(idx string) bool {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	
+	// If idx is empty, use default
+	if idx == "" {
+		idx = "default"
+	}
+	idx = dm.resolveAliasLocked(idx)
+	
+	if _, exists := dm.databases[idx]; exists {
+		return true
+	}
+	return dm.storedLocked(idx)
+}
+
+// storedLocked reports whether the tenant store has persisted idx. Callers must hold dbMu.
+func (dm *DatabaseManager) storedLocked(idx string) bool {
+	stored, err := dm.store.List()
+	if err != nil {
+		dm.logger.Printf("Error listing tenant store: %v", err)
+		return false
+	}
+	return slices.Contains(stored, idx)
+}
+
+// LastAccessedAt returns when the database for idx was last used, and false when it is not open
+func (dm *DatabaseManager) LastAccessedAt(idx string) (time.Time, bool) {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	
+	if idx == "" {
+		idx = "default"
+	}
+	access, exists := dm.lastAccess[dm.resolveAliasLocked(idx)]
+	if !exists || access == nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, access.Load()), true
+}
+
+// existingDatabase returns the SQLite database already open for idx without creating one, and
+// false when there is none or the default database is on MySQL
+func (dm *DatabaseManager) existingDatabase(idx string) (*sql.DB, bool) {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	
+	if idx == "" {
+		idx = "default"
+	}
+	idx = dm.resolveAliasLocked(idx)
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return nil, false
+	}
+	
+	db, exists := dm.databases[idx]
+	return db, exists
+}
+
+// openDatabase returns the database for idx, opening it from the tenant store when the store has
+// persisted it but it is not open, and false when the tenant does not exist. Unlike
+// GetOrCreateDatabase it never creates a tenant.
+func (dm *DatabaseManager) openDatabase(idx string) (*sql.DB, bool, error) {
+	if idx == "" {
+		idx = "default"
+	}
+	dm.lockWhenClosed(idx)
+	idx = dm.resolveAliasLocked(idx)
+	if db, exists := dm.databases[idx]; exists {
+		dm.touchLocked(idx)
+		dm.dbMu.Unlock()
+		return db, true, nil
+	}
+	if !dm.storedLocked(idx) {
+		dm.dbMu.Unlock()
+		return nil, false, nil
+	}
+	db, _, evicted, err := dm.createDatabaseLocked(idx, true)
+	dm.dbMu.Unlock()
+	
+	dm.finishEviction(evicted)
+	if err != nil {
+		dm.RecordTenantError(idx, err)
+		return nil, true, err
+	}
+	return db, true, nil
 }
 
-// GetDatabaseForSession gets the database for a specific session
+// GetDatabaseForSession gets the database for a specific session. The resolved database is
+// cached on the session until its tenant changes or a database is deleted or evicted.
 func (dm *DatabaseManager) GetDatabaseForSession(session *SessionVariables) (*sql.DB, error) {
-	// Get idx from session (user-defined session variable @idx)
-	var idx string
-	if idxVar, exists := session.GetUser("idx"); exists && idxVar != nil {
-		idx = fmt.Sprintf("%v", idxVar)
+	generation := dm.generation.Load()
+	tenant := session.CurrentTenant()
+	if cached := session.cachedDatabase(tenant, generation); cached != nil {
+		cached.lastAccess.Store(time.Now().UnixNano())
+		return cached.db, nil
+	}
+	
+	db, access, err := dm.getOrCreateDatabase(tenant)
+	if err != nil {
+		return nil, err
 	}
+	session.cacheDatabase(&sessionDBCache{db: db, lastAccess: access, generation: generation, tenant: tenant})
 	
-	return dm.GetOrCreateDatabase(idx)
+	return db, nil
 }
 
-// Initialize with some sample data
+// sampleTables lists the tables created by initSampleData
+var sampleTables = []string{"users", "products"}
+
+// Initialize with some sample data. Rows use fixed ids so re-running never duplicates them.
 func (dm *DatabaseManager) initSampleData(idx string) {
 	db, exists := dm.databases[idx]
 	if !exists {
 		dm.logger.Printf("Database for idx %s not found, cannot initialize sample data", idx)
 		return
 	}
-	
+	dm.createSampleData(db, idx)
+}
+
+// createSampleData creates the sample tables and rows in db, which holds or stands in for the
+// database of idx
+func (dm *DatabaseManager) createSampleData(db *sql.DB, idx string) {
 	// Determine if this is a MySQL or SQLite database
 	isMySQL := dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL
 	
-	var createUsersTable, createProductsTable, insertUsers, insertProducts string
+	var createUsersTable, createProductsTable, insertVerb string
 	
 	if isMySQL {
 		// MySQL syntax
@@ -148,17 +649,7 @@ func (dm *DatabaseManager) initSampleData(idx string) {
 				category VARCHAR(255)
 			)`
 		
-		insertUsers = `
-			INSERT IGNORE INTO users (name, email, age) VALUES 
-			('Alice', 'alice@example.com', 30),
-			('Bob', 'bob@example.com', 25),
-			('Charlie', 'charlie@example.com', 35)`
-		
-		insertProducts = `
-			INSERT IGNORE INTO products (name, price, category) VALUES 
-			('Laptop', 999.99, 'electronics'),
-			('Book', 19.99, 'education'),
-			('Coffee', 4.99, 'beverages')`
+		insertVerb = "INSERT IGNORE"
 	} else {
 		// SQLite syntax
 		createUsersTable = `
@@ -177,17 +668,7 @@ func (dm *DatabaseManager) initSampleData(idx string) {
 				category TEXT
 			)`
 		
-		insertUsers = `
-			INSERT OR IGNORE INTO users (name, email, age) VALUES 
-			('Alice', 'alice@example.com', 30),
-			('Bob', 'bob@example.com', 25),
-			('Charlie', 'charlie@example.com', 35)`
-		
-		insertProducts = `
-			INSERT OR IGNORE INTO products (name, price, category) VALUES 
-			('Laptop', 999.99, 'electronics'),
-			('Book', 19.99, 'education'),
-			('Coffee', 4.99, 'beverages')`
+		insertVerb = "INSERT OR IGNORE"
 	}
 	
 	// Create users table
@@ -205,15 +686,13 @@ func (dm *DatabaseManager) initSampleData(idx string) {
 	}
 	
 	// Insert sample users
-	_, err = db.Exec(insertUsers)
-	if err != nil {
+	if err := insertSampleRows(db, insertVerb+" INTO users (id, name, email, age) VALUES ", dm.sampleRows, sampleUser); err != nil {
 		dm.logger.Printf("Failed to insert sample users for idx %s: %v", idx, err)
 		return
 	}
 	
 	// Insert sample products
-	_, err = db.Exec(insertProducts)
-	if err != nil {
+	if err := insertSampleRows(db, insertVerb+" INTO products (id, name, price, category) VALUES ", dm.sampleRows, sampleProduct); err != nil {
 		dm.logger.Printf("Failed to insert sample products for idx %s: %v", idx, err)
 		return
 	}
@@ -221,73 +700,1026 @@ func (dm *DatabaseManager) initSampleData(idx string) {
 	dm.logger.Printf("Sample data initialized successfully for idx: %s", idx)
 }
 
-// isDefaultDatabase checks if the given idx represents the default database
-func (dm *DatabaseManager) isDefaultDatabase(idx string) bool {
-	return idx == "" || idx == "default"
-}
+// sampleRowsPerInsert bounds the rows per INSERT so the placeholders stay under SQLite's limit of 999
+const sampleRowsPerInsert = 200
 
-// Close closes all database connections
-func (dm *DatabaseManager) Close() error {
-	dm.dbMu.Lock()
-	defer dm.dbMu.Unlock()
-	
-	for idx, db := range dm.databases {
-		if err := db.Close(); err != nil {
-			dm.logger.Printf("Error closing database for idx %s: %v", idx, err)
-		}
+// Hand-written sample rows; any further rows are generated by sampleUser and sampleProduct
+var (
+	baseSampleUsers = [][]interface{}{
+		{"Alice", "alice@example.com", 30},
+		{"Bob", "bob@example.com", 25},
+		{"Charlie", "charlie@example.com", 35},
 	}
-	return nil
+	baseSampleProducts = [][]interface{}{
+		{"Laptop", 999.99, "electronics"},
+		{"Book", 19.99, "education"},
+		{"Coffee", 4.99, "beverages"},
+	}
+)
+
+// sampleUser returns the id, name, email and age of sample user id (counting from 1)
+func sampleUser(id int) []interface{} {
+	if id <= len(baseSampleUsers) {
+		return append([]interface{}{id}, baseSampleUsers[id-1]...)
+	}
+	return []interface{}{id, fmt.Sprintf("User %d", id), fmt.Sprintf("user%d@example.com", id), 18 + id%60}
 }
 
-// ListDatabases returns a list of all database indices
-func (dm *DatabaseManager) ListDatabases() []string {
-	dm.dbMu.RLock()
-	defer dm.dbMu.RUnlock()
-	
-	var indices []string
-	for idx := range dm.databases {
-		indices = append(indices, idx)
+// sampleProduct returns the id, name, price and category of sample product id (counting from 1)
+func sampleProduct(id int) []interface{} {
+	if id <= len(baseSampleProducts) {
+		return append([]interface{}{id}, baseSampleProducts[id-1]...)
 	}
-	return indices
+	category := baseSampleProducts[id%len(baseSampleProducts)][2]
+	return []interface{}{id, fmt.Sprintf("Product %d", id), float64(id%1000) + 0.99, category}
 }
 
-// GetActiveDatabases returns a map of all active databases (for SHOW DATABASES)
-func (dm *DatabaseManager) GetActiveDatabases() map[string]*sql.DB {
-	dm.dbMu.RLock()
-	defer dm.dbMu.RUnlock()
+// insertSampleRows inserts rows 1..count built by row, several per statement, in one transaction.
+// insertPrefix is the INSERT statement up to and including VALUES.
+func insertSampleRows(db *sql.DB, insertPrefix string, count int, row func(id int) []interface{}) error {
+	if count <= 0 {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 	
-	// Return a copy of the map to avoid external modification
-	result := make(map[string]*sql.DB)
-	for idx, db := range dm.databases {
-		result[idx] = db
+	for first := 1; first <= count; first += sampleRowsPerInsert {
+		last := first + sampleRowsPerInsert - 1
+		if last > count {
+			last = count
+		}
+		placeholders := make([]string, 0, last-first+1)
+		args := make([]interface{}, 0, 4*(last-first+1))
+		for id := first; id <= last; id++ {
+			placeholders = append(placeholders, "(?, ?, ?, ?)")
+			args = append(args, row(id)...)
+		}
+		if _, err := tx.Exec(insertPrefix+strings.Join(placeholders, ", "), args...); err != nil {
+			return err
+		}
 	}
-	return result
+	return tx.Commit()
 }
 
-// DeleteDatabase removes a database for a specific idx
-func (dm *DatabaseManager) DeleteDatabase(idx string) error {
+// SetSampleDataRows sets how many sample users and products initSampleData seeds into databases
+// created or seeded from now on
+func (dm *DatabaseManager) SetSampleDataRows(rows int) {
 	dm.dbMu.Lock()
 	defer dm.dbMu.Unlock()
+	dm.sampleRows = rows
+}
+
+// SeedSampleData creates the sample tables and rows for idx if they are missing, without
+// duplicating existing rows, and returns the resulting row count per sample table
+func (dm *DatabaseManager) SeedSampleData(idx string) (map[string]int64, error) {
+	if idx == "" {
+		idx = "default"
+	}
 	
-	// Don't allow deletion of default database
-	if idx == "" || idx == "default" {
-		return fmt.Errorf("cannot delete default database")
+	dm.dbMu.Lock()
+	idx = dm.resolveAliasLocked(idx)
+	db, exists := dm.databases[idx]
+	if !exists {
+		dm.dbMu.Unlock()
+		return nil, fmt.Errorf("database for idx %s does not exist", idx)
 	}
+	dm.initSampleData(idx)
+	dm.markSchemaModifiedLocked(idx)
+	dm.dbMu.Unlock()
 	
-	// Check if database exists
+	counts := make(map[string]int64)
+	for _, table := range sampleTables {
+		var count int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows in %s for idx %s: %v", table, idx, err)
+		}
+		counts[table] = count
+	}
+	
+	return counts, nil
+}
+
+// TruncateDatabase deletes every row from every user table for idx while keeping the table
+// definitions, optionally resetting AUTOINCREMENT sequences. Returns the truncated table names.
+func (dm *DatabaseManager) TruncateDatabase(idx string, resetSequences bool) ([]string, error) {
+	if idx == "" {
+		idx = "default"
+	}
+	if dm.blocksDestructive(idx) {
+		return nil, fmt.Errorf("%w: truncating is disabled for idx %s", ErrDestructiveStatement, idx)
+	}
+	
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
 	db, exists := dm.databases[idx]
+	dm.dbMu.RUnlock()
 	if !exists {
-		return fmt.Errorf("database for idx %s does not exist", idx)
+		return nil, fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return nil, fmt.Errorf("truncating a MySQL default database is not supported")
+	}
+	
+	// Run on a single transaction so readers never see a half-truncated database
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin truncate for idx %s: %v", idx, err)
 	}
+	defer tx.Rollback()
 	
-	// Close the database connection
-	if err := db.Close(); err != nil {
-		dm.logger.Printf("Error closing database for idx %s: %v", idx, err)
+	userTables, err := listUserTables(tx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables for idx %s: %v", idx, err)
 	}
 	
-	// Remove from map
-	delete(dm.databases, idx)
-	dm.logger.Printf("Database deleted for idx: %s", idx)
+	var tables []string
+	for _, userTable := range userTables {
+		table := userTable.Name
+		tables = append(tables, table)
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM \"%s\"", strings.ReplaceAll(table, "\"", "\"\""))); err != nil {
+			return nil, fmt.Errorf("failed to truncate %s for idx %s: %v", table, idx, err)
+		}
+	}
+	
+	if resetSequences {
+		// sqlite_sequence only exists once a table with AUTOINCREMENT has been created
+		var hasSequences int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name='sqlite_sequence'").Scan(&hasSequences); err != nil {
+			return nil, fmt.Errorf("failed to check sequences for idx %s: %v", idx, err)
+		}
+		if hasSequences > 0 {
+			if _, err := tx.Exec("DELETE FROM sqlite_sequence"); err != nil {
+				return nil, fmt.Errorf("failed to reset sequences for idx %s: %v", idx, err)
+			}
+		}
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit truncate for idx %s: %v", idx, err)
+	}
+	
+	dm.logger.Printf("Truncated %d tables for idx: %s", len(tables), idx)
+	return tables, nil
+}
+
+// IndexInfo describes one index on a tenant table
+type IndexInfo struct {
+	Name    string
+	Table   string
+	Unique  bool
+	Columns []string // Indexed columns in index order
+}
+
+// ListIndexes returns the indexes on every user table for idx, ordered by table and index name,
+// including the automatic indexes SQLite creates for PRIMARY KEY and UNIQUE constraints. A tenant
+// the store has persisted is opened if it is not open.
+func (dm *DatabaseManager) ListIndexes(idx string) ([]IndexInfo, error) {
+	if idx == "" {
+		idx = "default"
+	}
+	
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+	db, exists, err := dm.openDatabase(idx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database for idx %s: %v", idx, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return nil, fmt.Errorf("listing indexes of a MySQL default database is not supported")
+	}
+	
+	userTables, err := listUserTables(db, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables for idx %s: %v", idx, err)
+	}
+	
+	indexes := []IndexInfo{}
+	for _, userTable := range userTables {
+		table := userTable.Name
+		rows, err := db.Query(fmt.Sprintf("PRAGMA index_list(\"%s\")", strings.ReplaceAll(table, "\"", "\"\"")))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list indexes of %s for idx %s: %v", table, idx, err)
+		}
+		var tableIndexes []IndexInfo
+		for rows.Next() {
+			// index_list columns: seq, name, unique, origin, partial
+			var seq, unique, partial int
+			var name, origin string
+			if err := rows.Scan(&seq, &name, &unique, &origin, &partial); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan index of %s: %v", table, err)
+			}
+			tableIndexes = append(tableIndexes, IndexInfo{Name: name, Table: table, Unique: unique != 0})
+		}
+		rows.Close()
+		
+		sort.Slice(tableIndexes, func(i, j int) bool { return tableIndexes[i].Name < tableIndexes[j].Name })
+		for i := range tableIndexes {
+			columns, err := indexColumns(db, tableIndexes[i].Name)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read index %s for idx %s: %v", tableIndexes[i].Name, idx, err)
+			}
+			tableIndexes[i].Columns = columns
+		}
+		indexes = append(indexes, tableIndexes...)
+	}
+	
+	return indexes, nil
+}
+
+// indexColumns returns the column names of an index in index order. Expression columns, which
+// have no name, are reported as "<expression>".
+func indexColumns(db *sql.DB, index string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA index_info(\"%s\")", strings.ReplaceAll(index, "\"", "\"\"")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	columns := []string{}
+	for rows.Next() {
+		// index_info columns: seqno, cid, name
+		var seqno, cid int
+		var name sql.NullString
+		if err := rows.Scan(&seqno, &cid, &name); err != nil {
+			return nil, err
+		}
+		if !name.Valid {
+			columns = append(columns, "<expression>")
+			continue
+		}
+		columns = append(columns, name.String)
+	}
+	return columns, rows.Err()
+}
+
+// CopyDatabase copies every user table and row from srcIdx into dstIdx in a single transaction on
+// the target, creating tables the target lacks. Rows whose key already exists in the target are
+// kept as they are. Returns the resulting row count per copied table in the target.
+func (dm *DatabaseManager) CopyDatabase(srcIdx, dstIdx string) (map[string]int64, error) {
+	if srcIdx == "" {
+		srcIdx = "default"
+	}
+	if dstIdx == "" {
+		dstIdx = "default"
+	}
+	if srcIdx == dstIdx {
+		return nil, fmt.Errorf("cannot copy database for idx %s onto itself", srcIdx)
+	}
+	
+	dm.dbMu.RLock()
+	srcIdx, dstIdx = dm.resolveAliasLocked(srcIdx), dm.resolveAliasLocked(dstIdx)
+	src, srcExists := dm.databases[srcIdx]
+	dst, dstExists := dm.databases[dstIdx]
+	dm.dbMu.RUnlock()
+	if srcIdx == dstIdx {
+		return nil, fmt.Errorf("cannot copy database for idx %s onto itself", srcIdx)
+	}
+	if !srcExists {
+		return nil, fmt.Errorf("database for idx %s does not exist", srcIdx)
+	}
+	if !dstExists {
+		return nil, fmt.Errorf("database for idx %s does not exist", dstIdx)
+	}
+	for _, idx := range []string{srcIdx, dstIdx} {
+		if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+			return nil, fmt.Errorf("copying to or from a MySQL default database is not supported")
+		}
+	}
+	
+	// Read the source on one transaction so it is a consistent snapshot
+	srcTx, err := src.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin reading idx %s: %v", srcIdx, err)
+	}
+	defer srcTx.Rollback()
+	
+	// Write the target on one transaction so the copy lands all at once or not at all
+	dstTx, err := dst.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin copy into idx %s: %v", dstIdx, err)
+	}
+	defer dstTx.Rollback()
+	
+	rows, err := srcTx.Query("SELECT name, sql FROM sqlite_master WHERE type='table' AND " + userTablesFilter + " ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables for idx %s: %v", srcIdx, err)
+	}
+	schemas := make(map[string]string)
+	var tables []string
+	for rows.Next() {
+		var table, schema string
+		if err := rows.Scan(&table, &schema); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan table definition: %v", err)
+		}
+		tables = append(tables, table)
+		schemas[table] = schema
+	}
+	rows.Close()
+	
+	counts := make(map[string]int64)
+	for _, table := range tables {
+		quoted := "\"" + strings.ReplaceAll(table, "\"", "\"\"") + "\""
+		
+		var exists int
+		if err := dstTx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name = ?", table).Scan(&exists); err != nil {
+			return nil, fmt.Errorf("failed to check table %s in idx %s: %v", table, dstIdx, err)
+		}
+		if exists == 0 {
+			if _, err := dstTx.Exec(schemas[table]); err != nil {
+				return nil, fmt.Errorf("failed to create table %s in idx %s: %v", table, dstIdx, err)
+			}
+		}
+		
+		if err := copyTableRows(srcTx, dstTx, quoted); err != nil {
+			return nil, fmt.Errorf("failed to copy table %s from idx %s to idx %s: %v", table, srcIdx, dstIdx, err)
+		}
+		
+		var count int64
+		if err := dstTx.QueryRow("SELECT COUNT(*) FROM " + quoted).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows in %s for idx %s: %v", table, dstIdx, err)
+		}
+		counts[table] = count
+	}
+	
+	if err := dstTx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit copy into idx %s: %v", dstIdx, err)
+	}
+	dm.markSchemaModifiedLocked(dstIdx) // Tables missing from dstIdx were created
+	
+	dm.logger.Printf("Copied %d tables from idx %s to idx %s", len(tables), srcIdx, dstIdx)
+	return counts, nil
+}
+
+// copyTableRows inserts every row of the quoted table from src into the same table in dst,
+// leaving rows that already exist in dst untouched
+func copyTableRows(src, dst *sql.Tx, quoted string) error {
+	rows, err := src.Query("SELECT * FROM " + quoted)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+	quotedColumns := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		quotedColumns[i] = "\"" + strings.ReplaceAll(column, "\"", "\"\"") + "\""
+		placeholders[i] = "?"
+	}
+	
+	insert, err := dst.Prepare(fmt.Sprintf("INSERT OR IGNORE INTO %s (%s) VALUES (%s)",
+		quoted, strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", ")))
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+	
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return err
+		}
+		if _, err := insert.Exec(values...); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// QueryResult holds the outcome of a statement run through ExecuteQuery
+type QueryResult struct {
+	Columns      []string
+	Rows         [][]interface{}
+	RowsAffected int64
+	LastInsertID int64
+	SQL          string // Statement as handed to the database driver
+	Idx          string // Tenant the statement ran against
+}
+
+// ErrInvalidQuery is returned by ExecuteQuery when the statement itself is at fault: SQLite
+// rejected it, or it targets the reserved query log table
+var ErrInvalidQuery = errors.New("invalid query")
+
+// queryError wraps err in ErrInvalidQuery when SQLite rejected the statement - a syntax error, an
+// unknown table or column, or a violated constraint - so callers can tell bad SQL apart from a
+// database that could not run it
+func queryError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code {
+		case sqlite3.ErrError, sqlite3.ErrConstraint, sqlite3.ErrMismatch, sqlite3.ErrRange, sqlite3.ErrTooBig:
+			return fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+		}
+	}
+	return err
+}
+
+// ExecuteQuery runs query against the database for idx, binding args to its ? placeholders.
+// Failed statements are recorded as the tenant's last error.
+func (dm *DatabaseManager) ExecuteQuery(idx string, query string, args []interface{}) (*QueryResult, error) {
+	result, err := dm.executeQuery(idx, query, args, nil)
+	if err != nil {
+		dm.RecordTenantError(idx, err)
+	}
+	return result, err
+}
+
+// queryRewriter rewrites a statement and its args before it runs against db
+type queryRewriter func(db sqlQuerier, query string, args []interface{}) (string, []interface{})
+
+// executeQuery does the work of ExecuteQuery, running query through rewrite first when it is set
+func (dm *DatabaseManager) executeQuery(idx string, query string, args []interface{}, rewrite queryRewriter) (*QueryResult, error) {
+	db, err := dm.GetOrCreateDatabase(idx)
+	if err != nil {
+		return nil, err
+	}
+	if idx == "" {
+		idx = "default"
+	}
+	if err := dm.checkDestructive(idx, query); err != nil {
+		return nil, err
+	}
+	if writesQueryLog(query) {
+		return nil, fmt.Errorf("%w: table %s is reserved for the query log and cannot be changed", ErrInvalidQuery, colocatedQueryLogTable)
+	}
+	if rewrite != nil {
+		query, args = rewrite(db, query, args)
+	}
+	
+	if !returnsRows(query) {
+		result, err := db.Exec(query, args...)
+		if err != nil {
+			return nil, queryError(err)
+		}
+		if isDDLStatement(query) {
+			dm.markSchemaModified(idx)
+		}
+		queryResult := &QueryResult{SQL: query, Idx: idx}
+		queryResult.RowsAffected, _ = result.RowsAffected()
+		queryResult.LastInsertID, _ = result.LastInsertId()
+		return queryResult, nil
+	}
+	
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, queryError(err)
+	}
+	defer rows.Close()
+	
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get columns: %v", err)
+	}
+	
+	queryResult := &QueryResult{Columns: columns, Rows: [][]interface{}{}, SQL: query, Idx: idx}
+	for rows.Next() {
+		columnValues := make([]interface{}, len(columns))
+		columnPointers := make([]interface{}, len(columns))
+		for i := range columnValues {
+			columnPointers[i] = &columnValues[i]
+		}
+		
+		if err := rows.Scan(columnPointers...); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %v", err)
+		}
+		
+		// Convert []byte to string for text columns, keep other driver types as-is
+		for i, val := range columnValues {
+			if b, ok := val.([]byte); ok {
+				columnValues[i] = string(b)
+			}
+		}
+		queryResult.Rows = append(queryResult.Rows, columnValues)
+	}
+	
+	if err := rows.Err(); err != nil {
+		return nil, queryError(fmt.Errorf("rows iteration error: %w", err))
+	}
+	
+	return queryResult, nil
+}
+
+// StreamQuery runs a read-only query against the database for idx and calls fn with each row as
+// it is scanned, so large results are never held in memory. The query runs on a connection with
+// PRAGMA query_only set, so statements that would change data fail. Returning an error from fn
+// stops the scan and is returned. Failures are recorded as the tenant's last error.
+func (dm *DatabaseManager) StreamQuery(idx string, query string, fn func(columns []string, values []interface{}) error) error {
+	err := dm.streamQuery(idx, query, fn)
+	if err != nil {
+		dm.RecordTenantError(idx, err)
+	}
+	return err
+}
+
+// streamQuery does the work of StreamQuery
+func (dm *DatabaseManager) streamQuery(idx string, query string, fn func(columns []string, values []interface{}) error) error {
+	db, err := dm.GetOrCreateDatabase(idx)
+	if err != nil {
+		return err
+	}
+	
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get connection: %v", err)
+	}
+	defer conn.Close()
+	
+	// A MySQL default database has no query_only pragma; callers only send it SELECTs
+	if !(dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL) {
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return fmt.Errorf("failed to make connection read only: %v", err)
+		}
+		defer func() {
+			// The connection goes back to the pool, so it must accept writes again
+			if _, err := conn.ExecContext(ctx, "PRAGMA query_only = OFF"); err != nil {
+				dm.logger.Printf("Failed to reset query_only for idx %s: %v", idx, err)
+			}
+		}()
+	}
+	
+	rows, err := conn.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	
+	columns, err := rows.Columns()
+	if err != nil {
+		return fmt.Errorf("failed to get columns: %v", err)
+	}
+	
+	for rows.Next() {
+		columnValues := make([]interface{}, len(columns))
+		columnPointers := make([]interface{}, len(columns))
+		for i := range columnValues {
+			columnPointers[i] = &columnValues[i]
+		}
+		
+		if err := rows.Scan(columnPointers...); err != nil {
+			return fmt.Errorf("failed to scan row: %v", err)
+		}
+		
+		// Convert []byte to string for text columns, keep other driver types as-is
+		for i, val := range columnValues {
+			if b, ok := val.([]byte); ok {
+				columnValues[i] = string(b)
+			}
+		}
+		if err := fn(columns, columnValues); err != nil {
+			return err
+		}
+	}
+	
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows iteration error: %v", err)
+	}
+	return nil
+}
+
+// statementKeyword returns the lowercased leading keyword of a statement
+func statementKeyword(query string) string {
+	fields := strings.Fields(strings.ToLower(query))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.TrimLeft(fields[0], "(")
+}
+
+// isDataChange reports whether a statement is an INSERT, UPDATE, DELETE or REPLACE
+func isDataChange(query string) bool {
+	switch statementKeyword(query) {
+	case "insert", "update", "delete", "replace":
+		return true
+	}
+	return false
+}
+
+// isWriteStatement reports whether a statement changes data or schema, and so is refused in a
+// READ ONLY transaction
+func isWriteStatement(query string) bool {
+	return isDataChange(query) || isDDLStatement(query)
+}
+
+// isDDLStatement reports whether a statement changes the schema, which MySQL commits implicitly
+func isDDLStatement(query string) bool {
+	switch statementKeyword(query) {
+	case "create", "drop", "alter", "truncate", "rename":
+		return true
+	}
+	return false
+}
+
+// returningRegex matches a RETURNING keyword once quoted text has been blanked out
+var returningRegex = regexp.MustCompile(`(?i)\breturning\b`)
+
+// hasReturningClause reports whether query has a RETURNING clause outside quoted strings and identifiers
+func hasReturningClause(query string) bool {
+	return returningRegex.MatchString(blankQuoted(query))
+}
+
+// blankQuoted replaces comments and the contents of quoted strings and identifiers in query with
+// spaces, so keywords and ? placeholders can be searched for without matching quoted or
+// commented-out text
+func blankQuoted(query string) string {
+	unquoted := []rune(blankComments(query))
+	var quote rune
+	for i, c := range unquoted {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+			unquoted[i] = ' '
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		}
+	}
+	return string(unquoted)
+}
+
+// blankComments replaces -- and # line comments and /* */ block comments outside quoted strings
+// and identifiers with spaces, so a comment can neither hide a keyword nor supply one. Positions
+// are kept, so the result lines up with query rune for rune.
+func blankComments(query string) string {
+	blanked := []rune(query)
+	var quote rune
+	for i := 0; i < len(blanked); i++ {
+		c := blanked[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || isDashComment(blanked[i:]):
+			for ; i < len(blanked) && blanked[i] != '\n'; i++ {
+				blanked[i] = ' '
+			}
+		case c == '/' && i+1 < len(blanked) && blanked[i+1] == '*':
+			end := i + 2
+			for end < len(blanked) && !(blanked[end] == '*' && end+1 < len(blanked) && blanked[end+1] == '/') {
+				end++
+			}
+			end = min(end+2, len(blanked))
+			for ; i < end; i++ {
+				blanked[i] = ' '
+			}
+			i--
+		}
+	}
+	return string(blanked)
+}
+
+// isDashComment reports whether rest starts a -- comment, which MySQL only recognises when the
+// dashes are followed by whitespace or end the query
+func isDashComment(rest []rune) bool {
+	if len(rest) < 2 || rest[0] != '-' || rest[1] != '-' {
+		return false
+	}
+	return len(rest) == 2 || strings.ContainsRune(" \t\r\n", rest[2])
+}
+
+// splitStatements splits query into its statements at the semicolons outside quoted strings and
+// identifiers, dropping the empty ones
+func splitStatements(query string) []string {
+	original := []rune(query)
+	var statements []string
+	start := 0
+	add := func(end int) {
+		if statement := strings.TrimSpace(string(original[start:end])); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	for i, c := range []rune(blankQuoted(query)) {
+		if c == ';' {
+			add(i)
+			start = i + 1
+		}
+	}
+	add(len(original))
+	return statements
+}
+
+// returnsRows reports whether a statement produces a result set rather than an affected-row count
+func returnsRows(query string) bool {
+	switch statementKeyword(query) {
+	case "select", "with", "pragma", "explain", "values", "show", "describe", "desc":
+		return true
+	case "insert", "update", "delete", "replace":
+		return hasReturningClause(query)
+	}
+	return false
+}
+
+// isDefaultDatabase checks if the given idx represents the default database
+func (dm *DatabaseManager) isDefaultDatabase(idx string) bool {
+	return idx == "" || idx == "default"
+}
+
+// onMySQL reports whether tenant, or the tenant it is an alias of, is the default database
+// configured on a MySQL server rather than SQLite
+func (dm *DatabaseManager) onMySQL(tenant string) bool {
+	if dm.defaultConfig == nil || dm.defaultConfig.Type != config.DatabaseTypeMySQL {
+		return false
+	}
+	if tenant == "" {
+		tenant = "default"
+	}
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	return dm.isDefaultDatabase(dm.resolveAliasLocked(tenant))
+}
+
+// Close closes all database connections
+func (dm *DatabaseManager) Close() error {
+	dm.StopIdleEviction()
+	dm.StopTenantExpiry()
+	
+	dm.dbMu.Lock()
+	defer dm.dbMu.Unlock()
+	
+	for idx, db := range dm.databases {
+		if err := dm.closeDatabase(idx, db); err != nil {
+			dm.logger.Printf("Error closing database for idx %s: %v", idx, err)
+		}
+	}
+	return nil
+}
+
+// removedDatabase is a tenant database removed by removeDatabaseLocked that is still open, so the
+// hooks fired for it can flush to it before closeRemoved closes it
+type removedDatabase struct {
+	idx           string
+	db            *sql.DB
+	deleteStorage bool
+	done          chan struct{}
+}
+
+// removeDatabaseLocked takes the database for idx out of service and forgets everything kept
+// about it, leaving it open. With deleteStorage its storage is to be removed too; otherwise a
+// tenant the store persists keeps its data and aliases. Callers must hold dbMu for writing and,
+// once it is released, fire the close hooks, directly or through the eviction or expiry hooks,
+// and then pass the result to closeRemoved. Until then lockWhenClosed holds off reopening idx.
+func (dm *DatabaseManager) removeDatabaseLocked(idx string, db *sql.DB, deleteStorage bool) *removedDatabase {
+	delete(dm.databases, idx)
+	delete(dm.lastAccess, idx)
+	dm.clearTenantDiagnosticsLocked(idx)
+	if deleteStorage || !dm.storedLocked(idx) {
+		dm.dropAliasesLocked(idx) // Its data is gone with the connection
+	}
+	dm.forgetModified(idx)
+	dm.generation.Add(1)
+	
+	removed := &removedDatabase{idx: idx, db: db, deleteStorage: deleteStorage, done: make(chan struct{})}
+	dm.closing[idx] = removed.done
+	return removed
+}
+
+// closeRemoved closes a database taken out of service by removeDatabaseLocked, deleting its
+// storage if asked to, and lets idx be opened again
+func (dm *DatabaseManager) closeRemoved(removed *removedDatabase) {
+	if removed.deleteStorage {
+		if err := dm.store.Delete(removed.idx, removed.db); err != nil {
+			dm.logger.Printf("Error deleting database for idx %s: %v", removed.idx, err)
+		}
+		dm.fireDeleteHooks(removed.idx)
+	} else if err := dm.closeDatabase(removed.idx, removed.db); err != nil {
+		dm.logger.Printf("Error closing database for idx %s: %v", removed.idx, err)
+	}
+	
+	dm.dbMu.Lock()
+	if dm.closing[removed.idx] == removed.done {
+		delete(dm.closing, removed.idx)
+	}
+	dm.dbMu.Unlock()
+	close(removed.done)
+}
+
+// lockWhenClosed takes dbMu for writing once no database of idx is still being closed, so a
+// tenant is never reopened, or its storage recreated, before its hooks have run and the old
+// database has been released. Hooks must therefore not reopen the tenant they fire for.
+func (dm *DatabaseManager) lockWhenClosed(idx string) {
+	dm.dbMu.Lock()
+	for {
+		done, closing := dm.closing[dm.resolveAliasLocked(idx)]
+		if !closing {
+			return
+		}
+		dm.dbMu.Unlock()
+		<-done
+		dm.dbMu.Lock()
+	}
+}
+
+// closeDatabase releases an open database, handing tenant databases back to the store
+func (dm *DatabaseManager) closeDatabase(idx string, db *sql.DB) error {
+	if dm.isDefaultDatabase(idx) {
+		return db.Close()
+	}
+	return dm.store.Close(idx, db)
+}
+
+// ListDatabases returns a list of all database indices
+func (dm *DatabaseManager) ListDatabases() []string {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	
+	var indices []string
+	for idx := range dm.databases {
+		indices = append(indices, idx)
+	}
+	
+	// Include tenants the store has persisted but that are not currently open
+	stored, err := dm.store.List()
+	if err != nil {
+		dm.logger.Printf("Error listing tenant store: %v", err)
+	}
+	for _, idx := range stored {
+		if _, open := dm.databases[idx]; !open {
+			indices = append(indices, idx)
+		}
+	}
+	return indices
+}
+
+// GetActiveDatabases returns a map of all active databases (for SHOW DATABASES)
+func (dm *DatabaseManager) GetActiveDatabases() map[string]*sql.DB {
+	dm.dbMu.RLock()
+	defer dm.dbMu.RUnlock()
+	
+	// Return a copy of the map to avoid external modification
+	result := make(map[string]*sql.DB)
+	for idx, db := range dm.databases {
+		result[idx] = db
+	}
+	return result
+}
+
+// DeleteDatabase removes a database for a specific idx, whether it is open or only persisted by
+// the tenant store
+func (dm *DatabaseManager) DeleteDatabase(idx string) error {
+	// Don't allow deletion of default database
+	if idx == "" || idx == "default" {
+		return fmt.Errorf("cannot delete default database")
+	}
+	
+	dm.lockWhenClosed(idx)
+	
+	// Check if database exists
+	db, exists := dm.databases[idx]
+	if !exists {
+		if !dm.storedLocked(idx) {
+			dm.dbMu.Unlock()
+			return fmt.Errorf("database for idx %s does not exist", idx)
+		}
+		// The store removes storage through the database it opened for idx
+		var err error
+		if db, err = dm.store.GetOrCreate(idx); err != nil {
+			dm.dbMu.Unlock()
+			return fmt.Errorf("failed to open stored database for idx %s: %v", idx, err)
+		}
+	}
+	
+	removed := dm.removeDatabaseLocked(idx, db, true)
+	dm.logger.Printf("Database deleted for idx: %s", idx)
+	dm.dbMu.Unlock()
+	
+	// Run hooks without holding dbMu so they can safely call back into the manager, and before
+	// the database closes so they can still flush to it
+	dm.fireCloseHooks(idx)
+	dm.closeRemoved(removed)
+	return nil
+}
+
+// CloseHook is called when a tenant database is closed, whether it was deleted, expired or
+// evicted, so anything still holding its *sql.DB can flush to it and let go of it. It runs once
+// the database is out of service but before it is closed.
+type CloseHook func(idx string)
+
+// AddCloseHook registers a hook that fires whenever a tenant database is closed
+func (dm *DatabaseManager) AddCloseHook(hook CloseHook) {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	dm.closeHooks = append(dm.closeHooks, hook)
+}
+
+// fireCloseHooks calls every registered close hook for idx
+func (dm *DatabaseManager) fireCloseHooks(idx string) {
+	dm.hooksMu.RLock()
+	hooks := make([]CloseHook, len(dm.closeHooks))
+	copy(hooks, dm.closeHooks)
+	dm.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(idx)
+	}
+}
+
+// DeleteHook is called once the storage of a tenant database has been deleted, whether the
+// tenant was deleted or expired, so per-tenant state kept elsewhere can be dropped with it. Unlike
+// CloseHook it does not fire for evicted tenants, whose data is kept.
+type DeleteHook func(idx string)
+
+// AddDeleteHook registers a hook that fires whenever the storage of a tenant database is deleted
+func (dm *DatabaseManager) AddDeleteHook(hook DeleteHook) {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	dm.deleteHooks = append(dm.deleteHooks, hook)
+}
+
+// fireDeleteHooks calls every registered delete hook for idx
+func (dm *DatabaseManager) fireDeleteHooks(idx string) {
+	dm.hooksMu.RLock()
+	hooks := make([]DeleteHook, len(dm.deleteHooks))
+	copy(hooks, dm.deleteHooks)
+	dm.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(idx)
+	}
+}
+
+// DatabaseSize returns the approximate size in bytes of the database for idx, as page_count x
+// page_size, without creating it
+func (dm *DatabaseManager) DatabaseSize(idx string) (int64, error) {
+	if idx == "" {
+		idx = "default"
+	}
+	
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	db, exists := dm.databases[idx]
+	dm.dbMu.RUnlock()
+	if !exists {
+		return 0, fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return 0, fmt.Errorf("sizing a MySQL default database is not supported")
+	}
+	
+	var pageCount, pageSize int64
+	if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, fmt.Errorf("failed to read page count for idx %s: %v", idx, err)
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, fmt.Errorf("failed to read page size for idx %s: %v", idx, err)
+	}
+	return pageCount * pageSize, nil
+}
+
+// IsFileBacked reports whether the database for idx is stored in a SQLite file on disk
+func (dm *DatabaseManager) IsFileBacked(idx string) bool {
+	// Only the default database can be configured with an on-disk SQLite file
+	if !dm.isDefaultDatabase(idx) || dm.defaultConfig == nil || dm.defaultConfig.Type != config.DatabaseTypeSQLite {
+		return false
+	}
+	
+	connStr := dm.defaultConfig.ConnectionString
+	return connStr != "" && connStr != ":memory:" && !strings.Contains(connStr, "mode=memory")
+}
+
+// SnapshotDatabase writes a consistent copy of the database for idx to destPath using VACUUM INTO
+func (dm *DatabaseManager) SnapshotDatabase(idx string, destPath string) error {
+	if idx == "" {
+		idx = "default"
+	}
+	
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	db, exists := dm.databases[idx]
+	dm.dbMu.RUnlock()
+	
+	if !exists {
+		return fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if !dm.IsFileBacked(idx) {
+		return fmt.Errorf("database for idx %s is not file-backed", idx)
+	}
+	
+	if _, err := db.Exec("VACUUM INTO ?", destPath); err != nil {
+		return fmt.Errorf("failed to snapshot database for idx %s: %v", idx, err)
+	}
 	
+	dm.logger.Printf("Database snapshot written for idx %s: %s", idx, destPath)
 	return nil
 }
@@ -1,9 +1,16 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"log"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"multitenant-db/internal/config"
 )
@@ -16,7 +23,13 @@ func TestNewDatabaseManagerWithConfig_SQLite(t *testing.T) {
 		ConnectionString: ":memory:",
 	}
 	
-	dm := NewDatabaseManagerWithConfig(logger, cfg)
+	dm, err := NewDatabaseManagerWithConfig(logger, cfg)
+	
+	if err != nil {
+	
+		t.Fatalf("Failed to create database manager: %v", err)
+	
+	}
 	
 	if dm == nil {
 		t.Fatal("DatabaseManager should not be nil")
@@ -40,7 +53,13 @@ func TestNewDatabaseManagerWithConfig_SQLite(t *testing.T) {
 func TestNewDatabaseManagerWithConfig_NilConfig(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	
-	dm := NewDatabaseManagerWithConfig(logger, nil)
+	dm, err := NewDatabaseManagerWithConfig(logger, nil)
+	
+	if err != nil {
+	
+		t.Fatalf("Failed to create database manager: %v", err)
+	
+	}
 	
 	if dm == nil {
 		t.Fatal("DatabaseManager should not be nil")
@@ -162,3 +181,194 @@ func TestInitSampleData_SQLite(t *testing.T) {
 		t.Errorf("Expected 3 products, got %d", productCount)
 	}
 }
+
+func TestGetOrCreateDatabase_TenantPragmas(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.SQLiteCacheSize = -4000
+	cfg.TenantSQLiteCacheSize = map[string]int{"hot_tenant": -64000}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+	dm := handler.GetDatabaseManager()
+
+	expected := map[string]int{
+		"default":        -4000,
+		"regular_tenant": -4000,
+		"hot_tenant":     -64000,
+	}
+	for idx, want := range expected {
+		db, err := dm.GetOrCreateDatabase(idx)
+		if err != nil {
+			t.Fatalf("Failed to create database for %s: %v", idx, err)
+		}
+
+		// Hold several connections at once so the pool has to open new ones
+		var conns []*sql.Conn
+		for i := 0; i < 3; i++ {
+			conn, err := db.Conn(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to open connection %d for %s: %v", i, idx, err)
+			}
+			defer conn.Close()
+			conns = append(conns, conn)
+		}
+		for i, conn := range conns {
+			var cacheSize int
+			if err := conn.QueryRowContext(context.Background(), "PRAGMA cache_size").Scan(&cacheSize); err != nil {
+				t.Fatalf("Failed to read cache_size for %s: %v", idx, err)
+			}
+			if cacheSize != want {
+				t.Errorf("Expected cache_size %d on connection %d for %s, got %d", want, i, idx, cacheSize)
+			}
+		}
+	}
+}
+
+func TestDatabaseManager_SampleDataRows(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.SampleDataRows = 450 // More than one batch of inserts
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+	dm := handler.GetDatabaseManager()
+
+	for _, idx := range []string{"default", "load_tenant"} {
+		db, err := dm.GetOrCreateDatabase(idx)
+		if err != nil {
+			t.Fatalf("Failed to get database for %s: %v", idx, err)
+		}
+		for _, table := range sampleTables {
+			var count int
+			if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+				t.Fatalf("Failed to count %s for %s: %v", table, idx, err)
+			}
+			if count != 450 {
+				t.Errorf("Expected 450 rows in %s for %s, got %d", table, idx, count)
+			}
+		}
+
+		// The hand-written rows come first, generated ones follow
+		var first, generated string
+		if err := db.QueryRow("SELECT name FROM users WHERE id = 1").Scan(&first); err != nil || first != "Alice" {
+			t.Errorf("Expected Alice as user 1 for %s, got %q (%v)", idx, first, err)
+		}
+		if err := db.QueryRow("SELECT email FROM users WHERE id = 450").Scan(&generated); err != nil || generated != "user450@example.com" {
+			t.Errorf("Expected a generated user 450 for %s, got %q (%v)", idx, generated, err)
+		}
+	}
+
+	// Seeding again does not duplicate rows
+	counts, err := dm.SeedSampleData("load_tenant")
+	if err != nil {
+		t.Fatalf("SeedSampleData failed: %v", err)
+	}
+	if counts["users"] != 450 || counts["products"] != 450 {
+		t.Errorf("Expected reseeding to keep 450 rows, got %v", counts)
+	}
+
+	dm.SetSampleDataRows(0)
+	empty, err := dm.GetOrCreateDatabase("empty_tenant")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var count int
+	if err := empty.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected empty sample tables with 0 rows, got %d (%v)", count, err)
+	}
+}
+
+// stubMySQLDriver stands in for the MySQL driver, counting connectivity checks and refusing
+// connections to DSNs that mention "unreachable"
+type stubMySQLDriver struct {
+	pings atomic.Int32
+}
+
+func (d *stubMySQLDriver) Open(dsn string) (driver.Conn, error) {
+	if strings.Contains(dsn, "unreachable") {
+		return nil, errors.New("dial tcp: connection refused")
+	}
+	return &stubMySQLConn{driver: d}, nil
+}
+
+type stubMySQLConn struct {
+	driver *stubMySQLDriver
+}
+
+func (c *stubMySQLConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+func (c *stubMySQLConn) Close() error              { return nil }
+func (c *stubMySQLConn) Begin() (driver.Tx, error) { return nil, errors.New("not supported") }
+func (c *stubMySQLConn) Ping(ctx context.Context) error {
+	c.driver.pings.Add(1)
+	return nil
+}
+
+var stubMySQL = &stubMySQLDriver{}
+
+func init() {
+	sql.Register("stub-mysql", stubMySQL)
+}
+
+func TestOpenMySQLDatabase_PingsAndTunesPool(t *testing.T) {
+	original := mysqlDriverName
+	mysqlDriverName = "stub-mysql"
+	defer func() { mysqlDriverName = original }()
+	
+	dbConfig := &config.DefaultDatabaseConfig{
+		Type:                 config.DatabaseTypeMySQL,
+		MySQLHost:            "db.example.com",
+		ConnectionString:     "app@tcp(db.example.com:3306)/app",
+		MySQLMaxOpenConns:    7,
+		MySQLMaxIdleConns:    3,
+		MySQLConnMaxLifetime: time.Minute,
+	}
+	
+	before := stubMySQL.pings.Load()
+	db, err := openMySQLDatabase(dbConfig)
+	if err != nil {
+		t.Fatalf("openMySQLDatabase failed: %v", err)
+	}
+	defer db.Close()
+	
+	if pings := stubMySQL.pings.Load() - before; pings != 1 {
+		t.Errorf("Expected the database to be pinged once at startup, got %d", pings)
+	}
+	if maxOpen := db.Stats().MaxOpenConnections; maxOpen != 7 {
+		t.Errorf("Expected max open connections 7, got %d", maxOpen)
+	}
+	
+	// A server that can't be reached fails straight away instead of on the first query
+	dbConfig.ConnectionString = "app@tcp(unreachable:3306)/app"
+	if _, err := openMySQLDatabase(dbConfig); err == nil || !strings.Contains(err.Error(), "db.example.com") {
+		t.Errorf("Expected a connection error naming the host, got %v", err)
+	}
+}
+
+func TestNewDatabaseManagerWithConfig_UnreachableMySQL(t *testing.T) {
+	original := mysqlDriverName
+	mysqlDriverName = "stub-mysql"
+	defer func() { mysqlDriverName = original }()
+	
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := &config.DefaultDatabaseConfig{
+		Type:             config.DatabaseTypeMySQL,
+		MySQLHost:        "db.example.com",
+		ConnectionString: "app@tcp(unreachable:3306)/app",
+	}
+	
+	// The caller decides what to do about a server it can't reach; no SQLite stand-in is served
+	dm, err := NewDatabaseManagerWithConfig(logger, cfg)
+	if err == nil || !strings.Contains(err.Error(), "db.example.com") {
+		t.Errorf("Expected a connection error naming the host, got %v", err)
+	}
+	if dm != nil {
+		t.Error("No database manager should be returned when the default database is unreachable")
+	}
+}
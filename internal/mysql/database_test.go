@@ -1,11 +1,15 @@
 package mysql
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestNewDatabaseManager(t *testing.T) {
@@ -301,6 +305,100 @@ func TestDatabaseManager_Concurrency(t *testing.T) {
 	}
 }
 
+func TestDatabaseManager_ConcurrentWrites(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	if _, err := dm.ExecuteQuery("busy_tenant", "CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, writer INTEGER NOT NULL)", nil); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	// Writers and readers share the tenant's database at the same time. Each insert adds a batch
+	// of rows, so statements run long enough to overlap.
+	const writers, inserts, batch = 20, 10, 500
+	insert := fmt.Sprintf("INSERT INTO events (writer) WITH RECURSIVE n(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM n WHERE x < %d) SELECT ? FROM n", batch)
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*inserts*2)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			for j := 0; j < inserts; j++ {
+				if _, err := dm.ExecuteQuery("busy_tenant", insert, []interface{}{writer}); err != nil {
+					errs <- err
+				}
+				if _, err := dm.ExecuteQuery("busy_tenant", "SELECT COUNT(*) FROM events", nil); err != nil {
+					errs <- err
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Concurrent statement failed: %v", err)
+	}
+
+	// Every connection sees the same database, so no write went missing
+	result, err := dm.ExecuteQuery("busy_tenant", "SELECT COUNT(*), COUNT(DISTINCT writer) FROM events", nil)
+	if err != nil {
+		t.Fatalf("Failed to count rows: %v", err)
+	}
+	if rows, perWriter := fmt.Sprint(result.Rows[0][0]), fmt.Sprint(result.Rows[0][1]); rows != fmt.Sprint(writers*inserts*batch) || perWriter != fmt.Sprint(writers) {
+		t.Errorf("Expected %d rows from %d writers, got %s rows from %s", writers*inserts*batch, writers, rows, perWriter)
+	}
+}
+
+func TestDatabaseManager_StreamDoesNotBlockReads(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	if _, err := dm.GetOrCreateDatabase("stream_tenant"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// A stream whose consumer is slow keeps its connection until the consumer is done
+	streaming, release := make(chan struct{}), make(chan struct{})
+	streamErr := make(chan error, 1)
+	go func() {
+		first := true
+		streamErr <- dm.StreamQuery("stream_tenant", "SELECT id FROM users", func(columns []string, values []interface{}) error {
+			if first {
+				first = false
+				close(streaming)
+				<-release
+			}
+			return nil
+		})
+	}()
+	<-streaming
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := dm.ExecuteQuery("stream_tenant", "SELECT 2", nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Read during a stream failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Read blocked behind an open stream on the same tenant")
+		close(release)
+		<-done
+		<-streamErr
+		return
+	}
+
+	close(release)
+	if err := <-streamErr; err != nil {
+		t.Errorf("Stream failed: %v", err)
+	}
+}
+
 func TestDatabaseManager_ErrorHandling(t *testing.T) {
 	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
 	dm := NewDatabaseManager(logger)
@@ -386,3 +484,451 @@ func TestDatabaseManager_CaseSensitivity(t *testing.T) {
 		t.Error("Both case variants should exist in database list")
 	}
 }
+
+func TestDatabaseManager_HasDatabase(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+
+	if !dm.HasDatabase("default") || !dm.HasDatabase("") {
+		t.Error("Default database should exist")
+	}
+
+	if dm.HasDatabase("not_created") {
+		t.Error("HasDatabase should return false for an unknown idx")
+	}
+	if stringInSlice("not_created", dm.ListDatabases()) {
+		t.Error("HasDatabase should not create a database")
+	}
+
+	if _, err := dm.GetOrCreateDatabase("created"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if !dm.HasDatabase("created") {
+		t.Error("HasDatabase should return true for an existing idx")
+	}
+}
+
+func TestDatabaseManager_SeedSampleData(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	// Empty the default database so seeding has to recreate everything
+	db, err := dm.GetOrCreateDatabase("default")
+	if err != nil {
+		t.Fatalf("Failed to get default database: %v", err)
+	}
+	for _, table := range sampleTables {
+		if _, err := db.Exec("DROP TABLE " + table); err != nil {
+			t.Fatalf("Failed to drop %s: %v", table, err)
+		}
+	}
+
+	// Seeding twice must not duplicate rows
+	for i := 0; i < 2; i++ {
+		counts, err := dm.SeedSampleData("default")
+		if err != nil {
+			t.Fatalf("SeedSampleData failed: %v", err)
+		}
+		if counts["users"] != 3 || counts["products"] != 3 {
+			t.Errorf("Seed %d: expected 3 users and 3 products, got %v", i+1, counts)
+		}
+	}
+
+	if _, err := dm.SeedSampleData("missing"); err == nil {
+		t.Error("Expected error seeding a database that does not exist")
+	}
+}
+
+func TestDatabaseManager_GetDatabaseForSession_Caching(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	session := NewSessionVariables()
+	session.SetUser("idx", "cache_a")
+
+	dbA, err := dm.GetDatabaseForSession(session)
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	if again, _ := dm.GetDatabaseForSession(session); again != dbA {
+		t.Error("Repeated lookups for the same idx should return the cached database")
+	}
+
+	// Changing @idx must re-resolve
+	session.SetUser("idx", int64(42))
+	dbB, err := dm.GetDatabaseForSession(session)
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	expectedB, _ := dm.GetOrCreateDatabase("42")
+	if dbB == dbA || dbB != expectedB {
+		t.Error("Changing @idx should resolve the new tenant's database")
+	}
+
+	// Deleting the tenant must invalidate the cached lookup
+	if err := dm.DeleteDatabase("42"); err != nil {
+		t.Fatalf("Failed to delete database: %v", err)
+	}
+	dbRecreated, err := dm.GetDatabaseForSession(session)
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	if dbRecreated == dbB {
+		t.Error("Deleted database should not be served from the session cache")
+	}
+	if !dm.HasDatabase("42") {
+		t.Error("Lookup after delete should recreate the tenant database")
+	}
+
+	// Unsetting @idx falls back to the default database
+	session.UnsetUser("idx")
+	defaultDB, _ := dm.GetOrCreateDatabase("default")
+	if db, _ := dm.GetDatabaseForSession(session); db != defaultDB {
+		t.Error("Unsetting @idx should resolve the default database")
+	}
+}
+
+func BenchmarkDatabaseManager_GetDatabaseForSession(b *testing.B) {
+	logger := log.New(io.Discard, "", 0)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	session := NewSessionVariables()
+	session.SetUser("idx", int64(1234))
+
+	b.Run("cached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := dm.GetDatabaseForSession(session); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("uncached", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			idxVar, _ := session.GetUser("idx")
+			if _, err := dm.GetOrCreateDatabase(fmt.Sprintf("%v", idxVar)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestDatabaseManager_ExecuteQuery(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	result, err := dm.ExecuteQuery("exec_test", "INSERT INTO users (name, email, age) VALUES (?, ?, ?)", []interface{}{"Dana", "dana@example.com", int64(41)})
+	if err != nil {
+		t.Fatalf("Parameterized insert failed: %v", err)
+	}
+	if result.RowsAffected != 1 || result.LastInsertID == 0 {
+		t.Errorf("Expected 1 affected row and an insert id, got %+v", result)
+	}
+
+	result, err = dm.ExecuteQuery("exec_test", "SELECT name, age FROM users WHERE email = ?", []interface{}{"dana@example.com"})
+	if err != nil {
+		t.Fatalf("Parameterized select failed: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][0] != "Dana" || result.Rows[0][1] != int64(41) {
+		t.Errorf("Expected typed row [Dana 41], got %v", result.Rows)
+	}
+
+	result, err = dm.ExecuteQuery("exec_test", "INSERT INTO users (name, email, age) VALUES (?, ?, ?) RETURNING id, name", []interface{}{"Eli", "eli@example.com", int64(35)})
+	if err != nil {
+		t.Fatalf("Insert with RETURNING failed: %v", err)
+	}
+	if len(result.Rows) != 1 || result.Rows[0][1] != "Eli" {
+		t.Errorf("Expected returned row for Eli, got %v", result.Rows)
+	}
+
+	// Statements SQLite rejects are the caller's fault, not the server's
+	for _, query := range []string{
+		"SELECT * FROM missing_table",
+		"SELEC 1",
+		"INSERT INTO users (id, name, email, age) VALUES (1, 'Dup', 'dup@example.com', 1)",
+	} {
+		if _, err := dm.ExecuteQuery("exec_test", query, nil); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("%s: expected ErrInvalidQuery, got %v", query, err)
+		}
+	}
+}
+
+func TestDatabaseManager_TruncateDatabase(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	db, err := dm.GetOrCreateDatabase("truncate_test")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE events (id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := db.Exec("INSERT INTO events (name) VALUES ('event')"); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	tables, err := dm.TruncateDatabase("truncate_test", true)
+	if err != nil {
+		t.Fatalf("TruncateDatabase failed: %v", err)
+	}
+	if len(tables) != 3 || !stringInSlice("events", tables) {
+		t.Errorf("Expected users, products and events to be truncated, got %v", tables)
+	}
+
+	// Tables remain but are empty
+	for _, table := range []string{"users", "products", "events"} {
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err != nil {
+			t.Errorf("Table %s should still exist: %v", table, err)
+		} else if count != 0 {
+			t.Errorf("Expected %s to be empty, got %d rows", table, count)
+		}
+	}
+
+	// Sequences were reset, so ids start over
+	result, err := db.Exec("INSERT INTO events (name) VALUES ('fresh')")
+	if err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if id, _ := result.LastInsertId(); id != 1 {
+		t.Errorf("Expected id sequence to restart at 1, got %d", id)
+	}
+
+	if _, err := dm.TruncateDatabase("missing", false); err == nil {
+		t.Error("Expected error truncating a database that does not exist")
+	}
+}
+
+func TestDatabaseManager_CopyDatabase(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	src, err := dm.GetOrCreateDatabase("sandbox")
+	if err != nil {
+		t.Fatalf("Failed to create source database: %v", err)
+	}
+	dst, err := dm.GetOrCreateDatabase("production")
+	if err != nil {
+		t.Fatalf("Failed to create target database: %v", err)
+	}
+
+	// Extra rows in an existing table and a table the target does not have yet
+	if _, err := src.Exec("INSERT INTO users (id, name, email, age) VALUES (4, 'Dana', 'dana@example.com', 41)"); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	if _, err := src.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := src.Exec("INSERT INTO notes (id, body) VALUES (1, 'ship it')"); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+	// A row whose key clashes with the target keeps the target's version
+	if _, err := src.Exec("UPDATE users SET name = 'Alicia' WHERE id = 1"); err != nil {
+		t.Fatalf("Failed to update row: %v", err)
+	}
+
+	counts, err := dm.CopyDatabase("sandbox", "production")
+	if err != nil {
+		t.Fatalf("CopyDatabase failed: %v", err)
+	}
+	if counts["users"] != 4 || counts["products"] != 3 || counts["notes"] != 1 {
+		t.Errorf("Unexpected row counts after copy: %v", counts)
+	}
+
+	var name string
+	if err := dst.QueryRow("SELECT name FROM users WHERE id = 4").Scan(&name); err != nil || name != "Dana" {
+		t.Errorf("Expected Dana to arrive in the target, got %q (%v)", name, err)
+	}
+	if err := dst.QueryRow("SELECT body FROM notes WHERE id = 1").Scan(&name); err != nil || name != "ship it" {
+		t.Errorf("Expected the notes table to be copied, got %q (%v)", name, err)
+	}
+	if err := dst.QueryRow("SELECT name FROM users WHERE id = 1").Scan(&name); err != nil || name != "Alice" {
+		t.Errorf("Expected existing target row to be kept, got %q (%v)", name, err)
+	}
+
+	if _, err := dm.CopyDatabase("sandbox", "sandbox"); err == nil {
+		t.Error("Expected error copying a database onto itself")
+	}
+	if _, err := dm.CopyDatabase("missing", "production"); err == nil {
+		t.Error("Expected error copying a database that does not exist")
+	}
+}
+
+func TestDatabaseManager_GetOrCreateDatabase_NoDuplicateCreation(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	store := newFakeTenantStore()
+	dm, err := NewDatabaseManagerWithStore(logger, nil, store)
+	if err != nil {
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	defer dm.Close()
+
+	const workers = 32
+	results := make([]*sql.DB, workers)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			db, err := dm.GetOrCreateDatabase("racy_tenant")
+			if err != nil {
+				t.Errorf("Failed to get database: %v", err)
+				return
+			}
+			results[i] = db
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	store.mu.Lock()
+	opened := store.opened["racy_tenant"]
+	store.mu.Unlock()
+	if opened != 1 {
+		t.Errorf("Expected the database to be created once, got %d", opened)
+	}
+	for i, db := range results {
+		if db != results[0] {
+			t.Errorf("Worker %d got a different database instance", i)
+		}
+	}
+}
+
+func BenchmarkDatabaseManager_GetOrCreateDatabase_Parallel(b *testing.B) {
+	logger := log.New(io.Discard, "", 0)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	tenants := make([]string, 8)
+	for i := range tenants {
+		tenants[i] = fmt.Sprintf("hot_tenant_%d", i)
+		if _, err := dm.GetOrCreateDatabase(tenants[i]); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if _, err := dm.GetOrCreateDatabase(tenants[i%len(tenants)]); err != nil {
+				b.Fatal(err)
+			}
+			i++
+		}
+	})
+}
+
+func TestDatabaseManager_CreateDatabase(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	// Schema in addition to the sample data
+	if err := dm.CreateDatabase("seeded", true, "CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT)"); err != nil {
+		t.Fatalf("CreateDatabase failed: %v", err)
+	}
+	db, err := dm.GetOrCreateDatabase("seeded")
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	for _, table := range []string{"users", "products", "notes"} {
+		var name string
+		if err := db.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", table).Scan(&name); err != nil {
+			t.Errorf("Expected table %s to exist: %v", table, err)
+		}
+	}
+
+	if err := dm.CreateDatabase("seeded", false, ""); !errors.Is(err, ErrDatabaseExists) {
+		t.Errorf("Expected ErrDatabaseExists, got %v", err)
+	}
+	if err := dm.CreateDatabase("default", false, ""); !errors.Is(err, ErrDatabaseExists) {
+		t.Errorf("Expected ErrDatabaseExists for the default database, got %v", err)
+	}
+
+	// A failing statement rolls back the whole schema and removes the database
+	err = dm.CreateDatabase("broken", false, "CREATE TABLE first (id INTEGER); INSERT INTO missing VALUES (1)")
+	if !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("Expected ErrInvalidSchema, got %v", err)
+	}
+	if dm.HasDatabase("broken") {
+		t.Error("Database should be removed after its schema failed")
+	}
+
+	// Statements reaching outside the tenant database are refused before anything is created
+	err = dm.CreateDatabase("attacher", false, "ATTACH DATABASE '/tmp/other.db' AS other")
+	if !errors.Is(err, ErrInvalidSchema) || dm.HasDatabase("attacher") {
+		t.Errorf("Expected ATTACH to be refused without creating the database, got %v", err)
+	}
+	if err := dm.CreateDatabase("quoted", false, "CREATE TABLE docs (body TEXT DEFAULT 'attach here')"); err != nil {
+		t.Errorf("Keywords inside quoted text should be allowed: %v", err)
+	}
+}
+
+// walTenantStore keeps each tenant in a SQLite file in WAL mode
+type walTenantStore struct {
+	dir string
+}
+
+func (s *walTenantStore) GetOrCreate(idx string) (*sql.DB, error) {
+	return sql.Open("sqlite3", fmt.Sprintf("file:%s/%s.db?_journal_mode=WAL", s.dir, idx))
+}
+
+func (s *walTenantStore) Close(idx string, db *sql.DB) error  { return db.Close() }
+func (s *walTenantStore) Delete(idx string, db *sql.DB) error { return db.Close() }
+func (s *walTenantStore) List() ([]string, error)             { return nil, nil }
+
+func TestDatabaseManager_ConnectionAffinity(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	dm, err := NewDatabaseManagerWithStore(logger, nil, &walTenantStore{dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	defer dm.Close()
+	dm.SetConnectionAffinity(true)
+
+	db, err := dm.GetOrCreateDatabase("wal_tenant")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	var journalMode string
+	if err := db.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Fatalf("Expected a WAL tenant database, got %q (%v)", journalMode, err)
+	}
+	if open := db.Stats().MaxOpenConnections; open != 1 {
+		t.Errorf("Expected a single dedicated connection, got a pool of %d", open)
+	}
+
+	// Statements issued one after another, as a client session does, share the transaction
+	// and see each other's writes straight away
+	var before int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&before); err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if _, err := db.Exec("BEGIN"); err != nil {
+		t.Fatalf("BEGIN failed: %v", err)
+	}
+	if _, err := db.Exec("INSERT INTO users (name, email, age) VALUES ('Wal', 'wal@example.com', 30)"); err != nil {
+		t.Fatalf("INSERT failed: %v", err)
+	}
+	var during int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&during); err != nil {
+		t.Fatalf("Failed to count users: %v", err)
+	}
+	if during != before+1 {
+		t.Errorf("Expected the uncommitted insert to be visible to the next read, got %d users (was %d)", during, before)
+	}
+	if _, err := db.Exec("COMMIT"); err != nil {
+		t.Fatalf("COMMIT failed: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// ErrDestructiveStatement is returned for a DROP, TRUNCATE or DELETE without WHERE while
+// destructive statements are blocked for the tenant
+var ErrDestructiveStatement = errors.New("destructive statement blocked")
+
+// whereRegex matches a WHERE keyword once quoted text has been blanked out
+var whereRegex = regexp.MustCompile(`(?i)\bwhere\b`)
+
+// isDestructiveStatement reports whether query, or any statement in it, is a DROP, a TRUNCATE
+// or a DELETE without a WHERE clause, which would throw away a whole table's data. Comments are
+// blanked first, so they can neither hide the statement keyword nor stand in for a WHERE.
+func isDestructiveStatement(query string) bool {
+	for _, statement := range strings.Split(blankQuoted(query), ";") {
+		switch statementKeyword(statement) {
+		case "drop", "truncate":
+			return true
+		case "delete":
+			if !whereRegex.MatchString(statement) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DestructiveGuardFunc reports whether destructive statements are blocked for a tenant
+type DestructiveGuardFunc func(idx string) bool
+
+// SetDestructiveGuard sets the function deciding whether ExecuteQuery refuses destructive
+// statements for a tenant. It is consulted on every statement, so it may follow reloads.
+func (dm *DatabaseManager) SetDestructiveGuard(guard DestructiveGuardFunc) {
+	dm.dbMu.Lock()
+	defer dm.dbMu.Unlock()
+	dm.destructiveGuard = guard
+}
+
+// blocksDestructive reports whether destructive statements are blocked for idx. The guard is
+// asked about the tenant idx resolves to, so an alias is treated like the tenant it points at.
+func (dm *DatabaseManager) blocksDestructive(idx string) bool {
+	if idx == "" {
+		idx = "default"
+	}
+	dm.dbMu.RLock()
+	guard := dm.destructiveGuard
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+	return guard != nil && guard(idx)
+}
+
+// checkDestructive returns ErrDestructiveStatement when query is destructive and blocked for idx
+func (dm *DatabaseManager) checkDestructive(idx string, query string) error {
+	if !isDestructiveStatement(query) || !dm.blocksDestructive(idx) {
+		return nil
+	}
+	return fmt.Errorf("%w: DROP, TRUNCATE and DELETE without WHERE are disabled for idx %s", ErrDestructiveStatement, idx)
+}
+
+// destructiveBlockedError is the MySQL error for a blocked destructive statement, modelled on
+// the one MySQL raises for writes while read_only is set
+func destructiveBlockedError() error {
+	return mysql.NewError(mysql.ER_OPTION_PREVENTS_STATEMENT,
+		"The server is running with --block-destructive so it cannot execute DROP, TRUNCATE or DELETE without WHERE")
+}
@@ -0,0 +1,224 @@
+package mysql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// EvictionHook is called when a tenant database has been evicted, before it is closed
+type EvictionHook func(idx string, evictedAt time.Time)
+
+// AddEvictionHook registers a hook that fires whenever a tenant database is evicted
+func (dm *DatabaseManager) AddEvictionHook(hook EvictionHook) {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	dm.evictionHooks = append(dm.evictionHooks, hook)
+}
+
+// EvictIdleDatabases closes and removes tenant databases that have not been accessed within idleTimeout.
+// The default database is never evicted, nor is a database still running a statement or holding
+// a transaction open. Returns the evicted idx values.
+func (dm *DatabaseManager) EvictIdleDatabases(idleTimeout time.Duration) []string {
+	now := time.Now()
+	var removed []*removedDatabase
+
+	dm.dbMu.Lock()
+	for idx, db := range dm.databases {
+		if dm.isDefaultDatabase(idx) {
+			continue
+		}
+		if access, exists := dm.lastAccess[idx]; exists && now.Sub(time.Unix(0, access.Load())) < idleTimeout {
+			continue
+		}
+		if databaseInUse(db) {
+			continue
+		}
+
+		removed = append(removed, dm.removeDatabaseLocked(idx, db, false))
+	}
+	dm.dbMu.Unlock()
+
+	// Run hooks without holding dbMu so they can safely call back into the manager, and before
+	// each database closes so they can still flush to it
+	var evicted []string
+	for _, r := range removed {
+		dm.logger.Printf("Evicted idle database for idx: %s", r.idx)
+		dm.fireEvictionHooks(r.idx, now)
+		dm.closeRemoved(r)
+		evicted = append(evicted, r.idx)
+	}
+
+	return evicted
+}
+
+// ErrTenantLimitReached is returned when creating a tenant database would exceed the configured cap
+var ErrTenantLimitReached = errors.New("tenant database limit reached")
+
+// SetTenantLimit caps how many tenant databases may be open at once (0 disables the cap). At the
+// cap a new tenant either evicts the least recently used one or is refused with ErrTenantLimitReached.
+func (dm *DatabaseManager) SetTenantLimit(maxTenants int, evictAtLimit bool) {
+	dm.dbMu.Lock()
+	defer dm.dbMu.Unlock()
+	dm.maxTenants = maxTenants
+	dm.evictAtLimit = evictAtLimit
+}
+
+// makeRoomLocked enforces the tenant cap before a new tenant database is created, returning the
+// tenant evicted to make room, if any. Tenants in use are passed over, so a running statement
+// never loses its database. Callers must hold dbMu for writing and pass the evicted tenant to
+// finishEviction once it is released.
+func (dm *DatabaseManager) makeRoomLocked() (*removedDatabase, error) {
+	if dm.maxTenants <= 0 {
+		return nil, nil
+	}
+
+	tenants := 0
+	lruIdx, lruAccess := "", int64(0)
+	for idx, db := range dm.databases {
+		if dm.isDefaultDatabase(idx) {
+			continue
+		}
+		tenants++
+		if databaseInUse(db) {
+			continue
+		}
+		var access int64
+		if lastAccess, exists := dm.lastAccess[idx]; exists {
+			access = lastAccess.Load()
+		}
+		if lruIdx == "" || access < lruAccess {
+			lruIdx, lruAccess = idx, access
+		}
+	}
+	if tenants < dm.maxTenants {
+		return nil, nil
+	}
+	if !dm.evictAtLimit {
+		return nil, fmt.Errorf("%w (max %d)", ErrTenantLimitReached, dm.maxTenants)
+	}
+	if lruIdx == "" {
+		return nil, fmt.Errorf("%w (max %d, all in use)", ErrTenantLimitReached, dm.maxTenants)
+	}
+
+	evicted := dm.removeDatabaseLocked(lruIdx, dm.databases[lruIdx], false)
+	dm.logger.Printf("Evicted least recently used database for idx %s to stay within %d tenants", lruIdx, dm.maxTenants)
+	return evicted, nil
+}
+
+// finishEviction fires the eviction hooks for a tenant makeRoomLocked evicted, if any, and then
+// closes its database. Callers must not hold dbMu, so the hooks can call back into the manager.
+func (dm *DatabaseManager) finishEviction(evicted *removedDatabase) {
+	if evicted == nil {
+		return
+	}
+	dm.fireEvictionHooks(evicted.idx, time.Now())
+	dm.closeRemoved(evicted)
+}
+
+// databaseInUse reports whether db has a connection checked out, i.e. a statement is running,
+// rows are being read or a transaction is open on it
+func databaseInUse(db *sql.DB) bool {
+	return db.Stats().InUse > 0
+}
+
+// fireEvictionHooks calls every registered eviction hook for idx
+func (dm *DatabaseManager) fireEvictionHooks(idx string, evictedAt time.Time) {
+	dm.hooksMu.RLock()
+	hooks := make([]EvictionHook, len(dm.evictionHooks))
+	copy(hooks, dm.evictionHooks)
+	dm.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(idx, evictedAt)
+	}
+	dm.fireCloseHooks(idx)
+}
+
+// StartIdleEviction periodically evicts tenant databases idle for longer than idleTimeout
+func (dm *DatabaseManager) StartIdleEviction(idleTimeout time.Duration) {
+	if idleTimeout <= 0 {
+		return
+	}
+
+	dm.hooksMu.Lock()
+	if dm.stopEviction != nil {
+		dm.hooksMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	dm.stopEviction = stop
+	dm.hooksMu.Unlock()
+
+	// Check a few times per timeout window so databases are evicted reasonably promptly
+	interval := idleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	dm.logger.Printf("Idle tenant eviction enabled (timeout %v)", idleTimeout)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dm.EvictIdleDatabases(idleTimeout)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopIdleEviction stops the background eviction loop if it is running
+func (dm *DatabaseManager) StopIdleEviction() {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	if dm.stopEviction != nil {
+		close(dm.stopEviction)
+		dm.stopEviction = nil
+	}
+}
+
+// NewWebhookEvictionHook returns an EvictionHook that POSTs a JSON notification to url
+func NewWebhookEvictionHook(url string, logger *log.Logger) EvictionHook {
+	return EvictionHook(newWebhookNotifier(url, "tenant_evicted", "evicted_at", logger))
+}
+
+// newWebhookNotifier returns a function that POSTs a tenant lifecycle event to url, with the event
+// time under timeKey
+func newWebhookNotifier(url, event, timeKey string, logger *log.Logger) func(idx string, at time.Time) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	return func(idx string, at time.Time) {
+		payload, err := json.Marshal(map[string]interface{}{
+			"event": event,
+			"idx":   idx,
+			timeKey: at,
+		})
+		if err != nil {
+			logger.Printf("Failed to encode %s webhook payload for idx %s: %v", event, idx, err)
+			return
+		}
+
+		// Deliver asynchronously so a slow endpoint doesn't stall eviction or expiry
+		go func() {
+			resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+			if err != nil {
+				logger.Printf("Webhook for %s failed for idx %s: %v", event, idx, err)
+				return
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode >= 300 {
+				logger.Printf("Webhook for %s for idx %s returned %s", event, idx, resp.Status)
+			}
+		}()
+	}
+}
@@ -0,0 +1,243 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDatabaseManager_EvictionHook(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	var mu sync.Mutex
+	var evictedIdx []string
+	dm.AddEvictionHook(func(idx string, evictedAt time.Time) {
+		// Hooks must run without dbMu held, so calling back into the manager must not deadlock
+		dm.ListDatabases()
+		mu.Lock()
+		evictedIdx = append(evictedIdx, idx)
+		mu.Unlock()
+	})
+
+	if _, err := dm.GetOrCreateDatabase("idle_tenant"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := dm.GetOrCreateDatabase("busy_tenant"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// Backdate idle_tenant and the default database so they look idle
+	dm.dbMu.Lock()
+	for _, idx := range []string{"idle_tenant", "default"} {
+		access := new(atomic.Int64)
+		access.Store(time.Now().Add(-time.Hour).UnixNano())
+		dm.lastAccess[idx] = access
+	}
+	dm.dbMu.Unlock()
+
+	evicted := dm.EvictIdleDatabases(time.Minute)
+	if len(evicted) != 1 || evicted[0] != "idle_tenant" {
+		t.Errorf("Expected only idle_tenant to be evicted, got %v", evicted)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(evictedIdx) != 1 || evictedIdx[0] != "idle_tenant" {
+		t.Errorf("Expected eviction hook to fire with idle_tenant, got %v", evictedIdx)
+	}
+
+	databases := dm.ListDatabases()
+	if stringInSlice("idle_tenant", databases) {
+		t.Error("Evicted database should no longer be listed")
+	}
+	if !stringInSlice("busy_tenant", databases) || !stringInSlice("default", databases) {
+		t.Errorf("Active and default databases should be kept, got %v", databases)
+	}
+}
+
+func TestDatabaseManager_HooksRunBeforeClose(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+
+	// Hooks holding a tenant's *sql.DB can still use it, as a colocated query log flushes to it
+	handles := make(map[string]*sql.DB)
+	hookErrors := make(map[string]error)
+	dm.AddCloseHook(func(idx string) {
+		var count int
+		hookErrors[idx] = handles[idx].QueryRow("SELECT COUNT(*) FROM users").Scan(&count)
+	})
+
+	for _, idx := range []string{"deleted_tenant", "evicted_tenant"} {
+		db, err := dm.GetOrCreateDatabase(idx)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", idx, err)
+		}
+		handles[idx] = db
+	}
+
+	if err := dm.DeleteDatabase("deleted_tenant"); err != nil {
+		t.Fatalf("Failed to delete database: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	dm.EvictIdleDatabases(time.Millisecond)
+
+	for _, idx := range []string{"deleted_tenant", "evicted_tenant"} {
+		if err, fired := hookErrors[idx]; !fired || err != nil {
+			t.Errorf("Expected the close hook for %s to read its database, fired %v: %v", idx, fired, err)
+		}
+		if err := handles[idx].Ping(); err == nil {
+			t.Errorf("Expected %s to be closed once its hooks had run", idx)
+		}
+	}
+
+	// The tenant can be recreated afterwards, starting afresh
+	if _, err := dm.GetOrCreateDatabase("deleted_tenant"); err != nil {
+		t.Errorf("Failed to recreate deleted tenant: %v", err)
+	}
+}
+
+func TestDatabaseManager_TenantLimit(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+
+	t.Run("reject", func(t *testing.T) {
+		dm := NewDatabaseManager(logger)
+		defer dm.Close()
+		dm.SetTenantLimit(2, false)
+
+		for _, idx := range []string{"tenant_a", "tenant_b"} {
+			if _, err := dm.GetOrCreateDatabase(idx); err != nil {
+				t.Fatalf("Failed to create %s: %v", idx, err)
+			}
+		}
+		if _, err := dm.GetOrCreateDatabase("tenant_c"); !errors.Is(err, ErrTenantLimitReached) {
+			t.Errorf("Expected ErrTenantLimitReached, got %v", err)
+		}
+
+		// Existing tenants and the default database are still served at the cap
+		if _, err := dm.GetOrCreateDatabase("tenant_a"); err != nil {
+			t.Errorf("Existing tenant should still be available: %v", err)
+		}
+		if _, err := dm.GetOrCreateDatabase(""); err != nil {
+			t.Errorf("Default database should not count towards the limit: %v", err)
+		}
+	})
+
+	t.Run("evict", func(t *testing.T) {
+		dm := NewDatabaseManager(logger)
+		defer dm.Close()
+		dm.SetTenantLimit(2, true)
+
+		var evictedIdx, closedIdx []string
+		dm.AddEvictionHook(func(idx string, evictedAt time.Time) {
+			evictedIdx = append(evictedIdx, idx)
+		})
+		dm.AddCloseHook(func(idx string) {
+			closedIdx = append(closedIdx, idx)
+		})
+
+		for _, idx := range []string{"tenant_a", "tenant_b"} {
+			if _, err := dm.GetOrCreateDatabase(idx); err != nil {
+				t.Fatalf("Failed to create %s: %v", idx, err)
+			}
+		}
+
+		// Backdate tenant_a so it is the least recently used
+		dm.dbMu.Lock()
+		dm.lastAccess["tenant_a"].Store(time.Now().Add(-time.Hour).UnixNano())
+		dm.dbMu.Unlock()
+		dm.RecordTenantError("tenant_a", errors.New("no such table: orders"))
+
+		if _, err := dm.GetOrCreateDatabase("tenant_c"); err != nil {
+			t.Fatalf("Expected tenant_c to be created by evicting, got %v", err)
+		}
+		if dm.HasDatabase("tenant_a") || !dm.HasDatabase("tenant_b") || !dm.HasDatabase("tenant_c") {
+			t.Errorf("Expected tenant_a to be evicted, got %v", dm.ListDatabases())
+		}
+		if len(evictedIdx) != 1 || evictedIdx[0] != "tenant_a" {
+			t.Errorf("Expected eviction hook to fire with tenant_a, got %v", evictedIdx)
+		}
+		if len(closedIdx) != 1 || closedIdx[0] != "tenant_a" {
+			t.Errorf("Expected close hook to fire with tenant_a, got %v", closedIdx)
+		}
+		if _, ok := dm.LastError("tenant_a"); ok {
+			t.Error("Expected the evicted tenant's last error to be forgotten")
+		}
+
+		// A tenant with an open transaction is passed over even when least recently used
+		busy, err := dm.GetOrCreateDatabase("tenant_b")
+		if err != nil {
+			t.Fatalf("Failed to get tenant_b: %v", err)
+		}
+		tx, err := busy.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer tx.Rollback()
+		dm.dbMu.Lock()
+		dm.lastAccess["tenant_b"].Store(time.Now().Add(-time.Hour).UnixNano())
+		dm.dbMu.Unlock()
+
+		if _, err := dm.GetOrCreateDatabase("tenant_d"); err != nil {
+			t.Fatalf("Expected tenant_d to be created by evicting, got %v", err)
+		}
+		if !dm.HasDatabase("tenant_b") || dm.HasDatabase("tenant_c") {
+			t.Errorf("Expected tenant_c to be evicted instead of the busy tenant_b, got %v", dm.ListDatabases())
+		}
+		if _, err := tx.Exec("INSERT INTO users (name, email) VALUES ('Kim', 'kim@example.com')"); err != nil {
+			t.Errorf("Transaction on the busy tenant should still work: %v", err)
+		}
+
+		// With every tenant busy there is nothing to evict
+		other, err := dm.GetOrCreateDatabase("tenant_d")
+		if err != nil {
+			t.Fatalf("Failed to get tenant_d: %v", err)
+		}
+		otherTx, err := other.Begin()
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		defer otherTx.Rollback()
+		if _, err := dm.GetOrCreateDatabase("tenant_e"); !errors.Is(err, ErrTenantLimitReached) {
+			t.Errorf("Expected ErrTenantLimitReached with every tenant busy, got %v", err)
+		}
+	})
+}
+
+func TestNewWebhookEvictionHook(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+
+	received := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		received <- payload
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	hook := NewWebhookEvictionHook(server.URL, logger)
+	hook("webhook_tenant", time.Now())
+
+	select {
+	case payload := <-received:
+		if payload["idx"] != "webhook_tenant" {
+			t.Errorf("Expected webhook payload idx webhook_tenant, got %v", payload["idx"])
+		}
+		if payload["event"] != "tenant_evicted" {
+			t.Errorf("Expected event tenant_evicted, got %v", payload["event"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not called")
+	}
+}
@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"log"
+	"time"
+)
+
+// ExpiryHook is called when a tenant database has expired, before it is closed and deleted
+type ExpiryHook func(idx string, expiredAt time.Time)
+
+// AddExpiryHook registers a hook that fires whenever a tenant database expires
+func (dm *DatabaseManager) AddExpiryHook(hook ExpiryHook) {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	dm.expiryHooks = append(dm.expiryHooks, hook)
+}
+
+// ExpireTenants deletes tenant databases that have not been accessed within ttl, closing them and
+// removing their storage. Unlike idle eviction the data is gone for good; the next request for the
+// idx starts from fresh sample data. The default database never expires, nor does one still in use.
+// Returns the expired idx values.
+func (dm *DatabaseManager) ExpireTenants(ttl time.Duration) []string {
+	now := dm.now()
+	var removed []*removedDatabase
+
+	dm.dbMu.Lock()
+	for idx, db := range dm.databases {
+		if dm.isDefaultDatabase(idx) {
+			continue
+		}
+		if access, exists := dm.lastAccess[idx]; exists && now.Sub(time.Unix(0, access.Load())) < ttl {
+			continue
+		}
+		if databaseInUse(db) {
+			continue
+		}
+
+		removed = append(removed, dm.removeDatabaseLocked(idx, db, true))
+	}
+	dm.dbMu.Unlock()
+
+	// Run hooks without holding dbMu so they can safely call back into the manager, and before
+	// each database is deleted so they can still read it
+	var expired []string
+	for _, r := range removed {
+		dm.logger.Printf("Expired database for idx %s after %v without access", r.idx, ttl)
+		dm.fireExpiryHooks(r.idx, now)
+		dm.closeRemoved(r)
+		expired = append(expired, r.idx)
+	}
+
+	return expired
+}
+
+// fireExpiryHooks calls every registered expiry hook for idx
+func (dm *DatabaseManager) fireExpiryHooks(idx string, expiredAt time.Time) {
+	dm.hooksMu.RLock()
+	hooks := make([]ExpiryHook, len(dm.expiryHooks))
+	copy(hooks, dm.expiryHooks)
+	dm.hooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		hook(idx, expiredAt)
+	}
+	dm.fireCloseHooks(idx)
+}
+
+// StartTenantExpiry periodically deletes tenant databases untouched for longer than ttl
+func (dm *DatabaseManager) StartTenantExpiry(ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	dm.hooksMu.Lock()
+	if dm.stopExpiry != nil {
+		dm.hooksMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	dm.stopExpiry = stop
+	dm.hooksMu.Unlock()
+
+	// Sweep a few times per TTL so tenants are deleted reasonably promptly
+	interval := ttl / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+
+	dm.logger.Printf("Tenant expiry enabled (TTL %v)", ttl)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				dm.ExpireTenants(ttl)
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopTenantExpiry stops the background expiry sweeper if it is running
+func (dm *DatabaseManager) StopTenantExpiry() {
+	dm.hooksMu.Lock()
+	defer dm.hooksMu.Unlock()
+	if dm.stopExpiry != nil {
+		close(dm.stopExpiry)
+		dm.stopExpiry = nil
+	}
+}
+
+// NewWebhookExpiryHook returns an ExpiryHook that POSTs a JSON notification to url
+func NewWebhookExpiryHook(url string, logger *log.Logger) ExpiryHook {
+	return ExpiryHook(newWebhookNotifier(url, "tenant_expired", "expired_at", logger))
+}
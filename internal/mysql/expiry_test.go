@@ -0,0 +1,54 @@
+package mysql
+
+import (
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDatabaseManager_ExpireTenants(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	store := newFakeTenantStore()
+	dm, err := NewDatabaseManagerWithStore(logger, nil, store)
+	if err != nil {
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	defer dm.Close()
+
+	var expiredIdx []string
+	dm.AddExpiryHook(func(idx string, expiredAt time.Time) {
+		expiredIdx = append(expiredIdx, idx)
+	})
+
+	if _, err := dm.GetOrCreateDatabase("sandbox"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+
+	// Nothing expires while the tenant is within its TTL
+	if expired := dm.ExpireTenants(time.Hour); len(expired) != 0 {
+		t.Fatalf("Expected no tenants to expire yet, got %v", expired)
+	}
+
+	// Advance the clock past the TTL
+	dm.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	expired := dm.ExpireTenants(time.Hour)
+	if len(expired) != 1 || expired[0] != "sandbox" {
+		t.Fatalf("Expected only sandbox to expire, got %v", expired)
+	}
+	if len(expiredIdx) != 1 || expiredIdx[0] != "sandbox" {
+		t.Errorf("Expected expiry hook to fire with sandbox, got %v", expiredIdx)
+	}
+
+	// Expiry deletes the storage rather than just closing it, and keeps the default database
+	if dm.HasDatabase("sandbox") {
+		t.Error("Expired database should not be open")
+	}
+	if stringInSlice("sandbox", dm.ListDatabases()) {
+		t.Error("Expired tenant should no longer be listed")
+	}
+	if !dm.HasDatabase("default") {
+		t.Error("Default database should never expire")
+	}
+}
@@ -1,50 +1,141 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
 
+	"multitenant-db/internal/audit"
 	"multitenant-db/internal/config"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 	"github.com/go-mysql-org/go-mysql/server"
 )
 
-// Handler represents the MySQL protocol handler
+// Handler represents the MySQL protocol handler. Every client connection is served by a Handler
+// of its own, bound to that connection with forConnection, so concurrent commands each resolve
+// their own session. The server's Handler is bound to no connection and serves whichever one the
+// session manager marks current.
 type Handler struct {
+	*handlerState
+	queryHandlers *QueryHandlers
+	connID        uint32 // Connection this handler serves, 0 to follow the current connection
+}
+
+// handlerState is everything the Handlers of one server share
+type handlerState struct {
 	databaseManager *DatabaseManager
 	sessionManager  *SessionManager
-	queryHandlers   *QueryHandlers
 	queryLogger     *QueryLogger
+	queryStats      *QueryStats
 	logger          *log.Logger
 	config          *config.Config
+	configMu        sync.RWMutex  // Guards config, which is swapped wholesale on reload
+	auditLog        *audit.Logger // Trail of failed logins, nil when auditing is off
+
+	// Connection draining on shutdown
+	serveMu      sync.Mutex
+	listener     net.Listener                   // Accepting clients, nil until Serve
+	conns        map[net.Conn]*SessionVariables // Connections being served, with their session once authenticated
+	connsDone    sync.WaitGroup                 // Counts the connections in conns
+	shuttingDown bool
 }
 
-// NewHandler creates a new MySQL protocol handler
+// NewHandler creates a new MySQL protocol handler over an in-memory default database. Like
+// NewDatabaseManager, it panics if SQLite cannot open one.
 func NewHandler(logger *log.Logger) *Handler {
-	return NewHandlerWithConfig(logger, nil)
+	handler, err := NewHandlerWithConfig(logger, nil)
+	if err != nil {
+		panic(err)
+	}
+	return handler
 }
 
-// NewHandlerWithConfig creates a new MySQL protocol handler with configuration
-func NewHandlerWithConfig(logger *log.Logger, cfg *config.Config) *Handler {
+// NewHandlerWithConfig creates a new MySQL protocol handler with configuration. It fails if the
+// configured default database cannot be opened.
+func NewHandlerWithConfig(logger *log.Logger, cfg *config.Config) (*Handler, error) {
 	var defaultDBConfig *config.DefaultDatabaseConfig
 	if cfg != nil && cfg.DefaultDatabase != nil {
 		defaultDBConfig = cfg.DefaultDatabase
 	}
+	queryLogDir := ""
+	if cfg != nil {
+		queryLogDir = cfg.QueryLogDir
+	}
+	
+	handler := &Handler{handlerState: &handlerState{
+		sessionManager: NewSessionManager(),
+		queryStats:     NewQueryStats(),
+		logger:         logger,
+		config:         cfg, // Store config for authentication
+	}}
 	
-	handler := &Handler{
-		databaseManager: NewDatabaseManagerWithConfig(logger, defaultDBConfig),
-		sessionManager:  NewSessionManager(),
-		queryLogger:     NewQueryLogger(logger, ""),
-		logger:          logger,
-		config:          cfg, // Store config for authentication
+	// SQLite pragmas follow the configuration current when each database is opened
+	var pragmas TenantPragmasFunc
+	if cfg != nil {
+		pragmas = func(idx string) (int, int) {
+			current := handler.Config()
+			return current.SQLiteCacheSizeFor(idx), current.SQLiteMmapSizeFor(idx)
+		}
+	}
+	databaseManager, err := NewDatabaseManagerWithPragmas(logger, defaultDBConfig, NewSQLiteMemoryStore(), pragmas)
+	if err != nil {
+		return nil, err
 	}
+	handler.databaseManager = databaseManager
+	handler.databaseManager.AddDeleteHook(handler.queryStats.Forget)
+	handler.queryLogger = NewQueryLogger(logger, queryLogDir)
 	
 	handler.queryHandlers = NewQueryHandlers(handler)
-	return handler
+	
+	if cfg != nil {
+		if cfg.EvictionWebhookURL != "" {
+			handler.databaseManager.AddEvictionHook(NewWebhookEvictionHook(cfg.EvictionWebhookURL, logger))
+		}
+		handler.databaseManager.StartIdleEviction(cfg.TenantIdleTimeout)
+		if cfg.EvictionWebhookURL != "" {
+			handler.databaseManager.AddExpiryHook(NewWebhookExpiryHook(cfg.EvictionWebhookURL, logger))
+		}
+		handler.databaseManager.StartTenantExpiry(cfg.TenantTTL)
+		handler.sessionManager.StartSessionGC(cfg.SessionGCInterval, logger)
+		handler.databaseManager.SetTenantLimit(cfg.MaxTenantDatabases, cfg.TenantLimitMode == config.TenantLimitModeEvict)
+		handler.queryLogger.SetMaxLogDatabases(cfg.MaxQueryLogDatabases)
+		handler.queryLogger.SetShardLevels(cfg.QueryLogShardLevels)
+		if cfg.QueryLogColocate {
+			handler.queryLogger.SetColocatedDatabases(handler.databaseManager.existingDatabase)
+			handler.databaseManager.AddCloseHook(handler.queryLogger.ForgetClosedDatabase)
+		}
+		if cfg.QueryLogToStdout {
+			handler.queryLogger.MirrorTo(logger)
+		}
+		handler.databaseManager.SetConnectionAffinity(cfg.TenantConnectionAffinity)
+		handler.databaseManager.SetSampleDataRows(cfg.SampleDataRows)
+		if cfg.SampleDataRows > config.DefaultSampleDataRows {
+			// The default database was seeded before the setting applied; top it up
+			if _, err := handler.databaseManager.SeedSampleData("default"); err != nil {
+				logger.Printf("Failed to seed sample data for the default database: %v", err)
+			}
+		}
+		handler.databaseManager.SetDestructiveGuard(func(idx string) bool {
+			return handler.Config().BlocksDestructive(idx)
+		})
+		if resolver, err := NewTenantResolver(cfg.TenantResolvers, cfg.DefaultTenant); err != nil {
+			logger.Printf("Resolving tenants through @idx only: %v", err)
+		} else {
+			handler.sessionManager.SetTenantResolver(resolver)
+		}
+	}
+	return handler, nil
 }
 
 // GetDatabaseManager returns the database manager (for API access)
@@ -57,70 +148,473 @@ func (h *Handler) GetQueryLogger() *QueryLogger {
 	return h.queryLogger
 }
 
-// logWithIdx formats a log message including the "idx" user variable if set
-func (h *Handler) logWithIdx(format string, args ...interface{}) {
-	connID := h.sessionManager.GetCurrentConnection()
-	session := h.sessionManager.GetOrCreateSession(connID)
+// SetAuditLogger records failed MySQL logins in auditLog. A nil logger disables auditing.
+func (h *Handler) SetAuditLogger(auditLog *audit.Logger) {
+	h.auditLog = auditLog
+}
+
+// GetQueryStats returns the query counters (for API access)
+func (h *Handler) GetQueryStats() *QueryStats {
+	return h.queryStats
+}
+
+// Config returns the configuration currently in effect. The returned value must not be modified.
+func (h *Handler) Config() *config.Config {
+	h.configMu.RLock()
+	defer h.configMu.RUnlock()
+	return h.config
+}
+
+// ReloadConfig applies the runtime-safe settings from cfg (see config.ApplyReloadable) and
+// returns a description of each setting that changed. The active configuration is copied
+// and swapped in one step, so statements in flight keep seeing a consistent snapshot.
+func (h *Handler) ReloadConfig(cfg *config.Config) []string {
+	h.configMu.Lock()
+	defer h.configMu.Unlock()
+
+	updated := config.NewConfig()
+	if h.config != nil {
+		*updated = *h.config
+	}
+	changes := updated.ApplyReloadable(cfg)
+	if len(changes) > 0 {
+		h.config = updated
+	}
+	return changes
+}
+
+// authUsername returns the username clients authenticate as
+func (h *Handler) authUsername() string {
+	cfg := h.Config()
+	if cfg != nil && cfg.Auth != nil && cfg.Auth.Username != "" {
+		return cfg.Auth.Username
+	}
+	return "root"
+}
+
+// maxResultRows returns the row cap for queries on the given tenant (0 means unlimited)
+func (h *Handler) maxResultRows(idx string) int {
+	cfg := h.Config()
+	if cfg == nil {
+		return 0
+	}
+	return cfg.MaxResultRowsFor(idx)
+}
+
+// erQueryTimeout is MySQL's ER_QUERY_TIMEOUT, raised when max_execution_time is exceeded
+const erQueryTimeout = 3024
+
+// statementContext returns the context a single statement runs under, bounded by the
+// configured statement timeout when one is set
+func (h *Handler) statementContext() (context.Context, context.CancelFunc) {
+	cfg := h.Config()
+	if cfg == nil || cfg.StatementTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), cfg.StatementTimeout)
+}
+
+// statementInterrupted returns the MySQL error for a statement whose context ended before it
+// finished, by the statement timeout or by KILL QUERY, and nil while ctx is still live
+func (h *Handler) statementInterrupted(ctx context.Context, query string) error {
+	switch ctx.Err() {
+	case context.DeadlineExceeded:
+		return h.statementTimeoutError(query)
+	case context.Canceled:
+		h.logWithIdx("Statement interrupted by KILL QUERY: %s", query)
+		return mysql.NewError(mysql.ER_QUERY_INTERRUPTED, "Query execution was interrupted")
+	}
+	return nil
+}
+
+// statementTimeoutError logs a timed-out statement against its tenant and returns the MySQL error for it
+func (h *Handler) statementTimeoutError(query string) error {
+	h.logWithIdx("Statement exceeded timeout of %v: %s", h.Config().StatementTimeout, query)
+	return mysql.NewError(erQueryTimeout, "Query execution was interrupted, maximum statement execution time exceeded")
+}
+
+// formatBindParams renders prepared-statement arguments for logging. It returns false when
+// parameter logging is disabled, otherwise the arguments masked per the configured redaction mode.
+func (h *Handler) formatBindParams(args []interface{}) (string, bool) {
+	if cfg := h.Config(); cfg != nil && !cfg.LogBindParams {
+		return "", false
+	}
 	
-	var prefix string
-	// Check for user-defined session variable @idx
-	if idxVar, exists := session.GetUser("idx"); exists && idxVar != nil {
-		prefix = fmt.Sprintf("[idx=%v] ", idxVar)
+	mode := h.bindParamRedaction()
+	formatted := make([]string, len(args))
+	for i, arg := range args {
+		formatted[i] = maskValue(mode, arg)
+	}
+	return "[" + strings.Join(formatted, " ") + "]", true
+}
+
+// bindParamRedaction returns the configured mode for masking logged values
+func (h *Handler) bindParamRedaction() string {
+	if cfg := h.Config(); cfg != nil && cfg.BindParamRedaction != "" {
+		return cfg.BindParamRedaction
+	}
+	return config.BindParamRedactionNone
+}
+
+// maskValue renders a logged value masked per the redaction mode
+func maskValue(mode string, value interface{}) string {
+	switch mode {
+	case config.BindParamRedactionRedact:
+		return "<redacted>"
+	case config.BindParamRedactionHash:
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%v", value)))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	default:
+		return fmt.Sprintf("%v", value)
+	}
+}
+
+// redactLiterals masks the quoted string and number literals in query per the redaction mode,
+// leaving keywords, identifiers and placeholders alone, so a statement keeps its shape without
+// its values
+func redactLiterals(query, mode string) string {
+	if mode == config.BindParamRedactionNone {
+		return query
 	}
 	
+	runes := []rune(query)
+	var redacted strings.Builder
+	for i := 0; i < len(runes); i++ {
+		c := runes[i]
+		switch {
+		case c == '\'' || c == '"':
+			var literal strings.Builder
+			end := i + 1
+			for ; end < len(runes); end++ {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				} else if runes[end] == c {
+					if end+1 >= len(runes) || runes[end+1] != c {
+						break
+					}
+					end++ // A doubled quote stands for one
+				}
+				literal.WriteRune(runes[end])
+			}
+			redacted.WriteString(maskValue(mode, literal.String()))
+			i = end
+		case c == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != '`' {
+				end++
+			}
+			redacted.WriteString(string(runes[i:min(end+1, len(runes))]))
+			i = end
+		case unicode.IsDigit(c) && (i == 0 || !isWordRune(runes[i-1])):
+			end := i
+			for end < len(runes) && (isWordRune(runes[end]) || runes[end] == '.') {
+				end++
+			}
+			redacted.WriteString(maskValue(mode, string(runes[i:end])))
+			i = end - 1
+		default:
+			redacted.WriteRune(c)
+		}
+	}
+	return redacted.String()
+}
+
+// isWordRune reports whether c may appear in an unquoted identifier or number
+func isWordRune(c rune) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
+
+// maxAllowedPacket returns the largest query payload accepted, in bytes
+func (h *Handler) maxAllowedPacket() int {
+	cfg := h.Config()
+	if cfg == nil || cfg.MaxAllowedPacket == 0 {
+		return config.DefaultMaxAllowedPacket
+	}
+	return cfg.MaxAllowedPacket
+}
+
+// systemVariables returns the @@variables visible to a session: server defaults, values
+// derived from configuration and anything the session has set itself, apart from the read-only
+// server settings
+func (h *Handler) systemVariables(session *SessionVariables) map[string]interface{} {
+	vars := h.globalSystemVariables()
+	for name, value := range session.GetAllSystem() {
+		if !slices.Contains(readOnlySystemVariables, name) {
+			vars[name] = value
+		}
+	}
+	vars["warning_count"] = len(session.GetWarnings())
+	return vars
+}
+
+// globalSystemVariables returns the server-wide @@global.variables: server defaults and values
+// derived from configuration, unaffected by anything a session sets
+func (h *Handler) globalSystemVariables() map[string]interface{} {
+	vars := make(map[string]interface{})
+	for name, value := range defaultSystemVariables {
+		vars[name] = value
+	}
+	vars["max_allowed_packet"] = h.maxAllowedPacket()
+	if h.lowerCaseTableNames() {
+		vars["lower_case_table_names"] = 1
+	}
+	if cfg := h.Config(); cfg != nil && cfg.DefaultTimeZone != "" {
+		vars["time_zone"] = cfg.DefaultTimeZone
+	}
+	return vars
+}
+
+// systemVariable looks up a single @@variable for a session
+func (h *Handler) systemVariable(session *SessionVariables, name string) (interface{}, bool) {
+	value, exists := h.systemVariables(session)[strings.ToLower(name)]
+	return value, exists
+}
+
+// globalSystemVariable looks up a single @@global.variable
+func (h *Handler) globalSystemVariable(name string) (interface{}, bool) {
+	value, exists := h.globalSystemVariables()[strings.ToLower(name)]
+	return value, exists
+}
+
+// forConnection returns a Handler bound to connID, sharing everything else with h
+func (h *Handler) forConnection(connID uint32) *Handler {
+	bound := &Handler{handlerState: h.handlerState, connID: connID}
+	bound.queryHandlers = NewQueryHandlers(bound)
+	return bound
+}
+
+// currentConnection returns the connection the command being handled came from
+func (h *Handler) currentConnection() uint32 {
+	if h.connID != 0 {
+		return h.connID
+	}
+	return h.sessionManager.GetCurrentConnection()
+}
+
+// lowerCaseTableNames reports whether table names are resolved case-insensitively
+func (h *Handler) lowerCaseTableNames() bool {
+	cfg := h.Config()
+	return cfg != nil && cfg.LowerCaseTableNames
+}
+
+// mysqlCompat reports whether MySQL-only clauses SQLite rejects are rewritten and result
+// columns named as MySQL names them
+func (h *Handler) mysqlCompat() bool {
+	cfg := h.Config()
+	return cfg == nil || cfg.MySQLCompat
+}
+
+// logPrefix returns the "[conn=N] [idx=T] " prefix that attributes a log line to a connection
+// and the tenant it is bound to
+func (h *Handler) logPrefix(connID uint32) string {
+	tenant := h.sessionManager.GetOrCreateSession(connID).CurrentTenant()
+	if tenant == "" {
+		tenant = "default"
+	}
+	return fmt.Sprintf("[conn=%d] [idx=%s] ", connID, tenant)
+}
+
+// logWithIdx formats a log message prefixed with the current connection id and tenant
+func (h *Handler) logWithIdx(format string, args ...interface{}) {
+	prefix := h.logPrefix(h.currentConnection())
 	message := fmt.Sprintf(format, args...)
 	h.logger.Printf("%s%s", prefix, message)
 }
 
-// UseDB implements the MySQL UseDB command
+// strictTenants reports whether tenants must exist before a session may select them, because
+// tenant databases are not created on first use
+func (h *Handler) strictTenants() bool {
+	cfg := h.Config()
+	return cfg != nil && !cfg.AutocreateTenants
+}
+
+// authorizeLogin checks that the user a client logged in as may use the tenant its idx attribute
+// or username prefix selects, returning MySQL's access denied error when it may not
+func (h *Handler) authorizeLogin(username string, attributes map[string]string) error {
+	cfg := h.Config()
+	if cfg == nil || len(cfg.TenantUserAccess) == 0 {
+		return nil
+	}
+	tenant, ok := loginTenant(cfg.TenantResolvers, username, attributes)
+	if !ok {
+		return nil
+	}
+	
+	return tenantAccessError(cfg, username, tenant)
+}
+
+// authorizeTenant checks that the user session logged in as may use tenant, which a statement is
+// about to switch to through SET @idx or an idx hint, returning MySQL's access denied error when
+// it may not. The login alone is checked once, so every later change of tenant must be too.
+func (h *Handler) authorizeTenant(session *SessionVariables, tenant string) error {
+	cfg := h.Config()
+	if cfg == nil || len(cfg.TenantUserAccess) == 0 || tenant == "" {
+		return nil
+	}
+	return tenantAccessError(cfg, session.Username(), tenant)
+}
+
+// tenantAccessError returns MySQL's access denied error when username may not use tenant, and nil
+// when it may
+func tenantAccessError(cfg *config.Config, username, tenant string) error {
+	user := tenantPrefixCredentials{}.unprefixed(username)
+	if cfg.UserMayUseTenant(user, tenant) {
+		return nil
+	}
+	return mysql.NewError(mysql.ER_DBACCESS_DENIED_ERROR, fmt.Sprintf("Access denied for user '%s'@'%%' to database 'multitenant_db_idx_%s'", user, tenant))
+}
+
+// systemSchemas are the MySQL system databases SHOW DATABASES always lists
+var systemSchemas = []string{"information_schema", "mysql", "performance_schema", "sys"}
+
+// isSystemSchema reports whether dbName is one of systemSchemas, which MySQL matches ignoring case
+func isSystemSchema(dbName string) bool {
+	return slices.Contains(systemSchemas, strings.ToLower(dbName))
+}
+
+// UseDB implements the MySQL UseDB command. Any database name is accepted, except that strict
+// tenant mode refuses names that are neither a system schema nor the database of an existing
+// tenant.
 func (h *Handler) UseDB(dbName string) error {
 	h.logWithIdx("Client switching to database: %s", dbName)
-	// Accept any database name for simplicity
+	if h.strictTenants() && !isSystemSchema(dbName) {
+		idx, ok := databaseIdx(dbName)
+		if !ok || !h.databaseManager.HasDatabase(idx) {
+			return unknownDatabaseError(dbName)
+		}
+	}
 	return nil
 }
 
+// databaseIdx returns the tenant whose MySQL-facing database name is dbName, and false when the
+// name does not belong to any tenant
+func databaseIdx(dbName string) (string, bool) {
+	switch {
+	case dbName == "multitenant_db":
+		return "default", true
+	case strings.HasPrefix(dbName, "multitenant_db_idx_") && len(dbName) > len("multitenant_db_idx_"):
+		return strings.TrimPrefix(dbName, "multitenant_db_idx_"), true
+	}
+	return "", false
+}
+
+// unknownDatabaseError is the MySQL error for selecting a database that does not exist
+func unknownDatabaseError(dbName string) error {
+	return mysql.NewError(mysql.ER_BAD_DB_ERROR, fmt.Sprintf("Unknown database '%s'", dbName))
+}
+
+// invalidIdxError is MySQL's error for a value @idx can't take, returned for a tenant ID that
+// config.CheckIdx rejects
+func invalidIdxError(idx string) error {
+	return mysql.NewError(mysql.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("Variable 'idx' can't be set to the value of '%s'", idx))
+}
+
 // HandleQuery implements the MySQL Query command
 func (h *Handler) HandleQuery(query string) (*mysql.Result, error) {
+	// Some clients send empty queries as keep-alives; answer them without executing or logging anything
+	if strings.TrimSpace(query) == "" {
+		return h.emptyQueryResult()
+	}
+	return h.handleQuery(query, nil)
+}
+
+// emptyQueryResult answers an empty query according to the configured empty query mode: an OK
+// result with no affected rows by default, or MySQL's own "Query was empty" error
+func (h *Handler) emptyQueryResult() (*mysql.Result, error) {
+	if cfg := h.Config(); cfg != nil && cfg.EmptyQueryMode == config.EmptyQueryModeError {
+		return nil, mysql.NewError(mysql.ER_EMPTY_QUERY, "Query was empty")
+	}
+	return mysql.NewResult(nil), nil
+}
+
+// handleQuery executes query and records it in the query log, along with any
+// prepared-statement arguments allowed by the bind parameter logging settings
+func (h *Handler) handleQuery(query string, args []interface{}) (*mysql.Result, error) {
 	startTime := time.Now()
-	connectionID := fmt.Sprintf("conn_%d", h.sessionManager.GetCurrentConnection())
+	connectionID := fmt.Sprintf("conn_%d", h.currentConnection())
+	
+	// A leading /* idx=tenant */ hint routes this statement alone to the tenant, which it is also
+	// logged under; the session stays bound to its own tenant
+	statement := query
+	var hintErr error
+	if idx, stripped, ok := parseTenantHint(query); ok {
+		statement = stripped
+		session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+		// A forbidden tenant is never pinned, so the statement isn't even logged under it
+		if config.CheckIdx(idx) != "" {
+			hintErr = invalidIdxError(idx)
+		} else if hintErr = h.authorizeTenant(session, idx); hintErr == nil {
+			session.pinTenant(idx)
+			defer session.unpinTenant()
+			if h.strictTenants() && !h.databaseManager.HasDatabase(idx) {
+				hintErr = unknownDatabaseError(fmt.Sprintf("multitenant_db_idx_%s", idx))
+			}
+		}
+	}
 	
 	h.logWithIdx("Executing query: %s", query)
 	
-	// Execute the actual query
-	result, err := h.executeQueryInternal(query)
+	// Execute the actual query, rejecting payloads larger than max_allowed_packet
+	var result *mysql.Result
+	var err error
+	if len(query) > h.maxAllowedPacket() {
+		h.logWithIdx("Rejected query of %d bytes exceeding max_allowed_packet (%d)", len(query), h.maxAllowedPacket())
+		err = mysql.NewError(mysql.ER_NET_PACKET_TOO_LARGE, "Got a packet bigger than 'max_allowed_packet' bytes")
+	} else if hintErr != nil {
+		err = hintErr
+	} else {
+		result, err = h.executeQueryInternal(statement, args)
+	}
 	
 	// Get current session to determine tenant ID AFTER query execution
 	// This ensures SET @idx commands are properly reflected in the logs
-	session := h.sessionManager.GetOrCreateSession(h.sessionManager.GetCurrentConnection())
-	tenantIDVal, _ := session.GetUser("idx")
-	tenantID := ""
-	if tenantIDVal != nil {
-		// Convert the tenant ID to string, regardless of its original type
-		switch v := tenantIDVal.(type) {
-		case string:
-			tenantID = v
-		case int:
-			tenantID = fmt.Sprintf("%d", v)
-		case int64:
-			tenantID = fmt.Sprintf("%d", v)
-		case float64:
-			tenantID = fmt.Sprintf("%.0f", v)
-		default:
-			tenantID = fmt.Sprintf("%v", v)
-		}
-	}
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+	tenantID := session.CurrentTenant()
+	h.queryStats.Record(tenantID)
 	
 	// Log the query execution
 	duration := time.Since(startTime)
 	success := err == nil
+	h.queryStats.ObserveDuration(tenantID, query, success, duration)
 	errorMsg := ""
 	if err != nil {
 		errorMsg = err.Error()
+		h.databaseManager.RecordTenantError(tenantID, err)
+	}
+	
+	loggedQuery := query
+	preview := redactLiterals(query, h.bindParamRedaction())
+	if len(args) > 0 {
+		if params, ok := h.formatBindParams(args); ok {
+			loggedQuery = fmt.Sprintf("%s -- params: %s", query, params)
+			preview = fmt.Sprintf("%s -- params: %s", preview, params)
+		}
+	}
+	
+	// Session-management statements can be kept out of the query log, as every client sends them
+	if cfg := h.Config(); cfg != nil && cfg.QueryLogSkipSession && isSessionStatement(statement) {
+		return result, err
+	}
+	
+	// The tenant's last statement is previewed as logged, its literals masked like its arguments
+	h.databaseManager.RecordTenantQuery(tenantID, preview)
+	
+	// Slow statements can have their query plan captured alongside the log entry. The database is
+	// looked up now, while a tenant hint still applies, and explained in the background.
+	var planDB *sql.DB
+	if success && h.explainsSlowQueries(duration) && isExplainable(statement) {
+		if db, dbErr := h.databaseManager.GetDatabaseForSession(session); dbErr == nil {
+			planDB = db
+		}
 	}
 	
 	// Log the query (non-blocking)
 	go func() {
-		if logErr := h.queryLogger.LogQuery(tenantID, query, connectionID, duration, success, errorMsg); logErr != nil {
+		explain := ""
+		if planDB != nil {
+			explain = h.captureQueryPlan(planDB, statement)
+		}
+		if logErr := h.queryLogger.LogQueryWithPlan(tenantID, loggedQuery, connectionID, duration, success, errorMsg, explain); logErr != nil {
 			h.logger.Printf("Failed to log query: %v", logErr)
 		}
 	}()
@@ -128,42 +622,291 @@ func (h *Handler) HandleQuery(query string) (*mysql.Result, error) {
 	return result, err
 }
 
-// executeQueryInternal contains the original query execution logic
-func (h *Handler) executeQueryInternal(query string) (*mysql.Result, error) {
+// executeQueryInternal contains the original query execution logic. Prepared-statement args
+// are bound as parameters by SQLite for the statements it runs, and inlined as literals for the
+// statements answered here.
+func (h *Handler) executeQueryInternal(query string, args []interface{}) (*mysql.Result, error) {
+	sqliteQuery := query
+	if len(args) > 0 {
+		query = inlineArgs(query, args)
+	}
+	
 	// Convert query to lowercase for easier parsing
 	queryLower := strings.ToLower(strings.TrimSpace(query))
 	
+	// SHOW WARNINGS and @@warning_count report on the previous statement, every other statement
+	// starts with a clean slate
+	if showWarningsRegex.MatchString(query) {
+		return h.queryHandlers.HandleShowWarnings(query)
+	}
+	if selectWarningCountRegex.MatchString(query) {
+		return h.queryHandlers.HandleSelectVariable(query)
+	}
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+	session.SetWarnings(nil)
+	
 	// Use the query handlers for MySQL-specific commands
 	switch {
 	case strings.HasPrefix(queryLower, "show databases"):
-		return h.queryHandlers.HandleShowDatabases()
-	case strings.HasPrefix(queryLower, "show tables"):
-		return h.queryHandlers.HandleShowTables()
+		return h.queryHandlers.HandleShowDatabases(query)
+	case showTablesRegex.MatchString(query):
+		return h.queryHandlers.HandleShowTables(query)
 	case strings.HasPrefix(queryLower, "show variables"):
-		return h.queryHandlers.HandleShowVariables()
+		return h.queryHandlers.HandleShowVariables(query)
+	case strings.HasPrefix(queryLower, "show grants"):
+		return h.queryHandlers.HandleShowGrants(query)
 	case strings.HasPrefix(queryLower, "describe ") || strings.HasPrefix(queryLower, "desc "):
 		return h.queryHandlers.HandleDescribe(query)
-	case strings.HasPrefix(queryLower, "set ") && strings.Contains(queryLower, "@"):
+	case setTransactionRegex.MatchString(query):
+		return h.queryHandlers.HandleSetTransaction(query)
+	case setStatementRegex.MatchString(query):
 		return h.queryHandlers.HandleSet(query)
-	case strings.Contains(queryLower, "@") && strings.HasPrefix(queryLower, "select"):
+	case selectVariableRegex.MatchString(query):
 		return h.queryHandlers.HandleSelectVariable(query)
+	case callRegex.MatchString(query):
+		return h.queryHandlers.HandleCall(query)
+	case tableMaintenanceRegex.MatchString(query):
+		return h.queryHandlers.HandleTableMaintenance(query)
+	case flushRegex.MatchString(query):
+		return h.queryHandlers.HandleFlush(query)
+	case foundRowsRegex.MatchString(query):
+		return h.queryHandlers.HandleFoundRows(query)
+	case connectionIDRegex.MatchString(query):
+		return h.queryHandlers.HandleConnectionID(query)
+	case sleepRegex.MatchString(query):
+		return h.queryHandlers.HandleSleep(query)
+	case isTimeFunctionSelect(query):
+		return h.queryHandlers.HandleTimeFunctions(query)
+	case processlistRegex.MatchString(query):
+		return h.queryHandlers.HandleShowProcesslist(query)
+	case killRegex.MatchString(query):
+		return h.queryHandlers.HandleKill(query)
+	case useRegex.MatchString(query):
+		return h.queryHandlers.HandleUse(query)
 	default:
-		// Let SQLite handle everything else
-		return h.executeSQLiteQuery(query)
+		query = sqliteQuery
+		
+		query = h.withoutLockingClause(session.CurrentTenant(), query)
+		query = h.queryHandlers.inlineVariables(session, query)
+		// Strip SQL_CALC_FOUND_ROWS for SQLite, then count the rows the query would return without its LIMIT
+		if stripped, ok := stripCalcFoundRows(query); ok {
+			result, err := h.executeSQLiteQuery(stripped, args)
+			if err == nil {
+				h.queryHandlers.countWithoutLimit(stripped, args)
+			}
+			return result, err
+		}
+		// Let SQLite handle everything else, refusing destructive statements where they are blocked
+		// and writes while the session or transaction is read only
+		if isDestructiveStatement(query) && h.databaseManager.blocksDestructive(session.CurrentTenant()) {
+			h.logWithIdx("Rejected destructive statement: %s", query)
+			return nil, destructiveBlockedError()
+		}
+		if writesQueryLog(query) {
+			h.logWithIdx("Rejected write to the query log table: %s", query)
+			return nil, queryLogAccessDeniedError(query)
+		}
+		if session.ReadOnly() && isWriteStatement(query) {
+			return nil, mysql.NewError(mysql.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION, "Cannot execute statement in a READ ONLY transaction.")
+		}
+		// Under connection affinity another session's open transaction would take in this one's
+		// writes, and a ROLLBACK there would undo them
+		connID := h.currentConnection()
+		begins := beginsTransaction(query)
+		if (begins || isWriteStatement(query)) && h.databaseManager.transactionBlocked(session.CurrentTenant(), connID) {
+			h.logWithIdx("Rejected statement while another connection's transaction is open: %s", query)
+			return nil, transactionBlockedError()
+		}
+		if begins && !h.databaseManager.claimTransaction(session.CurrentTenant(), connID) {
+			return nil, transactionBlockedError()
+		}
+		implicitCommit := false
+		if session.InTransaction() && isDDLStatement(query) {
+			if err := h.implicitCommit(session); err != nil {
+				return nil, err
+			}
+			implicitCommit = true
+		}
+		result, err := h.executeSQLiteStatement(query, args)
+		if err != nil && begins && !session.InTransaction() {
+			h.databaseManager.releaseTransaction(connID)
+		}
+		if err == nil {
+			if warnings := h.trackTransaction(session, query); len(warnings) > 0 && result != nil {
+				session.SetWarnings(warnings)
+				result.Warnings = uint16(len(warnings))
+			}
+			if isDDLStatement(query) {
+				h.databaseManager.markSchemaModified(session.CurrentTenant())
+			}
+		}
+		if implicitCommit && result != nil {
+			session.SetWarnings([]Warning{{
+				Level:   "Note",
+				Code:    mysql.ER_UNKNOWN_ERROR,
+				Message: "The open transaction was committed implicitly before this statement",
+			}})
+			result.Warnings = 1
+		}
+		return result, err
+	}
+}
+
+// executeSQLiteStatement runs a statement that reached SQLite, translating the MySQL syntax it
+// can't parse first. ALTER TABLE ... ADD COLUMN becomes one SQLite ALTER TABLE per added column;
+// they run in one transaction, so when one fails none of the columns are added, as in MySQL.
+func (h *Handler) executeSQLiteStatement(query string, args []interface{}) (*mysql.Result, error) {
+	statements, ok := translateAddColumns(query)
+	if !ok {
+		return h.executeSQLiteQuery(query, args)
+	}
+	
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+	db, err := h.databaseManager.GetDatabaseForSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %v", err)
+	}
+	
+	ctx, cancel := h.statementContext()
+	defer cancel()
+	session.trackStatement(cancel)
+	defer session.trackStatement(nil)
+	
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("SQLite error: %v", err)
+	}
+	defer tx.Rollback()
+	
+	var result *mysql.Result
+	for _, statement := range statements {
+		h.logWithIdx("Translated for SQLite: %s", statement)
+		if result, err = h.execSQLiteStatement(ctx, tx, statement, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("SQLite error: %v", err)
+	}
+	return result, nil
+}
+
+// ExecuteQuery runs query for idx as DatabaseManager.ExecuteQuery does, rewritten for SQLite as
+// statements from MySQL clients are: a locking clause is stripped, and TIMESTAMP values written or
+// compared are converted from the default time_zone to UTC. The result's SQL is the statement SQLite ran.
+func (h *Handler) ExecuteQuery(idx string, query string, args []interface{}) (*QueryResult, error) {
+	location, err := h.sessionLocation(NewSessionVariables())
+	if err != nil {
+		return nil, err
+	}
+	rewrite := func(db sqlQuerier, query string, args []interface{}) (string, []interface{}) {
+		query = h.withoutLockingClause(idx, query)
+		return timestampsToUTC(h.databaseManager.cachedColumnTypes(db, idx), query, args, location)
+	}
+	
+	result, err := h.databaseManager.executeQuery(idx, query, args, rewrite)
+	if err != nil {
+		h.databaseManager.RecordTenantError(idx, err)
+	}
+	return result, err
+}
+
+// withoutLockingClause strips the locking clause of a SELECT for tenant in MySQL compatibility
+// mode. SQLite has no row locks and rejects locking reads; a write transaction locks the whole
+// database, so running the plain SELECT is safe. A default database on MySQL keeps the clause,
+// which there takes the row locks the client asked for.
+func (h *Handler) withoutLockingClause(tenant, query string) string {
+	if !h.mysqlCompat() || h.databaseManager.onMySQL(tenant) {
+		return query
+	}
+	if stripped, ok := stripLockingClause(query); ok {
+		h.logWithIdx("Stripped locking clause for SQLite: %s", stripped)
+		return stripped
+	}
+	return query
+}
+
+// implicitCommit commits the session's open transaction ahead of a DDL statement. MySQL commits
+// implicitly before DDL, while SQLite would make the DDL part of the transaction, so without this
+// a later ROLLBACK would undo schema changes a MySQL client expects to be permanent.
+func (h *Handler) implicitCommit(session *SessionVariables) error {
+	if _, err := h.executeSQLiteQuery("COMMIT", nil); err != nil {
+		return fmt.Errorf("implicit commit before DDL failed: %v", err)
 	}
+	session.EndTransaction()
+	h.databaseManager.releaseTransaction(h.currentConnection())
+	h.logWithIdx("Committed the open transaction implicitly before DDL")
+	return nil
 }
 
-// executeSQLiteQuery executes a query directly against SQLite and converts results to MySQL format
-func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
+// trackTransaction follows explicit transaction boundaries so SET TRANSACTION characteristics
+// apply to the transaction they were set for. A transaction started at an isolation level the
+// client chose but SQLite does not provide gets the not-enforced warning again.
+func (h *Handler) trackTransaction(session *SessionVariables, query string) []Warning {
+	fields := strings.Fields(strings.ToLower(strings.TrimRight(strings.TrimSpace(query), ";")))
+	switch {
+	case len(fields) == 0:
+	case beginsTransaction(query):
+		chars := session.BeginTransaction()
+		h.logWithIdx("Transaction started: isolation %s (SQLite executes it as %s), read only %t",
+			chars.IsolationLevel, sqliteIsolationLevel(chars.IsolationLevel), *chars.ReadOnly)
+		if chars.IsolationLevel != defaultSystemVariables["transaction_isolation"] {
+			return isolationWarnings(chars.IsolationLevel)
+		}
+	case fields[0] == "commit" || fields[0] == "end":
+		session.EndTransaction()
+		h.databaseManager.releaseTransaction(h.currentConnection())
+	case fields[0] == "rollback" && !strings.Contains(strings.Join(fields, " "), " to "):
+		// ROLLBACK TO SAVEPOINT keeps the transaction open
+		session.EndTransaction()
+		h.databaseManager.releaseTransaction(h.currentConnection())
+	}
+	return nil
+}
+
+// beginsTransaction reports whether query is BEGIN or START TRANSACTION
+func beginsTransaction(query string) bool {
+	fields := strings.Fields(strings.ToLower(strings.TrimRight(strings.TrimSpace(query), ";")))
+	return len(fields) > 0 && (fields[0] == "begin" || (fields[0] == "start" && len(fields) > 1 && fields[1] == "transaction"))
+}
+
+// transactionBlockedError is MySQL's lock wait timeout, returned at once for statements that
+// would run inside another connection's transaction under connection affinity
+func transactionBlockedError() error {
+	return mysql.NewError(mysql.ER_LOCK_WAIT_TIMEOUT, "Lock wait timeout exceeded; try restarting transaction")
+}
+
+// executeSQLiteQuery executes a query directly against SQLite, binding args to its placeholders, and
+// converts results to MySQL format. The statement timeout and KILL QUERY only interrupt this
+// statement; they never close the underlying connection.
+func (h *Handler) executeSQLiteQuery(query string, args []interface{}) (*mysql.Result, error) {
 	// Get the database for the current session
-	session := h.sessionManager.GetOrCreateSession(h.sessionManager.GetCurrentConnection())
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
 	db, err := h.databaseManager.GetDatabaseForSession(session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %v", err)
 	}
 	
-	// First try as a query (SELECT, WITH, etc.) - anything that returns rows
-	rows, err := db.Query(query)
+	ctx, cancel := h.statementContext()
+	defer cancel()
+	session.trackStatement(cancel)
+	defer session.trackStatement(nil)
+	
+	location, err := h.sessionLocation(session)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Data changes only return rows with a RETURNING clause; the rest go straight to Exec so
+	// clients get the affected row count and last insert id
+	args = sqliteArgs(args)
+	query, args = timestampsToUTC(h.databaseManager.cachedColumnTypes(db, session.CurrentTenant()), query, args, location)
+	if isDataChange(query) && !hasReturningClause(query) {
+		return h.execSQLiteStatement(ctx, db, query, args)
+	}
+	
+	// First try as a query (SELECT, WITH, INSERT ... RETURNING, etc.) - anything that returns rows
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err == nil {
 		defer rows.Close()
 		
@@ -172,11 +915,37 @@ func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get columns: %v", err)
 		}
+		if h.mysqlCompat() {
+			for i, column := range columns {
+				columns[i] = mysqlColumnName(column)
+			}
+		}
+		
+		// BLOB columns keep their raw bytes, everything else is sent as text. TIMESTAMP values
+		// are stored in UTC and reported in the session time_zone; DATETIME values are reported
+		// as written.
+		blobColumns := make([]bool, len(columns))
+		timestampColumns := make([]bool, len(columns))
+		if columnTypes, err := rows.ColumnTypes(); err == nil {
+			for i, columnType := range columnTypes {
+				blobColumns[i] = isBlobType(columnType.DatabaseTypeName())
+				timestampColumns[i] = isTimestampType(columnType.DatabaseTypeName())
+			}
+		}
 		
 		// Prepare result data
 		var values [][]interface{}
 		
+		maxRows := h.maxResultRows(session.CurrentTenant())
+		truncated := false
+		
 		for rows.Next() {
+			// Stop scanning once the cap is reached; another row being available means we truncated
+			if maxRows > 0 && len(values) >= maxRows {
+				truncated = true
+				break
+			}
+			
 			// Create a slice of interface{} to hold each column value
 			columnValues := make([]interface{}, len(columns))
 			columnPointers := make([]interface{}, len(columns))
@@ -186,14 +955,19 @@ func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
 			}
 			
 			if err := rows.Scan(columnPointers...); err != nil {
+				if err := h.statementInterrupted(ctx, query); err != nil {
+					return nil, err
+				}
 				return nil, fmt.Errorf("failed to scan row: %v", err)
 			}
 			
 			// Convert []byte to string for text columns
 			row := make([]interface{}, len(columns))
 			for i, val := range columnValues {
-				if b, ok := val.([]byte); ok {
+				if b, ok := val.([]byte); ok && !blobColumns[i] {
 					row[i] = string(b)
+				} else if t, ok := val.(time.Time); ok && timestampColumns[i] {
+					row[i] = t.In(location)
 				} else {
 					row[i] = val
 				}
@@ -203,6 +977,9 @@ func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
 		}
 		
 		if err = rows.Err(); err != nil {
+			if err := h.statementInterrupted(ctx, query); err != nil {
+				return nil, err
+			}
 			return nil, fmt.Errorf("rows iteration error: %v", err)
 		}
 		
@@ -212,12 +989,85 @@ func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
 			return nil, fmt.Errorf("failed to build resultset: %v", err)
 		}
 		
-		return mysql.NewResult(resultset), nil
+		for i, field := range resultset.Fields {
+			if blobColumns[i] {
+				field.Type = mysql.MYSQL_TYPE_BLOB
+				field.Charset = 63 // binary
+				field.Flag |= mysql.BINARY_FLAG | mysql.BLOB_FLAG
+			}
+		}
+		
+		result := mysql.NewResult(resultset)
+		if len(columns) > 0 {
+			session.SetFoundRows(int64(len(values)))
+		}
+		if truncated {
+			h.logWithIdx("Result truncated to %d rows", maxRows)
+			session.SetWarnings([]Warning{{
+				Level:   "Warning",
+				Code:    mysql.ER_TOO_MANY_ROWS,
+				Message: fmt.Sprintf("Result truncated to %d rows (max_result_rows)", maxRows),
+			}})
+			result.Warnings = 1
+		}
+		
+		return result, nil
+	}
+	
+	if err := h.statementInterrupted(ctx, query); err != nil {
+		return nil, err
+	}
+	
+	// If Query() failed, try as Exec() - for DDL and anything else that returns no rows
+	return h.execSQLiteStatement(ctx, db, query, args)
+}
+
+// mysqlColumnName returns the name MySQL gives the result column SQLite named name. Both report
+// aliases exactly as written, and unaliased expressions such as UPPER(name) by their text, but
+// MySQL names an unaliased string literal after its value: SELECT 'abc' is column abc, not 'abc'.
+func mysqlColumnName(name string) string {
+	if len(name) < 2 {
+		return name
+	}
+	quote := name[0]
+	if (quote != '\'' && quote != '"') || name[len(name)-1] != quote {
+		return name
 	}
 	
-	// If Query() failed, try as Exec() - for INSERT, UPDATE, DELETE, DDL, etc.
-	result, err := db.Exec(query)
+	// 'a' || 'b' starts and ends with a quote but is not one literal
+	inner, doubled := name[1:len(name)-1], string([]byte{quote, quote})
+	if strings.ContainsRune(strings.ReplaceAll(inner, doubled, ""), rune(quote)) {
+		return name
+	}
+	return strings.ReplaceAll(inner, doubled, string(quote))
+}
+
+// isBlobType reports whether a declared SQLite column type holds binary data
+func isBlobType(declared string) bool {
+	return strings.Contains(strings.ToUpper(declared), "BLOB")
+}
+
+// isTimestampType reports whether a declared SQLite column type is a TIMESTAMP, the only type
+// converted between the session time_zone and UTC. DATETIME and DATE values are zone-less.
+func isTimestampType(declared string) bool {
+	return strings.Contains(strings.ToUpper(declared), "TIMESTAMP")
+}
+
+// sqlExecer runs statements that return no rows, on a database pool or within a transaction
+type sqlExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// execSQLiteStatement runs a statement that returns no rows and reports its affected rows and insert id
+func (h *Handler) execSQLiteStatement(ctx context.Context, db sqlExecer, query string, args []interface{}) (*mysql.Result, error) {
+	result, err := db.ExecContext(ctx, query, args...)
 	if err != nil {
+		if err := h.statementInterrupted(ctx, query); err != nil {
+			return nil, err
+		}
+		if err := missingFeatureError(err); err != nil {
+			return nil, err
+		}
 		return nil, fmt.Errorf("SQLite error: %v", err)
 	}
 	
@@ -240,12 +1090,18 @@ func (h *Handler) executeSQLiteQuery(query string) (*mysql.Result, error) {
 func (h *Handler) HandleFieldList(table string, wildcard string) ([]*mysql.Field, error) {
 	h.logWithIdx("Field list requested for table: %s", table)	
 	
-	session := h.sessionManager.GetOrCreateSession(h.sessionManager.GetCurrentConnection())
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
 	db, err := h.databaseManager.GetDatabaseForSession(session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %v", err)
 	}
 	
+	if h.lowerCaseTableNames() {
+		if table, err = resolveTableName(db, table); err != nil {
+			return nil, err
+		}
+	}
+	
 	// Get table schema from SQLite
 	rows, err := db.Query("PRAGMA table_info(" + table + ")")
 	if err != nil {
@@ -253,22 +1109,17 @@ func (h *Handler) HandleFieldList(table string, wildcard string) ([]*mysql.Field
 	}
 	defer rows.Close()
 	
+	columns, err := scanTableColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	
 	var fields []*mysql.Field
 	
-	for rows.Next() {
-		var cid int
-		var name, dataType string
-		var notNull bool
-		var defaultValue interface{}
-		var pk bool
-		
-		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
-			return nil, fmt.Errorf("failed to scan column info: %v", err)
-		}
-		
+	for _, column := range columns {
 		// Convert SQLite types to MySQL field types
 		var fieldType byte
-		switch strings.ToLower(dataType) {
+		switch strings.ToLower(column.dataType) {
 		case "integer":
 			fieldType = mysql.MYSQL_TYPE_LONG
 		case "text":
@@ -279,9 +1130,18 @@ func (h *Handler) HandleFieldList(table string, wildcard string) ([]*mysql.Field
 			fieldType = mysql.MYSQL_TYPE_VAR_STRING
 		}
 		
+		var flag uint16
+		if column.pkSeq > 0 {
+			flag |= mysql.PRI_KEY_FLAG
+		}
+		if column.notNull {
+			flag |= mysql.NOT_NULL_FLAG
+		}
+		
 		fields = append(fields, &mysql.Field{
-			Name: []byte(name),
+			Name: []byte(column.name),
 			Type: fieldType,
+			Flag: flag,
 		})
 	}
 	
@@ -292,22 +1152,76 @@ func (h *Handler) HandleFieldList(table string, wildcard string) ([]*mysql.Field
 	return fields, nil
 }
 
-// HandleStmtPrepare implements prepared statement preparation
+// HandleStmtPrepare implements prepared statement preparation. The statement and its parameter
+// count are kept on the session under a statement ID, which is the context handed back on
+// execution and close; the parameter count tells clients how many arguments to send.
 func (h *Handler) HandleStmtPrepare(query string) (int, int, interface{}, error) {
-	h.logWithIdx("Prepared statement: %s", query)
-	// Return statement ID, parameter count, column count, context
-	return 1, 0, nil, nil
+	params := countPlaceholders(query)
+	session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+	id := session.prepareStatement(query, params)
+	h.logWithIdx("Prepared statement %d: %s", id, query)
+	// Return parameter count, column count (sent with each execution instead), context
+	return params, 0, id, nil
 }
 
-// HandleStmtExecute implements prepared statement execution
+// countPlaceholders counts the ? parameter markers in query outside comments, quoted strings and
+// identifiers
+func countPlaceholders(query string) int {
+	return strings.Count(blankQuoted(query), "?")
+}
+
+// HandleStmtExecute implements prepared statement execution. context is the statement ID from
+// HandleStmtPrepare, whose query runs with args bound to its parameters; a nil context runs query
+// itself, for callers in this process that never prepared it. Executions use the binary protocol,
+// so result rows are re-encoded from the text resultset the query handlers build.
 func (h *Handler) HandleStmtExecute(context interface{}, query string, args []interface{}) (*mysql.Result, error) {
-	h.logWithIdx("Executing prepared statement with args: %v", args)
-	return h.HandleQuery(query)
+	if id, ok := context.(uint32); ok {
+		stmt, ok := h.sessionManager.GetOrCreateSession(h.currentConnection()).preparedStatement(id)
+		if !ok {
+			return nil, unknownStatementError(id, "mysqld_stmt_execute")
+		}
+		if len(args) != stmt.params {
+			return nil, mysql.NewError(mysql.ER_WRONG_ARGUMENTS, "Incorrect arguments to mysqld_stmt_execute")
+		}
+		query = stmt.query
+	}
+	if params, ok := h.formatBindParams(args); ok {
+		h.logWithIdx("Executing prepared statement with args: %s", params)
+	} else {
+		h.logWithIdx("Executing prepared statement with %d args", len(args))
+	}
+	
+	result, err := h.handleQuery(query, args)
+	if err != nil || result == nil || !result.HasResultset() {
+		return result, err
+	}
+	
+	resultset, warnings, err := binaryResultset(result.Resultset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build binary resultset: %v", err)
+	}
+	result.Resultset = resultset
+	if len(warnings) > 0 {
+		session := h.sessionManager.GetOrCreateSession(h.currentConnection())
+		if result.Warnings > 0 {
+			// Keep the warnings the statement itself raised, such as a truncated result
+			warnings = append(session.GetWarnings(), warnings...)
+		}
+		session.SetWarnings(warnings)
+		result.Warnings = uint16(len(warnings))
+	}
+	return result, nil
 }
 
-// HandleStmtClose implements prepared statement cleanup
+// HandleStmtClose implements prepared statement cleanup, releasing the statement kept on the
+// session. Like MySQL, closing an unknown statement is not an error.
 func (h *Handler) HandleStmtClose(context interface{}) error {
-	h.logWithIdx("Closing prepared statement")
+	id, ok := context.(uint32)
+	if !ok {
+		return nil
+	}
+	h.logWithIdx("Closing prepared statement %d", id)
+	h.sessionManager.GetOrCreateSession(h.currentConnection()).closeStatement(id)
 	return nil
 }
 
@@ -317,9 +1231,14 @@ func (h *Handler) HandleOtherCommand(cmd byte, data []byte) error {
 	return mysql.NewDefaultError(mysql.ER_UNKNOWN_ERROR, "command not supported")
 }
 
-// Close closes all database connections
+// Close closes the query logger, which flushes its mirror, and all database connections
 func (h *Handler) Close() error {
-	return h.databaseManager.Close()
+	h.sessionManager.StopSessionGC()
+	logErr := h.queryLogger.Close()
+	if err := h.databaseManager.Close(); err != nil {
+		return err
+	}
+	return logErr
 }
 
 // StartServer starts the MySQL protocol server
@@ -334,81 +1253,120 @@ func StartServer(port int, handler *Handler) error {
 	
 	handler.logger.Printf("MySQL server listening on port %d", port)
 	
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			handler.logger.Printf("Failed to accept connection: %v", err)
-			continue
-		}
-		
-		go func() {
-			defer conn.Close()
-
-			// Get authentication credentials
-			username := "root"
-			password := ""
-			if handler.config != nil && handler.config.Auth != nil {
-				username = handler.config.Auth.Username
-				password = handler.config.Auth.Password
-			}
+	return handler.Serve(listener)
+}
 
-			// Create new MySQL connection with authentication
-			mysqlConn, err := server.NewConn(conn, username, password, handler)
-			if err != nil {
-				handler.logger.Printf("Failed to create MySQL connection: %v", err)
-				return
+// serveConnection authenticates a client connection and serves its commands until it closes
+func (h *Handler) serveConnection(conn net.Conn) {
+	defer conn.Close()
+	if !h.trackConnection(conn) {
+		return
+	}
+	defer h.untrackConnection(conn)
+
+	// Get authentication credentials
+	username := "root"
+	password := ""
+	cfg := h.Config()
+	if cfg != nil && cfg.Auth != nil {
+		username = cfg.Auth.Username
+		password = cfg.Auth.Password
+	}
+
+	// Create new MySQL connection with authentication. When tenants can be named in the username,
+	// the configured user is also accepted with a tenant prefix.
+	connHandler := &connectionHandler{Handler: h}
+	var mysqlConn *server.Conn
+	var err error
+	if cfg != nil && usesUsernamePrefix(cfg.TenantResolvers) {
+		credentials := tenantPrefixCredentials{username: username, password: password}
+		mysqlConn, err = tenantPrefixServer().NewCustomizedConn(conn, credentials, connHandler)
+	} else {
+		mysqlConn, err = server.NewConn(conn, username, password, connHandler)
+	}
+	if err != nil {
+		var myErr *mysql.MyError
+		if errors.As(err, &myErr) && myErr.Code == mysql.ER_ACCESS_DENIED_ERROR {
+			if auditErr := h.auditLog.Record(conn.RemoteAddr().String(), audit.ActionAuthFailure, "", err); auditErr != nil {
+				h.logger.Printf("Failed to write audit entry for failed login: %v", auditErr)
 			}
+		}
+		h.logger.Printf("Failed to create MySQL connection: %v", err)
+		return
+	}
+	defer func() {
+		if mysqlConn != nil {
 			defer func() {
-				if mysqlConn != nil {
-					defer func() {
-						if r := recover(); r != nil {
-							handler.logger.Printf("Recovered from panic in mysqlConn.Close(): %v", r)
-						}
-					}()
-					mysqlConn.Close()
-				}
-			}()
-			
-			// Get connection ID and set it for this handler instance
-			connID := handler.sessionManager.GetNextConnectionID()
-			handler.sessionManager.SetCurrentConnection(connID)
-			
-			// Create initial session
-			session := handler.sessionManager.GetOrCreateSession(connID)
-			_ = session // Use session to avoid unused variable warning
-			
-			handler.logger.Printf("New MySQL client connected [conn=%d] from %s", connID, conn.RemoteAddr())
-			
-			// Clean up session when connection closes
-			defer func() {
-				// Try to get idx context before removing session
-				var idxContext string
-				if session := handler.sessionManager.GetOrCreateSession(connID); session != nil {
-					if idxVar, hasIdx := session.GetUser("idx"); hasIdx && idxVar != nil {
-						idxContext = fmt.Sprintf("[idx=%v] ", idxVar)
-					}
+				if r := recover(); r != nil {
+					h.logger.Printf("Recovered from panic in mysqlConn.Close(): %v", r)
 				}
-				
-				handler.sessionManager.RemoveSession(connID)
-				handler.logger.Printf("%sMySQL client disconnected [conn=%d]: %s", idxContext, connID, conn.RemoteAddr())
 			}()
-			
-			// Handle the connection
-			for {
-				if err := mysqlConn.HandleCommand(); err != nil {
-					// For connection errors, we can try to get idx context
-					if session := handler.sessionManager.GetOrCreateSession(connID); session != nil {
-						if idxVar, hasIdx := session.GetUser("idx"); hasIdx && idxVar != nil {
-							handler.logger.Printf("[idx=%v] MySQL connection error [conn=%d]: %v", idxVar, connID, err)
-						} else {
-							handler.logger.Printf("MySQL connection error [conn=%d]: %v", connID, err)
-						}
-					} else {
-						handler.logger.Printf("MySQL connection error [conn=%d]: %v", connID, err)
-					}
-					break
-				}
+			mysqlConn.Close()
+		}
+	}()
+	
+	// Protocol compression is not supported and never advertised, so compliant clients fall back
+	// to uncompressed packets. One that requests it anyway would send packets we can't read and
+	// hang, so drop it straight away with a clear reason.
+	if mysqlConn.HasCapability(mysql.CLIENT_COMPRESS) {
+		h.logger.Printf("Refusing MySQL client from %s: protocol compression was requested but is not supported", conn.RemoteAddr())
+		return
+	}
+	
+	// Use the connection ID sent to the client in the handshake, so CONNECTION_ID(), the
+	// process list and the logs all report the same ID
+	connID := mysqlConn.ConnectionID()
+	connHandler.Handler = h.forConnection(connID)
+	
+	// Create initial session, bound to whichever tenant the client's login resolves to
+	session := h.sessionManager.OpenSession(connID, conn.RemoteAddr().String())
+	session.setConnectionCloser(func() { conn.Close() })
+	h.trackSession(conn, session)
+	session.setClient(mysqlConn.GetUser(), mysqlConn.Attributes())
+	
+	// The handshake has been answered already, so a login that selected a tenant its user may not
+	// use stays connected but gets access denied for every command and never reaches the tenant
+	if err := h.authorizeLogin(mysqlConn.GetUser(), mysqlConn.Attributes()); err != nil {
+		connHandler.denied = err
+		session.setClient("", nil)
+		h.logger.Printf("Denying MySQL client from %s: %v", conn.RemoteAddr(), err)
+		if auditErr := h.auditLog.Record(conn.RemoteAddr().String(), audit.ActionAuthFailure, "", err); auditErr != nil {
+			h.logger.Printf("Failed to write audit entry for denied tenant selection: %v", auditErr)
+		}
+	}
+	if tenant := session.CurrentTenant(); tenant != "" && h.strictTenants() && !h.databaseManager.HasDatabase(tenant) {
+		h.sessionManager.RemoveSession(connID)
+		h.logger.Printf("Refusing MySQL client from %s: unknown tenant %s", conn.RemoteAddr(), tenant)
+		return
+	}
+	
+	h.logger.Printf("%sNew MySQL client connected from %s", h.logPrefix(connID), conn.RemoteAddr())
+	
+	// Clean up session when connection closes, capturing the tenant context first
+	defer func() {
+		prefix := h.logPrefix(connID)
+		if idx, open := h.databaseManager.releaseTransaction(connID); open {
+			// The transaction lives on the connection every session of the tenant shares, so
+			// it has to end with the client that opened it
+			if err := h.databaseManager.rollbackTransaction(idx); err != nil {
+				h.logger.Printf("%sFailed to roll back the open transaction: %v", prefix, err)
+			}
+		}
+		h.sessionManager.RemoveSession(connID)
+		h.logger.Printf("%sMySQL client disconnected: %s", prefix, conn.RemoteAddr())
+	}()
+	
+	// Handle the connection until it closes or, once the server is shutting down, until the
+	// command in progress has been answered
+	for {
+		if err := mysqlConn.HandleCommand(); err != nil {
+			if !h.isShuttingDown() {
+				h.logger.Printf("%sMySQL connection error: %v", h.logPrefix(connID), err)
 			}
-		}()
+			break
+		}
+		if h.isShuttingDown() {
+			break
+		}
 	}
 }
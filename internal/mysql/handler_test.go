@@ -1,12 +1,27 @@
 package mysql
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"multitenant-db/internal/audit"
+	"multitenant-db/internal/config"
+
 	"github.com/go-mysql-org/go-mysql/mysql"
+	mysqldriver "github.com/go-sql-driver/mysql"
 )
 
 func TestNewHandler(t *testing.T) {
@@ -321,8 +336,21 @@ func TestHandler_PreparedStatements(t *testing.T) {
 		t.Errorf("Expected parameter count 0, got %d", paramCount)
 	}
 
-	// Test HandleStmtExecute
-	result, err := handler.HandleStmtExecute(context, "SELECT * FROM users", []interface{}{})
+	if context != uint32(1) {
+		t.Errorf("Expected the first statement on the session to have ID 1, got %v", context)
+	}
+
+	// Markers inside comments are not parameters
+	params, _, commented, _ := handler.HandleStmtPrepare("SELECT /* id? */ * FROM users WHERE id = ? -- why?\n# or?")
+	if params != 1 {
+		t.Errorf("Expected 1 parameter outside comments, got %d", params)
+	}
+	if commented != uint32(2) {
+		t.Errorf("Expected the second statement on the session to have ID 2, got %v", commented)
+	}
+
+	// The prepared query is used, not the one passed to execute
+	result, err := handler.HandleStmtExecute(context, "SELECT * FROM no_such_table", []interface{}{1})
 	if err != nil {
 		t.Errorf("HandleStmtExecute should not return error: %v", err)
 	}
@@ -330,11 +358,23 @@ func TestHandler_PreparedStatements(t *testing.T) {
 		t.Error("HandleStmtExecute should return a result")
 	}
 
+	// The argument count must match the prepared parameter count
+	_, err = handler.HandleStmtExecute(context, "SELECT * FROM users WHERE id = ?", []interface{}{})
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_WRONG_ARGUMENTS {
+		t.Errorf("Expected ER_WRONG_ARGUMENTS for a missing argument, got %v", err)
+	}
+
 	// Test HandleStmtClose
 	err = handler.HandleStmtClose(context)
 	if err != nil {
 		t.Errorf("HandleStmtClose should not return error: %v", err)
 	}
+
+	// A closed statement is released from the session
+	_, err = handler.HandleStmtExecute(context, "SELECT * FROM users WHERE id = ?", []interface{}{1})
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_UNKNOWN_STMT_HANDLER {
+		t.Errorf("Expected ER_UNKNOWN_STMT_HANDLER after close, got %v", err)
+	}
 }
 
 func TestHandler_HandleOtherCommand(t *testing.T) {
@@ -570,4 +610,3223 @@ func TestHandler_NumericTenantIDQueryLogging(t *testing.T) {
 			}
 		})
 	}
-}
+}
+
+func TestHandler_HandleQuery_ShowGrants(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "grants_tenant")
+
+	testCases := []string{
+		"SHOW GRANTS",
+		"show grants for current_user",
+		"SHOW GRANTS FOR CURRENT_USER()",
+	}
+
+	for _, query := range testCases {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Errorf("Query '%s' should not return error: %v", query, err)
+			continue
+		}
+		if result == nil || result.Resultset == nil {
+			t.Errorf("Query '%s' should return a resultset", query)
+			continue
+		}
+		rows := resultRows(t, result)
+		if len(rows) != 1 {
+			t.Errorf("Query '%s' should return a single row, got %d", query, len(rows))
+			continue
+		}
+
+		grant := rows[0][0]
+		if !strings.Contains(grant, "GRANT ALL PRIVILEGES") {
+			t.Errorf("Query '%s' should grant all privileges, got: %s", query, grant)
+		}
+		if !strings.Contains(grant, "multitenant_db_idx_grants_tenant") || !strings.Contains(grant, "`root`") {
+			t.Errorf("Query '%s' should grant on the current database to the connected user, got: %s", query, grant)
+		}
+	}
+}
+
+// resultRows decodes the text rows of a result into strings for assertions
+func resultRows(t *testing.T, result *mysql.Result) [][]string {
+	t.Helper()
+	var rows [][]string
+	for _, rowData := range result.Resultset.RowDatas {
+		values, err := rowData.ParseText(result.Resultset.Fields, nil)
+		if err != nil {
+			t.Fatalf("Failed to parse row data: %v", err)
+		}
+		row := make([]string, len(values))
+		for i := range values {
+			if values[i].Type == mysql.FieldValueTypeString {
+				row[i] = string(values[i].AsString())
+			} else {
+				row[i] = values[i].String()
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestHandler_HandleQuery_TransactionIsolation(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	readIsolation := func(query string) string {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("Query '%s' should not return error: %v", query, err)
+		}
+		rows := resultRows(t, result)
+		if len(rows) != 1 || len(rows[0]) != 1 {
+			t.Fatalf("Query '%s' should return a single value, got %v", query, rows)
+		}
+		return rows[0][0]
+	}
+
+	// MySQL's default is reported before anything is set
+	if level := readIsolation("SELECT @@tx_isolation"); level != "REPEATABLE-READ" {
+		t.Errorf("Expected default isolation REPEATABLE-READ, got %s", level)
+	}
+
+	if _, err := handler.HandleQuery("SET @@SESSION.tx_isolation = 'READ-COMMITTED'"); err != nil {
+		t.Fatalf("Setting tx_isolation should succeed: %v", err)
+	}
+	if level := readIsolation("SELECT @@tx_isolation"); level != "READ-COMMITTED" {
+		t.Errorf("Expected isolation READ-COMMITTED, got %s", level)
+	}
+	if level := readIsolation("SELECT @@transaction_isolation"); level != "READ-COMMITTED" {
+		t.Errorf("transaction_isolation should mirror tx_isolation, got %s", level)
+	}
+
+	// Space-separated levels are normalized to MySQL's form
+	if _, err := handler.HandleQuery("SET @@session.transaction_isolation = 'serializable'"); err != nil {
+		t.Fatalf("Setting transaction_isolation should succeed: %v", err)
+	}
+	if level := readIsolation("SELECT @@session.tx_isolation"); level != "SERIALIZABLE" {
+		t.Errorf("Expected isolation SERIALIZABLE, got %s", level)
+	}
+
+	// Unsupported levels are rejected and leave the current level unchanged
+	_, err := handler.HandleQuery("SET @@SESSION.tx_isolation = 'SNAPSHOT'")
+	if err == nil {
+		t.Fatal("Unsupported isolation level should be rejected")
+	}
+	if myErr, ok := err.(*mysql.MyError); !ok || myErr.Code != mysql.ER_WRONG_VALUE_FOR_VAR {
+		t.Errorf("Expected ER_WRONG_VALUE_FOR_VAR, got %v", err)
+	}
+	if level := readIsolation("SELECT @@tx_isolation"); level != "SERIALIZABLE" {
+		t.Errorf("Rejected SET should not change isolation, got %s", level)
+	}
+}
+
+func TestHandler_HandleQuery_ShowDatabasesSorted(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	for _, idx := range []string{"zeta", "alpha", "mike", "bravo"} {
+		if _, err := handler.databaseManager.GetOrCreateDatabase(idx); err != nil {
+			t.Fatalf("Failed to create database %s: %v", idx, err)
+		}
+	}
+
+	expected := []string{
+		"information_schema",
+		"mysql",
+		"performance_schema",
+		"sys",
+		"multitenant_db",
+		"multitenant_db_idx_alpha",
+		"multitenant_db_idx_bravo",
+		"multitenant_db_idx_mike",
+		"multitenant_db_idx_zeta",
+	}
+
+	// Run several times so random map ordering would show up
+	for i := 0; i < 5; i++ {
+		result, err := handler.HandleQuery("SHOW DATABASES")
+		if err != nil {
+			t.Fatalf("SHOW DATABASES should not return error: %v", err)
+		}
+
+		rows := resultRows(t, result)
+		if len(rows) != len(expected) {
+			t.Fatalf("Expected %d databases, got %d", len(expected), len(rows))
+		}
+		for j, row := range rows {
+			if row[0] != expected[j] {
+				t.Errorf("Row %d: expected %s, got %s", j, expected[j], row[0])
+			}
+		}
+	}
+}
+
+func TestHandler_CloseFlushesQueryLogMirror(t *testing.T) {
+	var output lockedBuffer
+	cfg := config.NewConfig()
+	cfg.QueryLogToStdout = true
+	handler, err := NewHandlerWithConfig(log.New(&output, "", 0), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	if err := handler.queryLogger.LogQuery("close_tenant", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+	if err := handler.Close(); err != nil {
+		t.Fatalf("Failed to close handler: %v", err)
+	}
+
+	// Close waits for the mirror to write what was queued and stop
+	if !strings.Contains(output.String(), "query_log ") {
+		t.Error("Expected the queued query to be mirrored before Close returned")
+	}
+	if handler.queryLogger.mirror != nil {
+		t.Error("Expected Close to stop the query log mirror")
+	}
+}
+
+func TestHandler_HandleQuery_MaxResultRows(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.MaxResultRows = 5
+	cfg.TenantMaxResultRows = map[string]int{"big_tenant": 0}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+
+	for _, idx := range []string{"capped_tenant", "big_tenant"} {
+		session.SetUser("idx", idx)
+		if _, err := handler.HandleQuery("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+			t.Fatalf("Failed to create table for %s: %v", idx, err)
+		}
+		for i := 1; i <= 12; i++ {
+			if _, err := handler.HandleQuery(fmt.Sprintf("INSERT INTO items (id) VALUES (%d)", i)); err != nil {
+				t.Fatalf("Failed to insert row for %s: %v", idx, err)
+			}
+		}
+	}
+
+	// Capped tenant gets the first 5 rows and a truncation warning
+	session.SetUser("idx", "capped_tenant")
+	result, err := handler.HandleQuery("SELECT id FROM items ORDER BY id")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 5 {
+		t.Errorf("Expected 5 rows after truncation, got %d", len(rows))
+	}
+	if result.Warnings != 1 {
+		t.Errorf("Expected 1 warning on truncated result, got %d", result.Warnings)
+	}
+
+	warnings, err := handler.HandleQuery("SHOW WARNINGS")
+	if err != nil {
+		t.Fatalf("SHOW WARNINGS should not return error: %v", err)
+	}
+	warningRows := resultRows(t, warnings)
+	if len(warningRows) != 1 || !strings.Contains(warningRows[0][2], "truncated to 5 rows") {
+		t.Errorf("Expected a truncation warning, got %v", warningRows)
+	}
+
+	// A result under the cap is not truncated and clears the previous warning
+	result, err = handler.HandleQuery("SELECT id FROM items WHERE id <= 3")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 3 || result.Warnings != 0 {
+		t.Errorf("Expected 3 rows and no warnings, got %d rows and %d warnings", len(rows), result.Warnings)
+	}
+	if len(session.GetWarnings()) != 0 {
+		t.Error("Warnings should be cleared by the next statement")
+	}
+
+	// Per-tenant override disables the cap
+	session.SetUser("idx", "big_tenant")
+	result, err = handler.HandleQuery("SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 12 {
+		t.Errorf("Expected all 12 rows for overridden tenant, got %d", len(rows))
+	}
+}
+
+func TestHandler_LowerCaseTableNames(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+
+	for _, enabled := range []bool{false, true} {
+		cfg := config.NewConfig()
+		cfg.LowerCaseTableNames = enabled
+		handler, err := NewHandlerWithConfig(logger, cfg)
+		if err != nil {
+			t.Fatalf("Failed to create handler: %v", err)
+		}
+
+		connID := handler.sessionManager.GetNextConnectionID()
+		handler.sessionManager.SetCurrentConnection(connID)
+		session := handler.sessionManager.GetOrCreateSession(connID)
+		session.SetUser("idx", fmt.Sprintf("case_tenant_%v", enabled))
+
+		if _, err := handler.HandleQuery("CREATE TABLE MixedCase (id INTEGER PRIMARY KEY, label TEXT)"); err != nil {
+			t.Fatalf("enabled=%v: failed to create table: %v", enabled, err)
+		}
+		if _, err := handler.HandleQuery("INSERT INTO MixedCase (id, label) VALUES (1, 'one')"); err != nil {
+			t.Fatalf("enabled=%v: failed to insert row: %v", enabled, err)
+		}
+
+		// SQLite resolves unquoted and quoted identifiers regardless of case either way
+		for _, query := range []string{"SELECT * FROM MIXEDCASE", "SELECT * FROM `mixedcase`"} {
+			result, err := handler.HandleQuery(query)
+			if err != nil {
+				t.Errorf("enabled=%v: query '%s' should not return error: %v", enabled, query, err)
+				continue
+			}
+			if rows := resultRows(t, result); len(rows) != 1 {
+				t.Errorf("enabled=%v: query '%s' expected 1 row, got %d", enabled, query, len(rows))
+			}
+		}
+
+		// SHOW TABLES reports lower-cased names only when the option is on
+		result, err := handler.HandleQuery("SHOW TABLES")
+		if err != nil {
+			t.Fatalf("enabled=%v: SHOW TABLES should not return error: %v", enabled, err)
+		}
+		expected := "MixedCase"
+		if enabled {
+			expected = "mixedcase"
+		}
+		found := false
+		for _, row := range resultRows(t, result) {
+			if row[0] == expected {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("enabled=%v: SHOW TABLES should list %s", enabled, expected)
+		}
+
+		// DESCRIBE and field lists accept any casing
+		result, err = handler.HandleQuery("DESCRIBE `MIXEDcase`")
+		if err != nil {
+			t.Errorf("enabled=%v: DESCRIBE should resolve mixed-case table: %v", enabled, err)
+		} else if rows := resultRows(t, result); len(rows) != 2 {
+			t.Errorf("enabled=%v: DESCRIBE expected 2 columns, got %d", enabled, len(rows))
+		}
+		if fields, err := handler.HandleFieldList("MIXEDCASE", ""); err != nil || len(fields) != 2 {
+			t.Errorf("enabled=%v: field list should resolve mixed-case table, got %d fields, err %v", enabled, len(fields), err)
+		}
+
+		handler.Close()
+	}
+}
+
+func TestHandler_HandleSet_RebindsCurrentTenant(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.New(&output, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	for _, tenant := range []string{"tenant_a", "tenant_b"} {
+		output.Reset()
+		if _, err := handler.HandleQuery(fmt.Sprintf("SET @idx = '%s'", tenant)); err != nil {
+			t.Fatalf("SET @idx should not return error: %v", err)
+		}
+
+		// The registry reflects the new tenant before any other query runs
+		if got := handler.sessionManager.ConnectionTenants()[connID]; got != tenant {
+			t.Errorf("Connection registry should report %s, got %q", tenant, got)
+		}
+
+		logged := output.String()
+		if !strings.Contains(logged, "rebound") || !strings.Contains(logged, fmt.Sprintf("[idx=%s] ", tenant)) {
+			t.Errorf("SET @idx should log the rebinding attributed to %s, got: %s", tenant, logged)
+		}
+	}
+
+	if _, err := handler.HandleQuery("SET @idx = NULL"); err != nil {
+		t.Fatalf("SET @idx = NULL should not return error: %v", err)
+	}
+	if got := handler.sessionManager.ConnectionTenants()[connID]; got != "" {
+		t.Errorf("Clearing @idx should bind the default tenant, got %q", got)
+	}
+}
+
+func TestHandler_StatementTimeout(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.StatementTimeout = 50 * time.Millisecond
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "timeout_tenant")
+
+	if _, err := handler.HandleQuery("BEGIN"); err != nil {
+		t.Fatalf("BEGIN should not return error: %v", err)
+	}
+	if _, err := handler.HandleQuery("INSERT INTO users (name, email, age) VALUES ('Dana', 'dana@example.com', 41)"); err != nil {
+		t.Fatalf("INSERT should not return error: %v", err)
+	}
+
+	start := time.Now()
+	_, err = handler.HandleQuery("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT COUNT(*) FROM c")
+	if err == nil {
+		t.Fatal("Slow statement should time out")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Slow statement should be interrupted promptly, took %v", elapsed)
+	}
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != erQueryTimeout {
+		t.Errorf("Expected ER_QUERY_TIMEOUT, got %v", err)
+	}
+
+	// Only the statement is interrupted: the open transaction and its writes survive
+	result, err := handler.HandleQuery("SELECT COUNT(*) FROM users")
+	if err != nil {
+		t.Fatalf("Query after timeout should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "4" {
+		t.Errorf("Expected the uncommitted insert to still be visible, got %v users", rows[0][0])
+	}
+	if _, err := handler.HandleQuery("COMMIT"); err != nil {
+		t.Errorf("COMMIT after a timed-out statement should succeed: %v", err)
+	}
+}
+
+func TestHandler_BindParamLogging(t *testing.T) {
+	testCases := []struct {
+		name        string
+		logParams   bool
+		redaction   string
+		expected    string
+		notExpected string
+	}{
+		{"full", true, config.BindParamRedactionNone, "alice@example.com", "<redacted>"},
+		{"redacted", true, config.BindParamRedactionRedact, "[<redacted> <redacted>]", "alice@example.com"},
+		{"hashed", true, config.BindParamRedactionHash, "sha256:", "alice@example.com"},
+		{"disabled", false, "", "with 2 args", "alice@example.com"},
+	}
+
+	for _, tc := range testCases {
+		var output bytes.Buffer
+		logger := log.New(&output, "[TEST] ", log.LstdFlags)
+		cfg := config.NewConfig()
+		cfg.LogBindParams = tc.logParams
+		cfg.BindParamRedaction = tc.redaction
+		handler, err := NewHandlerWithConfig(logger, cfg)
+		if err != nil {
+			t.Fatalf("Failed to create handler: %v", err)
+		}
+
+		connID := handler.sessionManager.GetNextConnectionID()
+		handler.sessionManager.SetCurrentConnection(connID)
+		tenant := "params_" + tc.name
+		handler.sessionManager.GetOrCreateSession(connID).SetUser("idx", tenant)
+
+		if _, err := handler.HandleStmtExecute(nil, "SELECT * FROM users", []interface{}{"alice@example.com", 42}); err != nil {
+			t.Fatalf("%s: HandleStmtExecute should not return error: %v", tc.name, err)
+		}
+
+		logged := output.String()
+		if !strings.Contains(logged, tc.expected) || strings.Contains(logged, tc.notExpected) {
+			t.Errorf("%s: expected log to contain %q and not %q, got: %s", tc.name, tc.expected, tc.notExpected, logged)
+		}
+
+		// The query log is written asynchronously
+		var storedQuery string
+		for i := 0; i < 50 && storedQuery == ""; i++ {
+			logs, _ := handler.queryLogger.GetQueryLogs(tenant, 1, 0, nil, nil)
+			if len(logs) == 1 {
+				storedQuery = logs[0].(QueryLogEntry).Query
+			} else {
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+		if strings.Contains(storedQuery, tc.notExpected) {
+			t.Errorf("%s: query log should not contain %q, got: %s", tc.name, tc.notExpected, storedQuery)
+		}
+		if tc.logParams && !strings.Contains(storedQuery, tc.expected) {
+			t.Errorf("%s: query log should contain %q, got: %s", tc.name, tc.expected, storedQuery)
+		}
+		if !tc.logParams && storedQuery != "SELECT * FROM users" {
+			t.Errorf("%s: query log should hold the bare query, got: %s", tc.name, storedQuery)
+		}
+
+		handler.Close()
+	}
+}
+
+func TestRedactLiterals(t *testing.T) {
+	query := "SELECT `col1`, name2 FROM t3 WHERE a = 'it''s' AND b = \"x\\\"y\" AND c IN (1, 2.5) AND d = ?"
+	if redacted := redactLiterals(query, config.BindParamRedactionNone); redacted != query {
+		t.Errorf("Expected no redaction in none mode, got %q", redacted)
+	}
+
+	expected := "SELECT `col1`, name2 FROM t3 WHERE a = <redacted> AND b = <redacted> AND c IN (<redacted>, <redacted>) AND d = ?"
+	if redacted := redactLiterals(query, config.BindParamRedactionRedact); redacted != expected {
+		t.Errorf("Expected %q, got %q", expected, redacted)
+	}
+
+	// Hashing masks equal values alike, so previews can still be compared
+	hashed := redactLiterals("SELECT 'it''s', 'it\\'s'", config.BindParamRedactionHash)
+	digest := maskValue(config.BindParamRedactionHash, "it's")
+	if hashed != "SELECT "+digest+", "+digest {
+		t.Errorf("Expected both literals hashed to %s, got %q", digest, hashed)
+	}
+}
+
+func TestHandler_MaxAllowedPacket(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.MaxAllowedPacket = 2048
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	result, err := handler.HandleQuery("SELECT @@max_allowed_packet")
+	if err != nil {
+		t.Fatalf("SELECT @@max_allowed_packet should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "2048" {
+		t.Errorf("Expected max_allowed_packet 2048, got %v", rows[0][0])
+	}
+
+	result, err = handler.HandleQuery("SHOW VARIABLES LIKE 'max_allowed_packet'")
+	if err != nil {
+		t.Fatalf("SHOW VARIABLES should not return error: %v", err)
+	}
+	rows := resultRows(t, result)
+	if len(rows) != 1 || rows[0][0] != "max_allowed_packet" || rows[0][1] != "2048" {
+		t.Errorf("Expected a single max_allowed_packet row with 2048, got %v", rows)
+	}
+
+	// Queries larger than the packet limit are rejected before execution
+	oversized := "SELECT '" + strings.Repeat("x", 3000) + "'"
+	_, err = handler.HandleQuery(oversized)
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_NET_PACKET_TOO_LARGE {
+		t.Errorf("Expected ER_NET_PACKET_TOO_LARGE for oversized query, got %v", err)
+	}
+
+	if _, err := handler.HandleQuery("SELECT 1"); err != nil {
+		t.Errorf("Queries within the limit should still run: %v", err)
+	}
+}
+
+func TestHandler_ReloadConfig(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler, err := NewHandlerWithConfig(logger, config.NewConfig())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "reload_tenant")
+
+	if _, err := handler.HandleQuery("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 4; i++ {
+		if _, err := handler.HandleQuery(fmt.Sprintf("INSERT INTO items (id) VALUES (%d)", i)); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	result, err := handler.HandleQuery("SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 4 {
+		t.Fatalf("Expected 4 rows before reload, got %d", len(rows))
+	}
+
+	reloaded := config.NewConfig()
+	reloaded.MaxResultRows = 2
+	reloaded.HTTPPort = 9999
+	changes := handler.ReloadConfig(reloaded)
+	if len(changes) != 1 || !strings.HasPrefix(changes[0], "max_result_rows") {
+		t.Errorf("Expected only max_result_rows to change, got %v", changes)
+	}
+	if handler.Config().HTTPPort != 8080 {
+		t.Error("HTTP port should not change on reload")
+	}
+
+	result, err = handler.HandleQuery("SELECT id FROM items")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 2 {
+		t.Errorf("Expected reloaded row cap of 2, got %d rows", len(rows))
+	}
+}
+
+func TestHandler_HandleQuery_FoundRows(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "found_rows_tenant")
+
+	if _, err := handler.HandleQuery("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	for i := 1; i <= 10; i++ {
+		if _, err := handler.HandleQuery(fmt.Sprintf("INSERT INTO items (id) VALUES (%d)", i)); err != nil {
+			t.Fatalf("Failed to insert row: %v", err)
+		}
+	}
+
+	foundRows := func(query string) []string {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		rows := resultRows(t, result)
+		if len(rows) != 1 {
+			t.Fatalf("Expected 1 row from %s, got %d", query, len(rows))
+		}
+		return []string{string(result.Resultset.Fields[0].Name), rows[0][0]}
+	}
+
+	// SQL_CALC_FOUND_ROWS is stripped and FOUND_ROWS() reports the count before the LIMIT
+	result, err := handler.HandleQuery("SELECT SQL_CALC_FOUND_ROWS id FROM items WHERE id > 2 ORDER BY id LIMIT 3")
+	if err != nil {
+		t.Fatalf("SQL_CALC_FOUND_ROWS query should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 3 {
+		t.Errorf("Expected 3 limited rows, got %d", len(rows))
+	}
+	if got := foundRows("SELECT FOUND_ROWS()"); got[0] != "FOUND_ROWS()" || got[1] != "8" {
+		t.Errorf("Expected FOUND_ROWS() = 8, got %v", got)
+	}
+
+	// Without the hint FOUND_ROWS() reports the rows returned by the last SELECT
+	if _, err := handler.HandleQuery("SELECT id FROM items LIMIT 4"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if got := foundRows("select found_rows() as total;"); got[0] != "total" || got[1] != "4" {
+		t.Errorf("Expected total = 4, got %v", got)
+	}
+
+	// Statements that return no rows leave the count alone
+	if _, err := handler.HandleQuery("UPDATE items SET id = id WHERE id = 1"); err != nil {
+		t.Fatalf("UPDATE should not return error: %v", err)
+	}
+	if got := foundRows("SELECT FOUND_ROWS()"); got[1] != "4" {
+		t.Errorf("Expected FOUND_ROWS() to stay 4 after UPDATE, got %v", got)
+	}
+}
+
+func TestHandler_HandleQuery_Call(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "call_tenant")
+
+	// Unknown procedures get MySQL's error instead of a SQLite parse failure
+	_, err := handler.HandleQuery("CALL refresh_reports(1, 'x')")
+	if err == nil {
+		t.Fatal("Expected error for unknown procedure")
+	}
+	mysqlErr, ok := err.(*mysql.MyError)
+	if !ok || mysqlErr.Code != mysql.ER_SP_DOES_NOT_EXIST {
+		t.Fatalf("Expected ER_SP_DOES_NOT_EXIST, got %v", err)
+	}
+	if !strings.Contains(mysqlErr.Message, "multitenant_db_idx_call_tenant.refresh_reports") {
+		t.Errorf("Expected qualified procedure name in error, got %q", mysqlErr.Message)
+	}
+
+	// Built-in procedures run against the session's tenant
+	result, err := handler.HandleQuery("CALL truncate_tenant()")
+	if err != nil {
+		t.Fatalf("CALL truncate_tenant() should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 2 {
+		t.Errorf("Expected 2 truncated tables, got %v", rows)
+	}
+
+	result, err = handler.HandleQuery("call seed_sample_data;")
+	if err != nil {
+		t.Fatalf("CALL seed_sample_data should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 2 || rows[0][1] != "3" {
+		t.Errorf("Expected 3 seeded rows per table, got %v", rows)
+	}
+
+	if _, err := handler.HandleQuery("CALL truncate_tenant(1, 2)"); err == nil {
+		t.Error("Expected error for wrong number of arguments")
+	}
+}
+
+func TestHandler_HandleQuery_InsertReturning(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	handler.sessionManager.GetOrCreateSession(connID).SetUser("idx", "returning_tenant")
+
+	result, err := handler.HandleQuery("INSERT INTO users (name, email, age) VALUES ('Frank', 'frank@example.com', 52) RETURNING id, name")
+	if err != nil {
+		t.Fatalf("INSERT ... RETURNING should not return error: %v", err)
+	}
+	if result.Resultset == nil {
+		t.Fatal("INSERT ... RETURNING should return a result set")
+	}
+	rows := resultRows(t, result)
+	if len(rows) != 1 || rows[0][0] != "4" || rows[0][1] != "Frank" {
+		t.Errorf("Expected returned row [4 Frank], got %v", rows)
+	}
+
+	// Without RETURNING the statement reports affected rows and the insert id instead
+	result, err = handler.HandleQuery("INSERT INTO users (name, email, age) VALUES ('Gina', 'gina@example.com', 27)")
+	if err != nil {
+		t.Fatalf("INSERT should not return error: %v", err)
+	}
+	if result.Resultset != nil || result.AffectedRows != 1 || result.InsertId != 5 {
+		t.Errorf("Expected 1 affected row with insert id 5, got %+v", result)
+	}
+
+	// A quoted "returning" is just data
+	result, err = handler.HandleQuery("UPDATE users SET name = 'returning' WHERE id = 5")
+	if err != nil {
+		t.Fatalf("UPDATE should not return error: %v", err)
+	}
+	if result.Resultset != nil || result.AffectedRows != 1 {
+		t.Errorf("Expected 1 affected row from UPDATE, got %+v", result)
+	}
+}
+
+func TestHandler_LogPrefix(t *testing.T) {
+	// Queries are logged in the background, which writes to the logger while the test reads it
+	var output lockedBuffer
+	handler := NewHandler(log.New(&output, "", 0))
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	// Queries on the default tenant still carry both the connection id and idx
+	output.Reset()
+	if _, err := handler.HandleQuery("SELECT 1"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	expected := fmt.Sprintf("[conn=%d] [idx=default] Executing query: SELECT 1", connID)
+	if !strings.Contains(output.String(), expected) {
+		t.Errorf("Expected log line %q, got: %s", expected, output.String())
+	}
+
+	handler.sessionManager.GetOrCreateSession(connID).SetUser("idx", "prefix_tenant")
+	output.Reset()
+	if _, err := handler.HandleQuery("SELECT 2"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	expected = fmt.Sprintf("[conn=%d] [idx=prefix_tenant] Executing query: SELECT 2", connID)
+	if !strings.Contains(output.String(), expected) {
+		t.Errorf("Expected log line %q, got: %s", expected, output.String())
+	}
+}
+
+func TestHandler_HandleQuery_ShowFullTables(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	if _, err := handler.HandleQuery("CREATE VIEW adult_users AS SELECT id, name FROM users WHERE age >= 30"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	result, err := handler.HandleQuery("SHOW FULL TABLES")
+	if err != nil {
+		t.Fatalf("SHOW FULL TABLES should not return error: %v", err)
+	}
+	fields := result.Resultset.Fields
+	if len(fields) != 2 || string(fields[0].Name) != "Tables_in_multitenant_db" || string(fields[1].Name) != "Table_type" {
+		t.Fatalf("Expected Tables_in_multitenant_db and Table_type columns, got %d columns", len(fields))
+	}
+
+	types := make(map[string]string)
+	for _, row := range resultRows(t, result) {
+		types[row[0]] = row[1]
+	}
+	expected := map[string]string{"users": "BASE TABLE", "products": "BASE TABLE", "adult_users": "VIEW"}
+	for name, tableType := range expected {
+		if types[name] != tableType {
+			t.Errorf("Expected %s to be %s, got %q", name, tableType, types[name])
+		}
+	}
+
+	// Plain SHOW TABLES keeps its single column
+	result, err = handler.HandleQuery("show tables")
+	if err != nil {
+		t.Fatalf("SHOW TABLES should not return error: %v", err)
+	}
+	if len(result.Resultset.Fields) != 1 {
+		t.Errorf("SHOW TABLES should return one column, got %d", len(result.Resultset.Fields))
+	}
+}
+
+func TestHandler_HandleQuery_Views(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	if _, err := handler.HandleQuery("CREATE VIEW active_users AS SELECT id, name, email FROM users WHERE age IS NOT NULL"); err != nil {
+		t.Fatalf("Failed to create view: %v", err)
+	}
+
+	result, err := handler.HandleQuery("SHOW TABLES")
+	if err != nil {
+		t.Fatalf("SHOW TABLES should not return error: %v", err)
+	}
+	found := false
+	for _, row := range resultRows(t, result) {
+		if row[0] == "active_users" {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("SHOW TABLES should list the active_users view")
+	}
+
+	result, err = handler.HandleQuery("DESCRIBE active_users")
+	if err != nil {
+		t.Fatalf("DESCRIBE on a view should not return error: %v", err)
+	}
+	var columns []string
+	for _, row := range resultRows(t, result) {
+		columns = append(columns, row[0])
+	}
+	if strings.Join(columns, ",") != "id,name,email" {
+		t.Errorf("Expected view columns id,name,email, got %v", columns)
+	}
+}
+
+func TestHandler_HandleQuery_BlobColumns(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	if _, err := handler.HandleQuery("CREATE TABLE files (id INTEGER PRIMARY KEY, name TEXT, data BLOB)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	// Bytes that are not valid UTF-8, including NUL
+	if _, err := handler.HandleQuery("INSERT INTO files (id, name, data) VALUES (1, 'raw', x'00ff80fe0a')"); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	result, err := handler.HandleQuery("SELECT name, data FROM files WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+
+	fields := result.Resultset.Fields
+	if fields[0].Type != mysql.MYSQL_TYPE_VAR_STRING || fields[0].Charset == 63 {
+		t.Errorf("TEXT column should stay a text string, got type %d charset %d", fields[0].Type, fields[0].Charset)
+	}
+	if fields[1].Type != mysql.MYSQL_TYPE_BLOB || fields[1].Charset != 63 || fields[1].Flag&mysql.BINARY_FLAG == 0 {
+		t.Errorf("BLOB column should be a binary BLOB, got type %d charset %d flag %d", fields[1].Type, fields[1].Charset, fields[1].Flag)
+	}
+
+	values, err := result.Resultset.RowDatas[0].ParseText(fields, nil)
+	if err != nil {
+		t.Fatalf("Failed to parse row data: %v", err)
+	}
+	if got := values[1].AsString(); !bytes.Equal(got, []byte{0x00, 0xff, 0x80, 0xfe, 0x0a}) {
+		t.Errorf("Expected blob bytes to round-trip unchanged, got %x", got)
+	}
+	if got := string(values[0].AsString()); got != "raw" {
+		t.Errorf("Expected name 'raw', got %q", got)
+	}
+}
+
+func TestHandler_HandleQuery_SelectScopedVariables(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	result, err := handler.HandleQuery("SELECT @@session.autocommit, @@GLOBAL.version")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	fields := result.Resultset.Fields
+	if string(fields[0].Name) != "@@session.autocommit" || string(fields[1].Name) != "@@global.version" {
+		t.Errorf("Expected scoped column names, got %s and %s", fields[0].Name, fields[1].Name)
+	}
+	rows := resultRows(t, result)
+	if rows[0][0] != "1" {
+		t.Errorf("Expected @@session.autocommit 1, got %s", rows[0][0])
+	}
+	if rows[0][1] != "8.0.11" {
+		t.Errorf("Expected @@global.version 8.0.11, got %s", rows[0][1])
+	}
+
+	// Session values shadow the global ones only in session scope
+	if _, err := handler.HandleQuery("SET @@session.autocommit = 0"); err != nil {
+		t.Fatalf("SET should not return error: %v", err)
+	}
+	result, err = handler.HandleQuery("SELECT @@session.autocommit, @@global.autocommit, @@autocommit")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if row := resultRows(t, result)[0]; row[0] != "0" || row[1] != "1" || row[2] != "0" {
+		t.Errorf("Expected session 0, global 1, unscoped 0, got %v", row)
+	}
+}
+
+func TestHandler_HandleQuery_ShowWarningsForms(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.MaxResultRows = 2
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	if _, err := handler.HandleQuery("CREATE TABLE items (id INTEGER PRIMARY KEY)"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	if _, err := handler.HandleQuery("INSERT INTO items (id) VALUES (1), (2), (3)"); err != nil {
+		t.Fatalf("Failed to insert rows: %v", err)
+	}
+	if _, err := handler.HandleQuery("SELECT id FROM items"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+
+	// Diagnostic statements report on the truncated SELECT without clearing its warning
+	for _, tc := range []struct {
+		query    string
+		expected [][]string
+	}{
+		{"SELECT @@warning_count", [][]string{{"1"}}},
+		{"SHOW COUNT(*) WARNINGS", [][]string{{"1"}}},
+		{"SHOW WARNINGS LIMIT 1", [][]string{{"Warning", "1172", "Result truncated to 2 rows (max_result_rows)"}}},
+		{"SHOW WARNINGS LIMIT 1, 1", nil},
+		{"show warnings;", [][]string{{"Warning", "1172", "Result truncated to 2 rows (max_result_rows)"}}},
+	} {
+		result, err := handler.HandleQuery(tc.query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", tc.query, err)
+		}
+		if rows := resultRows(t, result); fmt.Sprint(rows) != fmt.Sprint(tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.query, tc.expected, rows)
+		}
+	}
+
+	if _, err := handler.HandleQuery("SELECT 1"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	result, err := handler.HandleQuery("SHOW COUNT(*) WARNINGS")
+	if err != nil {
+		t.Fatalf("SHOW COUNT(*) WARNINGS should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 1 || rows[0][0] != "0" {
+		t.Errorf("Expected no warnings after a clean statement, got %v", rows)
+	}
+}
+
+func TestHandler_HandleQuery_SetTransaction(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+
+	readVariable := func(query string) string {
+		t.Helper()
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		return resultRows(t, result)[0][0]
+	}
+	mustExec := func(query string) {
+		t.Helper()
+		if _, err := handler.HandleQuery(query); err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+	}
+
+	mustExec("CREATE TABLE items (id INTEGER PRIMARY KEY)")
+
+	// Without a scope the isolation level applies to the next transaction only
+	mustExec("SET TRANSACTION ISOLATION LEVEL READ COMMITTED")
+	if level := readVariable("SELECT @@transaction_isolation"); level != "REPEATABLE-READ" {
+		t.Errorf("Session isolation should be unchanged, got %s", level)
+	}
+	mustExec("BEGIN")
+	if !session.InTransaction() {
+		t.Error("BEGIN should open a transaction")
+	}
+	if _, err := handler.HandleQuery("SET TRANSACTION READ ONLY"); err == nil {
+		t.Error("Expected error changing characteristics inside a transaction")
+	}
+	mustExec("COMMIT")
+
+	// SESSION changes the session defaults
+	mustExec("SET SESSION TRANSACTION ISOLATION LEVEL SERIALIZABLE")
+	if level := readVariable("SELECT @@transaction_isolation"); level != "SERIALIZABLE" {
+		t.Errorf("Expected SERIALIZABLE session isolation, got %s", level)
+	}
+
+	mustExec("SET SESSION TRANSACTION READ ONLY")
+	if readOnly := readVariable("SELECT @@transaction_read_only"); readOnly != "1" {
+		t.Errorf("Expected @@transaction_read_only = 1, got %s", readOnly)
+	}
+	_, err := handler.HandleQuery("INSERT INTO items (id) VALUES (1)")
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION {
+		t.Errorf("Expected read-only error for INSERT, got %v", err)
+	}
+	mustExec("SELECT id FROM items")
+	for _, call := range []string{"CALL truncate_tenant()", "CALL seed_sample_data()"} {
+		_, err := handler.HandleQuery(call)
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION {
+			t.Errorf("Expected read-only error for %s, got %v", call, err)
+		}
+	}
+	mustExec("SET SESSION TRANSACTION READ WRITE, ISOLATION LEVEL REPEATABLE READ")
+	mustExec("INSERT INTO items (id) VALUES (1)")
+
+	// A read-only next transaction refuses writes until it ends
+	mustExec("SET TRANSACTION READ ONLY")
+	mustExec("BEGIN")
+	if _, err := handler.HandleQuery("INSERT INTO items (id) VALUES (2)"); err == nil {
+		t.Error("Expected INSERT to fail in a READ ONLY transaction")
+	}
+	mustExec("ROLLBACK")
+	mustExec("INSERT INTO items (id) VALUES (2)")
+
+	mustExec("SET GLOBAL TRANSACTION ISOLATION LEVEL READ UNCOMMITTED")
+	if level := readVariable("SELECT @@transaction_isolation"); level != "REPEATABLE-READ" {
+		t.Errorf("GLOBAL should not change the session isolation, got %s", level)
+	}
+
+	if _, err := handler.HandleQuery("SET TRANSACTION ISOLATION LEVEL SNAPSHOT"); err == nil {
+		t.Error("Expected error for unsupported isolation level")
+	}
+}
+
+func TestHandler_HandleQuery_SetMultipleAssignments(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+
+	query := "SET @a = 1, @b := 'x, (y)', autocommit = 0, @@session.transaction_isolation = 'READ-COMMITTED', SESSION sql_mode = 'ANSI'"
+	if _, err := handler.HandleQuery(query); err != nil {
+		t.Fatalf("Multi-assignment SET should succeed: %v", err)
+	}
+	if value, _ := session.GetUser("a"); value != 1 {
+		t.Errorf("Expected @a = 1, got %v", value)
+	}
+	if value, _ := session.GetUser("b"); value != "x, (y)" {
+		t.Errorf("Expected @b to keep its quoted comma, got %v", value)
+	}
+	if value, _ := session.GetSystem("autocommit"); value != 0 {
+		t.Errorf("Expected autocommit = 0, got %v", value)
+	}
+	if value, _ := session.GetSystem("tx_isolation"); value != "READ-COMMITTED" {
+		t.Errorf("Expected tx_isolation to follow transaction_isolation, got %v", value)
+	}
+	if value, _ := session.GetSystem("sql_mode"); value != "ANSI" {
+		t.Errorf("Expected sql_mode = ANSI, got %v", value)
+	}
+
+	// One invalid assignment fails the whole statement without applying the others
+	if _, err := handler.HandleQuery("SET @c = 3, @@transaction_isolation = 'SNAPSHOT'"); err == nil {
+		t.Error("Expected error for an invalid isolation level")
+	}
+	if _, exists := session.GetUser("c"); exists {
+		t.Error("No assignment should be applied when one of them fails")
+	}
+
+	// @idx can be switched alongside other variables
+	if _, err := handler.HandleQuery("SET @idx = 'tenant_multi', @d = 4;"); err != nil {
+		t.Fatalf("SET with @idx should succeed: %v", err)
+	}
+	if tenant := session.CurrentTenant(); tenant != "tenant_multi" {
+		t.Errorf("Expected session bound to tenant_multi, got %q", tenant)
+	}
+}
+
+func TestHandler_HandleQuery_DDLCommitsImplicitly(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "ddl_tenant")
+
+	if _, err := handler.HandleQuery("BEGIN"); err != nil {
+		t.Fatalf("BEGIN should not return error: %v", err)
+	}
+	if _, err := handler.HandleQuery("INSERT INTO users (name, email, age) VALUES ('Dana', 'dana@example.com', 41)"); err != nil {
+		t.Fatalf("INSERT should not return error: %v", err)
+	}
+
+	result, err := handler.HandleQuery("CREATE TABLE audit (id INTEGER PRIMARY KEY)")
+	if err != nil {
+		t.Fatalf("DDL inside a transaction should not return error: %v", err)
+	}
+	if session.InTransaction() {
+		t.Error("DDL should end the open transaction")
+	}
+	if result.Warnings != 1 {
+		t.Errorf("Expected a note about the implicit commit, got %d warnings", result.Warnings)
+	}
+	warnings, err := handler.HandleQuery("SHOW WARNINGS")
+	if err != nil {
+		t.Fatalf("SHOW WARNINGS should not return error: %v", err)
+	}
+	if rows := resultRows(t, warnings); len(rows) != 1 || rows[0][0] != "Note" || !strings.Contains(rows[0][2], "committed implicitly") {
+		t.Errorf("Expected an implicit commit note, got %v", rows)
+	}
+
+	// The insert was committed, so a ROLLBACK now has nothing to undo
+	if _, err := handler.HandleQuery("ROLLBACK"); err == nil {
+		t.Error("Expected ROLLBACK to fail with no transaction open")
+	}
+	result, err = handler.HandleQuery("SELECT COUNT(*) FROM users")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "4" {
+		t.Errorf("Expected the insert to survive the implicit commit, got %v users", rows[0][0])
+	}
+
+	// Outside a transaction DDL runs as before, without a note
+	result, err = handler.HandleQuery("DROP TABLE audit")
+	if err != nil {
+		t.Fatalf("DROP TABLE should not return error: %v", err)
+	}
+	if result.Warnings != 0 {
+		t.Errorf("Expected no warnings outside a transaction, got %d", result.Warnings)
+	}
+}
+
+func TestHandler_HandleQuery_ConnectionIDMatchesProcesslist(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	// Two clients connect, each served through its own connection handler
+	handler.sessionManager.OpenSession(10001, "127.0.0.1:50001")
+	handler.sessionManager.OpenSession(10002, "127.0.0.1:50002")
+	first := &connectionHandler{Handler: handler.forConnection(10001)}
+	second := &connectionHandler{Handler: handler.forConnection(10002)}
+
+	if _, err := second.HandleQuery("SET @idx = 'processlist_tenant'"); err != nil {
+		t.Fatalf("SET @idx should not return error: %v", err)
+	}
+
+	connectionID := func(conn *connectionHandler, query string) (string, string) {
+		result, err := conn.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		rows := resultRows(t, result)
+		if len(rows) != 1 {
+			t.Fatalf("Expected 1 row from %s, got %d", query, len(rows))
+		}
+		return string(result.Resultset.Fields[0].Name), rows[0][0]
+	}
+
+	// Interleaved commands still see their own connection's ID
+	if column, id := connectionID(first, "SELECT CONNECTION_ID()"); column != "CONNECTION_ID()" || id != "10001" {
+		t.Errorf("Expected CONNECTION_ID() = 10001 on the first connection, got %s = %s", column, id)
+	}
+	_, secondID := connectionID(second, "select connection_id() as id;")
+	if secondID != "10002" {
+		t.Errorf("Expected CONNECTION_ID() = 10002 on the second connection, got %s", secondID)
+	}
+
+	result, err := second.HandleQuery("SHOW PROCESSLIST")
+	if err != nil {
+		t.Fatalf("SHOW PROCESSLIST should not return error: %v", err)
+	}
+	rows := resultRows(t, result)
+	if len(rows) != 2 {
+		t.Fatalf("Expected 2 connections in the process list, got %d", len(rows))
+	}
+	var own []string
+	for _, row := range rows {
+		if row[0] == secondID {
+			own = row
+		} else if row[4] != "Sleep" {
+			t.Errorf("Expected other connections to be sleeping, got %v", row)
+		}
+	}
+	if own == nil {
+		t.Fatalf("Expected the process list to include connection %s, got %v", secondID, rows)
+	}
+	if own[2] != "127.0.0.1:50002" || own[3] != "multitenant_db_idx_processlist_tenant" || own[4] != "Query" || own[7] != "SHOW PROCESSLIST" {
+		t.Errorf("Unexpected process list row for the current connection: %v", own)
+	}
+
+	// Closed connections leave the process list
+	handler.sessionManager.RemoveSession(10001)
+	result, err = second.HandleQuery("SHOW FULL PROCESSLIST")
+	if err != nil {
+		t.Fatalf("SHOW FULL PROCESSLIST should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 1 || rows[0][0] != "10002" {
+		t.Errorf("Expected only connection 10002 after the first closed, got %v", rows)
+	}
+}
+
+func TestHandler_HandleQuery_TableMaintenance(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "maintenance_tenant")
+
+	result, err := handler.HandleQuery("OPTIMIZE TABLE users")
+	if err != nil {
+		t.Fatalf("OPTIMIZE TABLE should not return error: %v", err)
+	}
+	var columns []string
+	for _, field := range result.Resultset.Fields {
+		columns = append(columns, string(field.Name))
+	}
+	if strings.Join(columns, ",") != "Table,Op,Msg_type,Msg_text" {
+		t.Errorf("Expected Table, Op, Msg_type, Msg_text columns, got %v", columns)
+	}
+	rows := resultRows(t, result)
+	if len(rows) != 1 {
+		t.Fatalf("Expected 1 row, got %d", len(rows))
+	}
+	if want := []string{"multitenant_db_idx_maintenance_tenant.users", "optimize", "status", "OK"}; strings.Join(rows[0], "|") != strings.Join(want, "|") {
+		t.Errorf("Expected %v, got %v", want, rows[0])
+	}
+
+	// ANALYZE takes a table list and reports missing tables without failing the statement
+	result, err = handler.HandleQuery("analyze no_write_to_binlog table `Products`, missing;")
+	if err != nil {
+		t.Fatalf("ANALYZE TABLE should not return error: %v", err)
+	}
+	rows = resultRows(t, result)
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d: %v", len(rows), rows)
+	}
+	if rows[0][0] != "multitenant_db_idx_maintenance_tenant.products" || rows[0][1] != "analyze" || rows[0][3] != "OK" {
+		t.Errorf("Expected products to be analyzed, got %v", rows[0])
+	}
+	if rows[1][2] != "Error" || rows[2][2] != "status" || rows[2][3] != "Operation failed" {
+		t.Errorf("Expected an error and failed status for the missing table, got %v and %v", rows[1], rows[2])
+	}
+}
+
+func TestHandler_HandleQuery_EmptyQuery(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler, err := NewHandlerWithConfig(logger, config.NewConfig())
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	// Empty keep-alives get a clean OK result
+	for _, query := range []string{"", "   ", "\n\t "} {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("Empty query %q should not return error: %v", query, err)
+		}
+		if result == nil || result.Resultset != nil || result.AffectedRows != 0 {
+			t.Errorf("Expected an OK result with zero affected rows for %q, got %+v", query, result)
+		}
+	}
+
+	// EMPTY_QUERY_MODE=error answers like MySQL instead
+	updated := config.NewConfig()
+	updated.EmptyQueryMode = config.EmptyQueryModeError
+	handler.ReloadConfig(updated)
+	_, err = handler.HandleQuery(" ")
+	if myErr, ok := err.(*mysql.MyError); !ok || myErr.Code != mysql.ER_EMPTY_QUERY {
+		t.Errorf("Expected ER_EMPTY_QUERY in error mode, got %v", err)
+	}
+}
+
+func TestHandler_HandleQuery_DescribeCompositePrimaryKey(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "composite_key_tenant")
+
+	// The key lists its columns in a different order from their declaration
+	if _, err := handler.HandleQuery("CREATE TABLE order_items (note TEXT, order_id INTEGER NOT NULL, item_id INTEGER NOT NULL, PRIMARY KEY (item_id, order_id))"); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+
+	result, err := handler.HandleQuery("DESCRIBE order_items")
+	if err != nil {
+		t.Fatalf("DESCRIBE should not return error: %v", err)
+	}
+	rows := resultRows(t, result)
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 columns, got %d", len(rows))
+	}
+	expected := []struct{ field, key string }{{"note", ""}, {"order_id", "PRI"}, {"item_id", "PRI"}}
+	for i, want := range expected {
+		// Empty strings come back as NULL from the text resultset
+		key := strings.TrimPrefix(rows[i][3], "NULL")
+		if rows[i][0] != want.field || key != want.key {
+			t.Errorf("Row %d: expected %s with key %q, got %v", i, want.field, want.key, rows[i])
+		}
+		if rows[i][5] != "NULL" {
+			t.Errorf("Composite key columns are not auto_increment, got %v", rows[i])
+		}
+	}
+
+	fields, err := handler.HandleFieldList("order_items", "")
+	if err != nil {
+		t.Fatalf("HandleFieldList should not return error: %v", err)
+	}
+	for _, field := range fields {
+		isKey := field.Flag&mysql.PRI_KEY_FLAG != 0
+		if wantKey := string(field.Name) != "note"; isKey != wantKey {
+			t.Errorf("Field %s: expected primary key flag %t, got %t", field.Name, wantKey, isKey)
+		}
+	}
+
+	// A single INTEGER primary key is still reported as auto_increment
+	result, err = handler.HandleQuery("DESCRIBE users")
+	if err != nil {
+		t.Fatalf("DESCRIBE users should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "id" || rows[0][3] != "PRI" || rows[0][5] != "auto_increment" {
+		t.Errorf("Expected id to be an auto_increment primary key, got %v", rows[0])
+	}
+}
+
+func TestHandler_HandleStmtExecute_BinaryProtocol(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.serveConnection(conn)
+		}
+	}()
+
+	db, err := sql.Open("mysql", "root:@tcp("+listener.Addr().String()+")/")
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Executing a prepared statement uses the binary protocol
+	stmt, err := db.Prepare("SELECT id, name, age FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer stmt.Close()
+
+	var id, name, age interface{}
+	if err := stmt.QueryRow().Scan(&id, &name, &age); err != nil {
+		t.Fatalf("Executing prepared statement failed: %v", err)
+	}
+	if v, ok := id.(int64); !ok || v != 1 {
+		t.Errorf("Expected id to decode as int64 1, got %T %v", id, id)
+	}
+	if _, ok := age.(int64); !ok {
+		t.Errorf("Expected age to decode as int64, got %T %v", age, age)
+	}
+	if v, ok := name.([]byte); !ok || len(v) == 0 {
+		t.Errorf("Expected name to decode as a string, got %T %v", name, name)
+	}
+}
+
+func TestHandler_BinaryResultsetUnparsableDateTime(t *testing.T) {
+	text, err := mysql.BuildSimpleTextResultset([]string{"id", "created_at"}, [][]interface{}{
+		{int64(1), "0000-00-00 00:00:00"},
+		{int64(2), "2024-01-15 10:00:00"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to build resultset: %v", err)
+	}
+	text.Fields[1].Type = mysql.MYSQL_TYPE_DATETIME
+
+	// MySQL's zero date does not parse; the column falls back to text rather than failing
+	resultset, warnings, err := binaryResultset(text)
+	if err != nil {
+		t.Fatalf("Expected an unparsable DATETIME not to fail the statement, got %v", err)
+	}
+	if resultset.Fields[1].Type != mysql.MYSQL_TYPE_VAR_STRING {
+		t.Errorf("Expected the column to be sent as text, got type %d", resultset.Fields[1].Type)
+	}
+	if text.Fields[1].Type != mysql.MYSQL_TYPE_DATETIME {
+		t.Error("Expected the text resultset's fields to be left alone")
+	}
+	if len(warnings) != 1 || warnings[0].Code != mysql.ER_TRUNCATED_WRONG_VALUE || !strings.Contains(warnings[0].Message, "'0000-00-00 00:00:00' for column 'created_at' at row 1") {
+		t.Errorf("Expected one warning for the unparsable value, got %+v", warnings)
+	}
+	for n, raw := range []string{"0000-00-00 00:00:00", "2024-01-15 10:00:00"} {
+		if row := resultset.RowDatas[n]; !bytes.HasSuffix(row, mysql.PutLengthEncodedString([]byte(raw))) {
+			t.Errorf("Expected row %d to carry %q as text, got %q", n+1, raw, row)
+		}
+	}
+}
+
+func TestHandler_HandleQuery_TimeFunctions(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	clock := func() (time.Time, int64) {
+		result, err := handler.HandleQuery("SELECT NOW(), UNIX_TIMESTAMP() AS ts")
+		if err != nil {
+			t.Fatalf("SELECT NOW(), UNIX_TIMESTAMP() should not return error: %v", err)
+		}
+		if name := string(result.Resultset.Fields[1].Name); name != "ts" {
+			t.Errorf("Expected UNIX_TIMESTAMP() column to be aliased ts, got %s", name)
+		}
+		row := resultRows(t, result)[0]
+		now, err := time.ParseInLocation(time.DateTime, row[0], time.Local)
+		if err != nil {
+			t.Fatalf("NOW() returned %q, not a datetime: %v", row[0], err)
+		}
+		unix, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			t.Fatalf("UNIX_TIMESTAMP() returned %q, not an integer: %v", row[1], err)
+		}
+		return now, unix
+	}
+
+	before := time.Now().Unix()
+	firstNow, firstUnix := clock()
+	secondNow, secondUnix := clock()
+	after := time.Now().Unix()
+
+	if firstUnix < before || secondUnix > after {
+		t.Errorf("Expected UNIX_TIMESTAMP() between %d and %d, got %d and %d", before, after, firstUnix, secondUnix)
+	}
+	if secondUnix < firstUnix || secondNow.Before(firstNow) {
+		t.Errorf("Expected the clock not to go backwards, got %v then %v", firstNow, secondNow)
+	}
+	if firstNow.Unix() != firstUnix {
+		t.Errorf("Expected NOW() and UNIX_TIMESTAMP() to agree, got %v and %d", firstNow, firstUnix)
+	}
+
+	// NOW(fsp) has fractional seconds and follows the session time_zone
+	if _, err := handler.HandleQuery("SET time_zone = '+00:00'"); err != nil {
+		t.Fatalf("SET time_zone should not return error: %v", err)
+	}
+	result, err := handler.HandleQuery("SELECT CURRENT_TIMESTAMP(3)")
+	if err != nil {
+		t.Fatalf("SELECT CURRENT_TIMESTAMP(3) should not return error: %v", err)
+	}
+	value := resultRows(t, result)[0][0]
+	utc, err := time.Parse("2006-01-02 15:04:05.000", value)
+	if err != nil {
+		t.Fatalf("CURRENT_TIMESTAMP(3) returned %q: %v", value, err)
+	}
+	if diff := time.Since(utc); diff < 0 || diff > 5*time.Second {
+		t.Errorf("Expected CURRENT_TIMESTAMP(3) in UTC, got %s", value)
+	}
+}
+
+func TestHandler_KillQuery(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.serveConnection(conn)
+		}
+	}()
+
+	db, err := sql.Open("mysql", "root:@tcp("+listener.Addr().String()+")/")
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	defer db.Close()
+
+	ctx := context.Background()
+	connect := func() (*sql.Conn, uint32) {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		var id uint32
+		if err := conn.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+			t.Fatalf("SELECT CONNECTION_ID() failed: %v", err)
+		}
+		return conn, id
+	}
+	slow, slowID := connect()
+	defer slow.Close()
+	killer, _ := connect()
+	defer killer.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		var count int64
+		done <- slow.QueryRowContext(ctx, "WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < 1000000000) SELECT COUNT(*) FROM c").Scan(&count)
+	}()
+
+	// Wait until the slow statement is in flight before killing it
+	session, _ := handler.sessionManager.GetSession(slowID)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		session.mu.RLock()
+		running := session.cancelStmt != nil
+		session.mu.RUnlock()
+		if running {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Slow statement never started")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, err := killer.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", slowID)); err != nil {
+		t.Fatalf("KILL QUERY should not return error: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "1317") {
+			t.Errorf("Expected the slow statement to fail with ER_QUERY_INTERRUPTED, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("KILL QUERY did not interrupt the slow statement")
+	}
+
+	// Only the statement was interrupted: the connection keeps serving queries
+	var id uint32
+	if err := slow.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		t.Fatalf("Connection should remain usable after KILL QUERY: %v", err)
+	}
+	if id != slowID {
+		t.Errorf("Expected the same connection %d after KILL QUERY, got %d", slowID, id)
+	}
+
+	if _, err := killer.ExecContext(ctx, "KILL QUERY 999999"); err == nil || !strings.Contains(err.Error(), "1094") {
+		t.Errorf("Expected ER_NO_SUCH_THREAD for an unknown connection, got %v", err)
+	}
+
+	// KILL CONNECTION closes the connection instead
+	if _, err := killer.ExecContext(ctx, fmt.Sprintf("KILL CONNECTION %d", slowID)); err != nil {
+		t.Fatalf("KILL CONNECTION should not return error: %v", err)
+	}
+	if err := slow.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err == nil {
+		t.Error("Killed connection should no longer serve queries")
+	}
+}
+
+func TestHandler_ConnectionAffinityTransactions(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	cfg := config.NewConfig()
+	cfg.TenantConnectionAffinity = true
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	open := func() uint32 {
+		connID := handler.sessionManager.GetNextConnectionID()
+		handler.sessionManager.GetOrCreateSession(connID).SetUser("idx", "acme")
+		return connID
+	}
+	owner, other := open(), open()
+	run := func(connID uint32, query string) error {
+		handler.sessionManager.SetCurrentConnection(connID)
+		_, err := handler.HandleQuery(query)
+		return err
+	}
+	insert := "INSERT INTO users (name, email, age) VALUES ('Tx', 'tx@example.com', 30)"
+
+	if err := run(owner, "BEGIN"); err != nil {
+		t.Fatalf("BEGIN failed: %v", err)
+	}
+	if err := run(owner, insert); err != nil {
+		t.Fatalf("INSERT in the transaction failed: %v", err)
+	}
+
+	// The other session would write into, or open a transaction on top of, the owner's transaction
+	for _, query := range []string{insert, "BEGIN"} {
+		err := run(other, query)
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_LOCK_WAIT_TIMEOUT {
+			t.Errorf("Expected ER_LOCK_WAIT_TIMEOUT for %s during another connection's transaction, got %v", query, err)
+		}
+	}
+	if err := run(other, "SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("Expected reads to run during another connection's transaction, got %v", err)
+	}
+
+	// Once the transaction ends the other session writes again, and its write is not rolled back
+	if err := run(owner, "ROLLBACK"); err != nil {
+		t.Fatalf("ROLLBACK failed: %v", err)
+	}
+	if err := run(other, insert); err != nil {
+		t.Errorf("Expected INSERT to succeed after the transaction ended, got %v", err)
+	}
+	if err := run(other, "BEGIN"); err != nil {
+		t.Errorf("Expected BEGIN to succeed after the transaction ended, got %v", err)
+	}
+	if err := run(other, "COMMIT"); err != nil {
+		t.Errorf("COMMIT failed: %v", err)
+	}
+}
+
+func TestHandler_KillOtherTenant(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	cfg := config.NewConfig()
+	cfg.TenantUserAccess = map[string][]string{"app": {"acme", "globex"}, "ops": {"*"}}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+	var trail lockedBuffer
+	handler.SetAuditLogger(audit.New(&trail))
+
+	open := func(user, idx string) uint32 {
+		connID := handler.sessionManager.GetNextConnectionID()
+		session := handler.sessionManager.OpenSession(connID, "10.0.0.1:5000")
+		session.setClient(user, nil)
+		session.SetUser("idx", idx)
+		return connID
+	}
+	acme, otherAcme, globex, ops := open("app", "acme"), open("app", "acme"), open("app", "globex"), open("ops", "acme")
+
+	// Connections of another tenant are off limits
+	handler.sessionManager.SetCurrentConnection(acme)
+	_, err = handler.HandleQuery(fmt.Sprintf("KILL QUERY %d", globex))
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_KILL_DENIED_ERROR {
+		t.Errorf("Expected ER_KILL_DENIED_ERROR killing another tenant's connection, got %v", err)
+	}
+
+	// Those of the same tenant are not, and neither is any connection for a user with access to all
+	if _, err := handler.HandleQuery(fmt.Sprintf("KILL QUERY %d", otherAcme)); err != nil {
+		t.Errorf("Expected KILL of a connection on the same tenant to succeed, got %v", err)
+	}
+	handler.sessionManager.SetCurrentConnection(ops)
+	if _, err := handler.HandleQuery(fmt.Sprintf("KILL QUERY %d", globex)); err != nil {
+		t.Errorf("Expected a user with access to every tenant to KILL any connection, got %v", err)
+	}
+
+	// Every attempt is audited
+	entries := strings.Split(strings.TrimSpace(trail.String()), "\n")
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 audit entries, got %d: %s", len(entries), trail.String())
+	}
+	var denied audit.Entry
+	if err := json.Unmarshal([]byte(entries[0]), &denied); err != nil {
+		t.Fatalf("Failed to decode audit entry: %v", err)
+	}
+	if denied.Action != audit.ActionConnectionKill || denied.Result != audit.ResultFailure || denied.Target != "globex" {
+		t.Errorf("Expected a failed connection_kill on globex, got %+v", denied)
+	}
+}
+
+func TestHandler_SessionTimeZone(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.DefaultTimeZone = "-05:00"
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+	for _, statement := range []string{
+		"SET @idx = 'tz_tenant'",
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, happened_at TIMESTAMP, logged_at DATETIME, due DATE)",
+		"INSERT INTO events (id, happened_at, logged_at, due) VALUES (1, '2024-01-15 12:00:00', '2024-01-15 12:00:00', '2024-01-15')",
+		"INSERT INTO events VALUES (2, '2024-01-15 12:00:00.250', '2024-01-15 12:00:00', '2024-01-15')",
+	} {
+		if _, err := handler.HandleQuery(statement); err != nil {
+			t.Fatalf("%s should not return error: %v", statement, err)
+		}
+	}
+	if _, err := handler.HandleStmtExecute(nil, "INSERT INTO events (id, happened_at, logged_at) VALUES (3, ?, ?)", []interface{}{[]byte("2024-01-15 12:00:00"), []byte("2024-01-15 12:00:00")}); err != nil {
+		t.Fatalf("Prepared INSERT should not return error: %v", err)
+	}
+
+	readAt := func(timeZone string, id int) []string {
+		if timeZone != "" {
+			if _, err := handler.HandleQuery("SET time_zone = '" + timeZone + "'"); err != nil {
+				t.Fatalf("SET time_zone = '%s' should not return error: %v", timeZone, err)
+			}
+		}
+		result, err := handler.HandleQuery(fmt.Sprintf("SELECT happened_at, logged_at, due FROM events WHERE id = %d", id))
+		if err != nil {
+			t.Fatalf("SELECT should not return error: %v", err)
+		}
+		return resultRows(t, result)[0]
+	}
+
+	// Sessions start in the configured default, and read back the TIMESTAMP they wrote in it
+	for id := 1; id <= 3; id++ {
+		if row := readAt("", id); !strings.HasPrefix(row[0], "2024-01-15 12:00:00") {
+			t.Errorf("Expected row %d to read back as written in the default -05:00 zone, got %s", id, row[0])
+		}
+	}
+	// The stored value is UTC
+	for id := 1; id <= 3; id++ {
+		if row := readAt("+00:00", id); !strings.HasPrefix(row[0], "2024-01-15 17:00:00") {
+			t.Errorf("Expected row %d in UTC, got %s", id, row[0])
+		}
+	}
+	row := readAt("Asia/Tokyo", 1)
+	if row[0] != "2024-01-16 02:00:00" {
+		t.Errorf("Expected the timestamp in Asia/Tokyo, got %s", row[0])
+	}
+	if row[1] != "2024-01-15 12:00:00" {
+		t.Errorf("Expected DATETIME columns not to be shifted, got %s", row[1])
+	}
+	if row[2] != "2024-01-15 00:00:00" {
+		t.Errorf("Expected DATE columns not to be shifted, got %s", row[2])
+	}
+
+	// An UPDATE converts from the zone of the session writing it
+	if _, err := handler.HandleQuery("UPDATE events SET happened_at = '2024-01-15 09:30:00', logged_at = '2024-01-15 09:30:00' WHERE id = 1"); err != nil {
+		t.Fatalf("UPDATE should not return error: %v", err)
+	}
+	if row := readAt("+00:00", 1); row[0] != "2024-01-15 00:30:00" || row[1] != "2024-01-15 09:30:00" {
+		t.Errorf("Expected the TIMESTAMP written in Asia/Tokyo stored in UTC and the DATETIME as written, got %v", row)
+	}
+
+	// Filters compare TIMESTAMP columns with literals in the session zone, and DATETIME columns as written
+	if _, err := handler.HandleQuery("SET time_zone = 'Asia/Tokyo'"); err != nil {
+		t.Fatalf("SET time_zone should not return error: %v", err)
+	}
+	matchingIDs := func(query string) string {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		var ids []string
+		for _, row := range resultRows(t, result) {
+			ids = append(ids, row[0])
+		}
+		return strings.Join(ids, ",")
+	}
+	for query, expected := range map[string]string{
+		"SELECT id FROM events WHERE happened_at = '2024-01-15 09:30:00'":                                              "1",
+		"SELECT id FROM events WHERE '2024-01-15 09:30:00' = happened_at":                                              "1",
+		"SELECT e.id FROM events e WHERE e.happened_at IN ('2024-01-15 09:30:00', '2024-01-01 00:00:00')":              "1",
+		"SELECT id FROM events WHERE happened_at BETWEEN '2024-01-16 01:59:00' AND '2024-01-16 02:01:00' ORDER BY id": "2,3",
+		"SELECT id FROM events WHERE logged_at = '2024-01-15 09:30:00'":                                                "1",
+		"SELECT id FROM events WHERE happened_at = '2024-01-15 09:30:00' AND logged_at = '2024-01-15 09:30:00'":       "1",
+	} {
+		if ids := matchingIDs(query); ids != expected {
+			t.Errorf("%s: expected ids %s, got %q", query, expected, ids)
+		}
+	}
+	if _, err := handler.HandleQuery("DELETE FROM events WHERE id = 3 AND happened_at > '2024-01-16 01:59:00'"); err != nil {
+		t.Fatalf("DELETE should not return error: %v", err)
+	}
+	if ids := matchingIDs("SELECT id FROM events ORDER BY id"); ids != "1,2" {
+		t.Errorf("Expected the DELETE filter to match row 3 in the session zone, got ids %q", ids)
+	}
+	// Bound arguments are converted too, here from the configured default zone
+	result, err := handler.ExecuteQuery("tz_tenant", "SELECT id FROM events WHERE happened_at = ?", []interface{}{"2024-01-14 19:30:00"})
+	if err != nil {
+		t.Fatalf("ExecuteQuery should not return error: %v", err)
+	}
+	if len(result.Rows) != 1 {
+		t.Errorf("Expected the bound timestamp to match row 1, got %v", result.Rows)
+	}
+
+	// Column types are cached, but a schema change is seen at once
+	if _, err := handler.HandleQuery("ALTER TABLE events ADD COLUMN seen_at TIMESTAMP"); err != nil {
+		t.Fatalf("ALTER TABLE should not return error: %v", err)
+	}
+	if _, err := handler.HandleQuery("UPDATE events SET seen_at = '2024-01-15 09:30:00' WHERE id = 1"); err != nil {
+		t.Fatalf("UPDATE should not return error: %v", err)
+	}
+	if ids := matchingIDs("SELECT id FROM events WHERE seen_at = '2024-01-15 09:30:00'"); ids != "1" {
+		t.Errorf("Expected the added TIMESTAMP column to be converted, got ids %q", ids)
+	}
+	if _, err := handler.HandleQuery("SET time_zone = '+00:00'"); err != nil {
+		t.Fatalf("SET time_zone should not return error: %v", err)
+	}
+	if ids := matchingIDs("SELECT id FROM events WHERE seen_at = '2024-01-15 00:30:00'"); ids != "1" {
+		t.Errorf("Expected the added TIMESTAMP column to be stored in UTC, got ids %q", ids)
+	}
+
+	if _, err := handler.HandleQuery("SET time_zone = 'Not/AZone'"); err == nil {
+		t.Error("Expected an error setting an unknown time_zone")
+	}
+	if _, err := handler.HandleQuery("SET time_zone = '+25:00'"); err == nil {
+		t.Error("Expected an error setting an out of range time_zone")
+	} else if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_UNKNOWN_TIME_ZONE {
+		t.Errorf("Expected ER_UNKNOWN_TIME_ZONE, got %v", err)
+	}
+}
+
+func TestHandler_AlterTableAddColumn(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	for _, statement := range []string{
+		"SET @idx = 'alter_tenant'",
+		"ALTER TABLE users ADD COLUMN phone VARCHAR(20) CHARACTER SET utf8mb4 NOT NULL COMMENT 'contact number' AFTER name",
+		"ALTER TABLE users ADD status ENUM('active', 'disabled') DEFAULT 'active', ADD COLUMN (score INT UNSIGNED NOT NULL, notes TEXT)",
+	} {
+		if _, err := handler.HandleQuery(statement); err != nil {
+			t.Fatalf("%s should not return error: %v", statement, err)
+		}
+	}
+
+	result, err := handler.HandleQuery("DESCRIBE users")
+	if err != nil {
+		t.Fatalf("DESCRIBE should not return error: %v", err)
+	}
+	columns := make(map[string][]string)
+	for _, row := range resultRows(t, result) {
+		columns[row[0]] = row
+	}
+	if phone, ok := columns["phone"]; !ok {
+		t.Error("Expected DESCRIBE to show the added phone column")
+	} else if phone[1] != "VARCHAR(20)" || phone[2] != "NO" || phone[4] != "''" {
+		t.Errorf("Expected phone VARCHAR(20) NOT NULL with the implicit '' default, got %v", phone)
+	}
+	if status, ok := columns["status"]; !ok || status[4] != "'active'" {
+		t.Errorf("Expected the ENUM column to be added with its default, got %v", status)
+	}
+	if score, ok := columns["score"]; !ok || score[2] != "NO" || score[4] != "0" {
+		t.Errorf("Expected score NOT NULL with the implicit 0 default, got %v", score)
+	}
+	if _, ok := columns["notes"]; !ok {
+		t.Error("Expected DESCRIBE to show the added notes column")
+	}
+
+	// Existing rows pick up the defaults (resultRows shows the empty phone as NULL)
+	result, err = handler.HandleQuery("SELECT phone, status, score FROM users WHERE id = 1")
+	if err != nil {
+		t.Fatalf("SELECT of added columns should not return error: %v", err)
+	}
+	if row := resultRows(t, result)[0]; row[0] != "NULL" || row[1] != "active" || row[2] != "0" {
+		t.Errorf("Expected existing rows to get the column defaults, got %v", row)
+	}
+}
+
+func TestHandler_HandleQuery_ShowDatabasesLike(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	for _, idx := range []string{"acme", "acme_eu", "acmex", "globex"} {
+		if _, err := handler.databaseManager.GetOrCreateDatabase(idx); err != nil {
+			t.Fatalf("Failed to create database %s: %v", idx, err)
+		}
+	}
+
+	testCases := []struct {
+		query    string
+		expected []string
+	}{
+		// Escaped underscores match literally, so tools can probe for one tenant's database
+		{`SHOW DATABASES LIKE 'multitenant\_db\_idx\_acme'`, []string{"multitenant_db_idx_acme"}},
+		{`SHOW DATABASES LIKE 'multitenant_db_idx_acme\_%'`, []string{"multitenant_db_idx_acme_eu"}},
+		{"SHOW DATABASES LIKE 'multitenant_db_idx_acme%'", []string{"multitenant_db_idx_acme", "multitenant_db_idx_acme_eu", "multitenant_db_idx_acmex"}},
+		{"show databases like '%SCHEMA'", []string{"information_schema", "performance_schema"}},
+		{"SHOW DATABASES LIKE 'multitenant_db_idx_initech'", nil},
+		// An ESCAPE clause picks another escape character, and quotes may appear in the pattern
+		{"SHOW DATABASES LIKE 'multitenant|_db|_idx|_acme' ESCAPE '|'", []string{"multitenant_db_idx_acme"}},
+		{"SHOW DATABASES LIKE 'multitenant_db_idx_acme!_%' escape '!'", []string{"multitenant_db_idx_acme_eu"}},
+		{`SHOW DATABASES LIKE 'multitenant\_db\_idx\_acme' ESCAPE '\\'`, []string{"multitenant_db_idx_acme"}},
+		{"SHOW DATABASES LIKE 'it''s%'", nil},
+	}
+
+	for _, tc := range testCases {
+		result, err := handler.HandleQuery(tc.query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", tc.query, err)
+		}
+		var databases []string
+		for _, row := range resultRows(t, result) {
+			databases = append(databases, row[0])
+		}
+		if strings.Join(databases, ",") != strings.Join(tc.expected, ",") {
+			t.Errorf("%s: expected %v, got %v", tc.query, tc.expected, databases)
+		}
+	}
+
+	_, err := handler.HandleQuery("SHOW DATABASES LIKE 'acme' ESCAPE '||'")
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_WRONG_ARGUMENTS {
+		t.Errorf("Expected ER_WRONG_ARGUMENTS for a multi-character ESCAPE, got %v", err)
+	}
+}
+
+func TestHandler_BlockDestructive(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.BlockDestructive = true
+	cfg.BlockDestructiveExempt = []string{"admin_tenant", "alias_tenant"}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "demo_tenant")
+
+	blocked := []string{
+		"DELETE FROM users",
+		"DELETE FROM users WHERE 1=1; DELETE FROM products",
+		"TRUNCATE TABLE users",
+		"DROP TABLE products",
+		"/* x */ DROP TABLE users",
+		"DELETE FROM users -- where",
+		"DELETE FROM users # where",
+		"CALL truncate_tenant()",
+	}
+	for _, query := range blocked {
+		_, err := handler.HandleQuery(query)
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_OPTION_PREVENTS_STATEMENT {
+			t.Errorf("Expected %q to be blocked with ER_OPTION_PREVENTS_STATEMENT, got %v", query, err)
+		}
+	}
+
+	// An exempt idx aliased to a protected tenant is guarded like the tenant it resolves to
+	if err := handler.GetDatabaseManager().SetAlias("alias_tenant", "demo_tenant"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	session.SetUser("idx", "alias_tenant")
+	if _, err := handler.HandleQuery("DELETE FROM users"); err == nil {
+		t.Error("Expected DELETE without WHERE through an exempt alias of a protected tenant to be blocked")
+	}
+	session.SetUser("idx", "demo_tenant")
+
+	for _, query := range []string{
+		"DELETE FROM users WHERE id=1",
+		"UPDATE users SET name = 'drop table' WHERE id = 2",
+	} {
+		if _, err := handler.HandleQuery(query); err != nil {
+			t.Errorf("Expected %q to be allowed, got %v", query, err)
+		}
+	}
+
+	result, err := handler.HandleQuery("SELECT COUNT(*) FROM users")
+	if err != nil {
+		t.Fatalf("SELECT COUNT(*) should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "2" {
+		t.Errorf("Expected only the targeted user to be deleted, leaving 2 rows, got %v", rows)
+	}
+
+	// The HTTP path goes through the database manager and is guarded the same way
+	if _, err := handler.GetDatabaseManager().ExecuteQuery("demo_tenant", "DELETE FROM users", nil); !errors.Is(err, ErrDestructiveStatement) {
+		t.Errorf("Expected ExecuteQuery to block DELETE without WHERE, got %v", err)
+	}
+	if _, err := handler.GetDatabaseManager().TruncateDatabase("demo_tenant", false); !errors.Is(err, ErrDestructiveStatement) {
+		t.Errorf("Expected TruncateDatabase to be blocked, got %v", err)
+	}
+
+	session.SetUser("idx", "admin_tenant")
+	if _, err := handler.HandleQuery("DELETE FROM users"); err != nil {
+		t.Errorf("Expected an exempt tenant to run DELETE without WHERE, got %v", err)
+	}
+}
+
+func TestHandler_ColocatedQueryLogProtected(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.QueryLogColocate = true
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "audited")
+
+	if _, err := handler.HandleQuery("SELECT * FROM users"); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	db, err := handler.databaseManager.GetOrCreateDatabase("audited")
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	// The entry is logged in the background, creating the table with it
+	logged := func() int {
+		var count int
+		db.QueryRow("SELECT COUNT(*) FROM __query_logs").Scan(&count)
+		return count
+	}
+	for i := 0; i < 50 && logged() == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The log is hidden from the tenant's tables and schema
+	result, err := handler.HandleQuery("SHOW TABLES")
+	if err != nil {
+		t.Fatalf("SHOW TABLES should not return error: %v", err)
+	}
+	for _, row := range resultRows(t, result) {
+		if row[0] == "__query_logs" {
+			t.Error("Expected SHOW TABLES to leave out the query log table")
+		}
+	}
+	schema, err := handler.databaseManager.GetSchema("audited")
+	if err != nil {
+		t.Fatalf("GetSchema failed: %v", err)
+	}
+	for _, table := range schema {
+		if table.Name == "__query_logs" {
+			t.Error("Expected GetSchema to leave out the query log table")
+		}
+	}
+
+	// It can be read, but neither rewritten, emptied nor dropped
+	for _, query := range []string{
+		"UPDATE __query_logs SET query = 'nothing to see'",
+		"DELETE FROM `__query_logs` WHERE id > 0",
+		"DROP TABLE __query_logs",
+	} {
+		_, err := handler.HandleQuery(query)
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_TABLEACCESS_DENIED_ERROR {
+			t.Errorf("Expected %q to be denied with ER_TABLEACCESS_DENIED_ERROR, got %v", query, err)
+		}
+	}
+	if _, err := handler.databaseManager.ExecuteQuery("audited", "DROP TABLE __query_logs", nil); err == nil {
+		t.Error("Expected ExecuteQuery to refuse dropping the query log table")
+	}
+	if _, err := handler.HandleQuery("CALL truncate_tenant()"); err != nil {
+		t.Fatalf("CALL truncate_tenant() should not return error: %v", err)
+	}
+	if logged() == 0 {
+		t.Error("Expected truncate_tenant to keep the query log")
+	}
+
+	// A table lost some other way is recreated by the next entry
+	if _, err := db.Exec("DROP TABLE __query_logs"); err != nil {
+		t.Fatalf("Failed to drop the query log table: %v", err)
+	}
+	if err := handler.queryLogger.LogQuery("audited", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Errorf("Expected logging to recreate the query log table, got %v", err)
+	}
+}
+
+func TestHandler_StrictTenants(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+
+	lenient, err := NewHandlerWithConfig(logger, config.NewConfig())
+
+	if err != nil {
+
+		t.Fatalf("Failed to create handler: %v", err)
+
+	}
+	defer lenient.Close()
+	lenient.sessionManager.SetCurrentConnection(lenient.sessionManager.GetNextConnectionID())
+	if err := lenient.UseDB("multitenant_db_idx_unknown"); err != nil {
+		t.Errorf("Lenient mode should accept an unknown USE target, got %v", err)
+	}
+	if _, err := lenient.HandleQuery("SET @idx = 'unknown'"); err != nil {
+		t.Errorf("Lenient mode should accept SET @idx to an unknown tenant, got %v", err)
+	}
+
+	cfg := config.NewConfig()
+	cfg.AutocreateTenants = false
+	strict, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer strict.Close()
+	connID := strict.sessionManager.GetNextConnectionID()
+	strict.sessionManager.SetCurrentConnection(connID)
+	if _, err := strict.GetDatabaseManager().GetOrCreateDatabase("known"); err != nil {
+		t.Fatalf("Failed to create tenant: %v", err)
+	}
+
+	isBadDB := func(err error) bool {
+		mysqlErr, ok := err.(*mysql.MyError)
+		return ok && mysqlErr.Code == mysql.ER_BAD_DB_ERROR
+	}
+	if err := strict.UseDB("multitenant_db_idx_unknown"); !isBadDB(err) {
+		t.Errorf("Strict mode should reject an unknown USE target with ER_BAD_DB_ERROR, got %v", err)
+	}
+	if err := strict.UseDB("not_a_tenant"); !isBadDB(err) {
+		t.Errorf("Strict mode should reject a database that is not a tenant's, got %v", err)
+	}
+	if _, err := strict.HandleQuery("USE `multitenant_db_idx_unknown`"); !isBadDB(err) {
+		t.Errorf("Strict mode should reject USE sent as a query, got %v", err)
+	}
+	if _, err := strict.HandleQuery("SET @idx = 'unknown'"); !isBadDB(err) {
+		t.Errorf("Strict mode should reject SET @idx to an unknown tenant, got %v", err)
+	}
+	if tenant := strict.sessionManager.GetOrCreateSession(connID).CurrentTenant(); tenant != "" {
+		t.Errorf("A rejected SET @idx should leave the session unbound, got %q", tenant)
+	}
+
+	// System schemas are listed by SHOW DATABASES, so clients can select them too
+	for _, dbName := range []string{"multitenant_db", "multitenant_db_idx_known", "information_schema", "mysql", "performance_schema", "sys", "INFORMATION_SCHEMA"} {
+		if err := strict.UseDB(dbName); err != nil {
+			t.Errorf("Strict mode should accept USE %s, got %v", dbName, err)
+		}
+	}
+	if _, err := strict.HandleQuery("USE multitenant_db_idx_known"); err != nil {
+		t.Errorf("Strict mode should accept USE of an existing tenant sent as a query, got %v", err)
+	}
+	if _, err := strict.HandleQuery("USE information_schema"); err != nil {
+		t.Errorf("Strict mode should accept USE of a system schema sent as a query, got %v", err)
+	}
+	if _, err := strict.HandleQuery("SET @idx = 'known'"); err != nil {
+		t.Errorf("Strict mode should accept SET @idx to an existing tenant, got %v", err)
+	}
+}
+
+func TestHandler_QueryLogSkipSession(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	for _, skip := range []bool{false, true} {
+		cfg := config.NewConfig()
+		cfg.QueryLogSkipSession = skip
+		handler, err := NewHandlerWithConfig(logger, cfg)
+		if err != nil {
+			t.Fatalf("Failed to create handler: %v", err)
+		}
+		handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+		tenant := fmt.Sprintf("skip_session_%t", skip)
+		for _, query := range []string{
+			fmt.Sprintf("SET @idx = '%s'", tenant),
+			"SET autocommit = 1",
+			"SELECT @@version_comment LIMIT 1",
+			"SHOW VARIABLES LIKE 'time_zone'",
+			"SELECT @@version_comment AS version, @x, name FROM users WHERE id = 1",
+			"SELECT name FROM users WHERE email = 'bob@example.com'",
+			"SELECT COUNT(*) FROM users",
+		} {
+			if _, err := handler.HandleQuery(query); err != nil {
+				t.Fatalf("%s should not return error: %v", query, err)
+			}
+		}
+
+		// The query log is written asynchronously; the SELECT on users is logged last
+		var queries []string
+		for i := 0; i < 50; i++ {
+			logs, _ := handler.queryLogger.GetQueryLogs(tenant, 10, 0, nil, nil)
+			queries = queries[:0]
+			for _, entry := range logs {
+				queries = append(queries, entry.(QueryLogEntry).Query)
+			}
+			if stringInSlice("SELECT COUNT(*) FROM users", queries) && (skip || len(queries) == 7) {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		if !stringInSlice("SELECT COUNT(*) FROM users", queries) {
+			t.Errorf("skip=%t: expected the data query to be logged, got %v", skip, queries)
+		}
+		if loggedSet := stringInSlice(fmt.Sprintf("SET @idx = '%s'", tenant), queries); loggedSet == skip {
+			t.Errorf("skip=%t: SET @idx logged = %t, got %v", skip, loggedSet, queries)
+		}
+		// Data queries that mention a variable or an @ are not session statements
+		if skip && len(queries) != 3 {
+			t.Errorf("Expected only the data queries to be logged when skipping session statements, got %v", queries)
+		}
+		handler.Close()
+	}
+}
+
+func TestHandler_LockingReads(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	handler.sessionManager.GetOrCreateSession(connID).SetUser("idx", "locking_tenant")
+
+	for _, query := range []string{
+		"SELECT id, name FROM users WHERE id = 1 FOR UPDATE",
+		"select id, name from users where id = 1 for update nowait;",
+		"SELECT id, name FROM users WHERE id = 1 FOR SHARE OF users SKIP LOCKED",
+		"SELECT id, name FROM users WHERE id = 1 LOCK IN SHARE MODE",
+	} {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Errorf("Expected %q to run with the locking clause stripped, got %v", query, err)
+			continue
+		}
+		if rows := resultRows(t, result); len(rows) != 1 || rows[0][0] != "1" {
+			t.Errorf("Expected the user with id 1 for %q, got %v", query, rows)
+		}
+	}
+
+	// Inside a transaction the stripped SELECT still runs, and quoted text is left alone
+	if _, err := handler.HandleQuery("BEGIN"); err != nil {
+		t.Fatalf("BEGIN failed: %v", err)
+	}
+	result, err := handler.HandleQuery("SELECT 'for update' AS note FROM users WHERE id = 1 FOR UPDATE")
+	if err != nil {
+		t.Fatalf("Expected the locking read to run in a transaction, got %v", err)
+	}
+	if rows := resultRows(t, result); len(rows) != 1 || rows[0][0] != "for update" {
+		t.Errorf("Expected the quoted text to survive, got %v", rows)
+	}
+	if _, err := handler.HandleQuery("COMMIT"); err != nil {
+		t.Fatalf("COMMIT failed: %v", err)
+	}
+
+	// Without MySQL compatibility the clause reaches SQLite, which rejects it
+	cfg = config.NewConfig()
+	cfg.MySQLCompat = false
+	handler.ReloadConfig(cfg)
+	if _, err := handler.HandleQuery("SELECT id FROM users FOR UPDATE"); err == nil {
+		t.Error("Expected SQLite to reject FOR UPDATE with MySQL compatibility disabled")
+	}
+
+	// A default database on MySQL, reached directly or through an alias, keeps the clause and
+	// with it the row locks
+	handler.ReloadConfig(config.NewConfig())
+	handler.databaseManager.defaultConfig = &config.DefaultDatabaseConfig{Type: config.DatabaseTypeMySQL}
+	if err := handler.databaseManager.SetAlias("mysql_alias", "default"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	query := "SELECT id FROM users FOR UPDATE"
+	for _, tenant := range []string{"", "default", "mysql_alias"} {
+		if kept := handler.withoutLockingClause(tenant, query); kept != query {
+			t.Errorf("Expected the locking clause kept on MySQL for tenant %q, got %q", tenant, kept)
+		}
+	}
+	if stripped := handler.withoutLockingClause("locking_tenant", query); stripped != "SELECT id FROM users" {
+		t.Errorf("Expected the locking clause stripped for a SQLite tenant, got %q", stripped)
+	}
+}
+
+func TestHandler_ShutdownDrainsConnections(t *testing.T) {
+	serve := func() (*Handler, *sql.DB, chan error) {
+		handler := NewHandler(log.New(os.Stdout, "[TEST] ", log.LstdFlags))
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("Failed to listen: %v", err)
+		}
+		served := make(chan error, 1)
+		go func() { served <- handler.Serve(listener) }()
+
+		db, err := sql.Open("mysql", "root:@tcp("+listener.Addr().String()+")/")
+		if err != nil {
+			t.Fatalf("Failed to open client: %v", err)
+		}
+		return handler, db, served
+	}
+	ctx := context.Background()
+
+	// startSlow runs a statement counting to limit on its own connection, next to an idle one,
+	// and returns once the statement is in flight
+	startSlow := func(handler *Handler, db *sql.DB, limit int) chan error {
+		idle, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		if err := idle.PingContext(ctx); err != nil {
+			t.Fatalf("Ping failed: %v", err)
+		}
+		slow, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		var slowID uint32
+		if err := slow.QueryRowContext(ctx, "SELECT CONNECTION_ID()").Scan(&slowID); err != nil {
+			t.Fatalf("SELECT CONNECTION_ID() failed: %v", err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			var count int64
+			done <- slow.QueryRowContext(ctx, fmt.Sprintf("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c WHERE x < %d) SELECT COUNT(*) FROM c", limit)).Scan(&count)
+		}()
+
+		session, _ := handler.sessionManager.GetSession(slowID)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			session.mu.RLock()
+			running := session.cancelStmt != nil
+			session.mu.RUnlock()
+			if running {
+				return done
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Slow statement never started")
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	// Within the grace period the slow statement finishes and delivers its result
+	handler, db, served := serve()
+	done := startSlow(handler, db, 2000000)
+	shutdownCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	if err := handler.Shutdown(shutdownCtx); err != nil {
+		t.Errorf("Expected every connection to drain within the grace period, got %v", err)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected the slow statement to finish during shutdown, got %v", err)
+	}
+	if err := <-served; err != nil {
+		t.Errorf("Expected Serve to return cleanly after shutdown, got %v", err)
+	}
+	if _, err := db.Conn(ctx); err == nil {
+		t.Error("Expected new connections to be refused after shutdown")
+	}
+	db.Close()
+	handler.Close()
+
+	// Past the grace period the connection is closed and the statement interrupted
+	handler, db, _ = serve()
+	defer handler.Close()
+	defer db.Close()
+	done = startSlow(handler, db, 1000000000)
+	shutdownCtx, cancel = context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := handler.Shutdown(shutdownCtx); err == nil || !strings.Contains(err.Error(), "force-closed 1 MySQL connections") {
+		t.Errorf("Expected the slow connection to be force-closed, got %v", err)
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("Expected the force-closed statement to fail")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Force-closing did not interrupt the slow statement")
+	}
+}
+
+func TestHandler_ServerVariables(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.LowerCaseTableNames = true
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	expected := map[string]string{
+		"version":                "8.0.11",
+		"version_comment":        "multitenant-db",
+		"sql_mode":               "ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION",
+		"lower_case_table_names": "1",
+		"max_allowed_packet":     strconv.Itoa(config.DefaultMaxAllowedPacket),
+		"wait_timeout":           "28800",
+	}
+	for name, value := range expected {
+		result, err := handler.HandleQuery("SELECT @@" + name)
+		if err != nil {
+			t.Fatalf("SELECT @@%s should not return error: %v", name, err)
+		}
+		if rows := resultRows(t, result); rows[0][0] != value {
+			t.Errorf("Expected @@%s = %s, got %v", name, value, rows[0][0])
+		}
+
+		result, err = handler.HandleQuery(fmt.Sprintf("SHOW VARIABLES LIKE '%s'", name))
+		if err != nil {
+			t.Fatalf("SHOW VARIABLES LIKE '%s' should not return error: %v", name, err)
+		}
+		if rows := resultRows(t, result); len(rows) != 1 || rows[0][1] != value {
+			t.Errorf("Expected SHOW VARIABLES to report %s = %s, got %v", name, value, rows)
+		}
+	}
+
+	// sql_mode is the session's to change, while the server version is not
+	if _, err := handler.HandleQuery("SET sql_mode = 'ANSI_QUOTES', @@version = '5.7.0'"); err != nil {
+		t.Fatalf("SET should not return error: %v", err)
+	}
+	result, err := handler.HandleQuery("SELECT @@sql_mode, @@version")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "ANSI_QUOTES" || rows[0][1] != "8.0.11" {
+		t.Errorf("Expected sql_mode ANSI_QUOTES and version 8.0.11, got %v", rows[0])
+	}
+}
+
+func TestHandler_TenantHint(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "hint_home")
+
+	// Two tenants on one connection, each statement routed by its own hint
+	for _, query := range []string{
+		"/* idx=hint_acme */ INSERT INTO users (id, name, email, age) VALUES (100, 'Acme', 'a@acme.test', 30)",
+		"/*idx='hint_globex'*/ DELETE FROM users WHERE id = 1",
+	} {
+		if _, err := handler.HandleQuery(query); err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+	}
+	counts := map[string]string{"hint_acme": "4", "hint_globex": "2", "hint_home": "3"}
+	for tenant, expected := range counts {
+		result, err := handler.HandleQuery(fmt.Sprintf("/* idx=%s */ SELECT COUNT(*) FROM users", tenant))
+		if err != nil {
+			t.Fatalf("Hinted SELECT for %s should not return error: %v", tenant, err)
+		}
+		if rows := resultRows(t, result); rows[0][0] != expected {
+			t.Errorf("Expected %s users for %s, got %v", expected, tenant, rows[0][0])
+		}
+	}
+
+	// The session stays bound to its own tenant
+	if tenant := session.CurrentTenant(); tenant != "hint_home" {
+		t.Errorf("Expected the session to stay on hint_home, got %q", tenant)
+	}
+	result, err := handler.HandleQuery("SELECT COUNT(*) FROM users")
+	if err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "3" {
+		t.Errorf("Expected the unhinted statement to see hint_home's 3 users, got %v", rows[0][0])
+	}
+
+	// Hinted statements are logged under the hinted tenant, as written
+	insert := "/* idx=hint_acme */ INSERT INTO users (id, name, email, age) VALUES (100, 'Acme', 'a@acme.test', 30)"
+	var queries []string
+	for i := 0; i < 50; i++ {
+		logs, _ := handler.queryLogger.GetQueryLogs("hint_acme", 10, 0, nil, nil)
+		queries = queries[:0]
+		for _, entry := range logs {
+			queries = append(queries, entry.(QueryLogEntry).Query)
+		}
+		if stringInSlice(insert, queries) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !stringInSlice(insert, queries) {
+		t.Errorf("Expected the hinted INSERT in hint_acme's query log, got %v", queries)
+	}
+
+	// Hints and SET @idx take the tenant IDs the HTTP API does, dots included
+	if _, err := handler.HandleQuery("/* idx=acme.eu */ SELECT COUNT(*) FROM users"); err != nil {
+		t.Errorf("Expected a hint naming acme.eu to work, got %v", err)
+	}
+	for _, query := range []string{
+		"/* idx=" + strings.Repeat("a", config.MaxIdxLength+1) + " */ SELECT 1 FROM users",
+		"SET @idx = 'acme/eu'",
+		"SET @idx = '" + strings.Repeat("a", config.MaxIdxLength+1) + "'",
+	} {
+		_, err := handler.HandleQuery(query)
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_WRONG_VALUE_FOR_VAR {
+			t.Errorf("Expected ER_WRONG_VALUE_FOR_VAR for %.40s, got %v", query, err)
+		}
+	}
+	if _, err := handler.HandleQuery("SET @idx = 'acme.eu'"); err != nil || session.CurrentTenant() != "acme.eu" {
+		t.Errorf("Expected SET @idx = 'acme.eu' to bind the session, got %q (%v)", session.CurrentTenant(), err)
+	}
+}
+
+func TestHandler_HandleQuery_Flush(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "flush_tenant")
+
+	for _, query := range []string{
+		"FLUSH TABLES",
+		"FLUSH PRIVILEGES",
+		"flush local tables users, products;",
+		"FLUSH TABLES WITH READ LOCK",
+		"FLUSH NO_WRITE_TO_BINLOG BINARY LOGS",
+		"RESET QUERY CACHE",
+	} {
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		if result == nil || result.Resultset != nil || result.AffectedRows != 0 {
+			t.Errorf("Expected an OK result for %s, got %+v", query, result)
+		}
+	}
+
+	// Anything else is still left to SQLite
+	if _, err := handler.HandleQuery("FLUSH EVERYTHING"); err == nil {
+		t.Error("Expected error for an unknown FLUSH variant")
+	}
+}
+
+func TestHandler_SlowQueryExplain(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.SlowQueryExplain = true
+	cfg.SlowQueryThreshold = 0 // Every statement counts as slow
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "slow_tenant")
+
+	query := "SELECT name FROM users WHERE id = 1 FOR UPDATE"
+	if _, err := handler.HandleQuery(query); err != nil {
+		t.Fatalf("SELECT should not return error: %v", err)
+	}
+	if _, err := handler.HandleQuery("SHOW TABLES"); err != nil {
+		t.Fatalf("SHOW TABLES should not return error: %v", err)
+	}
+
+	// The plan is captured in the background along with the log entry
+	plans := map[string]string{}
+	for i := 0; i < 50; i++ {
+		logs, _ := handler.queryLogger.GetSlowestQueries("slow_tenant", 10)
+		for _, entry := range logs {
+			plans[entry.(QueryLogEntry).Query] = entry.(QueryLogEntry).Explain
+		}
+		if _, ok := plans["SHOW TABLES"]; ok && plans[query] != "" {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if plan := plans[query]; !strings.Contains(plan, "users") {
+		t.Errorf("Expected the slow SELECT to record a query plan over users, got %q", plan)
+	}
+	if plan := plans["SHOW TABLES"]; plan != "" {
+		t.Errorf("Expected no query plan for SHOW TABLES, got %q", plan)
+	}
+
+	// Turning capture off is picked up on a reload
+	reloaded := *cfg
+	reloaded.SlowQueryExplain = false
+	handler.ReloadConfig(&reloaded)
+	if handler.explainsSlowQueries(time.Hour) {
+		t.Error("Expected no plan capture with SLOW_QUERY_EXPLAIN disabled")
+	}
+}
+
+func TestHandler_SlowQueryExplainMultiStatement(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.SlowQueryExplain = true
+	cfg.SlowQueryThreshold = time.Nanosecond
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	session.SetUser("idx", "slow_multi")
+
+	queries := []string{
+		"UPDATE users SET age = 1 WHERE id = 1; UPDATE users SET age = age + 100 WHERE id = 1",
+		"SELECT 1; UPDATE users SET age = age + 1000 WHERE id = 2",
+	}
+	for _, query := range queries {
+		if _, err := handler.HandleQuery(query); err != nil {
+			t.Fatalf("%q should not return error: %v", query, err)
+		}
+	}
+
+	// Wait for both plans to be captured, then check explaining them ran nothing
+	for i := 0; i < 50; i++ {
+		logs, _ := handler.queryLogger.GetSlowestQueries("slow_multi", 10)
+		captured := 0
+		for _, entry := range logs {
+			if entry.(QueryLogEntry).Explain != "" {
+				captured++
+			}
+		}
+		if captured == len(queries) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	db, err := handler.databaseManager.GetOrCreateDatabase("slow_multi")
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	var first, second int
+	if err := db.QueryRow("SELECT age FROM users WHERE id = 1").Scan(&first); err != nil {
+		t.Fatalf("Failed to read age: %v", err)
+	}
+	if err := db.QueryRow("SELECT age FROM users WHERE id = 2").Scan(&second); err != nil {
+		t.Fatalf("Failed to read age: %v", err)
+	}
+	if first != 101 {
+		t.Errorf("Expected age 101 for user 1 after the slow multi-statement UPDATE, got %d", first)
+	}
+	if second != 1025 {
+		t.Errorf("Expected age 1025 for user 2 after the slow multi-statement query, got %d", second)
+	}
+}
+
+func TestHandler_Sleep(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	cfg := config.NewConfig()
+	cfg.StatementTimeout = time.Second
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	result, err := handler.HandleQuery("SELECT SLEEP(0.01) AS slept")
+	if err != nil {
+		t.Fatalf("SELECT SLEEP should not return error: %v", err)
+	}
+	if name := string(result.Resultset.Fields[0].Name); name != "slept" {
+		t.Errorf("Expected column slept, got %s", name)
+	}
+	if rows := resultRows(t, result); rows[0][0] != "0" {
+		t.Errorf("Expected SLEEP to return 0, got %v", rows[0][0])
+	}
+
+	// A sleep longer than the statement timeout is cut short
+	start := time.Now()
+	_, err = handler.HandleQuery("SELECT SLEEP(5)")
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("SLEEP should be interrupted by the 1s statement timeout, took %v", elapsed)
+	}
+	if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != erQueryTimeout {
+		t.Errorf("Expected ER_QUERY_TIMEOUT, got %v", err)
+	}
+
+	// KILL QUERY from another connection interrupts it too
+	session := handler.sessionManager.GetOrCreateSession(connID)
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < 100 && !session.CancelStatement(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	go func() {
+		_, err := handler.queryHandlers.HandleSleep("SELECT SLEEP(5)")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if mysqlErr, ok := err.(*mysql.MyError); !ok || mysqlErr.Code != mysql.ER_QUERY_INTERRUPTED {
+			t.Errorf("Expected ER_QUERY_INTERRUPTED, got %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("KILL QUERY did not interrupt SLEEP")
+	}
+}
+
+func TestHandler_TenantUserAccess(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	cfg := config.NewConfig()
+	cfg.TenantResolvers = []string{config.TenantResolverAttribute, config.TenantResolverUsername}
+	cfg.TenantUserAccess = map[string][]string{"root": {"alpha"}}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.serveConnection(conn)
+		}
+	}()
+
+	// Tenant-prefixed usernames contain a colon, which a DSN can't express
+	query := func(user, attributes string) error {
+		t.Helper()
+		clientCfg := mysqldriver.NewConfig()
+		clientCfg.User = user
+		clientCfg.Net = "tcp"
+		clientCfg.Addr = listener.Addr().String()
+		clientCfg.ConnectionAttributes = attributes
+		connector, err := mysqldriver.NewConnector(clientCfg)
+		if err != nil {
+			t.Fatalf("Failed to create connector: %v", err)
+		}
+		db := sql.OpenDB(connector)
+		defer db.Close()
+		_, err = db.Exec("SELECT 1")
+		return err
+	}
+
+	// Permitted tenants are honored through either source
+	if err := query("alpha:root", ""); err != nil {
+		t.Errorf("Expected root to select tenant alpha by username, got %v", err)
+	}
+	if err := query("root", "idx:alpha"); err != nil {
+		t.Errorf("Expected root to select tenant alpha by attribute, got %v", err)
+	}
+	if err := query("root", ""); err != nil {
+		t.Errorf("Expected a login without a tenant to be left alone, got %v", err)
+	}
+
+	// Forbidden tenants get access denied and their database is never touched
+	for _, login := range []struct{ user, attributes string }{
+		{"beta:root", ""},
+		{"root", "idx:beta"},
+	} {
+		err := query(login.user, login.attributes)
+		if err == nil || !strings.Contains(err.Error(), "1044") {
+			t.Errorf("Expected access denied for user %s with attributes %q, got %v", login.user, login.attributes, err)
+		}
+	}
+	if handler.databaseManager.HasDatabase("beta") {
+		t.Error("Expected no database to be created for the forbidden tenant")
+	}
+}
+
+func TestMissingFeatureError(t *testing.T) {
+	tests := []struct {
+		sqliteErr string
+		feature   string
+	}{
+		{"no such function: json_extract", "JSON functions (JSON1)"},
+		{"no such table: json_each", "JSON functions (JSON1)"},
+		{"no such module: fts5", "full-text search (FTS)"},
+		{`near "RETURNING": syntax error`, "RETURNING clauses"},
+		{"no such table: users", ""},
+		{"no such function: my_udf", ""},
+	}
+
+	for _, tt := range tests {
+		err := missingFeatureError(errors.New(tt.sqliteErr))
+		if tt.feature == "" {
+			if err != nil {
+				t.Errorf("Expected %q to be left alone, got %v", tt.sqliteErr, err)
+			}
+			continue
+		}
+		mysqlErr, ok := err.(*mysql.MyError)
+		if !ok || mysqlErr.Code != mysql.ER_NOT_SUPPORTED_YET {
+			t.Errorf("Expected ER_NOT_SUPPORTED_YET for %q, got %v", tt.sqliteErr, err)
+			continue
+		}
+		if !strings.Contains(mysqlErr.Message, tt.feature) || !strings.Contains(mysqlErr.Message, tt.sqliteErr) {
+			t.Errorf("Expected the message for %q to name %s, got %q", tt.sqliteErr, tt.feature, mysqlErr.Message)
+		}
+	}
+}
+
+func TestHandler_ColumnAliases(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+
+	result, err := handler.HandleQuery("SELECT id AS user_id, name AS `Full Name`, id user_Id2, UPPER(name), id + 1, COUNT(*) AS N, 'abc', 'it''s', 'a' || 'b' FROM users GROUP BY id")
+	if err != nil {
+		t.Fatalf("Query should not return error: %v", err)
+	}
+	expected := []string{"user_id", "Full Name", "user_Id2", "UPPER(name)", "id + 1", "N", "abc", "it's", "'a' || 'b'"}
+	if len(result.Resultset.Fields) != len(expected) {
+		t.Fatalf("Expected %d columns, got %d", len(expected), len(result.Resultset.Fields))
+	}
+	for i, field := range result.Resultset.Fields {
+		if string(field.Name) != expected[i] {
+			t.Errorf("Expected column %d to be named %q, got %q", i, expected[i], field.Name)
+		}
+	}
+
+	// Without MySQL compatibility columns are named as SQLite names them
+	cfg := config.NewConfig()
+	cfg.MySQLCompat = false
+	handler.ReloadConfig(cfg)
+	result, err = handler.HandleQuery("SELECT 'abc' AS alias, 'abc'")
+	if err != nil {
+		t.Fatalf("Query should not return error: %v", err)
+	}
+	if first, second := string(result.Resultset.Fields[0].Name), string(result.Resultset.Fields[1].Name); first != "alias" || second != "'abc'" {
+		t.Errorf("Expected columns alias and 'abc', got %q and %q", first, second)
+	}
+}
+
+func TestHandler_ConcurrentConnectionsKeepTheirTenant(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.serveConnection(conn)
+		}
+	}()
+
+	db, err := sql.Open("mysql", "root:@tcp("+listener.Addr().String()+")/")
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	defer db.Close()
+
+	// Each client selects its own tenant and marks it, so a query routed to the wrong tenant shows
+	ctx := context.Background()
+	tenants := []string{"isolation_a", "isolation_b", "isolation_c", "isolation_d"}
+	conns := make([]*sql.Conn, len(tenants))
+	for i, tenant := range tenants {
+		conn, err := db.Conn(ctx)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v", err)
+		}
+		defer conn.Close()
+		for _, query := range []string{
+			"SET @idx = '" + tenant + "'",
+			"CREATE TABLE marker (tenant TEXT)",
+			"INSERT INTO marker VALUES ('" + tenant + "')",
+		} {
+			if _, err := conn.ExecContext(ctx, query); err != nil {
+				t.Fatalf("%s failed: %v", query, err)
+			}
+		}
+		conns[i] = conn
+	}
+
+	// Interleave both clients' queries as tightly as possible
+	var wg sync.WaitGroup
+	errs := make(chan error, len(conns))
+	for i, conn := range conns {
+		wg.Add(1)
+		go func(conn *sql.Conn, tenant string) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				var marker string
+				if err := conn.QueryRowContext(ctx, "SELECT tenant FROM marker").Scan(&marker); err != nil {
+					errs <- fmt.Errorf("query %d on %s failed: %v", j, tenant, err)
+					return
+				}
+				if marker != tenant {
+					errs <- fmt.Errorf("query %d on %s ran against %s", j, tenant, marker)
+					return
+				}
+			}
+		}(conn, tenants[i])
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+func TestHandler_PreparedStatementParameters(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.serveConnection(conn)
+		}
+	}()
+
+	// Arguments make the driver prepare each statement and send them in the binary protocol
+	db, err := sql.Open("mysql", "root:@tcp("+listener.Addr().String()+")/")
+	if err != nil {
+		t.Fatalf("Failed to open client: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	// Statements the server answers itself see the arguments too
+	if _, err := db.Exec("SET @idx = ?", "prepared_tenant"); err != nil {
+		t.Fatalf("SET @idx with an argument failed: %v", err)
+	}
+	if _, err := db.Exec("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT, score REAL, note TEXT)"); err != nil {
+		t.Fatalf("CREATE TABLE failed: %v", err)
+	}
+
+	insert, err := db.Prepare("INSERT INTO notes (id, body, score, note) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		t.Fatalf("Prepare failed: %v", err)
+	}
+	defer insert.Close()
+	for _, row := range [][]interface{}{
+		{1, "it's a '?' mark", 1.5, nil},
+		{2, "second", -2.25, "kept"},
+	} {
+		result, err := insert.Exec(row...)
+		if err != nil {
+			t.Fatalf("Executing INSERT with %v failed: %v", row, err)
+		}
+		if affected, _ := result.RowsAffected(); affected != 1 {
+			t.Errorf("Expected 1 affected row, got %d", affected)
+		}
+	}
+
+	// A second statement prepared alongside the first binds its own arguments
+	var body string
+	var score float64
+	var note sql.NullString
+	if err := db.QueryRow("SELECT body, score, note FROM notes WHERE id = ? AND body = ?", 1, "it's a '?' mark").Scan(&body, &score, &note); err != nil {
+		t.Fatalf("Executing SELECT failed: %v", err)
+	}
+	if body != "it's a '?' mark" || score != 1.5 || note.Valid {
+		t.Errorf("Expected (it's a '?' mark, 1.5, NULL), got (%s, %v, %v)", body, score, note)
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM notes WHERE score < ? AND note = ?", 0, "kept").Scan(&count); err != nil {
+		t.Fatalf("Executing SELECT COUNT failed: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 matching row, got %d", count)
+	}
+
+	// The rows landed in the tenant selected through the argument
+	result, err := handler.databaseManager.ExecuteQuery("prepared_tenant", "SELECT COUNT(*) FROM notes", nil)
+	if err != nil {
+		t.Fatalf("Failed to read the tenant database: %v", err)
+	}
+	if rows := fmt.Sprint(result.Rows[0][0]); rows != "2" {
+		t.Errorf("Expected 2 rows in prepared_tenant, got %s", rows)
+	}
+
+}
+
+func TestHandler_TenantUserAccessAfterLogin(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	cfg := config.NewConfig()
+	cfg.TenantUserAccess = map[string][]string{"root": {"alpha"}}
+	handler, err := NewHandlerWithConfig(logger, cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	session := handler.sessionManager.OpenSession(10001, "127.0.0.1:50001")
+	session.setClient("root", nil)
+	conn := handler.forConnection(10001)
+
+	if _, err := conn.HandleQuery("SET @idx = 'alpha'"); err != nil {
+		t.Fatalf("Expected root to select tenant alpha, got %v", err)
+	}
+
+	// Neither SET @idx nor a hint may switch to a tenant the login may not use
+	_, err = conn.HandleQuery("SET @idx = 'beta'")
+	if err == nil || !strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("Expected access denied for SET @idx = 'beta', got %v", err)
+	}
+	if tenant := session.CurrentTenant(); tenant != "alpha" {
+		t.Errorf("Expected the session to stay on tenant alpha, got %q", tenant)
+	}
+	_, err = conn.HandleQuery("/* idx=beta */ SELECT 1")
+	if err == nil || !strings.Contains(err.Error(), "Access denied") {
+		t.Errorf("Expected access denied for an idx=beta hint, got %v", err)
+	}
+	if _, err := conn.HandleQuery("/* idx=alpha */ SELECT 1"); err != nil {
+		t.Errorf("Expected an idx=alpha hint to be allowed, got %v", err)
+	}
+	if handler.databaseManager.HasDatabase("beta") {
+		t.Error("Expected no database to be created for the forbidden tenant")
+	}
+}
+
+func TestHandler_ExecuteQueryRewritesForSQLite(t *testing.T) {
+	handler := NewHandler(log.New(io.Discard, "", 0))
+	defer handler.Close()
+
+	// The locking clause SQLite rejects is stripped, and the SQL reported is the statement it ran
+	result, err := handler.ExecuteQuery("rewrite_tenant", "SELECT name FROM users WHERE id = ? FOR UPDATE", []interface{}{int64(1)})
+	if err != nil {
+		t.Fatalf("ExecuteQuery should rewrite the locking read for SQLite: %v", err)
+	}
+	if result.SQL != "SELECT name FROM users WHERE id = ?" {
+		t.Errorf("Expected the rewritten statement as the executed SQL, got %q", result.SQL)
+	}
+	if len(result.Rows) != 1 {
+		t.Errorf("Expected one row, got %v", result.Rows)
+	}
+}
+
+func TestHandler_VariablesInDataQueries(t *testing.T) {
+	handler := NewHandler(log.New(io.Discard, "", 0))
+	defer handler.Close()
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	query := func(query string) [][]string {
+		t.Helper()
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		return resultRows(t, result)
+	}
+	for _, set := range []string{"SET @idx = 'variables_tenant'", "SET @min_id = 2", "SET @label = 'it''s'", "SET @path = 'C:\\\\dir'"} {
+		if _, err := handler.HandleQuery(set); err != nil {
+			t.Fatalf("%s should not return error: %v", set, err)
+		}
+	}
+
+	// Variables read alongside columns are inlined for SQLite instead of dropping the columns
+	expected := query("SELECT COUNT(*) FROM users WHERE id >= 2")
+	rows := query("SELECT @label AS label, COUNT(*) AS n FROM users WHERE id >= @min_id")
+	if len(rows) != 1 || rows[0][0] != "it's" || rows[0][1] != expected[0][0] {
+		t.Errorf("Expected [it's %s], got %v", expected[0][0], rows)
+	}
+
+	// SQLite has no backslash escapes, so an inlined backslash must not be doubled
+	rows = query("SELECT @path AS path FROM users WHERE id = 1")
+	if len(rows) != 1 || rows[0][0] != `C:\dir` {
+		t.Errorf("Expected [C:\\dir], got %v", rows)
+	}
+
+	// An @ inside a string literal is data, not a variable
+	rows = query("SELECT COUNT(*) FROM users WHERE email = 'nobody@example.com'")
+	if len(rows) != 1 || rows[0][0] != "0" {
+		t.Errorf("Expected a count of 0 for the email filter, got %v", rows)
+	}
+}
+
+func TestHandler_IsolationLevelWarnings(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	warningsFor := func(query string) [][]string {
+		t.Helper()
+		result, err := handler.HandleQuery(query)
+		if err != nil {
+			t.Fatalf("%s should not return error: %v", query, err)
+		}
+		warnings, err := handler.HandleQuery("SHOW WARNINGS")
+		if err != nil {
+			t.Fatalf("SHOW WARNINGS should not return error: %v", err)
+		}
+		rows := resultRows(t, warnings)
+		if int(result.Warnings) != len(rows) {
+			t.Errorf("%s reported %d warnings, SHOW WARNINGS lists %d", query, result.Warnings, len(rows))
+		}
+		return rows
+	}
+
+	// Levels SQLite does not provide are stored, but not silently
+	for _, query := range []string{
+		"SET SESSION TRANSACTION ISOLATION LEVEL READ UNCOMMITTED",
+		"SET TRANSACTION ISOLATION LEVEL READ COMMITTED",
+		"SET @@transaction_isolation = 'REPEATABLE-READ'",
+	} {
+		rows := warningsFor(query)
+		if len(rows) != 1 || !strings.Contains(rows[0][2], "not enforced") {
+			t.Errorf("Expected a warning that the level is not enforced for %s, got %v", query, rows)
+		}
+	}
+	if rows := warningsFor("SET SESSION TRANSACTION ISOLATION LEVEL SERIALIZABLE"); len(rows) != 0 {
+		t.Errorf("Expected no warning for SERIALIZABLE, got %v", rows)
+	}
+	if rows := warningsFor("SET GLOBAL TRANSACTION ISOLATION LEVEL SERIALIZABLE"); len(rows) != 1 {
+		t.Errorf("Expected a warning that GLOBAL is ignored, got %v", rows)
+	}
+
+	// The transaction that runs at the chosen level says so again; the default level stays quiet
+	warningsFor("SET SESSION TRANSACTION ISOLATION LEVEL READ COMMITTED")
+	if rows := warningsFor("BEGIN"); len(rows) != 1 || !strings.Contains(rows[0][2], "READ-COMMITTED is not enforced") {
+		t.Errorf("Expected BEGIN to warn that READ-COMMITTED is not enforced, got %v", rows)
+	}
+	warningsFor("COMMIT")
+	warningsFor("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ")
+	if rows := warningsFor("BEGIN"); len(rows) != 0 {
+		t.Errorf("Expected no warning for a transaction at the default level, got %v", rows)
+	}
+	warningsFor("COMMIT")
+}
+
+func TestHandler_SetBoundArgumentWithQuotes(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+
+	connID := handler.sessionManager.GetNextConnectionID()
+	handler.sessionManager.SetCurrentConnection(connID)
+	session := handler.sessionManager.GetOrCreateSession(connID)
+
+	// Arguments inlined for SET come back exactly as they were bound
+	for _, value := range []string{"it's", `back\slash`, `'quoted'`, `mixed \' and ''`} {
+		if _, err := handler.HandleStmtExecute(nil, "SET @note = ?", []interface{}{[]byte(value)}); err != nil {
+			t.Fatalf("SET @note = ? with %q should not return error: %v", value, err)
+		}
+		if got, _ := session.GetUser("note"); got != value {
+			t.Errorf("Expected @note = %q, got %q", value, got)
+		}
+	}
+	if _, err := handler.HandleStmtExecute(nil, "SET @idx = ?", []interface{}{"acme.eu"}); err != nil {
+		t.Fatalf("SET @idx = ? should not return error: %v", err)
+	}
+	if tenant := session.CurrentTenant(); tenant != "acme.eu" {
+		t.Errorf("Expected tenant acme.eu, got %q", tenant)
+	}
+	// A quote is no part of a tenant ID; the error names the value as it was bound
+	_, err := handler.HandleStmtExecute(nil, "SET @idx = ?", []interface{}{"o'brien"})
+	if err == nil || !strings.Contains(err.Error(), "'o'brien'") {
+		t.Errorf("Expected SET @idx = ? to refuse o'brien, got %v", err)
+	}
+
+	// Literals written by the client are unescaped the same way
+	if _, err := handler.HandleQuery(`SET @note = 'it''s', @other = "say \"hi\""`); err != nil {
+		t.Fatalf("SET with escaped literals should not return error: %v", err)
+	}
+	if got, _ := session.GetUser("note"); got != "it's" {
+		t.Errorf("Expected @note = it's, got %q", got)
+	}
+	if got, _ := session.GetUser("other"); got != `say "hi"` {
+		t.Errorf(`Expected @other = say "hi", got %q`, got)
+	}
+}
+
+func TestHandler_AlterTableAddColumnsAtomic(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	handler := NewHandler(logger)
+	defer handler.Close()
+	handler.sessionManager.SetCurrentConnection(handler.sessionManager.GetNextConnectionID())
+
+	// email already exists, so the statement fails after its first column was added
+	if _, err := handler.HandleQuery("ALTER TABLE users ADD nickname VARCHAR(50), ADD email VARCHAR(100)"); err == nil {
+		t.Fatal("Expected an error adding a column that already exists")
+	}
+	result, err := handler.HandleQuery("DESCRIBE users")
+	if err != nil {
+		t.Fatalf("DESCRIBE should not return error: %v", err)
+	}
+	for _, row := range resultRows(t, result) {
+		if row[0] == "nickname" {
+			t.Error("A failed ALTER TABLE should not leave the columns before the failing one added")
+		}
+	}
+
+	// The same columns are added together once the statement is valid
+	if _, err := handler.HandleQuery("ALTER TABLE users ADD nickname VARCHAR(50), ADD COLUMN bio TEXT"); err != nil {
+		t.Fatalf("ALTER TABLE should not return error: %v", err)
+	}
+	if _, err := handler.HandleQuery("SELECT nickname, bio FROM users"); err != nil {
+		t.Errorf("Expected both columns to be added, got %v", err)
+	}
+}
@@ -1,10 +1,18 @@
 package mysql
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode/utf8"
+
+	"multitenant-db/internal/audit"
+	"multitenant-db/internal/config"
 
 	"github.com/go-mysql-org/go-mysql/mysql"
 )
@@ -21,29 +29,48 @@ func NewQueryHandlers(handler *Handler) *QueryHandlers {
 	}
 }
 
-// HandleShowTables handles SHOW TABLES command
-func (qh *QueryHandlers) HandleShowTables() (*mysql.Result, error) {
-	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.sessionManager.GetCurrentConnection())
+// showTablesRegex matches SHOW [FULL] TABLES, capturing FULL when present
+var showTablesRegex = regexp.MustCompile(`(?i)^\s*show\s+(full\s+)?tables\b`)
+
+// HandleShowTables handles SHOW [FULL] TABLES, listing tables and views. FULL adds the
+// Table_type column, telling views apart from base tables.
+func (qh *QueryHandlers) HandleShowTables(query string) (*mysql.Result, error) {
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
 	db, err := qh.handler.databaseManager.GetDatabaseForSession(session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %v", err)
 	}
 	
-	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'")
+	full := false
+	if matches := showTablesRegex.FindStringSubmatch(query); len(matches) == 2 {
+		full = matches[1] != ""
+	}
+	
+	tables, err := listUserTables(db, true)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get tables: %v", err)
 	}
-	defer rows.Close()
 	
 	names := []string{"Tables_in_multitenant_db"}
+	if full {
+		names = append(names, "Table_type")
+	}
 	var values [][]interface{}
 	
-	for rows.Next() {
-		var tableName string
-		if err := rows.Scan(&tableName); err != nil {
-			return nil, fmt.Errorf("failed to scan table name: %v", err)
+	for _, table := range tables {
+		tableName := table.Name
+		if qh.handler.lowerCaseTableNames() {
+			tableName = strings.ToLower(tableName)
+		}
+		if !full {
+			values = append(values, []interface{}{tableName})
+			continue
 		}
-		values = append(values, []interface{}{tableName})
+		tableType := "BASE TABLE"
+		if table.View {
+			tableType = "VIEW"
+		}
+		values = append(values, []interface{}{tableName, tableType})
 	}
 	
 	resultset, err := mysql.BuildSimpleTextResultset(names, values)
@@ -54,21 +81,49 @@ func (qh *QueryHandlers) HandleShowTables() (*mysql.Result, error) {
 	return mysql.NewResult(resultset), nil
 }
 
-// HandleShowDatabases handles SHOW DATABASES command
-func (qh *QueryHandlers) HandleShowDatabases() (*mysql.Result, error) {
+// userTable is a table or view of the tenant's own
+type userTable struct {
+	Name string
+	View bool
+}
+
+// listUserTables returns the tenant's own tables ordered by name, with its views too when
+// withViews is set, leaving out SQLite's internal tables and the colocated query log
+func listUserTables(db sqlQuerier, withViews bool) ([]userTable, error) {
+	types := "'table'"
+	if withViews {
+		types = "'table', 'view'"
+	}
+	rows, err := db.Query("SELECT name, type FROM sqlite_master WHERE type IN (" + types + ") AND " + userTablesFilter + " ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var tables []userTable
+	for rows.Next() {
+		var name, objectType string
+		if err := rows.Scan(&name, &objectType); err != nil {
+			return nil, fmt.Errorf("failed to scan table name: %v", err)
+		}
+		tables = append(tables, userTable{Name: name, View: objectType == "view"})
+	}
+	return tables, rows.Err()
+}
+
+// HandleShowDatabases handles SHOW DATABASES [LIKE 'pattern']
+func (qh *QueryHandlers) HandleShowDatabases(query string) (*mysql.Result, error) {
 	names := []string{"Database"}
 	var values [][]interface{}
 	
 	// Always include standard MySQL databases
-	values = append(values, []interface{}{"information_schema"})
-	values = append(values, []interface{}{"mysql"})
-	values = append(values, []interface{}{"performance_schema"})
-	values = append(values, []interface{}{"sys"})
+	dbNames := append([]string(nil), systemSchemas...)
 	
 	// Get all active databases from the database manager
 	activeDatabases := qh.handler.databaseManager.GetActiveDatabases()
 	
-	// Add each active database with its idx identifier
+	// Build the name of each active database from its idx identifier
+	tenantNames := make([]string, 0, len(activeDatabases))
 	for idx := range activeDatabases {
 		var dbName string
 		if idx == "" || idx == "default" {
@@ -76,7 +131,19 @@ func (qh *QueryHandlers) HandleShowDatabases() (*mysql.Result, error) {
 		} else {
 			dbName = fmt.Sprintf("multitenant_db_idx_%s", idx)
 		}
-		values = append(values, []interface{}{dbName})
+		tenantNames = append(tenantNames, dbName)
+	}
+	
+	// Map iteration order is random; list tenants alphabetically for stable output
+	sort.Strings(tenantNames)
+	likeRegex, err := likeFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	for _, dbName := range append(dbNames, tenantNames...) {
+		if likeRegex == nil || likeRegex.MatchString(dbName) {
+			values = append(values, []interface{}{dbName})
+		}
 	}
 	
 	resultset, err := mysql.BuildSimpleTextResultset(names, values)
@@ -89,7 +156,7 @@ func (qh *QueryHandlers) HandleShowDatabases() (*mysql.Result, error) {
 
 // HandleDescribe handles DESCRIBE queries
 func (qh *QueryHandlers) HandleDescribe(query string) (*mysql.Result, error) {
-	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.sessionManager.GetCurrentConnection())
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
 	db, err := qh.handler.databaseManager.GetDatabaseForSession(session)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get database: %v", err)
@@ -97,19 +164,23 @@ func (qh *QueryHandlers) HandleDescribe(query string) (*mysql.Result, error) {
 	
 	queryLower := strings.ToLower(query)
 	
-	// Extract table name from DESCRIBE statement
+	// Extract table name from DESCRIBE statement. Existing tables and views are resolved by name
+	// first, so a view such as active_users is not mistaken for the users table.
 	var tableName string
-	if strings.Contains(queryLower, "users") {
-		tableName = "users"
-	} else if strings.Contains(queryLower, "products") {
-		tableName = "products"
-	} else {
-		// Try to extract table name more generically
-		parts := strings.Fields(queryLower)
-		if len(parts) >= 2 {
-			tableName = parts[1]
+	parts := strings.Fields(query)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("could not determine table name from query")
+	}
+	if tableName, err = resolveTableName(db, parts[1]); err != nil {
+		if qh.handler.lowerCaseTableNames() {
+			return nil, err
+		}
+		if strings.Contains(queryLower, "users") {
+			tableName = "users"
+		} else if strings.Contains(queryLower, "products") {
+			tableName = "products"
 		} else {
-			return nil, fmt.Errorf("could not determine table name from query")
+			tableName = strings.Fields(queryLower)[1]
 		}
 	}
 	
@@ -120,19 +191,25 @@ func (qh *QueryHandlers) HandleDescribe(query string) (*mysql.Result, error) {
 	}
 	defer rows.Close()
 	
+	columns, err := scanTableColumns(rows)
+	if err != nil {
+		return nil, err
+	}
+	
+	// Only a single-column INTEGER primary key is a rowid alias that SQLite fills in itself
+	keyColumns := 0
+	for _, column := range columns {
+		if column.pkSeq > 0 {
+			keyColumns++
+		}
+	}
+	
 	names := []string{"Field", "Type", "Null", "Key", "Default", "Extra"}
 	var values [][]interface{}
 	
-	for rows.Next() {
-		var cid int
-		var name, dataType string
-		var notNull bool
-		var defaultValue interface{}
-		var pk bool
-		
-		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
-			return nil, fmt.Errorf("failed to scan column info: %v", err)
-		}
+	for _, column := range columns {
+		name, dataType, notNull, defaultValue := column.name, column.dataType, column.notNull, column.defaultValue
+		pk := column.pkSeq > 0
 		
 		// Convert SQLite types to MySQL-like types
 		var mysqlType string
@@ -158,7 +235,7 @@ func (qh *QueryHandlers) HandleDescribe(query string) (*mysql.Result, error) {
 		}
 		
 		extraStr := ""
-		if pk && strings.ToLower(dataType) == "integer" {
+		if pk && keyColumns == 1 && strings.ToLower(dataType) == "integer" {
 			extraStr = "auto_increment"
 		}
 		
@@ -179,106 +256,403 @@ func (qh *QueryHandlers) HandleDescribe(query string) (*mysql.Result, error) {
 	return mysql.NewResult(resultset), nil
 }
 
-// HandleSet handles SET commands for user-defined session variables
+// tableColumn is one column as reported by PRAGMA table_info
+type tableColumn struct {
+	name         string
+	dataType     string
+	notNull      bool
+	defaultValue interface{}
+	pkSeq        int // 1-based position in the primary key, 0 when not part of it
+}
+
+// scanTableColumns reads the rows of PRAGMA table_info in column declaration order. The pk column
+// is a position rather than a flag, so every column of a composite primary key is recognised.
+func scanTableColumns(rows *sql.Rows) ([]tableColumn, error) {
+	var columns []tableColumn
+	for rows.Next() {
+		var cid int
+		var column tableColumn
+		if err := rows.Scan(&cid, &column.name, &column.dataType, &column.notNull, &column.defaultValue, &column.pkSeq); err != nil {
+			return nil, fmt.Errorf("failed to scan column info: %v", err)
+		}
+		columns = append(columns, column)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read column info: %v", err)
+	}
+	return columns, nil
+}
+
+// resolveTableName maps a client-supplied table name to the name stored in SQLite, ignoring case
+func resolveTableName(db *sql.DB, name string) (string, error) {
+	name = strings.Trim(name, "`\"';")
+	
+	var stored string
+	err := db.QueryRow("SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND lower(name) = lower(?)", name).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("table %s not found", name)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve table %s: %v", name, err)
+	}
+	
+	return stored, nil
+}
+
+// setStatementRegex matches a SET statement made of variable assignments, as opposed to forms
+// such as SET NAMES or SET TRANSACTION
+var setStatementRegex = regexp.MustCompile(`(?i)^\s*set\s+(?:(?:global|session|local)\s+)?(?:@@|@)?(?:(?:global|session|local)\.)?\w+\s*:?=`)
+
+// setAssignmentRegex matches one assignment of a SET statement:
+// @variable = value, @variable := value, @@[session.|global.|local.]variable = value and
+// [SESSION |GLOBAL |LOCAL ]variable = value, the last being a system variable
+var setAssignmentRegex = regexp.MustCompile(`(?is)^(?:(?:global|session|local)\s+)?(@@|@)?(?:(?:global|session|local)\.)?(\w+)\s*:?=\s*(.+)$`)
+
+// setAssignment is one parsed assignment of a SET statement
+type setAssignment struct {
+	system bool        // System variable rather than a user-defined @variable
+	name   string      // Lowercased variable name
+	value  interface{} // Value to store, already validated
+}
+
+// HandleSet handles SET commands for user-defined and system session variables. Several
+// comma-separated assignments may be given; they are all validated before any is applied, so
+// the statement either succeeds as a whole or changes nothing.
 func (qh *QueryHandlers) HandleSet(query string) (*mysql.Result, error) {
 	// Get current session using the actual connection ID
-	connID := qh.handler.sessionManager.GetCurrentConnection()
+	connID := qh.handler.currentConnection()
 	session := qh.handler.sessionManager.GetOrCreateSession(connID)
 	
-	// Parse SET statement - support only user-defined session variables (@variables)
-	// Patterns to match:
-	// SET @variable = value  
-	// SET @variable := value
-	setRegex := regexp.MustCompile(`(?i)set\s+(@)(\w+)\s*(:?=)\s*(.+)`)
-	matches := setRegex.FindStringSubmatch(query)
-	
-	if len(matches) != 5 {
+	body := strings.TrimSpace(query)
+	if len(body) < 4 || !strings.EqualFold(body[:4], "set ") {
 		return nil, fmt.Errorf("invalid SET syntax: %s", query)
 	}
+	body = strings.TrimSuffix(strings.TrimSpace(body[4:]), ";")
 	
-	// prefix := matches[1] // @@ or @ prefix - we only care about @
-	varName := strings.ToLower(matches[2])
-	varValue := strings.Trim(matches[4], "\"'`")
+	var assignments []setAssignment
+	for _, part := range splitTopLevel(body) {
+		matches := setAssignmentRegex.FindStringSubmatch(strings.TrimSpace(part))
+		if matches == nil {
+			return nil, fmt.Errorf("invalid SET syntax: %s", query)
+		}
+		prefix := matches[1]
+		varName := strings.ToLower(matches[2])
+		varValue, quoted := unquoteLiteral(matches[3])
+		if !quoted {
+			varValue = strings.Trim(varValue, "\"'`")
+		}
+		
+		// System variables are kept separately; @@idx stays an alias for the @idx routing variable
+		if prefix != "@" && varName != "idx" {
+			value, err := systemVariableValue(varName, varValue)
+			if err != nil {
+				return nil, err
+			}
+			assignments = append(assignments, setAssignment{system: true, name: varName, value: value})
+			continue
+		}
+		assignments = append(assignments, setAssignment{name: varName, value: parseSetValue(varValue)})
+	}
 	
-	// Convert value based on variable type
-	var value interface{}
+	// @idx takes the tenant IDs the HTTP API and tenant hints accept
+	for _, assignment := range assignments {
+		if assignment.system || assignment.name != "idx" {
+			continue
+		}
+		if idx := tenantIDString(assignment.value); idx != "" && config.CheckIdx(idx) != "" {
+			return nil, invalidIdxError(idx)
+		}
+	}
+	
+	// Strict tenant mode refuses to bind the session to a tenant that does not exist yet
+	if qh.handler.strictTenants() {
+		for _, assignment := range assignments {
+			if assignment.system || assignment.name != "idx" || assignment.value == nil {
+				continue
+			}
+			if idx := tenantIDString(assignment.value); idx != "" && !qh.handler.databaseManager.HasDatabase(idx) {
+				return nil, unknownDatabaseError(fmt.Sprintf("multitenant_db_idx_%s", idx))
+			}
+		}
+	}
+	
+	// The tenant the statement would switch to must be one the logged-in user may use
+	previousTenant := session.CurrentTenant()
+	userVars := make(map[string]interface{})
+	for _, assignment := range assignments {
+		if !assignment.system {
+			userVars[assignment.name] = assignment.value
+		}
+	}
+	if tenant := session.tenantWithUserVars(userVars); tenant != previousTenant {
+		if err := qh.handler.authorizeTenant(session, tenant); err != nil {
+			return nil, err
+		}
+	}
+	
+	var warnings []Warning
+	for _, assignment := range assignments {
+		switch {
+		case assignment.system:
+			warnings = append(warnings, qh.setSystemVariable(session, assignment.name, assignment.value)...)
+		case assignment.value == nil:
+			session.UnsetUser(assignment.name)
+			qh.handler.logWithIdx("Unset user-defined session variable: @%s", assignment.name)
+		default:
+			session.SetUser(assignment.name, assignment.value)
+			qh.handler.logWithIdx("Set user-defined session variable: @%s = %v", assignment.name, assignment.value)
+		}
+	}
+	
+	// Setting @idx rebinds the session to another tenant right away
+	if currentTenant := session.CurrentTenant(); currentTenant != previousTenant {
+		qh.handler.logWithIdx("Connection %d rebound from tenant %q to %q", connID, previousTenant, currentTenant)
+	}
+	
+	// Return OK result
+	result := mysql.NewResult(nil)
+	result.AffectedRows = 0
+	if len(warnings) > 0 {
+		session.SetWarnings(warnings)
+		result.Warnings = uint16(len(warnings))
+	}
+	return result, nil
+}
+
+// splitTopLevel splits s on commas outside quoted strings, quoted identifiers and parentheses
+func splitTopLevel(s string) []string {
+	var parts []string
+	var quote rune
+	escaped := false
+	depth, start := 0, 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if c == '\\' && quote != '`' {
+				escaped = true
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// parseSetValue converts the literal on the right of a SET assignment to a Go value
+func parseSetValue(varValue string) interface{} {
 	if strings.ToLower(varValue) == "null" {
-		value = nil
+		return nil
 	} else if strings.ToLower(varValue) == "true" || varValue == "1" {
-		value = 1
+		return 1
 	} else if strings.ToLower(varValue) == "false" || varValue == "0" {
-		value = 0
+		return 0
 	} else if intVal, err := strconv.Atoi(varValue); err == nil {
-		value = intVal
-	} else {
-		value = varValue
+		return intVal
 	}
+	return varValue
+}
+
+// systemVariableValue validates the value assigned to a system variable and converts it to the
+// form stored, rejecting invalid values for the ones with server-side effect
+func systemVariableValue(varName string, varValue string) (interface{}, error) {
+	switch varName {
+	case "tx_isolation", "transaction_isolation":
+		level, err := normalizeIsolationLevel(varValue)
+		if err != nil {
+			return nil, mysql.NewError(mysql.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("Variable '%s' can't be set to the value of '%s'", varName, varValue))
+		}
+		return level, nil
+	case "time_zone":
+		if _, err := timeZoneLocation(varValue); err != nil {
+			return nil, err
+		}
+		return varValue, nil
+	case "tx_read_only", "transaction_read_only":
+		switch strings.ToLower(varValue) {
+		case "1", "on", "true":
+			return 1, nil
+		case "0", "off", "false":
+			return 0, nil
+		}
+		return nil, mysql.NewError(mysql.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("Variable '%s' can't be set to the value of '%s'", varName, varValue))
+	}
+	return parseSetValue(varValue), nil
+}
+
+// setSystemVariable stores a session-scoped system variable validated by systemVariableValue,
+// returning warnings for a setting that is kept but has no effect
+func (qh *QueryHandlers) setSystemVariable(session *SessionVariables, varName string, value interface{}) []Warning {
+	switch varName {
+	case "tx_isolation", "transaction_isolation":
+		// Keep both spellings in sync, as MySQL 5.7 does
+		session.SetSystem("tx_isolation", value)
+		session.SetSystem("transaction_isolation", value)
+		qh.handler.logWithIdx("Set transaction isolation: %s (SQLite executes transactions as %s)", value, sqliteIsolationLevel(value.(string)))
+		return isolationWarnings(value.(string))
+	case "tx_read_only", "transaction_read_only":
+		session.SetSystem("tx_read_only", value)
+		session.SetSystem("transaction_read_only", value)
+		qh.handler.logWithIdx("Set transaction read only: %v", value)
+	default:
+		session.SetSystem(varName, value)
+		qh.handler.logWithIdx("Set system session variable: @@%s = %v", varName, value)
+	}
+	return nil
+}
+
+// setTransactionRegex matches SET [GLOBAL | SESSION | LOCAL] TRANSACTION characteristic[, ...]
+var setTransactionRegex = regexp.MustCompile(`(?i)^\s*set\s+(?:(global|session|local)\s+)?transaction\s+(.+?)\s*;?\s*$`)
+
+// HandleSetTransaction handles SET TRANSACTION. Without a scope the isolation level and access
+// mode apply to the next transaction only; SESSION and LOCAL change the session defaults. There
+// is no server-wide variable store, so GLOBAL has no effect and says so in a warning. An isolation
+// level SQLite does not provide is kept for @@transaction_isolation with a warning as well.
+func (qh *QueryHandlers) HandleSetTransaction(query string) (*mysql.Result, error) {
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
 	
-	// Handle user-defined session variable (@)
-	if value == nil {
-		session.UnsetUser(varName)
-		qh.handler.logWithIdx("Unset user-defined session variable: @%s", varName)
-	} else {
-		session.SetUser(varName, value)
-		qh.handler.logWithIdx("Set user-defined session variable: @%s = %v", varName, value)
+	match := setTransactionRegex.FindStringSubmatch(query)
+	if match == nil {
+		return nil, fmt.Errorf("invalid SET TRANSACTION syntax: %s", query)
+	}
+	scope := strings.ToLower(match[1])
+	
+	var chars TransactionCharacteristics
+	for _, characteristic := range strings.Split(match[2], ",") {
+		words := strings.Fields(strings.ToLower(characteristic))
+		switch {
+		case len(words) > 2 && words[0] == "isolation" && words[1] == "level":
+			level, err := normalizeIsolationLevel(strings.Join(words[2:], " "))
+			if err != nil {
+				return nil, mysql.NewError(mysql.ER_PARSE_ERROR, fmt.Sprintf("You have an error in your SQL syntax near '%s'", strings.TrimSpace(characteristic)))
+			}
+			chars.IsolationLevel = level
+		case len(words) == 2 && words[0] == "read" && (words[1] == "only" || words[1] == "write"):
+			readOnly := words[1] == "only"
+			chars.ReadOnly = &readOnly
+		default:
+			return nil, mysql.NewError(mysql.ER_PARSE_ERROR, fmt.Sprintf("You have an error in your SQL syntax near '%s'", strings.TrimSpace(characteristic)))
+		}
+	}
+	
+	var warnings []Warning
+	switch scope {
+	case "":
+		if session.InTransaction() {
+			return nil, mysql.NewError(mysql.ER_CANT_CHANGE_TX_CHARACTERISTICS, "Transaction characteristics can't be changed while a transaction is in progress")
+		}
+		session.SetNextTransaction(chars)
+		if chars.IsolationLevel != "" {
+			warnings = isolationWarnings(chars.IsolationLevel)
+		}
+		qh.handler.logWithIdx("Set characteristics for the next transaction: %s", match[2])
+	case "session", "local":
+		if chars.IsolationLevel != "" {
+			warnings = qh.setSystemVariable(session, "transaction_isolation", chars.IsolationLevel)
+		}
+		if chars.ReadOnly != nil {
+			readOnly := 0
+			if *chars.ReadOnly {
+				readOnly = 1
+			}
+			qh.setSystemVariable(session, "transaction_read_only", readOnly)
+		}
+		qh.handler.logWithIdx("Set session transaction characteristics: %s", match[2])
+	case "global":
+		warnings = []Warning{{
+			Level:   "Warning",
+			Code:    mysql.ER_NOT_SUPPORTED_YET,
+			Message: "Global transaction characteristics are not supported; the setting was ignored",
+		}}
+		qh.handler.logWithIdx("Ignoring global transaction characteristics: %s", match[2])
 	}
 	
-	// Return OK result
 	result := mysql.NewResult(nil)
 	result.AffectedRows = 0
+	if len(warnings) > 0 {
+		session.SetWarnings(warnings)
+		result.Warnings = uint16(len(warnings))
+	}
 	return result, nil
 }
 
-// HandleSelectVariable handles SELECT @variable queries
+// normalizeIsolationLevel converts an isolation level to MySQL's canonical form, e.g. READ-COMMITTED
+func normalizeIsolationLevel(level string) (string, error) {
+	normalized := strings.ToUpper(strings.Join(strings.Fields(strings.ReplaceAll(level, "-", " ")), "-"))
+	switch normalized {
+	case "READ-UNCOMMITTED", "READ-COMMITTED", "REPEATABLE-READ", "SERIALIZABLE":
+		return normalized, nil
+	default:
+		return "", fmt.Errorf("unsupported transaction isolation level: %s", level)
+	}
+}
+
+// sqliteIsolationLevel maps a MySQL isolation level to the level SQLite provides. SQLite
+// serializes writers, and PRAGMA read_uncommitted only applies to shared-cache databases, which
+// tenants never are, so every level behaves as SERIALIZABLE.
+func sqliteIsolationLevel(level string) string {
+	return "SERIALIZABLE"
+}
+
+// isolationWarnings warns that level is not enforced when SQLite runs transactions at another one
+func isolationWarnings(level string) []Warning {
+	executed := sqliteIsolationLevel(level)
+	if executed == level {
+		return nil
+	}
+	return []Warning{{
+		Level:   "Warning",
+		Code:    mysql.ER_NOT_SUPPORTED_YET,
+		Message: fmt.Sprintf("Transaction isolation level %s is not enforced; SQLite executes transactions as %s", level, executed),
+	}}
+}
+
+// HandleSelectVariable handles SELECT @variable and SELECT @@variable queries
 func (qh *QueryHandlers) HandleSelectVariable(query string) (*mysql.Result, error) {
-	connID := qh.handler.sessionManager.GetCurrentConnection()
+	connID := qh.handler.currentConnection()
 	session := qh.handler.sessionManager.GetOrCreateSession(connID)
 	
-	// Parse variable reference - support only user-defined session variables (@)
-	varRegex := regexp.MustCompile(`(@)(?:session\.)?(\w+)`)
-	matches := varRegex.FindAllStringSubmatch(query, -1)
+	// Parse variable references - user-defined (@) and system (@@) variables, the latter with an
+	// optional session., local. or global. scope - after the LIMIT, which could pass for an alias
+	matches := selectVariableItemRegex.FindAllStringSubmatch(selectVariableLimitRegex.ReplaceAllString(query, ""), -1)
 	
 	if len(matches) == 0 {
 		return nil, fmt.Errorf("no variables found in query: %s", query)
 	}
 	
 	var names []string
-	var values [][]interface{}
+	row := make([]interface{}, len(matches))
 	
-	// Handle single variable
-	if len(matches) == 1 {
-		// prefix := matches[0][1] // @@ or @ prefix - we only care about @
-		varName := strings.ToLower(matches[0][2])
+	for i, match := range matches {
+		prefix := match[1]
+		scope := strings.ToLower(match[2])
+		varName := strings.ToLower(match[3])
 		
-		var value interface{}
+		value := qh.variableValue(session, prefix, scope, varName)
 		
-		// User-defined variable
-		value, exists := session.GetUser(varName)
-		if !exists {
-			value = nil // MySQL returns NULL for undefined user-defined session variables
+		// MySQL names the column after the alias, or else the expression, scope included
+		name := prefix + varName
+		if scope != "" {
+			name = prefix + scope + "." + varName
 		}
-		names = []string{"@" + varName}
-		
-		values = [][]interface{}{{value}}
-	} else {
-		// Handle multiple variables
-		row := make([]interface{}, len(matches))
-		for i, match := range matches {
-			// prefix := match[1] // @@ or @ prefix - we only care about @
-			varName := strings.ToLower(match[2])
-			
-			var value interface{}
-			// User-defined variable
-			value, _ = session.GetUser(varName)
-			if value == nil {
-				value = nil // MySQL returns NULL for undefined user-defined session variables
-			}
-			names = append(names, "@"+varName)
-			
-			row[i] = value
+		if alias := match[4]; alias != "" {
+			name = strings.Trim(alias, "`'\"")
 		}
-		values = [][]interface{}{row}
+		names = append(names, name)
+		
+		row[i] = value
 	}
+	values := [][]interface{}{row}
 	
 	resultset, err := mysql.BuildSimpleTextResultset(names, values)
 	if err != nil {
@@ -288,17 +662,142 @@ func (qh *QueryHandlers) HandleSelectVariable(query string) (*mysql.Result, erro
 	return mysql.NewResult(resultset), nil
 }
 
+// variableValue returns the value of the variable with the given @ or @@ prefix, scope and
+// lower-cased name as a SELECT reads it
+func (qh *QueryHandlers) variableValue(session *SessionVariables, prefix, scope, name string) interface{} {
+	var value interface{}
+	if prefix == "@@" && scope == "global" {
+		// Server-wide value, ignoring anything the session has set
+		value, _ = qh.handler.globalSystemVariable(name)
+	} else if prefix == "@@" && name != "idx" {
+		// System variable
+		value, _ = qh.handler.systemVariable(session, name)
+	} else {
+		// User-defined variable; MySQL returns NULL for undefined ones
+		value, _ = session.GetUser(name)
+	}
+	return value
+}
+
+// variableRefRegex matches a user or system variable read by a statement
+var variableRefRegex = regexp.MustCompile(`(?i)(@@|@)(?:(session|local|global)\.)?(\w+)`)
+
+// inlineVariables replaces the variables a statement bound for SQLite reads, outside quoted text
+// and comments, with their values as literals. SQLite has no session variables, so a statement
+// such as SELECT @x, name FROM users or INSERT INTO t VALUES (@id) would fail there otherwise.
+func (qh *QueryHandlers) inlineVariables(session *SessionVariables, query string) string {
+	// blankQuoted keeps every rune in place, so both line up rune for rune
+	blanked := blankQuoted(query)
+	matches := variableRefRegex.FindAllStringSubmatchIndex(blanked, -1)
+	if matches == nil {
+		return query
+	}
+	
+	runes := []rune(query)
+	var inlined strings.Builder
+	next := 0
+	for _, match := range matches {
+		start := utf8.RuneCountInString(blanked[:match[0]])
+		end := start + utf8.RuneCountInString(blanked[match[0]:match[1]])
+		scope := ""
+		if match[4] >= 0 {
+			scope = strings.ToLower(blanked[match[4]:match[5]])
+		}
+		value := qh.variableValue(session, blanked[match[2]:match[3]], scope, strings.ToLower(blanked[match[6]:match[7]]))
+		inlined.WriteString(string(runes[next:start]))
+		inlined.WriteString(sqliteLiteral(value))
+		next = end
+	}
+	inlined.WriteString(string(runes[next:]))
+	return inlined.String()
+}
+
+// quotedLiteralPattern matches a single- or double-quoted string literal, with doubled or
+// backslash-escaped quotes inside
+const quotedLiteralPattern = `'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"`
+
+// likeFilterRegex matches the LIKE 'pattern' [ESCAPE 'c'] filter of a SHOW statement
+var likeFilterRegex = regexp.MustCompile(`(?is)\blike\s+(` + quotedLiteralPattern + `)(?:\s+escape\s+(` + quotedLiteralPattern + `))?`)
+
+// likeFilter returns a matcher for the LIKE 'pattern' filter of a SHOW statement, or nil when it
+// has none. % matches any run of characters and _ any one character, unless preceded by the
+// escape character: a backslash as in 'multitenant\_db', or the one an ESCAPE clause names, as in
+// LIKE 'multitenant|_db' ESCAPE '|'. An ESCAPE of more than one character is rejected as in MySQL.
+func likeFilter(query string) (*regexp.Regexp, error) {
+	matches := likeFilterRegex.FindStringSubmatch(query)
+	if len(matches) != 3 {
+		return nil, nil
+	}
+	
+	text, _ := unquoteLiteral(matches[1])
+	escape := '\\'
+	if matches[2] != "" {
+		escapeText, _ := unquoteLiteral(matches[2])
+		switch runes := []rune(escapeText); len(runes) {
+		case 0:
+			// An empty ESCAPE keeps the backslash, as in MySQL
+		case 1:
+			escape = runes[0]
+		default:
+			return nil, mysql.NewError(mysql.ER_WRONG_ARGUMENTS, "Incorrect arguments to ESCAPE")
+		}
+	}
+	
+	var pattern strings.Builder
+	escaped := false
+	for _, c := range text {
+		switch {
+		case escaped:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+			escaped = false
+		case c == escape:
+			escaped = true
+		case c == '%':
+			pattern.WriteString(".*")
+		case c == '_':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if escaped {
+		pattern.WriteString(regexp.QuoteMeta(string(escape)))
+	}
+	return regexp.MustCompile("(?is)^" + pattern.String() + "$"), nil
+}
+
 // HandleShowVariables handles SHOW VARIABLES command
-func (qh *QueryHandlers) HandleShowVariables() (*mysql.Result, error) {
-	connID := qh.handler.sessionManager.GetCurrentConnection()
+func (qh *QueryHandlers) HandleShowVariables(query string) (*mysql.Result, error) {
+	connID := qh.handler.currentConnection()
 	session := qh.handler.sessionManager.GetOrCreateSession(connID)
 	
+	// Optional LIKE filter, e.g. SHOW VARIABLES LIKE 'max_allowed_packet'
+	likeRegex, err := likeFilter(query)
+	if err != nil {
+		return nil, err
+	}
+	
 	names := []string{"Variable_name", "Value"}
 	var values [][]interface{}
 	
 	allVars := session.GetAllUser()
 	for varName, varValue := range allVars {
-		values = append(values, []interface{}{"@" + varName, varValue})
+		if likeRegex == nil || likeRegex.MatchString(varName) {
+			values = append(values, []interface{}{"@" + varName, varValue})
+		}
+	}
+	
+	// System variables follow, sorted by name like MySQL
+	systemVars := qh.handler.systemVariables(session)
+	systemNames := make([]string, 0, len(systemVars))
+	for varName := range systemVars {
+		systemNames = append(systemNames, varName)
+	}
+	sort.Strings(systemNames)
+	for _, varName := range systemNames {
+		if likeRegex == nil || likeRegex.MatchString(varName) {
+			values = append(values, []interface{}{varName, systemVars[varName]})
+		}
 	}
 	
 	resultset, err := mysql.BuildSimpleTextResultset(names, values)
@@ -308,3 +807,626 @@ func (qh *QueryHandlers) HandleShowVariables() (*mysql.Result, error) {
 	
 	return mysql.NewResult(resultset), nil
 }
+
+// HandleShowGrants handles SHOW GRANTS [FOR user] commands
+func (qh *QueryHandlers) HandleShowGrants(query string) (*mysql.Result, error) {
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	
+	// Default to the connected user; honour an explicit FOR 'user'@'host' clause
+	user := qh.handler.authUsername()
+	host := "%"
+	grantsRegex := regexp.MustCompile("(?i)show\\s+grants\\s+for\\s+['\"`]?([^'\"`@\\s;(]+)['\"`]?(?:@['\"`]?([^'\"`\\s;]+)['\"`]?)?")
+	if matches := grantsRegex.FindStringSubmatch(query); len(matches) == 3 {
+		if !strings.HasPrefix(strings.ToLower(matches[1]), "current_user") {
+			user = matches[1]
+			if matches[2] != "" {
+				host = matches[2]
+			}
+		}
+	}
+	
+	// Grant everything on the database the session is currently routed to
+	dbName := "multitenant_db"
+	if idx := session.CurrentTenant(); idx != "" && idx != "default" {
+		dbName = fmt.Sprintf("multitenant_db_idx_%s", idx)
+	}
+	
+	names := []string{fmt.Sprintf("Grants for %s@%s", user, host)}
+	values := [][]interface{}{
+		{fmt.Sprintf("GRANT ALL PRIVILEGES ON `%s`.* TO `%s`@`%s`", dbName, user, host)},
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset(names, values)
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// foundRowsRegex matches SELECT FOUND_ROWS() with an optional alias
+var foundRowsRegex = regexp.MustCompile(`(?i)^\s*select\s+found_rows\s*\(\s*\)(?:\s+(?:as\s+)?` + "`?" + `(\w+)` + "`?" + `)?\s*;?\s*$`)
+
+// calcFoundRowsRegex matches the SQL_CALC_FOUND_ROWS hint at the start of a SELECT
+var calcFoundRowsRegex = regexp.MustCompile(`(?i)^(\s*select\s+(?:(?:all|distinct|distinctrow)\s+)?)sql_calc_found_rows\s+`)
+
+// trailingLimitRegex matches a trailing LIMIT n, LIMIT m, n or LIMIT n OFFSET m clause
+var trailingLimitRegex = regexp.MustCompile(`(?is)^(.*?)\s+limit\s+\d+(?:\s*,\s*\d+|\s+offset\s+\d+)?\s*;?\s*$`)
+
+// stripCalcFoundRows removes the MySQL-only SQL_CALC_FOUND_ROWS hint, which SQLite rejects,
+// and reports whether it was present
+func stripCalcFoundRows(query string) (string, bool) {
+	if !calcFoundRowsRegex.MatchString(query) {
+		return query, false
+	}
+	return calcFoundRowsRegex.ReplaceAllString(query, "${1}"), true
+}
+
+// HandleFoundRows handles SELECT FOUND_ROWS(), answering from the row count of the session's last SELECT
+func (qh *QueryHandlers) HandleFoundRows(query string) (*mysql.Result, error) {
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	
+	column := "FOUND_ROWS()"
+	if matches := foundRowsRegex.FindStringSubmatch(query); len(matches) == 2 && matches[1] != "" {
+		column = matches[1]
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset([]string{column}, [][]interface{}{{session.GetFoundRows()}})
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// connectionIDRegex matches SELECT CONNECTION_ID() with an optional alias
+var connectionIDRegex = regexp.MustCompile(`(?i)^\s*select\s+connection_id\s*\(\s*\)(?:\s+(?:as\s+)?` + "`?" + `(\w+)` + "`?" + `)?\s*;?\s*$`)
+
+// sleepRegex matches SELECT SLEEP(seconds) with an optional alias, capturing the call and its argument
+var sleepRegex = regexp.MustCompile(`(?i)^\s*select\s+(sleep\s*\(\s*(\d+(?:\.\d*)?|\.\d+)\s*\))(?:\s+(?:as\s+)?` + "`?" + `(\w+)` + "`?" + `)?\s*;?\s*$`)
+
+// processlistRegex matches SHOW [FULL] PROCESSLIST
+var processlistRegex = regexp.MustCompile(`(?i)^\s*show\s+(full\s+)?processlist\s*;?\s*$`)
+
+// processlistInfoLength is how much of a statement SHOW PROCESSLIST shows without FULL
+const processlistInfoLength = 100
+
+// HandleConnectionID handles SELECT CONNECTION_ID(), answering with the id of the current connection
+func (qh *QueryHandlers) HandleConnectionID(query string) (*mysql.Result, error) {
+	column := "CONNECTION_ID()"
+	if matches := connectionIDRegex.FindStringSubmatch(query); len(matches) == 2 && matches[1] != "" {
+		column = matches[1]
+	}
+	
+	connID := int64(qh.handler.currentConnection())
+	resultset, err := mysql.BuildSimpleTextResultset([]string{column}, [][]interface{}{{connID}})
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// HandleSleep handles SELECT SLEEP(seconds), which SQLite lacks, by waiting the given number of
+// seconds and answering 0. The statement timeout and KILL QUERY cut the wait short with the same
+// errors they raise for any other statement.
+func (qh *QueryHandlers) HandleSleep(query string) (*mysql.Result, error) {
+	matches := sleepRegex.FindStringSubmatch(query)
+	seconds, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return nil, mysql.NewError(mysql.ER_WRONG_ARGUMENTS, "Incorrect arguments to sleep")
+	}
+	column := matches[1]
+	if matches[3] != "" {
+		column = matches[3]
+	}
+	
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	ctx, cancel := qh.handler.statementContext()
+	defer cancel()
+	session.trackStatement(cancel)
+	defer session.trackStatement(nil)
+	
+	timer := time.NewTimer(time.Duration(seconds * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, qh.handler.statementInterrupted(ctx, query)
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset([]string{column}, [][]interface{}{{int64(0)}})
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// timeFunctionRegex matches one server clock function in a SELECT list, with its optional
+// parentheses and fractional seconds precision and an optional alias
+var timeFunctionRegex = regexp.MustCompile(`(?i)^(now|sysdate|unix_timestamp|current_timestamp|localtime|localtimestamp)(\s*\(\s*([0-6]?)\s*\))?(?:\s+(?:as\s+)?` + "`?" + `(\w+)` + "`?" + `)?$`)
+
+// selectListRegex matches a SELECT without any clauses, capturing its select list
+var selectListRegex = regexp.MustCompile(`(?is)^\s*select\s+(.+?)\s*;?\s*$`)
+
+// timeFunction is one server clock function selected by a statement
+type timeFunction struct {
+	name      string // Lowercased function name
+	column    string // Result column: the alias, or the expression as written
+	precision int    // Fractional seconds digits
+}
+
+// parseTimeFunctions reports whether query selects nothing but server clock functions, such as
+// SELECT NOW(), UNIX_TIMESTAMP(), and returns them in select list order
+func parseTimeFunctions(query string) ([]timeFunction, bool) {
+	matches := selectListRegex.FindStringSubmatch(query)
+	if matches == nil {
+		return nil, false
+	}
+	
+	var functions []timeFunction
+	for _, item := range splitTopLevel(matches[1]) {
+		item = strings.TrimSpace(item)
+		parts := timeFunctionRegex.FindStringSubmatch(item)
+		if parts == nil {
+			return nil, false
+		}
+		name := strings.ToLower(parts[1])
+		hasParens := parts[2] != ""
+		switch name {
+		case "now", "sysdate":
+			if !hasParens {
+				return nil, false // A bare now is a column reference
+			}
+		case "unix_timestamp":
+			if !hasParens || parts[3] != "" {
+				return nil, false // UNIX_TIMESTAMP(date) is left to SQLite
+			}
+		}
+		
+		fn := timeFunction{name: name, column: parts[1] + parts[2]}
+		if parts[4] != "" {
+			fn.column = parts[4]
+		}
+		if parts[3] != "" {
+			fn.precision = int(parts[3][0] - '0')
+		}
+		functions = append(functions, fn)
+	}
+	return functions, true
+}
+
+// isTimeFunctionSelect reports whether query is handled by HandleTimeFunctions
+func isTimeFunctionSelect(query string) bool {
+	_, ok := parseTimeFunctions(query)
+	return ok
+}
+
+// HandleTimeFunctions handles SELECTs of NOW(), CURRENT_TIMESTAMP, UNIX_TIMESTAMP() and their
+// synonyms from the server clock rather than SQLite's, which only knows UTC. The clock is read
+// once, so every function in a statement sees the same instant, and datetimes are reported in
+// the session time_zone.
+func (qh *QueryHandlers) HandleTimeFunctions(query string) (*mysql.Result, error) {
+	functions, ok := parseTimeFunctions(query)
+	if !ok {
+		return nil, fmt.Errorf("invalid time function query: %s", query)
+	}
+	
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	location, err := qh.handler.sessionLocation(session)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().In(location)
+	
+	names := make([]string, len(functions))
+	row := make([]interface{}, len(functions))
+	for i, fn := range functions {
+		names[i] = fn.column
+		if fn.name == "unix_timestamp" {
+			row[i] = now.Unix()
+			continue
+		}
+		layout := time.DateTime
+		if fn.precision > 0 {
+			layout += "." + strings.Repeat("0", fn.precision)
+		}
+		row[i] = now.Format(layout)
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset(names, [][]interface{}{row})
+	if err != nil {
+		return nil, err
+	}
+	for i, fn := range functions {
+		if fn.name != "unix_timestamp" {
+			field := resultset.Fields[i]
+			field.Type = mysql.MYSQL_TYPE_DATETIME
+			field.Charset = 63 // binary
+			field.Flag |= mysql.BINARY_FLAG
+			field.Decimal = uint8(fn.precision)
+		}
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// HandleShowProcesslist handles SHOW [FULL] PROCESSLIST, listing every open connection with the
+// database its @idx routes to. Only the current connection is running a statement.
+func (qh *QueryHandlers) HandleShowProcesslist(query string) (*mysql.Result, error) {
+	full := processlistRegex.FindStringSubmatch(query)[1] != ""
+	current := qh.handler.currentConnection()
+	user := qh.handler.authUsername()
+	
+	names := []string{"Id", "User", "Host", "db", "Command", "Time", "State", "Info"}
+	var values [][]interface{}
+	for _, process := range qh.handler.sessionManager.Processes() {
+		dbName := "multitenant_db"
+		if process.Tenant != "" && process.Tenant != "default" {
+			dbName = fmt.Sprintf("multitenant_db_idx_%s", process.Tenant)
+		}
+		
+		command, state := "Sleep", ""
+		var info interface{}
+		if process.ID == current {
+			command, state = "Query", "executing"
+			statement := strings.TrimSpace(query)
+			if !full && len(statement) > processlistInfoLength {
+				statement = statement[:processlistInfoLength]
+			}
+			info = statement
+		}
+		
+		elapsed := int64(time.Since(process.OpenedAt) / time.Second)
+		values = append(values, []interface{}{int64(process.ID), user, process.Host, dbName, command, elapsed, state, info})
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset(names, values)
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// useRegex matches a USE statement sent as a query, capturing the database name
+var useRegex = regexp.MustCompile(`(?i)^\s*use\s+` + "`?" + `([^` + "`" + `\s;]+)` + "`?" + `\s*;?\s*$`)
+
+// HandleUse handles USE <db> sent as a query rather than COM_INIT_DB, which it otherwise mirrors
+func (qh *QueryHandlers) HandleUse(query string) (*mysql.Result, error) {
+	matches := useRegex.FindStringSubmatch(query)
+	if err := qh.handler.UseDB(matches[1]); err != nil {
+		return nil, err
+	}
+	return mysql.NewResult(nil), nil
+}
+
+// selectVariableItem matches one item of a variable-only SELECT: a user or system variable, the
+// latter with an optional scope, and an optional alias. The groups are the @ or @@ prefix, the
+// scope, the name and the alias.
+const selectVariableItem = `(@@|@)(?:(session|local|global)\.)?(\w+)(?:\s+(?:as\s+)?(\w+|` + "`[^`]*`" + `|'[^']*'|"[^"]*"))?`
+
+// selectVariableRegex matches a SELECT of nothing but variables, such as SELECT @@version_comment
+// LIMIT 1 or SELECT @idx AS tenant, @@time_zone. A SELECT that also reads columns or calls
+// functions is left to SQLite.
+var selectVariableRegex = regexp.MustCompile(`(?i)^\s*select\s+` + selectVariableItem + `(?:\s*,\s*` + selectVariableItem + `)*(?:\s+limit\s+\d+)?\s*;?\s*$`)
+
+// selectVariableItemRegex matches each item of a variable-only SELECT
+var selectVariableItemRegex = regexp.MustCompile(`(?i)` + selectVariableItem)
+
+// selectVariableLimitRegex matches the LIMIT clause ending a variable-only SELECT
+var selectVariableLimitRegex = regexp.MustCompile(`(?i)\s+limit\s+\d+\s*;?\s*$`)
+
+// isSessionStatement reports whether query only manages the session rather than touching tenant
+// data: SET, USE, SHOW VARIABLES or a SELECT of variables such as @@version_comment
+func isSessionStatement(query string) bool {
+	switch {
+	case setStatementRegex.MatchString(query), setTransactionRegex.MatchString(query), useRegex.MatchString(query):
+		return true
+	case selectVariableRegex.MatchString(query):
+		return true
+	}
+	fields := strings.Fields(strings.ToLower(query))
+	return len(fields) >= 2 && fields[0] == "show" && (fields[1] == "variables" ||
+		(len(fields) >= 3 && (fields[1] == "session" || fields[1] == "global") && fields[2] == "variables"))
+}
+
+// killRegex matches KILL [CONNECTION | QUERY] processlist_id
+var killRegex = regexp.MustCompile(`(?i)^\s*kill\s+(?:(connection|query)\s+)?(\d+)\s*;?\s*$`)
+
+// HandleKill handles KILL QUERY, which interrupts the statement a connection is running and
+// leaves the connection open, and KILL [CONNECTION], which closes the connection as well.
+// Killing a connection that is idle is not an error. Only connections on the caller's own tenant
+// may be killed, unless the caller has access to every tenant; every attempt is logged and audited.
+func (qh *QueryHandlers) HandleKill(query string) (*mysql.Result, error) {
+	matches := killRegex.FindStringSubmatch(query)
+	id, err := strconv.ParseUint(matches[2], 10, 32)
+	if err != nil {
+		return nil, mysql.NewError(mysql.ER_NO_SUCH_THREAD, fmt.Sprintf("Unknown thread id: %s", matches[2]))
+	}
+	
+	session, exists := qh.handler.sessionManager.GetSession(uint32(id))
+	if !exists {
+		return nil, mysql.NewError(mysql.ER_NO_SUCH_THREAD, fmt.Sprintf("Unknown thread id: %d", id))
+	}
+	
+	caller := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	target := session.CurrentTenant()
+	if err := qh.authorizeKill(caller, session, uint32(id)); err != nil {
+		qh.handler.logWithIdx("Refused to kill connection %d of idx %s: %v", id, target, err)
+		qh.auditKill(caller, target, query, err)
+		return nil, err
+	}
+	
+	if strings.EqualFold(matches[1], "query") {
+		if session.CancelStatement() {
+			qh.handler.logWithIdx("Interrupted the statement running on connection %d of idx %s", id, target)
+		}
+		qh.auditKill(caller, target, query, nil)
+		return mysql.NewResult(nil), nil
+	}
+	
+	qh.handler.logWithIdx("Killing connection %d of idx %s", id, target)
+	qh.auditKill(caller, target, query, nil)
+	session.CloseConnection()
+	return mysql.NewResult(nil), nil
+}
+
+// authorizeKill returns MySQL's "not owner of thread" error unless caller may kill connection
+// id of session: both are on the same tenant, or the caller may use every tenant
+func (qh *QueryHandlers) authorizeKill(caller, session *SessionVariables, id uint32) error {
+	if caller == session || tenantOrDefault(caller.CurrentTenant()) == tenantOrDefault(session.CurrentTenant()) {
+		return nil
+	}
+	if cfg := qh.handler.Config(); cfg != nil && cfg.MayUseAnyTenant(tenantPrefixCredentials{}.unprefixed(caller.Username())) {
+		return nil
+	}
+	return mysql.NewError(mysql.ER_KILL_DENIED_ERROR, fmt.Sprintf("You are not owner of thread %d", id))
+}
+
+// tenantOrDefault returns tenant, or "default" for the default database's empty idx
+func tenantOrDefault(tenant string) string {
+	if tenant == "" {
+		return "default"
+	}
+	return tenant
+}
+
+// auditKill records a KILL by caller of a connection on tenant in the audit log
+func (qh *QueryHandlers) auditKill(caller *SessionVariables, tenant, query string, err error) {
+	entry := audit.Entry{
+		Actor:  caller.Host(),
+		Action: audit.ActionConnectionKill,
+		Target: tenantOrDefault(tenant),
+		Result: audit.ResultSuccess,
+		Detail: fmt.Sprintf("%s from connection %d", strings.Join(strings.Fields(query), " "), qh.handler.currentConnection()),
+	}
+	if err != nil {
+		entry.Result = audit.ResultFailure
+		entry.Detail += ": " + err.Error()
+	}
+	if auditErr := qh.handler.auditLog.Write(entry); auditErr != nil {
+		qh.handler.logger.Printf("Failed to write audit entry for KILL: %v", auditErr)
+	}
+}
+
+// countWithoutLimit records the number of rows a SQL_CALC_FOUND_ROWS query would have returned
+// without its trailing LIMIT. Queries without a trailing LIMIT keep the returned row count. args
+// are the query's prepared-statement arguments, of which those in the LIMIT are left out.
+//
+// SQLite cannot report the rows a LIMIT skipped, so the query runs again as SELECT COUNT(*) over
+// it, after the limited read and outside it: each SQL_CALC_FOUND_ROWS select costs about twice
+// the plain query, and the count can include rows written between the two reads.
+func (qh *QueryHandlers) countWithoutLimit(query string, args []interface{}) {
+	matches := trailingLimitRegex.FindStringSubmatch(query)
+	if len(matches) != 2 {
+		return
+	}
+	
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	db, err := qh.handler.databaseManager.GetDatabaseForSession(session)
+	if err != nil {
+		return
+	}
+	
+	ctx, cancel := qh.handler.statementContext()
+	defer cancel()
+	
+	var total int64
+	if bound := countPlaceholders(matches[1]); bound < len(args) {
+		args = args[:bound]
+	}
+	if err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM ("+matches[1]+")", sqliteArgs(args)...).Scan(&total); err != nil {
+		qh.handler.logWithIdx("Could not count rows for FOUND_ROWS(), using returned row count: %v", err)
+		return
+	}
+	session.SetFoundRows(total)
+}
+
+// tableMaintenanceRegex matches ANALYZE TABLE and OPTIMIZE TABLE with an optional NO_WRITE_TO_BINLOG
+// or LOCAL modifier, capturing the operation and the table list
+var tableMaintenanceRegex = regexp.MustCompile(`(?is)^\s*(analyze|optimize)\s+(?:(?:no_write_to_binlog|local)\s+)?tables?\s+(.+?)\s*;?\s*$`)
+
+// HandleTableMaintenance handles ANALYZE TABLE and OPTIMIZE TABLE. SQLite has no per-table
+// optimize, so both refresh the query planner statistics with ANALYZE. The result has MySQL's
+// Table, Op, Msg_type, Msg_text shape with one status row per table.
+func (qh *QueryHandlers) HandleTableMaintenance(query string) (*mysql.Result, error) {
+	matches := tableMaintenanceRegex.FindStringSubmatch(query)
+	if len(matches) != 3 {
+		return nil, mysql.NewError(mysql.ER_PARSE_ERROR, "You have an error in your SQL syntax near 'TABLE'")
+	}
+	op := strings.ToLower(matches[1])
+	
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	db, err := qh.handler.databaseManager.GetDatabaseForSession(session)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %v", err)
+	}
+	
+	dbName := "multitenant_db"
+	if idx := session.CurrentTenant(); idx != "" && idx != "default" {
+		dbName = fmt.Sprintf("multitenant_db_idx_%s", idx)
+	}
+	
+	ctx, cancel := qh.handler.statementContext()
+	defer cancel()
+	
+	names := []string{"Table", "Op", "Msg_type", "Msg_text"}
+	var values [][]interface{}
+	for _, name := range strings.Split(matches[2], ",") {
+		// Tables always live in the session's database, so a schema qualifier is dropped
+		name = strings.TrimSpace(name)
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			name = name[dot+1:]
+		}
+		table := dbName + "." + strings.Trim(name, "`\"'")
+		
+		stored, err := resolveTableName(db, name)
+		if err != nil {
+			values = append(values,
+				[]interface{}{table, op, "Error", fmt.Sprintf("Table '%s' doesn't exist", table)},
+				[]interface{}{table, op, "status", "Operation failed"})
+			continue
+		}
+		table = dbName + "." + stored
+		
+		if _, err := db.ExecContext(ctx, "ANALYZE \""+strings.ReplaceAll(stored, "\"", "\"\"")+"\""); err != nil {
+			values = append(values,
+				[]interface{}{table, op, "Error", err.Error()},
+				[]interface{}{table, op, "status", "Operation failed"})
+			continue
+		}
+		values = append(values, []interface{}{table, op, "status", "OK"})
+	}
+	
+	resultset, err := mysql.BuildSimpleTextResultset(names, values)
+	if err != nil {
+		return nil, err
+	}
+	
+	return mysql.NewResult(resultset), nil
+}
+
+// flushRegex matches the FLUSH and RESET statements admin tools and connectors send during setup
+// and maintenance: FLUSH PRIVILEGES, STATUS, HOSTS, the LOGS variants, TABLES with an optional
+// table list or WITH READ LOCK, QUERY CACHE, and RESET QUERY CACHE
+var flushRegex = regexp.MustCompile(`(?is)^\s*(?:flush\s+(?:(?:no_write_to_binlog|local)\s+)?(?:privileges|status|hosts|user_resources|optimizer_costs|query\s+cache|(?:(?:binary|engine|error|general|relay|slow)\s+)?logs|tables?(?:\s+.+?)?)|reset\s+query\s+cache)\s*;?\s*$`)
+
+// HandleFlush handles FLUSH and RESET statements by returning OK. SQLite has no grant tables,
+// query cache or server logs to flush, and writes go straight to the database file.
+func (qh *QueryHandlers) HandleFlush(query string) (*mysql.Result, error) {
+	qh.handler.logWithIdx("Ignoring %s, there is nothing to flush in SQLite", strings.Join(strings.Fields(query), " "))
+	return mysql.NewResult(nil), nil
+}
+
+// callRegex matches CALL name or CALL name(args), capturing the procedure name and raw arguments
+var callRegex = regexp.MustCompile(`(?is)^\s*call\s+` + "`?" + `(\w+)` + "`?" + `\s*(?:\((.*)\))?\s*;?\s*$`)
+
+// builtinProcedures are the procedures CALL can run, keyed by lowercase name. There is no
+// CREATE PROCEDURE support; anything else is reported as a missing procedure.
+var builtinProcedures = map[string]func(qh *QueryHandlers, idx string, args []string) (*mysql.Result, error){
+	"truncate_tenant":  callTruncateTenant,
+	"seed_sample_data": callSeedSampleData,
+}
+
+// writingProcedures are the built-in procedures that change the tenant's data, which a read only
+// session or transaction may not CALL
+var writingProcedures = map[string]bool{
+	"truncate_tenant":  true,
+	"seed_sample_data": true,
+}
+
+// HandleCall handles CALL statements by running a built-in procedure against the session's
+// tenant, returning MySQL's "procedure does not exist" error for anything else
+func (qh *QueryHandlers) HandleCall(query string) (*mysql.Result, error) {
+	matches := callRegex.FindStringSubmatch(query)
+	if len(matches) != 3 {
+		return nil, mysql.NewError(mysql.ER_PARSE_ERROR, "You have an error in your SQL syntax near 'CALL'")
+	}
+	name := matches[1]
+	
+	var args []string
+	if raw := strings.TrimSpace(matches[2]); raw != "" {
+		for _, arg := range strings.Split(raw, ",") {
+			args = append(args, strings.Trim(strings.TrimSpace(arg), `'"`))
+		}
+	}
+	
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	idx := session.CurrentTenant()
+	
+	procedure, exists := builtinProcedures[strings.ToLower(name)]
+	if !exists {
+		dbName := "multitenant_db"
+		if idx != "" && idx != "default" {
+			dbName = fmt.Sprintf("multitenant_db_idx_%s", idx)
+		}
+		return nil, mysql.NewError(mysql.ER_SP_DOES_NOT_EXIST, fmt.Sprintf("PROCEDURE %s.%s does not exist", dbName, name))
+	}
+	if session.ReadOnly() && writingProcedures[strings.ToLower(name)] {
+		return nil, mysql.NewError(mysql.ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION, "Cannot execute statement in a READ ONLY transaction.")
+	}
+	
+	// Make sure the tenant's database exists before the procedure touches it
+	if _, err := qh.handler.databaseManager.GetDatabaseForSession(session); err != nil {
+		return nil, fmt.Errorf("failed to get database: %v", err)
+	}
+	return procedure(qh, idx, args)
+}
+
+// callTruncateTenant implements CALL truncate_tenant([reset_sequences]), returning the truncated tables
+func callTruncateTenant(qh *QueryHandlers, idx string, args []string) (*mysql.Result, error) {
+	if len(args) > 1 {
+		return nil, mysql.NewError(mysql.ER_SP_WRONG_NO_OF_ARGS, fmt.Sprintf("Incorrect number of arguments for PROCEDURE truncate_tenant; expected 0 or 1, got %d", len(args)))
+	}
+	resetSequences := false
+	if len(args) == 1 {
+		reset, err := strconv.ParseBool(strings.ToLower(args[0]))
+		if err != nil {
+			return nil, mysql.NewError(mysql.ER_WRONG_VALUE_FOR_VAR, fmt.Sprintf("Invalid reset_sequences value '%s' for PROCEDURE truncate_tenant", args[0]))
+		}
+		resetSequences = reset
+	}
+	
+	tables, err := qh.handler.databaseManager.TruncateDatabase(idx, resetSequences)
+	if errors.Is(err, ErrDestructiveStatement) {
+		qh.handler.logWithIdx("Rejected CALL truncate_tenant: %v", err)
+		return nil, destructiveBlockedError()
+	}
+	if err != nil {
+		return nil, err
+	}
+	
+	values := make([][]interface{}, 0, len(tables))
+	for _, table := range tables {
+		values = append(values, []interface{}{table})
+	}
+	resultset, err := mysql.BuildSimpleTextResultset([]string{"truncated_table"}, values)
+	if err != nil {
+		return nil, err
+	}
+	return mysql.NewResult(resultset), nil
+}
+
+// callSeedSampleData implements CALL seed_sample_data(), returning the sample row count per table
+func callSeedSampleData(qh *QueryHandlers, idx string, args []string) (*mysql.Result, error) {
+	if len(args) != 0 {
+		return nil, mysql.NewError(mysql.ER_SP_WRONG_NO_OF_ARGS, fmt.Sprintf("Incorrect number of arguments for PROCEDURE seed_sample_data; expected 0, got %d", len(args)))
+	}
+	
+	counts, err := qh.handler.databaseManager.SeedSampleData(idx)
+	if err != nil {
+		return nil, err
+	}
+	
+	values := make([][]interface{}, 0, len(sampleTables))
+	for _, table := range sampleTables {
+		values = append(values, []interface{}{table, counts[table]})
+	}
+	resultset, err := mysql.BuildSimpleTextResultset([]string{"table_name", "row_count"}, values)
+	if err != nil {
+		return nil, err
+	}
+	return mysql.NewResult(resultset), nil
+}
@@ -0,0 +1,163 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"multitenant-db/internal/config"
+)
+
+// loadBatchSize is how many rows LoadRows inserts per transaction
+const loadBatchSize = 1000
+
+// ErrInvalidLoad is returned by LoadRows when the target table or one of the columns does not exist
+var ErrInvalidLoad = errors.New("invalid load target")
+
+// LoadRowError reports a row LoadRows could not insert
+type LoadRowError struct {
+	Row     int    // Row number the source gave for the row
+	Message string // Why it was rejected
+}
+
+// LoadRowSource yields the rows to load one at a time: the row's number for error reports and one
+// value per column. It returns io.EOF after the last row.
+type LoadRowSource func() (int, []interface{}, error)
+
+// loadRow is a row read from a LoadRowSource
+type loadRow struct {
+	number int
+	values []interface{}
+}
+
+// LoadRows bulk-inserts the rows from next into table of the existing database for idx, opening
+// it when the tenant store has persisted it. Rows are read and inserted loadBatchSize to a
+// transaction with one prepared statement, which is far faster than a transaction per row and
+// holds only one batch in memory. A row that fails, e.g. on a constraint, is reported and skipped
+// while the rest of its batch still loads. An error from next ends the load, keeping the batches
+// already committed, and is wrapped in the returned error. It returns the number of rows loaded.
+func (dm *DatabaseManager) LoadRows(idx, table string, columns []string, next LoadRowSource) (int64, []LoadRowError, error) {
+	if idx == "" {
+		idx = "default"
+	}
+
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+	db, exists, err := dm.openDatabase(idx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to open database for idx %s: %v", idx, err)
+	}
+	if !exists {
+		return 0, nil, fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return 0, nil, fmt.Errorf("loading into a MySQL default database is not supported")
+	}
+	if len(columns) == 0 {
+		return 0, nil, fmt.Errorf("%w: no columns to load", ErrInvalidLoad)
+	}
+	if strings.EqualFold(table, colocatedQueryLogTable) {
+		return 0, nil, fmt.Errorf("%w: table %s is reserved for the query log", ErrInvalidLoad, table)
+	}
+
+	// Check the table and columns up front, so a typo is one clear error rather than one per row
+	tableColumns, err := db.Query("SELECT name FROM pragma_table_info(?)", table)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read columns of table %s in idx %s: %v", table, idx, err)
+	}
+	known := make(map[string]bool)
+	for tableColumns.Next() {
+		var name string
+		if err := tableColumns.Scan(&name); err != nil {
+			tableColumns.Close()
+			return 0, nil, fmt.Errorf("failed to scan column of table %s: %v", table, err)
+		}
+		known[strings.ToLower(name)] = true
+	}
+	tableColumns.Close()
+	if len(known) == 0 {
+		return 0, nil, fmt.Errorf("%w: table %s does not exist in idx %s", ErrInvalidLoad, table, idx)
+	}
+	quotedColumns := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	for i, column := range columns {
+		if !known[strings.ToLower(column)] {
+			return 0, nil, fmt.Errorf("%w: table %s has no column %s", ErrInvalidLoad, table, column)
+		}
+		quotedColumns[i] = "\"" + strings.ReplaceAll(column, "\"", "\"\"") + "\""
+		placeholders[i] = "?"
+	}
+	insertSQL := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", "\""+strings.ReplaceAll(table, "\"", "\"\"")+"\"",
+		strings.Join(quotedColumns, ", "), strings.Join(placeholders, ", "))
+
+	var loaded int64
+	var rowErrors []LoadRowError
+	batch := make([]loadRow, 0, loadBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		batchLoaded, batchErrors, err := loadBatch(db, insertSQL, batch)
+		if err != nil {
+			return fmt.Errorf("failed to load rows %d to %d into %s for idx %s: %v", batch[0].number, batch[len(batch)-1].number, table, idx, err)
+		}
+		loaded += batchLoaded
+		rowErrors = append(rowErrors, batchErrors...)
+		batch = batch[:0]
+		return nil
+	}
+	for {
+		number, values, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return loaded, rowErrors, fmt.Errorf("failed to read rows to load into %s for idx %s: %w", table, idx, err)
+		}
+		batch = append(batch, loadRow{number: number, values: values})
+		if len(batch) == loadBatchSize {
+			if err := flush(); err != nil {
+				return loaded, rowErrors, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return loaded, rowErrors, err
+	}
+
+	dm.logger.Printf("Loaded %d rows into %s for idx %s, %d rejected", loaded, table, idx, len(rowErrors))
+	return loaded, rowErrors, nil
+}
+
+// loadBatch inserts rows on one transaction
+func loadBatch(db *sql.DB, insertSQL string, rows []loadRow) (int64, []LoadRowError, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(insertSQL)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer insert.Close()
+
+	var loaded int64
+	var rowErrors []LoadRowError
+	for _, row := range rows {
+		if _, err := insert.Exec(row.values...); err != nil {
+			rowErrors = append(rowErrors, LoadRowError{Row: row.number, Message: err.Error()})
+			continue
+		}
+		loaded++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, nil, err
+	}
+	return loaded, rowErrors, nil
+}
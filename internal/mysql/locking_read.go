@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"regexp"
+	"unicode/utf8"
+)
+
+// lockingClauseRegex matches the locking clause ending a SELECT once quoted text has been blanked
+// out: FOR UPDATE or FOR SHARE with their OF, NOWAIT and SKIP LOCKED options, or the older
+// LOCK IN SHARE MODE
+var lockingClauseRegex = regexp.MustCompile(`(?is)\s+(?:for\s+(?:update|share)(?:\s+of\s+[^;]+?)?(?:\s+(?:nowait|skip\s+locked))?|lock\s+in\s+share\s+mode)\s*;?\s*$`)
+
+// stripLockingClause removes the locking clause ORMs append to a SELECT, which SQLite rejects,
+// and reports whether there was one
+func stripLockingClause(query string) (string, bool) {
+	switch statementKeyword(query) {
+	case "select", "with":
+	default:
+		return query, false
+	}
+
+	blanked := blankQuoted(query)
+	loc := lockingClauseRegex.FindStringIndex(blanked)
+	if loc == nil {
+		return query, false
+	}
+	// Blanking replaces each quoted character with one space, so count characters rather than
+	// bytes to find where the clause starts in the original query
+	runes := []rune(query)
+	return string(runes[:utf8.RuneCountInString(blanked[:loc[0]])]), true
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"time"
+)
+
+// DatabasesModifiedAt returns when a database was last created or removed, so the list of
+// databases can be served with HTTP cache validators
+func (dm *DatabaseManager) DatabasesModifiedAt() time.Time {
+	dm.modMu.Lock()
+	defer dm.modMu.Unlock()
+	return dm.databasesModified
+}
+
+// SchemaModifiedAt returns when the schema of the database for idx last changed: when it was
+// created, seeded or altered by DDL. It returns false when the database does not exist.
+func (dm *DatabaseManager) SchemaModifiedAt(idx string) (time.Time, bool) {
+	if idx == "" {
+		idx = "default"
+	}
+
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	_, exists := dm.databases[idx]
+	dm.dbMu.RUnlock()
+	if !exists {
+		return time.Time{}, false
+	}
+
+	dm.modMu.Lock()
+	defer dm.modMu.Unlock()
+	if modified, ok := dm.schemaModified[idx]; ok {
+		return modified, true
+	}
+	return dm.databasesModified, true
+}
+
+// markDatabasesModified records that a database was created or removed. dbMu may be held.
+func (dm *DatabaseManager) markDatabasesModified() {
+	dm.modMu.Lock()
+	defer dm.modMu.Unlock()
+	dm.databasesModified = dm.now()
+}
+
+// markSchemaModified records that the schema of the database for idx changed, resolving
+// aliases. dbMu must not be held.
+func (dm *DatabaseManager) markSchemaModified(idx string) {
+	if idx == "" {
+		idx = "default"
+	}
+
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+
+	dm.markSchemaModifiedLocked(idx)
+}
+
+// markSchemaModifiedLocked records that the schema of the database for the already resolved idx
+// changed. dbMu may be held.
+func (dm *DatabaseManager) markSchemaModifiedLocked(idx string) {
+	dm.modMu.Lock()
+	defer dm.modMu.Unlock()
+	dm.schemaModified[idx] = dm.now()
+	dm.schemaVersion.Add(1)
+}
+
+// forgetModified drops the schema modification time of a removed database and records that the
+// list of databases changed. dbMu may be held.
+func (dm *DatabaseManager) forgetModified(idx string) {
+	dm.modMu.Lock()
+	defer dm.modMu.Unlock()
+	delete(dm.schemaModified, idx)
+	dm.databasesModified = dm.now()
+	dm.schemaVersion.Add(1)
+	dm.forgetColumnTypes(idx)
+}
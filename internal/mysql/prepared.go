@@ -0,0 +1,48 @@
+package mysql
+
+import (
+	"strconv"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// preparedStatement is a statement a client prepared, kept on its session until it is closed
+type preparedStatement struct {
+	query  string
+	params int // Number of ? parameters each execution binds
+}
+
+// prepareStatement keeps query, with its parameter count, among the session's prepared
+// statements and returns its statement ID. IDs count up from 1 on each connection, so
+// statements prepared by different clients never collide.
+func (sv *SessionVariables) prepareStatement(query string, params int) uint32 {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if sv.stmts == nil {
+		sv.stmts = make(map[uint32]*preparedStatement)
+	}
+	sv.lastStmtID++
+	sv.stmts[sv.lastStmtID] = &preparedStatement{query: query, params: params}
+	return sv.lastStmtID
+}
+
+// preparedStatement returns the statement prepared on the session under id
+func (sv *SessionVariables) preparedStatement(id uint32) (*preparedStatement, bool) {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	stmt, ok := sv.stmts[id]
+	return stmt, ok
+}
+
+// closeStatement releases the statement prepared on the session under id
+func (sv *SessionVariables) closeStatement(id uint32) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	delete(sv.stmts, id)
+}
+
+// unknownStatementError is MySQL's error for executing a statement that was never prepared on the
+// connection or has been closed
+func unknownStatementError(id uint32, command string) error {
+	return mysql.NewDefaultError(mysql.ER_UNKNOWN_STMT_HANDLER, 5, strconv.FormatUint(uint64(id), 10), command)
+}
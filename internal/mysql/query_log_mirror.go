@@ -0,0 +1,88 @@
+package mysql
+
+import (
+	"encoding/json"
+	"log"
+	"sync/atomic"
+)
+
+// queryLogMirrorBuffer is how many entries may wait to be mirrored before new ones are dropped
+const queryLogMirrorBuffer = 1024
+
+// queryLogMirror writes query log entries to a logger from a goroutine of its own, so a slow
+// sink never holds up the statements being logged
+type queryLogMirror struct {
+	entries chan QueryLogEntry
+	dropped atomic.Int64 // Entries dropped because the buffer was full, since last reported
+	stop    chan struct{}
+	done    chan struct{} // Closed once run has returned
+}
+
+// MirrorTo also writes every logged query to logger as one structured line, for shipping to
+// centralized logging. A *log.Logger from log/syslog sends them to syslog. Lines are written in
+// the background; when the sink falls behind, entries are dropped and the number dropped is
+// reported instead. Calling it again has no effect.
+func (ql *QueryLogger) MirrorTo(logger *log.Logger) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	if ql.mirror != nil {
+		return
+	}
+
+	mirror := &queryLogMirror{
+		entries: make(chan QueryLogEntry, queryLogMirrorBuffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	ql.mirror = mirror
+	go mirror.run(logger)
+}
+
+// run writes mirrored entries to logger until the mirror is stopped, then writes the entries
+// still queued
+func (m *queryLogMirror) run(logger *log.Logger) {
+	defer close(m.done)
+	for {
+		select {
+		case entry := <-m.entries:
+			m.write(logger, entry)
+		case <-m.stop:
+			for {
+				select {
+				case entry := <-m.entries:
+					m.write(logger, entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write writes one entry to logger, reporting any entries dropped before it
+func (m *queryLogMirror) write(logger *log.Logger, entry QueryLogEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		logger.Printf("Failed to encode query log entry: %v", err)
+		return
+	}
+	logger.Printf("query_log %s", line)
+	if dropped := m.dropped.Swap(0); dropped > 0 {
+		logger.Printf("query_log dropped %d entries, the log sink is falling behind", dropped)
+	}
+}
+
+// close stops the mirror and waits for the queued entries to be written
+func (m *queryLogMirror) close() {
+	close(m.stop)
+	<-m.done
+}
+
+// send queues entry for mirroring without waiting, dropping it when the buffer is full
+func (m *queryLogMirror) send(entry QueryLogEntry) {
+	select {
+	case m.entries <- entry:
+	default:
+		m.dropped.Add(1)
+	}
+}
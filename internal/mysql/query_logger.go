@@ -1,12 +1,24 @@
 package mysql
 
 import (
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
-	"math/rand"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
 )
 
 // QueryLogEntry represents a single query log entry
@@ -19,29 +31,116 @@ type QueryLogEntry struct {
 	Success     bool      `json:"success"`
 	ErrorMsg    string    `json:"error_message,omitempty"`
 	ConnectionID string   `json:"connection_id"`
+	Explain     string    `json:"explain,omitempty"` // EXPLAIN QUERY PLAN of a slow statement, when captured
+}
+
+// queryLogTable is the table holding the entries of a separate log database
+const queryLogTable = "query_logs"
+
+// colocatedQueryLogTable is the table holding a tenant's entries inside its own database
+const colocatedQueryLogTable = "__query_logs"
+
+// userTablesFilter restricts a sqlite_master query to the tables of the tenant's own, leaving out
+// SQLite's internal tables and the colocated query log
+const userTablesFilter = "name NOT LIKE 'sqlite_%' AND name <> '" + colocatedQueryLogTable + "'"
+
+// queryLogTableRegex matches a reference to the colocated query log table, quoted or not
+var queryLogTableRegex = regexp.MustCompile("(?i)(?:^|[^\\w$])" + colocatedQueryLogTable + "(?:$|[^\\w$])")
+
+// writesQueryLog reports whether query changes the colocated query log table or its schema,
+// which tenants may read but never rewrite, empty or drop
+func writesQueryLog(query string) bool {
+	for _, statement := range splitStatements(blankComments(query)) {
+		if isWriteStatement(statement) && queryLogTableRegex.MatchString(statement) {
+			return true
+		}
+	}
+	return false
 }
 
+// queryLogAccessDeniedError is the MySQL error for a statement writing to the query log table
+func queryLogAccessDeniedError(query string) error {
+	command := strings.ToUpper(statementKeyword(blankComments(query)))
+	return mysql.NewError(mysql.ER_TABLEACCESS_DENIED_ERROR,
+		fmt.Sprintf("%s command denied for table '%s'", command, colocatedQueryLogTable))
+}
+
+// queryLogIndexes lists the indexes every query log table should have, keyed by index name, with
+// the columns they cover
+var queryLogIndexes = map[string]string{
+	"idx_tenant_executed_at":         "tenant_id, executed_at",
+	"idx_connection_id":              "connection_id",
+	"idx_tenant_success_executed_at": "tenant_id, success, executed_at",
+	"idx_tenant_duration":            "tenant_id, duration_ms",
+}
+
+// queryLogColumns lists the query log columns added after the table was first released, keyed
+// by column name, with the definition log tables created by older versions are migrated with
+var queryLogColumns = map[string]string{
+	"explain": "explain TEXT",
+}
+
+// logIndexName returns the name of a query log index on table. Indexes of a colocated table are
+// prefixed with its name, so they cannot clash with the tenant's own indexes.
+func logIndexName(table, index string) string {
+	if table == queryLogTable {
+		return index
+	}
+	return table + "_" + index
+}
+
+// ColocatedDatabaseFunc returns the SQLite database of a tenant to keep its query log in, and
+// false when the tenant has none open
+type ColocatedDatabaseFunc func(tenantID string) (*sql.DB, bool)
+
 // QueryLogger manages query logging for all tenants
 type QueryLogger struct {
-	logDatabases map[string]*sql.DB // key is tenant ID, value is log DB connection
-	dbMu         sync.RWMutex
-	logger       *log.Logger
-	logDir       string // Directory for log databases, empty means use in-memory
-	instanceID   int64  // Unique instance ID to avoid cross-test pollution
+	logDatabases    map[string]*sql.DB // key is tenant ID, value is log DB connection
+	dbMu            sync.RWMutex
+	logger          *log.Logger
+	logDir          string // Directory for log databases, empty means use in-memory
+	shardLevels     int    // Levels of hash-named subdirectories log databases are spread over (0 keeps them flat)
+	instanceID      int64  // Unique instance ID to avoid cross-test pollution
+	counters        map[string]*queryCounter // key is tenant ID, guarded by dbMu
+	lastAccess      map[string]*atomic.Int64 // key is tenant ID, value is last time (UnixNano) the log DB was used
+	maxLogDatabases int                      // Cap on open log databases, evicting the least recently used (0 disables)
+	mirror          *queryLogMirror          // Optional real-time copy of each entry, guarded by dbMu
+	colocate        ColocatedDatabaseFunc    // Optional source of tenant databases to keep logs in, guarded by dbMu
+	colocated       map[string]bool          // Tenants whose entry in logDatabases is their own database, guarded by dbMu
+	inUse           map[*sql.DB]int          // Callers currently using each log database, guarded by dbMu
+	retired         map[*sql.DB]bool         // Log databases evicted while in use, closed by their last user; guarded by dbMu
+}
+
+// queryCounter tracks how many queries a tenant has logged without touching its log database
+type queryCounter struct {
+	count  atomic.Int64
+	lastAt atomic.Int64 // UnixNano of the most recent logged query, 0 if none
 }
 
+// queryLoggerInstances hands out process-unique instance IDs, so in-memory log databases of
+// different loggers never share a shared-cache name
+var queryLoggerInstances atomic.Int64
+
 // NewQueryLogger creates a new query logger
 func NewQueryLogger(logger *log.Logger, logDir string) *QueryLogger {
 	return &QueryLogger{
 		logDatabases: make(map[string]*sql.DB),
+		counters:     make(map[string]*queryCounter),
+		lastAccess:   make(map[string]*atomic.Int64),
+		colocated:    make(map[string]bool),
+		inUse:        make(map[*sql.DB]int),
+		retired:      make(map[*sql.DB]bool),
 		logger:       logger,
 		logDir:       logDir,
-		instanceID:   rand.Int63(), // Random instance ID to avoid test interference
+		instanceID:   queryLoggerInstances.Add(1),
 	}
 }
 
-// getOrCreateLogDatabase gets or creates a log database for the specified tenant
-func (ql *QueryLogger) getOrCreateLogDatabase(tenantID string) (*sql.DB, error) {
+// getOrCreateLogDatabase gets or creates the log database for the specified tenant and returns
+// it with the table its entries are kept in. With colocation, that is the tenant's own database
+// whenever it has one open. The caller must call release once done with the database: a log
+// database evicted while in use is only closed by its last user.
+func (ql *QueryLogger) getOrCreateLogDatabase(tenantID string) (db *sql.DB, table string, release func(), err error) {
 	ql.dbMu.Lock()
 	defer ql.dbMu.Unlock()
 
@@ -50,28 +149,148 @@ func (ql *QueryLogger) getOrCreateLogDatabase(tenantID string) (*sql.DB, error)
 		tenantID = "default"
 	}
 
-	// Check if log database already exists
+	if db, table, err = ql.openLogDatabaseLocked(tenantID); err != nil {
+		return nil, "", nil, err
+	}
+	ql.inUse[db]++
+	return db, table, func() { ql.releaseLogDatabase(db) }, nil
+}
+
+// releaseLogDatabase ends one use of db, closing it if it was evicted while in use
+func (ql *QueryLogger) releaseLogDatabase(db *sql.DB) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+
+	if ql.inUse[db]--; ql.inUse[db] > 0 {
+		return
+	}
+	delete(ql.inUse, db)
+	if ql.retired[db] {
+		delete(ql.retired, db)
+		if err := db.Close(); err != nil {
+			ql.logger.Printf("Error closing evicted log database: %v", err)
+		}
+	}
+}
+
+// openLogDatabaseLocked returns the open log database of tenantID and its table, opening it if
+// needed. Callers must hold dbMu for writing.
+func (ql *QueryLogger) openLogDatabaseLocked(tenantID string) (*sql.DB, string, error) {
+
+	var tenantDB *sql.DB
+	colocated := false
+	if ql.colocate != nil {
+		tenantDB, colocated = ql.colocate(tenantID)
+	}
+
+	// Check if log database already exists and is still where the tenant's logs belong: the
+	// tenant's database may have been opened, reopened or closed since
 	if db, exists := ql.logDatabases[tenantID]; exists {
-		return db, nil
+		if colocated == ql.colocated[tenantID] && (!colocated || db == tenantDB) {
+			ql.lastAccess[tenantID].Store(time.Now().UnixNano())
+			return db, ql.logTableLocked(tenantID), nil
+		}
+		ql.closeLogDatabaseLocked(tenantID)
 	}
 
-	// Create new SQLite database for query logs
-	// Use in-memory database if no logs directory is configured or in test mode
-	var dbPath string
-	if ql.logDir == "" {
-		// For in-memory databases, use a unique shared cache per instance to avoid test interference
-		dbPath = fmt.Sprintf("file:memdb_%d_%s?mode=memory&cache=shared&_fk=1", ql.instanceID, tenantID)
+	table := queryLogTable
+	var db *sql.DB
+	if colocated {
+		table = colocatedQueryLogTable
+		db = tenantDB
 	} else {
-		dbPath = fmt.Sprintf("%s/query_logs_%s.db", ql.logDir, tenantID)
+		ql.makeRoomLocked()
+
+		// Create new SQLite database for query logs
+		// Use in-memory database if no logs directory is configured or in test mode
+		var dbPath string
+		if ql.logDir == "" {
+			// For in-memory databases, use a unique shared cache per instance to avoid test interference
+			// The name is escaped so a ? or / in the tenant ID can't end it early or make it a file path
+			dbPath = fmt.Sprintf("file:memdb_%d_%s?mode=memory&cache=shared&_fk=1", ql.instanceID, url.PathEscape(tenantID))
+		} else {
+			var err error
+			var path string
+			if path, err = ql.prepareLogPath(tenantID); err != nil {
+				return nil, "", fmt.Errorf("failed to prepare log database for tenant %s: %v", tenantID, err)
+			}
+			dbPath = fileURI(path)
+		}
+		var err error
+		db, err = sql.Open("sqlite3", dbPath)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to create log database for tenant %s: %v", tenantID, err)
+		}
 	}
-	db, err := sql.Open("sqlite3", dbPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create log database for tenant %s: %v", tenantID, err)
+
+	// The tenant's own database is never ours to close
+	closeOnError := func() {
+		if !colocated {
+			db.Close()
+		}
+	}
+
+	if err := ql.ensureLogTable(db, table, tenantID); err != nil {
+		closeOnError()
+		return nil, "", err
+	}
+
+	// Seed the query counter from any rows already in the database
+	counter := &queryCounter{}
+	var count int64
+	if err := db.QueryRow("SELECT COUNT(*) FROM " + table).Scan(&count); err == nil && count > 0 {
+		counter.count.Store(count)
+		var lastAt time.Time
+		if err := db.QueryRow("SELECT executed_at FROM " + table + " ORDER BY id DESC LIMIT 1").Scan(&lastAt); err == nil {
+			counter.lastAt.Store(lastAt.UnixNano())
+		}
+	}
+	ql.counters[tenantID] = counter
+
+	ql.logDatabases[tenantID] = db
+	access := &atomic.Int64{}
+	access.Store(time.Now().UnixNano())
+	ql.lastAccess[tenantID] = access
+	if colocated {
+		ql.colocated[tenantID] = true
+		ql.logger.Printf("Keeping query log for tenant %s in its own database", tenantID)
+	} else {
+		ql.logger.Printf("Created query log database for tenant: %s", tenantID)
+	}
+	return db, table, nil
+}
+
+// hasLogDatabaseLocked reports whether tenantID has a log database, open or stored, without
+// creating one: the log table in its own database when colocated, otherwise a log database that is
+// open or, with a log directory, on disk in its shard or flat from before sharding. Callers must
+// hold dbMu for writing.
+func (ql *QueryLogger) hasLogDatabaseLocked(tenantID string) bool {
+	if ql.colocate != nil {
+		if tenantDB, colocated := ql.colocate(tenantID); colocated {
+			var name string
+			err := tenantDB.QueryRow("SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?", colocatedQueryLogTable).Scan(&name)
+			return err == nil
+		}
+	}
+	if _, open := ql.logDatabases[tenantID]; open {
+		return true
+	}
+	if ql.logDir == "" {
+		return false
+	}
+	for _, path := range []string{ql.logPath(tenantID), filepath.Join(ql.logDir, fmt.Sprintf("query_logs_%s.db", tenantID))} {
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
 	}
+	return false
+}
 
-	// Create the query_logs table
+// ensureLogTable creates the query log table in db if it is missing and brings its columns and
+// indexes up to date, which also migrates log databases created by older versions
+func (ql *QueryLogger) ensureLogTable(db *sql.DB, table string, tenantID string) error {
 	createTableSQL := `
-		CREATE TABLE IF NOT EXISTS query_logs (
+		CREATE TABLE IF NOT EXISTS ` + table + ` (
 			id INTEGER PRIMARY KEY AUTOINCREMENT,
 			tenant_id TEXT NOT NULL,
 			query TEXT NOT NULL,
@@ -80,67 +299,365 @@ func (ql *QueryLogger) getOrCreateLogDatabase(tenantID string) (*sql.DB, error)
 			success BOOLEAN NOT NULL,
 			error_message TEXT,
 			connection_id TEXT NOT NULL,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			explain TEXT
 		);
-		
-		CREATE INDEX IF NOT EXISTS idx_tenant_executed_at ON query_logs(tenant_id, executed_at);
-		CREATE INDEX IF NOT EXISTS idx_connection_id ON query_logs(connection_id);
 	`
 
 	if _, err := db.Exec(createTableSQL); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("failed to create query_logs table for tenant %s: %v", tenantID, err)
+		return fmt.Errorf("failed to create %s table for tenant %s: %v", table, tenantID, err)
+	}
+	if err := ql.ensureLogColumns(db, table, tenantID); err != nil {
+		return err
 	}
+	return ql.ensureLogIndexes(db, table, tenantID)
+}
 
-	ql.logDatabases[tenantID] = db
-	ql.logger.Printf("Created query log database for tenant: %s", tenantID)
-	return db, nil
+// SetColocatedDatabases keeps each tenant's query log in a __query_logs table of the tenant's
+// own database, as returned by colocate, so it is backed up and exported with the tenant's data.
+// Tenants without a database open, such as a default database on MySQL, keep using a separate
+// log database.
+func (ql *QueryLogger) SetColocatedDatabases(colocate ColocatedDatabaseFunc) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	ql.colocate = colocate
+}
+
+// ForgetClosedDatabase drops the logs kept in the database of idx, which has just been closed, so
+// the closed handle is never used again. Logs reached through an alias of idx are dropped as well:
+// every colocated log whose tenant no longer has that database open is forgotten.
+func (ql *QueryLogger) ForgetClosedDatabase(idx string) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	ql.forgetStaleColocatedLocked()
+}
+
+// forgetStaleColocatedLocked forgets every colocated log database that is no longer the tenant's
+// open database. Callers must hold dbMu for writing.
+func (ql *QueryLogger) forgetStaleColocatedLocked() {
+	if ql.colocate == nil {
+		return
+	}
+	for tenantID := range ql.colocated {
+		if tenantDB, ok := ql.colocate(tenantID); !ok || tenantDB != ql.logDatabases[tenantID] {
+			ql.logger.Printf("Forgetting query log of tenant %s, whose database was closed", tenantID)
+			ql.closeLogDatabaseLocked(tenantID)
+		}
+	}
+}
+
+// logTableLocked returns the table the log entries of an open log database are kept in. Callers
+// must hold dbMu.
+func (ql *QueryLogger) logTableLocked(tenantID string) string {
+	if ql.colocated[tenantID] {
+		return colocatedQueryLogTable
+	}
+	return queryLogTable
+}
+
+// closeLogDatabaseLocked forgets the log database of tenantID, closing it unless it is the
+// tenant's own database. One still in use is left to its last user to close. Callers must hold
+// dbMu for writing.
+func (ql *QueryLogger) closeLogDatabaseLocked(tenantID string) {
+	if db := ql.logDatabases[tenantID]; !ql.colocated[tenantID] {
+		if ql.inUse[db] > 0 {
+			ql.retired[db] = true
+		} else if err := db.Close(); err != nil {
+			ql.logger.Printf("Error closing log database for tenant %s: %v", tenantID, err)
+		}
+	}
+	delete(ql.logDatabases, tenantID)
+	delete(ql.lastAccess, tenantID)
+	delete(ql.counters, tenantID) // Seeded again from the stored rows if reopened
+	delete(ql.colocated, tenantID)
+}
+
+// queryLogShardWidth is how many hex digits of the tenant's hash name each shard directory
+const queryLogShardWidth = 2
+
+// SetShardLevels spreads file-backed log databases over levels of subdirectories named after
+// a hash of the tenant ID, e.g. logDir/3f/a2/query_logs_acme.db for two levels, so deployments
+// with thousands of tenants never put them all in one directory. 0 keeps them flat in logDir.
+// Log databases already open keep their path until reopened.
+func (ql *QueryLogger) SetShardLevels(levels int) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	ql.shardLevels = levels
+}
+
+// logPath returns where the log database of tenantID is stored on disk
+func (ql *QueryLogger) logPath(tenantID string) string {
+	dir := ql.logDir
+	sum := sha256.Sum256([]byte(tenantID))
+	digest := hex.EncodeToString(sum[:])
+	for level := 0; level < ql.shardLevels; level++ {
+		dir = filepath.Join(dir, digest[level*queryLogShardWidth:(level+1)*queryLogShardWidth])
+	}
+	return filepath.Join(dir, fmt.Sprintf("query_logs_%s.db", tenantID))
+}
+
+// prepareLogPath creates the shard directory of tenantID's log database and returns its path.
+// A log left flat in logDir from before sharding was enabled is moved into its shard.
+func (ql *QueryLogger) prepareLogPath(tenantID string) (string, error) {
+	// Tenant IDs set over MySQL aren't validated, and the ID becomes part of a file name
+	if strings.ContainsAny(tenantID, "/\\\x00") || strings.Contains(tenantID, "..") {
+		return "", fmt.Errorf("tenant ID %q cannot name a log file", tenantID)
+	}
+	path := ql.logPath(tenantID)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	if ql.shardLevels == 0 {
+		return path, nil
+	}
+
+	flat := filepath.Join(ql.logDir, fmt.Sprintf("query_logs_%s.db", tenantID))
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		if _, err := os.Stat(flat); err == nil {
+			// The journal and WAL files hold changes not yet in the database file, so they move
+			// with it, ahead of it so an interrupted move never leaves the database without them
+			for _, suffix := range []string{"-journal", "-wal", "-shm", ""} {
+				if err := os.Rename(flat+suffix, path+suffix); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return "", fmt.Errorf("failed to move %s into its shard: %v", flat+suffix, err)
+				}
+			}
+			ql.logger.Printf("Moved query log database for tenant %s to %s", tenantID, path)
+		}
+	}
+	return path, nil
+}
+
+// fileURI returns the SQLite URI of the database file at path. Opened as a plain file name, a ?
+// or # in the path would start the DSN's parameters, so each path element is escaped.
+func fileURI(path string) string {
+	elements := strings.Split(filepath.ToSlash(path), "/")
+	for i, element := range elements {
+		elements[i] = url.PathEscape(element)
+	}
+	return "file:" + strings.Join(elements, "/")
+}
+
+// SetMaxLogDatabases caps how many tenant log databases may be open at once (0 disables the
+// cap). At the cap, opening another closes the least recently used one.
+func (ql *QueryLogger) SetMaxLogDatabases(max int) {
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	ql.maxLogDatabases = max
+}
+
+// makeRoomLocked enforces the log database cap before a new log database is opened by closing
+// the least recently used ones. File-backed logs stay on disk and are reopened on next use;
+// in-memory logs are lost. Callers must hold dbMu for writing.
+func (ql *QueryLogger) makeRoomLocked() {
+	if ql.maxLogDatabases <= 0 {
+		return
+	}
+	
+	// Tenants' own databases are not log databases we opened, so they do not count
+	for len(ql.logDatabases)-len(ql.colocated) >= ql.maxLogDatabases {
+		lruTenant, lruAccess := "", int64(0)
+		for tenantID := range ql.logDatabases {
+			if ql.colocated[tenantID] {
+				continue
+			}
+			access := ql.lastAccess[tenantID].Load()
+			if lruTenant == "" || access < lruAccess {
+				lruTenant, lruAccess = tenantID, access
+			}
+		}
+		
+		ql.closeLogDatabaseLocked(lruTenant)
+		if ql.logDir == "" {
+			ql.logger.Printf("Warning: evicted in-memory query log for tenant %s to stay within %d log databases; its entries are lost", lruTenant, ql.maxLogDatabases)
+		} else {
+			ql.logger.Printf("Closed query log database for tenant %s to stay within %d log databases", lruTenant, ql.maxLogDatabases)
+		}
+	}
+}
+
+// ensureLogColumns adds the columns a log table created by an older version lacks
+func (ql *QueryLogger) ensureLogColumns(db *sql.DB, table string, tenantID string) error {
+	columns, err := tableColumns(db, table)
+	if err != nil {
+		return fmt.Errorf("failed to list query log columns for tenant %s: %v", tenantID, err)
+	}
+
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column.Name] = true
+	}
+	for name, definition := range queryLogColumns {
+		if existing[name] {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + table + " ADD COLUMN " + definition); err != nil {
+			return fmt.Errorf("failed to add column %s for tenant %s: %v", name, tenantID, err)
+		}
+		ql.logger.Printf("Added missing column %s to query log database for tenant: %s", name, tenantID)
+	}
+
+	return nil
+}
+
+// ensureLogIndexes detects which query log indexes are missing and creates them
+func (ql *QueryLogger) ensureLogIndexes(db *sql.DB, table string, tenantID string) error {
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'index' AND tbl_name = ?", table)
+	if err != nil {
+		return fmt.Errorf("failed to list query log indexes for tenant %s: %v", tenantID, err)
+	}
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan query log index for tenant %s: %v", tenantID, err)
+		}
+		existing[name] = true
+	}
+	rows.Close()
+
+	for index, columns := range queryLogIndexes {
+		name := logIndexName(table, index)
+		if existing[name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s(%s)", name, table, columns)); err != nil {
+			return fmt.Errorf("failed to create index %s for tenant %s: %v", name, tenantID, err)
+		}
+		if len(existing) > 0 {
+			// Only worth reporting when upgrading a log database that already had indexes
+			ql.logger.Printf("Added missing index %s to query log database for tenant: %s", name, tenantID)
+		}
+	}
+
+	return nil
 }
 
 // LogQuery logs a query execution
 func (ql *QueryLogger) LogQuery(tenantID, query, connectionID string, duration time.Duration, success bool, errorMsg string) error {
+	return ql.LogQueryWithPlan(tenantID, query, connectionID, duration, success, errorMsg, "")
+}
+
+// LogQueryWithPlan logs a query execution along with the query plan captured for it, which is
+// stored in the explain column for later analysis of slow statements
+func (ql *QueryLogger) LogQueryWithPlan(tenantID, query, connectionID string, duration time.Duration, success bool, errorMsg string, explain string) error {
 	// Normalize tenant ID (empty becomes "default")
 	if tenantID == "" {
 		tenantID = "default"
 	}
 	
-	db, err := ql.getOrCreateLogDatabase(tenantID)
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
 	if err != nil {
 		return fmt.Errorf("failed to get log database: %v", err)
 	}
+	defer release()
 
 	insertSQL := `
-		INSERT INTO query_logs (tenant_id, query, executed_at, duration_ms, success, error_message, connection_id)
-		VALUES (?, ?, ?, ?, ?, ?, ?)
+		INSERT INTO ` + table + ` (tenant_id, query, executed_at, duration_ms, success, error_message, connection_id, explain)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''))
 	`
 
 	executedAt := time.Now()
 	durationMs := duration.Nanoseconds() / 1000000 // Convert to milliseconds
 
-	_, err = db.Exec(insertSQL, tenantID, query, executedAt, durationMs, success, errorMsg, connectionID)
+	result, err := db.Exec(insertSQL, tenantID, query, executedAt, durationMs, success, errorMsg, connectionID, explain)
+	if err != nil && table == colocatedQueryLogTable {
+		// The tenant's database may have lost the table, e.g. when restored from an older backup;
+		// recreate it rather than failing every entry until the tenant is reopened
+		if ensureErr := ql.ensureLogTable(db, table, tenantID); ensureErr == nil {
+			ql.logger.Printf("Recreated the query log table of tenant %s", tenantID)
+			result, err = db.Exec(insertSQL, tenantID, query, executedAt, durationMs, success, errorMsg, connectionID, explain)
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("failed to insert query log: %v", err)
 	}
 
+	ql.dbMu.RLock()
+	counter := ql.counters[tenantID]
+	mirror := ql.mirror
+	ql.dbMu.RUnlock()
+	if mirror != nil {
+		id, _ := result.LastInsertId()
+		mirror.send(QueryLogEntry{
+			ID:           id,
+			TenantID:     tenantID,
+			Query:        query,
+			ExecutedAt:   executedAt,
+			Duration:     durationMs,
+			Success:      success,
+			ErrorMsg:     errorMsg,
+			ConnectionID: connectionID,
+			Explain:      explain,
+		})
+	}
+	if counter != nil {
+		counter.count.Add(1)
+		counter.lastAt.Store(executedAt.UnixNano())
+	}
+
 	return nil
 }
 
 // GetQueryLogs retrieves query logs for a tenant with optional filters
 func (ql *QueryLogger) GetQueryLogs(tenantID string, limit int, offset int, startTime, endTime *time.Time) ([]interface{}, error) {
-	db, err := ql.getOrCreateLogDatabase(tenantID)
+	return ql.GetQueryLogsFiltered(tenantID, limit, offset, startTime, endTime, nil)
+}
+
+// GetFailedQueries retrieves the most recent failed queries for a tenant
+func (ql *QueryLogger) GetFailedQueries(tenantID string, limit int) ([]interface{}, error) {
+	failed := false
+	return ql.GetQueryLogsFiltered(tenantID, limit, 0, nil, nil, &failed)
+}
+
+// GetLogsByConnection retrieves the query logs of a single connection of a tenant, newest first,
+// to trace one session's activity
+func (ql *QueryLogger) GetLogsByConnection(tenantID string, connectionID string, limit int, offset int) ([]interface{}, error) {
+	return ql.getQueryLogs(tenantID, connectionID, limit, offset, nil, nil, nil)
+}
+
+// GetQueryLogsFiltered retrieves query logs for a tenant, optionally restricted to successful or failed queries
+func (ql *QueryLogger) GetQueryLogsFiltered(tenantID string, limit int, offset int, startTime, endTime *time.Time, success *bool) ([]interface{}, error) {
+	return ql.getQueryLogs(tenantID, "", limit, offset, startTime, endTime, success)
+}
+
+// getQueryLogs retrieves query logs for a tenant with optional filters, restricted to one
+// connection when connectionID is not empty
+func (ql *QueryLogger) getQueryLogs(tenantID string, connectionID string, limit int, offset int, startTime, endTime *time.Time, success *bool) ([]interface{}, error) {
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get log database: %v", err)
 	}
+	defer release()
+
+	// A log table holds one tenant, so tenant_id does not narrow anything down; look a
+	// connection up through idx_connection_id instead
+	if connectionID != "" {
+		table += " INDEXED BY " + logIndexName(table, "idx_connection_id")
+	}
 
 	// Build the query with optional time filters
 	querySQL := `
 		SELECT id, tenant_id, query, executed_at, duration_ms, success, 
-		       COALESCE(error_message, '') as error_message, connection_id
-		FROM query_logs 
+		       COALESCE(error_message, '') as error_message, connection_id,
+		       COALESCE(explain, '') as explain
+		FROM ` + table + ` 
 		WHERE tenant_id = ?
 	`
 	args := []interface{}{tenantID}
 
+	if connectionID != "" {
+		querySQL += " AND connection_id = ?"
+		args = append(args, connectionID)
+	}
+
+	// Filter on success right after tenant_id so idx_tenant_success_executed_at can be used
+	if success != nil {
+		querySQL += " AND success = ?"
+		args = append(args, *success)
+	}
+
 	if startTime != nil {
 		querySQL += " AND executed_at >= ?"
 		args = append(args, *startTime)
@@ -169,6 +686,43 @@ func (ql *QueryLogger) GetQueryLogs(tenantID string, limit int, offset int, star
 	}
 	defer rows.Close()
 
+	return ql.scanQueryLogs(rows)
+}
+
+// GetSlowestQueries retrieves a tenant's slowest logged queries, longest first, along with any
+// query plan captured for them
+func (ql *QueryLogger) GetSlowestQueries(tenantID string, limit int) ([]interface{}, error) {
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log database: %v", err)
+	}
+	defer release()
+
+	querySQL := `
+		SELECT id, tenant_id, query, executed_at, duration_ms, success,
+		       COALESCE(error_message, '') as error_message, connection_id,
+		       COALESCE(explain, '') as explain
+		FROM ` + table + `
+		WHERE tenant_id = ?
+		ORDER BY duration_ms DESC, id DESC
+	`
+	args := []interface{}{tenantID}
+	if limit > 0 {
+		querySQL += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(querySQL, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query slowest queries: %v", err)
+	}
+	defer rows.Close()
+
+	return ql.scanQueryLogs(rows)
+}
+
+// scanQueryLogs reads query log entries selected in QueryLogEntry field order
+func (ql *QueryLogger) scanQueryLogs(rows *sql.Rows) ([]interface{}, error) {
 	var logs []interface{}
 	for rows.Next() {
 		var entry QueryLogEntry
@@ -183,6 +737,7 @@ func (ql *QueryLogger) GetQueryLogs(tenantID string, limit int, offset int, star
 			&entry.Success,
 			&entry.ErrorMsg,
 			&entry.ConnectionID,
+			&entry.Explain,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan log entry: %v", err)
@@ -202,7 +757,7 @@ func (ql *QueryLogger) GetQueryLogs(tenantID string, limit int, offset int, star
 		logs = append(logs, entry)
 	}
 
-	if err = rows.Err(); err != nil {
+	if err := rows.Err(); err != nil {
 		return nil, fmt.Errorf("error iterating over logs: %v", err)
 	}
 
@@ -211,10 +766,11 @@ func (ql *QueryLogger) GetQueryLogs(tenantID string, limit int, offset int, star
 
 // GetQueryLogStats returns statistics for a tenant's query logs
 func (ql *QueryLogger) GetQueryLogStats(tenantID string) (map[string]interface{}, error) {
-	db, err := ql.getOrCreateLogDatabase(tenantID)
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get log database: %v", err)
 	}
+	defer release()
 
 	statsSQL := `
 		SELECT 
@@ -224,7 +780,7 @@ func (ql *QueryLogger) GetQueryLogStats(tenantID string) (map[string]interface{}
 			COALESCE(AVG(duration_ms), 0) as avg_duration_ms,
 			COALESCE(MAX(duration_ms), 0) as max_duration_ms,
 			COALESCE(MIN(duration_ms), 0) as min_duration_ms
-		FROM query_logs 
+		FROM ` + table + ` 
 		WHERE tenant_id = ?
 	`
 
@@ -269,10 +825,131 @@ func (ql *QueryLogger) GetQueryLogStats(tenantID string) (map[string]interface{}
 	return result, nil
 }
 
+// GetTenantMetrics returns a tenant's query count, error count and average and 95th percentile
+// latency over its query log, for per-tenant billing and monitoring. The percentile is the
+// nearest-rank duration, 0 when nothing has been logged.
+func (ql *QueryLogger) GetTenantMetrics(tenantID string) (map[string]interface{}, error) {
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get log database: %v", err)
+	}
+	defer release()
+
+	var queryCount, errorCount int64
+	var avgLatency float64
+	err = db.QueryRow(`
+		SELECT
+			COUNT(*),
+			COUNT(CASE WHEN success = 0 THEN 1 END),
+			COALESCE(AVG(duration_ms), 0)
+		FROM `+table+`
+		WHERE tenant_id = ?
+	`, tenantID).Scan(&queryCount, &errorCount, &avgLatency)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get query metrics: %v", err)
+	}
+
+	var p95Latency int64
+	if queryCount > 0 {
+		rank := (queryCount*95 + 99) / 100 // ceil(0.95 x count), 1-based
+		err = db.QueryRow(`
+			SELECT duration_ms FROM `+table+`
+			WHERE tenant_id = ?
+			ORDER BY duration_ms
+			LIMIT 1 OFFSET ?
+		`, tenantID, rank-1).Scan(&p95Latency)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get p95 latency: %v", err)
+		}
+	}
+
+	return map[string]interface{}{
+		"query_count":    queryCount,
+		"error_count":    errorCount,
+		"avg_latency_ms": avgLatency,
+		"p95_latency_ms": p95Latency,
+	}, nil
+}
+
+// GetQueryCount returns how many queries have been logged for a tenant and when the most recent
+// one ran (nil if none). It reads an in-memory counter, so it is cheap enough for frequent polling.
+func (ql *QueryLogger) GetQueryCount(tenantID string) (int64, *time.Time, error) {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+
+	// Reading a count must not create a log database for a tenant that has never logged
+	ql.dbMu.Lock()
+	exists := ql.hasLogDatabaseLocked(tenantID)
+	ql.dbMu.Unlock()
+	if !exists {
+		return 0, nil, nil
+	}
+
+	// Opening the log database seeds the counter from existing rows. Another tenant may evict it
+	// right after, dropping the counter, in which case opening it again seeds a new one.
+	var counter *queryCounter
+	for attempt := 0; counter == nil && attempt < 2; attempt++ {
+		_, _, release, err := ql.getOrCreateLogDatabase(tenantID)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to get log database: %v", err)
+		}
+		ql.dbMu.RLock()
+		counter = ql.counters[tenantID]
+		ql.dbMu.RUnlock()
+		release()
+	}
+	if counter == nil {
+		return 0, nil, nil
+	}
+
+	var lastAt *time.Time
+	if nanos := counter.lastAt.Load(); nanos != 0 {
+		t := time.Unix(0, nanos)
+		lastAt = &t
+	}
+	return counter.count.Load(), lastAt, nil
+}
+
+// PurgeFailedQueries deletes a tenant's failed query log entries, keeping successful history,
+// and returns how many entries were removed
+func (ql *QueryLogger) PurgeFailedQueries(tenantID string) (int64, error) {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+
+	db, table, release, err := ql.getOrCreateLogDatabase(tenantID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get log database: %v", err)
+	}
+	defer release()
+
+	result, err := db.Exec("DELETE FROM "+table+" WHERE tenant_id = ? AND success = 0", tenantID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge failed queries: %v", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to count purged queries: %v", err)
+	}
+
+	// The counter mirrors the rows in the log database, so it drops by what was removed
+	ql.dbMu.RLock()
+	counter := ql.counters[tenantID]
+	ql.dbMu.RUnlock()
+	if counter != nil && removed > 0 {
+		counter.count.Add(-removed)
+	}
+
+	ql.logger.Printf("Purged %d failed queries for tenant: %s", removed, tenantID)
+	return removed, nil
+}
+
 // ListTenantLogs returns a list of all tenants that have query logs
 func (ql *QueryLogger) ListTenantLogs() []string {
-	ql.dbMu.RLock()
-	defer ql.dbMu.RUnlock()
+	ql.dbMu.Lock()
+	defer ql.dbMu.Unlock()
+	ql.forgetStaleColocatedLocked()
 
 	tenants := make([]string, 0, len(ql.logDatabases))
 	for tenantID := range ql.logDatabases {
@@ -282,17 +959,82 @@ func (ql *QueryLogger) ListTenantLogs() []string {
 	return tenants
 }
 
+// GetLogSizes returns the row count and approximate size in bytes of every tenant's query log
+// database, largest first. Size is page_count x page_size, which in-memory databases report too;
+// for a log kept in the tenant's own database it is the size of that whole database.
+func (ql *QueryLogger) GetLogSizes() ([]map[string]interface{}, error) {
+	ql.dbMu.Lock()
+	ql.forgetStaleColocatedLocked()
+	databases := make(map[string]*sql.DB, len(ql.logDatabases))
+	tables := make(map[string]string, len(ql.logDatabases))
+	colocated := make(map[string]bool, len(ql.colocated))
+	for tenantID, db := range ql.logDatabases {
+		databases[tenantID] = db
+		tables[tenantID] = ql.logTableLocked(tenantID)
+		colocated[tenantID] = ql.colocated[tenantID]
+	}
+	ql.dbMu.Unlock()
+
+	sizes := make([]map[string]interface{}, 0, len(databases))
+	for tenantID, db := range databases {
+		var rowCount, pageCount, pageSize int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + tables[tenantID]).Scan(&rowCount); err != nil {
+			if colocated[tenantID] {
+				// The tenant's database may be closed by its owner at any moment
+				ql.logger.Printf("Skipping query log size of tenant %s: %v", tenantID, err)
+				continue
+			}
+			return nil, fmt.Errorf("failed to count query logs for tenant %s: %v", tenantID, err)
+		}
+		if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+			return nil, fmt.Errorf("failed to get page count for tenant %s: %v", tenantID, err)
+		}
+		if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+			return nil, fmt.Errorf("failed to get page size for tenant %s: %v", tenantID, err)
+		}
+
+		sizes = append(sizes, map[string]interface{}{
+			"tenant_id":  tenantID,
+			"row_count":  rowCount,
+			"size_bytes": pageCount * pageSize,
+		})
+	}
+
+	sort.Slice(sizes, func(i, j int) bool {
+		si, sj := sizes[i]["size_bytes"].(int64), sizes[j]["size_bytes"].(int64)
+		if si != sj {
+			return si > sj
+		}
+		ri, rj := sizes[i]["row_count"].(int64), sizes[j]["row_count"].(int64)
+		if ri != rj {
+			return ri > rj
+		}
+		return sizes[i]["tenant_id"].(string) < sizes[j]["tenant_id"].(string)
+	})
+
+	return sizes, nil
+}
+
 // Close closes all log database connections
 func (ql *QueryLogger) Close() error {
 	ql.dbMu.Lock()
 	defer ql.dbMu.Unlock()
 
 	for tenantID, db := range ql.logDatabases {
+		if ql.colocated[tenantID] {
+			continue // the tenant's own database, closed by the DatabaseManager
+		}
 		if err := db.Close(); err != nil {
 			ql.logger.Printf("Error closing log database for tenant %s: %v", tenantID, err)
 		}
 	}
 
 	ql.logDatabases = make(map[string]*sql.DB)
+	ql.lastAccess = make(map[string]*atomic.Int64)
+	ql.colocated = make(map[string]bool)
+	if ql.mirror != nil {
+		ql.mirror.close()
+		ql.mirror = nil
+	}
 	return nil
 }
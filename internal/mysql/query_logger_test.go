@@ -1,9 +1,16 @@
 package mysql
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -333,3 +340,754 @@ func TestQueryLoggerNumericTenantID(t *testing.T) {
 		t.Error("Logs for different numeric tenants should be isolated")
 	}
 }
+
+func TestQueryLoggerGetQueryLogsFiltered(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	ql := NewQueryLogger(logger, "")
+	
+	tenantID := "filtered_logs_test"
+	ql.LogQuery(tenantID, "SELECT 1", "conn_1", 10*time.Millisecond, true, "")
+	ql.LogQuery(tenantID, "SELECT 2", "conn_1", 10*time.Millisecond, true, "")
+	ql.LogQuery(tenantID, "BROKEN SQL", "conn_1", 10*time.Millisecond, false, "syntax error")
+	
+	failed := false
+	logs, err := ql.GetQueryLogsFiltered(tenantID, 10, 0, nil, nil, &failed)
+	if err != nil {
+		t.Fatalf("Failed to get filtered logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Fatalf("Expected 1 failed log, got %d", len(logs))
+	}
+	if entry := logs[0].(QueryLogEntry); entry.Query != "BROKEN SQL" || entry.Success {
+		t.Errorf("Expected the failed query, got %+v", entry)
+	}
+	
+	succeeded := true
+	logs, err = ql.GetQueryLogsFiltered(tenantID, 10, 0, nil, nil, &succeeded)
+	if err != nil {
+		t.Fatalf("Failed to get filtered logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Errorf("Expected 2 successful logs, got %d", len(logs))
+	}
+}
+
+func TestQueryLoggerGetFailedQueries(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	ql := NewQueryLogger(logger, "")
+	
+	tenantID := "failed_queries_test"
+	ql.LogQuery(tenantID, "SELECT 1", "conn_1", 10*time.Millisecond, true, "")
+	ql.LogQuery(tenantID, "BROKEN SQL", "conn_1", 10*time.Millisecond, false, "syntax error")
+	ql.LogQuery(tenantID, "SELECT * FROM missing", "conn_1", 10*time.Millisecond, false, "no such table: missing")
+	
+	logs, err := ql.GetFailedQueries(tenantID, 50)
+	if err != nil {
+		t.Fatalf("Failed to get failed queries: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 failed queries, got %d", len(logs))
+	}
+	for _, l := range logs {
+		if entry := l.(QueryLogEntry); entry.Success || entry.ErrorMsg == "" {
+			t.Errorf("Expected a failed query with an error message, got %+v", entry)
+		}
+	}
+	
+	logs, err = ql.GetFailedQueries(tenantID, 1)
+	if err != nil {
+		t.Fatalf("Failed to get failed queries: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Errorf("Expected limit to cap results at 1, got %d", len(logs))
+	}
+}
+
+func TestQueryLoggerPurgeFailedQueries(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	ql := NewQueryLogger(logger, "")
+	defer ql.Close()
+	
+	tenantID := "purge_failed_test"
+	ql.LogQuery(tenantID, "SELECT 1", "conn_1", 10*time.Millisecond, true, "")
+	ql.LogQuery(tenantID, "BROKEN SQL", "conn_1", 10*time.Millisecond, false, "syntax error")
+	ql.LogQuery(tenantID, "SELECT 2", "conn_1", 10*time.Millisecond, true, "")
+	ql.LogQuery(tenantID, "SELECT * FROM missing", "conn_1", 10*time.Millisecond, false, "no such table: missing")
+	ql.LogQuery(tenantID, "SELEC 3", "conn_1", 10*time.Millisecond, false, "syntax error")
+	ql.LogQuery("other_tenant", "BROKEN SQL", "conn_2", 10*time.Millisecond, false, "syntax error")
+	
+	removed, err := ql.PurgeFailedQueries(tenantID)
+	if err != nil {
+		t.Fatalf("Failed to purge failed queries: %v", err)
+	}
+	if removed != 3 {
+		t.Errorf("Expected 3 failed queries removed, got %d", removed)
+	}
+	
+	logs, err := ql.GetQueryLogs(tenantID, 50, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to get query logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 successful queries to remain, got %d", len(logs))
+	}
+	for _, l := range logs {
+		if entry := l.(QueryLogEntry); !entry.Success {
+			t.Errorf("Expected only successful queries to remain, got %+v", entry)
+		}
+	}
+	
+	count, _, err := ql.GetQueryCount(tenantID)
+	if err != nil {
+		t.Fatalf("Failed to get query count: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected query count 2 after purge, got %d", count)
+	}
+	
+	// Other tenants keep their failures
+	failed, err := ql.GetFailedQueries("other_tenant", 50)
+	if err != nil {
+		t.Fatalf("Failed to get failed queries: %v", err)
+	}
+	if len(failed) != 1 {
+		t.Errorf("Expected other tenant to keep 1 failed query, got %d", len(failed))
+	}
+	
+	// Purging again finds nothing
+	removed, err = ql.PurgeFailedQueries(tenantID)
+	if err != nil {
+		t.Fatalf("Failed to purge failed queries: %v", err)
+	}
+	if removed != 0 {
+		t.Errorf("Expected nothing removed on second purge, got %d", removed)
+	}
+}
+
+func TestQueryLoggerGetLogSizes(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	ql := NewQueryLogger(logger, "")
+	defer ql.Close()
+	
+	for i := 0; i < 3; i++ {
+		ql.LogQuery("quiet_tenant", "SELECT 1", "conn_1", time.Millisecond, true, "")
+	}
+	longQuery := "SELECT * FROM users WHERE name = '" + strings.Repeat("x", 500) + "'"
+	for i := 0; i < 500; i++ {
+		ql.LogQuery("busy_tenant", longQuery, "conn_2", time.Millisecond, true, "")
+	}
+	
+	sizes, err := ql.GetLogSizes()
+	if err != nil {
+		t.Fatalf("Failed to get log sizes: %v", err)
+	}
+	if len(sizes) != 2 {
+		t.Fatalf("Expected sizes for 2 tenants, got %d", len(sizes))
+	}
+	if sizes[0]["tenant_id"] != "busy_tenant" || sizes[1]["tenant_id"] != "quiet_tenant" {
+		t.Errorf("Expected busy_tenant before quiet_tenant, got %v then %v", sizes[0]["tenant_id"], sizes[1]["tenant_id"])
+	}
+	if sizes[0]["row_count"] != int64(500) || sizes[1]["row_count"] != int64(3) {
+		t.Errorf("Unexpected row counts: %v and %v", sizes[0]["row_count"], sizes[1]["row_count"])
+	}
+	if sizes[0]["size_bytes"].(int64) <= sizes[1]["size_bytes"].(int64) {
+		t.Errorf("Expected busy_tenant to use more bytes: %v vs %v", sizes[0]["size_bytes"], sizes[1]["size_bytes"])
+	}
+}
+
+func TestQueryLoggerMigratesMissingIndexes(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	logDir := t.TempDir()
+	tenantID := "legacy_tenant"
+	
+	// Create a log database with the original schema, which lacks the composite success index
+	legacyDB, err := sql.Open("sqlite3", fmt.Sprintf("%s/query_logs_%s.db", logDir, tenantID))
+	if err != nil {
+		t.Fatalf("Failed to open legacy log database: %v", err)
+	}
+	_, err = legacyDB.Exec(`
+		CREATE TABLE query_logs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tenant_id TEXT NOT NULL,
+			query TEXT NOT NULL,
+			executed_at DATETIME NOT NULL,
+			duration_ms INTEGER NOT NULL,
+			success BOOLEAN NOT NULL,
+			error_message TEXT,
+			connection_id TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE INDEX idx_tenant_executed_at ON query_logs(tenant_id, executed_at);
+		CREATE INDEX idx_connection_id ON query_logs(connection_id);
+	`)
+	legacyDB.Close()
+	if err != nil {
+		t.Fatalf("Failed to create legacy schema: %v", err)
+	}
+	
+	ql := NewQueryLogger(logger, logDir)
+	defer ql.Close()
+	
+	db, _, release, err := ql.getOrCreateLogDatabase(tenantID)
+	if err != nil {
+		t.Fatalf("Failed to open log database: %v", err)
+	}
+	defer release()
+	
+	var count int
+	err = db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'idx_tenant_success_executed_at'").Scan(&count)
+	if err != nil || count != 1 {
+		t.Fatalf("Expected composite index to be added on open (count=%d, err=%v)", count, err)
+	}
+	
+	// The success-filtered query should be planned against the composite index
+	rows, err := db.Query("EXPLAIN QUERY PLAN SELECT id FROM query_logs WHERE tenant_id = ? AND success = ? ORDER BY executed_at DESC", tenantID, false)
+	if err != nil {
+		t.Fatalf("Failed to explain query: %v", err)
+	}
+	defer rows.Close()
+	
+	usesIndex := false
+	for rows.Next() {
+		var id, parent, notused int
+		var detail string
+		if err := rows.Scan(&id, &parent, &notused, &detail); err != nil {
+			t.Fatalf("Failed to scan query plan: %v", err)
+		}
+		if strings.Contains(detail, "idx_tenant_success_executed_at") {
+			usesIndex = true
+		}
+	}
+	if !usesIndex {
+		t.Error("Filtered query should use idx_tenant_success_executed_at")
+	}
+	
+	// The explain column is added too, so slow query plans can be stored
+	if err := ql.LogQueryWithPlan(tenantID, "SELECT * FROM users", "conn_1", 2*time.Second, true, "", "SCAN users"); err != nil {
+		t.Fatalf("Failed to log query with plan: %v", err)
+	}
+	if err := ql.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+	slowest, err := ql.GetSlowestQueries(tenantID, 10)
+	if err != nil {
+		t.Fatalf("Failed to get slowest queries: %v", err)
+	}
+	if len(slowest) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(slowest))
+	}
+	if entry := slowest[0].(QueryLogEntry); entry.Query != "SELECT * FROM users" || entry.Explain != "SCAN users" {
+		t.Errorf("Expected the slow query first with its plan, got %+v", entry)
+	}
+	if entry := slowest[1].(QueryLogEntry); entry.Explain != "" {
+		t.Errorf("Expected no plan for the fast query, got %q", entry.Explain)
+	}
+}
+
+func BenchmarkQueryLoggerFilteredBySuccess(b *testing.B) {
+	logger := log.New(io.Discard, "", 0)
+	tenantID := "bench_tenant"
+	
+	setup := func(b *testing.B, withIndex bool) *QueryLogger {
+		ql := NewQueryLogger(logger, "")
+		db, _, release, err := ql.getOrCreateLogDatabase(tenantID)
+		if err != nil {
+			b.Fatalf("Failed to create log database: %v", err)
+		}
+		defer release()
+		if !withIndex {
+			if _, err := db.Exec("DROP INDEX idx_tenant_success_executed_at"); err != nil {
+				b.Fatalf("Failed to drop index: %v", err)
+			}
+		}
+		
+		// Mostly successful queries with a small share of failures, like a real workload
+		tx, _ := db.Begin()
+		stmt, _ := tx.Prepare("INSERT INTO query_logs (tenant_id, query, executed_at, duration_ms, success, error_message, connection_id) VALUES (?, ?, ?, ?, ?, ?, ?)")
+		start := time.Now().Add(-24 * time.Hour)
+		for i := 0; i < 20000; i++ {
+			success := i%50 != 0
+			stmt.Exec(tenantID, fmt.Sprintf("SELECT %d", i), start.Add(time.Duration(i)*time.Second), 1, success, "", "conn_1")
+		}
+		stmt.Close()
+		tx.Commit()
+		return ql
+	}
+	
+	for _, withIndex := range []bool{false, true} {
+		name := "without_index"
+		if withIndex {
+			name = "with_index"
+		}
+		b.Run(name, func(b *testing.B) {
+			ql := setup(b, withIndex)
+			defer ql.Close()
+			failed := false
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ql.GetQueryLogsFiltered(tenantID, 50, 0, nil, nil, &failed); err != nil {
+					b.Fatalf("Failed to get filtered logs: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryLoggerGetQueryCount(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	logDir := t.TempDir()
+	ql := NewQueryLogger(logger, logDir)
+	
+	count, lastAt, err := ql.GetQueryCount("counted_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get query count: %v", err)
+	}
+	if count != 0 || lastAt != nil {
+		t.Errorf("Expected no queries yet, got %d (last at %v)", count, lastAt)
+	}
+	if tenants := ql.ListTenantLogs(); len(tenants) != 0 {
+		t.Errorf("Reading a count should not create a log database, got logs for %v", tenants)
+	}
+	if _, err := os.Stat(ql.logPath("counted_tenant")); err == nil {
+		t.Error("Reading a count should not create a log file")
+	}
+	
+	before := time.Now()
+	for i := 0; i < 3; i++ {
+		ql.LogQuery("counted_tenant", "SELECT 1", "conn_1", time.Millisecond, true, "")
+	}
+	count, lastAt, err = ql.GetQueryCount("counted_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get query count: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 queries, got %d", count)
+	}
+	if lastAt == nil || lastAt.Before(before) {
+		t.Errorf("Expected last query time after %v, got %v", before, lastAt)
+	}
+	ql.Close()
+	
+	// A fresh logger seeds the counter from the existing log database
+	reopened := NewQueryLogger(logger, logDir)
+	defer reopened.Close()
+	count, lastAt, err = reopened.GetQueryCount("counted_tenant")
+	if err != nil {
+		t.Fatalf("Failed to get query count after reopen: %v", err)
+	}
+	if count != 3 || lastAt == nil {
+		t.Errorf("Expected 3 queries with a last query time after reopen, got %d (last at %v)", count, lastAt)
+	}
+}
+
+func TestQueryLoggerInstancesIsolated(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	first := NewQueryLogger(logger, "")
+	second := NewQueryLogger(logger, "")
+	defer first.Close()
+	defer second.Close()
+
+	if first.instanceID == second.instanceID {
+		t.Fatalf("Expected distinct instance IDs, both got %d", first.instanceID)
+	}
+
+	tenantID := "test_tenant_isolated"
+	if err := first.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+
+	logs, err := second.GetQueryLogs(tenantID, 10, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to get query logs: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("Expected the second logger's tenant log to be empty, got %d entries", len(logs))
+	}
+
+	logs, err = first.GetQueryLogs(tenantID, 10, 0, nil, nil)
+	if err != nil {
+		t.Fatalf("Failed to get query logs: %v", err)
+	}
+	if len(logs) != 1 {
+		t.Errorf("Expected the first logger to keep its entry, got %d", len(logs))
+	}
+}
+
+func TestQueryLoggerMaxLogDatabases(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	ql := NewQueryLogger(logger, t.TempDir())
+	defer ql.Close()
+	ql.SetMaxLogDatabases(2)
+	
+	if err := ql.LogQuery("oldest", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+	oldest, _, release, err := ql.getOrCreateLogDatabase("oldest")
+	if err != nil {
+		t.Fatalf("Failed to get log database: %v", err)
+	}
+	time.Sleep(time.Millisecond)
+	ql.LogQuery("middle", "SELECT 1", "conn_1", time.Millisecond, true, "")
+	time.Sleep(time.Millisecond)
+	
+	// A third tenant goes over the cap and closes the least recently used log database
+	ql.LogQuery("newest", "SELECT 1", "conn_1", time.Millisecond, true, "")
+	if tenants := ql.ListTenantLogs(); len(tenants) != 2 || stringInSlice("oldest", tenants) {
+		t.Errorf("Expected only middle and newest to stay open, got %v", tenants)
+	}
+	
+	// The evicted log database stays usable until its user is done with it
+	if err := oldest.Ping(); err != nil {
+		t.Errorf("Expected the evicted log database to stay open while in use, got %v", err)
+	}
+	release()
+	if err := oldest.Ping(); err == nil {
+		t.Error("Expected the evicted log database connection to be closed")
+	}
+	
+	// File-backed logs survive eviction and are reopened on next use
+	count, _, err := ql.GetQueryCount("oldest")
+	if err != nil {
+		t.Fatalf("Failed to get query count: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected the reopened log to keep its 1 query, got %d", count)
+	}
+	if tenants := ql.ListTenantLogs(); len(tenants) != 2 || stringInSlice("middle", tenants) {
+		t.Errorf("Expected reopening oldest to evict middle, got %v", tenants)
+	}
+}
+
+func TestQueryLoggerGetLogsByConnection(t *testing.T) {
+	ql := NewQueryLogger(log.New(io.Discard, "", 0), "")
+	defer ql.Close()
+
+	tenantID := "test_tenant_by_connection"
+	for _, entry := range []struct {
+		query        string
+		connectionID string
+	}{
+		{"SELECT 1", "conn_1"},
+		{"SELECT 2", "conn_2"},
+		{"SELECT 3", "conn_1"},
+		{"SELECT 4", "conn_2"},
+		{"SELECT 5", "conn_1"},
+	} {
+		if err := ql.LogQuery(tenantID, entry.query, entry.connectionID, time.Millisecond, true, ""); err != nil {
+			t.Fatalf("Failed to log query: %v", err)
+		}
+	}
+
+	logs, err := ql.GetLogsByConnection(tenantID, "conn_2", 10, 0)
+	if err != nil {
+		t.Fatalf("Failed to get logs by connection: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 logs for conn_2, got %d", len(logs))
+	}
+	for _, entry := range logs {
+		logEntry := entry.(QueryLogEntry)
+		if logEntry.ConnectionID != "conn_2" {
+			t.Errorf("Expected only conn_2 logs, got %+v", logEntry)
+		}
+	}
+
+	// Paging applies within the connection
+	logs, err = ql.GetLogsByConnection(tenantID, "conn_1", 2, 2)
+	if err != nil {
+		t.Fatalf("Failed to get logs by connection: %v", err)
+	}
+	if len(logs) != 1 || logs[0].(QueryLogEntry).ConnectionID != "conn_1" {
+		t.Errorf("Expected the third conn_1 log on the second page, got %+v", logs)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to write from background goroutines, such as the query log
+// mirror or LogQuery, while the test reads it
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func (b *lockedBuffer) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf.Reset()
+}
+
+func TestQueryLoggerMirrorTo(t *testing.T) {
+	ql := NewQueryLogger(log.New(io.Discard, "", 0), "")
+	defer ql.Close()
+
+	var output lockedBuffer
+	ql.MirrorTo(log.New(&output, "", 0))
+
+	if err := ql.LogQuery("mirror_tenant", "SELECT * FROM users", "conn_9", 12*time.Millisecond, false, "no such table: users"); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(output.String(), "query_log ") {
+		if time.Now().After(deadline) {
+			t.Fatal("Logged query was not mirrored to the logger")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	line := strings.TrimSpace(output.String())
+	var entry QueryLogEntry
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "query_log ")), &entry); err != nil {
+		t.Fatalf("Mirrored line should be JSON after its prefix, got %q: %v", line, err)
+	}
+	if entry.TenantID != "mirror_tenant" || entry.Query != "SELECT * FROM users" || entry.ConnectionID != "conn_9" ||
+		entry.Success || entry.ErrorMsg != "no such table: users" || entry.Duration != 12 || entry.ID == 0 {
+		t.Errorf("Unexpected mirrored entry %+v", entry)
+	}
+}
+
+func TestQueryLoggerShardLevels(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	logDir := t.TempDir()
+
+	// A log written before sharding was enabled sits flat in logDir
+	flat := NewQueryLogger(logger, logDir)
+	if err := flat.LogQuery("legacy", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("LogQuery failed: %v", err)
+	}
+	flat.Close()
+	if _, err := os.Stat(filepath.Join(logDir, "query_logs_legacy.db")); err != nil {
+		t.Fatalf("Expected the unsharded log flat in the log directory: %v", err)
+	}
+	// A WAL file left behind next to it belongs with the database
+	if err := os.WriteFile(filepath.Join(logDir, "query_logs_legacy.db-wal"), nil, 0o644); err != nil {
+		t.Fatalf("Failed to write WAL file: %v", err)
+	}
+
+	ql := NewQueryLogger(logger, logDir)
+	ql.SetShardLevels(2)
+	defer ql.Close()
+
+	// sha256("acme") starts with 822b33ad...
+	if err := ql.LogQuery("acme", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("LogQuery failed: %v", err)
+	}
+	expected := filepath.Join(logDir, "82", "2b", "query_logs_acme.db")
+	if path := ql.logPath("acme"); path != expected {
+		t.Errorf("Expected the log at %s, got %s", expected, path)
+	}
+	if _, err := os.Stat(expected); err != nil {
+		t.Errorf("Expected the log database in its shard directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "query_logs_acme.db")); err == nil {
+		t.Error("Expected no log database flat in the log directory")
+	}
+
+	// The flat log moves into its shard with its entries
+	if count, _, err := ql.GetQueryCount("legacy"); err != nil || count != 1 {
+		t.Errorf("Expected the moved log to keep its entry, got %d (%v)", count, err)
+	}
+	if _, err := os.Stat(ql.logPath("legacy")); err != nil {
+		t.Errorf("Expected the flat log moved into its shard: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "query_logs_legacy.db")); err == nil {
+		t.Error("Expected the flat log to be gone after the move")
+	}
+	if _, err := os.Stat(filepath.Join(logDir, "query_logs_legacy.db-wal")); err == nil {
+		t.Error("Expected the flat log's WAL file to move with it")
+	}
+}
+
+func TestQueryLoggerLogDirURICharacters(t *testing.T) {
+	// Opened as a plain file name, the ? would start DSN parameters and open an in-memory database
+	logDir := filepath.Join(t.TempDir(), "logs?mode=memory#1")
+	ql := NewQueryLogger(log.New(io.Discard, "", 0), logDir)
+	if err := ql.LogQuery("acme", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("LogQuery failed: %v", err)
+	}
+	ql.Close()
+
+	if _, err := os.Stat(filepath.Join(logDir, "query_logs_acme.db")); err != nil {
+		t.Fatalf("Expected the log database in the log directory: %v", err)
+	}
+	reopened := NewQueryLogger(log.New(io.Discard, "", 0), logDir)
+	defer reopened.Close()
+	if count, _, err := reopened.GetQueryCount("acme"); err != nil || count != 1 {
+		t.Errorf("Expected the stored entry after reopening, got %d (%v)", count, err)
+	}
+}
+
+func TestQueryLoggerColocatedDatabases(t *testing.T) {
+	tenantDB, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("Failed to open tenant database: %v", err)
+	}
+	defer tenantDB.Close()
+	tenantDB.SetMaxOpenConns(1)
+
+	ql := NewQueryLogger(log.New(io.Discard, "", 0), "")
+	ql.SetColocatedDatabases(func(tenantID string) (*sql.DB, bool) {
+		if tenantID == "acme" {
+			return tenantDB, true
+		}
+		return nil, false
+	})
+
+	if err := ql.LogQuery("acme", "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+	if err := ql.LogQuery("globex", "SELECT 2", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Fatalf("Failed to log query: %v", err)
+	}
+
+	var count int
+	if err := tenantDB.QueryRow("SELECT COUNT(*) FROM " + colocatedQueryLogTable).Scan(&count); err != nil || count != 1 {
+		t.Fatalf("Expected acme's entry in its own database, got %d (%v)", count, err)
+	}
+	logs, err := ql.GetQueryLogs("acme", 10, 0, nil, nil)
+	if err != nil || len(logs) != 1 || logs[0].(QueryLogEntry).Query != "SELECT 1" {
+		t.Errorf("Expected acme's colocated entry back, got %v (%v)", logs, err)
+	}
+
+	// Tenants without a database of their own keep a separate log database
+	logs, err = ql.GetQueryLogs("globex", 10, 0, nil, nil)
+	if err != nil || len(logs) != 1 || logs[0].(QueryLogEntry).Query != "SELECT 2" {
+		t.Errorf("Expected globex's entry in a separate log database, got %v (%v)", logs, err)
+	}
+	if sizes, err := ql.GetLogSizes(); err != nil || len(sizes) != 2 {
+		t.Errorf("Expected sizes for both tenants, got %v (%v)", sizes, err)
+	}
+
+	// The tenant's database belongs to its owner and stays open
+	ql.Close()
+	if err := tenantDB.Ping(); err != nil {
+		t.Errorf("Expected the tenant database to stay open after Close, got %v", err)
+	}
+}
+
+func TestQueryLoggerRejectsPathTenantIDs(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	root := t.TempDir()
+	logDir := filepath.Join(root, "logs")
+
+	for _, levels := range []int{0, 2} {
+		ql := NewQueryLogger(logger, logDir)
+		ql.SetShardLevels(levels)
+		for _, tenantID := range []string{"../escaped", "../../outside/escaped", "a/b", `a\b`, ".."} {
+			if err := ql.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err == nil {
+				t.Errorf("Expected tenant ID %q to be refused with %d shard levels", tenantID, levels)
+			}
+		}
+		ql.Close()
+	}
+
+	// Nothing may be created beside the log directory
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", root, err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "logs" {
+			t.Errorf("Expected nothing outside the log directory, found %s", entry.Name())
+		}
+	}
+
+	// In memory, a tenant ID that isn't a valid URI path still gets a log of its own
+	ql := NewQueryLogger(logger, "")
+	defer ql.Close()
+	for _, tenantID := range []string{"a?b", "a/b"} {
+		if err := ql.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+			t.Errorf("LogQuery for in-memory tenant %q failed: %v", tenantID, err)
+		}
+		if count, _, err := ql.GetQueryCount(tenantID); err != nil || count != 1 {
+			t.Errorf("Expected one entry for in-memory tenant %q, got %d (%v)", tenantID, count, err)
+		}
+	}
+}
+
+func TestQueryLoggerColocatedDatabaseDeleted(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	dm := NewDatabaseManager(logger)
+	defer dm.Close()
+	ql := NewQueryLogger(logger, "")
+	defer ql.Close()
+	ql.SetColocatedDatabases(dm.existingDatabase)
+	dm.AddCloseHook(ql.ForgetClosedDatabase)
+
+	for _, tenantID := range []string{"acme", "globex"} {
+		if _, err := dm.GetOrCreateDatabase(tenantID); err != nil {
+			t.Fatalf("Failed to create database for %s: %v", tenantID, err)
+		}
+		if err := ql.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+			t.Fatalf("Failed to log query: %v", err)
+		}
+	}
+
+	// Deleting a tenant closes its database, which the logger must let go of
+	if err := dm.DeleteDatabase("acme"); err != nil {
+		t.Fatalf("DeleteDatabase failed: %v", err)
+	}
+	sizes, err := ql.GetLogSizes()
+	if err != nil || len(sizes) != 1 || sizes[0]["tenant_id"] != "globex" {
+		t.Errorf("Expected sizes for globex alone, got %v (%v)", sizes, err)
+	}
+	if tenants := ql.ListTenantLogs(); len(tenants) != 1 || tenants[0] != "globex" {
+		t.Errorf("Expected only globex to have logs, got %v", tenants)
+	}
+
+	// A tenant recreated under the same idx logs into its new database
+	if _, err := dm.GetOrCreateDatabase("acme"); err != nil {
+		t.Fatalf("Failed to recreate database: %v", err)
+	}
+	if err := ql.LogQuery("acme", "SELECT 2", "conn_1", time.Millisecond, true, ""); err != nil {
+		t.Errorf("Failed to log query after recreating the tenant: %v", err)
+	}
+}
+
+func TestQueryLoggerEvictionWhileInUse(t *testing.T) {
+	logger := log.New(io.Discard, "", 0)
+	ql := NewQueryLogger(logger, t.TempDir())
+	defer ql.Close()
+	ql.SetMaxLogDatabases(1)
+
+	// Every call opens a log database, evicting the one another goroutine is using
+	var wg sync.WaitGroup
+	errs := make(chan error, 4*50*2)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(tenantID string) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if err := ql.LogQuery(tenantID, "SELECT 1", "conn_1", time.Millisecond, true, ""); err != nil {
+					errs <- err
+				}
+				if _, _, err := ql.GetQueryCount(tenantID); err != nil {
+					errs <- err
+				}
+			}
+		}(fmt.Sprintf("tenant_%d", i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("Logging during eviction failed: %v", err)
+	}
+
+	// File-backed logs keep every entry through the evictions
+	for i := 0; i < 4; i++ {
+		if count, _, err := ql.GetQueryCount(fmt.Sprintf("tenant_%d", i)); err != nil || count != 50 {
+			t.Errorf("Expected 50 entries for tenant_%d, got %d (%v)", i, count, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package mysql
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// qpsBuckets is how many one-second buckets the rolling query rate keeps
+const qpsBuckets = 60
+
+// QPSWindow is the period the queries-per-second estimate is averaged over
+const QPSWindow = 10 * time.Second
+
+// MaxMetricTenantLabels caps the distinct idx labels on the query duration metrics; queries for
+// tenants beyond the cap are reported under OverflowTenantLabel so thousands of tenants cannot
+// explode the number of series
+const MaxMetricTenantLabels = 100
+
+// OverflowTenantLabel is the idx label used for tenants beyond MaxMetricTenantLabels
+const OverflowTenantLabel = "other"
+
+// metricStatementTypes are the statement_type label values; other statements are reported as "other"
+var metricStatementTypes = map[string]bool{
+	"select": true, "insert": true, "update": true, "delete": true, "replace": true,
+	"create": true, "drop": true, "alter": true, "show": true, "set": true,
+	"describe": true, "explain": true, "use": true, "begin": true, "start": true,
+	"commit": true, "rollback": true, "with": true,
+}
+
+// durationKey identifies one labeled query duration series
+type durationKey struct {
+	idx           string
+	statementType string
+	status        string
+}
+
+// durationSeries is a lock-free query duration histogram for one label set
+type durationSeries struct {
+	buckets [len(queryDurationBucketsNs)]atomic.Int64 // Non-cumulative counts per bucket; the last is +Inf
+	sumNs   atomic.Int64
+	count   atomic.Int64
+}
+
+// queryDurationBucketsNs are the upper bounds of the query duration histogram buckets, with a
+// trailing +Inf bucket
+var queryDurationBucketsNs = [...]time.Duration{
+	time.Millisecond, 5 * time.Millisecond, 10 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 500 * time.Millisecond, time.Second, 5 * time.Second, 1<<63 - 1,
+}
+
+// QueryDurationBuckets are the upper bounds, in seconds, of the finite query duration histogram buckets
+var QueryDurationBuckets = func() []float64 {
+	bounds := make([]float64, len(queryDurationBucketsNs)-1)
+	for i := range bounds {
+		bounds[i] = queryDurationBucketsNs[i].Seconds()
+	}
+	return bounds
+}()
+
+// QueryDurationSeries is a point-in-time copy of one labeled query duration histogram
+type QueryDurationSeries struct {
+	Idx           string
+	StatementType string
+	Status        string  // "success" or "error"
+	BucketCounts  []int64 // Cumulative counts for each of QueryDurationBuckets
+	Sum           time.Duration
+	Count         int64
+}
+
+// QueryStats counts handled queries globally and per tenant and estimates the recent query rate.
+// Recording is lock-free apart from the first query of a new tenant, so it does not contend
+// under concurrent load.
+type QueryStats struct {
+	total   atomic.Int64
+	tenants sync.Map // tenant ID -> *atomic.Int64
+
+	// Each bucket packs the Unix second it belongs to (high 32 bits) with its count (low 32 bits)
+	// so a bucket can be claimed for a new second and counted in one compare-and-swap
+	buckets [qpsBuckets]atomic.Uint64
+
+	durations       sync.Map     // durationKey -> *durationSeries
+	tenantLabels    sync.Map     // tenant ID -> struct{}, tenants given their own idx label
+	tenantLabelN    atomic.Int64 // number of entries in tenantLabels
+	maxTenantLabels int
+}
+
+// QueryStatsSnapshot is a point-in-time copy of the query counters
+type QueryStatsSnapshot struct {
+	TotalQueries     int64
+	QueriesPerSecond float64
+	TenantQueries    map[string]int64
+	Durations        []QueryDurationSeries // Sorted by idx, statement type and status
+}
+
+// NewQueryStats creates an empty set of query counters
+func NewQueryStats() *QueryStats {
+	return &QueryStats{maxTenantLabels: MaxMetricTenantLabels}
+}
+
+// Record counts one query for tenantID ("" counts against the default tenant)
+func (qs *QueryStats) Record(tenantID string) {
+	qs.recordAt(tenantID, time.Now())
+}
+
+// recordAt counts one query for tenantID at the given time
+func (qs *QueryStats) recordAt(tenantID string, now time.Time) {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+
+	qs.total.Add(1)
+
+	counter, ok := qs.tenants.Load(tenantID)
+	if !ok {
+		counter, _ = qs.tenants.LoadOrStore(tenantID, new(atomic.Int64))
+	}
+	counter.(*atomic.Int64).Add(1)
+
+	second := uint64(uint32(now.Unix()))
+	bucket := &qs.buckets[second%qpsBuckets]
+	for {
+		current := bucket.Load()
+		next := second<<32 | 1
+		if current>>32 == second {
+			next = current + 1
+		}
+		if bucket.CompareAndSwap(current, next) {
+			return
+		}
+	}
+}
+
+// ObserveDuration records how long a query for tenantID took, labeled by its statement type and
+// whether it succeeded
+func (qs *QueryStats) ObserveDuration(tenantID, query string, success bool, duration time.Duration) {
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	key := durationKey{idx: qs.tenantLabel(tenantID), statementType: metricStatementType(query), status: status}
+
+	series, ok := qs.durations.Load(key)
+	if !ok {
+		series, _ = qs.durations.LoadOrStore(key, new(durationSeries))
+	}
+	ds := series.(*durationSeries)
+	for i, bound := range queryDurationBucketsNs {
+		if duration <= bound {
+			ds.buckets[i].Add(1)
+			break
+		}
+	}
+	ds.sumNs.Add(int64(duration))
+	ds.count.Add(1)
+}
+
+// tenantLabel returns the idx label for tenantID, bucketing tenants beyond the label cap into
+// OverflowTenantLabel. Tenants keep the label they were first given.
+func (qs *QueryStats) tenantLabel(tenantID string) string {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+	if _, ok := qs.tenantLabels.Load(tenantID); ok {
+		return tenantID
+	}
+	for {
+		n := qs.tenantLabelN.Load()
+		if n >= int64(qs.maxTenantLabels) {
+			return OverflowTenantLabel
+		}
+		if qs.tenantLabelN.CompareAndSwap(n, n+1) {
+			break
+		}
+	}
+	if _, loaded := qs.tenantLabels.LoadOrStore(tenantID, struct{}{}); loaded {
+		// Another query for the same tenant claimed its label first; give back the slot
+		qs.tenantLabelN.Add(-1)
+	}
+	return tenantID
+}
+
+// Forget drops the query count and duration series of tenantID, whose database was deleted, and
+// frees its idx label for another tenant. The global total and query rate keep its queries, as do
+// the OverflowTenantLabel series it may have shared.
+func (qs *QueryStats) Forget(tenantID string) {
+	if tenantID == "" {
+		tenantID = "default"
+	}
+	qs.tenants.Delete(tenantID)
+	if _, labeled := qs.tenantLabels.LoadAndDelete(tenantID); !labeled {
+		return
+	}
+	qs.durations.Range(func(key, _ interface{}) bool {
+		if key.(durationKey).idx == tenantID {
+			qs.durations.Delete(key)
+		}
+		return true
+	})
+	qs.tenantLabelN.Add(-1)
+}
+
+// metricStatementType returns the statement_type label for query
+func metricStatementType(query string) string {
+	keyword := statementKeyword(query)
+	if keyword == "desc" {
+		keyword = "describe"
+	}
+	if !metricStatementTypes[keyword] {
+		return "other"
+	}
+	return keyword
+}
+
+// Total returns the number of queries recorded across all tenants
+func (qs *QueryStats) Total() int64 {
+	return qs.total.Load()
+}
+
+// QPS returns the average queries per second over the last QPSWindow, including the current second
+func (qs *QueryStats) QPS() float64 {
+	return qs.qpsAt(time.Now())
+}
+
+// qpsAt returns the average queries per second over the QPSWindow ending at now
+func (qs *QueryStats) qpsAt(now time.Time) float64 {
+	windowSeconds := int64(QPSWindow / time.Second)
+	current := now.Unix()
+
+	var count uint64
+	for s := current - windowSeconds + 1; s <= current; s++ {
+		second := uint64(uint32(s))
+		if value := qs.buckets[second%qpsBuckets].Load(); value>>32 == second {
+			count += value & 0xffffffff
+		}
+	}
+	return float64(count) / float64(windowSeconds)
+}
+
+// Snapshot returns the current counters and query rate
+func (qs *QueryStats) Snapshot() QueryStatsSnapshot {
+	snapshot := QueryStatsSnapshot{
+		TotalQueries:     qs.Total(),
+		QueriesPerSecond: qs.QPS(),
+		TenantQueries:    make(map[string]int64),
+	}
+	qs.tenants.Range(func(key, value interface{}) bool {
+		snapshot.TenantQueries[key.(string)] = value.(*atomic.Int64).Load()
+		return true
+	})
+	qs.durations.Range(func(key, value interface{}) bool {
+		k, ds := key.(durationKey), value.(*durationSeries)
+		series := QueryDurationSeries{
+			Idx:           k.idx,
+			StatementType: k.statementType,
+			Status:        k.status,
+			BucketCounts:  make([]int64, len(QueryDurationBuckets)),
+			Sum:           time.Duration(ds.sumNs.Load()),
+			Count:         ds.count.Load(),
+		}
+		var cumulative int64
+		for i := range series.BucketCounts {
+			cumulative += ds.buckets[i].Load()
+			series.BucketCounts[i] = cumulative
+		}
+		snapshot.Durations = append(snapshot.Durations, series)
+		return true
+	})
+	sort.Slice(snapshot.Durations, func(i, j int) bool {
+		a, b := snapshot.Durations[i], snapshot.Durations[j]
+		if a.Idx != b.Idx {
+			return a.Idx < b.Idx
+		}
+		if a.StatementType != b.StatementType {
+			return a.StatementType < b.StatementType
+		}
+		return a.Status < b.Status
+	})
+	return snapshot
+}
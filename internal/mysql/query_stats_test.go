@@ -0,0 +1,182 @@
+package mysql
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueryStats_ConcurrentQueries(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	const workers = 20
+	const perWorker = 50
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				if _, err := handler.HandleQuery("SELECT 1"); err != nil {
+					t.Errorf("Query failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := handler.GetQueryStats().Snapshot()
+	if snapshot.TotalQueries != workers*perWorker {
+		t.Errorf("Expected %d queries, got %d", workers*perWorker, snapshot.TotalQueries)
+	}
+	if snapshot.TenantQueries["default"] != workers*perWorker {
+		t.Errorf("Expected %d queries for default tenant, got %d", workers*perWorker, snapshot.TenantQueries["default"])
+	}
+	if snapshot.QueriesPerSecond <= 0 {
+		t.Errorf("Expected a positive query rate, got %v", snapshot.QueriesPerSecond)
+	}
+}
+
+func TestQueryStats_PerTenantAndWindow(t *testing.T) {
+	stats := NewQueryStats()
+	start := time.Unix(1_700_000_000, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			stats.recordAt(fmt.Sprintf("tenant_%d", i%4), start)
+		}(i)
+	}
+	wg.Wait()
+	stats.recordAt("", start.Add(5*time.Second))
+
+	snapshot := stats.Snapshot()
+	if snapshot.TotalQueries != 101 {
+		t.Errorf("Expected 101 queries, got %d", snapshot.TotalQueries)
+	}
+	if snapshot.TenantQueries["tenant_0"] != 25 || snapshot.TenantQueries["default"] != 1 {
+		t.Errorf("Unexpected per-tenant counts: %v", snapshot.TenantQueries)
+	}
+
+	// Both seconds fall in the window, so the rate is 101 queries over 10 seconds
+	if qps := stats.qpsAt(start.Add(5 * time.Second)); qps != 10.1 {
+		t.Errorf("Expected 10.1 qps, got %v", qps)
+	}
+	// Once the first second leaves the window only the later query counts
+	if qps := stats.qpsAt(start.Add(QPSWindow)); qps != 0.1 {
+		t.Errorf("Expected 0.1 qps after the burst leaves the window, got %v", qps)
+	}
+	// A bucket reused a minute later does not carry over stale counts
+	if qps := stats.qpsAt(start.Add(time.Minute)); qps != 0 {
+		t.Errorf("Expected 0 qps a minute later, got %v", qps)
+	}
+}
+
+// findDurationSeries returns the duration series with the given labels, if recorded
+func findDurationSeries(snapshot QueryStatsSnapshot, idx, statementType, status string) (QueryDurationSeries, bool) {
+	for _, series := range snapshot.Durations {
+		if series.Idx == idx && series.StatementType == statementType && series.Status == status {
+			return series, true
+		}
+	}
+	return QueryDurationSeries{}, false
+}
+
+func TestQueryStats_DurationLabels(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+
+	if _, err := handler.HandleQuery("SELECT 1"); err != nil {
+		t.Fatalf("SELECT failed: %v", err)
+	}
+	if _, err := handler.HandleQuery("SELECT * FROM no_such_table"); err == nil {
+		t.Fatal("Expected query against a missing table to fail")
+	}
+
+	snapshot := handler.GetQueryStats().Snapshot()
+	success, ok := findDurationSeries(snapshot, "default", "select", "success")
+	if !ok || success.Count != 1 {
+		t.Errorf("Expected one successful select for the default tenant, got %+v", snapshot.Durations)
+	}
+	if ok && success.BucketCounts[len(success.BucketCounts)-1] > success.Count {
+		t.Errorf("Cumulative bucket counts should not exceed the total: %+v", success)
+	}
+	if failed, ok := findDurationSeries(snapshot, "default", "select", "error"); !ok || failed.Count != 1 {
+		t.Errorf("Expected one failed select for the default tenant, got %+v", snapshot.Durations)
+	}
+}
+
+func TestQueryStats_DurationTenantOverflow(t *testing.T) {
+	stats := NewQueryStats()
+	stats.maxTenantLabels = 2
+
+	for _, tenant := range []string{"tenant_a", "tenant_b", "tenant_c", "tenant_d", "tenant_a"} {
+		stats.ObserveDuration(tenant, "SELECT 1", true, 2*time.Millisecond)
+	}
+	stats.ObserveDuration("tenant_c", "VACUUM", true, time.Millisecond)
+
+	snapshot := stats.Snapshot()
+	if series, ok := findDurationSeries(snapshot, "tenant_a", "select", "success"); !ok || series.Count != 2 {
+		t.Errorf("Expected tenant_a to keep its own label, got %+v", snapshot.Durations)
+	}
+	if _, ok := findDurationSeries(snapshot, "tenant_b", "select", "success"); !ok {
+		t.Errorf("Expected tenant_b to keep its own label, got %+v", snapshot.Durations)
+	}
+	if series, ok := findDurationSeries(snapshot, OverflowTenantLabel, "select", "success"); !ok || series.Count != 2 {
+		t.Errorf("Expected tenants beyond the cap to be bucketed into %q, got %+v", OverflowTenantLabel, snapshot.Durations)
+	}
+	if _, ok := findDurationSeries(snapshot, OverflowTenantLabel, "other", "success"); !ok {
+		t.Errorf("Expected unknown statements to be labeled other, got %+v", snapshot.Durations)
+	}
+	for _, series := range snapshot.Durations {
+		if series.Idx == "tenant_c" || series.Idx == "tenant_d" {
+			t.Errorf("Overflow tenant %s should not have its own label", series.Idx)
+		}
+	}
+}
+
+func TestQueryStats_ForgetDeletedTenant(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	handler := NewHandler(logger)
+	stats := handler.GetQueryStats()
+	stats.maxTenantLabels = 1
+
+	if _, err := handler.databaseManager.GetOrCreateDatabase("doomed"); err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	stats.Record("doomed")
+	stats.ObserveDuration("doomed", "SELECT 1", true, time.Millisecond)
+	stats.ObserveDuration("kept", "SELECT 1", true, time.Millisecond)
+
+	if err := handler.databaseManager.DeleteDatabase("doomed"); err != nil {
+		t.Fatalf("Failed to delete database: %v", err)
+	}
+
+	snapshot := stats.Snapshot()
+	if _, ok := snapshot.TenantQueries["doomed"]; ok {
+		t.Errorf("Expected the deleted tenant's query count to be dropped, got %v", snapshot.TenantQueries)
+	}
+	if _, ok := findDurationSeries(snapshot, "doomed", "select", "success"); ok {
+		t.Errorf("Expected the deleted tenant's duration series to be dropped, got %+v", snapshot.Durations)
+	}
+	if snapshot.TotalQueries != 1 {
+		t.Errorf("Expected the global total to keep the deleted tenant's queries, got %d", snapshot.TotalQueries)
+	}
+	if _, ok := findDurationSeries(snapshot, OverflowTenantLabel, "select", "success"); !ok {
+		t.Errorf("Expected the overflow series to be kept, got %+v", snapshot.Durations)
+	}
+
+	// The freed label goes to the next tenant
+	stats.ObserveDuration("newcomer", "SELECT 1", true, time.Millisecond)
+	if _, ok := findDurationSeries(stats.Snapshot(), "newcomer", "select", "success"); !ok {
+		t.Errorf("Expected a new tenant to take the freed label, got %+v", stats.Snapshot().Durations)
+	}
+}
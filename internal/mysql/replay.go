@@ -0,0 +1,204 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"multitenant-db/internal/config"
+)
+
+// ReplayResult is the outcome of one statement handed to ReplayQueries
+type ReplayResult struct {
+	Skipped      string // Why the statement was not replayed, empty if it was
+	RowsAffected int64
+	Err          error // Why the statement failed, nil if it succeeded or was skipped
+}
+
+// replaySkipReason explains why a logged statement is not replayed, or returns "" if it is.
+// Only statements that change data or schema affect a tenant's state. Prepared statements are
+// logged with their placeholders, and any arguments only as redactable text, so they can't be
+// re-run faithfully.
+func replaySkipReason(query string) string {
+	switch {
+	case !isWriteStatement(query):
+		return "does not change data or schema"
+	case countPlaceholders(query) > 0:
+		return "prepared statement arguments are not logged faithfully"
+	}
+	return ""
+}
+
+// ReplayQueries re-runs logged statements against the database for idx, or the tenant it is an
+// alias of, in order, creating the database if needed. Statements that don't change data or
+// schema are skipped, destructive statements are refused as ExecuteQuery refuses them, and the
+// rest are rewritten for SQLite as they are for MySQL clients, with TIMESTAMP values taken to be
+// in the default time_zone. All statements share one transaction. A dry run neither creates nor
+// changes the tenant: it runs the statements against a scratch copy of its database, or of the
+// database it would be created with, and reports what would fail.
+func (h *Handler) ReplayQueries(idx string, queries []string, dryRun bool) ([]ReplayResult, error) {
+	dm := h.databaseManager
+	if idx == "" {
+		idx = "default"
+	}
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return nil, fmt.Errorf("replaying into a MySQL default database is not supported")
+	}
+	location, err := h.sessionLocation(NewSessionVariables())
+	if err != nil {
+		return nil, err
+	}
+
+	var db *sql.DB
+	if dryRun {
+		scratch, err := dm.scratchCopy(idx)
+		if err != nil {
+			return nil, err
+		}
+		defer scratch.Close()
+		db = scratch
+	} else if db, err = dm.GetOrCreateDatabase(idx); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin replay into idx %s: %v", idx, err)
+	}
+	defer tx.Rollback()
+
+	results := make([]ReplayResult, len(queries))
+	replayed, schemaChanged := 0, false
+	for i, query := range queries {
+		if results[i].Skipped = replaySkipReason(query); results[i].Skipped != "" {
+			continue
+		}
+		if results[i].Err = dm.checkDestructive(idx, query); results[i].Err != nil {
+			continue
+		}
+
+		// ALTER TABLE ... ADD COLUMN is translated as it is for MySQL clients
+		query = h.withoutLockingClause(idx, query)
+		statements, ok := translateAddColumns(query)
+		if !ok {
+			statements = []string{query}
+		}
+		for _, statement := range statements {
+			// The columns are read in the replay transaction, which sees the tables it created
+			statement, _ = timestampsToUTC(readColumnTypes(tx), statement, nil, location)
+			result, err := tx.Exec(statement)
+			if err != nil {
+				results[i].Err = err
+				break
+			}
+			affected, _ := result.RowsAffected()
+			results[i].RowsAffected += affected
+		}
+		if results[i].Err == nil {
+			replayed++
+			schemaChanged = schemaChanged || isDDLStatement(query)
+		}
+	}
+
+	if dryRun {
+		return results, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit replay into idx %s: %v", idx, err)
+	}
+	if schemaChanged {
+		dm.markSchemaModified(idx)
+	}
+
+	dm.logger.Printf("Replayed %d of %d logged statements into idx %s", replayed, len(queries), idx)
+	return results, nil
+}
+
+// scratchCopy returns a private in-memory copy of the database for idx, which the caller closes.
+// A stored tenant is opened to be copied, but a tenant that does not exist is not created: the
+// copy then holds the sample data it would be created with.
+func (dm *DatabaseManager) scratchCopy(idx string) (*sql.DB, error) {
+	db, exists, err := dm.openDatabase(idx)
+	if err != nil {
+		return nil, err
+	}
+	scratch, err := openMemoryDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open scratch database for idx %s: %v", idx, err)
+	}
+	if !exists {
+		dm.dbMu.RLock()
+		dm.createSampleData(scratch, idx)
+		dm.dbMu.RUnlock()
+		return scratch, nil
+	}
+	if err := copyDatabaseObjects(db, scratch); err != nil {
+		scratch.Close()
+		return nil, fmt.Errorf("failed to copy database for idx %s: %v", idx, err)
+	}
+	return scratch, nil
+}
+
+// copyDatabaseObjects copies every table with its rows, index, view and trigger of src into the
+// empty database dst, along with the AUTOINCREMENT sequences. Triggers are created once the rows
+// are in, so copying them fires none.
+func copyDatabaseObjects(src, dst *sql.DB) error {
+	srcTx, err := src.Begin()
+	if err != nil {
+		return err
+	}
+	defer srcTx.Rollback()
+	dstTx, err := dst.Begin()
+	if err != nil {
+		return err
+	}
+	defer dstTx.Rollback()
+
+	rows, err := srcTx.Query("SELECT type, name, sql FROM sqlite_master WHERE sql IS NOT NULL AND name NOT LIKE 'sqlite_%' ORDER BY type <> 'table', type = 'trigger', rowid")
+	if err != nil {
+		return err
+	}
+	type object struct{ kind, name, sql string }
+	var objects []object
+	for rows.Next() {
+		var o object
+		if err := rows.Scan(&o.kind, &o.name, &o.sql); err != nil {
+			rows.Close()
+			return err
+		}
+		objects = append(objects, o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, o := range objects {
+		if _, err := dstTx.Exec(o.sql); err != nil {
+			return fmt.Errorf("failed to create %s %s: %v", o.kind, o.name, err)
+		}
+		if o.kind == "table" {
+			if err := copyTableRows(srcTx, dstTx, "\""+strings.ReplaceAll(o.name, "\"", "\"\"")+"\""); err != nil {
+				return fmt.Errorf("failed to copy table %s: %v", o.name, err)
+			}
+		}
+	}
+
+	var sequences int
+	if err := srcTx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE name = 'sqlite_sequence'").Scan(&sequences); err != nil {
+		return err
+	}
+	if sequences > 0 {
+		// Copying the rows advanced the sequences only as far as the highest id left
+		if _, err := dstTx.Exec("DELETE FROM sqlite_sequence"); err != nil {
+			return err
+		}
+		if err := copyTableRows(srcTx, dstTx, "sqlite_sequence"); err != nil {
+			return fmt.Errorf("failed to copy AUTOINCREMENT sequences: %v", err)
+		}
+	}
+	return dstTx.Commit()
+}
@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"multitenant-db/internal/config"
+)
+
+func TestHandler_ReplayQueriesDryRun(t *testing.T) {
+	handler := NewHandler(log.New(io.Discard, "", 0))
+	defer handler.Close()
+	dm := handler.GetDatabaseManager()
+
+	queries := []string{
+		"CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)",
+		"INSERT INTO items (id, name) VALUES (1, 'a')",
+		"INSERT INTO items (id, name) VALUES (1, 'duplicate')",
+		"UPDATE users SET age = age + 1 WHERE id = 1",
+	}
+
+	// A tenant that doesn't exist yet is not created; the statements run against the sample data
+	// it would be created with
+	results, err := handler.ReplayQueries("fresh", queries, true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if results[0].Err != nil || results[1].Err != nil || results[2].Err == nil || results[3].Err != nil || results[3].RowsAffected != 1 {
+		t.Errorf("Expected only the duplicate insert to fail, got %+v", results)
+	}
+	if dm.HasDatabase("fresh") {
+		t.Error("Expected a dry run not to create the tenant")
+	}
+
+	// An existing tenant, reached through an alias, is left untouched
+	existing, err := dm.GetOrCreateDatabase("existing")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if err := dm.SetAlias("existing_alias", "existing"); err != nil {
+		t.Fatalf("Failed to set alias: %v", err)
+	}
+	if _, err := dm.ExecuteQuery("existing", "CREATE TABLE items (id INTEGER PRIMARY KEY, name TEXT)", nil); err != nil {
+		t.Fatalf("Failed to create table: %v", err)
+	}
+	results, err = handler.ReplayQueries("existing_alias", queries[1:], true)
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if results[0].Err != nil || results[1].Err == nil {
+		t.Errorf("Expected the copy of the existing tenant's table to take the first insert only, got %+v", results)
+	}
+	var count, age int
+	if err := existing.QueryRow("SELECT COUNT(*) FROM items").Scan(&count); err != nil || count != 0 {
+		t.Errorf("Expected a dry run to leave the tenant's rows alone, got %d (%v)", count, err)
+	}
+	if err := existing.QueryRow("SELECT age FROM users WHERE id = 1").Scan(&age); err != nil || age != 30 {
+		t.Errorf("Expected the tenant's sample data unchanged, got age %d (%v)", age, err)
+	}
+
+	// Without a dry run the alias target gets the statements
+	if _, err := handler.ReplayQueries("existing_alias", queries[1:2], false); err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	if err := existing.QueryRow("SELECT COUNT(*) FROM items").Scan(&count); err != nil || count != 1 {
+		t.Errorf("Expected the replayed row in the alias target, got %d (%v)", count, err)
+	}
+}
+
+func TestHandler_ReplayQueriesTimestamps(t *testing.T) {
+	cfg := config.NewConfig()
+	cfg.DefaultTimeZone = "+02:00"
+	handler, err := NewHandlerWithConfig(log.New(io.Discard, "", 0), cfg)
+	if err != nil {
+		t.Fatalf("Failed to create handler: %v", err)
+	}
+	defer handler.Close()
+
+	// Logged TIMESTAMP literals are in the client's zone and are stored in UTC, as when a client ran them
+	_, err = handler.ReplayQueries("clock", []string{
+		"CREATE TABLE events (id INTEGER PRIMARY KEY, at TIMESTAMP)",
+		"INSERT INTO events (id, at) VALUES (1, '2024-05-01 12:00:00')",
+	}, false)
+	if err != nil {
+		t.Fatalf("Replay failed: %v", err)
+	}
+	db, err := handler.GetDatabaseManager().GetOrCreateDatabase("clock")
+	if err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	var stored string
+	if err := db.QueryRow("SELECT CAST(at AS TEXT) FROM events").Scan(&stored); err != nil {
+		t.Fatalf("Failed to read the replayed row: %v", err)
+	}
+	if stored != "2024-05-01 10:00:00" {
+		t.Errorf("Expected the timestamp stored in UTC, got %s", stored)
+	}
+}
@@ -0,0 +1,192 @@
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"multitenant-db/internal/config"
+)
+
+// TableSchema describes the columns of one tenant table
+type TableSchema struct {
+	Name    string
+	Columns []ColumnSchema // Columns in declaration order
+}
+
+// ColumnSchema describes one column of a tenant table
+type ColumnSchema struct {
+	Name       string
+	Type       string // Declared type, as the client wrote it
+	NotNull    bool
+	PrimaryKey bool
+}
+
+// ColumnRef names a column of a table and its declared type
+type ColumnRef struct {
+	Table  string
+	Column string
+	Type   string
+}
+
+// TypeMismatch is a column both schemas have with different declared types
+type TypeMismatch struct {
+	Table      string
+	Column     string
+	SourceType string
+	TargetType string
+}
+
+// SchemaDiff lists how the schema of a source database differs from a target database's
+type SchemaDiff struct {
+	TablesOnlyInSource  []string
+	TablesOnlyInTarget  []string
+	ColumnsOnlyInSource []ColumnRef // Columns of tables both databases have
+	ColumnsOnlyInTarget []ColumnRef
+	TypeMismatches      []TypeMismatch
+}
+
+// Identical reports whether the diff found no differences
+func (d *SchemaDiff) Identical() bool {
+	return len(d.TablesOnlyInSource) == 0 && len(d.TablesOnlyInTarget) == 0 &&
+		len(d.ColumnsOnlyInSource) == 0 && len(d.ColumnsOnlyInTarget) == 0 && len(d.TypeMismatches) == 0
+}
+
+// GetSchema returns the tables of idx ordered by name, each with its columns in declaration order.
+// A tenant the store has persisted is opened if it is not open.
+func (dm *DatabaseManager) GetSchema(idx string) ([]TableSchema, error) {
+	if idx == "" {
+		idx = "default"
+	}
+
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+	db, exists, err := dm.openDatabase(idx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database for idx %s: %v", idx, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("database for idx %s does not exist", idx)
+	}
+	if dm.isDefaultDatabase(idx) && dm.defaultConfig != nil && dm.defaultConfig.Type == config.DatabaseTypeMySQL {
+		return nil, fmt.Errorf("reading the schema of a MySQL default database is not supported")
+	}
+
+	tables, err := listUserTables(db, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables for idx %s: %v", idx, err)
+	}
+
+	schema := make([]TableSchema, 0, len(tables))
+	for _, table := range tables {
+		columns, err := tableColumns(db, table.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read columns of %s for idx %s: %v", table.Name, idx, err)
+		}
+		schema = append(schema, TableSchema{Name: table.Name, Columns: columns})
+	}
+	return schema, nil
+}
+
+// sqlQuerier runs queries on a database, or within a transaction on one
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// tableColumns returns the columns of a table in declaration order
+func tableColumns(db sqlQuerier, table string) ([]ColumnSchema, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(\"%s\")", strings.ReplaceAll(table, "\"", "\"\"")))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columns []ColumnSchema
+	for rows.Next() {
+		// table_info columns: cid, name, type, notnull, dflt_value, pk
+		var cid, notNull, pk int
+		var name, dataType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &dataType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, err
+		}
+		columns = append(columns, ColumnSchema{Name: name, Type: dataType, NotNull: notNull != 0, PrimaryKey: pk != 0})
+	}
+	return columns, rows.Err()
+}
+
+// CompareSchemas reads the schemas of sourceIdx and targetIdx and returns how they differ: the
+// tables and columns only one of them has, and the columns whose declared types differ. Types are
+// compared case-insensitively, so INT and int match while INT and BIGINT do not.
+func (dm *DatabaseManager) CompareSchemas(sourceIdx, targetIdx string) (*SchemaDiff, error) {
+	source, err := dm.GetSchema(sourceIdx)
+	if err != nil {
+		return nil, err
+	}
+	target, err := dm.GetSchema(targetIdx)
+	if err != nil {
+		return nil, err
+	}
+	return diffSchemas(source, target), nil
+}
+
+// diffSchemas compares two schemas as returned by GetSchema
+func diffSchemas(source, target []TableSchema) *SchemaDiff {
+	diff := &SchemaDiff{
+		TablesOnlyInSource:  []string{},
+		TablesOnlyInTarget:  []string{},
+		ColumnsOnlyInSource: []ColumnRef{},
+		ColumnsOnlyInTarget: []ColumnRef{},
+		TypeMismatches:      []TypeMismatch{},
+	}
+
+	targetTables := make(map[string]TableSchema, len(target))
+	for _, table := range target {
+		targetTables[strings.ToLower(table.Name)] = table
+	}
+	sourceTables := make(map[string]bool, len(source))
+
+	for _, table := range source {
+		sourceTables[strings.ToLower(table.Name)] = true
+		other, ok := targetTables[strings.ToLower(table.Name)]
+		if !ok {
+			diff.TablesOnlyInSource = append(diff.TablesOnlyInSource, table.Name)
+			continue
+		}
+
+		otherColumns := make(map[string]ColumnSchema, len(other.Columns))
+		for _, column := range other.Columns {
+			otherColumns[strings.ToLower(column.Name)] = column
+		}
+		for _, column := range table.Columns {
+			otherColumn, ok := otherColumns[strings.ToLower(column.Name)]
+			if !ok {
+				diff.ColumnsOnlyInSource = append(diff.ColumnsOnlyInSource, ColumnRef{Table: table.Name, Column: column.Name, Type: column.Type})
+				continue
+			}
+			delete(otherColumns, strings.ToLower(column.Name))
+			if !strings.EqualFold(strings.Join(strings.Fields(column.Type), " "), strings.Join(strings.Fields(otherColumn.Type), " ")) {
+				diff.TypeMismatches = append(diff.TypeMismatches, TypeMismatch{
+					Table:      table.Name,
+					Column:     column.Name,
+					SourceType: column.Type,
+					TargetType: otherColumn.Type,
+				})
+			}
+		}
+		// Whatever is left is only in the target, reported in its declaration order
+		for _, column := range other.Columns {
+			if _, ok := otherColumns[strings.ToLower(column.Name)]; ok {
+				diff.ColumnsOnlyInTarget = append(diff.ColumnsOnlyInTarget, ColumnRef{Table: other.Name, Column: column.Name, Type: column.Type})
+			}
+		}
+	}
+
+	for _, table := range target {
+		if !sourceTables[strings.ToLower(table.Name)] {
+			diff.TablesOnlyInTarget = append(diff.TablesOnlyInTarget, table.Name)
+		}
+	}
+	return diff
+}
@@ -1,20 +1,85 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
 	"strings"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"multitenant-db/internal/config"
 )
 
+// defaultSystemVariables holds the values reported for @@variables that a session has not set
+var defaultSystemVariables = map[string]interface{}{
+	"tx_isolation":           "REPEATABLE-READ",
+	"transaction_isolation":  "REPEATABLE-READ",
+	"tx_read_only":           0,
+	"transaction_read_only":  0,
+	"autocommit":             1,
+	"time_zone":              "SYSTEM",
+	"version":                "8.0.11", // Matches the version sent in the protocol handshake
+	"version_comment":        "multitenant-db",
+	"sql_mode":               "ONLY_FULL_GROUP_BY,STRICT_TRANS_TABLES,NO_ZERO_IN_DATE,NO_ZERO_DATE,ERROR_FOR_DIVISION_BY_ZERO,NO_ENGINE_SUBSTITUTION",
+	"lower_case_table_names": 0,
+	"max_allowed_packet":     config.DefaultMaxAllowedPacket,
+	"wait_timeout":           28800, // MySQL defaults, in seconds; idle connections are never closed
+	"interactive_timeout":    28800,
+}
+
+// readOnlySystemVariables are server settings a session cannot change, so their server value is
+// always reported
+var readOnlySystemVariables = []string{"version", "version_comment", "lower_case_table_names", "max_allowed_packet"}
+
+// sessionDBCache holds the database last resolved for a session's @idx
+type sessionDBCache struct {
+	db         *sql.DB
+	lastAccess *atomic.Int64 // Shared with the DatabaseManager so idle eviction sees cached use
+	generation uint64        // DatabaseManager generation the lookup was made at
+	tenant     string        // Tenant the lookup was made for
+}
+
 // SessionVariables holds session-specific variables
 type SessionVariables struct {
-	userVars map[string]interface{} // @variables (user-defined session variables)
-	mu       sync.RWMutex
+	userVars   map[string]interface{}        // @variables (user-defined session variables)
+	systemVars map[string]interface{}        // @@variables (session-scoped system variables)
+	warnings   []Warning                     // Diagnostics from the last statement
+	foundRows  int64                         // Row count reported by FOUND_ROWS()
+	dbCache    *sessionDBCache               // Resolved database for the current tenant
+	tenant     string                        // Current tenant as resolved by resolver ("" means default)
+	pinned     *string                       // Tenant of the statement running under an idx hint, overriding tenant
+	resolver   TenantResolver                // Decides the tenant, nil meaning @idx alone
+	username   string                        // User the client authenticated as
+	attributes map[string]string             // Connection attributes the client sent
+	nextTx     TransactionCharacteristics    // Set by SET TRANSACTION for the next transaction only
+	inTx       bool                          // Whether an explicit transaction is open
+	txReadOnly bool                          // Whether the open transaction is read only
+	host       string                        // Client address, as shown by SHOW PROCESSLIST
+	openedAt   time.Time                     // When the connection's session was created
+	lastUsed   atomic.Int64                  // UnixNano of the last lookup, so the session GC can tell it is idle
+	cancelStmt context.CancelFunc            // Cancels the statement in flight, nil between statements
+	closeConn  func()                        // Closes the client connection, nil when not served over the network
+	stmts      map[uint32]*preparedStatement // Statements prepared on the connection by statement ID
+	lastStmtID uint32                        // ID given to the most recently prepared statement
+	mu         sync.RWMutex
+}
+
+// TransactionCharacteristics are the isolation level and access mode set by SET TRANSACTION
+type TransactionCharacteristics struct {
+	IsolationLevel string // Canonical level, e.g. READ-COMMITTED ("" leaves it unchanged)
+	ReadOnly       *bool  // Access mode (nil leaves it unchanged)
 }
 
 // NewSessionVariables creates a new session variables instance
 func NewSessionVariables() *SessionVariables {
 	return &SessionVariables{
-		userVars: make(map[string]interface{}),
+		userVars:   make(map[string]interface{}),
+		systemVars: make(map[string]interface{}),
+		openedAt:   time.Now(),
 	}
 }
 
@@ -23,6 +88,7 @@ func (sv *SessionVariables) SetUser(name string, value interface{}) {
 	sv.mu.Lock()
 	defer sv.mu.Unlock()
 	sv.userVars[strings.ToLower(name)] = value
+	sv.resolveTenantLocked()
 }
 
 // GetUser gets a user-defined variable
@@ -38,6 +104,7 @@ func (sv *SessionVariables) UnsetUser(name string) {
 	sv.mu.Lock()
 	defer sv.mu.Unlock()
 	delete(sv.userVars, strings.ToLower(name))
+	sv.resolveTenantLocked()
 }
 
 // GetAllUser returns all user-defined variables
@@ -52,12 +119,324 @@ func (sv *SessionVariables) GetAllUser() map[string]interface{} {
 	return result
 }
 
+// SetSystem sets a session-scoped system variable
+func (sv *SessionVariables) SetSystem(name string, value interface{}) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.systemVars[strings.ToLower(name)] = value
+}
+
+// GetSystem gets a session-scoped system variable, falling back to the server default
+func (sv *SessionVariables) GetSystem(name string) (interface{}, bool) {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	name = strings.ToLower(name)
+	if val, exists := sv.systemVars[name]; exists {
+		return val, true
+	}
+	val, exists := defaultSystemVariables[name]
+	return val, exists
+}
+
+// GetAllSystem returns all system variables set on this session
+func (sv *SessionVariables) GetAllSystem() map[string]interface{} {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	
+	result := make(map[string]interface{})
+	for k, v := range sv.systemVars {
+		result[k] = v
+	}
+	return result
+}
+
+// SetFoundRows records the row count FOUND_ROWS() reports until the next SELECT
+func (sv *SessionVariables) SetFoundRows(n int64) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.foundRows = n
+}
+
+// GetFoundRows returns the row count of the last SELECT
+func (sv *SessionVariables) GetFoundRows() int64 {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return sv.foundRows
+}
+
+// SetNextTransaction records characteristics for the next transaction only, on top of any
+// already set for it
+func (sv *SessionVariables) SetNextTransaction(chars TransactionCharacteristics) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if chars.IsolationLevel != "" {
+		sv.nextTx.IsolationLevel = chars.IsolationLevel
+	}
+	if chars.ReadOnly != nil {
+		sv.nextTx.ReadOnly = chars.ReadOnly
+	}
+}
+
+// BeginTransaction marks an explicit transaction as open and returns the characteristics it runs
+// with, consuming any set for the next transaction
+func (sv *SessionVariables) BeginTransaction() TransactionCharacteristics {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	chars := sv.nextTx
+	sv.nextTx = TransactionCharacteristics{}
+	if chars.IsolationLevel == "" {
+		chars.IsolationLevel = fmt.Sprint(sv.systemLocked("transaction_isolation"))
+	}
+	readOnly := isEnabledValue(sv.systemLocked("transaction_read_only"))
+	if chars.ReadOnly != nil {
+		readOnly = *chars.ReadOnly
+	}
+	chars.ReadOnly = &readOnly
+	sv.inTx = true
+	sv.txReadOnly = readOnly
+	return chars
+}
+
+// EndTransaction marks the open transaction as committed or rolled back
+func (sv *SessionVariables) EndTransaction() {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.inTx = false
+	sv.txReadOnly = false
+}
+
+// InTransaction reports whether an explicit transaction is open
+func (sv *SessionVariables) InTransaction() bool {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return sv.inTx
+}
+
+// ReadOnly reports whether statements currently run read only: inside a transaction its access
+// mode decides, outside one the session's @@transaction_read_only
+func (sv *SessionVariables) ReadOnly() bool {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	if sv.inTx {
+		return sv.txReadOnly
+	}
+	return isEnabledValue(sv.systemLocked("transaction_read_only"))
+}
+
+// systemLocked returns a system variable's session value or server default; sv.mu must be held
+func (sv *SessionVariables) systemLocked(name string) interface{} {
+	if val, exists := sv.systemVars[name]; exists {
+		return val
+	}
+	return defaultSystemVariables[name]
+}
+
+// isEnabledValue reports whether a boolean system variable value is on
+func isEnabledValue(value interface{}) bool {
+	switch v := value.(type) {
+	case int:
+		return v != 0
+	case string:
+		return strings.EqualFold(v, "on") || v == "1"
+	}
+	return false
+}
+
+// trackStatement records how to cancel the statement the session is running; nil marks the
+// statement as finished
+func (sv *SessionVariables) trackStatement(cancel context.CancelFunc) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.cancelStmt = cancel
+}
+
+// CancelStatement interrupts the statement the session is running, as KILL QUERY does, and
+// reports whether there was one. The connection stays open.
+func (sv *SessionVariables) CancelStatement() bool {
+	sv.mu.RLock()
+	cancel := sv.cancelStmt
+	sv.mu.RUnlock()
+	if cancel == nil {
+		return false
+	}
+	cancel()
+	return true
+}
+
+// setConnectionCloser records how to close the session's client connection
+func (sv *SessionVariables) setConnectionCloser(closeConn func()) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.closeConn = closeConn
+}
+
+// CloseConnection interrupts the session's statement and closes its client connection, as
+// KILL CONNECTION does
+func (sv *SessionVariables) CloseConnection() {
+	sv.CancelStatement()
+	sv.mu.RLock()
+	closeConn := sv.closeConn
+	sv.mu.RUnlock()
+	if closeConn != nil {
+		closeConn()
+	}
+}
+
+// CurrentTenant returns the tenant the session is bound to ("" means default), or the one its
+// statement is pinned to while it runs
+func (sv *SessionVariables) CurrentTenant() string {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return sv.currentTenantLocked()
+}
+
+// currentTenantLocked returns the session's current tenant; sv.mu must be held
+func (sv *SessionVariables) currentTenantLocked() string {
+	if sv.pinned != nil {
+		return *sv.pinned
+	}
+	return sv.tenant
+}
+
+// pinTenant routes the session to tenant for the statement about to run, leaving the tenant it
+// is bound to untouched; unpinTenant ends it
+func (sv *SessionVariables) pinTenant(tenant string) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.pinned = &tenant
+}
+
+// unpinTenant routes the session back to the tenant it is bound to
+func (sv *SessionVariables) unpinTenant() {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.pinned = nil
+}
+
+// setTenantResolver sets how the session's tenant is decided and resolves it again
+func (sv *SessionVariables) setTenantResolver(resolver TenantResolver) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.resolver = resolver
+	sv.resolveTenantLocked()
+}
+
+// setClient records who the client authenticated as and the connection attributes it sent,
+// and resolves the tenant again
+func (sv *SessionVariables) setClient(username string, attributes map[string]string) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.username = username
+	sv.attributes = attributes
+	sv.resolveTenantLocked()
+}
+
+// Username returns the user the client authenticated as
+func (sv *SessionVariables) Username() string {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return sv.username
+}
+
+// Host returns the address the client connected from, or "" before OpenSession
+func (sv *SessionVariables) Host() string {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	return sv.host
+}
+
+// tenantWithUserVars returns the tenant the session would be bound to with changes applied to its
+// user-defined variables, a nil value unsetting one, without changing anything
+func (sv *SessionVariables) tenantWithUserVars(changes map[string]interface{}) string {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	userVars := make(map[string]interface{}, len(sv.userVars)+len(changes))
+	for name, value := range sv.userVars {
+		userVars[name] = value
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(userVars, name)
+		} else {
+			userVars[name] = value
+		}
+	}
+	resolver := sv.resolver
+	if resolver == nil {
+		resolver = defaultTenantResolver
+	}
+	tenant, _ := resolver.ResolveTenant(TenantContext{
+		UserVars:   userVars,
+		Username:   sv.username,
+		Attributes: sv.attributes,
+	})
+	return tenant
+}
+
+// resolveTenantLocked decides the session's tenant again, dropping the cached database when it
+// changes; sv.mu must be held for writing
+func (sv *SessionVariables) resolveTenantLocked() {
+	resolver := sv.resolver
+	if resolver == nil {
+		resolver = defaultTenantResolver
+	}
+	tenant, _ := resolver.ResolveTenant(TenantContext{
+		UserVars:   sv.userVars,
+		Username:   sv.username,
+		Attributes: sv.attributes,
+	})
+	if tenant != sv.tenant {
+		sv.dbCache = nil
+		sv.tenant = tenant
+	}
+}
+
+// tenantIDString converts an @idx value to a tenant ID, regardless of its original type
+func tenantIDString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return fmt.Sprintf("%d", v)
+	case int64:
+		return fmt.Sprintf("%d", v)
+	case float64:
+		// Shortest exact form: 1.5 stays 1.5 and 1e20 is written out in full
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// cachedDatabase returns the cached database lookup if it is still valid for tenant at generation
+func (sv *SessionVariables) cachedDatabase(tenant string, generation uint64) *sessionDBCache {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+	if sv.dbCache == nil || sv.dbCache.generation != generation || sv.dbCache.tenant != tenant {
+		return nil
+	}
+	return sv.dbCache
+}
+
+// cacheDatabase stores the database resolved for the current tenant
+func (sv *SessionVariables) cacheDatabase(cache *sessionDBCache) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.dbCache = cache
+}
+
 // SessionManager manages sessions for connections
 type SessionManager struct {
 	sessions          map[uint32]*SessionVariables
+	connected         map[uint32]bool // Connections currently being served; guarded by sessionMu
 	sessionMu         sync.RWMutex
 	connectionCounter uint32
 	connCounterMu     sync.Mutex
+	gcMu              sync.Mutex
+	stopGC            chan struct{} // Stops the session GC loop; guarded by gcMu
+	resolver          TenantResolver // Given to new sessions, nil meaning @idx alone; guarded by sessionMu
 	
 	// Current connection tracking
 	currentConnMu sync.RWMutex
@@ -67,7 +446,8 @@ type SessionManager struct {
 // NewSessionManager creates a new session manager
 func NewSessionManager() *SessionManager {
 	return &SessionManager{
-		sessions: make(map[uint32]*SessionVariables),
+		sessions:  make(map[uint32]*SessionVariables),
+		connected: make(map[uint32]bool),
 	}
 }
 
@@ -77,19 +457,45 @@ func (sm *SessionManager) GetOrCreateSession(connID uint32) *SessionVariables {
 	defer sm.sessionMu.Unlock()
 	
 	if session, exists := sm.sessions[connID]; exists {
+		session.lastUsed.Store(time.Now().UnixNano())
 		return session
 	}
 	
 	session := NewSessionVariables()
+	session.lastUsed.Store(time.Now().UnixNano())
+	if sm.resolver != nil {
+		session.setTenantResolver(sm.resolver)
+	}
 	sm.sessions[connID] = session
 	return session
 }
 
+// OpenSession creates the session for a newly connected client, recording its address and
+// registering the connection as open until RemoveSession
+func (sm *SessionManager) OpenSession(connID uint32, host string) *SessionVariables {
+	session := sm.GetOrCreateSession(connID)
+	sm.sessionMu.Lock()
+	sm.connected[connID] = true
+	sm.sessionMu.Unlock()
+	session.mu.Lock()
+	session.host = host
+	session.mu.Unlock()
+	return session
+}
+
+// SetTenantResolver sets how the tenant of sessions created from now on is decided
+func (sm *SessionManager) SetTenantResolver(resolver TenantResolver) {
+	sm.sessionMu.Lock()
+	defer sm.sessionMu.Unlock()
+	sm.resolver = resolver
+}
+
 // RemoveSession removes a session when connection closes
 func (sm *SessionManager) RemoveSession(connID uint32) {
 	sm.sessionMu.Lock()
 	defer sm.sessionMu.Unlock()
 	delete(sm.sessions, connID)
+	delete(sm.connected, connID)
 }
 
 // GetNextConnectionID generates a unique connection ID
@@ -100,20 +506,62 @@ func (sm *SessionManager) GetNextConnectionID() uint32 {
 	return sm.connectionCounter
 }
 
-// SetCurrentConnection sets the current connection ID
+// SetCurrentConnection sets the connection a Handler bound to no connection serves. Client
+// connections are served by Handlers bound to their own connection, so this is only for driving
+// the server's Handler directly.
 func (sm *SessionManager) SetCurrentConnection(connID uint32) {
 	sm.currentConnMu.Lock()
 	defer sm.currentConnMu.Unlock()
 	sm.currentConnID = connID
 }
 
-// GetCurrentConnection gets the current connection ID
+// GetCurrentConnection gets the connection set by SetCurrentConnection
 func (sm *SessionManager) GetCurrentConnection() uint32 {
 	sm.currentConnMu.RLock()
 	defer sm.currentConnMu.RUnlock()
 	return sm.currentConnID
 }
 
+// ConnectionTenants returns the current tenant of every open session, keyed by connection ID
+func (sm *SessionManager) ConnectionTenants() map[uint32]string {
+	sm.sessionMu.RLock()
+	defer sm.sessionMu.RUnlock()
+	
+	result := make(map[uint32]string, len(sm.sessions))
+	for connID, session := range sm.sessions {
+		result[connID] = session.CurrentTenant()
+	}
+	return result
+}
+
+// ProcessInfo describes an open connection, as listed by SHOW PROCESSLIST
+type ProcessInfo struct {
+	ID       uint32
+	Host     string
+	Tenant   string // Current tenant ("" means default)
+	OpenedAt time.Time
+}
+
+// Processes returns every open connection ordered by connection ID
+func (sm *SessionManager) Processes() []ProcessInfo {
+	sm.sessionMu.RLock()
+	defer sm.sessionMu.RUnlock()
+	
+	processes := make([]ProcessInfo, 0, len(sm.sessions))
+	for connID, session := range sm.sessions {
+		session.mu.RLock()
+		processes = append(processes, ProcessInfo{
+			ID:       connID,
+			Host:     session.host,
+			Tenant:   session.currentTenantLocked(),
+			OpenedAt: session.openedAt,
+		})
+		session.mu.RUnlock()
+	}
+	sort.Slice(processes, func(i, j int) bool { return processes[i].ID < processes[j].ID })
+	return processes
+}
+
 // GetSession gets a session by connection ID
 func (sm *SessionManager) GetSession(connID uint32) (*SessionVariables, bool) {
 	sm.sessionMu.RLock()
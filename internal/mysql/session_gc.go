@@ -0,0 +1,69 @@
+package mysql
+
+import (
+	"log"
+	"time"
+)
+
+// CollectOrphanedSessions removes sessions whose connection is no longer open and that have not
+// been used for at least idle. Such sessions are recreated by lookups that race with a disconnect,
+// such as logging a statement after its client has gone, and would otherwise never be removed.
+// Returns the connection IDs of the removed sessions.
+func (sm *SessionManager) CollectOrphanedSessions(idle time.Duration) []uint32 {
+	cutoff := time.Now().Add(-idle).UnixNano()
+
+	sm.sessionMu.Lock()
+	defer sm.sessionMu.Unlock()
+
+	var removed []uint32
+	for connID, session := range sm.sessions {
+		if sm.connected[connID] || session.lastUsed.Load() > cutoff {
+			continue
+		}
+		delete(sm.sessions, connID)
+		removed = append(removed, connID)
+	}
+	return removed
+}
+
+// StartSessionGC periodically removes orphaned sessions (see CollectOrphanedSessions), treating a
+// session as idle once it has gone unused for a whole interval
+func (sm *SessionManager) StartSessionGC(interval time.Duration, logger *log.Logger) {
+	if interval <= 0 {
+		return
+	}
+
+	sm.gcMu.Lock()
+	if sm.stopGC != nil {
+		sm.gcMu.Unlock()
+		return
+	}
+	stop := make(chan struct{})
+	sm.stopGC = stop
+	sm.gcMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if removed := sm.CollectOrphanedSessions(interval); len(removed) > 0 {
+					logger.Printf("Removed %d orphaned sessions: %v", len(removed), removed)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopSessionGC stops the session GC loop if it is running
+func (sm *SessionManager) StopSessionGC() {
+	sm.gcMu.Lock()
+	defer sm.gcMu.Unlock()
+	if sm.stopGC != nil {
+		close(sm.stopGC)
+		sm.stopGC = nil
+	}
+}
@@ -0,0 +1,59 @@
+package mysql
+
+import (
+	"io"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSessionManager_CollectOrphanedSessions(t *testing.T) {
+	sm := NewSessionManager()
+
+	// A connected client keeps its session however long it idles
+	sm.OpenSession(1, "127.0.0.1:50001")
+
+	// A lookup racing with a disconnect recreates the session after RemoveSession
+	sm.OpenSession(2, "127.0.0.1:50002")
+	sm.RemoveSession(2)
+	sm.GetOrCreateSession(2).SetUser("idx", "gone")
+
+	if removed := sm.CollectOrphanedSessions(time.Hour); len(removed) != 0 {
+		t.Errorf("Recently used sessions should survive, removed %v", removed)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	removed := sm.CollectOrphanedSessions(5 * time.Millisecond)
+	if len(removed) != 1 || removed[0] != 2 {
+		t.Errorf("Expected only the orphaned session 2 to be removed, got %v", removed)
+	}
+	if _, exists := sm.GetSession(2); exists {
+		t.Error("Orphaned session should be gone")
+	}
+	if _, exists := sm.GetSession(1); !exists {
+		t.Error("Session of an open connection should be kept")
+	}
+}
+
+func TestSessionManager_StartSessionGC(t *testing.T) {
+	sm := NewSessionManager()
+	sm.StartSessionGC(20*time.Millisecond, log.New(io.Discard, "", 0))
+	defer sm.StopSessionGC()
+
+	sm.OpenSession(1, "127.0.0.1:50001")
+	sm.GetOrCreateSession(2)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, exists := sm.GetSession(2); !exists {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Session GC did not remove the orphaned session")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, exists := sm.GetSession(1); !exists {
+		t.Error("Session GC should keep the session of an open connection")
+	}
+}
@@ -225,3 +225,44 @@ func TestSessionManager_Concurrency(t *testing.T) {
 	
 	wg.Wait()
 }
+
+func TestSessionVariables_SetSystem_GetSystem(t *testing.T) {
+	sv := NewSessionVariables()
+
+	// Defaults are reported for unset system variables
+	value, exists := sv.GetSystem("tx_isolation")
+	if !exists || value != "REPEATABLE-READ" {
+		t.Errorf("Expected default tx_isolation REPEATABLE-READ, got %v", value)
+	}
+
+	sv.SetSystem("TX_ISOLATION", "READ-COMMITTED")
+	value, exists = sv.GetSystem("tx_isolation")
+	if !exists || value != "READ-COMMITTED" {
+		t.Errorf("Expected tx_isolation READ-COMMITTED, got %v", value)
+	}
+
+	// System variables don't leak into user variables
+	if _, exists := sv.GetUser("tx_isolation"); exists {
+		t.Error("System variables should be separate from user variables")
+	}
+}
+
+func TestTenantIDString(t *testing.T) {
+	for _, tt := range []struct {
+		value    interface{}
+		expected string
+	}{
+		{nil, ""},
+		{"tenant_a", "tenant_a"},
+		{42, "42"},
+		{int64(42), "42"},
+		{float64(42), "42"},
+		{1.5, "1.5"},
+		{1e20, "100000000000000000000"},
+		{-0.25, "-0.25"},
+	} {
+		if got := tenantIDString(tt.value); got != tt.expected {
+			t.Errorf("tenantIDString(%v) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
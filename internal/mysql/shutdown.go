@@ -0,0 +1,134 @@
+package mysql
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+// clientKeepAlive has TCP keepalive probe idle client connections, so one whose client vanished
+// without closing it (a half-open connection, after a crash or a network drop) fails its next
+// read and is closed, removing its session, instead of waiting forever for a command: probes
+// start after Idle without traffic, repeat every Interval, and Count unanswered ones end it
+var clientKeepAlive = net.KeepAliveConfig{Enable: true, Idle: 30 * time.Second, Interval: 10 * time.Second, Count: 3}
+
+// Serve accepts MySQL clients on listener and serves each on its own goroutine until Shutdown
+func (h *Handler) Serve(listener net.Listener) error {
+	h.serveMu.Lock()
+	if h.shuttingDown {
+		h.serveMu.Unlock()
+		listener.Close()
+		return nil
+	}
+	h.listener = listener
+	h.serveMu.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if h.isShuttingDown() {
+				return nil
+			}
+			h.logger.Printf("Failed to accept connection: %v", err)
+			continue
+		}
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if err := tcpConn.SetKeepAliveConfig(clientKeepAlive); err != nil {
+				h.logger.Printf("Failed to enable TCP keepalive for %s: %v", conn.RemoteAddr(), err)
+			}
+		}
+
+		go h.serveConnection(conn)
+	}
+}
+
+// Shutdown stops accepting MySQL clients and drains the open connections: idle ones are closed
+// straight away and busy ones once their statement has finished. Connections still running a
+// statement when ctx is done are closed forcibly, interrupting the statement, and an error
+// reports how many there were.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	h.serveMu.Lock()
+	h.shuttingDown = true
+	if h.listener != nil {
+		h.listener.Close()
+	}
+	// Wake connections waiting for their next command; writes are unaffected, so a statement in
+	// flight still delivers its result before the connection closes
+	for conn := range h.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	open := len(h.conns)
+	h.serveMu.Unlock()
+
+	if open > 0 {
+		h.logger.Printf("Draining %d MySQL connections", open)
+	}
+	drained := make(chan struct{})
+	go func() {
+		h.connsDone.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	h.serveMu.Lock()
+	remaining := make(map[net.Conn]*SessionVariables, len(h.conns))
+	for conn, session := range h.conns {
+		remaining[conn] = session
+	}
+	h.serveMu.Unlock()
+	for conn, session := range remaining {
+		if session != nil {
+			session.CloseConnection()
+		} else {
+			conn.Close()
+		}
+	}
+	h.logger.Printf("Force-closed %d MySQL connections still busy after the shutdown grace period", len(remaining))
+	return fmt.Errorf("force-closed %d MySQL connections: %w", len(remaining), ctx.Err())
+}
+
+// isShuttingDown reports whether Shutdown has been called
+func (h *Handler) isShuttingDown() bool {
+	h.serveMu.Lock()
+	defer h.serveMu.Unlock()
+	return h.shuttingDown
+}
+
+// trackConnection registers a client connection for draining, and refuses it with false once
+// shutdown has begun
+func (h *Handler) trackConnection(conn net.Conn) bool {
+	h.serveMu.Lock()
+	defer h.serveMu.Unlock()
+	if h.shuttingDown {
+		return false
+	}
+	if h.conns == nil {
+		h.conns = make(map[net.Conn]*SessionVariables)
+	}
+	h.conns[conn] = nil
+	h.connsDone.Add(1)
+	return true
+}
+
+// trackSession records the session of a tracked connection once it is authenticated
+func (h *Handler) trackSession(conn net.Conn, session *SessionVariables) {
+	h.serveMu.Lock()
+	defer h.serveMu.Unlock()
+	if _, tracked := h.conns[conn]; tracked {
+		h.conns[conn] = session
+	}
+}
+
+// untrackConnection removes a client connection that has finished being served
+func (h *Handler) untrackConnection(conn net.Conn) {
+	h.serveMu.Lock()
+	defer h.serveMu.Unlock()
+	delete(h.conns, conn)
+	h.connsDone.Done()
+}
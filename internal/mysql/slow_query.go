@@ -0,0 +1,89 @@
+package mysql
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// explainsSlowQueries reports whether the query plan of a statement that ran for duration should
+// be captured for the query log
+func (h *Handler) explainsSlowQueries(duration time.Duration) bool {
+	cfg := h.Config()
+	return cfg != nil && cfg.SlowQueryExplain && duration >= cfg.SlowQueryThreshold
+}
+
+// isExplainable reports whether SQLite can explain query: a SELECT, WITH or data change, as
+// opposed to the SHOW, SET and other statements the handler answers itself
+func isExplainable(query string) bool {
+	switch statementKeyword(blankQuoted(query)) {
+	case "select":
+		return !sleepRegex.MatchString(query)
+	case "with":
+		return true
+	}
+	return isDataChange(query)
+}
+
+// captureQueryPlan returns the query plan of a slow statement, explaining it as rewritten for
+// SQLite, or "" when it cannot be explained. Each statement of a multi-statement query is
+// explained on its own, as EXPLAIN only covers the first statement it is given.
+func (h *Handler) captureQueryPlan(db *sql.DB, query string) string {
+	var plans []string
+	for _, statement := range splitStatements(query) {
+		if !isExplainable(statement) {
+			continue
+		}
+		if h.mysqlCompat() {
+			if stripped, ok := stripLockingClause(statement); ok {
+				statement = stripped
+			}
+		}
+		if stripped, ok := stripCalcFoundRows(statement); ok {
+			statement = stripped
+		}
+		plan, err := queryPlan(db, statement)
+		if err != nil {
+			h.logger.Printf("Failed to capture the query plan of a slow query: %v", err)
+			return ""
+		}
+		plans = append(plans, plan)
+	}
+	return strings.Join(plans, "\n")
+}
+
+// queryPlan returns the EXPLAIN QUERY PLAN of query against db, one step per line and indented
+// by depth the way the sqlite3 shell prints it. The statement is prepared rather than queried,
+// so only its first statement is compiled and nothing after it ever runs.
+func queryPlan(db *sql.DB, query string) (string, error) {
+	stmt, err := db.Prepare("EXPLAIN QUERY PLAN " + query)
+	if err != nil {
+		return "", err
+	}
+	defer stmt.Close()
+	rows, err := stmt.Query()
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	depth := make(map[int64]int)
+	var lines []string
+	for rows.Next() {
+		var id, parent, notUsed int64
+		var detail string
+		if err := rows.Scan(&id, &parent, &notUsed, &detail); err != nil {
+			return "", err
+		}
+		level := 0
+		if parent != 0 {
+			level = depth[parent] + 1
+		}
+		depth[id] = level
+		lines = append(lines, strings.Repeat("  ", level)+detail)
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
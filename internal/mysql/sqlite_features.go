@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// missingFeatures lists the SQLite errors raised when a statement needs a feature the SQLite
+// build was compiled without, with the capability each one lacks
+var missingFeatures = []struct {
+	pattern *regexp.Regexp
+	feature string
+}{
+	{regexp.MustCompile(`(?i)no such function: jsonb?_\w+|no such table: json_(each|tree)\b`), "JSON functions (JSON1)"},
+	{regexp.MustCompile(`(?i)no such module: fts[345]\b`), "full-text search (FTS)"},
+	{regexp.MustCompile(`(?i)near "returning": syntax error`), "RETURNING clauses"},
+}
+
+// missingFeatureError translates a SQLite error caused by a feature missing from the SQLite
+// build into a MySQL error naming that capability. Any other error yields nil.
+func missingFeatureError(err error) error {
+	for _, missing := range missingFeatures {
+		if missing.pattern.MatchString(err.Error()) {
+			return mysql.NewError(mysql.ER_NOT_SUPPORTED_YET,
+				fmt.Sprintf("This server's SQLite build doesn't support %s (%v)", missing.feature, err))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package mysql
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// TenantError is the most recent error a tenant ran into, such as a failed open or a rejected
+// statement
+type TenantError struct {
+	Message string
+	At      time.Time
+}
+
+// TenantQuery is the most recent statement a tenant ran, shortened to a preview
+type TenantQuery struct {
+	Query string
+	At    time.Time
+}
+
+// lastQueryPreviewLength is how many characters of a tenant's last statement are kept
+const lastQueryPreviewLength = 200
+
+// tenantDiagnostics holds the most recent error and statement recorded under one idx, behind a
+// lock of its own so recording them never contends across tenants
+type tenantDiagnostics struct {
+	mu        sync.Mutex
+	lastError *TenantError
+	lastQuery *TenantQuery
+}
+
+// diagnosticsFor returns the diagnostics recorded under idx, creating them on first use
+func (dm *DatabaseManager) diagnosticsFor(idx string) *tenantDiagnostics {
+	if diagnostics, ok := dm.diagnostics.Load(idx); ok {
+		return diagnostics.(*tenantDiagnostics)
+	}
+	diagnostics, _ := dm.diagnostics.LoadOrStore(idx, &tenantDiagnostics{})
+	return diagnostics.(*tenantDiagnostics)
+}
+
+// RecordTenantError remembers err as the most recent error for idx, replacing any earlier one.
+// It is kept under idx as given, without resolving aliases, so recording stays off dbMu; the
+// readers combine an idx with its aliases.
+func (dm *DatabaseManager) RecordTenantError(idx string, err error) {
+	if err == nil {
+		return
+	}
+	if idx == "" {
+		idx = "default"
+	}
+
+	diagnostics := dm.diagnosticsFor(idx)
+	diagnostics.mu.Lock()
+	defer diagnostics.mu.Unlock()
+	diagnostics.lastError = &TenantError{Message: err.Error(), At: dm.now()}
+}
+
+// LastError returns the most recent error recorded for the database idx resolves to, through
+// any of its aliases, if any
+func (dm *DatabaseManager) LastError(idx string) (TenantError, bool) {
+	var latest *TenantError
+	for _, diagnostics := range dm.sharedDiagnostics(idx) {
+		diagnostics.mu.Lock()
+		if lastError := diagnostics.lastError; lastError != nil && (latest == nil || lastError.At.After(latest.At)) {
+			latest = lastError
+		}
+		diagnostics.mu.Unlock()
+	}
+	if latest == nil {
+		return TenantError{}, false
+	}
+	return *latest, true
+}
+
+// RecordTenantQuery remembers query as the most recent statement idx ran, with runs of
+// whitespace collapsed and cut to lastQueryPreviewLength characters. Callers redact literals
+// first. Like errors, statements are kept under idx as given.
+func (dm *DatabaseManager) RecordTenantQuery(idx string, query string) {
+	if idx == "" {
+		idx = "default"
+	}
+
+	preview := strings.Join(strings.Fields(query), " ")
+	if runes := []rune(preview); len(runes) > lastQueryPreviewLength {
+		preview = string(runes[:lastQueryPreviewLength]) + "..."
+	}
+
+	diagnostics := dm.diagnosticsFor(idx)
+	diagnostics.mu.Lock()
+	defer diagnostics.mu.Unlock()
+	diagnostics.lastQuery = &TenantQuery{Query: preview, At: dm.now()}
+}
+
+// LastQuery returns the most recent statement recorded for the database idx resolves to, through
+// any of its aliases, if any
+func (dm *DatabaseManager) LastQuery(idx string) (TenantQuery, bool) {
+	var latest *TenantQuery
+	for _, diagnostics := range dm.sharedDiagnostics(idx) {
+		diagnostics.mu.Lock()
+		if lastQuery := diagnostics.lastQuery; lastQuery != nil && (latest == nil || lastQuery.At.After(latest.At)) {
+			latest = lastQuery
+		}
+		diagnostics.mu.Unlock()
+	}
+	if latest == nil {
+		return TenantQuery{}, false
+	}
+	return *latest, true
+}
+
+// sharedDiagnostics returns the diagnostics recorded under the idx that idx resolves to and
+// under each alias of it
+func (dm *DatabaseManager) sharedDiagnostics(idx string) []*tenantDiagnostics {
+	if idx == "" {
+		idx = "default"
+	}
+
+	dm.dbMu.RLock()
+	names := dm.sharingNamesLocked(dm.resolveAliasLocked(idx))
+	dm.dbMu.RUnlock()
+
+	var shared []*tenantDiagnostics
+	for _, name := range names {
+		if diagnostics, ok := dm.diagnostics.Load(name); ok {
+			shared = append(shared, diagnostics.(*tenantDiagnostics))
+		}
+	}
+	return shared
+}
+
+// sharingNamesLocked returns idx and every alias resolving to it. Callers must hold dbMu.
+func (dm *DatabaseManager) sharingNamesLocked(idx string) []string {
+	names := []string{idx}
+	for alias := range dm.aliases {
+		if dm.resolveAliasLocked(alias) == idx {
+			names = append(names, alias)
+		}
+	}
+	return names
+}
+
+// clearTenantDiagnosticsLocked forgets the errors and statements recorded for idx and its aliases
+// once its database is gone. Callers must hold dbMu.
+func (dm *DatabaseManager) clearTenantDiagnosticsLocked(idx string) {
+	for _, name := range dm.sharingNamesLocked(idx) {
+		dm.diagnostics.Delete(name)
+	}
+}
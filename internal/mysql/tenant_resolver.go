@@ -0,0 +1,201 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"multitenant-db/internal/config"
+
+	"github.com/go-mysql-org/go-mysql/server"
+)
+
+// TenantContext is what a TenantResolver sees of a session: its user-defined variables and what
+// the client sent when it connected. It must not be modified.
+type TenantContext struct {
+	UserVars   map[string]interface{} // @variables, keyed by lowercased name
+	Username   string                 // User the client authenticated as
+	Attributes map[string]string      // Connection attributes sent in the handshake
+}
+
+// TenantResolver decides which tenant a session is bound to
+type TenantResolver interface {
+	// ResolveTenant returns the session's tenant ("" means default) and true, or false when the
+	// resolver has nothing to go on and the next one should be asked
+	ResolveTenant(ctx TenantContext) (string, bool)
+}
+
+// UserVariableResolver binds a session to the tenant named by a user-defined variable, @idx
+type UserVariableResolver struct {
+	Variable string
+}
+
+// ResolveTenant implements TenantResolver
+func (r UserVariableResolver) ResolveTenant(ctx TenantContext) (string, bool) {
+	value, exists := ctx.UserVars[strings.ToLower(r.Variable)]
+	if !exists || value == nil {
+		return "", false
+	}
+	return tenantIDString(value), true
+}
+
+// ConnectionAttributeResolver binds a session to the tenant named by a connection attribute,
+// such as one set through a driver's connection options
+type ConnectionAttributeResolver struct {
+	Attribute string
+}
+
+// ResolveTenant implements TenantResolver
+func (r ConnectionAttributeResolver) ResolveTenant(ctx TenantContext) (string, bool) {
+	tenant, exists := ctx.Attributes[r.Attribute]
+	if !exists || tenant == "" {
+		return "", false
+	}
+	return tenant, true
+}
+
+// UsernamePrefixResolver binds a session to the tenant its username starts with, as in
+// tenant_alpha:root
+type UsernamePrefixResolver struct {
+	Separator string
+}
+
+// ResolveTenant implements TenantResolver
+func (r UsernamePrefixResolver) ResolveTenant(ctx TenantContext) (string, bool) {
+	tenant, _, found := strings.Cut(ctx.Username, r.Separator)
+	if !found || tenant == "" {
+		return "", false
+	}
+	return tenant, true
+}
+
+// DefaultTenantResolver binds every session to one configured tenant, as the last resort
+type DefaultTenantResolver struct {
+	Tenant string
+}
+
+// ResolveTenant implements TenantResolver
+func (r DefaultTenantResolver) ResolveTenant(ctx TenantContext) (string, bool) {
+	return r.Tenant, true
+}
+
+// ChainResolver asks each resolver in priority order and uses the first answer
+type ChainResolver []TenantResolver
+
+// ResolveTenant implements TenantResolver
+func (c ChainResolver) ResolveTenant(ctx TenantContext) (string, bool) {
+	for _, resolver := range c {
+		if tenant, ok := resolver.ResolveTenant(ctx); ok {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// TenantAttribute is the connection attribute naming a session's tenant
+const TenantAttribute = "idx"
+
+// UsernameTenantSeparator separates the tenant from the user in a tenant-prefixed username
+const UsernameTenantSeparator = ":"
+
+// defaultTenantResolver binds sessions through @idx alone, the behavior without configuration
+var defaultTenantResolver TenantResolver = UserVariableResolver{Variable: "idx"}
+
+// NewTenantResolver builds the resolver for the configured sources (see config.TenantResolvers),
+// asked in the order given and falling back to defaultTenant. No sources means @idx alone.
+func NewTenantResolver(sources []string, defaultTenant string) (TenantResolver, error) {
+	if len(sources) == 0 {
+		sources = []string{config.TenantResolverVariable}
+	}
+	chain := make(ChainResolver, 0, len(sources)+1)
+	for _, source := range sources {
+		switch source {
+		case config.TenantResolverVariable:
+			chain = append(chain, UserVariableResolver{Variable: "idx"})
+		case config.TenantResolverAttribute:
+			chain = append(chain, ConnectionAttributeResolver{Attribute: TenantAttribute})
+		case config.TenantResolverUsername:
+			chain = append(chain, UsernamePrefixResolver{Separator: UsernameTenantSeparator})
+		default:
+			return nil, fmt.Errorf("unknown tenant resolver %q", source)
+		}
+	}
+	return append(chain, DefaultTenantResolver{Tenant: defaultTenant}), nil
+}
+
+// loginTenant returns the tenant a client's login names through the configured idx attribute
+// or username prefix sources, asked in order, and false when it names none
+func loginTenant(sources []string, username string, attributes map[string]string) (string, bool) {
+	ctx := TenantContext{Username: username, Attributes: attributes}
+	for _, source := range sources {
+		var resolver TenantResolver
+		switch source {
+		case config.TenantResolverAttribute:
+			resolver = ConnectionAttributeResolver{Attribute: TenantAttribute}
+		case config.TenantResolverUsername:
+			resolver = UsernamePrefixResolver{Separator: UsernameTenantSeparator}
+		default:
+			continue
+		}
+		if tenant, ok := resolver.ResolveTenant(ctx); ok {
+			return tenant, true
+		}
+	}
+	return "", false
+}
+
+// usesUsernamePrefix reports whether sources include tenant-prefixed usernames
+func usesUsernamePrefix(sources []string) bool {
+	for _, source := range sources {
+		if source == config.TenantResolverUsername {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantHintRegex matches a leading /* idx=tenant */ comment pinning one statement to a tenant
+var tenantHintRegex = regexp.MustCompile(`^\s*/\*\s*idx\s*=\s*['"]?(` + config.IdxPattern + `)['"]?\s*\*/\s*`)
+
+// parseTenantHint returns the tenant a statement's leading /* idx=tenant */ hint names and the
+// statement without it, and false when it has no hint
+func parseTenantHint(query string) (string, string, bool) {
+	match := tenantHintRegex.FindStringSubmatchIndex(query)
+	if match == nil {
+		return "", query, false
+	}
+	return query[match[2]:match[3]], query[match[1]:], true
+}
+
+// tenantPrefixServer holds the server settings connections with tenant-prefixed usernames are
+// created with. Building them generates a TLS certificate, so it only happens when needed.
+var tenantPrefixServer = sync.OnceValue(server.NewDefaultServer)
+
+// tenantPrefixCredentials accepts the configured user both as is and prefixed with a tenant,
+// so tenant-prefixed usernames authenticate with the configured password
+type tenantPrefixCredentials struct {
+	username string
+	password string
+}
+
+// unprefixed strips a tenant prefix from username
+func (p tenantPrefixCredentials) unprefixed(username string) string {
+	if _, user, found := strings.Cut(username, UsernameTenantSeparator); found {
+		return user
+	}
+	return username
+}
+
+// CheckUsername implements server.CredentialProvider
+func (p tenantPrefixCredentials) CheckUsername(username string) (bool, error) {
+	return p.unprefixed(username) == p.username, nil
+}
+
+// GetCredential implements server.CredentialProvider
+func (p tenantPrefixCredentials) GetCredential(username string) (string, bool, error) {
+	if p.unprefixed(username) != p.username {
+		return "", false, nil
+	}
+	return p.password, true, nil
+}
@@ -0,0 +1,150 @@
+package mysql
+
+import (
+	"testing"
+
+	"multitenant-db/internal/config"
+)
+
+func TestUserVariableResolver(t *testing.T) {
+	resolver := UserVariableResolver{Variable: "idx"}
+
+	if _, ok := resolver.ResolveTenant(TenantContext{}); ok {
+		t.Error("Expected no tenant without @idx")
+	}
+	if _, ok := resolver.ResolveTenant(TenantContext{UserVars: map[string]interface{}{"idx": nil}}); ok {
+		t.Error("Expected no tenant for a NULL @idx")
+	}
+	if tenant, ok := resolver.ResolveTenant(TenantContext{UserVars: map[string]interface{}{"idx": int64(42)}}); !ok || tenant != "42" {
+		t.Errorf("Expected tenant 42, got %q (%t)", tenant, ok)
+	}
+}
+
+func TestConnectionAttributeResolver(t *testing.T) {
+	resolver := ConnectionAttributeResolver{Attribute: TenantAttribute}
+
+	if _, ok := resolver.ResolveTenant(TenantContext{Attributes: map[string]string{"_client_name": "libmysql"}}); ok {
+		t.Error("Expected no tenant without the idx attribute")
+	}
+	if _, ok := resolver.ResolveTenant(TenantContext{Attributes: map[string]string{"idx": ""}}); ok {
+		t.Error("Expected no tenant for an empty idx attribute")
+	}
+	if tenant, ok := resolver.ResolveTenant(TenantContext{Attributes: map[string]string{"idx": "alpha"}}); !ok || tenant != "alpha" {
+		t.Errorf("Expected tenant alpha, got %q (%t)", tenant, ok)
+	}
+}
+
+func TestUsernamePrefixResolver(t *testing.T) {
+	resolver := UsernamePrefixResolver{Separator: UsernameTenantSeparator}
+
+	for _, username := range []string{"", "root", ":root"} {
+		if tenant, ok := resolver.ResolveTenant(TenantContext{Username: username}); ok {
+			t.Errorf("Expected no tenant for username %q, got %q", username, tenant)
+		}
+	}
+	if tenant, ok := resolver.ResolveTenant(TenantContext{Username: "alpha:root"}); !ok || tenant != "alpha" {
+		t.Errorf("Expected tenant alpha, got %q (%t)", tenant, ok)
+	}
+}
+
+func TestDefaultTenantResolver(t *testing.T) {
+	if tenant, ok := (DefaultTenantResolver{Tenant: "shared"}).ResolveTenant(TenantContext{}); !ok || tenant != "shared" {
+		t.Errorf("Expected tenant shared, got %q (%t)", tenant, ok)
+	}
+	if tenant, ok := (DefaultTenantResolver{}).ResolveTenant(TenantContext{}); !ok || tenant != "" {
+		t.Errorf("Expected the default database, got %q (%t)", tenant, ok)
+	}
+}
+
+func TestNewTenantResolver_Precedence(t *testing.T) {
+	resolver, err := NewTenantResolver([]string{
+		config.TenantResolverVariable,
+		config.TenantResolverAttribute,
+		config.TenantResolverUsername,
+	}, "shared")
+	if err != nil {
+		t.Fatalf("NewTenantResolver failed: %v", err)
+	}
+
+	ctx := TenantContext{
+		UserVars:   map[string]interface{}{"idx": "from_variable"},
+		Username:   "from_username:root",
+		Attributes: map[string]string{"idx": "from_attribute"},
+	}
+	steps := []struct {
+		expected string
+		drop     func()
+	}{
+		{"from_variable", func() { ctx.UserVars = nil }},
+		{"from_attribute", func() { ctx.Attributes = nil }},
+		{"from_username", func() { ctx.Username = "root" }},
+		{"shared", nil},
+	}
+	for _, step := range steps {
+		if tenant, _ := resolver.ResolveTenant(ctx); tenant != step.expected {
+			t.Errorf("Expected tenant %s, got %q", step.expected, tenant)
+		}
+		if step.drop != nil {
+			step.drop()
+		}
+	}
+
+	// Order is configurable: the attribute can outrank @idx
+	resolver, err = NewTenantResolver([]string{config.TenantResolverAttribute, config.TenantResolverVariable}, "")
+	if err != nil {
+		t.Fatalf("NewTenantResolver failed: %v", err)
+	}
+	ctx = TenantContext{
+		UserVars:   map[string]interface{}{"idx": "from_variable"},
+		Attributes: map[string]string{"idx": "from_attribute"},
+	}
+	if tenant, _ := resolver.ResolveTenant(ctx); tenant != "from_attribute" {
+		t.Errorf("Expected the attribute to take precedence, got %q", tenant)
+	}
+
+	if _, err := NewTenantResolver([]string{"cookie"}, ""); err == nil {
+		t.Error("Expected error for an unknown tenant resolver")
+	}
+}
+
+func TestSessionVariables_TenantResolver(t *testing.T) {
+	resolver, err := NewTenantResolver([]string{config.TenantResolverVariable, config.TenantResolverAttribute}, "")
+	if err != nil {
+		t.Fatalf("NewTenantResolver failed: %v", err)
+	}
+	sm := NewSessionManager()
+	sm.SetTenantResolver(resolver)
+
+	session := sm.OpenSession(1, "127.0.0.1:50001")
+	session.setClient("root", map[string]string{"idx": "alpha"})
+	if tenant := session.CurrentTenant(); tenant != "alpha" {
+		t.Errorf("Expected the connection attribute to bind tenant alpha, got %q", tenant)
+	}
+
+	session.SetUser("idx", "beta")
+	if tenant := session.CurrentTenant(); tenant != "beta" {
+		t.Errorf("Expected @idx to take precedence, got %q", tenant)
+	}
+
+	// Clearing @idx falls back to the attribute rather than the default database
+	session.UnsetUser("idx")
+	if tenant := session.CurrentTenant(); tenant != "alpha" {
+		t.Errorf("Expected to fall back to tenant alpha, got %q", tenant)
+	}
+}
+
+func TestTenantPrefixCredentials(t *testing.T) {
+	credentials := tenantPrefixCredentials{username: "root", password: "secret"}
+
+	for _, username := range []string{"root", "alpha:root"} {
+		if ok, _ := credentials.CheckUsername(username); !ok {
+			t.Errorf("Expected %q to be accepted", username)
+		}
+		if password, found, _ := credentials.GetCredential(username); !found || password != "secret" {
+			t.Errorf("Expected the configured password for %q, got %q (%t)", username, password, found)
+		}
+	}
+	if ok, _ := credentials.CheckUsername("alpha:admin"); ok {
+		t.Error("Expected a different user to be refused")
+	}
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// TenantStore provides the storage behind tenant databases. The DatabaseManager keeps track of
+// open tenants, last access and eviction; a store only opens, closes and removes the underlying
+// databases, so alternative backends can be plugged in without touching that bookkeeping.
+type TenantStore interface {
+	// GetOrCreate opens the database for idx, creating its storage if it does not exist yet
+	GetOrCreate(idx string) (*sql.DB, error)
+	// Close releases db without removing its storage, e.g. when an idle tenant is evicted
+	Close(idx string, db *sql.DB) error
+	// Delete closes db and permanently removes the storage for idx
+	Delete(idx string, db *sql.DB) error
+	// List returns the idx of every tenant whose storage outlives its connection
+	List() ([]string, error)
+}
+
+// PragmaTenantStore is implemented by tenant stores that can open a database with SQLite pragmas
+// applied to every connection of its pool. The DatabaseManager uses it when tenant pragmas are set.
+type PragmaTenantStore interface {
+	// GetOrCreateWithPragmas opens the database for idx like GetOrCreate, with every connection
+	// using the given PRAGMA cache_size and mmap_size
+	GetOrCreateWithPragmas(idx string, cacheSize, mmapSize int) (*sql.DB, error)
+}
+
+// pragmaDriverName is the SQLite driver that applies the _mmap_size DSN parameter to each new
+// connection, alongside the _cache_size go-sqlite3 already understands
+const pragmaDriverName = "sqlite3_pragmas"
+
+func init() {
+	sql.Register(pragmaDriverName, &pragmaDriver{})
+}
+
+// pragmaDriver opens SQLite connections like go-sqlite3 and then sets their mmap_size
+type pragmaDriver struct {
+	sqlite3.SQLiteDriver
+}
+
+// Open opens a connection for dsn, running PRAGMA mmap_size when the DSN sets _mmap_size
+func (d *pragmaDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.SQLiteDriver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if _, query, ok := strings.Cut(dsn, "?"); ok {
+		if params, err := url.ParseQuery(query); err == nil && params.Get("_mmap_size") != "" {
+			mmapSize, err := strconv.Atoi(params.Get("_mmap_size"))
+			if err == nil {
+				_, err = conn.(*sqlite3.SQLiteConn).Exec(fmt.Sprintf("PRAGMA mmap_size = %d", mmapSize), nil)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, fmt.Errorf("failed to set mmap_size: %v", err)
+			}
+		}
+	}
+	return conn, nil
+}
+
+// withPragmas opens dsn with the pragma driver, adding DSN parameters that set cache_size and
+// mmap_size on every connection the pool opens
+func withPragmas(dsn string, cacheSize, mmapSize int) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(dsn, "?") {
+		separator = "&"
+	}
+	return sql.Open(pragmaDriverName, fmt.Sprintf("%s%s_cache_size=%d&_mmap_size=%d", dsn, separator, cacheSize, mmapSize))
+}
+
+// memoryDatabases hands out process-unique names for in-memory SQLite databases
+var memoryDatabases atomic.Int64
+
+// memoryBusyTimeout is how long a statement on an in-memory database waits for another
+// connection's write to finish before failing with "database is locked"
+const memoryBusyTimeout = 5 * time.Second
+
+// memoryDSN returns the DSN of a new, empty in-memory SQLite database. Each connection a pool
+// opens on ":memory:" gets an empty database of its own, so it is a named database of the memdb
+// VFS, which every connection of the pool shares. Unlike a shared-cache database it uses ordinary
+// file locking, so readers run side by side and a writer that collides with another connection
+// waits for it under the busy timeout instead of failing at once with "database table is locked".
+func memoryDSN() string {
+	return fmt.Sprintf("file:/memdb_tenant_%d?vfs=memdb&_busy_timeout=%d",
+		memoryDatabases.Add(1), memoryBusyTimeout.Milliseconds())
+}
+
+// openMemoryDatabase opens a new, empty in-memory SQLite database
+func openMemoryDatabase() (*sql.DB, error) {
+	return sql.Open("sqlite3", memoryDSN())
+}
+
+// SQLiteMemoryStore keeps every tenant in its own in-memory SQLite database. Closing a tenant
+// discards its data, so there is never anything to list.
+type SQLiteMemoryStore struct{}
+
+// NewSQLiteMemoryStore creates the default in-memory SQLite tenant store
+func NewSQLiteMemoryStore() *SQLiteMemoryStore {
+	return &SQLiteMemoryStore{}
+}
+
+// GetOrCreate opens a new in-memory SQLite database for idx
+func (s *SQLiteMemoryStore) GetOrCreate(idx string) (*sql.DB, error) {
+	db, err := openMemoryDatabase()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database for idx %s: %v", idx, err)
+	}
+	return db, nil
+}
+
+// GetOrCreateWithPragmas opens a new in-memory SQLite database for idx whose connections all use
+// cacheSize. mmap_size has no effect on in-memory databases but is set all the same.
+func (s *SQLiteMemoryStore) GetOrCreateWithPragmas(idx string, cacheSize, mmapSize int) (*sql.DB, error) {
+	db, err := withPragmas(memoryDSN(), cacheSize, mmapSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database for idx %s: %v", idx, err)
+	}
+	return db, nil
+}
+
+// Close closes db, which discards an in-memory database
+func (s *SQLiteMemoryStore) Close(idx string, db *sql.DB) error {
+	return db.Close()
+}
+
+// Delete closes db, which discards an in-memory database
+func (s *SQLiteMemoryStore) Delete(idx string, db *sql.DB) error {
+	return db.Close()
+}
+
+// List returns nothing since in-memory databases do not outlive their connection
+func (s *SQLiteMemoryStore) List() ([]string, error) {
+	return nil, nil
+}
@@ -0,0 +1,222 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTenantStore keeps tenant data in shared in-memory SQLite databases that survive Close,
+// standing in for a persistent backend
+type fakeTenantStore struct {
+	mu      sync.Mutex
+	keepers map[string]*sql.DB // holds each shared database open so its data outlives Close
+	opened  map[string]int
+	closed  map[string]int
+}
+
+func newFakeTenantStore() *fakeTenantStore {
+	return &fakeTenantStore{
+		keepers: make(map[string]*sql.DB),
+		opened:  make(map[string]int),
+		closed:  make(map[string]int),
+	}
+}
+
+func (s *fakeTenantStore) dsn(idx string) string {
+	return fmt.Sprintf("file:fake_store_%p_%s?mode=memory&cache=shared", s, idx)
+}
+
+func (s *fakeTenantStore) GetOrCreate(idx string) (*sql.DB, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.keepers[idx]; !exists {
+		keeper, err := sql.Open("sqlite3", s.dsn(idx))
+		if err != nil {
+			return nil, err
+		}
+		if err := keeper.Ping(); err != nil {
+			return nil, err
+		}
+		s.keepers[idx] = keeper
+	}
+	s.opened[idx]++
+	return sql.Open("sqlite3", s.dsn(idx))
+}
+
+func (s *fakeTenantStore) Close(idx string, db *sql.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed[idx]++
+	return db.Close()
+}
+
+func (s *fakeTenantStore) Delete(idx string, db *sql.DB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if keeper, exists := s.keepers[idx]; exists {
+		keeper.Close()
+		delete(s.keepers, idx)
+	}
+	return db.Close()
+}
+
+func (s *fakeTenantStore) List() ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var indices []string
+	for idx := range s.keepers {
+		indices = append(indices, idx)
+	}
+	return indices, nil
+}
+
+func TestDatabaseManager_TenantStore(t *testing.T) {
+	logger := log.New(os.Stdout, "[TEST] ", log.LstdFlags)
+	store := newFakeTenantStore()
+	dm, err := NewDatabaseManagerWithStore(logger, nil, store)
+	if err != nil {
+		t.Fatalf("Failed to create database manager: %v", err)
+	}
+	defer dm.Close()
+
+	db, err := dm.GetOrCreateDatabase("stored_tenant")
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	if _, err := dm.GetOrCreateDatabase("stored_tenant"); err != nil {
+		t.Fatalf("Failed to get database: %v", err)
+	}
+	if store.opened["stored_tenant"] != 1 {
+		t.Errorf("Expected the store to be asked once, got %d", store.opened["stored_tenant"])
+	}
+	if _, err := db.Exec("INSERT INTO users (id, name, email, age) VALUES (10, 'Erin', 'erin@example.com', 29)"); err != nil {
+		t.Fatalf("Failed to insert row: %v", err)
+	}
+
+	// Evicting hands the database back to the store without deleting it
+	time.Sleep(5 * time.Millisecond)
+	if evicted := dm.EvictIdleDatabases(time.Millisecond); len(evicted) != 1 {
+		t.Fatalf("Expected stored_tenant to be evicted, got %v", evicted)
+	}
+	if store.closed["stored_tenant"] != 1 {
+		t.Errorf("Expected the store to close the evicted database, got %d closes", store.closed["stored_tenant"])
+	}
+	if _, open := dm.LastAccessedAt("stored_tenant"); open {
+		t.Error("Evicted database should not be open")
+	}
+	if !dm.HasDatabase("stored_tenant") {
+		t.Error("Evicted database should still exist in the store")
+	}
+
+	// Persisted tenants are still listed and reopen with their data
+	indices := dm.ListDatabases()
+	sort.Strings(indices)
+	if !stringInSlice("stored_tenant", indices) {
+		t.Errorf("Expected stored_tenant to be listed from the store, got %v", indices)
+	}
+
+	db, err = dm.GetOrCreateDatabase("stored_tenant")
+	if err != nil {
+		t.Fatalf("Failed to reopen database: %v", err)
+	}
+	var name string
+	if err := db.QueryRow("SELECT name FROM users WHERE id = 10").Scan(&name); err != nil || name != "Erin" {
+		t.Errorf("Expected row to survive eviction, got %q (%v)", name, err)
+	}
+
+	// Deleting removes the storage, also of a tenant that is not open
+	time.Sleep(5 * time.Millisecond)
+	if evicted := dm.EvictIdleDatabases(time.Millisecond); len(evicted) != 1 {
+		t.Fatalf("Expected stored_tenant to be evicted again, got %v", evicted)
+	}
+
+	// Creating a tenant that is stored but closed neither recreates nor wipes it
+	if err := dm.CreateDatabase("stored_tenant", false, "CREATE TABLE users (id INTEGER)"); !errors.Is(err, ErrDatabaseExists) {
+		t.Errorf("Expected ErrDatabaseExists for a stored tenant, got %v", err)
+	}
+	if !stringInSlice("stored_tenant", dm.ListDatabases()) {
+		t.Error("Expected stored_tenant to survive a refused CreateDatabase")
+	}
+
+	// Reading the schema or indexes of a tenant that is stored but closed opens it
+	if schema, err := dm.GetSchema("stored_tenant"); err != nil || len(schema) == 0 {
+		t.Errorf("Expected the schema of the stored tenant, got %v (%v)", schema, err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if evicted := dm.EvictIdleDatabases(time.Millisecond); len(evicted) != 1 {
+		t.Fatalf("Expected stored_tenant to be evicted again, got %v", evicted)
+	}
+	if _, err := dm.ListIndexes("stored_tenant"); err != nil {
+		t.Errorf("Expected the indexes of the stored tenant, got %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if evicted := dm.EvictIdleDatabases(time.Millisecond); len(evicted) != 1 {
+		t.Fatalf("Expected stored_tenant to be evicted again, got %v", evicted)
+	}
+
+	// Loading into a tenant that is stored but closed opens it
+	rows := [][]interface{}{{int64(11), "Finn", "finn@example.com"}}
+	next := func() (int, []interface{}, error) {
+		if len(rows) == 0 {
+			return 0, nil, io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return 1, row, nil
+	}
+	if loaded, rowErrors, err := dm.LoadRows("stored_tenant", "users", []string{"id", "name", "email"}, next); err != nil || loaded != 1 || len(rowErrors) != 0 {
+		t.Errorf("Expected one row loaded into the stored tenant, got %d %v (%v)", loaded, rowErrors, err)
+	}
+
+	if err := dm.DeleteDatabase("stored_tenant"); err != nil {
+		t.Fatalf("Failed to delete database: %v", err)
+	}
+	if stringInSlice("stored_tenant", dm.ListDatabases()) {
+		t.Error("Deleted tenant should no longer be listed")
+	}
+	if dm.HasDatabase("stored_tenant") {
+		t.Error("Deleted tenant should no longer exist")
+	}
+	if err := dm.DeleteDatabase("stored_tenant"); err == nil {
+		t.Error("Expected an error deleting a tenant that no longer exists")
+	}
+}
+
+func TestWithPragmas_EveryConnection(t *testing.T) {
+	db, err := withPragmas(t.TempDir()+"/tenant.db", -8000, 1<<20)
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	// Hold the first connection so the second is a new one
+	first, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to open connection: %v", err)
+	}
+	defer first.Close()
+	for _, conn := range []interface {
+		QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	}{first, db} {
+		var cacheSize, mmapSize int
+		if err := conn.QueryRowContext(context.Background(), "PRAGMA cache_size").Scan(&cacheSize); err != nil {
+			t.Fatalf("Failed to read cache_size: %v", err)
+		}
+		if err := conn.QueryRowContext(context.Background(), "PRAGMA mmap_size").Scan(&mmapSize); err != nil {
+			t.Fatalf("Failed to read mmap_size: %v", err)
+		}
+		if cacheSize != -8000 || mmapSize != 1<<20 {
+			t.Errorf("Expected cache_size -8000 and mmap_size %d, got %d and %d", 1<<20, cacheSize, mmapSize)
+		}
+	}
+}
@@ -0,0 +1,535 @@
+package mysql
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"multitenant-db/internal/config"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// insertValuesRegex matches INSERT or REPLACE INTO table [(columns)] VALUES, capturing the table
+// and its column list; the rows follow the match
+var insertValuesRegex = regexp.MustCompile(`(?is)^\s*(?:insert|replace)(?:\s+or\s+\w+)?(?:\s+ignore)?\s+into\s+([^\s(]+)\s*(\([^)]*\))?\s*values\s*`)
+
+// updateSetRegex matches UPDATE table SET, capturing the table; the assignments follow the match
+var updateSetRegex = regexp.MustCompile(`(?is)^\s*update(?:\s+or\s+\w+)?(?:\s+ignore)?\s+(\S+)\s+set\s+`)
+
+// timestampValueRegex matches a datetime value, capturing its date and time to the second and any
+// fractional seconds
+var timestampValueRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})[ T](\d{2}:\d{2}:\d{2})(\.\d+)?$`)
+
+// sessionLocation returns the zone datetimes are reported in for a session: its time_zone, or
+// the configured default when the session has not set one
+func (h *Handler) sessionLocation(session *SessionVariables) (*time.Location, error) {
+	timeZone, _ := h.systemVariable(session, "time_zone")
+	return timeZoneLocation(fmt.Sprintf("%v", timeZone))
+}
+
+// timeZoneLocation resolves a time_zone value (see config.LoadTimeZone), rejecting invalid ones
+// with MySQL's ER_UNKNOWN_TIME_ZONE
+func timeZoneLocation(name string) (*time.Location, error) {
+	location, err := config.LoadTimeZone(name)
+	if err != nil {
+		return nil, mysql.NewError(mysql.ER_UNKNOWN_TIME_ZONE, fmt.Sprintf("Unknown or incorrect time zone: '%s'", name))
+	}
+	return location, nil
+}
+
+// comparisonOperators are the operators whose datetime operand is converted when the other
+// operand is a TIMESTAMP column
+var comparisonOperators = map[string]bool{
+	"=": true, "==": true, "<=>": true, "!=": true, "<>": true, "<": true, "<=": true, ">": true, ">=": true,
+}
+
+// valueSpan is the byte range of a value written to or compared with a column
+type valueSpan struct {
+	start, end int
+}
+
+// columnTypesFunc returns the columns of a table in declaration order, or nil when they cannot
+// be read
+type columnTypesFunc func(table string) []ColumnSchema
+
+// columnTypesEntry is the columns of one table, cached at a schema version
+type columnTypesEntry struct {
+	version uint64
+	columns []ColumnSchema
+}
+
+// readColumnTypes looks up the columns of tables in db each time it is asked
+func readColumnTypes(db sqlQuerier) columnTypesFunc {
+	return func(table string) []ColumnSchema {
+		columns, err := tableColumns(db, table)
+		if err != nil {
+			return nil
+		}
+		return columns
+	}
+}
+
+// cachedColumnTypes looks up the columns of the tables of idx in db, reading each table's columns
+// once per schema version rather than on every statement
+func (dm *DatabaseManager) cachedColumnTypes(db sqlQuerier, idx string) columnTypesFunc {
+	if idx == "" {
+		idx = "default"
+	}
+	dm.dbMu.RLock()
+	idx = dm.resolveAliasLocked(idx)
+	dm.dbMu.RUnlock()
+
+	return func(table string) []ColumnSchema {
+		key := idx + "\x00" + strings.ToLower(table)
+		// Load the version first, so columns read after a schema change are never cached as
+		// current for the version before it
+		version := dm.schemaVersion.Load()
+		if cached, ok := dm.columnTypes.Load(key); ok && cached.(columnTypesEntry).version == version {
+			return cached.(columnTypesEntry).columns
+		}
+		columns, err := tableColumns(db, table)
+		if err != nil {
+			return nil
+		}
+		dm.columnTypes.Store(key, columnTypesEntry{version: version, columns: columns})
+		return columns
+	}
+}
+
+// forgetColumnTypes drops the cached columns of the tables of a removed database
+func (dm *DatabaseManager) forgetColumnTypes(idx string) {
+	prefix := idx + "\x00"
+	dm.columnTypes.Range(func(key, _ interface{}) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			dm.columnTypes.Delete(key)
+		}
+		return true
+	})
+}
+
+// timestampColumns returns the lowercased names of the TIMESTAMP columns among columns
+func timestampColumns(columns []ColumnSchema) map[string]bool {
+	timestamps := make(map[string]bool)
+	for _, column := range columns {
+		if isTimestampType(column.Type) {
+			timestamps[strings.ToLower(column.Name)] = true
+		}
+	}
+	return timestamps
+}
+
+// timestampsToUTC converts datetime values for TIMESTAMP columns from the session zone to UTC,
+// the zone TIMESTAMP values are stored in and which executeSQLiteQuery reports them back from:
+// the values an INSERT, REPLACE or UPDATE writes, and the values compared with a TIMESTAMP column
+// in WHERE, ON and HAVING clauses, so filters match what was written. Quoted datetime literals
+// and string arguments bound to them are converted; expressions such as CURRENT_TIMESTAMP already
+// produce UTC in SQLite. DATETIME columns are never converted, as in MySQL.
+func timestampsToUTC(columnTypes columnTypesFunc, query string, args []interface{}, location *time.Location) (string, []interface{}) {
+	if location == time.UTC {
+		return query, args
+	}
+
+	targets := filterTimestamps(columnTypes, query)
+	targets = append(targets, writtenTimestamps(columnTypes, query)...)
+	if len(targets) == 0 {
+		return query, args
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].start < targets[j].start })
+
+	converted := append([]interface{}(nil), args...)
+	var rewritten strings.Builder
+	last := 0
+	for i, target := range targets {
+		if i > 0 && target == targets[i-1] {
+			continue
+		}
+		value := query[target.start:target.end]
+		if value == "?" {
+			index := strings.Count(blankQuoted(query[:target.start]), "?")
+			if index < len(converted) {
+				if s, ok := converted[index].(string); ok {
+					if utc, ok := timestampToUTC(s, location); ok {
+						converted[index] = utc
+					}
+				}
+			}
+			continue
+		}
+		if len(value) < 2 || value[0] != '\'' || value[len(value)-1] != '\'' {
+			continue
+		}
+		if utc, ok := timestampToUTC(value[1:len(value)-1], location); ok {
+			rewritten.WriteString(query[last:target.start])
+			rewritten.WriteString("'" + utc + "'")
+			last = target.end
+		}
+	}
+	rewritten.WriteString(query[last:])
+	return rewritten.String(), converted
+}
+
+// writtenTimestamps returns the spans of the values an INSERT, REPLACE or UPDATE writes to
+// TIMESTAMP columns
+func writtenTimestamps(columnTypes columnTypesFunc, query string) []valueSpan {
+	// Each row of values is written to names, or to every column in order when there is no list
+	var table string
+	var names []string
+	var rows [][]valueSpan
+	if matches := insertValuesRegex.FindStringSubmatchIndex(query); matches != nil {
+		table = query[matches[2]:matches[3]]
+		if matches[4] >= 0 {
+			for _, column := range splitTopLevel(query[matches[4]+1 : matches[5]-1]) {
+				names = append(names, unquoteIdentifier(column))
+			}
+		}
+		rows = insertRows(query, matches[1])
+	} else if matches := updateSetRegex.FindStringSubmatchIndex(query); matches != nil {
+		table = query[matches[2]:matches[3]]
+		var row []valueSpan
+		names, row = updateAssignments(query, matches[1])
+		rows = [][]valueSpan{row}
+	} else {
+		return nil
+	}
+
+	columns := columnTypes(unquoteIdentifier(table))
+	timestamps := timestampColumns(columns)
+	if len(timestamps) == 0 {
+		return nil
+	}
+	if names == nil {
+		for _, column := range columns {
+			names = append(names, column.Name)
+		}
+	}
+
+	var targets []valueSpan
+	for _, row := range rows {
+		for i, span := range row {
+			if i < len(names) && timestamps[strings.ToLower(names[i])] {
+				targets = append(targets, span)
+			}
+		}
+	}
+
+	return targets
+}
+
+// filterTimestamps returns the spans of the values compared with a TIMESTAMP column from the
+// first WHERE, ON or HAVING clause on: the operand of a comparison, both bounds of a BETWEEN and
+// the items of an IN list. Columns are matched by name against every table the statement reads
+// or writes.
+func filterTimestamps(columnTypes columnTypesFunc, query string) []valueSpan {
+	tokens := sqlTokens(query)
+	filter := -1
+	timestamps := make(map[string]bool)
+	for i, token := range tokens {
+		switch strings.ToLower(token.text) {
+		case "from", "join", "update", "into":
+			if i+1 < len(tokens) && tokens[i+1].kind == wordToken {
+				for name := range timestampColumns(columnTypes(unquoteIdentifier(tokens[i+1].text))) {
+					timestamps[name] = true
+				}
+			}
+		case "where", "on", "having":
+			if filter < 0 && token.kind == wordToken {
+				filter = i
+			}
+		}
+	}
+	if filter < 0 || len(timestamps) == 0 {
+		return nil
+	}
+
+	isColumn := func(i int) bool {
+		return i >= 0 && i < len(tokens) && tokens[i].kind == wordToken && timestamps[strings.ToLower(unquoteIdentifier(tokens[i].text))]
+	}
+	isValue := func(i int) bool {
+		return i >= 0 && i < len(tokens) && (tokens[i].kind == stringToken || tokens[i].kind == placeholderToken)
+	}
+	isWord := func(i int, word string) bool {
+		return i < len(tokens) && tokens[i].kind == wordToken && strings.EqualFold(tokens[i].text, word)
+	}
+
+	var targets []valueSpan
+	for i := filter + 1; i < len(tokens); i++ {
+		if tokens[i].kind == symbolToken && comparisonOperators[tokens[i].text] {
+			if isColumn(i-1) && isValue(i+1) {
+				targets = append(targets, tokens[i+1].span)
+			} else if isValue(i-1) && isColumn(i+1) {
+				targets = append(targets, tokens[i-1].span)
+			}
+			continue
+		}
+		if !isColumn(i) {
+			continue
+		}
+		next := i + 1
+		if isWord(next, "not") {
+			next++
+		}
+		switch {
+		case isWord(next, "between") && isValue(next+1) && isWord(next+2, "and") && isValue(next+3):
+			targets = append(targets, tokens[next+1].span, tokens[next+3].span)
+		case isWord(next, "in") && next+1 < len(tokens) && tokens[next+1].text == "(":
+			for j := next + 2; isValue(j); j += 2 {
+				targets = append(targets, tokens[j].span)
+				if j+1 >= len(tokens) || tokens[j+1].text != "," {
+					break
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// sqlTokenKind classifies the tokens of a statement
+type sqlTokenKind int
+
+const (
+	wordToken        sqlTokenKind = iota // Keyword or identifier, possibly qualified and quoted
+	stringToken                          // Single-quoted string literal
+	placeholderToken                     // ? placeholder
+	symbolToken                          // Operator or punctuation
+)
+
+// sqlToken is one token of a statement and its byte range
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	span valueSpan
+}
+
+// sqlTokens splits query into tokens, skipping whitespace and comments
+func sqlTokens(query string) []sqlToken {
+	var tokens []sqlToken
+	for i := 0; i < len(query); {
+		c := query[i]
+		start := i
+		kind := symbolToken
+		switch {
+		case isSpace(c):
+			i++
+			continue
+		case c == '#' || strings.HasPrefix(query[i:], "--"):
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+			continue
+		case strings.HasPrefix(query[i:], "/*"):
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(query)
+			}
+			continue
+		case c == '\'':
+			kind = stringToken
+			i += leadingToken(query[i:])
+		case c == '?':
+			kind = placeholderToken
+			i++
+		case isWordByte(c) || c == '`' || c == '"' || c == '[':
+			kind = wordToken
+			i = wordEnd(query, i)
+		default:
+			// Operators such as <=, <> and <=> are one token
+			i++
+			for i < len(query) && strings.IndexByte("<>=", query[i]) >= 0 && strings.IndexByte("<>=!", c) >= 0 {
+				i++
+			}
+		}
+		tokens = append(tokens, sqlToken{kind: kind, text: query[start:i], span: valueSpan{start: start, end: i}})
+	}
+	return tokens
+}
+
+// wordEnd returns the offset just past the identifier or keyword starting at start, including
+// quoted parts and any qualifiers joined to it by dots
+func wordEnd(query string, start int) int {
+	i := start
+	for i < len(query) {
+		switch c := query[i]; {
+		case c == '`' || c == '"' || c == '[':
+			closing := c
+			if c == '[' {
+				closing = ']'
+			}
+			end := strings.IndexByte(query[i+1:], closing)
+			if end < 0 {
+				return len(query)
+			}
+			i += end + 2
+		case isWordByte(c):
+			for i < len(query) && isWordByte(query[i]) {
+				i++
+			}
+		default:
+			return i
+		}
+		if i >= len(query) || query[i] != '.' {
+			return i
+		}
+		i++
+	}
+	return i
+}
+
+// isWordByte reports whether c can be part of an unquoted identifier or keyword
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// timestampToUTC converts a datetime in location to UTC, keeping any fractional seconds as written
+func timestampToUTC(value string, location *time.Location) (string, bool) {
+	matches := timestampValueRegex.FindStringSubmatch(value)
+	if matches == nil {
+		return "", false
+	}
+	local, err := time.ParseInLocation(time.DateTime, matches[1]+" "+matches[2], location)
+	if err != nil {
+		return "", false
+	}
+	return local.UTC().Format(time.DateTime) + matches[3], true
+}
+
+// insertRows returns the spans of the values in each row of the VALUES list starting at offset
+func insertRows(query string, offset int) [][]valueSpan {
+	var rows [][]valueSpan
+	for {
+		for offset < len(query) && isSpace(query[offset]) {
+			offset++
+		}
+		if offset >= len(query) || query[offset] != '(' {
+			return rows
+		}
+		end := closingParen(query, offset)
+		if end < 0 {
+			return rows
+		}
+		var row []valueSpan
+		start := offset + 1
+		for _, value := range splitTopLevel(query[start:end]) {
+			row = append(row, trimmedSpan(query, start, start+len(value)))
+			start += len(value) + 1
+		}
+		rows = append(rows, row)
+
+		offset = end + 1
+		for offset < len(query) && isSpace(query[offset]) {
+			offset++
+		}
+		if offset >= len(query) || query[offset] != ',' {
+			return rows
+		}
+		offset++
+	}
+}
+
+// updateAssignments returns the columns and value spans of the SET list starting at offset. The
+// last value ends at the first space outside quotes, where WHERE or the other clauses begin; a
+// value that is an expression gets an empty span, so it is never converted.
+func updateAssignments(query string, offset int) ([]string, []valueSpan) {
+	var names []string
+	var spans []valueSpan
+	start := offset
+	for _, assignment := range splitTopLevel(query[offset:]) {
+		end := start + len(assignment)
+		if eq := strings.Index(assignment, "="); eq > 0 {
+			names = append(names, unquoteIdentifier(assignment[:eq]))
+			span := trimmedSpan(query, start+eq+1, end)
+			if token := leadingToken(query[span.start:span.end]); token != len(query[span.start:span.end]) {
+				rest := query[span.start+token : span.end]
+				if token == 0 || !isSpace(rest[0]) {
+					span = valueSpan{}
+				} else {
+					span.end = span.start + token
+				}
+			}
+			spans = append(spans, span)
+		}
+		start = end + 1
+	}
+	return names, spans
+}
+
+// leadingToken returns the length of the quoted string or unquoted word at the start of value
+func leadingToken(value string) int {
+	if strings.HasPrefix(value, "'") {
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '\'':
+				if i+1 < len(value) && value[i+1] == '\'' {
+					i++
+					continue
+				}
+				return i + 1
+			}
+		}
+		return len(value)
+	}
+	i := 0
+	for i < len(value) && !isSpace(value[i]) {
+		i++
+	}
+	return i
+}
+
+// trimmedSpan returns the span of query[start:end] without surrounding whitespace
+func trimmedSpan(query string, start, end int) valueSpan {
+	for start < end && isSpace(query[start]) {
+		start++
+	}
+	for end > start && isSpace(query[end-1]) {
+		end--
+	}
+	return valueSpan{start: start, end: end}
+}
+
+// closingParen returns the offset of the parenthesis closing the one at open, skipping quoted
+// strings and identifiers, or -1 when it is never closed
+func closingParen(query string, open int) int {
+	var quote byte
+	depth := 0
+	for i := open; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote != '`' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// unquoteIdentifier trims whitespace and MySQL or SQLite identifier quotes from a table or column
+// name, dropping any schema qualifier
+func unquoteIdentifier(name string) string {
+	name = strings.TrimSpace(name)
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		name = name[dot+1:]
+	}
+	return strings.Trim(name, "`\"[]")
+}
+
+// isSpace reports whether c is SQL whitespace
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
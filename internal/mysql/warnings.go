@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/go-mysql-org/go-mysql/mysql"
+)
+
+// Warning is a diagnostic raised by the last statement, as reported by SHOW WARNINGS
+type Warning struct {
+	Level   string
+	Code    uint16
+	Message string
+}
+
+// SetWarnings replaces the diagnostics recorded for the last statement
+func (sv *SessionVariables) SetWarnings(warnings []Warning) {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	sv.warnings = warnings
+}
+
+// GetWarnings returns the diagnostics recorded for the last statement
+func (sv *SessionVariables) GetWarnings() []Warning {
+	sv.mu.RLock()
+	defer sv.mu.RUnlock()
+
+	result := make([]Warning, len(sv.warnings))
+	copy(result, sv.warnings)
+	return result
+}
+
+// showWarningsRegex matches SHOW WARNINGS, SHOW COUNT(*) WARNINGS and SHOW WARNINGS LIMIT [offset,] n
+var showWarningsRegex = regexp.MustCompile(`(?i)^\s*show\s+(count\s*\(\s*\*\s*\)\s+)?warnings(?:\s+limit\s+(?:(\d+)\s*,\s*)?(\d+))?\s*;?\s*$`)
+
+// selectWarningCountRegex matches SELECT @@warning_count, which like SHOW WARNINGS must not clear
+// the previous statement's diagnostics
+var selectWarningCountRegex = regexp.MustCompile(`(?i)^\s*select\s+@@(?:session\.)?warning_count\s*;?\s*$`)
+
+// HandleShowWarnings handles SHOW WARNINGS, reporting diagnostics from the previous statement
+func (qh *QueryHandlers) HandleShowWarnings(query string) (*mysql.Result, error) {
+	session := qh.handler.sessionManager.GetOrCreateSession(qh.handler.currentConnection())
+	warnings := session.GetWarnings()
+
+	match := showWarningsRegex.FindStringSubmatch(query)
+	if match != nil && match[1] != "" {
+		resultset, err := mysql.BuildSimpleTextResultset([]string{"@@session.warning_count"}, [][]interface{}{{len(warnings)}})
+		if err != nil {
+			return nil, err
+		}
+		return mysql.NewResult(resultset), nil
+	}
+	if match != nil && match[3] != "" {
+		offset, _ := strconv.Atoi(match[2])
+		limit, _ := strconv.Atoi(match[3])
+		if offset > len(warnings) {
+			offset = len(warnings)
+		}
+		warnings = warnings[offset:]
+		if limit < len(warnings) {
+			warnings = warnings[:limit]
+		}
+	}
+
+	var values [][]interface{}
+	for _, warning := range warnings {
+		values = append(values, []interface{}{warning.Level, warning.Code, warning.Message})
+	}
+
+	resultset, err := mysql.BuildSimpleTextResultset([]string{"Level", "Code", "Message"}, values)
+	if err != nil {
+		return nil, err
+	}
+
+	return mysql.NewResult(resultset), nil
+}
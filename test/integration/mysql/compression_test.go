@@ -0,0 +1,46 @@
+//go:build integration
+// +build integration
+
+package mysql_test
+
+import (
+	"database/sql"
+	"os/exec"
+	"testing"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+)
+
+// Integration test: a client that enables protocol compression falls back to uncompressed packets
+// because the server doesn't advertise CLIENT_COMPRESS, rather than hanging.
+func TestMySQLServer_CompressionFallsBack(t *testing.T) {
+	cmd := exec.Command("../../bin/multitenant-db", "--auth-username=root", "--auth-password=")
+	if _, err := exec.LookPath("../../bin/multitenant-db"); err != nil {
+		cmd = exec.Command("../../../bin/multitenant-db", "--auth-username=root", "--auth-password=")
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start server: %v", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	// Wait for server to start
+	time.Sleep(500 * time.Millisecond)
+
+	db, err := sql.Open("mysql", "root:@tcp(127.0.0.1:3306)/?compress=true&timeout=5s&readTimeout=5s")
+	if err != nil {
+		t.Fatalf("Failed to open connection: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM users").Scan(&count); err != nil {
+		t.Fatalf("Query with compression enabled failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 sample users, got %d", count)
+	}
+}